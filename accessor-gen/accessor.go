@@ -0,0 +1,336 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accessor_gen
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/namer"
+	"github.com/lack-io/gogogen/gogenerator/types"
+	"github.com/lack-io/gogogen/util/log"
+	"github.com/lack-io/gogogen/util/sets"
+)
+
+// These are the comment tags that carry parameters for accessor generation.
+const (
+	tagName        = "gogogen:accessor-gen"
+	settersTagName = tagName + ":setters"
+
+	// tagValuePackage, on a package, asks for getters on every struct in it.
+	tagValuePackage = "package"
+)
+
+func extractTag(name string, t *types.Type) []string {
+	comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
+	return types.ExtractCommentTags("+", comments)[name]
+}
+
+// boolTag returns the value of a true/false tag, or 'def' if it is not set.
+func boolTag(values []string, def bool, where string, name string) bool {
+	if len(values) > 1 {
+		log.Fatalf("%s: found %d %s tags: %q", where, len(values), name, values)
+	}
+	if len(values) == 0 {
+		return def
+	}
+	switch values[0] {
+	case "", "true":
+		return true
+	case "false":
+		return false
+	}
+	log.Fatalf("%s: unsupported %s value: %q", where, name, values[0])
+	return false
+}
+
+// NameSystems returns the name system used by the generators in this package.
+func NameSystems() namer.NameSystems {
+	return namer.NameSystems{
+		"public": namer.NewPublicNamer(0),
+		"raw":    namer.NewRawNamer("", nil),
+	}
+}
+
+// DefaultNameSystem returns the default name system for ordering the types to
+// be processed by the generators in this package.
+func DefaultNameSystem() string {
+	return "public"
+}
+
+// accessor is a field along with the methods generated for it.
+type accessor struct {
+	Member types.Member
+	// The name the methods are made from, such as Name for GetName.
+	Name string
+	// Whether the getter dereferences a pointer to a basic type, the way
+	// protobuf getters of optional fields do.
+	Deref bool
+	// Whether a setter is generated too.
+	Setter bool
+}
+
+// findAccessors returns the accessors of the structs of 'pkg', indexed by
+// type.
+func findAccessors(pkg *types.Package) map[*types.Type][]accessor {
+	ptagValue := ""
+	if values := types.ExtractCommentTags("+", pkg.Comments)[tagName]; len(values) > 0 {
+		ptagValue = values[0]
+		if ptagValue != tagValuePackage {
+			log.Fatalf("Package %v: unsupported %s value: %q", pkg.Path, tagName, ptagValue)
+		}
+	}
+
+	accessors := map[*types.Type][]accessor{}
+	for _, t := range pkg.SortedTypes() {
+		if t.Kind != types.Struct {
+			continue
+		}
+		where := fmt.Sprintf("Type %v", t)
+		if !boolTag(extractTag(tagName, t), ptagValue == tagValuePackage, where, tagName) {
+			continue
+		}
+		setters := boolTag(extractTag(settersTagName, t), false, where, settersTagName)
+
+		for _, m := range t.Members {
+			where := fmt.Sprintf("Type %v, field %s", t, m.Name)
+			tags := types.ExtractCommentTags("+", m.CommentLines)
+			// Unexported fields only get accessors when asked for.
+			if !boolTag(tags[tagName], !namer.IsPrivateGoName(m.Name), where, tagName) {
+				continue
+			}
+			if !isNameable(m.Type) {
+				log.Warnf("%s: not generating accessors, as the type of the field can't be written", where)
+				continue
+			}
+			a := accessor{
+				Member: m,
+				Name:   strings.ToUpper(m.Name[:1]) + m.Name[1:],
+				Deref:  m.Type.Kind == types.Pointer && isBasic(m.Type.Elem),
+				Setter: boolTag(tags[settersTagName], setters, where, settersTagName),
+			}
+			if t.Methods["Get"+a.Name] != nil {
+				log.Warnf("%s: not generating Get%s, which is already defined", where, a.Name)
+				continue
+			}
+			if a.Setter && t.Methods["Set"+a.Name] != nil {
+				log.Warnf("%s: not generating Set%s, which is already defined", where, a.Name)
+				a.Setter = false
+			}
+			accessors[t] = append(accessors[t], a)
+		}
+	}
+	return accessors
+}
+
+// isNameable returns false for the types the raw namer can't write, which are
+// anonymous arrays, as the parser doesn't record their length.
+func isNameable(t *types.Type) bool {
+	if len(t.Name.Package) > 0 {
+		return true
+	}
+	switch t.Kind {
+	case types.Array:
+		return false
+	case types.Pointer, types.Slice, types.Chan:
+		return isNameable(t.Elem)
+	case types.Map:
+		return isNameable(t.Key) && isNameable(t.Elem)
+	}
+	return true
+}
+
+// isBasic returns true if 't' is a builtin type, or a named one of a builtin
+// type.
+func isBasic(t *types.Type) bool {
+	if t.Kind == types.Alias {
+		t = t.Underlying
+	}
+	return t.Kind == types.Builtin
+}
+
+func Packages(context *generator.Context, arguments *args.GeneratorArgs) generator.Packages {
+	boilerplate, err := arguments.LoadGoBoilerplate()
+	if err != nil {
+		log.Fatalf("Failed loading boilerplate: %v", err)
+	}
+
+	packages := generator.Packages{}
+	header := append(arguments.GeneratedBuildConstraint(), boilerplate...)
+
+	for i := range sets.NewString(context.Inputs...) {
+		log.Debugf("Considering pkg %q", i)
+		pkg := context.Universe[i]
+		if pkg == nil {
+			// If the input had no Go files, for example.
+			continue
+		}
+
+		accessors := findAccessors(pkg)
+		if len(accessors) == 0 {
+			continue
+		}
+
+		log.Infof("Package %q needs generation", i)
+		packages = append(packages,
+			&generator.DefaultPackage{
+				PackageName: strings.Split(filepath.Base(pkg.Path), ".")[0],
+				PackagePath: pkg.Path,
+				HeaderText:  header,
+				GeneratorFunc: func(c *generator.Context) (generators []generator.Generator) {
+					return []generator.Generator{
+						NewGenAccessor(arguments.OutputFileName(pkg, "accessor"), pkg.Path, accessors),
+					}
+				},
+				FilterFunc: func(c *generator.Context, t *types.Type) bool {
+					return t.Name.Package == pkg.Path
+				},
+			})
+	}
+	return packages
+}
+
+// genAccessor produces a file with the getters and setters of the structs of
+// a package.
+type genAccessor struct {
+	generator.DefaultGen
+	targetPackage string
+	imports       namer.ImportTracker
+	accessors     map[*types.Type][]accessor
+}
+
+func NewGenAccessor(sanitizedName, targetPackage string, accessors map[*types.Type][]accessor) generator.Generator {
+	return &genAccessor{
+		DefaultGen: generator.DefaultGen{
+			OptionalName: sanitizedName,
+		},
+		targetPackage: targetPackage,
+		imports:       generator.NewImportTracker(),
+		accessors:     accessors,
+	}
+}
+
+func (g *genAccessor) Namers(c *generator.Context) namer.NameSystems {
+	// Have the raw namer for this file track what it imports.
+	return namer.NameSystems{
+		"raw": namer.NewRawNamer(g.targetPackage, g.imports),
+	}
+}
+
+func (g *genAccessor) Filter(c *generator.Context, t *types.Type) bool {
+	_, ok := g.accessors[t]
+	return ok
+}
+
+func (g *genAccessor) isOtherPackage(pkg string) bool {
+	if pkg == g.targetPackage {
+		return false
+	}
+	if strings.HasSuffix(pkg, "\""+g.targetPackage+"\"") {
+		return false
+	}
+	return true
+}
+
+func (g *genAccessor) Imports(c *generator.Context) (imports []string) {
+	importLines := []string{}
+	for _, singleImport := range g.imports.ImportLines() {
+		if g.isOtherPackage(singleImport) {
+			importLines = append(importLines, singleImport)
+		}
+	}
+	return importLines
+}
+
+// zeroValue returns an expression for the zero value of 't'.
+func zeroValue(raw namer.Namer, t *types.Type) string {
+	u := t
+	if u.Kind == types.Alias {
+		u = u.Underlying
+	}
+	switch u.Kind {
+	case types.Builtin:
+		switch {
+		case u == types.String:
+			return `""`
+		case u == types.Bool:
+			return "false"
+		}
+		return "0"
+	case types.Struct, types.Array:
+		return raw.Name(t) + "{}"
+	}
+	return "nil"
+}
+
+func (g *genAccessor) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	log.Infof("Generating accessors for type %v", t)
+
+	raw := c.Namers["raw"]
+	sw := generator.NewSnippetWriter(w, c, "$", "$")
+	for _, a := range g.accessors[t] {
+		args := generator.Args{
+			"type":   t,
+			"name":   a.Name,
+			"field":  a.Member.Name,
+			"member": a.Member.Type,
+		}
+		if a.Deref {
+			args["result"] = a.Member.Type.Elem
+			args["zero"] = zeroValue(raw, a.Member.Type.Elem)
+			sw.Do(derefGetterCode, args)
+		} else {
+			args["result"] = a.Member.Type
+			args["zero"] = zeroValue(raw, a.Member.Type)
+			sw.Do(getterCode, args)
+		}
+		if a.Setter {
+			sw.Do(setterCode, args)
+		}
+	}
+	return sw.Error()
+}
+
+var getterCode = `// Get$.name$ returns the $.field$ field of x, or its zero value if x is nil.
+func (x *$.type|raw$) Get$.name$() $.result|raw$ {
+	if x != nil {
+		return x.$.field$
+	}
+	return $.zero$
+}
+
+`
+
+var derefGetterCode = `// Get$.name$ returns the value $.field$ points to, or the zero value if x or
+// $.field$ is nil.
+func (x *$.type|raw$) Get$.name$() $.result|raw$ {
+	if x != nil && x.$.field$ != nil {
+		return *x.$.field$
+	}
+	return $.zero$
+}
+
+`
+
+var setterCode = `// Set$.name$ sets the $.field$ field of x.
+func (x *$.type|raw$) Set$.name$(v $.member|raw$) {
+	x.$.field$ = v
+}
+
+`
@@ -0,0 +1,493 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package applyconfig_gen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/namer"
+	"github.com/lack-io/gogogen/gogenerator/types"
+	"github.com/lack-io/gogogen/util/log"
+	"github.com/lack-io/gogogen/util/sets"
+)
+
+// This is the comment tag that carries parameters for apply configuration
+// generation.
+const tagName = "gogogen:applyconfig-gen"
+
+// This is the tag value to request generation for all structs of a package.
+const tagValuePackage = "package"
+
+// NameSystems returns the name system used by the generators in this package.
+func NameSystems() namer.NameSystems {
+	return namer.NameSystems{
+		"public": namer.NewPublicNamer(0),
+		"raw":    namer.NewRawNamer("", nil),
+	}
+}
+
+// DefaultNameSystem returns the default name system for ordering the types to
+// be processed by the generators in this package.
+func DefaultNameSystem() string {
+	return "public"
+}
+
+// boolTag returns the value of a true/false tag, or 'def' if it is not set.
+func boolTag(values []string, def bool, where string) bool {
+	if len(values) > 1 {
+		log.Fatalf("%s: found %d %s tags: %q", where, len(values), tagName, values)
+	}
+	if len(values) == 0 {
+		return def
+	}
+	switch values[0] {
+	case "", "true":
+		return true
+	case "false":
+		return false
+	}
+	log.Fatalf("%s: unsupported %s value: %q", where, tagName, values[0])
+	return false
+}
+
+// configName returns the name of the apply configuration of the struct 't'.
+func configName(t *types.Type) types.Name {
+	return types.Name{Package: t.Name.Package, Name: t.Name.Name + "ApplyConfiguration"}
+}
+
+// requestedTypes returns the structs of 'pkg' apply configurations are
+// requested for.
+func requestedTypes(pkg *types.Package) map[*types.Type]bool {
+	ptagValue := ""
+	if values := types.ExtractCommentTags("+", pkg.Comments)[tagName]; len(values) > 0 {
+		ptagValue = values[0]
+		if ptagValue != tagValuePackage {
+			log.Fatalf("Package %v: unsupported %s value: %q", pkg.Path, tagName, ptagValue)
+		}
+	}
+	requested := map[*types.Type]bool{}
+	for _, t := range pkg.SortedTypes() {
+		if t.Kind != types.Struct {
+			continue
+		}
+		comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
+		values := types.ExtractCommentTags("+", comments)[tagName]
+		if !boolTag(values, ptagValue == tagValuePackage, fmt.Sprintf("Type %v", t)) {
+			continue
+		}
+		for _, name := range []string{configName(t).Name, "New" + configName(t).Name, "Extract" + t.Name.Name} {
+			if pkg.Types[name] != nil || pkg.Functions[name] != nil {
+				log.Fatalf("Type %v: %s is already declared in the package", t, name)
+			}
+		}
+		requested[t] = true
+	}
+	return requested
+}
+
+func Packages(context *generator.Context, arguments *args.GeneratorArgs) generator.Packages {
+	boilerplate, err := arguments.LoadGoBoilerplate()
+	if err != nil {
+		log.Fatalf("Failed loading boilerplate: %v", err)
+	}
+
+	packages := generator.Packages{}
+	header := append(arguments.GeneratedBuildConstraint(), boilerplate...)
+
+	// Find every struct with an apply configuration first, so that
+	// configurations can hold those of their fields, in any of the input
+	// packages.
+	requested := map[string]map[*types.Type]bool{}
+	configs := map[*types.Type]bool{}
+	for i := range sets.NewString(context.Inputs...) {
+		log.Debugf("Considering pkg %q", i)
+		pkg := context.Universe[i]
+		if pkg == nil {
+			// If the input had no Go files, for example.
+			continue
+		}
+		if pkgRequested := requestedTypes(pkg); len(pkgRequested) > 0 {
+			requested[i] = pkgRequested
+			for t := range pkgRequested {
+				configs[t] = true
+			}
+		}
+	}
+
+	for i := range requested {
+		pkg := context.Universe[i]
+		log.Infof("Package %q needs generation", i)
+		packages = append(packages,
+			&generator.DefaultPackage{
+				PackageName: strings.Split(filepath.Base(pkg.Path), ".")[0],
+				PackagePath: pkg.Path,
+				HeaderText:  header,
+				GeneratorFunc: func(c *generator.Context) (generators []generator.Generator) {
+					return []generator.Generator{
+						NewGenApplyConfig(arguments.OutputFileName(pkg, "applyconfig"), pkg.Path, requested[pkg.Path], configs),
+					}
+				},
+				FilterFunc: func(c *generator.Context, t *types.Type) bool {
+					return t.Name.Package == pkg.Path
+				},
+			})
+	}
+	return packages
+}
+
+// genApplyConfig produces a file with the apply configurations of the
+// structs of a package.
+type genApplyConfig struct {
+	generator.DefaultGen
+	targetPackage string
+	imports       namer.ImportTracker
+	requested     map[*types.Type]bool
+	// Every struct with an apply configuration, in any package.
+	configs map[*types.Type]bool
+}
+
+func NewGenApplyConfig(sanitizedName, targetPackage string, requested, configs map[*types.Type]bool) generator.Generator {
+	return &genApplyConfig{
+		DefaultGen: generator.DefaultGen{
+			OptionalName: sanitizedName,
+		},
+		targetPackage: targetPackage,
+		imports:       generator.NewImportTracker(),
+		requested:     requested,
+		configs:       configs,
+	}
+}
+
+func (g *genApplyConfig) Namers(c *generator.Context) namer.NameSystems {
+	// Have the raw namer for this file track what it imports.
+	return namer.NameSystems{
+		"raw": namer.NewRawNamer(g.targetPackage, g.imports),
+	}
+}
+
+func (g *genApplyConfig) Filter(c *generator.Context, t *types.Type) bool {
+	return g.requested[t]
+}
+
+func (g *genApplyConfig) isOtherPackage(pkg string) bool {
+	if pkg == g.targetPackage {
+		return false
+	}
+	if strings.HasSuffix(pkg, "\""+g.targetPackage+"\"") {
+		return false
+	}
+	return true
+}
+
+func (g *genApplyConfig) Imports(c *generator.Context) (imports []string) {
+	importLines := []string{"encoding/json"}
+	for _, singleImport := range g.imports.ImportLines() {
+		if g.isOtherPackage(singleImport) {
+			importLines = append(importLines, singleImport)
+		}
+	}
+	return importLines
+}
+
+// isNameable returns false for the types the raw namer can't write, which are
+// anonymous arrays, as the parser doesn't record their length.
+func isNameable(t *types.Type) bool {
+	if len(t.Name.Package) > 0 {
+		return true
+	}
+	switch t.Kind {
+	case types.Array:
+		return false
+	case types.Pointer, types.Slice, types.Chan:
+		return isNameable(t.Elem)
+	case types.Map:
+		return isNameable(t.Key) && isNameable(t.Elem)
+	}
+	return true
+}
+
+// How a field of a configuration holds the value of the field it mirrors,
+// and how its With method sets it.
+type fieldKind int
+
+const (
+	// A pointer to the value, set from a value.
+	kindValue fieldKind = iota
+	// The value itself, which can be nil, set as is.
+	kindNillable
+	// A pointer to a configuration, set as is.
+	kindConfig
+	// A slice, appended to.
+	kindSlice
+	// A slice of configurations, appended to from pointers.
+	kindConfigSlice
+	// A map, added to.
+	kindMap
+)
+
+// configField is a field of a configuration.
+type configField struct {
+	Name string
+	// The type of the field, and of the parameter of its With method.
+	Type  string
+	Param string
+	Kind  fieldKind
+	// The JSON name of the field, empty for an embedded one.
+	JSONName string
+	Embedded bool
+	// The configuration of the struct of an embedded field, if it has one.
+	EmbeddedConfig *types.Type
+}
+
+// configOf returns the struct 't' is, or points to, if it has a
+// configuration.
+func (g *genApplyConfig) configOf(t *types.Type) *types.Type {
+	if t.Kind == types.Pointer {
+		t = t.Elem
+	}
+	if g.configs[t] {
+		return t
+	}
+	return nil
+}
+
+// fields returns the fields of the configuration of the struct 't'.
+func (g *genApplyConfig) fields(raw namer.Namer, t *types.Type) []configField {
+	out := []configField{}
+	for _, m := range t.Members {
+		where := fmt.Sprintf("Type %v, field %s", t, m.Name)
+		if namer.IsPrivateGoName(m.Name) || !boolTag(types.ExtractCommentTags("+", m.CommentLines)[tagName], true, where) {
+			continue
+		}
+		jsonName := m.Name
+		if tag := reflect.StructTag(m.Tags).Get("json"); len(tag) > 0 {
+			if tag == "-" {
+				continue
+			}
+			if name := strings.Split(tag, ",")[0]; len(name) > 0 {
+				jsonName = name
+			}
+		}
+		if !isNameable(m.Type) {
+			log.Warnf("%s: not mirrored, as the type of the field can't be written", where)
+			continue
+		}
+
+		f := configField{Name: m.Name, JSONName: jsonName}
+		mt := m.Type
+		switch {
+		case m.Embedded:
+			f.Embedded, f.JSONName = true, ""
+			if c := g.configOf(mt); c != nil {
+				f.Name = configName(c).Name
+				f.Type = "*" + raw.Name(&types.Type{Name: configName(c)})
+				f.Param = f.Type
+				f.Kind = kindConfig
+				f.EmbeddedConfig = c
+			} else {
+				if mt.Kind == types.Pointer {
+					mt = mt.Elem
+				}
+				f.Name = mt.Name.Name
+				f.Type = "*" + raw.Name(mt)
+				f.Param = raw.Name(mt)
+				f.Kind = kindValue
+			}
+		case g.configOf(mt) != nil:
+			f.Type = "*" + raw.Name(&types.Type{Name: configName(g.configOf(mt))})
+			f.Param = f.Type
+			f.Kind = kindConfig
+		case mt.Kind == types.Slice && mt.Elem != types.Byte && g.configOf(mt.Elem) != nil:
+			config := raw.Name(&types.Type{Name: configName(g.configOf(mt.Elem))})
+			f.Type = "[]" + config
+			f.Param = "*" + config
+			f.Kind = kindConfigSlice
+		case mt.Kind == types.Slice && mt.Elem != types.Byte:
+			f.Type = raw.Name(mt)
+			f.Param = raw.Name(mt.Elem)
+			f.Kind = kindSlice
+		case mt.Kind == types.Map && g.configOf(mt.Elem) != nil && mt.Elem.Kind != types.Pointer:
+			f.Type = "map[" + raw.Name(mt.Key) + "]" + raw.Name(&types.Type{Name: configName(mt.Elem)})
+			f.Param = f.Type
+			f.Kind = kindMap
+		case mt.Kind == types.Map:
+			f.Type = raw.Name(mt)
+			f.Param = f.Type
+			f.Kind = kindMap
+		case mt.Kind == types.Pointer:
+			f.Type = raw.Name(mt)
+			f.Param = raw.Name(mt.Elem)
+			f.Kind = kindValue
+		case mt.Kind == types.Slice, mt.Kind == types.Interface, mt.Kind == types.Func, mt.Kind == types.Chan:
+			f.Type = raw.Name(mt)
+			f.Param = f.Type
+			f.Kind = kindNillable
+		default:
+			f.Type = "*" + raw.Name(mt)
+			f.Param = raw.Name(mt)
+			f.Kind = kindValue
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+func (g *genApplyConfig) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	log.Infof("Generating apply configuration for type %v", t)
+
+	raw := c.Namers["raw"]
+	config := raw.Name(&types.Type{Name: configName(t)})
+	fields := g.fields(raw, t)
+
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "// %s holds the fields of a %s to apply.\n", config, t.Name.Name)
+	fmt.Fprintf(b, "// The fields left nil are left to other appliers.\n")
+	fmt.Fprintf(b, "type %s struct {\n", config)
+	for _, f := range fields {
+		if f.Embedded {
+			fmt.Fprintf(b, "%s `json:\",omitempty\"`\n", f.Type)
+			continue
+		}
+		fmt.Fprintf(b, "%s %s `json:\"%s,omitempty\"`\n", f.Name, f.Type, f.JSONName)
+	}
+	fmt.Fprintf(b, "}\n\n")
+
+	fmt.Fprintf(b, "// New%s returns an apply configuration with no fields set.\n", config)
+	fmt.Fprintf(b, "func New%s() *%s {\n", config, config)
+	fmt.Fprintf(b, "return &%s{}\n", config)
+	fmt.Fprintf(b, "}\n\n")
+
+	declared := map[string]bool{}
+	for _, f := range fields {
+		declared["With"+f.Name] = true
+	}
+	for _, f := range fields {
+		writeWith(b, config, f)
+	}
+	// The fields of embedded configurations get With methods here too, so
+	// that calls on the embedding configuration can be chained.
+	for _, f := range fields {
+		if f.EmbeddedConfig == nil {
+			continue
+		}
+		for _, ef := range g.fields(raw, f.EmbeddedConfig) {
+			if declared["With"+ef.Name] {
+				continue
+			}
+			declared["With"+ef.Name] = true
+			writeEmbeddedWith(b, config, f, ef)
+		}
+	}
+
+	fmt.Fprintf(b, "// ToUnstructured returns the fields set in the apply configuration, as they\n")
+	fmt.Fprintf(b, "// would be decoded from JSON.\n")
+	fmt.Fprintf(b, "func (c *%s) ToUnstructured() (map[string]interface{}, error) {\n", config)
+	fmt.Fprintf(b, "data, err := json.Marshal(c)\n")
+	fmt.Fprintf(b, "if err != nil {\n")
+	fmt.Fprintf(b, "return nil, err\n")
+	fmt.Fprintf(b, "}\n")
+	fmt.Fprintf(b, "u := map[string]interface{}{}\n")
+	fmt.Fprintf(b, "if err := json.Unmarshal(data, &u); err != nil {\n")
+	fmt.Fprintf(b, "return nil, err\n")
+	fmt.Fprintf(b, "}\n")
+	fmt.Fprintf(b, "return u, nil\n")
+	fmt.Fprintf(b, "}\n\n")
+
+	fmt.Fprintf(b, "// Extract%s returns the apply configuration of the fields set in u, an\n", t.Name.Name)
+	fmt.Fprintf(b, "// unstructured %s as decoded from JSON.\n", t.Name.Name)
+	fmt.Fprintf(b, "func Extract%s(u map[string]interface{}) (*%s, error) {\n", t.Name.Name, config)
+	fmt.Fprintf(b, "data, err := json.Marshal(u)\n")
+	fmt.Fprintf(b, "if err != nil {\n")
+	fmt.Fprintf(b, "return nil, err\n")
+	fmt.Fprintf(b, "}\n")
+	fmt.Fprintf(b, "c := &%s{}\n", config)
+	fmt.Fprintf(b, "if err := json.Unmarshal(data, c); err != nil {\n")
+	fmt.Fprintf(b, "return nil, err\n")
+	fmt.Fprintf(b, "}\n")
+	fmt.Fprintf(b, "return c, nil\n")
+	fmt.Fprintf(b, "}\n\n")
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// writeWith writes the With method of the field 'f' of 'config'.
+func writeWith(b *bytes.Buffer, config string, f configField) {
+	switch f.Kind {
+	case kindValue:
+		fmt.Fprintf(b, "// With%s sets the %s field.\n", f.Name, f.Name)
+		fmt.Fprintf(b, "func (c *%s) With%s(v %s) *%s {\n", config, f.Name, f.Param, config)
+		fmt.Fprintf(b, "c.%s = &v\n", f.Name)
+	case kindNillable, kindConfig:
+		fmt.Fprintf(b, "// With%s sets the %s field.\n", f.Name, f.Name)
+		fmt.Fprintf(b, "func (c *%s) With%s(v %s) *%s {\n", config, f.Name, f.Param, config)
+		fmt.Fprintf(b, "c.%s = v\n", f.Name)
+	case kindSlice:
+		fmt.Fprintf(b, "// With%s appends to the %s field.\n", f.Name, f.Name)
+		fmt.Fprintf(b, "func (c *%s) With%s(values ...%s) *%s {\n", config, f.Name, f.Param, config)
+		fmt.Fprintf(b, "c.%s = append(c.%s, values...)\n", f.Name, f.Name)
+	case kindConfigSlice:
+		fmt.Fprintf(b, "// With%s appends to the %s field. It panics if any value is nil.\n", f.Name, f.Name)
+		fmt.Fprintf(b, "func (c *%s) With%s(values ...%s) *%s {\n", config, f.Name, f.Param, config)
+		fmt.Fprintf(b, "for _, v := range values {\n")
+		fmt.Fprintf(b, "if v == nil {\n")
+		fmt.Fprintf(b, "panic(\"nil value passed to With%s\")\n", f.Name)
+		fmt.Fprintf(b, "}\n")
+		fmt.Fprintf(b, "c.%s = append(c.%s, *v)\n", f.Name, f.Name)
+		fmt.Fprintf(b, "}\n")
+	case kindMap:
+		fmt.Fprintf(b, "// With%s adds the entries to the %s field, replacing those with the\n", f.Name, f.Name)
+		fmt.Fprintf(b, "// same keys.\n")
+		fmt.Fprintf(b, "func (c *%s) With%s(entries %s) *%s {\n", config, f.Name, f.Param, config)
+		fmt.Fprintf(b, "if c.%s == nil && len(entries) > 0 {\n", f.Name)
+		fmt.Fprintf(b, "c.%s = make(%s, len(entries))\n", f.Name, f.Type)
+		fmt.Fprintf(b, "}\n")
+		fmt.Fprintf(b, "for k, v := range entries {\n")
+		fmt.Fprintf(b, "c.%s[k] = v\n", f.Name)
+		fmt.Fprintf(b, "}\n")
+	}
+	fmt.Fprintf(b, "return c\n")
+	fmt.Fprintf(b, "}\n\n")
+}
+
+// writeEmbeddedWith writes a With method of 'config' setting the field 'ef'
+// of the configuration embedded as 'f'.
+func writeEmbeddedWith(b *bytes.Buffer, config string, f, ef configField) {
+	param := "v " + ef.Param
+	arg := "v"
+	switch ef.Kind {
+	case kindSlice, kindConfigSlice:
+		param = "values ..." + ef.Param
+		arg = "values..."
+	case kindMap:
+		param = "entries " + ef.Param
+		arg = "entries"
+	}
+	fmt.Fprintf(b, "// With%s calls With%s of the embedded %s.\n", ef.Name, ef.Name, f.Name)
+	fmt.Fprintf(b, "func (c *%s) With%s(%s) *%s {\n", config, ef.Name, param, config)
+	fmt.Fprintf(b, "if c.%s == nil {\n", f.Name)
+	fmt.Fprintf(b, "c.%s = &%s{}\n", f.Name, strings.TrimPrefix(f.Type, "*"))
+	fmt.Fprintf(b, "}\n")
+	fmt.Fprintf(b, "c.%s.With%s(%s)\n", f.Name, ef.Name, arg)
+	fmt.Fprintf(b, "return c\n")
+	fmt.Fprintf(b, "}\n\n")
+}
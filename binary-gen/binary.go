@@ -0,0 +1,618 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binary_gen
+
+import (
+	"fmt"
+	"hash/fnv"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/namer"
+	"github.com/lack-io/gogogen/gogenerator/types"
+	"github.com/lack-io/gogogen/util/log"
+	"github.com/lack-io/gogogen/util/sets"
+)
+
+// These are the comment tags that carry parameters for binary codec
+// generation.
+const (
+	tagName = "gogogen:binary-gen"
+	// The version written in the header of encoded values, 1 by default.
+	// Bumping it invalidates values encoded before, when their meaning
+	// changes without their layout changing.
+	versionTagName = tagName + ":version"
+
+	// tagValuePackage, on a package, asks for the methods of every struct in
+	// it.
+	tagValuePackage = "package"
+)
+
+// structTagName is the struct tag which, set to "-", leaves a field out.
+const structTagName = "binary"
+
+// binutilPackage holds the helpers the generated code calls.
+const binutilPackage = "github.com/lack-io/gogogen/runtime/binutil"
+
+// NameSystems returns the name system used by the generators in this package.
+func NameSystems() namer.NameSystems {
+	return namer.NameSystems{
+		"public": namer.NewPublicNamer(0),
+		"raw":    namer.NewRawNamer("", nil),
+	}
+}
+
+// DefaultNameSystem returns the default name system for ordering the types to
+// be processed by the generators in this package.
+func DefaultNameSystem() string {
+	return "public"
+}
+
+// wantsBinary returns true if binary methods are requested for 't', either by
+// its own tag or by the tag of its package.
+func wantsBinary(t *types.Type, ptagValue string) bool {
+	comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
+	values := types.ExtractCommentTags("+", comments)[tagName]
+	if len(values) > 1 {
+		log.Fatalf("Type %v: found %d %s tags: %q", t, len(values), tagName, values)
+	}
+	if len(values) == 1 {
+		switch values[0] {
+		case "", "true":
+			return true
+		case "false":
+			return false
+		default:
+			log.Fatalf("Type %v: unsupported %s value: %q", t, tagName, values[0])
+		}
+	}
+	return ptagValue == tagValuePackage
+}
+
+// versionOf returns the version of the layout of 't'.
+func versionOf(t *types.Type) uint64 {
+	comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
+	values := types.ExtractCommentTags("+", comments)[versionTagName]
+	if len(values) == 0 {
+		return 1
+	}
+	version, err := strconv.ParseUint(values[0], 10, 64)
+	if len(values) > 1 || err != nil {
+		log.Fatalf("Type %v: invalid %s tags: %q", t, versionTagName, values)
+	}
+	return version
+}
+
+func Packages(context *generator.Context, arguments *args.GeneratorArgs) generator.Packages {
+	boilerplate, err := arguments.LoadGoBoilerplate()
+	if err != nil {
+		log.Fatalf("Failed loading boilerplate: %v", err)
+	}
+
+	packages := generator.Packages{}
+	header := append(arguments.GeneratedBuildConstraint(), boilerplate...)
+
+	for i := range sets.NewString(context.Inputs...) {
+		log.Debugf("Considering pkg %q", i)
+		pkg := context.Universe[i]
+		if pkg == nil {
+			// If the input had no Go files, for example.
+			continue
+		}
+
+		ptagValue := ""
+		if values := types.ExtractCommentTags("+", pkg.Comments)[tagName]; len(values) > 0 {
+			ptagValue = values[0]
+			if ptagValue != tagValuePackage {
+				log.Fatalf("Package %v: unsupported %s value: %q", i, tagName, ptagValue)
+			}
+		}
+
+		structs := map[*types.Type]bool{}
+		for _, t := range pkg.SortedTypes() {
+			if t.Kind == types.Struct && wantsBinary(t, ptagValue) {
+				structs[t] = true
+			}
+		}
+		if len(structs) == 0 {
+			continue
+		}
+
+		log.Infof("Package %q needs generation", i)
+		packages = append(packages,
+			&generator.DefaultPackage{
+				PackageName: strings.Split(filepath.Base(pkg.Path), ".")[0],
+				PackagePath: pkg.Path,
+				HeaderText:  header,
+				GeneratorFunc: func(c *generator.Context) (generators []generator.Generator) {
+					return []generator.Generator{
+						NewGenBinary(arguments.OutputFileName(pkg, "binary"), pkg.Path, structs),
+					}
+				},
+				FilterFunc: func(c *generator.Context, t *types.Type) bool {
+					return t.Name.Package == pkg.Path
+				},
+			})
+	}
+	return packages
+}
+
+func isExported(name string) bool {
+	r, _ := utf8.DecodeRuneInString(name)
+	return unicode.IsUpper(r)
+}
+
+// binaryFields returns the members of 't' which are encoded, in order.
+func binaryFields(t *types.Type) []types.Member {
+	fields := []types.Member{}
+	for _, m := range t.Members {
+		switch tag := reflect.StructTag(m.Tags).Get(structTagName); tag {
+		case "-":
+			continue
+		case "":
+		default:
+			log.Fatalf("Type %v: unsupported %s tag %q on member %s", t, structTagName, tag, m.Name)
+		}
+		if isExported(m.Name) {
+			fields = append(fields, m)
+		}
+	}
+	return fields
+}
+
+func underlying(t *types.Type) *types.Type {
+	if t.Kind == types.Alias {
+		return t.Underlying
+	}
+	return t
+}
+
+// builtinName returns the name of the builtin underlying 't', or "".
+func builtinName(t *types.Type) string {
+	if u := underlying(t); u.Kind == types.Builtin {
+		return u.Name.Name
+	}
+	return ""
+}
+
+// genBinary produces a file with the binary methods of the structs of a
+// package.
+type genBinary struct {
+	generator.DefaultGen
+	targetPackage string
+	imports       namer.ImportTracker
+	structs       map[*types.Type]bool
+}
+
+func NewGenBinary(sanitizedName, targetPackage string, structs map[*types.Type]bool) generator.Generator {
+	return &genBinary{
+		DefaultGen: generator.DefaultGen{
+			OptionalName: sanitizedName,
+		},
+		targetPackage: targetPackage,
+		imports:       generator.NewImportTracker(),
+		structs:       structs,
+	}
+}
+
+func (g *genBinary) Namers(c *generator.Context) namer.NameSystems {
+	// Have the raw namer for this file track what it imports.
+	return namer.NameSystems{
+		"raw": namer.NewRawNamer(g.targetPackage, g.imports),
+	}
+}
+
+func (g *genBinary) Filter(c *generator.Context, t *types.Type) bool {
+	return g.structs[t]
+}
+
+func (g *genBinary) isOtherPackage(pkg string) bool {
+	if pkg == g.targetPackage {
+		return false
+	}
+	if strings.HasSuffix(pkg, "\""+g.targetPackage+"\"") {
+		return false
+	}
+	return true
+}
+
+func (g *genBinary) Imports(c *generator.Context) (imports []string) {
+	importLines := []string{}
+	for _, singleImport := range g.imports.ImportLines() {
+		if g.isOtherPackage(singleImport) {
+			importLines = append(importLines, singleImport)
+		}
+	}
+	return importLines
+}
+
+// valueKind says how the generated code encodes a value.
+type valueKind int
+
+const (
+	unsupportedKind valueKind = iota
+	// The type has binary-gen methods of its own, generated or not.
+	selfKind
+	// The type has MarshalBinary and UnmarshalBinary methods.
+	marshalerKind
+	stringKind
+	boolKind
+	byteKind
+	intKind
+	uintKind
+	float32Kind
+	float64Kind
+	byteSliceKind
+	pointerKind
+	sliceKind
+	arrayKind
+	mapKind
+)
+
+func (g *genBinary) kindOf(t *types.Type) valueKind {
+	if g.structs[t] {
+		return selfKind
+	}
+	if _, ok := t.Methods["AppendBinary"]; ok {
+		if _, ok := t.Methods["UnmarshalBinaryFrom"]; ok {
+			return selfKind
+		}
+	}
+	if _, ok := t.Methods["MarshalBinary"]; ok {
+		if _, ok := t.Methods["UnmarshalBinary"]; ok {
+			return marshalerKind
+		}
+	}
+	switch name := builtinName(t); {
+	case name == "string":
+		return stringKind
+	case name == "bool":
+		return boolKind
+	case name == "byte" || name == "uint8":
+		return byteKind
+	case name == "float32":
+		return float32Kind
+	case name == "float64":
+		return float64Kind
+	case strings.HasPrefix(name, "uint"):
+		return uintKind
+	case strings.HasPrefix(name, "int") || name == "rune":
+		return intKind
+	case name != "":
+		return unsupportedKind
+	}
+	switch u := underlying(t); u.Kind {
+	case types.Pointer:
+		return pointerKind
+	case types.Slice:
+		if u.Elem.Kind == types.Builtin && (u.Elem.Name.Name == "byte" || u.Elem.Name.Name == "uint8") {
+			return byteSliceKind
+		}
+		return sliceKind
+	case types.Array:
+		return arrayKind
+	case types.Map:
+		return mapKind
+	}
+	return unsupportedKind
+}
+
+// layout describes how values of 't' are encoded. Two types with the same
+// layout have the same encoding; the names of members and of structs, and the
+// versions of nested structs, are part of it, so that changing them
+// invalidates encoded values as well.
+func (g *genBinary) layout(t *types.Type, seen map[*types.Type]bool) string {
+	kind := g.kindOf(t)
+	switch kind {
+	case selfKind:
+		if !g.structs[t] || seen[t] {
+			return t.String()
+		}
+		seen[t] = true
+		parts := []string{}
+		for _, m := range binaryFields(t) {
+			parts = append(parts, m.Name+" "+g.layout(m.Type, seen))
+		}
+		return fmt.Sprintf("%v@%d{%s}", t, versionOf(t), strings.Join(parts, "; "))
+	case marshalerKind:
+		return t.String()
+	case pointerKind:
+		return "*" + g.layout(underlying(t).Elem, seen)
+	case sliceKind, byteSliceKind:
+		return "[]" + g.layout(underlying(t).Elem, seen)
+	case arrayKind:
+		name := underlying(t).Name.Name
+		return name[:strings.Index(name, "]")+1] + g.layout(underlying(t).Elem, seen)
+	case mapKind:
+		u := underlying(t)
+		return "map[" + g.layout(u.Key, seen) + "]" + g.layout(u.Elem, seen)
+	}
+	// Named builtins are encoded like their builtin.
+	return builtinName(t)
+}
+
+// layoutHash returns the hash of the layout of 't' written in the headers of
+// encoded values.
+func (g *genBinary) layoutHash(t *types.Type) uint32 {
+	h := fnv.New32a()
+	io.WriteString(h, g.layout(t, map[*types.Type]bool{}))
+	return h.Sum32()
+}
+
+// baseArgs returns the template arguments shared by all snippets.
+func baseArgs() generator.Args {
+	args := generator.Args{}
+	for _, name := range []string{"Writer", "Reader", "NewWriter", "NewReader"} {
+		args[name] = types.Ref(binutilPackage, name)
+	}
+	return args
+}
+
+func (g *genBinary) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	log.Infof("Generating binary methods for type %v", t)
+
+	sw := generator.NewSnippetWriter(w, c, "$", "$")
+	e := &emitter{g: g, sw: sw, t: t}
+	args := baseArgs().With("type", t).
+		With("version", versionOf(t)).
+		With("layout", fmt.Sprintf("%#08x", g.layoutHash(t))).
+		// The size of the value in memory is a fair guess of its encoded
+		// size.
+		With("size", t.Size+8)
+
+	sw.Do("// MarshalBinary implements encoding.BinaryMarshaler.\n", nil)
+	sw.Do("func (in $.type|raw$) MarshalBinary() ([]byte, error) {\n", args)
+	sw.Do("w := $.NewWriter|raw$($.size$)\n", args)
+	sw.Do("w.Header($.version$, $.layout$)\n", args)
+	sw.Do("in.AppendBinary(w)\n", nil)
+	sw.Do("return w.Bytes()\n", nil)
+	sw.Do("}\n\n", nil)
+
+	sw.Do("// AppendBinary writes the fields of in to w, without a header.\n", nil)
+	sw.Do("func (in *$.type|raw$) AppendBinary(w *$.Writer|raw$) {\n", args)
+	for _, m := range binaryFields(t) {
+		e.writeMarshalValue("in."+m.Name, m.Type, 1)
+	}
+	sw.Do("}\n\n", nil)
+
+	sw.Do("// UnmarshalBinary implements encoding.BinaryUnmarshaler. It fails for data\n", nil)
+	sw.Do("// written for another version or layout of the type.\n", nil)
+	sw.Do("func (out *$.type|raw$) UnmarshalBinary(data []byte) error {\n", args)
+	sw.Do("r := $.NewReader|raw$(data)\n", args)
+	sw.Do("r.Header($.version$, $.layout$)\n", args)
+	sw.Do("out.UnmarshalBinaryFrom(r)\n", nil)
+	sw.Do("r.End()\n", nil)
+	sw.Do("return r.Error()\n", nil)
+	sw.Do("}\n\n", nil)
+
+	sw.Do("// UnmarshalBinaryFrom reads the fields of out from r.\n", nil)
+	sw.Do("func (out *$.type|raw$) UnmarshalBinaryFrom(r *$.Reader|raw$) {\n", args)
+	for _, m := range binaryFields(t) {
+		e.writeUnmarshalValue("out."+m.Name, m.Type, 1)
+	}
+	sw.Do("}\n\n", nil)
+	return sw.Error()
+}
+
+// emitter writes the code encoding and decoding the members of a struct.
+type emitter struct {
+	g  *genBinary
+	sw *generator.SnippetWriter
+	// The struct being generated for.
+	t *types.Type
+}
+
+func (e *emitter) kindOf(t *types.Type) valueKind {
+	kind := e.g.kindOf(t)
+	if kind == unsupportedKind {
+		log.Fatalf("Type %v: values of type %v can not be encoded; annotate the type for binary-gen, or give it MarshalBinary and UnmarshalBinary methods", e.t, t)
+	}
+	return kind
+}
+
+// convert returns 'expr', of type 't', converted to the builtin 'to'.
+func convert(to, expr string, t *types.Type) string {
+	if t.Kind == types.Builtin && t.Name.Name == to {
+		return expr
+	}
+	return to + "(" + expr + ")"
+}
+
+func intBits(name string) string {
+	switch name {
+	case "int8":
+		return "8"
+	case "int16", "uint16":
+		return "16"
+	case "int32", "uint32", "rune":
+		return "32"
+	case "int64", "uint64":
+		return "64"
+	}
+	// The size of int, uint and uintptr.
+	return "0"
+}
+
+func loopVar(name string, depth int) string {
+	return name + strconv.Itoa(depth)
+}
+
+// writeMarshalValue emits code writing the addressable value 'expr' of type
+// 't' to w. Loop variables are numbered by 'depth'.
+func (e *emitter) writeMarshalValue(expr string, t *types.Type, depth int) {
+	u := underlying(t)
+	args := generator.Args{"expr": expr, "i": loopVar("i", depth), "k": loopVar("k", depth), "v": loopVar("v", depth)}
+	sw := e.sw
+	switch e.kindOf(t) {
+	case selfKind:
+		sw.Do("$.expr$.AppendBinary(w)\n", args)
+	case marshalerKind:
+		sw.Do("w.Marshal(&$.expr$)\n", args)
+	case stringKind:
+		sw.Do("w.String($.$)\n", convert("string", expr, t))
+	case boolKind:
+		sw.Do("w.Bool($.$)\n", convert("bool", expr, t))
+	case byteKind:
+		sw.Do("w.Byte($.$)\n", convert("byte", expr, t))
+	case intKind:
+		sw.Do("w.Int($.$)\n", convert("int64", expr, t))
+	case uintKind:
+		sw.Do("w.Uint($.$)\n", convert("uint64", expr, t))
+	case float32Kind:
+		sw.Do("w.Float32($.$)\n", convert("float32", expr, t))
+	case float64Kind:
+		sw.Do("w.Float64($.$)\n", convert("float64", expr, t))
+	case byteSliceKind:
+		if t.Kind == types.Slice {
+			sw.Do("w.ByteSlice($.expr$)\n", args)
+		} else {
+			sw.Do("w.ByteSlice([]byte($.expr$))\n", args)
+		}
+	case pointerKind:
+		sw.Do("w.Bool($.expr$ != nil)\n", args)
+		sw.Do("if $.expr$ != nil {\n", args)
+		if e.g.kindOf(u.Elem) == selfKind {
+			e.writeMarshalValue(expr, u.Elem, depth)
+		} else {
+			e.writeMarshalValue("(*"+expr+")", u.Elem, depth)
+		}
+		sw.Do("}\n", nil)
+	case sliceKind:
+		sw.Do("if $.expr$ == nil {\n", args)
+		sw.Do("w.Len(-1)\n", nil)
+		sw.Do("} else {\n", nil)
+		sw.Do("w.Len(len($.expr$))\n", args)
+		sw.Do("for $.i$ := range $.expr$ {\n", args)
+		e.writeMarshalValue(expr+"["+loopVar("i", depth)+"]", u.Elem, depth+1)
+		sw.Do("}\n", nil)
+		sw.Do("}\n", nil)
+	case arrayKind:
+		sw.Do("for $.i$ := range $.expr$ {\n", args)
+		e.writeMarshalValue(expr+"["+loopVar("i", depth)+"]", u.Elem, depth+1)
+		sw.Do("}\n", nil)
+	case mapKind:
+		sw.Do("if $.expr$ == nil {\n", args)
+		sw.Do("w.Len(-1)\n", nil)
+		sw.Do("} else {\n", nil)
+		sw.Do("w.Len(len($.expr$))\n", args)
+		sw.Do("for $.k$, $.v$ := range $.expr$ {\n", args)
+		e.writeMarshalValue(loopVar("k", depth), u.Key, depth+1)
+		e.writeMarshalValue(loopVar("v", depth), u.Elem, depth+1)
+		sw.Do("}\n", nil)
+		sw.Do("}\n", nil)
+	}
+}
+
+// writeUnmarshalValue emits code reading the addressable value 'expr' of type
+// 't' from r. Loop variables are numbered by 'depth'.
+func (e *emitter) writeUnmarshalValue(expr string, t *types.Type, depth int) {
+	u := underlying(t)
+	args := generator.Args{
+		"expr": expr,
+		"type": t,
+		"elem": u.Elem,
+		"key":  u.Key,
+		"i":    loopVar("i", depth),
+		"n":    loopVar("n", depth),
+		"k":    loopVar("k", depth),
+		"v":    loopVar("v", depth),
+	}
+	sw := e.sw
+	read, readType := "", ""
+	switch e.kindOf(t) {
+	case selfKind:
+		sw.Do("$.expr$.UnmarshalBinaryFrom(r)\n", args)
+		return
+	case marshalerKind:
+		sw.Do("r.Unmarshal(&$.expr$)\n", args)
+		return
+	case stringKind:
+		read, readType = "r.String()", "string"
+	case boolKind:
+		read, readType = "r.Bool()", "bool"
+	case byteKind:
+		read, readType = "r.Byte()", builtinName(t)
+	case intKind:
+		read, readType = "r.Int("+intBits(builtinName(t))+")", "int64"
+	case uintKind:
+		read, readType = "r.Uint("+intBits(builtinName(t))+")", "uint64"
+	case float32Kind:
+		read, readType = "r.Float32()", "float32"
+	case float64Kind:
+		read, readType = "r.Float64()", "float64"
+	case byteSliceKind:
+		if t.Kind == types.Slice {
+			sw.Do("$.expr$ = r.ByteSlice()\n", args)
+		} else {
+			sw.Do("$.expr$ = $.type|raw$(r.ByteSlice())\n", args)
+		}
+		return
+	case pointerKind:
+		sw.Do("if r.Bool() {\n", nil)
+		sw.Do("if $.expr$ == nil {\n", args)
+		sw.Do("$.expr$ = new($.elem|raw$)\n", args)
+		sw.Do("}\n", nil)
+		if e.g.kindOf(u.Elem) == selfKind {
+			e.writeUnmarshalValue(expr, u.Elem, depth)
+		} else {
+			e.writeUnmarshalValue("(*"+expr+")", u.Elem, depth)
+		}
+		sw.Do("} else {\n", nil)
+		sw.Do("$.expr$ = nil\n", args)
+		sw.Do("}\n", nil)
+		return
+	case sliceKind:
+		sw.Do("if $.n$ := r.Len(); $.n$ < 0 {\n", args)
+		sw.Do("$.expr$ = nil\n", args)
+		sw.Do("} else {\n", nil)
+		sw.Do("$.expr$ = make($.type|raw$, $.n$)\n", args)
+		sw.Do("for $.i$ := range $.expr$ {\n", args)
+		e.writeUnmarshalValue(expr+"["+loopVar("i", depth)+"]", u.Elem, depth+1)
+		sw.Do("}\n", nil)
+		sw.Do("}\n", nil)
+		return
+	case arrayKind:
+		sw.Do("for $.i$ := range $.expr$ {\n", args)
+		e.writeUnmarshalValue(expr+"["+loopVar("i", depth)+"]", u.Elem, depth+1)
+		sw.Do("}\n", nil)
+		return
+	case mapKind:
+		sw.Do("if $.n$ := r.Len(); $.n$ < 0 {\n", args)
+		sw.Do("$.expr$ = nil\n", args)
+		sw.Do("} else {\n", nil)
+		sw.Do("$.expr$ = make($.type|raw$, $.n$)\n", args)
+		sw.Do("for $.i$ := 0; $.i$ < $.n$; $.i$++ {\n", args)
+		sw.Do("var $.k$ $.key|raw$\n", args)
+		e.writeUnmarshalValue(loopVar("k", depth), u.Key, depth+1)
+		sw.Do("var $.v$ $.elem|raw$\n", args)
+		e.writeUnmarshalValue(loopVar("v", depth), u.Elem, depth+1)
+		sw.Do("$.expr$[$.k$] = $.v$\n", args)
+		sw.Do("}\n", nil)
+		sw.Do("}\n", nil)
+		return
+	}
+	if t.Kind == types.Builtin && t.Name.Name == readType {
+		sw.Do("$.expr$ = $.read$\n", args.With("read", read))
+	} else {
+		sw.Do("$.expr$ = $.type|raw$($.read$)\n", args.With("read", read))
+	}
+}
@@ -0,0 +1,379 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package builder_gen
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/namer"
+	"github.com/lack-io/gogogen/gogenerator/types"
+	"github.com/lack-io/gogogen/util/log"
+	"github.com/lack-io/gogogen/util/sets"
+)
+
+// This is the comment tag that carries parameters for builder generation.
+const tagName = "gogogen:builder-gen"
+
+// tagValuePackage, on a package, asks for builders of every struct in it.
+const tagValuePackage = "package"
+
+// NameSystems returns the name system used by the generators in this package.
+func NameSystems() namer.NameSystems {
+	return namer.NameSystems{
+		"public": namer.NewPublicNamer(0),
+		"raw":    namer.NewRawNamer("", nil),
+	}
+}
+
+// DefaultNameSystem returns the default name system for ordering the types to
+// be processed by the generators in this package.
+func DefaultNameSystem() string {
+	return "public"
+}
+
+// boolTag returns the value of a true/false tag, or 'def' if it is not set.
+func boolTag(values []string, def bool, where string) bool {
+	if len(values) > 1 {
+		log.Fatalf("%s: found %d %s tags: %q", where, len(values), tagName, values)
+	}
+	if len(values) == 0 {
+		return def
+	}
+	switch values[0] {
+	case "", "true":
+		return true
+	case "false":
+		return false
+	}
+	log.Fatalf("%s: unsupported %s value: %q", where, tagName, values[0])
+	return false
+}
+
+// requestedTypes returns the structs of 'pkg' builders are requested for.
+func requestedTypes(pkg *types.Package) map[*types.Type]bool {
+	ptagValue := ""
+	if values := types.ExtractCommentTags("+", pkg.Comments)[tagName]; len(values) > 0 {
+		ptagValue = values[0]
+		if ptagValue != tagValuePackage {
+			log.Fatalf("Package %v: unsupported %s value: %q", pkg.Path, tagName, ptagValue)
+		}
+	}
+	requested := map[*types.Type]bool{}
+	for _, t := range pkg.SortedTypes() {
+		if t.Kind != types.Struct {
+			continue
+		}
+		comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
+		values := types.ExtractCommentTags("+", comments)[tagName]
+		if !boolTag(values, ptagValue == tagValuePackage, fmt.Sprintf("Type %v", t)) {
+			continue
+		}
+		for _, name := range []string{t.Name.Name + "Builder", "New" + t.Name.Name + "Builder"} {
+			if pkg.Types[name] != nil || pkg.Functions[name] != nil {
+				log.Fatalf("Type %v: %s is already declared in the package", t, name)
+			}
+		}
+		requested[t] = true
+	}
+	return requested
+}
+
+func Packages(context *generator.Context, arguments *args.GeneratorArgs) generator.Packages {
+	boilerplate, err := arguments.LoadGoBoilerplate()
+	if err != nil {
+		log.Fatalf("Failed loading boilerplate: %v", err)
+	}
+
+	packages := generator.Packages{}
+	header := append(arguments.GeneratedBuildConstraint(), boilerplate...)
+
+	// Find every struct with a builder first, so that builders can take
+	// the builders of their fields, in any of the input packages.
+	requested := map[string]map[*types.Type]bool{}
+	builders := map[*types.Type]bool{}
+	for i := range sets.NewString(context.Inputs...) {
+		log.Debugf("Considering pkg %q", i)
+		pkg := context.Universe[i]
+		if pkg == nil {
+			// If the input had no Go files, for example.
+			continue
+		}
+		if pkgRequested := requestedTypes(pkg); len(pkgRequested) > 0 {
+			requested[i] = pkgRequested
+			for t := range pkgRequested {
+				builders[t] = true
+			}
+		}
+	}
+
+	for i := range requested {
+		pkg := context.Universe[i]
+		log.Infof("Package %q needs generation", i)
+		packages = append(packages,
+			&generator.DefaultPackage{
+				PackageName: strings.Split(filepath.Base(pkg.Path), ".")[0],
+				PackagePath: pkg.Path,
+				HeaderText:  header,
+				GeneratorFunc: func(c *generator.Context) (generators []generator.Generator) {
+					return []generator.Generator{
+						NewGenBuilder(arguments.OutputFileName(pkg, "builder"), pkg.Path, requested[pkg.Path], builders),
+					}
+				},
+				FilterFunc: func(c *generator.Context, t *types.Type) bool {
+					return t.Name.Package == pkg.Path
+				},
+			})
+	}
+	return packages
+}
+
+// genBuilder produces a file with the builders of the structs of a package.
+type genBuilder struct {
+	generator.DefaultGen
+	targetPackage string
+	imports       namer.ImportTracker
+	requested     map[*types.Type]bool
+	// Every struct with a builder, in any package.
+	builders map[*types.Type]bool
+}
+
+func NewGenBuilder(sanitizedName, targetPackage string, requested, builders map[*types.Type]bool) generator.Generator {
+	return &genBuilder{
+		DefaultGen: generator.DefaultGen{
+			OptionalName: sanitizedName,
+		},
+		targetPackage: targetPackage,
+		imports:       generator.NewImportTracker(),
+		requested:     requested,
+		builders:      builders,
+	}
+}
+
+func (g *genBuilder) Namers(c *generator.Context) namer.NameSystems {
+	// Have the raw namer for this file track what it imports.
+	return namer.NameSystems{
+		"raw": namer.NewRawNamer(g.targetPackage, g.imports),
+	}
+}
+
+func (g *genBuilder) Filter(c *generator.Context, t *types.Type) bool {
+	return g.requested[t]
+}
+
+func (g *genBuilder) isOtherPackage(pkg string) bool {
+	if pkg == g.targetPackage {
+		return false
+	}
+	if strings.HasSuffix(pkg, "\""+g.targetPackage+"\"") {
+		return false
+	}
+	return true
+}
+
+func (g *genBuilder) Imports(c *generator.Context) (imports []string) {
+	importLines := []string{"fmt"}
+	for _, singleImport := range g.imports.ImportLines() {
+		if g.isOtherPackage(singleImport) {
+			importLines = append(importLines, singleImport)
+		}
+	}
+	return importLines
+}
+
+// builderOf returns the builder type of the struct 't', or of the struct 't'
+// points to, and whether the field is a pointer. It returns nil if there is
+// no builder.
+func (g *genBuilder) builderOf(t *types.Type) (*types.Type, bool) {
+	pointer := false
+	if t.Kind == types.Pointer {
+		t, pointer = t.Elem, true
+	}
+	if !g.builders[t] {
+		return nil, false
+	}
+	return types.Ref(t.Name.Package, t.Name.Name+"Builder"), pointer
+}
+
+// isNameable returns false for the types the raw namer can't write, which are
+// anonymous arrays, as the parser doesn't record their length.
+func isNameable(t *types.Type) bool {
+	if len(t.Name.Package) > 0 {
+		return true
+	}
+	switch t.Kind {
+	case types.Array:
+		return false
+	case types.Pointer, types.Slice, types.Chan:
+		return isNameable(t.Elem)
+	case types.Map:
+		return isNameable(t.Key) && isNameable(t.Elem)
+	}
+	return true
+}
+
+func (g *genBuilder) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	log.Infof("Generating builder for type %v", t)
+
+	sw := generator.NewSnippetWriter(w, c, "$", "$")
+	args := generator.Args{
+		"type":    t,
+		"builder": types.Ref(t.Name.Package, t.Name.Name+"Builder"),
+	}
+	sw.Do(builderCode, args)
+
+	for _, m := range t.Members {
+		where := fmt.Sprintf("Type %v, field %s", t, m.Name)
+		if namer.IsPrivateGoName(m.Name) || !boolTag(types.ExtractCommentTags("+", m.CommentLines)[tagName], true, where) {
+			continue
+		}
+		if !isNameable(m.Type) {
+			log.Warnf("%s: not generating setters, as the type of the field can't be written", where)
+			continue
+		}
+		args["field"] = m.Name
+		args["member"] = m.Type
+		sw.Do(setCode, args)
+
+		if nested, pointer := g.builderOf(m.Type); nested != nil {
+			args["nested"] = nested
+			args["value"] = "*v"
+			if pointer {
+				args["value"] = "v"
+			}
+			sw.Do(setFromCode, args)
+		}
+		if m.Type.Kind == types.Slice && m.Type.Elem != types.Byte {
+			args["elem"] = m.Type.Elem
+			sw.Do(addCode, args)
+			if nested, pointer := g.builderOf(m.Type.Elem); nested != nil {
+				args["nested"] = nested
+				args["value"] = "*v"
+				if pointer {
+					args["value"] = "v"
+				}
+				sw.Do(addFromCode, args)
+			}
+		}
+	}
+	sw.Do(buildCode, args)
+	return sw.Error()
+}
+
+var builderCode = `// $.builder|raw$ builds $.type|raw$ values one field at a time. Its methods
+// return the builder, so that calls can be chained. The first error met by
+// any of them is returned by Build.
+type $.builder|raw$ struct {
+	obj        $.type|raw$
+	err        error
+	validators []func(*$.type|raw$) error
+}
+
+// New$.builder|raw$ returns a builder starting from the zero $.type|raw$.
+func New$.builder|raw$() *$.builder|raw$ {
+	return &$.builder|raw${}
+}
+
+// WithValidator adds a function checking the $.type|raw$ when it is built.
+func (b *$.builder|raw$) WithValidator(validate func(*$.type|raw$) error) *$.builder|raw$ {
+	b.validators = append(b.validators, validate)
+	return b
+}
+
+`
+
+var setCode = `// Set$.field$ sets the $.field$ field.
+func (b *$.builder|raw$) Set$.field$(v $.member|raw$) *$.builder|raw$ {
+	b.obj.$.field$ = v
+	return b
+}
+
+`
+
+var setFromCode = `// Set$.field$From sets the $.field$ field to what the given builder builds.
+func (b *$.builder|raw$) Set$.field$From(nested *$.nested|raw$) *$.builder|raw$ {
+	v, err := nested.Build()
+	if err != nil {
+		if b.err == nil {
+			b.err = fmt.Errorf("$.field$: %v", err)
+		}
+		return b
+	}
+	b.obj.$.field$ = $.value$
+	return b
+}
+
+`
+
+var addCode = `// Add$.field$ appends to the $.field$ field.
+func (b *$.builder|raw$) Add$.field$(v ...$.elem|raw$) *$.builder|raw$ {
+	b.obj.$.field$ = append(b.obj.$.field$, v...)
+	return b
+}
+
+`
+
+var addFromCode = `// Add$.field$From appends what the given builders build to the $.field$ field.
+func (b *$.builder|raw$) Add$.field$From(nested ...*$.nested|raw$) *$.builder|raw$ {
+	for _, n := range nested {
+		v, err := n.Build()
+		if err != nil {
+			if b.err == nil {
+				b.err = fmt.Errorf("$.field$[%d]: %v", len(b.obj.$.field$), err)
+			}
+			return b
+		}
+		b.obj.$.field$ = append(b.obj.$.field$, $.value$)
+	}
+	return b
+}
+
+`
+
+var buildCode = `// Build returns the $.type|raw$, after checking it with its Validate method, if
+// it has one, and with the validators of the builder. The $.type|raw$ is a
+// shallow copy of the one being built, which the builder may go on with.
+func (b *$.builder|raw$) Build() (*$.type|raw$, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	obj := b.obj
+	if v, ok := interface{}(&obj).(interface{ Validate() error }); ok {
+		if err := v.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	for _, validate := range b.validators {
+		if err := validate(&obj); err != nil {
+			return nil, err
+		}
+	}
+	return &obj, nil
+}
+
+// MustBuild is like Build, but panics on errors. It is meant for tests.
+func (b *$.builder|raw$) MustBuild() *$.type|raw$ {
+	obj, err := b.Build()
+	if err != nil {
+		panic(err)
+	}
+	return obj
+}
+
+`
@@ -0,0 +1,319 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package client_gen
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/namer"
+	"github.com/lack-io/gogogen/gogenerator/types"
+	"github.com/lack-io/gogogen/util/log"
+	"github.com/lack-io/gogogen/util/sets"
+)
+
+// This is the comment tag that requests a client, and the prefix of the one
+// carrying its parameters.
+const tagName = "gogogen:client"
+
+// The parameters of a client.
+const (
+	paramGroup    = "group"
+	paramVersion  = "version"
+	paramResource = "resource"
+	paramVerbs    = "verbs"
+)
+
+// The verbs a client supports, in the order its methods are generated.
+var allVerbs = []string{"get", "list", "create", "update", "delete"}
+
+// The package of the client the generated clients use.
+const restPackage = "github.com/lack-io/gogogen/runtime/rest"
+
+// NameSystems returns the name system used by the generators in this package.
+func NameSystems() namer.NameSystems {
+	return namer.NameSystems{
+		"public": namer.NewPublicNamer(0),
+		"raw":    namer.NewRawNamer("", nil),
+	}
+}
+
+// DefaultNameSystem returns the default name system for ordering the types to
+// be processed by the generators in this package.
+func DefaultNameSystem() string {
+	return "public"
+}
+
+// resource describes the API resource a type is the object of.
+type resource struct {
+	Group    string
+	Version  string
+	Resource string
+	// The path of the collection of the resource, under the base URL.
+	Path  string
+	Verbs map[string]bool
+}
+
+// parseResource returns the resource of 't', or nil if it requests no
+// client.
+func parseResource(t *types.Type) *resource {
+	comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
+	values := types.ExtractCommentTags("+", comments)[tagName]
+	if len(values) == 0 {
+		return nil
+	}
+	if len(values) > 1 || (values[0] != "" && values[0] != "true" && values[0] != "false") {
+		log.Fatalf("Type %v: unsupported %s values: %q", t, tagName, values)
+	}
+	if values[0] == "false" {
+		return nil
+	}
+	if t.Kind != types.Struct {
+		log.Fatalf("Type %v: clients are only generated for structs", t)
+	}
+
+	r := &resource{
+		Resource: namer.NewAllLowercasePluralNamer(nil).Name(t),
+		Verbs:    map[string]bool{},
+	}
+	for _, v := range allVerbs {
+		r.Verbs[v] = true
+	}
+	params, err := types.ExtractCommentTagParams("+", tagName, comments)
+	if err != nil {
+		log.Fatalf("Type %v: %v", t, err)
+	}
+	for _, p := range params {
+		switch p.Key {
+		case paramGroup:
+			r.Group = p.Value
+		case paramVersion:
+			r.Version = p.Value
+		case paramResource:
+			if len(p.Value) == 0 {
+				log.Fatalf("Type %v: empty %s", t, paramResource)
+			}
+			r.Resource = p.Value
+		case paramVerbs:
+			r.Verbs = map[string]bool{}
+			for _, v := range strings.Split(p.Value, "|") {
+				if !sets.NewString(allVerbs...).Has(v) {
+					log.Fatalf("Type %v: unsupported verb %q, must be one of %q", t, v, allVerbs)
+				}
+				r.Verbs[v] = true
+			}
+		default:
+			log.Fatalf("Type %v: unsupported %s parameter %q", t, tagName, p.Key)
+		}
+	}
+
+	segments := []string{}
+	for _, s := range []string{r.Group, r.Version, r.Resource} {
+		if len(s) > 0 {
+			segments = append(segments, s)
+		}
+	}
+	r.Path = "/" + strings.Join(segments, "/")
+	return r
+}
+
+func Packages(context *generator.Context, arguments *args.GeneratorArgs) generator.Packages {
+	boilerplate, err := arguments.LoadGoBoilerplate()
+	if err != nil {
+		log.Fatalf("Failed loading boilerplate: %v", err)
+	}
+
+	packages := generator.Packages{}
+	header := append(arguments.GeneratedBuildConstraint(), boilerplate...)
+
+	for i := range sets.NewString(context.Inputs...) {
+		log.Debugf("Considering pkg %q", i)
+		pkg := context.Universe[i]
+		if pkg == nil {
+			// If the input had no Go files, for example.
+			continue
+		}
+
+		resources := map[*types.Type]*resource{}
+		for _, t := range pkg.SortedTypes() {
+			if r := parseResource(t); r != nil {
+				resources[t] = r
+			}
+		}
+		if len(resources) == 0 {
+			continue
+		}
+
+		log.Infof("Package %q needs generation", i)
+		packages = append(packages,
+			&generator.DefaultPackage{
+				PackageName: strings.Split(filepath.Base(pkg.Path), ".")[0],
+				PackagePath: pkg.Path,
+				HeaderText:  header,
+				GeneratorFunc: func(c *generator.Context) (generators []generator.Generator) {
+					return []generator.Generator{
+						NewGenClient(arguments.OutputFileName(pkg, "client"), pkg.Path, resources),
+					}
+				},
+				FilterFunc: func(c *generator.Context, t *types.Type) bool {
+					return t.Name.Package == pkg.Path
+				},
+			})
+	}
+	return packages
+}
+
+// genClient produces a file with the clients of the resources of a package.
+type genClient struct {
+	generator.DefaultGen
+	targetPackage string
+	imports       namer.ImportTracker
+	resources     map[*types.Type]*resource
+}
+
+func NewGenClient(sanitizedName, targetPackage string, resources map[*types.Type]*resource) generator.Generator {
+	return &genClient{
+		DefaultGen: generator.DefaultGen{
+			OptionalName: sanitizedName,
+		},
+		targetPackage: targetPackage,
+		imports:       generator.NewImportTracker(),
+		resources:     resources,
+	}
+}
+
+func (g *genClient) Namers(c *generator.Context) namer.NameSystems {
+	// Have the raw namer for this file track what it imports.
+	return namer.NameSystems{
+		"raw": namer.NewRawNamer(g.targetPackage, g.imports),
+	}
+}
+
+func (g *genClient) Filter(c *generator.Context, t *types.Type) bool {
+	_, ok := g.resources[t]
+	return ok
+}
+
+func (g *genClient) isOtherPackage(pkg string) bool {
+	if pkg == g.targetPackage {
+		return false
+	}
+	if strings.HasSuffix(pkg, "\""+g.targetPackage+"\"") {
+		return false
+	}
+	return true
+}
+
+func (g *genClient) Imports(c *generator.Context) (imports []string) {
+	importLines := []string{}
+	for _, singleImport := range g.imports.ImportLines() {
+		if g.isOtherPackage(singleImport) {
+			importLines = append(importLines, singleImport)
+		}
+	}
+	return importLines
+}
+
+func (g *genClient) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	log.Infof("Generating client for type %v", t)
+
+	r := g.resources[t]
+	sw := generator.NewSnippetWriter(w, c, "$", "$")
+	args := generator.Args{
+		"type":       t,
+		"resource":   r.Resource,
+		"path":       r.Path,
+		"Client":     types.Ref(restPackage, "Client"),
+		"Context":    types.Ref("context", "Context"),
+		"PathEscape": types.Ref("net/url", "PathEscape"),
+		"Get":        types.Ref("net/http", "MethodGet"),
+		"Post":       types.Ref("net/http", "MethodPost"),
+		"Put":        types.Ref("net/http", "MethodPut"),
+		"Delete":     types.Ref("net/http", "MethodDelete"),
+	}
+	sw.Do(clientCode, args)
+	for _, v := range allVerbs {
+		if r.Verbs[v] {
+			sw.Do(verbCode[v], args)
+		}
+	}
+	return sw.Error()
+}
+
+var clientCode = `// $.type|public$Client accesses the $.resource$ served at $.path$.
+type $.type|public$Client struct {
+	client *$.Client|raw$
+}
+
+// New$.type|public$Client returns a client accessing the $.resource$ of the API
+// client sends requests to.
+func New$.type|public$Client(client *$.Client|raw$) *$.type|public$Client {
+	return &$.type|public$Client{client: client}
+}
+
+`
+
+var verbCode = map[string]string{
+	"get": `// Get returns the $.type|raw$ called name.
+func (c *$.type|public$Client) Get(ctx $.Context|raw$, name string) (*$.type|raw$, error) {
+	out := &$.type|raw${}
+	if err := c.client.Do(ctx, $.Get|raw$, "$.path$/"+$.PathEscape|raw$(name), nil, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+`,
+	"list": `// List returns every $.type|raw$.
+func (c *$.type|public$Client) List(ctx $.Context|raw$) ([]$.type|raw$, error) {
+	var out []$.type|raw$
+	if err := c.client.Do(ctx, $.Get|raw$, "$.path$", nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+`,
+	"create": `// Create creates obj, and returns it as created.
+func (c *$.type|public$Client) Create(ctx $.Context|raw$, obj *$.type|raw$) (*$.type|raw$, error) {
+	out := &$.type|raw${}
+	if err := c.client.Do(ctx, $.Post|raw$, "$.path$", obj, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+`,
+	"update": `// Update replaces the $.type|raw$ called name with obj, and returns it as
+// updated.
+func (c *$.type|public$Client) Update(ctx $.Context|raw$, name string, obj *$.type|raw$) (*$.type|raw$, error) {
+	out := &$.type|raw${}
+	if err := c.client.Do(ctx, $.Put|raw$, "$.path$/"+$.PathEscape|raw$(name), obj, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+`,
+	"delete": `// Delete deletes the $.type|raw$ called name.
+func (c *$.type|public$Client) Delete(ctx $.Context|raw$, name string) error {
+	return c.client.Do(ctx, $.Delete|raw$, "$.path$/"+$.PathEscape|raw$(name), nil, nil)
+}
+
+`,
+}
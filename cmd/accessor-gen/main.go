@@ -0,0 +1,85 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// accessor-gen is a tool for auto-generating getters and setters of struct
+// fields.
+//
+// Given a list of input directories, it will generate, for every field of a
+// requested struct:
+//   func (x *Foo) GetBar() Bar
+//
+// which returns the zero value when x is nil, so that chains of getters are
+// safe the way they are for protobuf messages. When the field is a pointer to
+// a basic type, the getter dereferences it, returning the zero value when the
+// pointer is nil too. Setters are generated on request:
+//   func (x *Foo) SetBar(v Bar)
+//
+// Generation is governed by comment tags in the source. A struct requests
+// generation by a comment on the type of the form:
+//   // +gogogen:accessor-gen
+//
+// and a package may request it for all of its structs, by including a
+// comment in the file-comments of one file, of the form:
+//   // +gogogen:accessor-gen=package
+//
+// Individual structs then opt out with:
+//   // +gogogen:accessor-gen=false
+//
+// Exported fields get getters, unless the field opts out with the same tag.
+// Unexported fields get them only when the field is tagged:
+//   // +gogogen:accessor-gen
+//
+// Setters are generated for all the fields of a struct, or for a single
+// field, with the comment tag:
+//   // +gogogen:accessor-gen:setters
+//
+// which a field may also set to false. Accessors which would replace a
+// method already defined are skipped.
+package main
+
+import (
+	"path/filepath"
+
+	ccli "github.com/lack-io/cli"
+
+	"github.com/lack-io/gogogen/accessor-gen"
+	"github.com/lack-io/gogogen/gogenerator/args"
+	utilbuild "github.com/lack-io/gogogen/util/build"
+	"github.com/lack-io/gogogen/util/log"
+)
+
+func main() {
+	genericArgs := accessor_gen.NewDefaults()
+
+	// Override defaults.
+	genericArgs.GoHeaderFilePath = filepath.Join(args.DefaultSourceTree(), utilbuild.BoilerplatePath())
+
+	app := ccli.CommandLine
+	genericArgs.AddFlags(app)
+	app.RunAndExitOnError()
+
+	if err := accessor_gen.Validate(genericArgs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Run it.
+	if err := genericArgs.Execute(
+		accessor_gen.NameSystems(),
+		accessor_gen.DefaultNameSystem(),
+		accessor_gen.Packages,
+	); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Infof("Completed successfully.")
+}
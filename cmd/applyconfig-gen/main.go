@@ -0,0 +1,82 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// applyconfig-gen is a tool for auto-generating apply configurations of
+// structs, for clients applying objects server-side.
+//
+// An apply configuration holds the fields of an object its applier has an
+// opinion on: it mirrors the struct with a pointer, slice or map for each
+// field, which is left nil for the fields the applier leaves to others, and
+// is encoded to JSON without them. Given a list of input directories, it
+// will generate, for every requested struct Foo:
+//   type FooApplyConfiguration struct { ... }
+//   func NewFooApplyConfiguration() *FooApplyConfiguration
+//   func (c *FooApplyConfiguration) WithBar(v Bar) *FooApplyConfiguration
+//   func (c *FooApplyConfiguration) ToUnstructured() (map[string]interface{}, error)
+//   func ExtractFoo(u map[string]interface{}) (*FooApplyConfiguration, error)
+//
+// Fields of structs with apply configurations themselves, or pointers,
+// slices or maps of them, hold those configurations. WithBar appends to
+// slices and adds to maps. The fields of an embedded struct with an apply
+// configuration get With methods on the embedding one too. ExtractFoo
+// returns the configuration of the fields set in an unstructured Foo, as
+// decoded from JSON.
+//
+// Generation is governed by comment tags in the source. A struct requests
+// generation by a comment on the type of the form:
+//   // +gogogen:applyconfig-gen
+//
+// and a package may request it for all of its structs, by including a
+// comment in the file-comments of one file, of the form:
+//   // +gogogen:applyconfig-gen=package
+//
+// Individual structs, and fields, then opt out with:
+//   // +gogogen:applyconfig-gen=false
+package main
+
+import (
+	"path/filepath"
+
+	ccli "github.com/lack-io/cli"
+
+	"github.com/lack-io/gogogen/applyconfig-gen"
+	"github.com/lack-io/gogogen/gogenerator/args"
+	utilbuild "github.com/lack-io/gogogen/util/build"
+	"github.com/lack-io/gogogen/util/log"
+)
+
+func main() {
+	genericArgs := applyconfig_gen.NewDefaults()
+
+	// Override defaults.
+	genericArgs.GoHeaderFilePath = filepath.Join(args.DefaultSourceTree(), utilbuild.BoilerplatePath())
+
+	app := ccli.CommandLine
+	genericArgs.AddFlags(app)
+	app.RunAndExitOnError()
+
+	if err := applyconfig_gen.Validate(genericArgs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Run it.
+	if err := genericArgs.Execute(
+		applyconfig_gen.NameSystems(),
+		applyconfig_gen.DefaultNameSystem(),
+		applyconfig_gen.Packages,
+	); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Infof("Completed successfully.")
+}
@@ -0,0 +1,87 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// binary-gen is a tool for auto-generating binary encoding methods, for
+// caches and other stores of values which do not outlive the code reading
+// them.
+//
+// Given a list of input directories, it will generate, for every requested
+// struct type:
+//   func (in Foo) MarshalBinary() ([]byte, error)
+//   func (in *Foo) AppendBinary(w *binutil.Writer)
+//   func (out *Foo) UnmarshalBinary(data []byte) error
+//   func (out *Foo) UnmarshalBinaryFrom(r *binutil.Reader)
+//
+// The methods encode the exported members of the struct in order, without
+// reflection or field names, in the layout the binutil package describes.
+// Members tagged `binary:"-"` are left out. Pointers, slices, arrays and maps
+// are followed; values of other types must be builtins, or have binary-gen
+// methods or MarshalBinary and UnmarshalBinary methods of their own. Map
+// entries are written in iteration order, so encodings of maps are not
+// deterministic.
+//
+// Encoded values start with the version of their type and a hash of its
+// layout, computed from its members' names and types, and UnmarshalBinary
+// fails for values written for another version or layout, which is how
+// caches notice their entries are stale. The version is 1 unless a comment on
+// the type sets it:
+//   // +gogogen:binary-gen:version=2
+//
+// Generation is governed by comment tags in the source. A type requests
+// generation by a comment on the type of the form:
+//   // +gogogen:binary-gen
+//
+// and a package may request it for all of its struct types, by including a
+// comment in the file-comments of one file, of the form:
+//   // +gogogen:binary-gen=package
+//
+// Individual types then opt out with:
+//   // +gogogen:binary-gen=false
+package main
+
+import (
+	"path/filepath"
+
+	ccli "github.com/lack-io/cli"
+
+	"github.com/lack-io/gogogen/binary-gen"
+	"github.com/lack-io/gogogen/gogenerator/args"
+	utilbuild "github.com/lack-io/gogogen/util/build"
+	"github.com/lack-io/gogogen/util/log"
+)
+
+func main() {
+	genericArgs := binary_gen.NewDefaults()
+
+	// Override defaults.
+	genericArgs.GoHeaderFilePath = filepath.Join(args.DefaultSourceTree(), utilbuild.BoilerplatePath())
+
+	app := ccli.CommandLine
+	genericArgs.AddFlags(app)
+	app.RunAndExitOnError()
+
+	if err := binary_gen.Validate(genericArgs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Run it.
+	if err := genericArgs.Execute(
+		binary_gen.NameSystems(),
+		binary_gen.DefaultNameSystem(),
+		binary_gen.Packages,
+	); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Infof("Completed successfully.")
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// builder-gen is a tool for auto-generating builders of structs.
+//
+// Given a list of input directories, it will generate, for every requested
+// struct Foo, a FooBuilder with a chainable setter for each exported field:
+//   func NewFooBuilder() *FooBuilder
+//   func (b *FooBuilder) SetBar(v Bar) *FooBuilder
+//   func (b *FooBuilder) Build() (*Foo, error)
+//   func (b *FooBuilder) MustBuild() *Foo
+//
+// Slice fields also get an AddBar method appending to them. Fields of
+// structs which have builders themselves, or pointers or slices of them, get
+// SetBarFrom or AddBarFrom methods taking those builders, and their errors
+// are passed on by Build.
+//
+// Build checks the result with its Validate() error method, if it has one,
+// and with the functions added by WithValidator.
+//
+// Generation is governed by comment tags in the source. A struct requests
+// generation by a comment on the type of the form:
+//   // +gogogen:builder-gen
+//
+// and a package may request it for all of its structs, by including a
+// comment in the file-comments of one file, of the form:
+//   // +gogogen:builder-gen=package
+//
+// Individual structs, and fields, then opt out with:
+//   // +gogogen:builder-gen=false
+package main
+
+import (
+	"path/filepath"
+
+	ccli "github.com/lack-io/cli"
+
+	"github.com/lack-io/gogogen/builder-gen"
+	"github.com/lack-io/gogogen/gogenerator/args"
+	utilbuild "github.com/lack-io/gogogen/util/build"
+	"github.com/lack-io/gogogen/util/log"
+)
+
+func main() {
+	genericArgs := builder_gen.NewDefaults()
+
+	// Override defaults.
+	genericArgs.GoHeaderFilePath = filepath.Join(args.DefaultSourceTree(), utilbuild.BoilerplatePath())
+
+	app := ccli.CommandLine
+	genericArgs.AddFlags(app)
+	app.RunAndExitOnError()
+
+	if err := builder_gen.Validate(genericArgs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Run it.
+	if err := genericArgs.Execute(
+		builder_gen.NameSystems(),
+		builder_gen.DefaultNameSystem(),
+		builder_gen.Packages,
+	); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Infof("Completed successfully.")
+}
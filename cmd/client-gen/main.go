@@ -0,0 +1,78 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// client-gen is a tool for auto-generating typed clients of REST APIs.
+//
+// Given a list of input directories, it will find structs requesting a
+// client, and generate for each struct Foo:
+//   type FooClient struct { ... }
+//   func NewFooClient(client *rest.Client) *FooClient
+//   func (c *FooClient) Get(ctx context.Context, name string) (*Foo, error)
+//   func (c *FooClient) List(ctx context.Context) ([]Foo, error)
+//   func (c *FooClient) Create(ctx context.Context, obj *Foo) (*Foo, error)
+//   func (c *FooClient) Update(ctx context.Context, name string, obj *Foo) (*Foo, error)
+//   func (c *FooClient) Delete(ctx context.Context, name string) error
+//
+// The clients send JSON over the rest.Client of
+// github.com/lack-io/gogogen/runtime/rest, whose Transport may be replaced.
+// Objects are accessed at /<group>/<version>/<resource>/<name>, leaving out
+// the parts which are not set, and List expects a JSON array.
+//
+// Generation is governed by comment tags in the source. A struct requests a
+// client by a comment on it of the form:
+//   // +gogogen:client
+//
+// The resource it is the object of is described with:
+//   // +gogogen:client:group=apps,version=v1,resource=deployments
+//
+// where the resource is the lower case plural of the type name by default.
+// The methods may be limited to some verbs with:
+//   // +gogogen:client:verbs=get|list
+package main
+
+import (
+	"path/filepath"
+
+	ccli "github.com/lack-io/cli"
+
+	"github.com/lack-io/gogogen/client-gen"
+	"github.com/lack-io/gogogen/gogenerator/args"
+	utilbuild "github.com/lack-io/gogogen/util/build"
+	"github.com/lack-io/gogogen/util/log"
+)
+
+func main() {
+	genericArgs := client_gen.NewDefaults()
+
+	// Override defaults.
+	genericArgs.GoHeaderFilePath = filepath.Join(args.DefaultSourceTree(), utilbuild.BoilerplatePath())
+
+	app := ccli.CommandLine
+	genericArgs.AddFlags(app)
+	app.RunAndExitOnError()
+
+	if err := client_gen.Validate(genericArgs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Run it.
+	if err := genericArgs.Execute(
+		client_gen.NameSystems(),
+		client_gen.DefaultNameSystem(),
+		client_gen.Packages,
+	); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Infof("Completed successfully.")
+}
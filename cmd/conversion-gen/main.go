@@ -0,0 +1,76 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// conversion-gen is a tool for auto-generating conversion functions.
+//
+// Given a list of input directories, it will generate functions converting
+// the struct types of each package to and from the types of the same name in
+// a peer package, for example between an internal and a versioned version of
+// an API. The functions are of the form:
+//   func Convert_v1_Foo_To_api_Foo(in *v1.Foo, out *api.Foo) error
+//
+// Generation is governed by comment tags in the source. A package requests
+// conversions by including a comment in the file-comments of one file, naming
+// the peer package:
+//   // +gogogen:conversion-gen=github.com/example/api
+//
+// Individual types may opt out with a comment on the type of the form:
+//   // +gogogen:conversion-gen=false
+//
+// Members are assigned when their types are identical, cast when they only
+// differ in name, and converted by calling the conversion function of their
+// types otherwise. Manually written Convert_ functions, found in either
+// package or in --extra-peer-dirs, take precedence over generated ones; they
+// usually call the generated autoConvert_ function and fix up the rest. When a
+// member cannot be converted automatically, for example because it is
+// unexported, no Convert_ function is generated and one must be written by
+// hand.
+package main
+
+import (
+	"path/filepath"
+
+	ccli "github.com/lack-io/cli"
+
+	"github.com/lack-io/gogogen/conversion-gen"
+	"github.com/lack-io/gogogen/gogenerator/args"
+	utilbuild "github.com/lack-io/gogogen/util/build"
+	"github.com/lack-io/gogogen/util/log"
+)
+
+func main() {
+	genericArgs, customArgs := conversion_gen.NewDefaults()
+
+	// Override defaults.
+	genericArgs.GoHeaderFilePath = filepath.Join(args.DefaultSourceTree(), utilbuild.BoilerplatePath())
+
+	app := ccli.CommandLine
+	genericArgs.AddFlags(app)
+	customArgs.AddFlags(app)
+	app.RunAndExitOnError()
+
+	if err := conversion_gen.Validate(genericArgs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Run it.
+	if err := genericArgs.Execute(
+		conversion_gen.NameSystems(),
+		conversion_gen.DefaultNameSystem(),
+		conversion_gen.Packages,
+	); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Infof("Completed successfully.")
+}
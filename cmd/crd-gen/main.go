@@ -0,0 +1,84 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// crd-gen is a tool for auto-generating Kubernetes CustomResourceDefinitions.
+//
+// Given a list of input directories, it will find structs requesting a CRD,
+// and write the CRDs of each package to zz_generated.crd.yaml in it, one YAML
+// document per CRD. Each CRD has a single version, served and stored, whose
+// structural schema is made from the fields of the struct the way
+// encoding/json encodes them. A version gets the status subresource when its
+// struct has a status field.
+//
+// Generation is governed by comment tags in the source. A struct requests a
+// CRD by a comment on it of the form:
+//   // +gogogen:crd
+//   // +gogogen:crd:group=example.com
+//
+// where the group is required. The other parameters, with their defaults,
+// are:
+//   // +gogogen:crd:version=<package name>,kind=<type name>,scope=Namespaced
+//   // +gogogen:crd:plural=<lower case plural of kind>,singular=<lower case kind>
+//   // +gogogen:crd:shortNames=foo|fo
+//
+// Columns are added to kubectl get with one comment per column:
+//   // +gogogen:crd:printcolumn:name=Replicas,type=integer,jsonPath=.spec.replicas
+//
+// which may also have a description, a format and a priority. Fields are
+// required unless they are omitempty or have a comment of the form:
+//   // +optional
+//
+// and are validated by the rules validate-gen checks, such as:
+//   // +validate:required,min=1,max=10,pattern="^[a-z]+$",enum=a|b
+//
+// where min and max bound the value of numbers, and the length of strings,
+// lists and maps. Defaults are given, as JSON, with:
+//   // +default=3
+package main
+
+import (
+	"path/filepath"
+
+	ccli "github.com/lack-io/cli"
+
+	"github.com/lack-io/gogogen/crd-gen"
+	"github.com/lack-io/gogogen/gogenerator/args"
+	utilbuild "github.com/lack-io/gogogen/util/build"
+	"github.com/lack-io/gogogen/util/log"
+)
+
+func main() {
+	genericArgs := crd_gen.NewDefaults()
+
+	// Override defaults.
+	genericArgs.GoHeaderFilePath = filepath.Join(args.DefaultSourceTree(), utilbuild.BoilerplatePath())
+
+	app := ccli.CommandLine
+	genericArgs.AddFlags(app)
+	app.RunAndExitOnError()
+
+	if err := crd_gen.Validate(genericArgs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Run it.
+	if err := genericArgs.Execute(
+		crd_gen.NameSystems(),
+		crd_gen.DefaultNameSystem(),
+		crd_gen.Packages,
+	); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Infof("Completed successfully.")
+}
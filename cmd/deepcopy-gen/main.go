@@ -26,15 +26,21 @@
 // Generation is governed by comment tags in the source. Any package may
 // request DeepCopy generation by including a comment in the file-comments of
 // one file, of the form:
-//   // +gogo:deepcopy-gen=package
+//   // +gogogen:deepcopy-gen=package
 //
 // DeepCopy functions can be generated for individual types, rather than the
 // entire package by specified a comment on the type define of the form:
-//   // +gogo:deepcopy-gen=true
+//   // +gogogen:deepcopy-gen=true
 //
 // When generating for a whole package, individual type may opt out of
 // DeepCopy generation by specified a comment on the of form:
-//   // +gogo:deepcopy-gen=false
+//   // +gogogen:deepcopy-gen=false
+//
+// A type may also ask for DeepCopy<Interface> methods, which return the copy
+// as the named interface. For example, DeepCopyObject is generated by:
+//   // +gogogen:deepcopy-gen:interfaces=github.com/lack-io/gogogen/runtime/meta.Object
+//
+// The older +gogo:deepcopy-gen tags are still honored.
 //
 // Note that registration is a whole-package option, and is not available for
 // individual types.
@@ -60,7 +66,9 @@ func main() {
 
 	app := ccli.CommandLine
 	genericArgs.AddFlags(app)
-	customArgs.AddFlags(app)
+	if err := genericArgs.RegisterCustomArgs(app, customArgs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
 	app.RunAndExitOnError()
 
 	if err := deepcopy_gen.Validate(genericArgs); err != nil {
@@ -0,0 +1,77 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// defaulter-gen is a tool for auto-generating defaulting functions.
+//
+// Given a list of input directories, it will scan for SetDefaults_<Type>
+// functions of the form:
+//   func SetDefaults_Foo(in *Foo)
+// and, for every requested type, generate a SetObjectDefaults_<Type> function
+// which calls the defaulters of the type and of every value nested in it:
+// struct fields, pointees, and elements of slices, arrays and maps. Types
+// from other packages which already offer a SetObjectDefaults_<Type> function
+// are defaulted by calling it.
+//
+// Generation is governed by comment tags in the source. A package may request
+// defaulters for all of its struct types by including a comment in the
+// file-comments of one file, of the form:
+//   // +gogogen:defaulter-gen=package
+//
+// or only for the struct types with a given member, for example:
+//   // +gogogen:defaulter-gen=Meta
+//
+// Individual types opt in or out with a comment on the type of the form:
+//   // +gogogen:defaulter-gen=true
+//
+// SetDefaults_ functions declared in other packages, such as the internal
+// version of a versioned API, are considered when requested by:
+//   // +gogogen:defaulter-gen-input=github.com/example/api
+package main
+
+import (
+	"path/filepath"
+
+	ccli "github.com/lack-io/cli"
+
+	"github.com/lack-io/gogogen/defaulter-gen"
+	"github.com/lack-io/gogogen/gogenerator/args"
+	utilbuild "github.com/lack-io/gogogen/util/build"
+	"github.com/lack-io/gogogen/util/log"
+)
+
+func main() {
+	genericArgs, customArgs := defaulter_gen.NewDefaults()
+
+	// Override defaults.
+	genericArgs.GoHeaderFilePath = filepath.Join(args.DefaultSourceTree(), utilbuild.BoilerplatePath())
+
+	app := ccli.CommandLine
+	genericArgs.AddFlags(app)
+	customArgs.AddFlags(app)
+	app.RunAndExitOnError()
+
+	if err := defaulter_gen.Validate(genericArgs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Run it.
+	if err := genericArgs.Execute(
+		defaulter_gen.NameSystems(),
+		defaulter_gen.DefaultNameSystem(),
+		defaulter_gen.Packages,
+	); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Infof("Completed successfully.")
+}
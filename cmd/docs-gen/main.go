@@ -0,0 +1,69 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// docs-gen is a tool for auto-generating API reference pages.
+//
+// Given a list of input directories, it will write a reference page for each
+// package, zz_generated.api.md in it, describing its exported types: their
+// doc comments, the fields of structs along with their JSON names, the
+// values of named types with constants, and the methods of interfaces.
+// Types of the packages documented together link to each other's pages.
+//
+// With --format=html, the pages are HTML fragments instead, to be embedded
+// in a site.
+//
+// Every exported type is documented, unless it opts out with a comment of
+// the form:
+//   // +gogogen:docs-gen=false
+//
+// and a package opts out as a whole by including that comment in the
+// file-comments of one file.
+package main
+
+import (
+	"path/filepath"
+
+	ccli "github.com/lack-io/cli"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/docs-gen"
+	utilbuild "github.com/lack-io/gogogen/util/build"
+	"github.com/lack-io/gogogen/util/log"
+)
+
+func main() {
+	genericArgs, customArgs := docs_gen.NewDefaults()
+
+	// Override defaults.
+	genericArgs.GoHeaderFilePath = filepath.Join(args.DefaultSourceTree(), utilbuild.BoilerplatePath())
+
+	app := ccli.CommandLine
+	genericArgs.AddFlags(app)
+	customArgs.AddFlags(app)
+	app.RunAndExitOnError()
+
+	if err := docs_gen.Validate(genericArgs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Run it.
+	if err := genericArgs.Execute(
+		docs_gen.NameSystems(),
+		docs_gen.DefaultNameSystem(),
+		docs_gen.Packages,
+	); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Infof("Completed successfully.")
+}
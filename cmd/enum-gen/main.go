@@ -0,0 +1,78 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// enum-gen is a tool for auto-generating methods of enumerated types.
+//
+// Given a list of input directories, it will find named integer and string
+// types along with the constants declared of them, and generate:
+//   func FooValues() []Foo
+//   func (x Foo) String() string
+//   func ParseFoo(s string) (Foo, error)
+//   func (x Foo) MarshalText() ([]byte, error)
+//   func (x *Foo) UnmarshalText(text []byte) error
+//
+// Integer values are formatted as the name of their constant, and string
+// values as themselves. When several constants share a value, the first by
+// name is used for formatting, and all of them are parsed.
+//
+// Generation is governed by comment tags in the source. A type requests
+// generation by a comment on the type of the form:
+//   // +gogogen:enum-gen
+//
+// and a package may request it for all of its types, by including a comment
+// in the file-comments of one file, of the form:
+//   // +gogogen:enum-gen=package
+//
+// Individual types then opt out with:
+//   // +gogogen:enum-gen=false
+//
+// A common prefix may be dropped from the names of integer constants with:
+//   // +gogogen:enum-gen:trim-prefix=Foo
+package main
+
+import (
+	"path/filepath"
+
+	ccli "github.com/lack-io/cli"
+
+	"github.com/lack-io/gogogen/enum-gen"
+	"github.com/lack-io/gogogen/gogenerator/args"
+	utilbuild "github.com/lack-io/gogogen/util/build"
+	"github.com/lack-io/gogogen/util/log"
+)
+
+func main() {
+	genericArgs := enum_gen.NewDefaults()
+
+	// Override defaults.
+	genericArgs.GoHeaderFilePath = filepath.Join(args.DefaultSourceTree(), utilbuild.BoilerplatePath())
+
+	app := ccli.CommandLine
+	genericArgs.AddFlags(app)
+	app.RunAndExitOnError()
+
+	if err := enum_gen.Validate(genericArgs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Run it.
+	if err := genericArgs.Execute(
+		enum_gen.NameSystems(),
+		enum_gen.DefaultNameSystem(),
+		enum_gen.Packages,
+	); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Infof("Completed successfully.")
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// env-gen is a tool for auto-generating loaders of config structs from the
+// environment.
+//
+// Given a list of input directories, it will find structs requesting
+// generation, and generate for each struct Foo:
+//   func (x *Foo) LoadFromEnv() error
+//
+// which sets every exported field from the environment variable named after
+// the path of the field in upper snake case: Foo.TLS.CertFile is read from
+// TLS_CERT_FILE. Fields of embedded structs are read as if they were
+// declared in place. Strings, booleans, numbers, time.Duration, []string
+// (from comma separated lists), types implementing encoding.TextUnmarshaler,
+// and pointers to them are supported. Fields whose variable is not set keep
+// their value, so the loader pairs with the flags of flag-gen.
+//
+// Generation is governed by comment tags in the source. A struct requests
+// generation by a comment on it of the form:
+//   // +gogogen:env-gen
+//
+// and a package may request it for all of its structs, by including a
+// comment in the file-comments of one file, of the form:
+//   // +gogogen:env-gen=package
+//
+// Individual structs then opt out with:
+//   // +gogogen:env-gen=false
+//
+// The names of the variables of a struct are prefixed with:
+//   // +gogogen:env-gen:prefix=APP
+//
+// The variable of a field is tuned by a comment on it, such as:
+//   // +env:name=LISTEN_ADDR,required
+//
+// and a field is left without a variable with:
+//   // +env:skip
+package main
+
+import (
+	"path/filepath"
+
+	ccli "github.com/lack-io/cli"
+
+	"github.com/lack-io/gogogen/env-gen"
+	"github.com/lack-io/gogogen/gogenerator/args"
+	utilbuild "github.com/lack-io/gogogen/util/build"
+	"github.com/lack-io/gogogen/util/log"
+)
+
+func main() {
+	genericArgs := env_gen.NewDefaults()
+
+	// Override defaults.
+	genericArgs.GoHeaderFilePath = filepath.Join(args.DefaultSourceTree(), utilbuild.BoilerplatePath())
+
+	app := ccli.CommandLine
+	genericArgs.AddFlags(app)
+	app.RunAndExitOnError()
+
+	if err := env_gen.Validate(genericArgs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Run it.
+	if err := genericArgs.Execute(
+		env_gen.NameSystems(),
+		env_gen.DefaultNameSystem(),
+		env_gen.Packages,
+	); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Infof("Completed successfully.")
+}
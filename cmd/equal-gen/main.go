@@ -0,0 +1,80 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// equal-gen is a tool for auto-generating semantic equality methods.
+//
+// Given a list of input directories, it will generate, for every requested
+// struct, or named slice or map:
+//   func (x Foo) Equal(other Foo) bool
+//
+// Fields are compared by value: pointers are followed, slices and maps are
+// compared item by item, and values whose types have an Equal(T) bool
+// method, such as time.Time and the types with generated methods, are
+// compared with it. Functions are only compared to nil, and interfaces, and
+// structs of other packages that can't be compared otherwise, fall back to
+// reflect.DeepEqual.
+//
+// Nil slices and maps are equal to empty ones, unless --nil-equals-empty is
+// false, or a type or field has the comment tag:
+//   // +gogogen:equal-gen:nil-equals-empty=false
+//
+// Generation is governed by comment tags in the source. A type requests
+// generation by a comment on the type of the form:
+//   // +gogogen:equal-gen
+//
+// and a package may request it for all of its types, by including a comment
+// in the file-comments of one file, of the form:
+//   // +gogogen:equal-gen=package
+//
+// Individual types then opt out, and fields are left out of comparisons,
+// with:
+//   // +gogogen:equal-gen=false
+package main
+
+import (
+	"path/filepath"
+
+	ccli "github.com/lack-io/cli"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/equal-gen"
+	utilbuild "github.com/lack-io/gogogen/util/build"
+	"github.com/lack-io/gogogen/util/log"
+)
+
+func main() {
+	genericArgs, customArgs := equal_gen.NewDefaults()
+
+	// Override defaults.
+	genericArgs.GoHeaderFilePath = filepath.Join(args.DefaultSourceTree(), utilbuild.BoilerplatePath())
+
+	app := ccli.CommandLine
+	genericArgs.AddFlags(app)
+	customArgs.AddFlags(app)
+	app.RunAndExitOnError()
+
+	if err := equal_gen.Validate(genericArgs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Run it.
+	if err := genericArgs.Execute(
+		equal_gen.NameSystems(),
+		equal_gen.DefaultNameSystem(),
+		equal_gen.Packages,
+	); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Infof("Completed successfully.")
+}
@@ -0,0 +1,81 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// flag-gen is a tool for auto-generating flag bindings of config structs.
+//
+// Given a list of input directories, it will find structs requesting
+// generation, and generate for each struct Foo:
+//   func (x *Foo) AddFlags(app *cli.App)
+//
+// which binds every exported field to a flag of github.com/lack-io/cli,
+// named after the field in kebab case, with the comment of the field as its
+// usage and the value of the field as its default. Fields of nested structs
+// get flags prefixed by the name of the struct field, and those of embedded
+// structs are bound as if they were declared in place.
+//
+// Generation is governed by comment tags in the source. A struct requests
+// generation by a comment on it of the form:
+//   // +gogogen:flag-gen
+//
+// and a package may request it for all of its structs, by including a
+// comment in the file-comments of one file, of the form:
+//   // +gogogen:flag-gen=package
+//
+// Individual structs then opt out with:
+//   // +gogogen:flag-gen=false
+//
+// The flag of a field is tuned by a comment on it, such as:
+//   // +flag:name=listen,alias=l,usage="The address to listen on."
+//   // +flag:default=:8080,env=LISTEN_ADDR
+//
+// where defaults of slices separate their items with "|". A field is left
+// without a flag with:
+//   // +flag:skip
+package main
+
+import (
+	"path/filepath"
+
+	ccli "github.com/lack-io/cli"
+
+	"github.com/lack-io/gogogen/flag-gen"
+	"github.com/lack-io/gogogen/gogenerator/args"
+	utilbuild "github.com/lack-io/gogogen/util/build"
+	"github.com/lack-io/gogogen/util/log"
+)
+
+func main() {
+	genericArgs := flag_gen.NewDefaults()
+
+	// Override defaults.
+	genericArgs.GoHeaderFilePath = filepath.Join(args.DefaultSourceTree(), utilbuild.BoilerplatePath())
+
+	app := ccli.CommandLine
+	genericArgs.AddFlags(app)
+	app.RunAndExitOnError()
+
+	if err := flag_gen.Validate(genericArgs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Run it.
+	if err := genericArgs.Execute(
+		flag_gen.NameSystems(),
+		flag_gen.DefaultNameSystem(),
+		flag_gen.Packages,
+	); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Infof("Completed successfully.")
+}
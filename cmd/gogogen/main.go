@@ -0,0 +1,117 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// gogogen bundles several of the generators in one binary, as subcommands
+// taking the flags of the standalone binaries:
+//   gogogen deepcopy -i github.com/example/api/v1
+//   gogogen client -i github.com/example/api/v1
+//
+// Run "gogogen help" for the list of generators.
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	ccli "github.com/lack-io/cli"
+
+	"github.com/lack-io/gogogen/client-gen"
+	"github.com/lack-io/gogogen/conversion-gen"
+	"github.com/lack-io/gogogen/deepcopy-gen"
+	"github.com/lack-io/gogogen/defaulter-gen"
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/register-gen"
+	utilbuild "github.com/lack-io/gogogen/util/build"
+	"github.com/lack-io/gogogen/util/log"
+)
+
+func main() {
+	if err := args.RunSubcommands(context.Background(), "gogogen", subcommands(), os.Args); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+}
+
+func subcommands() []args.Subcommand {
+	deepcopyArgs, deepcopyCustomArgs := deepcopy_gen.NewDefaults()
+	defaulterArgs, defaulterCustomArgs := defaulter_gen.NewDefaults()
+	conversionArgs, conversionCustomArgs := conversion_gen.NewDefaults()
+	clientArgs := client_gen.NewDefaults()
+	registerArgs := register_gen.NewDefaults()
+
+	subcommands := []args.Subcommand{
+		{
+			Name:  "deepcopy",
+			Usage: "Generates DeepCopy functions.",
+			Args:  deepcopyArgs,
+			AddFlags: func(app *ccli.App) error {
+				return deepcopyArgs.RegisterCustomArgs(app, deepcopyCustomArgs)
+			},
+			Validate:      deepcopy_gen.Validate,
+			NameSystems:   deepcopy_gen.NameSystems(),
+			DefaultSystem: deepcopy_gen.DefaultNameSystem(),
+			Packages:      deepcopy_gen.Package,
+		},
+		{
+			Name:  "defaulter",
+			Usage: "Generates functions setting the defaults of types.",
+			Args:  defaulterArgs,
+			AddFlags: func(app *ccli.App) error {
+				defaulterCustomArgs.AddFlags(app)
+				return nil
+			},
+			Validate:      defaulter_gen.Validate,
+			NameSystems:   defaulter_gen.NameSystems(),
+			DefaultSystem: defaulter_gen.DefaultNameSystem(),
+			Packages:      defaulter_gen.Packages,
+		},
+		{
+			Name:  "conversion",
+			Usage: "Generates functions converting between versions of types.",
+			Args:  conversionArgs,
+			AddFlags: func(app *ccli.App) error {
+				conversionCustomArgs.AddFlags(app)
+				return nil
+			},
+			Validate:      conversion_gen.Validate,
+			NameSystems:   conversion_gen.NameSystems(),
+			DefaultSystem: conversion_gen.DefaultNameSystem(),
+			Packages:      conversion_gen.Packages,
+		},
+		{
+			Name:          "client",
+			Usage:         "Generates typed clients of REST APIs.",
+			Args:          clientArgs,
+			Validate:      client_gen.Validate,
+			NameSystems:   client_gen.NameSystems(),
+			DefaultSystem: client_gen.DefaultNameSystem(),
+			Packages:      client_gen.Packages,
+		},
+		{
+			Name:          "register",
+			Usage:         "Generates the registration of types with a scheme.",
+			Args:          registerArgs,
+			Validate:      register_gen.Validate,
+			NameSystems:   register_gen.NameSystems(),
+			DefaultSystem: register_gen.DefaultNameSystem(),
+			Packages:      register_gen.Packages,
+		},
+	}
+
+	// Override defaults.
+	for _, sc := range subcommands {
+		sc.Args.GoHeaderFilePath = filepath.Join(args.DefaultSourceTree(), utilbuild.BoilerplatePath())
+	}
+	return subcommands
+}
@@ -0,0 +1,76 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// grpc-gen is a tool for auto-generating gRPC services from Go interfaces.
+//
+// Given a list of input directories, it will find interfaces requesting
+// generation, and generate for each interface Foo with methods of the form
+//   Bar(ctx context.Context, a A, b B) (C, error)
+// the code to serve it over gRPC and call it:
+//   type FooBarRequest struct { A A; B B }
+//   type FooBarResponse struct { Result C }
+//   type FooClient struct { ... }
+//   func NewFooClient(cc grpc.ClientConnInterface, opts ...grpc.CallOption) *FooClient
+//   func RegisterFooServer(s grpc.ServiceRegistrar, impl Foo)
+//   var FooServiceDesc grpc.ServiceDesc
+//
+// FooClient implements Foo, so services can be defined in Go rather than in
+// protobuf. Messages are exchanged as JSON, by a codec the generated code
+// registers under the "json" content subtype; every method must take a
+// context.Context first and return an error last. Streaming is not
+// supported.
+//
+// Generation is governed by comment tags in the source. An interface
+// requests generation by a comment on it of the form:
+//   // +gogogen:grpc-gen
+//
+// The service is named <package name>.<interface name>, unless named with:
+//   // +gogogen:grpc-gen:service=foo.v1.Foo
+package main
+
+import (
+	"path/filepath"
+
+	ccli "github.com/lack-io/cli"
+
+	"github.com/lack-io/gogogen/grpc-gen"
+	"github.com/lack-io/gogogen/gogenerator/args"
+	utilbuild "github.com/lack-io/gogogen/util/build"
+	"github.com/lack-io/gogogen/util/log"
+)
+
+func main() {
+	genericArgs := grpc_gen.NewDefaults()
+
+	// Override defaults.
+	genericArgs.GoHeaderFilePath = filepath.Join(args.DefaultSourceTree(), utilbuild.BoilerplatePath())
+
+	app := ccli.CommandLine
+	genericArgs.AddFlags(app)
+	app.RunAndExitOnError()
+
+	if err := grpc_gen.Validate(genericArgs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Run it.
+	if err := genericArgs.Execute(
+		grpc_gen.NameSystems(),
+		grpc_gen.DefaultNameSystem(),
+		grpc_gen.Packages,
+	); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Infof("Completed successfully.")
+}
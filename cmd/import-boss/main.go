@@ -0,0 +1,77 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// import-boss is a tool for checking that packages only import what they
+// are allowed to.
+//
+// Given a list of input directories, it checks the imports of each package
+// against the rules of the .import-restrictions files in its directory and
+// the directories above it, up to the one with the go.mod file, and against
+// the rules in its doc.go. It writes no files, and fails listing the
+// violations, if any. A .import-restrictions file holds JSON of the form:
+//   {
+//     "Rules": [
+//       {
+//         "SelectorRegexp": "^github[.]com/lack-io/",
+//         "AllowedPrefixes": ["github.com/lack-io/gogogen/runtime"],
+//         "ForbiddenPrefixes": ["github.com/lack-io/gogogen/runtime/meta"]
+//       }
+//     ]
+//   }
+//
+// A rule applies to the imports matching its selector, or to all of them if
+// it has none. Such an import is a violation if it has a forbidden prefix,
+// or if the rule has allowed prefixes and it has none of them. Imports of
+// the standard library are always allowed.
+//
+// A package adds a rule of its own, applying to all of its imports, by a
+// comment in its doc.go of the form:
+//   // +gogogen:import-boss:allowedPrefixes=github.com/a|github.com/b,forbiddenPrefixes=github.com/c
+package main
+
+import (
+	"path/filepath"
+
+	ccli "github.com/lack-io/cli"
+
+	"github.com/lack-io/gogogen/import-boss"
+	"github.com/lack-io/gogogen/gogenerator/args"
+	utilbuild "github.com/lack-io/gogogen/util/build"
+	"github.com/lack-io/gogogen/util/log"
+)
+
+func main() {
+	genericArgs := import_boss.NewDefaults()
+
+	// Override defaults.
+	genericArgs.GoHeaderFilePath = filepath.Join(args.DefaultSourceTree(), utilbuild.BoilerplatePath())
+
+	app := ccli.CommandLine
+	genericArgs.AddFlags(app)
+	app.RunAndExitOnError()
+
+	if err := import_boss.Validate(genericArgs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Run it.
+	if err := genericArgs.Execute(
+		import_boss.NameSystems(),
+		import_boss.DefaultNameSystem(),
+		import_boss.Packages,
+	); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Infof("Completed successfully.")
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// json-gen is a tool for auto-generating JSON encoding methods.
+//
+// Given a list of input directories, it will generate, for every requested
+// struct type:
+//   func (in Foo) MarshalJSON() ([]byte, error)
+//   func (in *Foo) AppendJSON(b []byte) ([]byte, error)
+//   func (out *Foo) UnmarshalJSON(data []byte) error
+//   func (out *Foo) UnmarshalJSONFrom(l *jsonutil.Lexer)
+//
+// The methods produce and accept the same JSON as encoding/json, without
+// reflection. They honor json struct tags, including omitempty and "-", flatten
+// embedded structs, and follow pointers. Values the generated code can not
+// handle itself, such as interfaces or types with their own MarshalJSON or
+// MarshalText methods, are passed to encoding/json. As encoding/json does, keys
+// are matched with the names of fields exactly, or else ignoring case. Unlike
+// encoding/json, the ",string" option is not supported.
+//
+// Generation is governed by comment tags in the source. A type requests
+// generation by a comment on the type of the form:
+//   // +gogogen:json-gen
+//
+// and a package may request it for all of its struct types, by including a
+// comment in the file-comments of one file, of the form:
+//   // +gogogen:json-gen=package
+//
+// Individual types then opt out with:
+//   // +gogogen:json-gen=false
+package main
+
+import (
+	"path/filepath"
+
+	ccli "github.com/lack-io/cli"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/json-gen"
+	utilbuild "github.com/lack-io/gogogen/util/build"
+	"github.com/lack-io/gogogen/util/log"
+)
+
+func main() {
+	genericArgs := json_gen.NewDefaults()
+
+	// Override defaults.
+	genericArgs.GoHeaderFilePath = filepath.Join(args.DefaultSourceTree(), utilbuild.BoilerplatePath())
+
+	app := ccli.CommandLine
+	genericArgs.AddFlags(app)
+	app.RunAndExitOnError()
+
+	if err := json_gen.Validate(genericArgs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Run it.
+	if err := genericArgs.Execute(
+		json_gen.NameSystems(),
+		json_gen.DefaultNameSystem(),
+		json_gen.Packages,
+	); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Infof("Completed successfully.")
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// jsonschema-gen is a tool for auto-generating JSON Schema documents.
+//
+// Given a list of input directories, it will write, for every package with
+// requested types, a draft 2020-12 JSON Schema document whose $defs
+// describe the JSON encoding of those types and of the types they refer to.
+// Struct fields become properties, named by their json struct tag, doc
+// comments become descriptions, and named types with constants become
+// enums. Types requested in another input package are not repeated, but
+// referred to in that package's document.
+//
+// With --base-uri, each document gets an $id made of the URI and its package
+// path, and references between documents are absolute. Otherwise they are
+// relative to the output directories.
+//
+// Generation is governed by comment tags in the source. A type requests
+// generation by a comment on the type of the form:
+//   // +gogogen:jsonschema-gen
+//
+// and a package may request it for all of its types, by including a comment
+// in the file-comments of one file, of the form:
+//   // +gogogen:jsonschema-gen=package
+//
+// Individual types then opt out with:
+//   // +gogogen:jsonschema-gen=false
+//
+// A field is required, unless it is a pointer, omitempty, or has the comment
+// tag:
+//   // +optional
+//
+// A pointer or omitempty field is nevertheless required with:
+//   // +required
+//
+// and a field's default is given, as JSON, by:
+//   // +default=<value>
+package main
+
+import (
+	"path/filepath"
+
+	ccli "github.com/lack-io/cli"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/jsonschema-gen"
+	utilbuild "github.com/lack-io/gogogen/util/build"
+	"github.com/lack-io/gogogen/util/log"
+)
+
+func main() {
+	genericArgs, customArgs := jsonschema_gen.NewDefaults()
+
+	// Override defaults.
+	genericArgs.GoHeaderFilePath = filepath.Join(args.DefaultSourceTree(), utilbuild.BoilerplatePath())
+
+	app := ccli.CommandLine
+	genericArgs.AddFlags(app)
+	customArgs.AddFlags(app)
+	app.RunAndExitOnError()
+
+	if err := jsonschema_gen.Validate(genericArgs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Run it.
+	if err := genericArgs.Execute(
+		jsonschema_gen.NameSystems(),
+		jsonschema_gen.DefaultNameSystem(),
+		jsonschema_gen.Packages,
+	); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Infof("Completed successfully.")
+}
@@ -0,0 +1,79 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// lister-gen is a tool for auto-generating typed listers of resources.
+//
+// A lister reads the objects of a resource from a cache.Indexer of
+// github.com/lack-io/gogogen/runtime/cache, usually filled from a watch of
+// the API, so that controllers don't ask the API for every object they look
+// at. Given a list of input directories, it will find the resource types,
+// and generate for each type Foo:
+//   type FooLister interface {
+//     List(match func(*Foo) bool) ([]*Foo, error)
+//     Get(name string) (*Foo, error)
+//     ByIndex(indexName, indexedValue string) ([]*Foo, error)
+//   }
+//   func NewFooLister(indexer cache.Indexer) FooLister
+//
+// The lister of a namespaced resource gets objects through a lister of a
+// namespace instead, returned by its Foos(namespace string) method, which
+// lists the objects of the namespace with the cache.NamespaceIndex index.
+// The indexer holds *Foo objects, keyed by cache.NamespacedKey.
+//
+// Generation is governed by comment tags in the source. A type is a
+// resource by a comment on it of the form:
+//   // +gogogen:resource
+//
+// with optional parameters:
+//   // +gogogen:resource:namespaced,resource=foos
+//
+// The resource, which names it in errors, defaults to the lowercase plural
+// of the type.
+package main
+
+import (
+	"path/filepath"
+
+	ccli "github.com/lack-io/cli"
+
+	"github.com/lack-io/gogogen/lister-gen"
+	"github.com/lack-io/gogogen/gogenerator/args"
+	utilbuild "github.com/lack-io/gogogen/util/build"
+	"github.com/lack-io/gogogen/util/log"
+)
+
+func main() {
+	genericArgs := lister_gen.NewDefaults()
+
+	// Override defaults.
+	genericArgs.GoHeaderFilePath = filepath.Join(args.DefaultSourceTree(), utilbuild.BoilerplatePath())
+
+	app := ccli.CommandLine
+	genericArgs.AddFlags(app)
+	app.RunAndExitOnError()
+
+	if err := lister_gen.Validate(genericArgs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Run it.
+	if err := genericArgs.Execute(
+		lister_gen.NameSystems(),
+		lister_gen.DefaultNameSystem(),
+		lister_gen.Packages,
+	); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Infof("Completed successfully.")
+}
@@ -0,0 +1,69 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// mock-gen is a tool for auto-generating mock implementations of interfaces.
+//
+// Given a list of input directories, it will generate, for every exported
+// interface in them, a MockX struct implementing the interface X. The mock
+// records the arguments of every call, which are read back with
+// <Method>Calls, and answers calls with the function in its <Method>Func
+// field. <Method>Returns sets that function to one returning fixed values.
+// Methods without a stub return zero values.
+//
+// Generation is governed by comment tags in the source. An interface opts out
+// with a comment of the form:
+//   // +gogogen:mock=false
+//
+// With --tagged-only, only the interfaces with a comment of the form:
+//   // +gogogen:mock
+//
+// are mocked, whether they are exported or not.
+package main
+
+import (
+	"path/filepath"
+
+	ccli "github.com/lack-io/cli"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/mock-gen"
+	utilbuild "github.com/lack-io/gogogen/util/build"
+	"github.com/lack-io/gogogen/util/log"
+)
+
+func main() {
+	genericArgs, customArgs := mock_gen.NewDefaults()
+
+	// Override defaults.
+	genericArgs.GoHeaderFilePath = filepath.Join(args.DefaultSourceTree(), utilbuild.BoilerplatePath())
+
+	app := ccli.CommandLine
+	genericArgs.AddFlags(app)
+	customArgs.AddFlags(app)
+	app.RunAndExitOnError()
+
+	if err := mock_gen.Validate(genericArgs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Run it.
+	if err := genericArgs.Execute(
+		mock_gen.NameSystems(),
+		mock_gen.DefaultNameSystem(),
+		mock_gen.Packages,
+	); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Infof("Completed successfully.")
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// openapi-gen is a tool for auto-generating OpenAPI v3 schemas.
+//
+// Given a list of input directories, it will generate, for every requested
+// struct and named type, a schema describing its JSON encoding, along with
+// the schemas of the types it refers to. Struct fields become properties,
+// named by their json struct tag, and doc comments become descriptions.
+// Named types with constants become enums.
+//
+// By default the schemas are returned by a function in the package:
+//   func OpenAPISchemas() map[string]*openapi.Schema
+//
+// With --format=json or --format=yaml, a standalone document holding the
+// components section is written instead.
+//
+// Generation is governed by comment tags in the source. A type requests
+// generation by a comment on the type of the form:
+//   // +gogogen:openapi-gen
+//
+// and a package may request it for all of its types, by including a comment
+// in the file-comments of one file, of the form:
+//   // +gogogen:openapi-gen=package
+//
+// Individual types then opt out with:
+//   // +gogogen:openapi-gen=false
+//
+// A field is required, unless it is omitempty or has the comment tag:
+//   // +optional
+//
+// and a field's default is given, as JSON, by:
+//   // +default=<value>
+package main
+
+import (
+	"path/filepath"
+
+	ccli "github.com/lack-io/cli"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/openapi-gen"
+	utilbuild "github.com/lack-io/gogogen/util/build"
+	"github.com/lack-io/gogogen/util/log"
+)
+
+func main() {
+	genericArgs, customArgs := openapi_gen.NewDefaults()
+
+	// Override defaults.
+	genericArgs.GoHeaderFilePath = filepath.Join(args.DefaultSourceTree(), utilbuild.BoilerplatePath())
+
+	app := ccli.CommandLine
+	genericArgs.AddFlags(app)
+	customArgs.AddFlags(app)
+	app.RunAndExitOnError()
+
+	if err := openapi_gen.Validate(genericArgs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Run it.
+	if err := genericArgs.Execute(
+		openapi_gen.NameSystems(),
+		openapi_gen.DefaultNameSystem(),
+		openapi_gen.Packages,
+	); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Infof("Completed successfully.")
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// options-gen is a tool for auto-generating functional options.
+//
+// Given a list of input directories, it will generate, for every requested
+// struct Foo:
+//   type Option func(*Foo)
+//   func NewFoo(opts ...Option) *Foo
+//
+// and, for every field Bar of it:
+//   func WithBar(v Bar) Option
+//
+// NewFoo sets the fields which have defaults, and then applies the options.
+//
+// Generation is governed by comment tags in the source. A struct requests
+// generation by a comment on the type of the form:
+//   // +gogogen:options
+//
+// Since the option type and functions are declared in the package, a package
+// with several such structs renames them with:
+//   // +gogogen:options:option-type=FooOption
+//   // +gogogen:options:prefix=WithFoo
+//
+// A field opts out of having an option with:
+//   // +gogogen:options=false
+//
+// and its default is given, as JSON, by:
+//   // +default=<value>
+//
+// Defaults may be given for fields of basic types, and slices and maps of
+// them.
+package main
+
+import (
+	"path/filepath"
+
+	ccli "github.com/lack-io/cli"
+
+	"github.com/lack-io/gogogen/options-gen"
+	"github.com/lack-io/gogogen/gogenerator/args"
+	utilbuild "github.com/lack-io/gogogen/util/build"
+	"github.com/lack-io/gogogen/util/log"
+)
+
+func main() {
+	genericArgs := options_gen.NewDefaults()
+
+	// Override defaults.
+	genericArgs.GoHeaderFilePath = filepath.Join(args.DefaultSourceTree(), utilbuild.BoilerplatePath())
+
+	app := ccli.CommandLine
+	genericArgs.AddFlags(app)
+	app.RunAndExitOnError()
+
+	if err := options_gen.Validate(genericArgs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Run it.
+	if err := genericArgs.Execute(
+		options_gen.NameSystems(),
+		options_gen.DefaultNameSystem(),
+		options_gen.Packages,
+	); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Infof("Completed successfully.")
+}
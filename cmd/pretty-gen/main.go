@@ -0,0 +1,88 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// pretty-gen is a tool for auto-generating readable String methods.
+//
+// Given a list of input directories, it will generate, for every requested
+// struct type:
+//   func (x Foo) String() string
+//   func (x Foo) FormatTo(p *prettyutil.Printer)
+//
+// String writes values in a compact, Go-like form, for debug logs to use
+// rather than %+v:
+//   Foo{Name: "a", Items: [1, 2, ... (+8 more)], Labels: {"k": "v"}}
+//
+// Nil pointers, slices, maps, interfaces, functions and channels are left out
+// of the structs they are fields of, and pointers are followed. At most
+// --max-items items of every slice, array and map are shown, unless a type has
+// the comment tag:
+//   // +gogogen:pretty-gen:max-items=20
+//
+// Map entries are sorted by their keys, byte slices only show their length,
+// and values whose types have a String method, such as time.Time, are written
+// with it. Structs of other packages, interfaces and the other values the
+// generated code can not handle itself are written as %+v writes them.
+//
+// Fields, and types whose values are to be hidden wherever they appear, are
+// redacted with:
+//   // +gogogen:secret
+//
+// Generation is governed by comment tags in the source. A type requests
+// generation by a comment on the type of the form:
+//   // +gogogen:pretty-gen
+//
+// and a package may request it for all of its struct types, by including a
+// comment in the file-comments of one file, of the form:
+//   // +gogogen:pretty-gen=package
+//
+// Individual types then opt out, and fields are left out, with:
+//   // +gogogen:pretty-gen=false
+package main
+
+import (
+	"path/filepath"
+
+	ccli "github.com/lack-io/cli"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/pretty-gen"
+	utilbuild "github.com/lack-io/gogogen/util/build"
+	"github.com/lack-io/gogogen/util/log"
+)
+
+func main() {
+	genericArgs, customArgs := pretty_gen.NewDefaults()
+
+	// Override defaults.
+	genericArgs.GoHeaderFilePath = filepath.Join(args.DefaultSourceTree(), utilbuild.BoilerplatePath())
+
+	app := ccli.CommandLine
+	genericArgs.AddFlags(app)
+	customArgs.AddFlags(app)
+	app.RunAndExitOnError()
+
+	if err := pretty_gen.Validate(genericArgs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Run it.
+	if err := genericArgs.Execute(
+		pretty_gen.NameSystems(),
+		pretty_gen.DefaultNameSystem(),
+		pretty_gen.Packages,
+	); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Infof("Completed successfully.")
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// protomarshal-gen is a tool for auto-generating protobuf encoding methods,
+// like those gogo/protobuf generates, without protoc.
+//
+// Given a list of input directories, it will generate, for every requested
+// struct type:
+//   func (m *Foo) Size() int
+//   func (m *Foo) Marshal() ([]byte, error)
+//   func (m *Foo) MarshalTo(dAtA []byte) (int, error)
+//   func (m *Foo) Unmarshal(dAtA []byte) error
+//
+// The fields are the members with protobuf struct tags, as goproto-gen
+// writes them, of the form:
+//   Name string `protobuf:"bytes,1,opt,name=name"`
+//
+// The first part of the tag is the wire type: varint, zigzag32 or zigzag64
+// for sint fields, fixed32 or fixed64, or bytes, and the second the field
+// number. Zero scalars are left out, as in proto3; pointers to scalars are
+// written whenever they are set. Repeated scalars are packed if the tag
+// has the "packed" option, and maps, whose keys and values may have their
+// own protobuf_key and protobuf_val tags, are written in the order of their
+// keys. Members of struct types are messages, which must be generated too,
+// or have the same methods. Nil messages, such as nil elements of slices or
+// maps of pointers, are written as empty messages.
+//
+// Generation is governed by comment tags in the source. A type requests
+// generation by a comment on the type of the form:
+//   // +gogogen:protomarshal-gen
+//
+// and a package may request it for all of its struct types, by including a
+// comment in the file-comments of one file, of the form:
+//   // +gogogen:protomarshal-gen=package
+//
+// Individual types then opt out with:
+//   // +gogogen:protomarshal-gen=false
+package main
+
+import (
+	"path/filepath"
+
+	ccli "github.com/lack-io/cli"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/protomarshal-gen"
+	utilbuild "github.com/lack-io/gogogen/util/build"
+	"github.com/lack-io/gogogen/util/log"
+)
+
+func main() {
+	genericArgs := protomarshal_gen.NewDefaults()
+
+	// Override defaults.
+	genericArgs.GoHeaderFilePath = filepath.Join(args.DefaultSourceTree(), utilbuild.BoilerplatePath())
+
+	app := ccli.CommandLine
+	genericArgs.AddFlags(app)
+	app.RunAndExitOnError()
+
+	if err := protomarshal_gen.Validate(genericArgs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Run it.
+	if err := genericArgs.Execute(
+		protomarshal_gen.NameSystems(),
+		protomarshal_gen.DefaultNameSystem(),
+		protomarshal_gen.Packages,
+	); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Infof("Completed successfully.")
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// register-gen is a tool for auto-generating the registration of API types
+// in a scheme.
+//
+// Given a list of input directories, it will find packages naming the group
+// and version of their API, and generate for each:
+//   const GroupName = "example.com"
+//   var SchemeGroupVersion = scheme.GroupVersion{Group: GroupName, Version: "v1"}
+//   var SchemeBuilder scheme.SchemeBuilder
+//   var AddToScheme = SchemeBuilder.AddToScheme
+//
+// along with a function, registered with SchemeBuilder, adding the root
+// types of the package to a scheme of
+// github.com/lack-io/gogogen/runtime/scheme. Other files of the package may
+// register functions of their own with localSchemeBuilder.
+//
+// Generation is governed by comment tags in the source. A package names its
+// group and version by a comment in its doc.go of the form:
+//   // +gogogen:register-gen:group=example.com,version=v1
+//
+// The version defaults to the name of the package. The root types are the
+// structs embedding github.com/lack-io/gogogen/runtime/meta.Meta, and the
+// types with a comment of the form:
+//   // +gogogen:register-gen=true
+//
+// A struct embedding Meta is left out by a comment of the form:
+//   // +gogogen:register-gen=false
+package main
+
+import (
+	"path/filepath"
+
+	ccli "github.com/lack-io/cli"
+
+	"github.com/lack-io/gogogen/register-gen"
+	"github.com/lack-io/gogogen/gogenerator/args"
+	utilbuild "github.com/lack-io/gogogen/util/build"
+	"github.com/lack-io/gogogen/util/log"
+)
+
+func main() {
+	genericArgs := register_gen.NewDefaults()
+
+	// Override defaults.
+	genericArgs.GoHeaderFilePath = filepath.Join(args.DefaultSourceTree(), utilbuild.BoilerplatePath())
+
+	app := ccli.CommandLine
+	genericArgs.AddFlags(app)
+	app.RunAndExitOnError()
+
+	if err := register_gen.Validate(genericArgs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Run it.
+	if err := genericArgs.Execute(
+		register_gen.NameSystems(),
+		register_gen.DefaultNameSystem(),
+		register_gen.Packages,
+	); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Infof("Completed successfully.")
+}
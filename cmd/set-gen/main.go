@@ -14,9 +14,12 @@
 
 // set-gen is an example usage of gengo
 //
-// Struct in the input directories with the below line in their comments will
-// have sets generated for them.
-// // +vine:genset
+// Structs and named types, such as "type Color string", in the input
+// directories with the below line in their comments will have sets generated
+// for them.
+// // +gogogen:set-gen
+//
+// The older +vine:genset tag is still honored.
 //
 // Any builtin type referenced anywhere in the input directories will have a
 // set generated for it.
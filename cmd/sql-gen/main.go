@@ -0,0 +1,87 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// sql-gen is a tool for auto-generating SQL tables of structs.
+//
+// Given a list of input directories, it will find structs requesting
+// generation, and generate for each struct Foo:
+//   const FooTable = "foos"
+//   const FooSchema = `CREATE TABLE foos (...);`
+//   func FooColumns() []string
+//   func (x *Foo) SQLPointers() []interface{}
+//   func (x *Foo) SQLValues() []interface{}
+//   func (x *Foo) ScanRow(row interface{ Scan(dest ...interface{}) error }) error
+//
+// so rows are read and written without reflection. The fields with a db
+// struct tag are the columns, along with those of embedded structs without
+// one:
+//   ID    int64  `db:"id,pk"`
+//   Email string `db:"email,unique"`
+//   Data  Blob   `db:"data,type=JSONB"`
+//
+// Columns are NOT NULL unless their field is a pointer or one of the Null
+// types of database/sql. Their SQL types follow the --dialect flag, and must
+// be given with type= for Go types without a default.
+//
+// Generation is governed by comment tags in the source. A struct requests
+// generation by a comment on it of the form:
+//   // +gogogen:sql-gen
+//
+// and a package may request it for all of its structs, by including a
+// comment in the file-comments of one file, of the form:
+//   // +gogogen:sql-gen=package
+//
+// Individual structs then opt out with:
+//   // +gogogen:sql-gen=false
+//
+// The table is the snake case plural of the struct name, unless named with:
+//   // +gogogen:sql-gen:table=people
+package main
+
+import (
+	"path/filepath"
+
+	ccli "github.com/lack-io/cli"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/sql-gen"
+	utilbuild "github.com/lack-io/gogogen/util/build"
+	"github.com/lack-io/gogogen/util/log"
+)
+
+func main() {
+	genericArgs, customArgs := sql_gen.NewDefaults()
+
+	// Override defaults.
+	genericArgs.GoHeaderFilePath = filepath.Join(args.DefaultSourceTree(), utilbuild.BoilerplatePath())
+
+	app := ccli.CommandLine
+	genericArgs.AddFlags(app)
+	customArgs.AddFlags(app)
+	app.RunAndExitOnError()
+
+	if err := sql_gen.Validate(genericArgs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Run it.
+	if err := genericArgs.Execute(
+		sql_gen.NameSystems(),
+		sql_gen.DefaultNameSystem(),
+		sql_gen.Packages,
+	); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Infof("Completed successfully.")
+}
@@ -0,0 +1,84 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// validate-gen is a tool for auto-generating Validate methods of structs.
+//
+// Given a list of input directories, it will generate, for every requested
+// struct:
+//   func (x *Foo) Validate() error
+//
+// which checks the fields against the rules in their comment tags, of the
+// form:
+//   // +validate:required,min=1,max=10,pattern="^[a-z]+$",enum=a|b|c
+//
+// min and max bound numbers, and the length of strings, slices and maps.
+// pattern is a regular expression strings must match, and enum lists the
+// values a string or number may have. Rules on a pointer apply to what it
+// points to; required fails on nil pointers and on zero values. Values may be
+// double quoted to hold commas.
+//
+// Fields whose types, or the types of their items, have a Validate method of
+// their own are validated with it too. The error returned is a
+// validation.Errors, from github.com/lack-io/gogogen/runtime/validation,
+// with the path of each field, such as spec.containers[0].image, built from
+// the JSON names of the fields.
+//
+// Generation is governed by comment tags in the source. A struct gets a
+// Validate method if any of its fields have rules, or by a comment on the
+// type of the form:
+//   // +gogogen:validate-gen
+//
+// and a package may request it for all of its structs, by including a
+// comment in the file-comments of one file, of the form:
+//   // +gogogen:validate-gen=package
+//
+// Individual structs then opt out with:
+//   // +gogogen:validate-gen=false
+package main
+
+import (
+	"path/filepath"
+
+	ccli "github.com/lack-io/cli"
+
+	"github.com/lack-io/gogogen/validate-gen"
+	"github.com/lack-io/gogogen/gogenerator/args"
+	utilbuild "github.com/lack-io/gogogen/util/build"
+	"github.com/lack-io/gogogen/util/log"
+)
+
+func main() {
+	genericArgs := validate_gen.NewDefaults()
+
+	// Override defaults.
+	genericArgs.GoHeaderFilePath = filepath.Join(args.DefaultSourceTree(), utilbuild.BoilerplatePath())
+
+	app := ccli.CommandLine
+	genericArgs.AddFlags(app)
+	app.RunAndExitOnError()
+
+	if err := validate_gen.Validate(genericArgs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Run it.
+	if err := genericArgs.Execute(
+		validate_gen.NameSystems(),
+		validate_gen.DefaultNameSystem(),
+		validate_gen.Packages,
+	); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Infof("Completed successfully.")
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// visitor-gen is a tool for auto-generating exhaustive visitors of tagged
+// unions.
+//
+// A tagged union is an interface, usually with an unexported marker method,
+// and the types of its package implementing it, its variants. Given a list
+// of input directories, it will find interfaces requesting a visitor, and
+// generate for each interface Shape with variants *Circle and Square:
+//   type ShapeVisitor interface {
+//     VisitCircle(*Circle)
+//     VisitSquare(Square)
+//   }
+//   func VisitShape(v Shape, visitor ShapeVisitor)
+//   func SwitchShape(v Shape, circle func(*Circle), square func(Square))
+//
+// Adding a variant adds a method to ShapeVisitor and a parameter to
+// SwitchShape, so the code handling the union stops compiling until it
+// handles the new variant too. A type whose methods implementing the
+// interface all have value receivers is a variant by value, otherwise by
+// pointer.
+//
+// Generation is governed by comment tags in the source. An interface
+// requests a visitor by a comment on it of the form:
+//   // +gogogen:visitor
+package main
+
+import (
+	"path/filepath"
+
+	ccli "github.com/lack-io/cli"
+
+	"github.com/lack-io/gogogen/visitor-gen"
+	"github.com/lack-io/gogogen/gogenerator/args"
+	utilbuild "github.com/lack-io/gogogen/util/build"
+	"github.com/lack-io/gogogen/util/log"
+)
+
+func main() {
+	genericArgs := visitor_gen.NewDefaults()
+
+	// Override defaults.
+	genericArgs.GoHeaderFilePath = filepath.Join(args.DefaultSourceTree(), utilbuild.BoilerplatePath())
+
+	app := ccli.CommandLine
+	genericArgs.AddFlags(app)
+	app.RunAndExitOnError()
+
+	if err := visitor_gen.Validate(genericArgs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Run it.
+	if err := genericArgs.Execute(
+		visitor_gen.NameSystems(),
+		visitor_gen.DefaultNameSystem(),
+		visitor_gen.Packages,
+	); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Infof("Completed successfully.")
+}
@@ -0,0 +1,67 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// wrap-gen is a tool for auto-generating instrumented wrappers of interfaces.
+//
+// Given a list of input directories, it will find interfaces requesting a
+// wrapper, and generate for each interface Foo:
+//   type FooWrapper struct { ... }
+//   func WrapFoo(next Foo, observers ...wrap.Observer) *FooWrapper
+//
+// FooWrapper implements Foo by delegating every call to next, and telling
+// the observers of github.com/lack-io/gogogen/runtime/wrap of it, with its
+// duration and error. Observers log calls, measure them, or hand them to a
+// tracer. Methods taking a context.Context first are called with the
+// context returned by the observers, so that it may carry a trace span.
+//
+// Generation is governed by comment tags in the source. An interface
+// requests a wrapper by a comment on it of the form:
+//   // +gogogen:wrap
+package main
+
+import (
+	"path/filepath"
+
+	ccli "github.com/lack-io/cli"
+
+	"github.com/lack-io/gogogen/wrap-gen"
+	"github.com/lack-io/gogogen/gogenerator/args"
+	utilbuild "github.com/lack-io/gogogen/util/build"
+	"github.com/lack-io/gogogen/util/log"
+)
+
+func main() {
+	genericArgs := wrap_gen.NewDefaults()
+
+	// Override defaults.
+	genericArgs.GoHeaderFilePath = filepath.Join(args.DefaultSourceTree(), utilbuild.BoilerplatePath())
+
+	app := ccli.CommandLine
+	genericArgs.AddFlags(app)
+	app.RunAndExitOnError()
+
+	if err := wrap_gen.Validate(genericArgs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Run it.
+	if err := genericArgs.Execute(
+		wrap_gen.NameSystems(),
+		wrap_gen.DefaultNameSystem(),
+		wrap_gen.Packages,
+	); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Infof("Completed successfully.")
+}
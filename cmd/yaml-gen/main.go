@@ -0,0 +1,87 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// yaml-gen is a tool for auto-generating YAML encoding methods.
+//
+// Given a list of input directories, it will generate, for every requested
+// struct type:
+//   func (in Foo) EncodeYAML() ([]byte, error)
+//   func (in *Foo) EncodeYAMLTo(e *yamlutil.Encoder)
+//   func (out *Foo) DecodeYAML(data []byte) error
+//   func (out *Foo) DecodeYAMLNode(d *yamlutil.Decoder, n *yamlutil.Node)
+//
+// The methods read and write YAML without reflection, using the keys the
+// go-yaml packages use: yaml struct tags, including omitempty, flow, inline
+// and "-", or else the lowercased member name. Durations, values with
+// MarshalText and UnmarshalText methods and empty interfaces are supported,
+// along with pointers, slices, arrays and maps keyed by strings or integers.
+// Values of other types must have yaml-gen methods of their own. Nil slices
+// and maps are written as null, as encoding/json does, rather than as empty
+// collections.
+//
+// The methods are named so as not to be taken for implementations of the
+// go-yaml packages' Marshaler and Unmarshaler interfaces, whose signatures
+// differ. Unlike those packages, DecodeYAML is strict: keys which match no
+// field, unless the struct inlines a map, and duplicate keys are errors.
+// Anchors, aliases, tags and multiple documents are rejected, as are
+// sequences longer than the array they are decoded into. Decoding with a
+// Decoder whose AllowUnknownFields is set skips unknown keys instead.
+//
+// Generation is governed by comment tags in the source. A type requests
+// generation by a comment on the type of the form:
+//   // +gogogen:yaml-gen
+//
+// and a package may request it for all of its struct types, by including a
+// comment in the file-comments of one file, of the form:
+//   // +gogogen:yaml-gen=package
+//
+// Individual types then opt out with:
+//   // +gogogen:yaml-gen=false
+package main
+
+import (
+	"path/filepath"
+
+	ccli "github.com/lack-io/cli"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	utilbuild "github.com/lack-io/gogogen/util/build"
+	"github.com/lack-io/gogogen/util/log"
+	"github.com/lack-io/gogogen/yaml-gen"
+)
+
+func main() {
+	genericArgs := yaml_gen.NewDefaults()
+
+	// Override defaults.
+	genericArgs.GoHeaderFilePath = filepath.Join(args.DefaultSourceTree(), utilbuild.BoilerplatePath())
+
+	app := ccli.CommandLine
+	genericArgs.AddFlags(app)
+	app.RunAndExitOnError()
+
+	if err := yaml_gen.Validate(genericArgs); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	// Run it.
+	if err := genericArgs.Execute(
+		yaml_gen.NameSystems(),
+		yaml_gen.DefaultNameSystem(),
+		yaml_gen.Packages,
+	); err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	log.Infof("Completed successfully.")
+}
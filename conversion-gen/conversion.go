@@ -0,0 +1,450 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conversion_gen
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/namer"
+	"github.com/lack-io/gogogen/gogenerator/types"
+	"github.com/lack-io/gogogen/util/log"
+	"github.com/lack-io/gogogen/util/sets"
+)
+
+// This is the comment tag that carries parameters for conversion generation.
+// On a package, its value is the import path of a peer package; on a type,
+// "false" opts the type out.
+const tagName = "gogogen:conversion-gen"
+
+func extractTag(comments []string) []string {
+	return types.ExtractCommentTags("+", comments)[tagName]
+}
+
+func isOptedOut(t *types.Type) bool {
+	comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
+	for _, v := range extractTag(comments) {
+		if v == "false" {
+			return true
+		}
+	}
+	return false
+}
+
+// NameSystems returns the name system used by the generators in this package.
+func NameSystems() namer.NameSystems {
+	return namer.NameSystems{
+		"public": namer.NewPublicNamer(1),
+		"raw":    namer.NewRawNamer("", nil),
+	}
+}
+
+// DefaultNameSystem returns the default name system for ordering the types to
+// be processed by the generators in this package.
+func DefaultNameSystem() string {
+	return "public"
+}
+
+// conversionPair identifies a conversion from one type to another.
+type conversionPair struct {
+	in, out types.Name
+}
+
+// conversionFuncs maps a pair of types to the function converting between
+// them.
+type conversionFuncs map[conversionPair]*types.Type
+
+// collectConversions adds every function of 'pkg' which has the signature
+//
+//	func Convert_<...>(in *A, out *B) error
+//
+// to 'funcs'.
+func collectConversions(pkg *types.Package, funcs conversionFuncs) {
+	for _, f := range pkg.SortedFunctions() {
+		name := f.Name.Name
+		if !strings.HasPrefix(name, "Convert_") {
+			continue
+		}
+		if f.Underlying == nil || f.Underlying.Signature == nil {
+			continue
+		}
+		sig := f.Underlying.Signature
+		if len(sig.Parameters) != 2 || len(sig.Results) != 1 ||
+			sig.Parameters[0].Kind != types.Pointer || sig.Parameters[1].Kind != types.Pointer ||
+			sig.Results[0].Name.Name != "error" {
+			log.Warnf("Function %v: ignoring conversion, expected func(in *A, out *B) error", f)
+			continue
+		}
+		funcs[conversionPair{sig.Parameters[0].Elem.Name, sig.Parameters[1].Elem.Name}] = f
+	}
+}
+
+func Packages(context *generator.Context, arguments *args.GeneratorArgs) generator.Packages {
+	boilerplate, err := arguments.LoadGoBoilerplate()
+	if err != nil {
+		log.Fatalf("Failed loading boilerplate: %v", err)
+	}
+
+	packages := generator.Packages{}
+	header := append(arguments.GeneratedBuildConstraint(), boilerplate...)
+
+	extraDirs := []string{}
+	if customArgs, ok := arguments.CustomArgs.(*CustomArgs); ok {
+		extraDirs = customArgs.ExtraPeerDirs
+	}
+
+	for i := range sets.NewString(context.Inputs...) {
+		log.Debugf("Considering pkg %q", i)
+		pkg := context.Universe[i]
+		if pkg == nil {
+			// If the input had no Go files, for example.
+			continue
+		}
+
+		peerPaths := extractTag(pkg.Comments)
+		if len(peerPaths) == 0 {
+			log.Debugf("  no tag")
+			continue
+		}
+
+		manual := conversionFuncs{}
+		collectConversions(pkg, manual)
+		for _, dir := range extraDirs {
+			extra, err := context.AddDirectory(dir)
+			if err != nil {
+				log.Fatalf("Package %v: failed to load %q: %v", i, dir, err)
+			}
+			collectConversions(extra, manual)
+		}
+
+		peers := []*types.Package{}
+		for _, peerPath := range peerPaths {
+			peer, err := context.AddDirectory(peerPath)
+			if err != nil {
+				log.Fatalf("Package %v: failed to load peer package %q: %v", i, peerPath, err)
+			}
+			collectConversions(peer, manual)
+			peers = append(peers, peer)
+		}
+
+		// Every struct type with a peer of the same name is converted in
+		// both directions.
+		peerTypes := map[*types.Type][]*types.Type{}
+		for _, t := range pkg.SortedTypes() {
+			if t.Kind != types.Struct || isOptedOut(t) {
+				continue
+			}
+			for _, peer := range peers {
+				if pt, ok := peer.Types[t.Name.Name]; ok && pt.Kind == types.Struct && !isOptedOut(pt) {
+					peerTypes[t] = append(peerTypes[t], pt)
+				}
+			}
+		}
+		if len(peerTypes) == 0 {
+			continue
+		}
+
+		log.Infof("Package %q needs generation", i)
+		packages = append(packages,
+			&generator.DefaultPackage{
+				PackageName: strings.Split(filepath.Base(pkg.Path), ".")[0],
+				PackagePath: pkg.Path,
+				HeaderText:  header,
+				GeneratorFunc: func(c *generator.Context) (generators []generator.Generator) {
+					return []generator.Generator{
+						NewGenConversion(arguments.OutputFileName(pkg, "conversion"), pkg.Path, peerTypes, manual),
+					}
+				},
+				FilterFunc: func(c *generator.Context, t *types.Type) bool {
+					return t.Name.Package == pkg.Path
+				},
+			})
+	}
+	return packages
+}
+
+// genConversion produces a file with auto-generated conversion functions.
+type genConversion struct {
+	generator.DefaultGen
+	targetPackage string
+	imports       namer.ImportTracker
+	peerTypes     map[*types.Type][]*types.Type
+	manual        conversionFuncs
+	// generated holds the conversions this file provides a public
+	// Convert_ function for.
+	generated map[conversionPair]bool
+}
+
+func NewGenConversion(sanitizedName, targetPackage string, peerTypes map[*types.Type][]*types.Type, manual conversionFuncs) generator.Generator {
+	g := &genConversion{
+		DefaultGen: generator.DefaultGen{
+			OptionalName: sanitizedName,
+		},
+		targetPackage: targetPackage,
+		imports:       generator.NewImportTracker(),
+		peerTypes:     peerTypes,
+		manual:        manual,
+		generated:     map[conversionPair]bool{},
+	}
+	for t, peers := range peerTypes {
+		for _, pt := range peers {
+			g.generated[conversionPair{t.Name, pt.Name}] = true
+			g.generated[conversionPair{pt.Name, t.Name}] = true
+		}
+	}
+	return g
+}
+
+func (g *genConversion) Namers(c *generator.Context) namer.NameSystems {
+	// Have the raw namer for this file track what it imports.
+	return namer.NameSystems{
+		"raw": namer.NewRawNamer(g.targetPackage, g.imports),
+	}
+}
+
+func (g *genConversion) Filter(c *generator.Context, t *types.Type) bool {
+	_, ok := g.peerTypes[t]
+	return ok
+}
+
+func (g *genConversion) isOtherPackage(pkg string) bool {
+	if pkg == g.targetPackage {
+		return false
+	}
+	if strings.HasSuffix(pkg, "\""+g.targetPackage+"\"") {
+		return false
+	}
+	return true
+}
+
+func (g *genConversion) Imports(c *generator.Context) (imports []string) {
+	importLines := []string{}
+	for _, singleImport := range g.imports.ImportLines() {
+		if g.isOtherPackage(singleImport) {
+			importLines = append(importLines, singleImport)
+		}
+	}
+	return importLines
+}
+
+// funcName returns the name of the conversion from 'in' to 'out', of the form
+// Convert_<pkg>_<Type>_To_<pkg>_<Type>.
+func funcName(c *generator.Context, prefix string, in, out *types.Type) string {
+	return fmt.Sprintf("%sConvert_%s_%s_To_%s_%s", prefix, packageName(c, in), in.Name.Name, packageName(c, out), out.Name.Name)
+}
+
+func packageName(c *generator.Context, t *types.Type) string {
+	if pkg := c.Universe[t.Name.Package]; pkg != nil && pkg.Name != "" {
+		return pkg.Name
+	}
+	return filepath.Base(t.Name.Package)
+}
+
+func (g *genConversion) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	sw := generator.NewSnippetWriter(w, c, "$", "$")
+	for _, pt := range g.peerTypes[t] {
+		log.Infof("Generating conversions between %v and %v", t, pt)
+		g.generateConversion(c, sw, t, pt)
+		g.generateConversion(c, sw, pt, t)
+	}
+	return sw.Error()
+}
+
+func (g *genConversion) generateConversion(c *generator.Context, sw *generator.SnippetWriter, in, out *types.Type) {
+	args := generator.Args{
+		"in":   in,
+		"out":  out,
+		"auto": funcName(c, "auto", in, out),
+		"name": funcName(c, "", in, out),
+	}
+
+	complete := true
+	sw.Do("func $.auto$(in *$.in|raw$, out *$.out|raw$) error {\n", args)
+	for _, m := range in.Members {
+		// The peer types are in another package.
+		if namer.IsPrivateGoName(m.Name) {
+			sw.Do("// WARNING: in.$.$ requires manual conversion: unexported\n", m.Name)
+			complete = false
+			continue
+		}
+		outMember, ok := findMember(out, m.Name)
+		if !ok {
+			sw.Do("// WARNING: in.$.$ requires manual conversion: does not exist in peer-type\n", m.Name)
+			complete = false
+			continue
+		}
+		if !g.convertible(m.Type, outMember.Type) {
+			sw.Do("// WARNING: in.$.name$ requires manual conversion: inconvertible types ($.in$ vs $.out$)\n", generator.Args{
+				"name": m.Name,
+				"in":   m.Type.String(),
+				"out":  outMember.Type.String(),
+			})
+			complete = false
+			continue
+		}
+		g.writeConversion(c, sw, "in."+m.Name, "out."+m.Name, m.Type, outMember.Type)
+	}
+	sw.Do("return nil\n", nil)
+	sw.Do("}\n\n", nil)
+
+	if _, found := g.manual[conversionPair{in.Name, out.Name}]; found {
+		// The manual conversion is expected to call the generated one.
+		return
+	}
+	if !complete {
+		log.Warnf("Conversion from %v to %v requires a manual %s function", in, out, args["name"])
+		delete(g.generated, conversionPair{in.Name, out.Name})
+		return
+	}
+	sw.Do("// $.name$ is an autogenerated conversion function.\n", args)
+	sw.Do("func $.name$(in *$.in|raw$, out *$.out|raw$) error {\n", args)
+	sw.Do("return $.auto$(in, out)\n", args)
+	sw.Do("}\n\n", args)
+}
+
+func findMember(t *types.Type, name string) (types.Member, bool) {
+	for _, m := range t.Members {
+		if m.Name == name {
+			return m, true
+		}
+	}
+	return types.Member{}, false
+}
+
+func identical(in, out *types.Type) bool {
+	return in == out || in.Name == out.Name && in.Name.Name != ""
+}
+
+func unwrapAlias(t *types.Type) *types.Type {
+	for t.Kind == types.Alias {
+		t = t.Underlying
+	}
+	return t
+}
+
+// conversionFunc returns the function converting 'in' to 'out', if any.
+func (g *genConversion) conversionFunc(c *generator.Context, in, out *types.Type) (string, *types.Type, bool) {
+	pair := conversionPair{in.Name, out.Name}
+	if f, ok := g.manual[pair]; ok {
+		return "", f, true
+	}
+	if g.generated[pair] {
+		return funcName(c, "", in, out), nil, true
+	}
+	return "", nil, false
+}
+
+// convertible returns true if a value of type 'in' can be converted to 'out'
+// by the generated code.
+func (g *genConversion) convertible(in, out *types.Type) bool {
+	if identical(in, out) {
+		return true
+	}
+	if g.manual[conversionPair{in.Name, out.Name}] != nil || g.generated[conversionPair{in.Name, out.Name}] {
+		return true
+	}
+	uin, uout := unwrapAlias(in), unwrapAlias(out)
+	if uin.Kind != uout.Kind {
+		return false
+	}
+	switch uin.Kind {
+	case types.Builtin:
+		return uin.Name == uout.Name
+	case types.Pointer, types.Slice:
+		return g.convertible(uin.Elem, uout.Elem)
+	case types.Map:
+		return g.convertible(uin.Key, uout.Key) && unwrapAlias(uin.Key).Kind == types.Builtin &&
+			g.convertible(uin.Elem, uout.Elem)
+	}
+	return false
+}
+
+// writeConversion emits code converting the addressable value 'inExpr' of
+// type 'in' to the addressable value 'outExpr' of type 'out'. Nested values
+// are reached by rebinding 'in' and 'out' to pointers.
+func (g *genConversion) writeConversion(c *generator.Context, sw *generator.SnippetWriter, inExpr, outExpr string, in, out *types.Type) {
+	args := generator.Args{
+		"in":   inExpr,
+		"out":  outExpr,
+		"type": out,
+	}
+	if identical(in, out) {
+		sw.Do("$.out$ = $.in$\n", args)
+		return
+	}
+	if name, f, ok := g.conversionFunc(c, in, out); ok {
+		args["inAddr"], args["outAddr"] = addrOf(inExpr), addrOf(outExpr)
+		if f != nil {
+			sw.Do("if err := $.func|raw$($.inAddr$, $.outAddr$); err != nil {\n", args.With("func", f))
+		} else {
+			sw.Do("if err := "+name+"($.inAddr$, $.outAddr$); err != nil {\n", args)
+		}
+		sw.Do("return err\n", nil)
+		sw.Do("}\n", nil)
+		return
+	}
+
+	uin, uout := unwrapAlias(in), unwrapAlias(out)
+	switch uin.Kind {
+	case types.Builtin:
+		sw.Do("$.out$ = $.type|raw$($.in$)\n", args)
+	case types.Pointer:
+		sw.Do("if $.in$ != nil {\n", args)
+		sw.Do("in, out := &$.in$, &$.out$\n", args)
+		sw.Do("*out = new($.|raw$)\n", uout.Elem)
+		g.writeConversion(c, sw, "**in", "**out", uin.Elem, uout.Elem)
+		sw.Do("} else {\n", nil)
+		sw.Do("$.out$ = nil\n", args)
+		sw.Do("}\n", nil)
+	case types.Slice:
+		sw.Do("if $.in$ != nil {\n", args)
+		sw.Do("in, out := &$.in$, &$.out$\n", args)
+		sw.Do("*out = make($.type|raw$, len(*in))\n", args)
+		sw.Do("for i := range *in {\n", nil)
+		g.writeConversion(c, sw, "(*in)[i]", "(*out)[i]", uin.Elem, uout.Elem)
+		sw.Do("}\n", nil)
+		sw.Do("} else {\n", nil)
+		sw.Do("$.out$ = nil\n", args)
+		sw.Do("}\n", nil)
+	case types.Map:
+		sw.Do("if $.in$ != nil {\n", args)
+		sw.Do("in, out := &$.in$, &$.out$\n", args)
+		sw.Do("*out = make($.type|raw$, len(*in))\n", args)
+		sw.Do("for key, val := range *in {\n", nil)
+		sw.Do("newVal := new($.|raw$)\n", uout.Elem)
+		g.writeConversion(c, sw, "val", "*newVal", uin.Elem, uout.Elem)
+		if identical(uin.Key, uout.Key) {
+			sw.Do("(*out)[key] = *newVal\n", nil)
+		} else {
+			sw.Do("(*out)[$.|raw$(key)] = *newVal\n", uout.Key)
+		}
+		sw.Do("}\n", nil)
+		sw.Do("} else {\n", nil)
+		sw.Do("$.out$ = nil\n", args)
+		sw.Do("}\n", nil)
+	}
+}
+
+// addrOf returns an expression for the address of 'expr'.
+func addrOf(expr string) string {
+	if strings.HasPrefix(expr, "*") {
+		return expr[1:]
+	}
+	return "&" + expr
+}
@@ -0,0 +1,98 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package conversion_gen
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	gentesting "github.com/lack-io/gogogen/gogenerator/testing"
+)
+
+const (
+	testdataPackage = "github.com/lack-io/gogogen/conversion-gen/testdata/cva"
+	outputFile      = "/out/" + testdataPackage + "/zz_generated.conversion.go"
+)
+
+// TestCacheTracksPeers checks that a cached run regenerates the conversions
+// of a package when only its peer package changes.
+func TestCacheTracksPeers(t *testing.T) {
+	peerFile, err := filepath.Abs("testdata/cvb/types.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cacheFile := filepath.Join(t.TempDir(), "cache")
+	fs := generator.NewMemFileSystem()
+	generate := func(overlay map[string][]byte) []byte {
+		t.Helper()
+		genericArgs, _ := NewDefaults()
+		genericArgs.GoHeader = []byte{}
+		genericArgs.GeneratorName = "conversion-gen"
+		genericArgs.InputDirs = []string{testdataPackage}
+		genericArgs.OutputBase = "/out"
+		genericArgs.CacheFile = cacheFile
+		genericArgs.Overlay = overlay
+		genericArgs.FS = fs
+		if err := genericArgs.Execute(NameSystems(), DefaultNameSystem(), Packages); err != nil {
+			t.Fatalf("failed generating: %v", err)
+		}
+		b, err := fs.ReadFile(outputFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	// The peer starts without the member B.
+	out := generate(map[string][]byte{peerFile: []byte("package cvb\n\ntype T struct {\n\tA int\n}\n")})
+	if !bytes.Contains(out, []byte("requires manual conversion")) {
+		t.Fatalf("expected B to need a manual conversion, got:\n%s", out)
+	}
+	out = generate(nil)
+	if !bytes.Contains(out, []byte("out.B = in.B")) {
+		t.Errorf("expected B to be converted once the peer has it, got:\n%s", out)
+	}
+}
+
+// TestUnexportedMembers checks that unexported members, which can't be
+// reached from the peer package, are left to manual conversions.
+func TestUnexportedMembers(t *testing.T) {
+	genericArgs, _ := NewDefaults()
+	genericArgs.GoHeader = []byte{}
+	genericArgs.GeneratorName = "conversion-gen"
+	files, err := gentesting.Generate(gentesting.Case{
+		InputDirs:     []string{testdataPackage},
+		NameSystems:   NameSystems(),
+		DefaultSystem: DefaultNameSystem(),
+		Packages:      Packages,
+		Args:          genericArgs,
+	})
+	if err != nil {
+		t.Fatalf("failed generating: %v", err)
+	}
+	out := files[testdataPackage+"/zz_generated.conversion.go"]
+	if bytes.Contains(out, []byte("out.c = in.c")) {
+		t.Errorf("unexported member c is converted:\n%s", out)
+	}
+	if !bytes.Contains(out, []byte("// WARNING: in.c requires manual conversion: unexported")) {
+		t.Errorf("expected a warning for the unexported member c, got:\n%s", out)
+	}
+	if bytes.Contains(out, []byte("func Convert_cva_U_To_cvb_U(")) {
+		t.Errorf("expected no Convert_ function for U, got:\n%s", out)
+	}
+}
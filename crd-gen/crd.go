@@ -0,0 +1,618 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crd_gen
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/namer"
+	"github.com/lack-io/gogogen/gogenerator/types"
+	"github.com/lack-io/gogogen/util/log"
+	"github.com/lack-io/gogogen/util/sets"
+)
+
+// These are the comment tags that carry parameters for CRD generation.
+const (
+	// On types, to request a CRD, and as the prefix of its parameters, as in
+	// +gogogen:crd:group=example.com,scope=Cluster.
+	tagName = "gogogen:crd"
+	// On types, with a column of kubectl get, as in
+	// +gogogen:crd:printcolumn:name=Replicas,type=integer,jsonPath=.spec.replicas
+	printColumnTagName = tagName + ":printcolumn"
+
+	// On fields, with the rules of validate-gen, which become validations
+	// of the schema.
+	rulesTagName = "validate"
+	// +optional marks a field which may be left out, even if it isn't
+	// omitempty.
+	tagOptional = "optional"
+	// +default=<value> gives the default of a field, as JSON. Values which
+	// are not valid JSON are taken as strings.
+	tagDefault = "default"
+)
+
+// The parameters of a CRD.
+const (
+	paramGroup      = "group"
+	paramVersion    = "version"
+	paramKind       = "kind"
+	paramPlural     = "plural"
+	paramSingular   = "singular"
+	paramShortNames = "shortNames"
+	paramScope      = "scope"
+)
+
+// The scopes of a resource.
+const (
+	scopeNamespaced = "Namespaced"
+	scopeCluster    = "Cluster"
+)
+
+// The parameters of a printer column.
+const (
+	paramColumnName        = "name"
+	paramColumnType        = "type"
+	paramColumnJSONPath    = "jsonPath"
+	paramColumnDescription = "description"
+	paramColumnFormat      = "format"
+	paramColumnPriority    = "priority"
+)
+
+// crdFileType is the file type of the manifests.
+const crdFileType = "crd-yaml"
+
+// NameSystems returns the name system used by the generators in this package.
+func NameSystems() namer.NameSystems {
+	return namer.NameSystems{
+		"public": namer.NewPublicNamer(0),
+		"raw":    namer.NewRawNamer("", nil),
+	}
+}
+
+// DefaultNameSystem returns the default name system for ordering the types to
+// be processed by the generators in this package.
+func DefaultNameSystem() string {
+	return "public"
+}
+
+// The model of the CustomResourceDefinition manifests, limited to what is
+// generated.
+
+type crd struct {
+	APIVersion string   `json:"apiVersion"`
+	Kind       string   `json:"kind"`
+	Metadata   metadata `json:"metadata"`
+	Spec       crdSpec  `json:"spec"`
+}
+
+type metadata struct {
+	Name string `json:"name"`
+}
+
+type crdSpec struct {
+	Group    string       `json:"group"`
+	Names    crdNames     `json:"names"`
+	Scope    string       `json:"scope"`
+	Versions []crdVersion `json:"versions"`
+}
+
+type crdNames struct {
+	Kind       string   `json:"kind"`
+	ListKind   string   `json:"listKind"`
+	Plural     string   `json:"plural"`
+	Singular   string   `json:"singular"`
+	ShortNames []string `json:"shortNames,omitempty"`
+}
+
+type crdVersion struct {
+	Name                     string        `json:"name"`
+	Served                   bool          `json:"served"`
+	Storage                  bool          `json:"storage"`
+	Schema                   crdSchema     `json:"schema"`
+	Subresources             *subresources `json:"subresources,omitempty"`
+	AdditionalPrinterColumns []printColumn `json:"additionalPrinterColumns,omitempty"`
+}
+
+type crdSchema struct {
+	OpenAPIV3Schema *schema `json:"openAPIV3Schema"`
+}
+
+type subresources struct {
+	Status *struct{} `json:"status,omitempty"`
+}
+
+type printColumn struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	JSONPath    string `json:"jsonPath"`
+	Description string `json:"description,omitempty"`
+	Format      string `json:"format,omitempty"`
+	Priority    int    `json:"priority,omitempty"`
+}
+
+// schema is a structural OpenAPI v3 schema: every node has a type, and
+// nothing is referred to.
+type schema struct {
+	Description          string             `json:"description,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *schema            `json:"items,omitempty"`
+	AdditionalProperties *schema            `json:"additionalProperties,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Default              interface{}        `json:"default,omitempty"`
+	Minimum              *json.Number       `json:"minimum,omitempty"`
+	Maximum              *json.Number       `json:"maximum,omitempty"`
+	MinLength            *int64             `json:"minLength,omitempty"`
+	MaxLength            *int64             `json:"maxLength,omitempty"`
+	MinItems             *int64             `json:"minItems,omitempty"`
+	MaxItems             *int64             `json:"maxItems,omitempty"`
+	MinProperties        *int64             `json:"minProperties,omitempty"`
+	MaxProperties        *int64             `json:"maxProperties,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	PreserveUnknown      bool               `json:"x-kubernetes-preserve-unknown-fields,omitempty"`
+}
+
+// newCRD returns the CRD of 't', or nil if it requests none.
+func newCRD(pkg *types.Package, t *types.Type) *crd {
+	comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
+	values := types.ExtractCommentTags("+", comments)[tagName]
+	if len(values) == 0 {
+		return nil
+	}
+	if len(values) > 1 || (values[0] != "" && values[0] != "true" && values[0] != "false") {
+		log.Fatalf("Type %v: unsupported %s values: %q", t, tagName, values)
+	}
+	if values[0] == "false" {
+		return nil
+	}
+	if t.Kind != types.Struct {
+		log.Fatalf("Type %v: CRDs are only generated for structs", t)
+	}
+
+	c := &crd{
+		APIVersion: "apiextensions.k8s.io/v1",
+		Kind:       "CustomResourceDefinition",
+		Spec: crdSpec{
+			Names: crdNames{
+				Kind:     t.Name.Name,
+				Plural:   namer.NewAllLowercasePluralNamer(nil).Name(t),
+				Singular: strings.ToLower(t.Name.Name),
+			},
+			Scope: scopeNamespaced,
+		},
+	}
+	version := crdVersion{Name: pkg.Name, Served: true, Storage: true}
+
+	// The lines of the printer columns carry parameters of their own.
+	var lines []string
+	for _, line := range comments {
+		line = strings.Trim(line, " ")
+		if strings.HasPrefix(line, "+"+printColumnTagName+":") {
+			version.AdditionalPrinterColumns = append(version.AdditionalPrinterColumns, parsePrintColumn(t, line))
+			continue
+		}
+		lines = append(lines, line)
+	}
+	params, err := types.ExtractCommentTagParams("+", tagName, lines)
+	if err != nil {
+		log.Fatalf("Type %v: %v", t, err)
+	}
+	for _, p := range params {
+		switch p.Key {
+		case paramGroup:
+			c.Spec.Group = p.Value
+		case paramVersion:
+			version.Name = p.Value
+		case paramKind:
+			c.Spec.Names.Kind = p.Value
+		case paramPlural:
+			c.Spec.Names.Plural = p.Value
+		case paramSingular:
+			c.Spec.Names.Singular = p.Value
+		case paramShortNames:
+			c.Spec.Names.ShortNames = strings.Split(p.Value, "|")
+		case paramScope:
+			if p.Value != scopeNamespaced && p.Value != scopeCluster {
+				log.Fatalf("Type %v: unsupported scope %q, must be %s or %s", t, p.Value, scopeNamespaced, scopeCluster)
+			}
+			c.Spec.Scope = p.Value
+		default:
+			log.Fatalf("Type %v: unsupported %s parameter %q", t, tagName, p.Key)
+		}
+	}
+	if len(c.Spec.Group) == 0 {
+		log.Fatalf("Type %v: a CRD needs a group, as in +%s:%s=example.com", t, tagName, paramGroup)
+	}
+	c.Spec.Names.ListKind = c.Spec.Names.Kind + "List"
+	c.Metadata.Name = c.Spec.Names.Plural + "." + c.Spec.Group
+
+	root := (&schemaBuilder{visiting: map[*types.Type]bool{}}).schemaFor(t)
+	root.Description = description(t.CommentLines)
+	// The API server manages these, whatever the type says of them.
+	for name, s := range map[string]*schema{
+		"apiVersion": {Type: "string"},
+		"kind":       {Type: "string"},
+		"metadata":   {Type: "object"},
+	} {
+		if root.Properties == nil {
+			root.Properties = map[string]*schema{}
+		}
+		root.Properties[name] = s
+	}
+	required := []string{}
+	for _, name := range root.Required {
+		if name != "apiVersion" && name != "kind" && name != "metadata" {
+			required = append(required, name)
+		}
+	}
+	root.Required = required
+	if len(required) == 0 {
+		root.Required = nil
+	}
+	version.Schema.OpenAPIV3Schema = root
+	if _, ok := root.Properties["status"]; ok {
+		version.Subresources = &subresources{Status: &struct{}{}}
+	}
+	c.Spec.Versions = []crdVersion{version}
+	return c
+}
+
+// parsePrintColumn returns the printer column of a tag line of 't'.
+func parsePrintColumn(t *types.Type, line string) printColumn {
+	params, err := types.ExtractCommentTagParams("+", printColumnTagName, []string{line})
+	if err != nil {
+		log.Fatalf("Type %v: %v", t, err)
+	}
+	col := printColumn{}
+	for _, p := range params {
+		switch p.Key {
+		case paramColumnName:
+			col.Name = p.Value
+		case paramColumnType:
+			col.Type = p.Value
+		case paramColumnJSONPath:
+			col.JSONPath = p.Value
+		case paramColumnDescription:
+			col.Description = p.Value
+		case paramColumnFormat:
+			col.Format = p.Value
+		case paramColumnPriority:
+			if col.Priority, err = strconv.Atoi(p.Value); err != nil {
+				log.Fatalf("Type %v: invalid printer column priority %q", t, p.Value)
+			}
+		default:
+			log.Fatalf("Type %v: unsupported %s parameter %q", t, printColumnTagName, p.Key)
+		}
+	}
+	if len(col.Name) == 0 || len(col.Type) == 0 || len(col.JSONPath) == 0 {
+		log.Fatalf("Type %v: a printer column needs a %s, a %s and a %s", t, paramColumnName, paramColumnType, paramColumnJSONPath)
+	}
+	return col
+}
+
+// schemaBuilder converts types into structural schemas.
+type schemaBuilder struct {
+	// The named types being converted, as structural schemas can't be
+	// recursive.
+	visiting map[*types.Type]bool
+}
+
+// schemaFor returns the schema for a value of type 't'.
+func (b *schemaBuilder) schemaFor(t *types.Type) *schema {
+	if len(t.Name.Package) > 0 {
+		if b.visiting[t] {
+			log.Fatalf("Type %v: recursive types can't be described by a CRD", t)
+		}
+		b.visiting[t] = true
+		defer delete(b.visiting, t)
+	}
+
+	switch {
+	case t.Name.Package == "time" && t.Name.Name == "Time":
+		return &schema{Type: "string", Format: "date-time"}
+	case t.Methods["MarshalJSON"] != nil:
+		// Nothing is known about what it produces.
+		return &schema{PreserveUnknown: true}
+	case t.Methods["MarshalText"] != nil:
+		return &schema{Type: "string"}
+	}
+
+	switch t.Kind {
+	case types.Builtin:
+		return builtinSchema(t)
+	case types.Alias:
+		s := b.schemaFor(t.Underlying)
+		s.Description = ""
+		return s
+	case types.Pointer:
+		return b.schemaFor(t.Elem)
+	case types.Slice, types.Array:
+		if t.Elem == types.Byte {
+			return &schema{Type: "string", Format: "byte"}
+		}
+		return &schema{Type: "array", Items: b.schemaFor(t.Elem)}
+	case types.Map:
+		return &schema{Type: "object", AdditionalProperties: b.schemaFor(t.Elem)}
+	case types.Struct:
+		s := &schema{Type: "object"}
+		b.addMembers(s, t, map[*types.Type]bool{})
+		return s
+	}
+	// Interfaces, and anything else, may hold any value.
+	return &schema{PreserveUnknown: true}
+}
+
+func builtinSchema(t *types.Type) *schema {
+	switch t {
+	case types.String:
+		return &schema{Type: "string"}
+	case types.Bool:
+		return &schema{Type: "boolean"}
+	case types.Int32, types.Int16, types.Int8, types.Uint16, types.Uint8:
+		return &schema{Type: "integer", Format: "int32"}
+	case types.Float32:
+		return &schema{Type: "number", Format: "float"}
+	case types.Float64:
+		return &schema{Type: "number", Format: "double"}
+	}
+	if types.IsInteger(t) {
+		return &schema{Type: "integer", Format: "int64"}
+	}
+	return &schema{PreserveUnknown: true}
+}
+
+// addMembers adds the members of the struct 't' to the object schema 's',
+// with the members of embedded structs promoted the way encoding/json does.
+func (b *schemaBuilder) addMembers(s *schema, t *types.Type, visited map[*types.Type]bool) {
+	if visited[t] {
+		return
+	}
+	visited[t] = true
+	for _, m := range t.Members {
+		tag := reflect.StructTag(m.Tags).Get("json")
+		if tag == "-" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		name, omitEmpty := parts[0], false
+		for _, opt := range parts[1:] {
+			omitEmpty = omitEmpty || opt == "omitempty"
+		}
+		if m.Embedded && len(name) == 0 {
+			et := m.Type
+			if et.Kind == types.Pointer {
+				et = et.Elem
+			}
+			if et.Kind == types.Struct {
+				b.addMembers(s, et, visited)
+				continue
+			}
+		}
+		if namer.IsPrivateGoName(m.Name) {
+			continue
+		}
+		if len(name) == 0 {
+			name = m.Name
+		}
+		if _, ok := s.Properties[name]; ok {
+			// A shallower member already claimed the name.
+			continue
+		}
+
+		prop := b.schemaFor(m.Type)
+		prop.Description = description(m.CommentLines)
+		memberTags := types.ExtractCommentTags("+", m.CommentLines)
+		if values := memberTags[tagDefault]; len(values) > 0 {
+			var value interface{}
+			if err := json.Unmarshal([]byte(values[0]), &value); err != nil {
+				value = values[0]
+			}
+			prop.Default = value
+		}
+		_, optional := memberTags[tagOptional]
+		required := !optional && !omitEmpty
+		if applyRules(t, m, prop) {
+			required = true
+		}
+		if s.Properties == nil {
+			s.Properties = map[string]*schema{}
+		}
+		s.Properties[name] = prop
+		if required {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// applyRules adds the validate-gen rules of the field 'm' of 't' to its
+// schema, and returns whether it is required by them.
+func applyRules(t *types.Type, m types.Member, s *schema) (required bool) {
+	params, err := m.CommentTags("+").Params(rulesTagName)
+	if err != nil {
+		log.Fatalf("Type %v, field %s: %v", t, m.Name, err)
+	}
+	for _, p := range params {
+		switch p.Key {
+		case "required":
+			required = true
+		case "min", "max":
+			applyBound(t, m, s, p.Key == "min", p.Value)
+		case "pattern":
+			s.Pattern = p.Value
+		case "enum":
+			for _, v := range strings.Split(p.Value, "|") {
+				if s.Type == "string" {
+					s.Enum = append(s.Enum, v)
+				} else {
+					s.Enum = append(s.Enum, json.Number(v))
+				}
+			}
+		default:
+			log.Fatalf("Type %v, field %s: unsupported rule %q", t, m.Name, p.Key)
+		}
+	}
+	return required
+}
+
+// applyBound adds a min or max rule to the schema 's': a bound of the value
+// of numbers, and of the length of anything else.
+func applyBound(t *types.Type, m types.Member, s *schema, min bool, value string) {
+	if s.Type == "integer" || s.Type == "number" {
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			log.Fatalf("Type %v, field %s: invalid bound %q", t, m.Name, value)
+		}
+		n := json.Number(value)
+		if min {
+			s.Minimum = &n
+		} else {
+			s.Maximum = &n
+		}
+		return
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		log.Fatalf("Type %v, field %s: invalid length bound %q", t, m.Name, value)
+	}
+	var bound **int64
+	switch {
+	case s.Type == "string" && min:
+		bound = &s.MinLength
+	case s.Type == "string":
+		bound = &s.MaxLength
+	case s.Type == "array" && min:
+		bound = &s.MinItems
+	case s.Type == "array":
+		bound = &s.MaxItems
+	case s.Type == "object" && min:
+		bound = &s.MinProperties
+	case s.Type == "object":
+		bound = &s.MaxProperties
+	default:
+		log.Fatalf("Type %v, field %s: bounds are not supported for its type", t, m.Name)
+	}
+	*bound = &n
+}
+
+// description returns the comment lines which aren't comment tags.
+func description(lines []string) string {
+	var text []string
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "+") {
+			continue
+		}
+		text = append(text, line)
+	}
+	return strings.TrimSpace(strings.Join(text, "\n"))
+}
+
+func Packages(context *generator.Context, arguments *args.GeneratorArgs) generator.Packages {
+	boilerplate, err := arguments.LoadGoBoilerplate()
+	if err != nil {
+		log.Fatalf("Failed loading boilerplate: %v", err)
+	}
+	context.FileTypes[crdFileType] = generator.DefaultFileType{
+		Format:   formatYAML,
+		Assemble: assembleYAML,
+	}
+
+	packages := generator.Packages{}
+	for i := range sets.NewString(context.Inputs...) {
+		log.Debugf("Considering pkg %q", i)
+		pkg := context.Universe[i]
+		if pkg == nil {
+			// If the input had no Go files, for example.
+			continue
+		}
+
+		crds := map[*types.Type]*crd{}
+		for _, t := range pkg.SortedTypes() {
+			if c := newCRD(pkg, t); c != nil {
+				crds[t] = c
+			}
+		}
+		if len(crds) == 0 {
+			continue
+		}
+
+		log.Infof("Package %q needs generation", i)
+		packages = append(packages,
+			&generator.DefaultPackage{
+				PackageName: strings.Split(filepath.Base(pkg.Path), ".")[0],
+				PackagePath: pkg.Path,
+				HeaderText:  boilerplate,
+				GeneratorFunc: func(c *generator.Context) (generators []generator.Generator) {
+					return []generator.Generator{
+						NewGenCRD(arguments.OutputFileName(pkg, "crd"), pkg.Path, crds),
+					}
+				},
+				FilterFunc: func(c *generator.Context, t *types.Type) bool {
+					return t.Name.Package == pkg.Path
+				},
+			})
+	}
+	return packages
+}
+
+// genCRD produces a file with the CRDs of the types of a package.
+type genCRD struct {
+	generator.DefaultGen
+	targetPackage string
+	crds          map[*types.Type]*crd
+}
+
+func NewGenCRD(sanitizedName, targetPackage string, crds map[*types.Type]*crd) generator.Generator {
+	return &genCRD{
+		DefaultGen: generator.DefaultGen{
+			OptionalName: sanitizedName,
+		},
+		targetPackage: targetPackage,
+		crds:          crds,
+	}
+}
+
+func (g *genCRD) Filename() string {
+	return g.OptionalName + ".yaml"
+}
+
+func (g *genCRD) FileType() string {
+	return crdFileType
+}
+
+func (g *genCRD) Filter(c *generator.Context, t *types.Type) bool {
+	_, ok := g.crds[t]
+	return ok
+}
+
+// GenerateType writes the CRD of 't' as a JSON document, which the file
+// type converts to YAML.
+func (g *genCRD) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	log.Infof("Generating CRD for type %v", t)
+	b, err := json.MarshalIndent(g.crds[t], "", "  ")
+	if err != nil {
+		return fmt.Errorf("type %v: %v", t, err)
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
@@ -0,0 +1,104 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package crd_gen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/lack-io/gogogen/gogenerator/generator"
+)
+
+// assembleYAML converts the header to YAML comments, and each JSON document
+// of the body to a block style YAML document.
+func assembleYAML(w io.Writer, f *generator.File) {
+	w.Write(generator.CommentHeader(f.Header, "#"))
+
+	d := json.NewDecoder(bytes.NewReader(f.Body.Bytes()))
+	d.UseNumber()
+	for {
+		var doc map[string]interface{}
+		if err := d.Decode(&doc); err == io.EOF {
+			return
+		} else if err != nil {
+			// JSON is valid YAML as well.
+			w.Write(f.Body.Bytes())
+			return
+		}
+		fmt.Fprintln(w, "---")
+		writeYAMLMap(w, doc, "")
+	}
+}
+
+func formatYAML(source []byte) ([]byte, error) {
+	return source, nil
+}
+
+var plainYAMLKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// writeYAMLMap writes a map in block style. Empty maps and lists, and
+// scalars, are written as JSON, which YAML accepts.
+func writeYAMLMap(w io.Writer, m map[string]interface{}, indent string) {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		name := key
+		if !plainYAMLKey.MatchString(key) {
+			b, _ := json.Marshal(key)
+			name = string(b)
+		}
+		fmt.Fprintf(w, "%s%s:", indent, name)
+		writeYAMLValue(w, m[key], indent+"  ")
+	}
+}
+
+// writeYAMLValue writes the value of a key, or of a list item, starting on
+// its line.
+func writeYAMLValue(w io.Writer, v interface{}, indent string) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if len(v) > 0 {
+			fmt.Fprintln(w)
+			writeYAMLMap(w, v, indent)
+			return
+		}
+	case []interface{}:
+		if len(v) > 0 {
+			fmt.Fprintln(w)
+			for _, item := range v {
+				fmt.Fprintf(w, "%s-", indent)
+				if m, ok := item.(map[string]interface{}); ok && len(m) > 0 {
+					// The first key goes on the line of the dash.
+					var b bytes.Buffer
+					writeYAMLMap(&b, m, indent+"  ")
+					fmt.Fprint(w, " "+strings.TrimPrefix(b.String(), indent+"  "))
+					continue
+				}
+				writeYAMLValue(w, item, indent+"  ")
+			}
+			return
+		}
+	}
+	b, _ := json.Marshal(v)
+	fmt.Fprintf(w, " %s\n", b)
+}
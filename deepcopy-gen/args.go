@@ -17,8 +17,6 @@ package deepcopy_gen
 import (
 	"fmt"
 
-	ccli "github.com/lack-io/cli"
-
 	"github.com/lack-io/gogogen/gogenerator/args"
 )
 
@@ -31,17 +29,11 @@ func NewDefaults() (*args.GeneratorArgs, *CustomArgs) {
 	return genericArgs, customArgs
 }
 
-// AddFlags add the generator flags to the flag set.
-func (ca *CustomArgs) AddFlags(app *ccli.App) {
-	app.StringSliceVarP(&ca.BoundingDirs, "bounding-dirs", "", ca.BoundingDirs,
-		"Comma-separated list of import path which bound the types for which deep-copies will be generated.", "")
-}
-
 // Validate checks the given arguments.
 func Validate(genericArgs *args.GeneratorArgs) error {
 	_ = genericArgs.CustomArgs.(*CustomArgs)
 
-	if len(genericArgs.InputDirs) == 0 {
+	if len(genericArgs.InputDirs) == 0 && len(genericArgs.InputFiles) == 0 {
 		return fmt.Errorf("intput directories cannot be empty")
 	}
 
@@ -32,16 +32,46 @@ import (
 // CustomArgs is used tby the go2idl framework to pass args specific to this
 // generator.
 type CustomArgs struct {
-	BoundingDirs []string // Only deal with types rooted under these dirs.
+	// Only deal with types rooted under these dirs.
+	BoundingDirs []string `flag:"bounding-dirs" usage:"Comma-separated list of import path which bound the types for which deep-copies will be generated."`
 }
 
 // This is the comment tag carries parameters for deep-copy generation.
 const (
-	tagEnableName              = "gogo:deepcopy-gen"
+	tagEnableName              = "gogogen:deepcopy-gen"
 	interfacesTagName          = tagEnableName + ":interfaces"
 	interfaceNonPointerTagName = tagEnableName + ":nonpointer-interfaces" // attach the DeepCopy<Interface> methods to the
+
+	// legacyTagEnableName is the tag used before the generator was built
+	// in. It is still honored, with the same parameters.
+	legacyTagEnableName = "gogo:deepcopy-gen"
 )
 
+// registerTagSchemas declares the comment tags of the generator, and the
+// legacy ones, which are deprecated.
+func registerTagSchemas(c *generator.Context) {
+	schemas := []generator.TagSchema{
+		{Name: tagEnableName, Value: generator.TagValueString, Scope: generator.TagScopePackage | generator.TagScopeType},
+		{Name: interfacesTagName, Value: generator.TagValueString, Scope: generator.TagScopeType, Repeated: true},
+		{Name: interfaceNonPointerTagName, Value: generator.TagValueBool, Scope: generator.TagScopeType},
+	}
+	c.RegisterTagSchemas(tagEnableName, schemas...)
+	for _, s := range schemas {
+		s.ReplacedBy = s.Name
+		s.Name = legacyTagEnableName + strings.TrimPrefix(s.Name, tagEnableName)
+		s.Deprecated = true
+		c.RegisterTagSchemas(legacyTagEnableName, s)
+	}
+}
+
+// extractTags returns the values of the comment tag 'name', also looking
+// for it under the legacy tag prefix.
+func extractTags(name string, comments []string) []string {
+	tags := types.ExtractCommentTags("+", comments)
+	legacyName := legacyTagEnableName + strings.TrimPrefix(name, tagEnableName)
+	return append(tags[name], tags[legacyName]...)
+}
+
 // Known values for the comment tag.
 const tagValuePackage = "package"
 
@@ -57,7 +87,7 @@ func extractEnableTypeTag(t *types.Type) *enableTagValue {
 }
 
 func extractEnableTag(comments []string) *enableTagValue {
-	tagVals := types.ExtractCommentTags("+", comments)[tagEnableName]
+	tagVals := extractTags(tagEnableName, comments)
 	if tagVals == nil {
 		return nil
 	}
@@ -127,9 +157,15 @@ func Package(context *generator.Context, arguments *args.GeneratorArgs) generato
 		log.Fatalf("Failed loading boilerplate: %v", err)
 	}
 
+	registerTagSchemas(context)
+	// The tags are read before generation, so check them now.
+	if err := context.ValidateTags(); err != nil {
+		log.Fatalf("Invalid comment tags:\n%v", err)
+	}
+
 	inputs := sets.NewString(context.Inputs...)
 	packages := generator.Packages{}
-	header := append([]byte(fmt.Sprintf("// +build !%s\n\n", arguments.GeneratedBuildTag)), boilerplate...)
+	header := append(arguments.GeneratedBuildConstraint(), boilerplate...)
 
 	boundingDirs := []string{}
 	if customArgs, ok := arguments.CustomArgs.(*CustomArgs); ok {
@@ -170,7 +206,7 @@ func Package(context *generator.Context, arguments *args.GeneratorArgs) generato
 		if !pkgNeedsGeneration {
 			// If the pkg-scoped tag did not exists, we can skip scanning types.
 			// explicitly wants generation.
-			for _, t := range pkg.Types {
+			for _, t := range pkg.SortedTypes() {
 				log.Debugf("  considering type %q", t.Name.String())
 				ttag := extractEnableTypeTag(t)
 				if ttag != nil && ttag.value == "true" {
@@ -207,7 +243,7 @@ func Package(context *generator.Context, arguments *args.GeneratorArgs) generato
 					HeaderText:  header,
 					GeneratorFunc: func(c *generator.Context) (generators []generator.Generator) {
 						return []generator.Generator{
-							NewGenDeepCopy(arguments.OutputFileBaseName, pkg.Path, boundingDirs, (ptagValue == tagValuePackage), ptagRegister),
+							NewGenDeepCopy(arguments.OutputFileName(pkg, "deepcopy"), pkg.Path, boundingDirs, (ptagValue == tagValuePackage), ptagRegister),
 						}
 					},
 					FilterFunc: func(c *generator.Context, t *types.Type) bool {
@@ -341,7 +377,7 @@ func deepCopyMethodOrDie(t *types.Type) *types.Signature {
 // or:
 //     func (t *T) DeepCopyInto(t *T)
 func deepCopyIntoMethod(t *types.Type) (*types.Signature, error) {
-	f, found := t.Methods["DeepCopyInfo"]
+	f, found := t.Methods["DeepCopyInto"]
 	if !found {
 		return nil, nil
 	}
@@ -485,7 +521,7 @@ func (g *genDeepCopy) needsGeneration(t *types.Type) bool {
 func extractInterfacesTag(t *types.Type) []string {
 	var result []string
 	comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
-	values := types.ExtractCommentTags("+", comments)[interfacesTagName]
+	values := extractTags(interfacesTagName, comments)
 	for _, v := range values {
 		if len(v) == 0 {
 			continue
@@ -502,7 +538,7 @@ func extractInterfacesTag(t *types.Type) []string {
 }
 func extractNonPointerInterfaces(t *types.Type) (bool, error) {
 	comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
-	values := types.ExtractCommentTags("+", comments)[interfaceNonPointerTagName]
+	values := extractTags(interfaceNonPointerTagName, comments)
 	if len(values) == 0 {
 		return false, nil
 	}
@@ -635,7 +671,7 @@ func (g *genDeepCopy) GenerateType(c *generator.Context, t *types.Type, w io.Wri
 		sw.Do(fmt.Sprintf("// DeepCopy%s is an auto-generated deepcopy function, copying the receiver, creating a new $.type|raw$.\n", intf.Name.Name), argsFromType(t, intf))
 		if nonPointerReceiver {
 			sw.Do(fmt.Sprintf("func (in $.type|raw$) DeepCopy%s() $.type2|raw$ {\n", intf.Name.Name), argsFromType(t, intf))
-			sw.Do("return *out.DeepCopy()", nil)
+			sw.Do("return *in.DeepCopy()\n", nil)
 			sw.Do("}\n\n", nil)
 		} else {
 			sw.Do(fmt.Sprintf("func (in *$.type|raw$) DeepCopy%s() $.type2|raw$ {\n", intf.Name.Name), argsFromType(t, intf))
@@ -731,7 +767,7 @@ func (g *genDeepCopy) doMap(t *types.Type, sw *generator.SnippetWriter) {
 			sw.Do("(*out)[key] = val.DeepCopy()\n", nil)
 		} else if leftPointer {
 			sw.Do("x := val.DeepCopy()\n", nil)
-			sw.Do("(*out)[key] = &x", nil)
+			sw.Do("(*out)[key] = &x\n", nil)
 		} else {
 			sw.Do("(*out)[key] = *val.DeepCopy()\n", nil)
 		}
@@ -744,11 +780,11 @@ func (g *genDeepCopy) doMap(t *types.Type, sw *generator.SnippetWriter) {
 		if uet.Name.Name == "interface{}" {
 			log.Fatalf("DeepCopy of %q is unsupported. Instead, use method interfaces with DeepCopy<named-interface> as one of the methods.", uet.Name.Name)
 		}
-		sw.Do("if val == nil { (*out}[key] = nil } else {\n", nil)
+		sw.Do("if val == nil { (*out)[key] = nil } else {\n", nil)
 		// Note: if t.Elem has been an alias "J" of an interface "I" in Go, we will see it
 		// as kind Interface of name "J" here, i.e. generate val.DeepCopyJ(). The golang
 		// parser does not given us the underlying interfaces name. So we cannot do any better.
-		sw.Do(fmt.Sprintf("(*out)[key] = val.DeepCopy%s()\n", t.Name.Name), nil)
+		sw.Do(fmt.Sprintf("(*out)[key] = val.DeepCopy%s()\n", uet.Name.Name), nil)
 		sw.Do("}\n", nil)
 	case uet.Kind == types.Slice || uet.Kind == types.Map || uet.Kind == types.Pointer:
 		sw.Do("var outVal $.|raw$\n", uet)
@@ -760,7 +796,7 @@ func (g *genDeepCopy) doMap(t *types.Type, sw *generator.SnippetWriter) {
 	case uet.Kind == types.Struct:
 		sw.Do("(*out)[key] = *val.DeepCopy()\n", nil)
 	default:
-		log.Fatalf("Hit an unsupported type %v for %v", uet, nil)
+		log.Fatalf("Hit an unsupported type %v for %v", uet, t)
 	}
 	sw.Do("}\n", nil)
 }
@@ -778,9 +814,9 @@ func (g *genDeepCopy) doSlice(t *types.Type, sw *generator.SnippetWriter) {
 
 	sw.Do("*out = make($.|raw$, len(*in))\n", t)
 	if deepCopyMethodOrDie(ut.Elem) != nil || deepCopyIntoMethodOrDie(ut.Elem) != nil {
-		sw.Do("for i := range *in\n", nil)
+		sw.Do("for i := range *in {\n", nil)
 		// Note: a DeepCopyInto exists because it is added if DeepCopy is manually defined
-		sw.Do("(*in)[i].DeepCopyInfo(&(*out)[i])\n", nil)
+		sw.Do("(*in)[i].DeepCopyInto(&(*out)[i])\n", nil)
 		sw.Do("}\n", nil)
 	} else if uet.Kind == types.Builtin || uet.IsAssignable() {
 		sw.Do("copy(*out, *in)\n", nil)
@@ -788,7 +824,7 @@ func (g *genDeepCopy) doSlice(t *types.Type, sw *generator.SnippetWriter) {
 		sw.Do("for i := range *in {\n", nil)
 		if uet.Kind == types.Slice || uet.Kind == types.Map || uet.Kind == types.Pointer || deepCopyMethodOrDie(ut.Elem) != nil || deepCopyIntoMethodOrDie(ut.Elem) != nil {
 			sw.Do("if (*in)[i] != nil {\n", nil)
-			sw.Do("in, out := &(*out)[i], &(*out)[i]\n", nil)
+			sw.Do("in, out := &(*in)[i], &(*out)[i]\n", nil)
 			g.generateFor(ut.Elem, sw)
 			sw.Do("}\n", nil)
 		} else if uet.Kind == types.Interface {
@@ -800,12 +836,12 @@ func (g *genDeepCopy) doSlice(t *types.Type, sw *generator.SnippetWriter) {
 			// Note: if t.Elem has been an alias "J" of an interface "I" in Go, we will see it
 			// as kind Interface of name "J" here, i.e. generate val.DeepCopyJ(). The golang
 			// parser does not give us underlying interface name. So we cannot do any better.
-			sw.Do(fmt.Sprintf("(*out)[i] = (*in)[i].DeepCopy%s()", uet.Name.Name), nil)
+			sw.Do(fmt.Sprintf("(*out)[i] = (*in)[i].DeepCopy%s()\n", uet.Name.Name), nil)
 			sw.Do("}\n", nil)
 		} else if uet.Kind == types.Struct {
-			sw.Do("(*in)[i].DeepCopyInto(*out)[i])\n", nil)
+			sw.Do("(*in)[i].DeepCopyInto(&(*out)[i])\n", nil)
 		} else {
-			log.Fatalf("Hit an unsupported type %v for %v", nil)
+			log.Fatalf("Hit an unsupported type %v for %v", uet, t)
 		}
 		sw.Do("}\n", nil)
 	}
@@ -846,8 +882,8 @@ func (g *genDeepCopy) doStruct(t *types.Type, sw *generator.SnippetWriter) {
 			if leftPointer == rightPointer {
 				sw.Do("out.$.name$ = in.$.name$.DeepCopy()\n", args)
 			} else if leftPointer {
-				sw.Do("x := in.$.name$.DeepCopy()\n", nil)
-				sw.Do("out.$.name$ = &x\n", nil)
+				sw.Do("x := in.$.name$.DeepCopy()\n", args)
+				sw.Do("out.$.name$ = &x\n", args)
 			} else {
 				sw.Do("in.$.name$.DeepCopyInto(&out.$.name$)\n", args)
 			}
@@ -870,7 +906,7 @@ func (g *genDeepCopy) doStruct(t *types.Type, sw *generator.SnippetWriter) {
 			if uft.Name.Name == "interface{}" {
 				log.Fatalf("DeepCopy of %q unsupported. Instead, use named interfaces with DeepCopy<named-interface> as one of the methods", uft.Name.Name)
 			}
-			sw.Do("if in.$.name$ != nil {\n", nil)
+			sw.Do("if in.$.name$ != nil {\n", args)
 			// Note: if t.Elem has been an alias "J" of an interface "I" in Go, we will see it
 			// as kind Interface of name "J" here, i.e. generate val.DeepCopyJ(). The golang
 			// parser does not give us the underlying interface name. So we cannot do any better.
@@ -903,7 +939,7 @@ func (g *genDeepCopy) doPointer(t *types.Type, sw *generator.SnippetWriter) {
 		}
 	case uet.IsAssignable():
 		sw.Do("*out = new($.Elem|raw$)\n", ut)
-		sw.Do("**out = **in", nil)
+		sw.Do("**out = **in\n", nil)
 	case uet.Kind == types.Map, uet.Kind == types.Slice, uet.Kind == types.Pointer:
 		sw.Do("*out = new($.Elem|raw$)\n", ut)
 		sw.Do("if **in != nil {\n", nil)
@@ -0,0 +1,420 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package defaulter_gen
+
+import (
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/namer"
+	"github.com/lack-io/gogogen/gogenerator/types"
+	"github.com/lack-io/gogogen/util/log"
+	"github.com/lack-io/gogogen/util/sets"
+)
+
+// These are the comment tags that carry parameters for defaulter generation.
+const (
+	tagName      = "gogogen:defaulter-gen"
+	inputTagName = "gogogen:defaulter-gen-input"
+)
+
+const (
+	// tagValuePackage, on a package, asks for defaulters for every struct
+	// type in it. Any other package value names a member, and asks for
+	// defaulters for every struct type which has it.
+	tagValuePackage = "package"
+
+	setDefaultsPrefix       = "SetDefaults_"
+	setObjectDefaultsPrefix = "SetObjectDefaults_"
+)
+
+func extractTag(comments []string) []string {
+	return types.ExtractCommentTags("+", comments)[tagName]
+}
+
+func extractInputTag(comments []string) []string {
+	return types.ExtractCommentTags("+", comments)[inputTagName]
+}
+
+func extractTypeTag(t *types.Type) string {
+	comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
+	values := extractTag(comments)
+	if len(values) == 0 {
+		return ""
+	}
+	if len(values) > 1 {
+		log.Fatalf("Type %v: found %d %s tags: %q", t, len(values), tagName, values)
+	}
+	if values[0] != "true" && values[0] != "false" {
+		log.Fatalf("Type %v: unsupported %s value: %q", t, tagName, values[0])
+	}
+	return values[0]
+}
+
+// NameSystems returns the name system used by the generators in this package.
+func NameSystems() namer.NameSystems {
+	return namer.NameSystems{
+		"public": namer.NewPublicNamer(1),
+		"raw":    namer.NewRawNamer("", nil),
+	}
+}
+
+// DefaultNameSystem returns the default name system for ordering the types to
+// be processed by the generators in this package.
+func DefaultNameSystem() string {
+	return "public"
+}
+
+// defaulterFuncs maps a type to the function which sets its defaults.
+type defaulterFuncs map[types.Name]*types.Type
+
+// collectDefaulters adds every function of 'pkg' which has the signature
+//     func SetDefaults_<Name>(*T)
+// to 'funcs', indexed by T.
+func collectDefaulters(pkg *types.Package, funcs defaulterFuncs) {
+	for _, f := range pkg.SortedFunctions() {
+		name := f.Name.Name
+		if !strings.HasPrefix(name, setDefaultsPrefix) {
+			continue
+		}
+		if f.Underlying == nil || f.Underlying.Signature == nil {
+			continue
+		}
+		sig := f.Underlying.Signature
+		if len(sig.Parameters) != 1 || len(sig.Results) != 0 || sig.Parameters[0].Kind != types.Pointer {
+			log.Warnf("Function %v: ignoring defaulter, expected a single pointer parameter and no results", f)
+			continue
+		}
+		funcs[sig.Parameters[0].Elem.Name] = f
+	}
+}
+
+func Packages(context *generator.Context, arguments *args.GeneratorArgs) generator.Packages {
+	boilerplate, err := arguments.LoadGoBoilerplate()
+	if err != nil {
+		log.Fatalf("Failed loading boilerplate: %v", err)
+	}
+
+	packages := generator.Packages{}
+	header := append(arguments.GeneratedBuildConstraint(), boilerplate...)
+
+	peerDirs := []string{}
+	if customArgs, ok := arguments.CustomArgs.(*CustomArgs); ok {
+		peerDirs = customArgs.ExtraPeerDirs
+	}
+
+	for i := range sets.NewString(context.Inputs...) {
+		log.Debugf("Considering pkg %q", i)
+		pkg := context.Universe[i]
+		if pkg == nil {
+			// If the input had no Go files, for example.
+			continue
+		}
+
+		ptagValue := ""
+		if values := extractTag(pkg.Comments); len(values) > 0 {
+			if len(values) > 1 {
+				log.Fatalf("Package %v: found %d %s tags: %q", i, len(values), tagName, values)
+			}
+			ptagValue = values[0]
+		}
+
+		funcs := defaulterFuncs{}
+		for _, dir := range append(append([]string{}, peerDirs...), extractInputTag(pkg.Comments)...) {
+			peer, err := context.AddDirectory(dir)
+			if err != nil {
+				log.Fatalf("Package %v: failed to load defaulter input %q: %v", i, dir, err)
+			}
+			collectDefaulters(peer, funcs)
+		}
+		collectDefaulters(pkg, funcs)
+
+		b := &callTreeBuilder{
+			universe:   context.Universe,
+			pkgPath:    pkg.Path,
+			defaulters: funcs,
+			building:   map[*types.Type]bool{},
+		}
+		trees := map[*types.Type]*callNode{}
+		for _, t := range pkg.SortedTypes() {
+			if t.Kind != types.Struct || !wantsDefaulter(t, ptagValue) {
+				continue
+			}
+			if tree := b.build(t, true); tree != nil {
+				trees[t] = tree
+			}
+		}
+		if len(trees) == 0 {
+			continue
+		}
+
+		log.Infof("Package %q needs generation", i)
+		packages = append(packages,
+			&generator.DefaultPackage{
+				PackageName: strings.Split(filepath.Base(pkg.Path), ".")[0],
+				PackagePath: pkg.Path,
+				HeaderText:  header,
+				GeneratorFunc: func(c *generator.Context) (generators []generator.Generator) {
+					return []generator.Generator{
+						NewGenDefaulter(arguments.OutputFileName(pkg, "defaulter"), pkg.Path, trees),
+					}
+				},
+				FilterFunc: func(c *generator.Context, t *types.Type) bool {
+					return t.Name.Package == pkg.Path
+				},
+			})
+	}
+	return packages
+}
+
+// wantsDefaulter returns true if a SetObjectDefaults_ function is requested
+// for 't', either by its own tag or by the tag of its package.
+func wantsDefaulter(t *types.Type, ptagValue string) bool {
+	switch extractTypeTag(t) {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	switch ptagValue {
+	case "":
+		return false
+	case tagValuePackage:
+		return true
+	}
+	for _, m := range t.Members {
+		if m.Name == ptagValue {
+			return true
+		}
+	}
+	return false
+}
+
+// callNode is a tree of the defaulter calls needed for a value and the values
+// nested in it. Only one of field, elem, index or key is set, describing how
+// the value is reached from its parent.
+type callNode struct {
+	field string
+	elem  bool
+	index bool
+	key   bool
+
+	call     []*types.Type
+	children []*callNode
+}
+
+type callTreeBuilder struct {
+	universe   types.Universe
+	pkgPath    string
+	defaulters defaulterFuncs
+	// building holds the types currently being walked, so that recursive
+	// types terminate.
+	building map[*types.Type]bool
+}
+
+// build returns the calls needed to default a value of type 't', or nil if
+// there are none.
+func (b *callTreeBuilder) build(t *types.Type, root bool) *callNode {
+	if b.building[t] {
+		return nil
+	}
+	b.building[t] = true
+	defer delete(b.building, t)
+
+	node := &callNode{}
+	if !root && t.Name.Package != "" && t.Name.Package != b.pkgPath {
+		// Types of other packages which already have generated defaulters
+		// are defaulted by those.
+		if pkg := b.universe[t.Name.Package]; pkg != nil {
+			if f, ok := pkg.Functions[setObjectDefaultsPrefix+t.Name.Name]; ok {
+				node.call = append(node.call, f)
+				return node
+			}
+		}
+	}
+	if f, ok := b.defaulters[t.Name]; ok {
+		node.call = append(node.call, f)
+	}
+
+	switch t.Kind {
+	case types.Alias:
+		if under := b.build(t.Underlying, false); under != nil {
+			node.call = append(node.call, under.call...)
+			node.children = append(node.children, under.children...)
+		}
+	case types.Pointer:
+		if child := b.build(t.Elem, false); child != nil {
+			child.elem = true
+			node.children = append(node.children, child)
+		}
+	case types.Slice, types.Array:
+		if child := b.build(t.Elem, false); child != nil {
+			child.index = true
+			node.children = append(node.children, child)
+		}
+	case types.Map:
+		if child := b.build(t.Elem, false); child != nil {
+			child.key = true
+			node.children = append(node.children, child)
+		}
+	case types.Struct:
+		for _, m := range t.Members {
+			if child := b.build(m.Type, false); child != nil {
+				child.field = m.Name
+				node.children = append(node.children, child)
+			}
+		}
+	}
+
+	if len(node.call) == 0 && len(node.children) == 0 {
+		return nil
+	}
+	return node
+}
+
+// genDefaulter produces a file with auto-generated defaulting functions.
+type genDefaulter struct {
+	generator.DefaultGen
+	targetPackage string
+	imports       namer.ImportTracker
+	trees         map[*types.Type]*callNode
+}
+
+func NewGenDefaulter(sanitizedName, targetPackage string, trees map[*types.Type]*callNode) generator.Generator {
+	return &genDefaulter{
+		DefaultGen: generator.DefaultGen{
+			OptionalName: sanitizedName,
+		},
+		targetPackage: targetPackage,
+		imports:       generator.NewImportTracker(),
+		trees:         trees,
+	}
+}
+
+func (g *genDefaulter) Namers(c *generator.Context) namer.NameSystems {
+	// Have the raw namer for this file track what it imports.
+	return namer.NameSystems{
+		"raw": namer.NewRawNamer(g.targetPackage, g.imports),
+	}
+}
+
+func (g *genDefaulter) Filter(c *generator.Context, t *types.Type) bool {
+	_, ok := g.trees[t]
+	return ok
+}
+
+func (g *genDefaulter) isOtherPackage(pkg string) bool {
+	if pkg == g.targetPackage {
+		return false
+	}
+	if strings.HasSuffix(pkg, "\""+g.targetPackage+"\"") {
+		return false
+	}
+	return true
+}
+
+func (g *genDefaulter) Imports(c *generator.Context) (imports []string) {
+	importLines := []string{}
+	for _, singleImport := range g.imports.ImportLines() {
+		if g.isOtherPackage(singleImport) {
+			importLines = append(importLines, singleImport)
+		}
+	}
+	return importLines
+}
+
+func (g *genDefaulter) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	log.Infof("Generating defaulter for type %v", t)
+
+	sw := generator.NewSnippetWriter(w, c, "$", "$")
+	args := generator.Args{
+		"type": t,
+		"name": setObjectDefaultsPrefix + t.Name.Name,
+	}
+	sw.Do("// $.name$ is an auto-generated function, setting the defaults of a $.type|raw$\n", args)
+	sw.Do("// and of all values nested in it. in must be non-nil.\n", nil)
+	sw.Do("func $.name$(in *$.type|raw$) {\n", args)
+	g.writeNode(sw, g.trees[t], "*in", 0)
+	sw.Do("}\n\n", nil)
+	return sw.Error()
+}
+
+// writeNode emits the calls of 'n' for the addressable value 'expr'. Loops
+// nested 'depth' deep use distinct variable names.
+func (g *genDefaulter) writeNode(sw *generator.SnippetWriter, n *callNode, expr string, depth int) {
+	for _, f := range n.call {
+		sw.Do("$.|raw$("+addrOf(expr)+")\n", f)
+	}
+
+	suffix := ""
+	if depth > 0 {
+		suffix = strconv.Itoa(depth)
+	}
+	for _, child := range n.children {
+		switch {
+		case child.field != "":
+			g.writeNode(sw, child, memberOf(expr, child.field), depth)
+		case child.elem:
+			sw.Do("if "+expr+" != nil {\n", nil)
+			g.writeNode(sw, child, "*"+paren(expr), depth)
+			sw.Do("}\n", nil)
+		case child.index:
+			i, a := "i"+suffix, "a"+suffix
+			sw.Do("for "+i+" := range "+expr+" {\n", nil)
+			sw.Do(a+" := &"+paren(expr)+"["+i+"]\n", nil)
+			g.writeNode(sw, child, "*"+a, depth+1)
+			sw.Do("}\n", nil)
+		case child.key:
+			// Map values are not addressable, so default a copy and store
+			// it back.
+			k, v := "k"+suffix, "v"+suffix
+			sw.Do("for "+k+", "+v+" := range "+expr+" {\n", nil)
+			g.writeNode(sw, child, v, depth+1)
+			sw.Do(paren(expr)+"["+k+"] = "+v+"\n", nil)
+			sw.Do("}\n", nil)
+		}
+	}
+}
+
+// addrOf returns an expression for the address of 'expr'.
+func addrOf(expr string) string {
+	if strings.HasPrefix(expr, "*(") && strings.HasSuffix(expr, ")") {
+		return expr[2 : len(expr)-1]
+	}
+	if strings.HasPrefix(expr, "*") {
+		return expr[1:]
+	}
+	return "&" + expr
+}
+
+// memberOf returns an expression selecting 'field' of 'expr', relying on Go
+// to dereference pointers to structs.
+func memberOf(expr, field string) string {
+	if strings.HasPrefix(expr, "*") {
+		return expr[1:] + "." + field
+	}
+	return expr + "." + field
+}
+
+func paren(expr string) string {
+	if strings.HasPrefix(expr, "*") {
+		return "(" + expr + ")"
+	}
+	return expr
+}
@@ -0,0 +1,463 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docs_gen
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/namer"
+	"github.com/lack-io/gogogen/gogenerator/types"
+	"github.com/lack-io/gogogen/util/log"
+	"github.com/lack-io/gogogen/util/sets"
+)
+
+// This is the comment tag that opts packages and types out of the reference.
+const tagName = "gogogen:docs-gen"
+
+// The file types of the reference pages.
+const (
+	markdownFileType = "docs-markdown"
+	htmlFileType     = "docs-html"
+)
+
+// NameSystems returns the name system used by the generators in this package.
+func NameSystems() namer.NameSystems {
+	return namer.NameSystems{
+		"public": namer.NewPublicNamer(0),
+		"raw":    namer.NewRawNamer("", nil),
+	}
+}
+
+// DefaultNameSystem returns the default name system for ordering the types to
+// be processed by the generators in this package.
+func DefaultNameSystem() string {
+	return "public"
+}
+
+// optedOut returns true if 'comments' hold +gogogen:docs-gen=false.
+func optedOut(comments []string, where string) bool {
+	values := types.ExtractCommentTags("+", comments)[tagName]
+	if len(values) == 0 {
+		return false
+	}
+	if len(values) > 1 || values[0] != "false" {
+		log.Fatalf("%s: unsupported %s values: %q", where, tagName, values)
+	}
+	return true
+}
+
+// documented returns the types of 'pkg' the reference describes.
+func documented(pkg *types.Package) map[*types.Type]bool {
+	docs := map[*types.Type]bool{}
+	if optedOut(pkg.Comments, "Package "+pkg.Path) {
+		return docs
+	}
+	for _, t := range pkg.SortedTypes() {
+		if namer.IsPrivateGoName(t.Name.Name) {
+			continue
+		}
+		comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
+		if optedOut(comments, "Type "+t.String()) {
+			continue
+		}
+		docs[t] = true
+	}
+	return docs
+}
+
+func Packages(context *generator.Context, arguments *args.GeneratorArgs) generator.Packages {
+	boilerplate, err := arguments.LoadGoBoilerplate()
+	if err != nil {
+		log.Fatalf("Failed loading boilerplate: %v", err)
+	}
+	format := arguments.CustomArgs.(*CustomArgs).Format
+
+	context.FileTypes[markdownFileType] = generator.DefaultFileType{
+		Format:   formatPage,
+		Assemble: assemblePage,
+	}
+	context.FileTypes[htmlFileType] = generator.DefaultFileType{
+		Format:   formatPage,
+		Assemble: assemblePage,
+	}
+
+	// Every page may link to the types of the others.
+	docs := map[*types.Type]bool{}
+	pkgs := []*types.Package{}
+	for i := range sets.NewString(context.Inputs...) {
+		log.Debugf("Considering pkg %q", i)
+		pkg := context.Universe[i]
+		if pkg == nil {
+			// If the input had no Go files, for example.
+			continue
+		}
+		pkgDocs := documented(pkg)
+		if len(pkgDocs) == 0 {
+			continue
+		}
+		for t := range pkgDocs {
+			docs[t] = true
+		}
+		pkgs = append(pkgs, pkg)
+	}
+
+	packages := generator.Packages{}
+	for i := range pkgs {
+		pkg := pkgs[i]
+		log.Infof("Package %q needs generation", pkg.Path)
+		packages = append(packages,
+			&generator.DefaultPackage{
+				PackageName: strings.Split(filepath.Base(pkg.Path), ".")[0],
+				PackagePath: pkg.Path,
+				HeaderText:  boilerplate,
+				GeneratorFunc: func(c *generator.Context) (generators []generator.Generator) {
+					return []generator.Generator{
+						NewGenDocs(arguments.OutputFileName(pkg, "docs"), pkg, format, docs),
+					}
+				},
+				FilterFunc: func(c *generator.Context, t *types.Type) bool {
+					return t.Name.Package == pkg.Path
+				},
+			})
+	}
+	return packages
+}
+
+// genDocs produces the reference page of a package.
+type genDocs struct {
+	generator.DefaultGen
+	pkg    *types.Package
+	format string
+	// The types of every package documented, which pages link to.
+	docs map[*types.Type]bool
+	page page
+}
+
+func NewGenDocs(sanitizedName string, pkg *types.Package, format string, docs map[*types.Type]bool) generator.Generator {
+	g := &genDocs{
+		DefaultGen: generator.DefaultGen{
+			OptionalName: sanitizedName,
+		},
+		pkg:    pkg,
+		format: format,
+		docs:   docs,
+	}
+	if format == FormatHTML {
+		g.page = htmlPage{}
+	} else {
+		g.page = markdownPage{}
+	}
+	return g
+}
+
+func (g *genDocs) Filename() string {
+	return g.OptionalName + g.page.extension()
+}
+
+func (g *genDocs) FileType() string {
+	if g.format == FormatHTML {
+		return htmlFileType
+	}
+	return markdownFileType
+}
+
+func (g *genDocs) Filter(c *generator.Context, t *types.Type) bool {
+	return t.Name.Package == g.pkg.Path && g.docs[t]
+}
+
+func (g *genDocs) Init(c *generator.Context, w io.Writer) error {
+	names := []string{}
+	for _, t := range g.pkg.SortedTypes() {
+		if g.docs[t] {
+			names = append(names, t.Name.Name)
+		}
+	}
+	sort.Strings(names)
+	index := []string{}
+	for _, name := range names {
+		index = append(index, g.page.link(name, "#"+anchor(name)))
+	}
+	g.page.packageHeader(w, g.pkg.Name, g.pkg.Path, paragraphs(g.pkg.DocComments), index)
+	return nil
+}
+
+func (g *genDocs) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	log.Infof("Documenting type %v", t)
+
+	s := typeSection{
+		Name:       t.Name.Name,
+		Paragraphs: paragraphs(t.CommentLines),
+	}
+	switch t.Kind {
+	case types.Struct:
+		for _, m := range t.Members {
+			if f, ok := g.field(m); ok {
+				s.Fields = append(s.Fields, f)
+			}
+		}
+	case types.Interface:
+		names := []string{}
+		for name := range t.Methods {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if namer.IsPrivateGoName(name) {
+				continue
+			}
+			s.Methods = append(s.Methods, item{Name: name, Description: oneLine(t.Methods[name].CommentLines)})
+		}
+	default:
+		if t.Underlying != nil {
+			s.Underlying = g.typeRef(t.Underlying)
+		}
+		names := []string{}
+		for name, ct := range g.pkg.Constants {
+			if ct.Underlying == t && !namer.IsPrivateGoName(name) {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			ct := g.pkg.Constants[name]
+			value := ""
+			if ct.ConstValue != nil {
+				value = *ct.ConstValue
+				if t.Underlying == types.String {
+					value = strconv.Quote(value)
+				}
+			}
+			s.Values = append(s.Values, item{Name: name, Value: value, Description: oneLine(ct.CommentLines)})
+		}
+	}
+	g.page.typeSection(w, s)
+	return nil
+}
+
+// field returns the row of the member 'm' in the field table, or false if
+// it is not encoded.
+func (g *genDocs) field(m types.Member) (field, bool) {
+	tag := reflect.StructTag(m.Tags).Get("json")
+	name := strings.Split(tag, ",")[0]
+	if tag == "-" || (namer.IsPrivateGoName(m.Name) && !m.Embedded) {
+		return field{}, false
+	}
+	f := field{Name: m.Name, JSONName: name, Type: g.typeRef(m.Type), Description: oneLine(m.CommentLines)}
+	if m.Embedded && len(name) == 0 {
+		f.Inline = true
+	} else if len(name) == 0 {
+		f.JSONName = m.Name
+	}
+	return f, true
+}
+
+// typeRef returns how a type is written on the page, linking to the
+// documented named types in it.
+func (g *genDocs) typeRef(t *types.Type) string {
+	var segments []segment
+	g.appendSegments(&segments, t)
+	b := strings.Builder{}
+	text := ""
+	flush := func() {
+		if len(text) > 0 {
+			b.WriteString(g.page.code(text))
+			text = ""
+		}
+	}
+	for _, s := range segments {
+		if len(s.href) == 0 {
+			text += s.text
+			continue
+		}
+		flush()
+		b.WriteString(g.page.link(g.page.code(s.text), s.href))
+	}
+	flush()
+	return b.String()
+}
+
+// segment is a part of a type reference, linking to 'href' if it is set.
+type segment struct {
+	text string
+	href string
+}
+
+func (g *genDocs) appendSegments(segments *[]segment, t *types.Type) {
+	add := func(text string) {
+		*segments = append(*segments, segment{text: text})
+	}
+	switch t.Kind {
+	case types.Pointer:
+		add("*")
+		g.appendSegments(segments, t.Elem)
+		return
+	case types.Slice:
+		add("[]")
+		g.appendSegments(segments, t.Elem)
+		return
+	case types.Array:
+		add("[...]")
+		g.appendSegments(segments, t.Elem)
+		return
+	case types.Map:
+		add("map[")
+		g.appendSegments(segments, t.Key)
+		add("]")
+		g.appendSegments(segments, t.Elem)
+		return
+	case types.Chan:
+		add("chan ")
+		g.appendSegments(segments, t.Elem)
+		return
+	}
+	if len(t.Name.Package) == 0 {
+		switch t.Kind {
+		case types.Struct:
+			add("struct{...}")
+		case types.Interface:
+			if len(t.Methods) == 0 {
+				add("interface{}")
+			} else {
+				add("interface{...}")
+			}
+		case types.Func:
+			add("func(...)")
+		default:
+			add(t.Name.Name)
+		}
+		return
+	}
+
+	name := t.Name.Name
+	if t.Name.Package != g.pkg.Path {
+		name = path.Base(t.Name.Package) + "." + name
+	}
+	if !g.docs[t] {
+		add(name)
+		return
+	}
+	href := "#" + anchor(t.Name.Name)
+	if t.Name.Package != g.pkg.Path {
+		rel, err := filepath.Rel(filepath.FromSlash(g.pkg.Path), filepath.FromSlash(t.Name.Package))
+		if err != nil {
+			log.Fatalf("Type %v: %v", t, err)
+		}
+		href = filepath.ToSlash(rel) + "/" + g.Filename() + href
+	}
+	*segments = append(*segments, segment{text: name, href: href})
+}
+
+// anchor returns the fragment identifying the section of a type.
+func anchor(name string) string {
+	return strings.ToLower(name)
+}
+
+// paragraphs splits comment lines into paragraphs, leaving out comment tags.
+func paragraphs(lines []string) []string {
+	var paras []string
+	var current []string
+	flush := func() {
+		if len(current) > 0 {
+			paras = append(paras, strings.Join(current, "\n"))
+			current = nil
+		}
+	}
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t")
+		if strings.HasPrefix(strings.TrimSpace(line), "+") {
+			continue
+		}
+		if len(strings.TrimSpace(line)) == 0 {
+			flush()
+			continue
+		}
+		current = append(current, strings.TrimSpace(line))
+	}
+	flush()
+	return paras
+}
+
+// oneLine returns the text of comment lines on a single line, for tables.
+func oneLine(lines []string) string {
+	return strings.Join(strings.Fields(strings.Join(paragraphs(lines), " ")), " ")
+}
+
+// field is a row of the field table of a struct.
+type field struct {
+	Name     string
+	JSONName string
+	// Whether the fields of the member are encoded inline.
+	Inline      bool
+	Type        string
+	Description string
+}
+
+// item is a constant or method of a type.
+type item struct {
+	Name        string
+	Value       string
+	Description string
+}
+
+// typeSection is the documentation of a type.
+type typeSection struct {
+	Name       string
+	Paragraphs []string
+	// The underlying type of named non-struct types, already formatted.
+	Underlying string
+	Fields     []field
+	Values     []item
+	Methods    []item
+}
+
+// page writes the parts of a reference page in a format.
+type page interface {
+	extension() string
+	// code returns 'text' as code.
+	code(text string) string
+	// link returns a link to 'href' with the formatted 'content'.
+	link(content, href string) string
+	packageHeader(w io.Writer, name, path string, paras, index []string)
+	typeSection(w io.Writer, s typeSection)
+}
+
+// assemblePage writes the header as a comment of the page, before its
+// body.
+func assemblePage(w io.Writer, f *generator.File) {
+	header := strings.TrimRight(string(f.Header), "\n")
+	if len(header) > 0 {
+		fmt.Fprintln(w, "<!--")
+		for _, line := range strings.Split(header, "\n") {
+			line = strings.TrimPrefix(strings.TrimPrefix(line, "//"), " ")
+			fmt.Fprintln(w, strings.Replace(line, "--", "- -", -1))
+		}
+		fmt.Fprintln(w, "-->")
+		fmt.Fprintln(w)
+	}
+	w.Write(f.Body.Bytes())
+}
+
+func formatPage(source []byte) ([]byte, error) {
+	return source, nil
+}
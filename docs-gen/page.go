@@ -0,0 +1,156 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docs_gen
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+// markdownPage writes pages in GitHub flavored Markdown.
+type markdownPage struct{}
+
+func (markdownPage) extension() string {
+	return ".md"
+}
+
+func (markdownPage) code(text string) string {
+	return "`" + text + "`"
+}
+
+func (markdownPage) link(content, href string) string {
+	return "[" + content + "](" + href + ")"
+}
+
+// cell escapes text for a table cell.
+func (markdownPage) cell(text string) string {
+	return strings.Replace(text, "|", `\|`, -1)
+}
+
+func (p markdownPage) packageHeader(w io.Writer, name, path string, paras, index []string) {
+	fmt.Fprintf(w, "# Package %s\n\n", name)
+	fmt.Fprintf(w, "%s\n\n", p.code(`import "`+path+`"`))
+	for _, para := range paras {
+		fmt.Fprintf(w, "%s\n\n", para)
+	}
+	fmt.Fprintf(w, "## Types\n\n")
+	for _, entry := range index {
+		fmt.Fprintf(w, "- %s\n", entry)
+	}
+	fmt.Fprintln(w)
+}
+
+func (p markdownPage) typeSection(w io.Writer, s typeSection) {
+	fmt.Fprintf(w, "## %s\n\n", s.Name)
+	for _, para := range s.Paragraphs {
+		fmt.Fprintf(w, "%s\n\n", para)
+	}
+	if len(s.Underlying) > 0 {
+		fmt.Fprintf(w, "Underlying type: %s\n\n", s.Underlying)
+	}
+	if len(s.Fields) > 0 {
+		fmt.Fprintf(w, "| Field | JSON | Type | Description |\n")
+		fmt.Fprintf(w, "| --- | --- | --- | --- |\n")
+		for _, f := range s.Fields {
+			jsonName := p.code(f.JSONName)
+			if f.Inline {
+				jsonName = "(inline)"
+			}
+			fmt.Fprintf(w, "| %s | %s | %s | %s |\n", p.code(f.Name), p.cell(jsonName), p.cell(f.Type), p.cell(f.Description))
+		}
+		fmt.Fprintln(w)
+	}
+	if len(s.Values) > 0 {
+		fmt.Fprintf(w, "| Value | Description |\n")
+		fmt.Fprintf(w, "| --- | --- |\n")
+		for _, v := range s.Values {
+			fmt.Fprintf(w, "| %s | %s |\n", p.cell(p.code(v.Name+" = "+v.Value)), p.cell(v.Description))
+		}
+		fmt.Fprintln(w)
+	}
+	if len(s.Methods) > 0 {
+		fmt.Fprintf(w, "| Method | Description |\n")
+		fmt.Fprintf(w, "| --- | --- |\n")
+		for _, m := range s.Methods {
+			fmt.Fprintf(w, "| %s | %s |\n", p.code(m.Name), p.cell(m.Description))
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// htmlPage writes pages as HTML fragments, to be embedded in a site.
+type htmlPage struct{}
+
+func (htmlPage) extension() string {
+	return ".html"
+}
+
+func (htmlPage) code(text string) string {
+	return "<code>" + html.EscapeString(text) + "</code>"
+}
+
+func (htmlPage) link(content, href string) string {
+	return `<a href="` + html.EscapeString(href) + `">` + content + "</a>"
+}
+
+func (p htmlPage) packageHeader(w io.Writer, name, path string, paras, index []string) {
+	fmt.Fprintf(w, "<h1>Package %s</h1>\n", html.EscapeString(name))
+	fmt.Fprintf(w, "<p>%s</p>\n", p.code(`import "`+path+`"`))
+	for _, para := range paras {
+		fmt.Fprintf(w, "<p>%s</p>\n", html.EscapeString(para))
+	}
+	fmt.Fprintf(w, "<h2>Types</h2>\n<ul>\n")
+	for _, entry := range index {
+		fmt.Fprintf(w, "<li>%s</li>\n", entry)
+	}
+	fmt.Fprintf(w, "</ul>\n")
+}
+
+func (p htmlPage) typeSection(w io.Writer, s typeSection) {
+	fmt.Fprintf(w, "<h2 id=\"%s\">%s</h2>\n", anchor(s.Name), html.EscapeString(s.Name))
+	for _, para := range s.Paragraphs {
+		fmt.Fprintf(w, "<p>%s</p>\n", html.EscapeString(para))
+	}
+	if len(s.Underlying) > 0 {
+		fmt.Fprintf(w, "<p>Underlying type: %s</p>\n", s.Underlying)
+	}
+	if len(s.Fields) > 0 {
+		fmt.Fprintf(w, "<table>\n<tr><th>Field</th><th>JSON</th><th>Type</th><th>Description</th></tr>\n")
+		for _, f := range s.Fields {
+			jsonName := p.code(f.JSONName)
+			if f.Inline {
+				jsonName = "(inline)"
+			}
+			fmt.Fprintf(w, "<tr><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>\n", p.code(f.Name), jsonName, f.Type, html.EscapeString(f.Description))
+		}
+		fmt.Fprintf(w, "</table>\n")
+	}
+	if len(s.Values) > 0 {
+		fmt.Fprintf(w, "<table>\n<tr><th>Value</th><th>Description</th></tr>\n")
+		for _, v := range s.Values {
+			fmt.Fprintf(w, "<tr><td>%s</td><td>%s</td></tr>\n", p.code(v.Name+" = "+v.Value), html.EscapeString(v.Description))
+		}
+		fmt.Fprintf(w, "</table>\n")
+	}
+	if len(s.Methods) > 0 {
+		fmt.Fprintf(w, "<table>\n<tr><th>Method</th><th>Description</th></tr>\n")
+		for _, m := range s.Methods {
+			fmt.Fprintf(w, "<tr><td>%s</td><td>%s</td></tr>\n", p.code(m.Name), html.EscapeString(m.Description))
+		}
+		fmt.Fprintf(w, "</table>\n")
+	}
+}
@@ -0,0 +1,367 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package enum_gen
+
+import (
+	"io"
+	"math/big"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/namer"
+	"github.com/lack-io/gogogen/gogenerator/types"
+	"github.com/lack-io/gogogen/util/log"
+	"github.com/lack-io/gogogen/util/sets"
+)
+
+// These are the comment tags that carry parameters for enum generation.
+const (
+	tagName           = "gogogen:enum-gen"
+	trimPrefixTagName = tagName + ":trim-prefix"
+
+	// tagValuePackage, on a package, asks for enum methods for every named
+	// integer or string type which has constants.
+	tagValuePackage = "package"
+)
+
+func extractTag(name string, t *types.Type) []string {
+	comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
+	return types.ExtractCommentTags("+", comments)[name]
+}
+
+// NameSystems returns the name system used by the generators in this package.
+func NameSystems() namer.NameSystems {
+	return namer.NameSystems{
+		"public": namer.NewPublicNamer(0),
+		"raw":    namer.NewRawNamer("", nil),
+	}
+}
+
+// DefaultNameSystem returns the default name system for ordering the types to
+// be processed by the generators in this package.
+func DefaultNameSystem() string {
+	return "public"
+}
+
+// enumValue is a single constant of an enum.
+type enumValue struct {
+	// The constant's identifier.
+	Name string
+	// The text the value is formatted as and parsed from, as a quoted Go
+	// string.
+	Text string
+	// The constant's value, as recorded by the parser.
+	Value string
+}
+
+// enum is a named type along with its constants, sorted by value.
+type enum struct {
+	Type   *types.Type
+	Values []enumValue
+}
+
+func isString(t *types.Type) bool {
+	return t.Kind == types.Alias && t.Underlying.Kind == types.Builtin && t.Underlying.Name.Name == "string"
+}
+
+func isInteger(t *types.Type) bool {
+	return t.Kind == types.Alias && types.IsInteger(t.Underlying)
+}
+
+func isUnsigned(t *types.Type) bool {
+	name := t.Underlying.Name.Name
+	return strings.HasPrefix(name, "uint") || name == "byte"
+}
+
+// wantsEnum returns true if enum methods are requested for 't', either by its
+// own tag or by the tag of its package.
+func wantsEnum(t *types.Type, ptagValue string) bool {
+	values := extractTag(tagName, t)
+	if len(values) > 1 {
+		log.Fatalf("%s: type %v: found %d %s tags: %q", t.Position, t, len(values), tagName, values)
+	}
+	if len(values) == 1 {
+		switch values[0] {
+		case "", "true":
+			return true
+		case "false":
+			return false
+		default:
+			log.Fatalf("%s: type %v: unsupported %s value: %q", t.Position, t, tagName, values[0])
+		}
+	}
+	return ptagValue == tagValuePackage
+}
+
+// findEnums returns the enums of 'pkg', indexed by type.
+func findEnums(pkg *types.Package) map[*types.Type]*enum {
+	ptagValue := ""
+	if values := types.ExtractCommentTags("+", pkg.Comments)[tagName]; len(values) > 0 {
+		ptagValue = values[0]
+		if ptagValue != tagValuePackage {
+			log.Fatalf("Package %v: unsupported %s value: %q", pkg.Path, tagName, ptagValue)
+		}
+	}
+
+	enums := map[*types.Type]*enum{}
+	for _, c := range pkg.SortedConstants() {
+		t := c.Underlying
+		if t == nil || c.ConstValue == nil || t.Name.Package != pkg.Path || !(isString(t) || isInteger(t)) {
+			continue
+		}
+		e, ok := enums[t]
+		if !ok {
+			if !wantsEnum(t, ptagValue) {
+				continue
+			}
+			e = &enum{Type: t}
+			enums[t] = e
+		}
+		e.Values = append(e.Values, enumValue{Name: c.Name.Name, Value: *c.ConstValue})
+	}
+
+	for t, e := range enums {
+		trimPrefix := ""
+		if values := extractTag(trimPrefixTagName, t); len(values) > 0 {
+			trimPrefix = values[0]
+		}
+		for i := range e.Values {
+			v := &e.Values[i]
+			if isString(t) {
+				v.Text = strconv.Quote(v.Value)
+			} else {
+				v.Text = strconv.Quote(strings.TrimPrefix(v.Name, trimPrefix))
+			}
+		}
+		sortValues(t, e.Values)
+	}
+	return enums
+}
+
+// sortValues sorts by value, then by name, so that the first of several
+// constants sharing a value is stable.
+func sortValues(t *types.Type, values []enumValue) {
+	sort.Slice(values, func(i, j int) bool {
+		a, b := values[i], values[j]
+		if isInteger(t) {
+			x, _ := new(big.Int).SetString(a.Value, 0)
+			y, _ := new(big.Int).SetString(b.Value, 0)
+			if x != nil && y != nil {
+				if c := x.Cmp(y); c != 0 {
+					return c < 0
+				}
+			}
+		} else if a.Value != b.Value {
+			return a.Value < b.Value
+		}
+		return a.Name < b.Name
+	})
+}
+
+func Packages(context *generator.Context, arguments *args.GeneratorArgs) generator.Packages {
+	boilerplate, err := arguments.LoadGoBoilerplate()
+	if err != nil {
+		log.Fatalf("Failed loading boilerplate: %v", err)
+	}
+
+	context.RegisterTagSchemas(tagName,
+		generator.TagSchema{Name: tagName, Value: generator.TagValueString, Scope: generator.TagScopePackage, Values: []string{tagValuePackage}},
+		generator.TagSchema{Name: tagName, Value: generator.TagValueBool, Scope: generator.TagScopeType},
+		generator.TagSchema{Name: trimPrefixTagName, Value: generator.TagValueString, Scope: generator.TagScopeType},
+	)
+	// The tags are read before generation, so check them now.
+	if err := context.ValidateTags(); err != nil {
+		log.Fatalf("Invalid comment tags:\n%v", err)
+	}
+
+	packages := generator.Packages{}
+	header := append(arguments.GeneratedBuildConstraint(), boilerplate...)
+
+	for i := range sets.NewString(context.Inputs...) {
+		log.Debugf("Considering pkg %q", i)
+		pkg := context.Universe[i]
+		if pkg == nil {
+			// If the input had no Go files, for example.
+			continue
+		}
+
+		enums := findEnums(pkg)
+		if len(enums) == 0 {
+			continue
+		}
+
+		log.Infof("Package %q needs generation", i)
+		packages = append(packages,
+			&generator.DefaultPackage{
+				PackageName: strings.Split(filepath.Base(pkg.Path), ".")[0],
+				PackagePath: pkg.Path,
+				HeaderText:  header,
+				GeneratorFunc: func(c *generator.Context) (generators []generator.Generator) {
+					return []generator.Generator{
+						NewGenEnum(arguments.OutputFileName(pkg, "enum"), pkg.Path, enums),
+					}
+				},
+				FilterFunc: func(c *generator.Context, t *types.Type) bool {
+					return t.Name.Package == pkg.Path
+				},
+			})
+	}
+	return packages
+}
+
+// genEnum produces a file with the methods of the enums of a package.
+type genEnum struct {
+	generator.DefaultGen
+	targetPackage string
+	imports       namer.ImportTracker
+	enums         map[*types.Type]*enum
+}
+
+func NewGenEnum(sanitizedName, targetPackage string, enums map[*types.Type]*enum) generator.Generator {
+	return &genEnum{
+		DefaultGen: generator.DefaultGen{
+			OptionalName: sanitizedName,
+		},
+		targetPackage: targetPackage,
+		imports:       generator.NewImportTracker(),
+		enums:         enums,
+	}
+}
+
+func (g *genEnum) Namers(c *generator.Context) namer.NameSystems {
+	// Have the raw namer for this file track what it imports.
+	return namer.NameSystems{
+		"raw": namer.NewRawNamer(g.targetPackage, g.imports),
+	}
+}
+
+func (g *genEnum) Filter(c *generator.Context, t *types.Type) bool {
+	_, ok := g.enums[t]
+	return ok
+}
+
+func (g *genEnum) Imports(c *generator.Context) (imports []string) {
+	imports = []string{"fmt"}
+	for t := range g.enums {
+		if isInteger(t) {
+			return append(imports, "strconv")
+		}
+	}
+	return imports
+}
+
+func (g *genEnum) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	log.Infof("Generating enum methods for type %v", t)
+
+	e := g.enums[t]
+	sw := generator.NewSnippetWriter(w, c, "$", "$")
+	args := generator.Args{
+		"type": t,
+	}
+
+	// Only the first constant of each value is used for formatting.
+	seen := map[string]bool{}
+	unique := []enumValue{}
+	for _, v := range e.Values {
+		if !seen[v.Value] {
+			seen[v.Value] = true
+			unique = append(unique, v)
+		}
+	}
+	args["unique"] = unique
+	// Every name of an integer value parses, while strings parse as
+	// themselves.
+	args["parse"] = unique
+	if isInteger(t) {
+		args["parse"] = e.Values
+	}
+
+	sw.Do(valuesCode, args)
+	if isInteger(t) {
+		args["format"] = "strconv.FormatInt(int64(x), 10)"
+		if isUnsigned(t) {
+			args["format"] = "strconv.FormatUint(uint64(x), 10)"
+		}
+		sw.Do(intStringCode, args)
+	} else {
+		sw.Do(stringStringCode, args)
+	}
+	sw.Do(parseCode, args)
+	return sw.Error()
+}
+
+var valuesCode = `// $.type|public$Values returns every defined $.type|raw$, in ascending order.
+func $.type|public$Values() []$.type|raw$ {
+	return []$.type|raw${
+		$- range .unique$
+		$.Name$,
+		$- end$
+	}
+}
+
+`
+
+var intStringCode = `// String returns the name of the constant holding x.
+func (x $.type|raw$) String() string {
+	switch x {
+	$- range .unique$
+	case $.Name$:
+		return $.Text$
+	$- end$
+	}
+	return "$.type|raw$(" + $.format$ + ")"
+}
+
+`
+
+var stringStringCode = `// String returns x as a string.
+func (x $.type|raw$) String() string {
+	return string(x)
+}
+
+`
+
+var parseCode = `// Parse$.type|public$ returns the $.type|raw$ formatted as s by String.
+func Parse$.type|public$(s string) ($.type|raw$, error) {
+	switch s {
+	$- range .parse$
+	case $.Text$:
+		return $.Name$, nil
+	$- end$
+	}
+	var zero $.type|raw$
+	return zero, fmt.Errorf("invalid $.type|raw$ %q", s)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (x $.type|raw$) MarshalText() ([]byte, error) {
+	return []byte(x.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (x *$.type|raw$) UnmarshalText(text []byte) error {
+	v, err := Parse$.type|public$(string(text))
+	if err != nil {
+		return err
+	}
+	*x = v
+	return nil
+}
+
+`
@@ -0,0 +1,432 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package env_gen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/namer"
+	"github.com/lack-io/gogogen/gogenerator/types"
+	"github.com/lack-io/gogogen/util/log"
+	"github.com/lack-io/gogogen/util/sets"
+)
+
+// These are the comment tags that carry parameters for loader generation.
+const (
+	// On types and packages, to request or opt out of generation.
+	tagName = "gogogen:env-gen"
+	// On types, the prefix of the names of their variables, as in
+	// +gogogen:env-gen:prefix=APP.
+	prefixTagName = tagName + ":prefix"
+	// On fields, with the parameters of their variable, as in
+	// +env:name=LISTEN_ADDR,required
+	envTagName = "env"
+
+	// tagValuePackage, on a package, asks for LoadFromEnv methods on every
+	// struct in it.
+	tagValuePackage = "package"
+)
+
+// The parameters of a variable.
+const (
+	// The name of the variable, by default made from the path of the field
+	// in upper snake case. On struct fields, it is the prefix of the
+	// variables of the struct.
+	paramName = "name"
+	// The variable must be set.
+	paramRequired = "required"
+	// Leaves the field without a variable.
+	paramSkip = "skip"
+)
+
+// envPackage holds the error types the generated code uses.
+const envPackage = "github.com/lack-io/gogogen/runtime/env"
+
+// NameSystems returns the name system used by the generators in this package.
+func NameSystems() namer.NameSystems {
+	return namer.NameSystems{
+		"public": namer.NewPublicNamer(0),
+		"raw":    namer.NewRawNamer("", nil),
+	}
+}
+
+// DefaultNameSystem returns the default name system for ordering the types to
+// be processed by the generators in this package.
+func DefaultNameSystem() string {
+	return "public"
+}
+
+// upperSnakeCase returns 'name' in upper case, with words separated by
+// underscores.
+func upperSnakeCase(name string) string {
+	b := &bytes.Buffer{}
+	runes := []rune(name)
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			// A new word starts at an upper case letter, unless it
+			// continues an initialism.
+			prevLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+// requestedTypes returns the structs of 'pkg' LoadFromEnv is requested for.
+func requestedTypes(pkg *types.Package) map[*types.Type]bool {
+	ptagValue := ""
+	if values := types.ExtractCommentTags("+", pkg.Comments)[tagName]; len(values) > 0 {
+		ptagValue = values[0]
+		if ptagValue != tagValuePackage {
+			log.Fatalf("Package %v: unsupported %s value: %q", pkg.Path, tagName, ptagValue)
+		}
+	}
+	requested := map[*types.Type]bool{}
+	for _, t := range pkg.SortedTypes() {
+		if t.Kind != types.Struct {
+			continue
+		}
+		comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
+		values := types.ExtractCommentTags("+", comments)[tagName]
+		if len(values) > 1 || (len(values) == 1 && values[0] != "" && values[0] != "true" && values[0] != "false") {
+			log.Fatalf("Type %v: unsupported %s values: %q", t, tagName, values)
+		}
+		if (len(values) == 0 && ptagValue != tagValuePackage) || (len(values) == 1 && values[0] == "false") {
+			continue
+		}
+		if t.Methods["LoadFromEnv"] != nil {
+			log.Warnf("Type %v already has a LoadFromEnv method, skipping", t)
+			continue
+		}
+		requested[t] = true
+	}
+	return requested
+}
+
+func Packages(context *generator.Context, arguments *args.GeneratorArgs) generator.Packages {
+	boilerplate, err := arguments.LoadGoBoilerplate()
+	if err != nil {
+		log.Fatalf("Failed loading boilerplate: %v", err)
+	}
+
+	packages := generator.Packages{}
+	header := append(arguments.GeneratedBuildConstraint(), boilerplate...)
+
+	for i := range sets.NewString(context.Inputs...) {
+		log.Debugf("Considering pkg %q", i)
+		pkg := context.Universe[i]
+		if pkg == nil {
+			// If the input had no Go files, for example.
+			continue
+		}
+
+		requested := requestedTypes(pkg)
+		if len(requested) == 0 {
+			continue
+		}
+
+		log.Infof("Package %q needs generation", i)
+		packages = append(packages,
+			&generator.DefaultPackage{
+				PackageName: strings.Split(filepath.Base(pkg.Path), ".")[0],
+				PackagePath: pkg.Path,
+				HeaderText:  header,
+				GeneratorFunc: func(c *generator.Context) (generators []generator.Generator) {
+					return []generator.Generator{
+						NewGenEnv(arguments.OutputFileName(pkg, "env"), pkg.Path, requested),
+					}
+				},
+				FilterFunc: func(c *generator.Context, t *types.Type) bool {
+					return t.Name.Package == pkg.Path
+				},
+			})
+	}
+	return packages
+}
+
+// genEnv produces a file with the LoadFromEnv methods of the structs of a
+// package.
+type genEnv struct {
+	generator.DefaultGen
+	targetPackage string
+	imports       namer.ImportTracker
+	requested     map[*types.Type]bool
+}
+
+func NewGenEnv(sanitizedName, targetPackage string, requested map[*types.Type]bool) generator.Generator {
+	return &genEnv{
+		DefaultGen: generator.DefaultGen{
+			OptionalName: sanitizedName,
+		},
+		targetPackage: targetPackage,
+		imports:       generator.NewImportTracker(),
+		requested:     requested,
+	}
+}
+
+func (g *genEnv) Namers(c *generator.Context) namer.NameSystems {
+	// Have the raw namer for this file track what it imports.
+	return namer.NameSystems{
+		"raw": namer.NewRawNamer(g.targetPackage, g.imports),
+	}
+}
+
+func (g *genEnv) Filter(c *generator.Context, t *types.Type) bool {
+	return g.requested[t]
+}
+
+func (g *genEnv) isOtherPackage(pkg string) bool {
+	if pkg == g.targetPackage {
+		return false
+	}
+	if strings.HasSuffix(pkg, "\""+g.targetPackage+"\"") {
+		return false
+	}
+	return true
+}
+
+func (g *genEnv) Imports(c *generator.Context) (imports []string) {
+	importLines := []string{}
+	for _, singleImport := range g.imports.ImportLines() {
+		if g.isOtherPackage(singleImport) {
+			importLines = append(importLines, singleImport)
+		}
+	}
+	return importLines
+}
+
+func (g *genEnv) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	log.Infof("Generating LoadFromEnv for type %v", t)
+
+	prefix := ""
+	comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
+	if values := types.ExtractCommentTags("+", comments)[prefixTagName]; len(values) > 0 {
+		prefix = strings.TrimSuffix(values[0], "_") + "_"
+	}
+	ew := &envWriter{t: t, raw: c.Namers["raw"], names: map[string]string{}}
+	ew.addStruct(t, "x.", prefix)
+	sw := generator.NewSnippetWriter(w, c, "$", "$")
+	sw.Do(loadCode, generator.Args{
+		"type":   t,
+		"Errors": types.Ref(envPackage, "Errors"),
+		"body":   ew.buf.String(),
+	})
+	return sw.Error()
+}
+
+var loadCode = `// LoadFromEnv sets the fields of x from environment variables. Fields whose
+// variable is not set keep their value. Every variable which is required but
+// not set, or can't be parsed, is reported.
+func (x *$.type|raw$) LoadFromEnv() error {
+	var errs $.Errors|raw$
+$.body$	return errs.ErrorOrNil()
+}
+
+`
+
+// envWriter writes the loading of the fields of a struct.
+type envWriter struct {
+	t   *types.Type
+	raw namer.Namer
+	buf bytes.Buffer
+	// The fields of the variables written, by variable name.
+	names map[string]string
+}
+
+func (ew *envWriter) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&ew.buf, format, args...)
+}
+
+// ref returns the name of 'name' in the package 'pkg', tracking its import.
+func (ew *envWriter) ref(pkg, name string) string {
+	return ew.raw.Name(types.Ref(pkg, name))
+}
+
+// addStruct writes the loading of the fields of the struct 'st', held at
+// 'path', from variables whose names start with 'prefix'.
+func (ew *envWriter) addStruct(st *types.Type, path, prefix string) {
+	for _, m := range st.Members {
+		if namer.IsPrivateGoName(m.Name) {
+			continue
+		}
+		params, err := m.CommentTags("+").Params(envTagName)
+		if err != nil {
+			log.Fatalf("Type %v, field %s: %v", ew.t, m.Name, err)
+		}
+		values := map[string]*string{}
+		for i := range params {
+			switch params[i].Key {
+			case paramName, paramRequired, paramSkip:
+				values[params[i].Key] = &params[i].Value
+			default:
+				log.Fatalf("Type %v, field %s: unsupported %s parameter %q", ew.t, m.Name, envTagName, params[i].Key)
+			}
+		}
+		if values[paramSkip] != nil {
+			continue
+		}
+
+		name := upperSnakeCase(m.Name)
+		if v := values[paramName]; v != nil {
+			name = *v
+		}
+		if m.Type.Kind == types.Struct && !isText(m.Type) {
+			// The variables of nested structs are prefixed, unless they
+			// are embedded.
+			nested := prefix
+			if !m.Embedded || values[paramName] != nil {
+				nested = prefix + name + "_"
+			}
+			ew.addStruct(m.Type, path+m.Name+".", nested)
+			continue
+		}
+		ew.addField(m, path+m.Name, prefix+name, values[paramRequired] != nil)
+	}
+}
+
+// isText returns true if pointers to 't' implement encoding.TextUnmarshaler.
+func isText(t *types.Type) bool {
+	return t.Methods["UnmarshalText"] != nil
+}
+
+func isDuration(t *types.Type) bool {
+	return t.Name.Package == "time" && t.Name.Name == "Duration"
+}
+
+// addField writes the loading of the field 'm', held at 'path', from the
+// variable 'name'.
+func (ew *envWriter) addField(m types.Member, path, name string, required bool) {
+	if other, ok := ew.names[name]; ok {
+		log.Fatalf("Type %v: fields %s and %s both have the variable %q", ew.t, other, m.Name, name)
+	}
+	ew.names[name] = m.Name
+
+	t := m.Type
+	// Pointer fields are set to a new value.
+	assign := func(value string) string {
+		return path + " = " + value
+	}
+	if t.Kind == types.Pointer {
+		t = t.Elem
+		assign = func(value string) string {
+			return fmt.Sprintf("p := %s\n%s = &p", value, path)
+		}
+	}
+	if !ew.supported(t) {
+		log.Fatalf("Type %v, field %s: variables of type %v are not supported, skip it with +%s:%s", ew.t, m.Name, m.Type, envTagName, paramSkip)
+	}
+
+	ew.printf("if v, ok := %s(%q); ok {\n", ew.ref("os", "LookupEnv"), name)
+	ew.parse(t, name, assign)
+	if required {
+		ew.printf("} else {\n")
+		ew.printf("errs = append(errs, %s(%q))\n", ew.ref(envPackage, "Missing"), name)
+	}
+	ew.printf("}\n")
+}
+
+// supported returns true if fields of type 't' can be parsed.
+func (ew *envWriter) supported(t *types.Type) bool {
+	if isText(t) || isDuration(t) {
+		return true
+	}
+	if t.Kind == types.Slice && t.Elem == types.String {
+		return true
+	}
+	if t.Kind == types.Alias {
+		t = t.Underlying
+	}
+	return t == types.String || t == types.Bool || types.IsInteger(t) || t == types.Float32 || t == types.Float64
+}
+
+// parse writes the parsing of the value 'v' of the variable 'name' into a
+// value of type 't', given to 'assign'.
+func (ew *envWriter) parse(t *types.Type, name string, assign func(string) string) {
+	typeName := ew.raw.Name(t)
+	invalid := fmt.Sprintf("errs = append(errs, %s(%q, err))\n", ew.ref(envPackage, "Invalid"), name)
+	if isText(t) {
+		ew.printf("var value %s\n", typeName)
+		ew.printf("if err := value.UnmarshalText([]byte(v)); err != nil {\n%s", invalid)
+		ew.printf("} else {\n%s\n}\n", assign("value"))
+		return
+	}
+	if isDuration(t) {
+		ew.printf("if d, err := %s(v); err != nil {\n%s", ew.ref("time", "ParseDuration"), invalid)
+		ew.printf("} else {\n%s\n}\n", assign("d"))
+		return
+	}
+	if t.Kind == types.Slice {
+		value := ew.ref(envPackage, "Split") + "(v)"
+		if len(t.Name.Package) > 0 {
+			value = typeName + "(" + value + ")"
+		}
+		ew.printf("%s\n", assign(value))
+		return
+	}
+
+	u := t
+	if u.Kind == types.Alias {
+		u = u.Underlying
+	}
+	conv := func(value string) string {
+		if t == types.String {
+			return value
+		}
+		return typeName + "(" + value + ")"
+	}
+	var call string
+	switch {
+	case u == types.String:
+		ew.printf("%s\n", assign(conv("v")))
+		return
+	case u == types.Bool:
+		call = ew.ref("strconv", "ParseBool") + "(v)"
+	case u == types.Float32 || u == types.Float64:
+		call = fmt.Sprintf("%s(v, %d)", ew.ref("strconv", "ParseFloat"), bitSize(u))
+	case strings.HasPrefix(u.Name.Name, "uint") || u == types.Uintptr || u == types.Byte:
+		call = fmt.Sprintf("%s(v, 0, %d)", ew.ref("strconv", "ParseUint"), bitSize(u))
+	default:
+		call = fmt.Sprintf("%s(v, 0, %d)", ew.ref("strconv", "ParseInt"), bitSize(u))
+	}
+	ew.printf("if n, err := %s; err != nil {\n%s", call, invalid)
+	ew.printf("} else {\n%s\n}\n", assign(conv("n")))
+}
+
+// bitSize returns the size of values of the builtin 't', as strconv takes
+// it.
+func bitSize(t *types.Type) int {
+	switch t {
+	case types.Int8, types.Uint8:
+		return 8
+	case types.Int16, types.Uint16:
+		return 16
+	case types.Int32, types.Uint32, types.Float32:
+		return 32
+	case types.Int, types.Uint, types.Uintptr:
+		return 0
+	}
+	return 64
+}
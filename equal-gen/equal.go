@@ -0,0 +1,363 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package equal_gen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/namer"
+	"github.com/lack-io/gogogen/gogenerator/types"
+	"github.com/lack-io/gogogen/util/log"
+	"github.com/lack-io/gogogen/util/sets"
+)
+
+// These are the comment tags that carry parameters for equality generation.
+const (
+	tagName               = "gogogen:equal-gen"
+	nilEqualsEmptyTagName = tagName + ":nil-equals-empty"
+
+	// tagValuePackage, on a package, asks for Equal methods on every struct
+	// and named slice or map in it.
+	tagValuePackage = "package"
+)
+
+// NameSystems returns the name system used by the generators in this package.
+func NameSystems() namer.NameSystems {
+	return namer.NameSystems{
+		"public": namer.NewPublicNamer(0),
+		"raw":    namer.NewRawNamer("", nil),
+	}
+}
+
+// DefaultNameSystem returns the default name system for ordering the types to
+// be processed by the generators in this package.
+func DefaultNameSystem() string {
+	return "public"
+}
+
+// boolTag returns the value of a true/false tag, or 'def' if it is not set.
+func boolTag(values []string, def bool, where, name string) bool {
+	if len(values) > 1 {
+		log.Fatalf("%s: found %d %s tags: %q", where, len(values), name, values)
+	}
+	if len(values) == 0 {
+		return def
+	}
+	switch values[0] {
+	case "", "true":
+		return true
+	case "false":
+		return false
+	}
+	log.Fatalf("%s: unsupported %s value: %q", where, name, values[0])
+	return false
+}
+
+func extractTag(name string, t *types.Type) []string {
+	comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
+	return types.ExtractCommentTags("+", comments)[name]
+}
+
+// canHaveEqual returns true for the types Equal methods are generated for.
+func canHaveEqual(t *types.Type) bool {
+	switch t.Kind {
+	case types.Struct:
+		return true
+	case types.Alias:
+		return t.Underlying.Kind == types.Slice || t.Underlying.Kind == types.Map
+	}
+	return false
+}
+
+// requestedTypes returns the types of 'pkg' Equal methods are requested for.
+func requestedTypes(pkg *types.Package) map[*types.Type]bool {
+	ptagValue := ""
+	if values := types.ExtractCommentTags("+", pkg.Comments)[tagName]; len(values) > 0 {
+		ptagValue = values[0]
+		if ptagValue != tagValuePackage {
+			log.Fatalf("Package %v: unsupported %s value: %q", pkg.Path, tagName, ptagValue)
+		}
+	}
+	requested := map[*types.Type]bool{}
+	for _, t := range pkg.SortedTypes() {
+		if !canHaveEqual(t) || !boolTag(extractTag(tagName, t), ptagValue == tagValuePackage, fmt.Sprintf("Type %v", t), tagName) {
+			continue
+		}
+		if t.Methods["Equal"] != nil {
+			log.Warnf("Type %v: not generating Equal, which is already defined", t)
+			continue
+		}
+		requested[t] = true
+	}
+	return requested
+}
+
+func Packages(context *generator.Context, arguments *args.GeneratorArgs) generator.Packages {
+	boilerplate, err := arguments.LoadGoBoilerplate()
+	if err != nil {
+		log.Fatalf("Failed loading boilerplate: %v", err)
+	}
+	nilEqualsEmpty := arguments.CustomArgs.(*CustomArgs).NilEqualsEmpty
+
+	packages := generator.Packages{}
+	header := append(arguments.GeneratedBuildConstraint(), boilerplate...)
+
+	// Find every type with an Equal method first, so that the methods can
+	// call each other across the input packages.
+	requested := map[string]map[*types.Type]bool{}
+	equal := map[*types.Type]bool{}
+	for i := range sets.NewString(context.Inputs...) {
+		log.Debugf("Considering pkg %q", i)
+		pkg := context.Universe[i]
+		if pkg == nil {
+			// If the input had no Go files, for example.
+			continue
+		}
+		if pkgRequested := requestedTypes(pkg); len(pkgRequested) > 0 {
+			requested[i] = pkgRequested
+			for t := range pkgRequested {
+				equal[t] = true
+			}
+		}
+	}
+
+	for i := range requested {
+		pkg := context.Universe[i]
+		log.Infof("Package %q needs generation", i)
+		packages = append(packages,
+			&generator.DefaultPackage{
+				PackageName: strings.Split(filepath.Base(pkg.Path), ".")[0],
+				PackagePath: pkg.Path,
+				HeaderText:  header,
+				GeneratorFunc: func(c *generator.Context) (generators []generator.Generator) {
+					return []generator.Generator{
+						NewGenEqual(arguments.OutputFileName(pkg, "equal"), pkg.Path, requested[pkg.Path], equal, nilEqualsEmpty),
+					}
+				},
+				FilterFunc: func(c *generator.Context, t *types.Type) bool {
+					return t.Name.Package == pkg.Path
+				},
+			})
+	}
+	return packages
+}
+
+// genEqual produces a file with the Equal methods of the types of a package.
+type genEqual struct {
+	generator.DefaultGen
+	targetPackage  string
+	imports        namer.ImportTracker
+	requested      map[*types.Type]bool
+	equal          map[*types.Type]bool
+	nilEqualsEmpty bool
+}
+
+func NewGenEqual(sanitizedName, targetPackage string, requested, equal map[*types.Type]bool, nilEqualsEmpty bool) generator.Generator {
+	return &genEqual{
+		DefaultGen: generator.DefaultGen{
+			OptionalName: sanitizedName,
+		},
+		targetPackage:  targetPackage,
+		imports:        generator.NewImportTracker(),
+		requested:      requested,
+		equal:          equal,
+		nilEqualsEmpty: nilEqualsEmpty,
+	}
+}
+
+func (g *genEqual) Namers(c *generator.Context) namer.NameSystems {
+	// Have the raw namer for this file track what it imports.
+	return namer.NameSystems{
+		"raw": namer.NewRawNamer(g.targetPackage, g.imports),
+	}
+}
+
+func (g *genEqual) Filter(c *generator.Context, t *types.Type) bool {
+	return g.requested[t]
+}
+
+func (g *genEqual) isOtherPackage(pkg string) bool {
+	if pkg == g.targetPackage {
+		return false
+	}
+	if strings.HasSuffix(pkg, "\""+g.targetPackage+"\"") {
+		return false
+	}
+	return true
+}
+
+func (g *genEqual) Imports(c *generator.Context) (imports []string) {
+	importLines := []string{}
+	for _, singleImport := range g.imports.ImportLines() {
+		if g.isOtherPackage(singleImport) {
+			importLines = append(importLines, singleImport)
+		}
+	}
+	return importLines
+}
+
+// hasEqual returns true if values of 't' are compared with their own Equal
+// method, which is either generated or of the form Equal(T) bool, as that
+// of time.Time is.
+func (g *genEqual) hasEqual(t *types.Type) bool {
+	if g.equal[t] {
+		return true
+	}
+	m := t.Methods["Equal"]
+	if m == nil || m.Signature == nil {
+		return false
+	}
+	sig := m.Signature
+	return len(sig.Parameters) == 1 && sig.Parameters[0] == t && len(sig.Results) == 1 && sig.Results[0] == types.Bool
+}
+
+// isComparable returns true if values of 't' are compared with ==, which is
+// the case of basic types, pointers that aren't followed, channels, and
+// arrays and structs of those.
+func isComparable(t *types.Type) bool {
+	switch t.Kind {
+	case types.Builtin, types.Chan:
+		return true
+	case types.Alias:
+		return isComparable(t.Underlying)
+	case types.Array:
+		return isComparable(t.Elem)
+	case types.Struct:
+		for _, m := range t.Members {
+			if !isComparable(m.Type) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// equalWriter writes the body of an Equal method.
+type equalWriter struct {
+	g   *genEqual
+	b   *bytes.Buffer
+	raw namer.Namer
+	// The depth of nested loops, to name their variables.
+	depth int
+}
+
+func (ew *equalWriter) printf(format string, args ...interface{}) {
+	fmt.Fprintf(ew.b, format, args...)
+}
+
+// compare writes the statements returning false if 'a' and 'b', of type 't',
+// differ. Within the type being generated, named types are compared by
+// their structure rather than by their Equal method, which is theirs.
+func (ew *equalWriter) compare(a, b string, t *types.Type, nilEqualsEmpty, top bool) {
+	if !top && ew.g.hasEqual(t) {
+		ew.printf("if !%s.Equal(%s) {\nreturn false\n}\n", a, unparen(b))
+		return
+	}
+	u := t
+	if u.Kind == types.Alias {
+		u = u.Underlying
+	}
+	switch {
+	case u.Kind == types.Pointer:
+		if isComparable(u.Elem) && !ew.g.hasEqual(u.Elem) {
+			ew.printf("if (%s == nil) != (%s == nil) || (%s != nil && *%s != *%s) {\nreturn false\n}\n", a, b, a, a, b)
+			return
+		}
+		ew.printf("if (%s == nil) != (%s == nil) {\nreturn false\n}\n", a, b)
+		ew.printf("if %s != nil && %s != %s {\n", a, a, b)
+		ew.compare("(*"+a+")", "(*"+b+")", u.Elem, nilEqualsEmpty, false)
+		ew.printf("}\n")
+	case isComparable(u):
+		ew.printf("if %s != %s {\nreturn false\n}\n", a, b)
+	case u.Kind == types.Slice || u.Kind == types.Array:
+		if u.Kind == types.Slice && !nilEqualsEmpty {
+			ew.printf("if (%s == nil) != (%s == nil) {\nreturn false\n}\n", a, b)
+		}
+		ew.printf("if len(%s) != len(%s) {\nreturn false\n}\n", a, b)
+		i := fmt.Sprintf("i%d", ew.depth)
+		ew.depth++
+		ew.printf("for %s := range %s {\n", i, a)
+		ew.compare(a+"["+i+"]", b+"["+i+"]", u.Elem, nilEqualsEmpty, false)
+		ew.printf("}\n")
+		ew.depth--
+	case u.Kind == types.Map:
+		if !nilEqualsEmpty {
+			ew.printf("if (%s == nil) != (%s == nil) {\nreturn false\n}\n", a, b)
+		}
+		ew.printf("if len(%s) != len(%s) {\nreturn false\n}\n", a, b)
+		k, va, vb := fmt.Sprintf("k%d", ew.depth), fmt.Sprintf("va%d", ew.depth), fmt.Sprintf("vb%d", ew.depth)
+		ew.depth++
+		ew.printf("for %s, %s := range %s {\n", k, va, a)
+		ew.printf("%s, ok := %s[%s]\nif !ok {\nreturn false\n}\n", vb, b, k)
+		ew.compare(va, vb, u.Elem, nilEqualsEmpty, false)
+		ew.printf("}\n")
+		ew.depth--
+	case u.Kind == types.Struct && (top || len(t.Name.Package) == 0 || t.Name.Package == ew.g.targetPackage):
+		for _, m := range u.Members {
+			if m.Name == "_" {
+				continue
+			}
+			where := fmt.Sprintf("Type %v, field %s", t, m.Name)
+			tags := types.ExtractCommentTags("+", m.CommentLines)
+			if !boolTag(tags[tagName], true, where, tagName) {
+				continue
+			}
+			fieldNilEqualsEmpty := boolTag(tags[nilEqualsEmptyTagName], nilEqualsEmpty, where, nilEqualsEmptyTagName)
+			ew.compare(a+"."+m.Name, b+"."+m.Name, m.Type, fieldNilEqualsEmpty, false)
+		}
+	case u.Kind == types.Func:
+		// Functions can't be compared, other than to nil.
+		ew.printf("if (%s == nil) != (%s == nil) {\nreturn false\n}\n", a, b)
+	default:
+		// Interfaces, and structs of other packages without Equal methods.
+		ew.printf("if !%s(%s, %s) {\nreturn false\n}\n", ew.raw.Name(types.Ref("reflect", "DeepEqual")), unparen(a), unparen(b))
+	}
+}
+
+// unparen removes the parentheses around a dereference, where it is an
+// argument and doesn't need them.
+func unparen(expr string) string {
+	if strings.HasPrefix(expr, "(*") && strings.HasSuffix(expr, ")") {
+		return expr[1 : len(expr)-1]
+	}
+	return expr
+}
+
+func (g *genEqual) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	log.Infof("Generating Equal for type %v", t)
+
+	nilEqualsEmpty := boolTag(extractTag(nilEqualsEmptyTagName, t), g.nilEqualsEmpty, fmt.Sprintf("Type %v", t), nilEqualsEmptyTagName)
+	ew := &equalWriter{g: g, b: &bytes.Buffer{}, raw: c.Namers["raw"]}
+	name := ew.raw.Name(t)
+	ew.printf("// Equal reports whether x and other are semantically equal.")
+	if nilEqualsEmpty {
+		ew.printf(" Nil slices and\n// maps are equal to empty ones, unless tagged otherwise.\n")
+	} else {
+		ew.printf(" Nil slices and\n// maps differ from empty ones, unless tagged otherwise.\n")
+	}
+	ew.printf("func (x %s) Equal(other %s) bool {\n", name, name)
+	ew.compare("x", "other", t, nilEqualsEmpty, true)
+	ew.printf("return true\n}\n\n")
+
+	_, err := w.Write(ew.b.Bytes())
+	return err
+}
@@ -0,0 +1,449 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package flag_gen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/namer"
+	"github.com/lack-io/gogogen/gogenerator/types"
+	"github.com/lack-io/gogogen/util/log"
+	"github.com/lack-io/gogogen/util/sets"
+)
+
+// These are the comment tags that carry parameters for flag generation.
+const (
+	// On types and packages, to request or opt out of generation.
+	tagName = "gogogen:flag-gen"
+	// On fields, with the parameters of their flag, as in
+	// +flag:name=listen,alias=l,usage="The address to listen on."
+	flagTagName = "flag"
+
+	// tagValuePackage, on a package, asks for AddFlags methods on every
+	// struct in it.
+	tagValuePackage = "package"
+)
+
+// The parameters of a flag.
+const (
+	// The name of the flag, by default the field name in kebab case. On
+	// struct fields, it is the prefix of the flags of the struct.
+	paramName = "name"
+	// The one letter alias of the flag.
+	paramAlias = "alias"
+	// The usage of the flag, by default the comment of the field.
+	paramUsage = "usage"
+	// The default of the flag, by default the value of the field when
+	// AddFlags is called. Items of slices are separated by "|".
+	paramDefault = "default"
+	// The environment variable the flag is read from.
+	paramEnv = "env"
+	// Leaves the field without a flag.
+	paramSkip = "skip"
+)
+
+const cliPackage = "github.com/lack-io/cli"
+
+// binding is the method of cli.App binding a type of field, along with the
+// builtin type it takes a pointer to.
+type binding struct {
+	Method string
+	Type   *types.Type
+}
+
+// bindings maps the types of fields to their binding, by name.
+var bindings = map[types.Name]binding{
+	types.Bool.Name:                     {"BoolVarP", types.Bool},
+	types.String.Name:                   {"StringVarP", types.String},
+	types.Int.Name:                      {"IntVarP", types.Int},
+	types.Int64.Name:                    {"Int64VarP", types.Int64},
+	types.Uint.Name:                     {"UintVarP", types.Uint},
+	types.Uint64.Name:                   {"Uint64VarP", types.Uint64},
+	types.Float64.Name:                  {"Float64VarP", types.Float64},
+	{Package: "time", Name: "Duration"}: {"DurationVarP", nil},
+	{Package: "time", Name: "Time"}:     {"TimestampVarP", nil},
+	{Name: "[]string"}:                  {"StringSliceVarP", nil},
+	{Name: "[]int"}:                     {"IntSliceVarP", nil},
+	{Name: "[]int64"}:                   {"Int64SliceVarP", nil},
+	{Name: "[]float64"}:                 {"Float64SliceVarP", nil},
+}
+
+// NameSystems returns the name system used by the generators in this package.
+func NameSystems() namer.NameSystems {
+	return namer.NameSystems{
+		"public": namer.NewPublicNamer(0),
+		"raw":    namer.NewRawNamer("", nil),
+	}
+}
+
+// DefaultNameSystem returns the default name system for ordering the types to
+// be processed by the generators in this package.
+func DefaultNameSystem() string {
+	return "public"
+}
+
+// kebabCase returns 'name' in lower case, with words separated by dashes.
+func kebabCase(name string) string {
+	b := &bytes.Buffer{}
+	runes := []rune(name)
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			// A new word starts at an upper case letter, unless it
+			// continues an initialism.
+			prevLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				b.WriteRune('-')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// description returns the comment lines which aren't comment tags, on one
+// line.
+func description(lines []string) string {
+	var text []string
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "+") {
+			continue
+		}
+		text = append(text, line)
+	}
+	return strings.Join(strings.Fields(strings.Join(text, " ")), " ")
+}
+
+// requestedTypes returns the structs of 'pkg' AddFlags is requested for.
+func requestedTypes(pkg *types.Package) map[*types.Type]bool {
+	ptagValue := ""
+	if values := types.ExtractCommentTags("+", pkg.Comments)[tagName]; len(values) > 0 {
+		ptagValue = values[0]
+		if ptagValue != tagValuePackage {
+			log.Fatalf("Package %v: unsupported %s value: %q", pkg.Path, tagName, ptagValue)
+		}
+	}
+	requested := map[*types.Type]bool{}
+	for _, t := range pkg.SortedTypes() {
+		if t.Kind != types.Struct {
+			continue
+		}
+		comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
+		values := types.ExtractCommentTags("+", comments)[tagName]
+		if len(values) > 1 || (len(values) == 1 && values[0] != "" && values[0] != "true" && values[0] != "false") {
+			log.Fatalf("Type %v: unsupported %s values: %q", t, tagName, values)
+		}
+		if (len(values) == 0 && ptagValue != tagValuePackage) || (len(values) == 1 && values[0] == "false") {
+			continue
+		}
+		if t.Methods["AddFlags"] != nil {
+			log.Warnf("Type %v already has an AddFlags method, skipping", t)
+			continue
+		}
+		requested[t] = true
+	}
+	return requested
+}
+
+func Packages(context *generator.Context, arguments *args.GeneratorArgs) generator.Packages {
+	boilerplate, err := arguments.LoadGoBoilerplate()
+	if err != nil {
+		log.Fatalf("Failed loading boilerplate: %v", err)
+	}
+
+	packages := generator.Packages{}
+	header := append(arguments.GeneratedBuildConstraint(), boilerplate...)
+
+	for i := range sets.NewString(context.Inputs...) {
+		log.Debugf("Considering pkg %q", i)
+		pkg := context.Universe[i]
+		if pkg == nil {
+			// If the input had no Go files, for example.
+			continue
+		}
+
+		requested := requestedTypes(pkg)
+		if len(requested) == 0 {
+			continue
+		}
+
+		log.Infof("Package %q needs generation", i)
+		packages = append(packages,
+			&generator.DefaultPackage{
+				PackageName: strings.Split(filepath.Base(pkg.Path), ".")[0],
+				PackagePath: pkg.Path,
+				HeaderText:  header,
+				GeneratorFunc: func(c *generator.Context) (generators []generator.Generator) {
+					return []generator.Generator{
+						NewGenFlags(arguments.OutputFileName(pkg, "flag"), pkg.Path, requested),
+					}
+				},
+				FilterFunc: func(c *generator.Context, t *types.Type) bool {
+					return t.Name.Package == pkg.Path
+				},
+			})
+	}
+	return packages
+}
+
+// genFlags produces a file with the AddFlags methods of the structs of a
+// package.
+type genFlags struct {
+	generator.DefaultGen
+	targetPackage string
+	imports       namer.ImportTracker
+	requested     map[*types.Type]bool
+}
+
+func NewGenFlags(sanitizedName, targetPackage string, requested map[*types.Type]bool) generator.Generator {
+	return &genFlags{
+		DefaultGen: generator.DefaultGen{
+			OptionalName: sanitizedName,
+		},
+		targetPackage: targetPackage,
+		imports:       generator.NewImportTracker(),
+		requested:     requested,
+	}
+}
+
+func (g *genFlags) Namers(c *generator.Context) namer.NameSystems {
+	// Have the raw namer for this file track what it imports.
+	return namer.NameSystems{
+		"raw": namer.NewRawNamer(g.targetPackage, g.imports),
+	}
+}
+
+func (g *genFlags) Filter(c *generator.Context, t *types.Type) bool {
+	return g.requested[t]
+}
+
+func (g *genFlags) isOtherPackage(pkg string) bool {
+	if pkg == g.targetPackage {
+		return false
+	}
+	if strings.HasSuffix(pkg, "\""+g.targetPackage+"\"") {
+		return false
+	}
+	return true
+}
+
+func (g *genFlags) Imports(c *generator.Context) (imports []string) {
+	importLines := []string{}
+	for _, singleImport := range g.imports.ImportLines() {
+		if g.isOtherPackage(singleImport) {
+			importLines = append(importLines, singleImport)
+		}
+	}
+	return importLines
+}
+
+func (g *genFlags) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	log.Infof("Generating AddFlags for type %v", t)
+
+	fw := &flagWriter{t: t, raw: c.Namers["raw"], names: map[string]string{}}
+	fw.addStruct(t, "x.", "")
+	sw := generator.NewSnippetWriter(w, c, "$", "$")
+	sw.Do(addFlagsCode, generator.Args{
+		"type": t,
+		"App":  types.Ref(cliPackage, "App"),
+		"body": fw.buf.String(),
+	})
+	return sw.Error()
+}
+
+var addFlagsCode = `// AddFlags binds the fields of x to flags of app. Unless given other
+// defaults, the flags default to the values of the fields.
+func (x *$.type|raw$) AddFlags(app *$.App|raw$) {
+$.body$}
+
+`
+
+// flagWriter writes the bindings of the fields of a struct.
+type flagWriter struct {
+	t   *types.Type
+	raw namer.Namer
+	buf bytes.Buffer
+	// The fields of the flags written, by flag name.
+	names map[string]string
+}
+
+// addStruct writes the bindings of the fields of the struct 'st', held at
+// 'path', with flag names starting with 'prefix'.
+func (fw *flagWriter) addStruct(st *types.Type, path, prefix string) {
+	for _, m := range st.Members {
+		if namer.IsPrivateGoName(m.Name) {
+			continue
+		}
+		params, err := m.CommentTags("+").Params(flagTagName)
+		if err != nil {
+			log.Fatalf("Type %v, field %s: %v", fw.t, m.Name, err)
+		}
+		values := map[string]*string{}
+		for i := range params {
+			switch params[i].Key {
+			case paramName, paramAlias, paramUsage, paramDefault, paramEnv, paramSkip:
+				values[params[i].Key] = &params[i].Value
+			default:
+				log.Fatalf("Type %v, field %s: unsupported %s parameter %q", fw.t, m.Name, flagTagName, params[i].Key)
+			}
+		}
+		if values[paramSkip] != nil {
+			continue
+		}
+
+		name := kebabCase(m.Name)
+		if v := values[paramName]; v != nil {
+			name = *v
+		}
+		if m.Type.Kind == types.Struct && bindingOf(m.Type) == nil {
+			// The flags of nested structs are prefixed, unless they are
+			// embedded.
+			nested := prefix
+			if !m.Embedded || values[paramName] != nil {
+				nested = prefix + name + "-"
+			}
+			fw.addStruct(m.Type, path+m.Name+".", nested)
+			continue
+		}
+		fw.addField(m, path+m.Name, prefix+name, values)
+	}
+}
+
+// bindingOf returns the binding of fields of type 't', or nil if it has
+// none. Named types of builtin types are bound as their underlying type.
+func bindingOf(t *types.Type) *binding {
+	if b, ok := bindings[t.Name]; ok {
+		return &b
+	}
+	if t.Kind == types.Alias && t.Underlying.Kind == types.Builtin {
+		if b, ok := bindings[t.Underlying.Name]; ok && b.Type != nil {
+			return &b
+		}
+	}
+	return nil
+}
+
+// addField writes the binding of the field 'm', held at 'path', to the flag
+// 'name'.
+func (fw *flagWriter) addField(m types.Member, path, name string, values map[string]*string) {
+	b := bindingOf(m.Type)
+	if b == nil {
+		log.Fatalf("Type %v, field %s: flags of type %v are not supported, skip it with +%s:%s", fw.t, m.Name, m.Type, flagTagName, paramSkip)
+	}
+	if other, ok := fw.names[name]; ok {
+		log.Fatalf("Type %v: fields %s and %s both have the flag %q", fw.t, other, m.Name, name)
+	}
+	fw.names[name] = m.Name
+
+	// Named types are bound through a pointer to their underlying type.
+	ptr, value := "&"+path, path
+	if b.Type != nil && m.Type != b.Type {
+		ptr = "(*" + b.Type.Name.Name + ")(&" + path + ")"
+		value = b.Type.Name.Name + "(" + path + ")"
+	}
+	if v := values[paramDefault]; v != nil {
+		value = fw.literal(m, b, *v)
+	}
+	alias, usage, env := "", description(m.CommentLines), ""
+	if v := values[paramAlias]; v != nil {
+		alias = *v
+	}
+	if v := values[paramUsage]; v != nil {
+		usage = *v
+	}
+	if v := values[paramEnv]; v != nil {
+		env = *v
+	}
+	fmt.Fprintf(&fw.buf, "app.%s(%s, %q, %q, %s, %q, %q)\n", b.Method, ptr, name, alias, value, usage, env)
+}
+
+// literal returns the Go expression of the default 'value' of the field
+// 'm'.
+func (fw *flagWriter) literal(m types.Member, b *binding, value string) string {
+	fail := func(err error) {
+		log.Fatalf("Type %v, field %s: invalid default %q: %v", fw.t, m.Name, value, err)
+	}
+	var err error
+	switch b.Method {
+	case "StringVarP":
+		return strconv.Quote(value)
+	case "BoolVarP":
+		_, err = strconv.ParseBool(value)
+	case "IntVarP", "Int64VarP":
+		_, err = strconv.ParseInt(value, 0, 64)
+	case "UintVarP", "Uint64VarP":
+		_, err = strconv.ParseUint(value, 0, 64)
+	case "Float64VarP":
+		_, err = strconv.ParseFloat(value, 64)
+	case "DurationVarP":
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			fail(err)
+		}
+		return durationLiteral(fw.raw.Name(types.Ref("time", "Duration")), d)
+	case "StringSliceVarP", "IntSliceVarP", "Int64SliceVarP", "Float64SliceVarP":
+		items := []string{}
+		if len(value) > 0 {
+			for _, item := range strings.Split(value, "|") {
+				if b.Method == "StringSliceVarP" {
+					items = append(items, strconv.Quote(item))
+					continue
+				}
+				if _, err := strconv.ParseFloat(item, 64); err != nil {
+					fail(err)
+				}
+				items = append(items, item)
+			}
+		}
+		return fw.raw.Name(m.Type) + "{" + strings.Join(items, ", ") + "}"
+	default:
+		log.Fatalf("Type %v, field %s: defaults of type %v are not supported", fw.t, m.Name, m.Type)
+	}
+	if err != nil {
+		fail(err)
+	}
+	return value
+}
+
+// durationLiteral returns the Go expression of 'd', in its largest whole
+// unit.
+func durationLiteral(durationType string, d time.Duration) string {
+	units := []struct {
+		d    time.Duration
+		name string
+	}{
+		{time.Hour, "Hour"},
+		{time.Minute, "Minute"},
+		{time.Second, "Second"},
+		{time.Millisecond, "Millisecond"},
+		{time.Microsecond, "Microsecond"},
+	}
+	pkg := strings.TrimSuffix(durationType, "Duration")
+	for _, u := range units {
+		if d != 0 && d%u.d == 0 {
+			return fmt.Sprintf("%d * %s%s", d/u.d, pkg, u.name)
+		}
+	}
+	return fmt.Sprintf("%s(%d)", durationType, int64(d))
+}
@@ -15,13 +15,13 @@
 package args
 
 import (
-	"bytes"
+	"context"
 	"fmt"
+	gotypes "go/types"
+	"io"
 	"io/ioutil"
 	"os"
-	"path"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 
@@ -30,7 +30,19 @@ import (
 	"github.com/lack-io/gogogen/gogenerator/generator"
 	"github.com/lack-io/gogogen/gogenerator/namer"
 	"github.com/lack-io/gogogen/gogenerator/parser"
+	"github.com/lack-io/gogogen/gogenerator/plugin"
+	"github.com/lack-io/gogogen/gogenerator/protoparser"
 	"github.com/lack-io/gogogen/gogenerator/types"
+	"github.com/lack-io/gogogen/util/log"
+)
+
+const (
+	// OutputModeGOPATH places output packages under OutputBase by import
+	// path.
+	OutputModeGOPATH = "gopath"
+	// OutputModeModule places output packages in the modules of the input
+	// packages relative to the module roots.
+	OutputModeModule = "module"
 )
 
 // Default returns a defaulted GeneratorArgs. You may change the defaults
@@ -40,6 +52,12 @@ func Default() *GeneratorArgs {
 		OutputBase:                 DefaultSourceTree(),
 		GoHeaderFilePath:           filepath.Join(DefaultSourceTree(), "github.com/lack-io/gogogen/gogenerator/boilerplate/boilerplate.go.txt"),
 		GeneratedBuildTag:          "ignore_autogenerated",
+		BuildConstraintStyle:       string(generator.BuildConstraintBoth),
+		OutputMode:                 OutputModeGOPATH,
+		CacheFile:                  ".gogogen-cache",
+		GoImports:                  true,
+		Verbosity:                  2,
+		WatchInterval:              time.Second,
 		GeneratedByCommentTemplate: "// Code generated by GENERATOR_NAME. Do NOT EDIT.",
 		defaultCommandLineFlags:    true,
 	}
@@ -47,43 +65,299 @@ func Default() *GeneratorArgs {
 
 // GeneratorArgs has arguments that are passed to generators.
 type GeneratorArgs struct {
-	// Which directories to parse.
+	// Which directories to parse. Entries ending in ".proto" are parsed as
+	// protobuf files instead of Go packages. Entries with a version, such as
+	// "example.com/api/...@v1.2.3", are packages of published modules, which
+	// are downloaded as needed; they can't be mixed with local packages.
 	InputDirs []string
 
+	// Go files to parse instead of InputDirs, for build systems which declare
+	// every input file, as "import/path=path/to/file.go". Nothing else is
+	// read to find the packages, and neither the cache nor watch mode are
+	// used.
+	InputFiles []string
+
+	// The files of packages which the InputFiles import, in the same form,
+	// so that those aren't looked for either. Other imports, as of the
+	// standard library, are loaded as usual.
+	DependencyFiles []string
+
+	// Directories searched for the imports of .proto inputs.
+	ProtoPaths []string
+
 	// Source tree to write results to.
 	OutputBase string
 
 	// Package path within the source tree.
 	OutputPackagePath string
 
+	// Maps import path prefixes to the directories their packages are
+	// written to, instead of under OutputBase. See
+	// generator.Context.OutputDirs.
+	OutputDirs map[string]string
+
+	// Stripped from the import paths of packages before they are appended
+	// to OutputBase. See generator.Context.TrimPathPrefix.
+	TrimPathPrefix string
+
+	// How output packages are placed: OutputModeGOPATH, the default, joins
+	// their import paths to OutputBase; OutputModeModule writes packages in
+	// the modules of the input packages relative to the modules' roots, as
+	// found by their go.mod files, and the rest as in OutputModeGOPATH.
+	OutputMode string
+
+	// More entries for OutputDirs, each of the form
+	// "import/path/prefix=directory".
+	OutputMappings []string
+
 	// Output file name.
 	OutputFileBaseName string
 
+	// If set, returns the base name of the output files the generator
+	// 'generatorName' writes for the package 'pkg', instead of
+	// OutputFileBaseName, e.g. to encode the generator or the API version.
+	// An empty result means OutputFileBaseName. See OutputFileName.
+	OutputFileNameFunc func(pkg *types.Package, generatorName string) string
+
 	// Where to get copyright header text.
 	GoHeaderFilePath string
 
+	// If non-nil, the copyright header text itself, used instead of the
+	// contents of GoHeaderFilePath.
+	GoHeader []byte
+
+	// If true, generated Go files get no header at all: neither the
+	// copyright header text nor the "Code generated by" comment.
+	NoHeader bool
+
+	// If set, computes the copyright header text of each output package,
+	// e.g. to apply the license of the module the package belongs to.
+	HeaderProvider HeaderProvider
+
 	// If GeneratedByCommentTemplate is set, generator a "Code generated by" comment
 	// below the boilerplate, of the format defined by this string.
 	// Any instances of "GENERATOR_NAME" will be replaced with the name of the code generator
+	// The other header variables, such as GENERATOR_VERSION, are replaced too; see
+	// headerVariables.
 	GeneratedByCommentTemplate string
 
+	// The values of the GENERATOR_NAME, GENERATOR_VERSION and GIT_COMMIT
+	// header variables. GeneratorName defaults to the name of the binary,
+	// and GeneratorVersion to the version of its main module. The
+	// +gogogen:skip and +gogogen:only tags may name the generator by
+	// GeneratorName, or by the name of its pipeline step.
+	GeneratorName    string
+	GeneratorVersion string
+	GitCommit        string
+
+	// The value of the YEAR header variable, if not zero, instead of the
+	// current year.
+	HeaderYear int
+
+	// If true, the header variables whose values change from build to build,
+	// GENERATOR_VERSION and GIT_COMMIT, are replaced with nothing, so that
+	// generated files only change with their inputs. Set HeaderYear to pin
+	// YEAR as well.
+	Reproducible bool
+
 	// If true, only verify, don't write anything.
 	VerifyOnly bool
 
+	// If true, verify like VerifyOnly, but write again the files which are
+	// missing or differ from the output, leaving the others alone.
+	Fix bool
+
+	// If true together with Fix, copy every file which is written again to
+	// its name plus generator.BackupSuffix first.
+	FixBackup bool
+
+	// If true, VerifyOnly and Fix compare files exactly. Otherwise Go files
+	// which differ from the output only in the copyright header or the
+	// "Code generated by" comment, such as in the YEAR or the generator
+	// name, are considered up to date.
+	VerifyStrict bool
+
+	// If set together with VerifyOnly or Fix, write a machine-readable report
+	// of the verification to stdout. The only supported format is "json".
+	VerifyReport string
+
+	// If true, write nothing until all the packages were generated, and then
+	// move the output into place together. If any package fails, the
+	// existing output is left as it was.
+	Atomic bool
+
+	// If true, remove the files carrying the "Code generated by" line of this
+	// run's header from the output directories of the inputs and of the
+	// generated packages, if no package generates them any more. With DryRun,
+	// they are only listed.
+	Prune bool
+
+	// If true, run the generators without writing anything, and print the
+	// files which would be created, updated or left unchanged to stdout.
+	DryRun bool
+
+	// If set, the output is read from and written to this file system
+	// rather than the disk, as with generator.MemFileSystem in tests.
+	FS generator.FileSystem
+
+	// Registered with the context before the packages to generate are made,
+	// to exclude types and packages, such as deprecated ones, from the run.
+	// See generator.Context.RegisterTypeFilter.
+	TypeFilters    []generator.TypeFilterFunc
+	PackageFilters []generator.PackageFilterFunc
+
+	// If set, report the time spent parsing and executing every package and
+	// generator, and the files and bytes written. Either "text" or "json".
+	Metrics string
+
+	// The file the metrics are written to. Defaults to stderr.
+	MetricsFile string
+
+	// If set, a JSON manifest of every generated file, with the package and
+	// generators it was generated by and the hash of its content, is written
+	// to this file after a successful run.
+	Manifest string
+
+	// If true, generate the packages, then watch the inputs and generate
+	// them again whenever they change, until interrupted.
+	Watch bool
+
+	// How often to check the inputs for changes, when watching.
+	WatchInterval time.Duration
+
+	// If set, load the inputs once, then serve requests to generate
+	// packages on the unix socket at this path, until interrupted. See
+	// GenerateRequest.
+	Serve string
+
 	// If true, include *_test.go files
 	IncludeTestFile bool
 
+	// If true, keep the bodies of the functions and methods in the input
+	// packages, for generators which inspect hand-written code.
+	IncludeFunctionBodies bool
+
+	// If true, packages importing "C" are parsed without type-checking
+	// their uses of it, instead of leaving out the files importing it.
+	IncludeCgoFiles bool
+
+	// If true, keep the syntax of the declarations in the input packages,
+	// for generators which need exact syntax, such as literal values.
+	IncludeSyntax bool
+
+	// If true, load the packages the input packages import from compiled
+	// export data instead of parsing them. See parser.Builder.ExportData.
+	ExportData bool
+
+	// If true, skip the function bodies of the packages the input packages
+	// import when parsing them. See parser.Builder.SkipFunctionBodies.
+	SkipFunctionBodies bool
+
+	// Contents of input files which override those on disk, keyed by
+	// absolute path, for generating from unsaved or patched sources. See
+	// parser.Builder.Overlay.
+	Overlay map[string][]byte
+
+	// Build tags satisfied when loading the input packages, in addition to
+	// the default ones.
+	BuildTags []string
+
+	// The operating system and architecture to load the input packages
+	// for, as selected by build constraints. If empty, they are $GOOS and
+	// $GOARCH.
+	GOOS   string
+	GOARCH string
+
+	// The architecture the sizes, alignments and field offsets of types are
+	// computed for. If empty, it is GOARCH.
+	TargetArch string
+
 	// GeneratedBuildTag is the tag used to identify code generated by execution
 	// of the type. Each generator should use a different tag, and different
 	// groups of generators (external API that depends on vine generators) should
 	// keep tags distinct as well
 	GeneratedBuildTag string
 
+	// The syntax of the build constraints written into generated Go files:
+	// "both" for a //go:build line followed by the legacy // +build line, or
+	// "go:build" for only the //go:build line.
+	BuildConstraintStyle string
+
+	// Where to keep the incremental generation cache, relative to
+	// OutputBase unless absolute. It is on by default: packages whose inputs,
+	// generator binary and flags are unchanged since the last run, and whose
+	// files are as they were written, are skipped. If empty, every package
+	// is generated on every run.
+	CacheFile string
+
+	// If true, ignore the cache and regenerate every package.
+	Force bool
+
+	// The number of output packages to generate concurrently.
+	WorkerCount int
+
+	// Go plugins (shared objects) whose packages are generated in addition
+	// to the ones passed to Execute. See LoadPlugin.
+	Plugins []string
+
+	// External generators to run, using the exec plugin protocol, in the
+	// form "name[=parameter]". See the plugin package.
+	ExecPlugins []string
+
+	// Words the name systems of the generator spell in all capitals, in
+	// addition to their own. See namer.NameStrategy.WithInitialisms.
+	Initialisms []string
+
+	// The import path prefix of the local module. Imports of its packages
+	// are grouped after the standard library and other imports.
+	LocalImportPrefix string
+
+	// If true, generated Go files are run through goimports, which removes
+	// unused imports and adds missing ones. Otherwise they are only run
+	// through gofmt.
+	GoImports bool
+
+	// If true, generated Go files are written without formatting them,
+	// overriding GoImports.
+	SkipFormat bool
+
+	// If set together with SkipFormat, fail if a generated Go file doesn't
+	// parse.
+	CheckSyntax bool
+
+	// If true, generated Go files are type checked with the rest of their
+	// package before they are written, and those which don't compile are
+	// reported instead.
+	TypeCheck bool
+
+	// If true, uses of deprecated comment tags are errors rather than
+	// warnings.
+	StrictTags bool
+
+	// If true, stop at the first error, rather than generating every
+	// package and reporting all of the errors.
+	FailFast bool
+
+	// How much to log: errors and warnings at 0, info at 1, and everything
+	// at 2 and above.
+	Verbosity int
+
+	// If non-nil, where the generators and the framework log to.
+	Logger log.Logger
+
 	// Any custom arguments go here
 	CustomArgs interface{}
 
+	// The JSON file the generator's own flags are read from, if set by
+	// RegisterCustomArgs.
+	ConfigFile string
+
 	// Whether to use default command line flags
 	defaultCommandLineFlags bool
+
+	// The module the inputs with versions are resolved in, if any. See
+	// resolveVersionedInputs.
+	moduleDir string
 }
 
 // WithoutDefaultFlagParsing disables implicit addition of command line flags and parsing.
@@ -95,53 +369,234 @@ func (g *GeneratorArgs) WithoutDefaultFlagParsing() *GeneratorArgs {
 
 func (g *GeneratorArgs) AddFlags(app *ccli.App) {
 	app.StringSliceVarP(&g.InputDirs, "input-dirs", "i", g.InputDirs,
-		"Comma-separated list of import paths to get input type from.", "")
+		"Comma-separated list of import paths to get input type from. Entries ending in .proto are parsed as protobuf files, and entries with a version, such as example.com/api@v1.2.3, are downloaded.", "")
+	app.StringSliceVarP(&g.InputFiles, "input-files", "", g.InputFiles,
+		"Comma-separated list of Go files to get input types from instead of --input-dirs, as import/path=path/to/file.go.", "")
+	app.StringSliceVarP(&g.DependencyFiles, "dependency-files", "", g.DependencyFiles,
+		"Comma-separated list of the Go files of packages --input-files import, as import/path=path/to/file.go.", "")
+	app.StringSliceVarP(&g.ProtoPaths, "proto-path", "", g.ProtoPaths,
+		"Comma-separated list of directories to search for the imports of .proto inputs.", "")
 	app.StringVarP(&g.OutputBase, "output-base", "o", g.OutputBase,
 		"Output base; defaults to $GOPATH/src/ or ./ if $GOPATH is not set.", "")
 	app.StringVarP(&g.OutputPackagePath, "output-package", "p", g.OutputPackagePath,
 		"Base package path.", "")
+	app.StringVarP(&g.TrimPathPrefix, "trim-path-prefix", "", g.TrimPathPrefix,
+		"If set, strip this prefix from the import paths of packages to find where they are written under the output base.", "")
+	app.StringVarP(&g.OutputMode, "output-mode", "", g.OutputMode,
+		"How output packages are placed: \"gopath\" to write them under the output base by import path, or \"module\" to write those in the modules of the input packages relative to the module roots.", "")
+	app.StringSliceVarP(&g.OutputMappings, "output", "", g.OutputMappings,
+		"Writes the packages under an import path prefix to a directory instead of under the output base, as \"import/path/prefix=directory\". May be repeated.", "")
 	app.StringVarP(&g.OutputFileBaseName, "output-file-base", "O", g.OutputFileBaseName,
 		"Base name (without .go suffix) for output files.", "")
 	app.StringVarP(&g.GoHeaderFilePath, "go-header-file", "H", g.GoHeaderFilePath,
-		"File containing boilerplate header text. The string YEAR will be replace with the current 4-digit year.", "")
+		"File containing boilerplate header text. The string YEAR will be replace with the current 4-digit year. If empty, only a \"Code generated\" comment is written.", "")
+	app.StringVarP(&g.GitCommit, "git-commit", "", g.GitCommit,
+		"The value of GIT_COMMIT in the header and the \"Code generated\" comment.", "")
+	app.IntVarP(&g.HeaderYear, "header-year", "", g.HeaderYear,
+		"The value of YEAR in the header, instead of the current year.", "")
+	app.BoolVarP(&g.Reproducible, "reproducible", "", g.Reproducible,
+		"If true, replace GENERATOR_VERSION and GIT_COMMIT in the header with nothing, so that the output only depends on the input.", "")
+	app.BoolVarP(&g.NoHeader, "no-header", "", g.NoHeader,
+		"If true, generated Go files get no header at all, not even the \"Code generated\" comment.", "")
 	app.BoolVarP(&g.VerifyOnly, "verify-only", "", g.VerifyOnly,
 		"If true, only verify existing output, do not write anything.", "")
+	app.BoolVarP(&g.Fix, "fix", "", g.Fix,
+		"If true, verify existing output, and write again only the files which are missing or differ.", "")
+	app.BoolVarP(&g.FixBackup, "fix-backup", "", g.FixBackup,
+		"If true, keep a .bak copy of every file written again by --fix.", "")
+	app.BoolVarP(&g.VerifyStrict, "verify-strict", "", g.VerifyStrict,
+		"If true, --verify-only and --fix compare generated Go files exactly, instead of ignoring differences in their headers such as the year.", "")
+	app.BoolVarP(&g.Atomic, "atomic", "", g.Atomic,
+		"If true, write no output until every package was generated, and leave the existing output untouched if any fails.", "")
+	app.BoolVarP(&g.Prune, "prune", "", g.Prune,
+		"If true, remove generated files, carrying this run's \"Code generated by\" line, which no package generates any more.", "")
+	app.BoolVarP(&g.DryRun, "dry-run", "", g.DryRun,
+		"If true, do not write anything, but print which files would be created, updated or left unchanged.", "")
+	app.BoolVarP(&g.Watch, "watch", "", g.Watch,
+		"If true, keep running, and generate again whenever the inputs change.", "")
+	app.DurationVarP(&g.WatchInterval, "watch-interval", "", g.WatchInterval,
+		"How often to check the inputs for changes with --watch.", "")
+	app.StringVarP(&g.Serve, "serve", "", g.Serve,
+		"If set, keep the inputs loaded and serve JSON-RPC requests to generate packages on the unix socket at this path.", "")
+	app.StringVarP(&g.VerifyReport, "verify-report", "", g.VerifyReport,
+		"If set with --verify-only or --fix, print a report of the verification to stdout. Only \"json\" is supported.", "")
+	app.StringVarP(&g.Metrics, "metrics", "", g.Metrics,
+		"If set, report parse time, per-package and per-generator execution time, file counts and bytes written. Either \"text\" or \"json\".", "")
+	app.StringVarP(&g.MetricsFile, "metrics-file", "", g.MetricsFile,
+		"The file to write the --metrics report to. Defaults to stderr.", "")
+	app.StringVarP(&g.Manifest, "manifest", "", g.Manifest,
+		"If set, write a JSON manifest of the generated files and the hashes of their contents to this file.", "")
+	app.StringSliceVarP(&g.Plugins, "plugins", "", g.Plugins,
+		"Comma-separated list of Go plugin (.so) files exporting a Packages function, whose packages are generated in the same run.", "")
+	app.StringSliceVarP(&g.ExecPlugins, "exec-plugins", "", g.ExecPlugins,
+		"Comma-separated list of external generators to run, as name[=parameter]. The binary gogogen-plugin-<name> is looked up in $PATH.", "")
+	app.StringVarP(&g.CacheFile, "cache-file", "", g.CacheFile,
+		"File recording the inputs and outputs of generated packages, so unchanged packages can be skipped, relative to the output base unless absolute. Empty disables the cache.", "")
+	app.BoolVarP(&g.Force, "force", "", g.Force,
+		"If true, regenerate every package, even if its inputs are unchanged.", "")
+	app.IntVarP(&g.WorkerCount, "workers", "", g.WorkerCount,
+		"The number of output packages to generate concurrently. Values less than 2 generate serially.", "")
+	app.StringSliceVarP(&g.Initialisms, "initialisms", "", g.Initialisms,
+		"Comma-separated list of words to spell in all capitals in generated names, e.g. CRD,GRPC.", "")
+	app.StringVarP(&g.LocalImportPrefix, "local-import-prefix", "", g.LocalImportPrefix,
+		"Import path prefix of the local module, whose imports are grouped after all others in generated files.", "")
+	app.BoolVarP(&g.GoImports, "goimports", "", g.GoImports,
+		"If true, run generated Go files through goimports, removing unused and adding missing imports. If false, only gofmt them.", "")
+	app.BoolVarP(&g.SkipFormat, "skip-format", "", g.SkipFormat,
+		"If true, write generated Go files without formatting them, for when they are formatted in a separate step.", "")
+	app.BoolVarP(&g.CheckSyntax, "check-syntax", "", g.CheckSyntax,
+		"If set with --skip-format, fail if a generated Go file can't be parsed.", "")
+	app.BoolVarP(&g.TypeCheck, "type-check", "", g.TypeCheck,
+		"If true, type check generated Go files before writing them, and report the compile errors of those that don't compile with the generators that wrote them.", "")
+	app.StringSliceVarP(&g.BuildTags, "tags", "", g.BuildTags,
+		"Comma-separated list of build tags to satisfy when loading the input packages.", "")
+	app.StringVarP(&g.GOOS, "goos", "", g.GOOS,
+		"The operating system to load the input packages for. Defaults to $GOOS.", "")
+	app.StringVarP(&g.GOARCH, "goarch", "", g.GOARCH,
+		"The architecture to load the input packages for. Defaults to $GOARCH.", "")
+	app.BoolVarP(&g.ExportData, "export-data", "", g.ExportData,
+		"If true, load the dependencies of the input packages from compiled export data instead of parsing their source. Faster, but their types have no comments.", "")
+	app.BoolVarP(&g.SkipFunctionBodies, "skip-function-bodies", "", g.SkipFunctionBodies,
+		"If true, skip the function bodies of the dependencies of the input packages when parsing them, which is faster.", "")
+	app.BoolVarP(&g.IncludeCgoFiles, "include-cgo", "", g.IncludeCgoFiles,
+		"If true, parse the files of packages importing \"C\" too, leaving the types of what comes from C unknown.", "")
+	app.StringVarP(&g.TargetArch, "target-arch", "", g.TargetArch,
+		"The architecture to compute the sizes and field offsets of types for. Defaults to --goarch.", "")
+	app.BoolVarP(&g.StrictTags, "strict-tags", "", g.StrictTags,
+		"If true, fail on uses of deprecated comment tags instead of warning about them.", "")
+	app.BoolVarP(&g.FailFast, "fail-fast", "", g.FailFast,
+		"If true, stop at the first error instead of generating every package and reporting all of the errors.", "")
+	app.IntVarP(&g.Verbosity, "v", "", g.Verbosity,
+		"How much to log: 0 for errors and warnings, 1 to add info messages, 2 or more for everything.", "")
 	app.StringVarP(&g.GeneratedBuildTag, "build-tag", "", g.GeneratedBuildTag,
 		"A go build tag to use to identify files generated by this command. Should be unique.", "")
+	app.StringVarP(&g.BuildConstraintStyle, "build-constraint-style", "", g.BuildConstraintStyle,
+		"The syntax of build constraints in generated Go files: \"both\" for //go:build and // +build lines, or \"go:build\" for only the former.", "")
+}
+
+// GeneratedBuildConstraint returns the build constraint lines, followed by a
+// blank line, which exclude generated Go files from builds using
+// GeneratedBuildTag. Generators put them ahead of the boilerplate.
+func (g *GeneratorArgs) GeneratedBuildConstraint() []byte {
+	return generator.BuildConstraint(generator.BuildConstraintStyle(g.BuildConstraintStyle), "!"+g.GeneratedBuildTag)
+}
+
+// OutputFileName returns the base name, without extension, of the output
+// files the generator 'generatorName' writes for the package 'pkg'.
+func (g *GeneratorArgs) OutputFileName(pkg *types.Package, generatorName string) string {
+	if g.OutputFileNameFunc != nil {
+		if name := g.OutputFileNameFunc(pkg, generatorName); name != "" {
+			return name
+		}
+	}
+	return g.OutputFileBaseName
 }
 
-// LoadGoBoilerplate loads the boilerplate file passed to --go-header-file.
+// LoadGoBoilerplate loads the boilerplate: GoHeader if set, or else the
+// file passed to --go-header-file. If there is none, the boilerplate is
+// only the "Code generated by" comment. PACKAGE is left as is; see
+// LoadGoBoilerplateFor.
 func (g *GeneratorArgs) LoadGoBoilerplate() ([]byte, error) {
-	b, err := ioutil.ReadFile(g.GoHeaderFilePath)
+	return g.loadGoBoilerplate("")
+}
+
+// LoadGoBoilerplateFor is like LoadGoBoilerplate, but for the output
+// package 'pkgPath': it asks HeaderProvider, if set, for the copyright
+// header text, and replaces PACKAGE with 'pkgPath'.
+func (g *GeneratorArgs) LoadGoBoilerplateFor(pkgPath string) ([]byte, error) {
+	if g.HeaderProvider == nil || g.NoHeader {
+		return g.loadGoBoilerplate(pkgPath)
+	}
+	b, err := g.HeaderProvider.GoHeader(pkgPath)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed loading the header of %q: %v", pkgPath, err)
 	}
-	b = bytes.Replace(b, []byte("YEAR"), []byte(strconv.Itoa(time.Now().UTC().Year())), -1)
+	return g.completeBoilerplate(append([]byte(nil), b...), false, pkgPath), nil
+}
+
+func (g *GeneratorArgs) loadGoBoilerplate(pkgPath string) ([]byte, error) {
+	if g.NoHeader {
+		return nil, nil
+	}
+	b := append([]byte(nil), g.GoHeader...)
+	if g.GoHeader == nil && g.GoHeaderFilePath != "" {
+		var err error
+		if b, err = ioutil.ReadFile(g.GoHeaderFilePath); err != nil {
+			return nil, err
+		}
+	}
+	return g.completeBoilerplate(b, g.GoHeader == nil && g.GoHeaderFilePath == "", pkgPath), nil
+}
+
+// completeBoilerplate replaces the header variables in the copyright header
+// text 'b' and appends the "Code generated by" comment, if 'b' is not empty
+// or 'always'.
+func (g *GeneratorArgs) completeBoilerplate(b []byte, always bool, pkgPath string) []byte {
+	vars := g.headerVariables(pkgPath)
+	b = []byte(vars.Replace(string(b)))
 
 	if g.GeneratedByCommentTemplate != "" {
-		if len(b) != 0 {
-			b = append(b, byte('\n'))
-			generatorName := path.Base(os.Args[0])
-			generatedByComment := strings.Replace(g.GeneratedByCommentTemplate, "GENERATOR_NAME", generatorName, -1)
-			s := fmt.Sprintf("%s\n\n", generatedByComment)
+		if len(b) != 0 || always {
+			if len(b) != 0 {
+				b = append(b, byte('\n'))
+			}
+			s := fmt.Sprintf("%s\n\n", vars.Replace(g.GeneratedByCommentTemplate))
 			b = append(b, []byte(s)...)
 		}
 	}
-	return b, nil
+	return b
 }
 
 // NewBuilder makes a new parser.Builder and populates it with the input
 // directories.
 func (g *GeneratorArgs) NewBuilder() (*parser.Builder, error) {
+	return g.newBuilder(context.Background())
+}
+
+func (g *GeneratorArgs) newBuilder(ctx context.Context) (*parser.Builder, error) {
 	b := parser.New()
+	b.SetContext(ctx)
 
 	// flag for including *_test.go
 	b.IncludeTestFiles = g.IncludeTestFile
+	b.IncludeFunctionBodies = g.IncludeFunctionBodies
+	b.IncludeSyntax = g.IncludeSyntax
+	b.Overlay = g.Overlay
+	b.Dir = g.moduleDir
+	b.ExportData = g.ExportData
+	b.SkipFunctionBodies = g.SkipFunctionBodies
+	b.IncludeCgoFiles = g.IncludeCgoFiles
+	b.AddBuildTags(g.BuildTags...)
+	b.SetPlatform(g.GOOS, g.GOARCH)
+	if g.TargetArch != "" {
+		if b.Sizes = gotypes.SizesFor("gc", g.TargetArch); b.Sizes == nil {
+			return nil, fmt.Errorf("unknown target architecture %q", g.TargetArch)
+		}
+	}
 
 	// Ignore all auto-generated files.
 	b.AddBuildTags(g.GeneratedBuildTag)
 
-	for _, d := range g.InputDirs {
+	deps, err := parseFileList(g.DependencyFiles)
+	if err != nil {
+		return nil, err
+	}
+	for _, pkg := range deps {
+		if err := b.AddDependencyFiles(pkg.pkgPath, pkg.files...); err != nil {
+			return nil, fmt.Errorf("unable to add the files of %q: %v", pkg.pkgPath, err)
+		}
+	}
+	inputs, err := parseFileList(g.InputFiles)
+	if err != nil {
+		return nil, err
+	}
+	for _, pkg := range inputs {
+		if err := b.AddFiles(pkg.pkgPath, pkg.files...); err != nil {
+			return nil, fmt.Errorf("unable to add the files of %q: %v", pkg.pkgPath, err)
+		}
+	}
+
+	for _, d := range g.goInputDirs() {
 		var err error
 		if strings.HasSuffix(d, "/...") {
 			err = b.AddDirRecursive(strings.TrimSuffix(d, "/..."))
@@ -156,6 +611,61 @@ func (g *GeneratorArgs) NewBuilder() (*parser.Builder, error) {
 	return b, nil
 }
 
+// NewProtoBuilder makes a new protoparser.Builder and populates it with the
+// .proto files among the input directories.
+func (g *GeneratorArgs) NewProtoBuilder() (*protoparser.Builder, error) {
+	b := protoparser.New()
+	b.ImportPaths = g.ProtoPaths
+	for _, f := range g.InputDirs {
+		if !isProtoInput(f) {
+			continue
+		}
+		if err := b.AddFile(f); err != nil {
+			return nil, fmt.Errorf("unable to add file %q: %v", f, err)
+		}
+	}
+	return b, nil
+}
+
+func isProtoInput(dir string) bool {
+	return strings.HasSuffix(dir, ".proto")
+}
+
+func (g *GeneratorArgs) goInputDirs() []string {
+	var dirs []string
+	for _, d := range g.InputDirs {
+		if !isProtoInput(d) {
+			dirs = append(dirs, d)
+		}
+	}
+	return dirs
+}
+
+// newContext makes the context for the input directories, which must be
+// either all Go packages or all .proto files.
+func (g *GeneratorArgs) newContext(ctx context.Context, nameSystems namer.NameSystems, defaultSystem string) (*generator.Context, error) {
+	goDirs := g.goInputDirs()
+	if len(goDirs) == len(g.InputDirs) {
+		b, err := g.newBuilder(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return generator.NewContext(b, nameSystems, defaultSystem)
+	}
+	if len(goDirs) > 0 {
+		return nil, fmt.Errorf("go packages and .proto files can't be mixed in the inputs")
+	}
+	b, err := g.NewProtoBuilder()
+	if err != nil {
+		return nil, err
+	}
+	universe, err := b.FindTypes()
+	if err != nil {
+		return nil, err
+	}
+	return generator.NewUniverseContext(universe, b.FindPackages(), nameSystems, defaultSystem), nil
+}
+
 // InputIncludes returns true if the given package is a (sub) package of one of
 // the InputDirs.
 func (g *GeneratorArgs) InputIncludes(p *types.Package) bool {
@@ -188,30 +698,443 @@ func DefaultSourceTree() string {
 // If you don't need any non-default behavior, use as:
 // args.Default().Execute(...)
 func (g *GeneratorArgs) Execute(nameSystems namer.NameSystems, defaultSystem string, pkgs func(*generator.Context, *GeneratorArgs) generator.Packages) error {
+	return g.ExecuteContext(context.Background(), nameSystems, defaultSystem, pkgs)
+}
+
+// ExecuteContext is like Execute, but stops loading the input and
+// generating packages once ctx is done, returning ctx.Err().
+func (g *GeneratorArgs) ExecuteContext(ctx context.Context, nameSystems namer.NameSystems, defaultSystem string, pkgs func(*generator.Context, *GeneratorArgs) generator.Packages) error {
+	report, err := g.prepare(nameSystems)
+	if err != nil {
+		return err
+	}
+
+	if g.Serve != "" {
+		return g.serve(ctx, nameSystems, defaultSystem, pkgs)
+	}
+	steps := []PipelineStep{{NameSystems: nameSystems, DefaultSystem: defaultSystem, Packages: pkgs}}
+	if g.Watch {
+		return g.watch(ctx, func() error {
+			return g.execute(ctx, steps, report)
+		})
+	}
+	return g.execute(ctx, steps, report)
+}
+
+// prepare parses the command line, if needed, checks the arguments and
+// applies them to the logger and the name systems of the generators. It
+// returns the report of --verify-report, if any.
+func (g *GeneratorArgs) prepare(nameSystems ...namer.NameSystems) (*generator.VerifyReport, error) {
 	if g.defaultCommandLineFlags {
 		cmd := ccli.CommandLine
 		g.AddFlags(cmd)
 		cmd.RunAndExitOnError()
 	}
 
-	b, err := g.NewBuilder()
-	if err != nil {
-		return err
+	if len(g.InputDirs) == 0 && len(g.InputFiles) == 0 && InvokedByGoGenerate() {
+		modulePath, moduleDir, err := g.applyGoGenerate()
+		if err != nil {
+			return nil, fmt.Errorf("failed finding the package to generate: %v", err)
+		}
+		// Output packages in the module of the package are written in place.
+		if g.OutputDirs == nil {
+			g.OutputDirs = map[string]string{}
+		}
+		g.OutputDirs[modulePath] = moduleDir
 	}
 
-	// pass though the flag on whether to include *_test.go files
-	b.IncludeTestFiles = g.IncludeTestFile
+	for _, m := range g.OutputMappings {
+		parts := strings.SplitN(m, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid --output mapping %q, expected \"import/path/prefix=directory\"", m)
+		}
+		if g.OutputDirs == nil {
+			g.OutputDirs = map[string]string{}
+		}
+		g.OutputDirs[strings.TrimSuffix(parts[0], "/")] = parts[1]
+	}
 
-	c, err := generator.NewContext(b, nameSystems, defaultSystem)
+	if g.OutputMode != OutputModeGOPATH && g.OutputMode != OutputModeModule {
+		return nil, fmt.Errorf("unsupported output mode %q", g.OutputMode)
+	}
+
+	if !validBuildConstraintStyle(g.BuildConstraintStyle) {
+		return nil, fmt.Errorf("unsupported build constraint style %q", g.BuildConstraintStyle)
+	}
+
+	if g.CheckSyntax && !g.SkipFormat {
+		return nil, fmt.Errorf("--check-syntax requires --skip-format")
+	}
+
+	if len(g.InputFiles) > 0 {
+		if len(g.InputDirs) > 0 {
+			return nil, fmt.Errorf("--input-files can't be combined with --input-dirs")
+		}
+		if g.Watch || g.OutputMode == OutputModeModule {
+			return nil, fmt.Errorf("--input-files can't be combined with --watch or --output-mode=%s", OutputModeModule)
+		}
+		for _, files := range [][]string{g.InputFiles, g.DependencyFiles} {
+			if _, err := parseFileList(files); err != nil {
+				return nil, err
+			}
+		}
+	} else if len(g.DependencyFiles) > 0 {
+		return nil, fmt.Errorf("--dependency-files requires --input-files")
+	}
+
+	moduleDir, err := g.resolveVersionedInputs()
 	if err != nil {
-		return fmt.Errorf("failed making a context: %v", err)
+		return nil, err
+	}
+	g.moduleDir = moduleDir
+
+	if g.Watch && g.VerifyOnly {
+		return nil, fmt.Errorf("--watch can't be combined with --verify-only")
+	}
+	if g.Serve != "" && (g.Watch || g.VerifyOnly || g.DryRun) {
+		return nil, fmt.Errorf("--serve can't be combined with --watch, --verify-only or --dry-run")
+	}
+	if g.Fix && (g.VerifyOnly || g.DryRun || g.Watch || g.Serve != "") {
+		return nil, fmt.Errorf("--fix can't be combined with --verify-only, --dry-run, --watch or --serve")
+	}
+	if g.Atomic && (g.VerifyOnly || g.DryRun) {
+		return nil, fmt.Errorf("--atomic can't be combined with --verify-only or --dry-run")
+	}
+	if g.Prune && (g.VerifyOnly || g.Serve != "") {
+		return nil, fmt.Errorf("--prune can't be combined with --verify-only or --serve")
+	}
+	if g.FixBackup && !g.Fix {
+		return nil, fmt.Errorf("--fix-backup requires --fix")
+	}
+
+	if g.DryRun {
+		if g.VerifyOnly {
+			return nil, fmt.Errorf("--dry-run can't be combined with --verify-only")
+		}
+		// Keep stdout clean for the plan.
+		log.DefaultOut(os.Stderr)
+	}
+
+	if g.Manifest != "" && (g.VerifyOnly || g.DryRun) {
+		return nil, fmt.Errorf("--manifest can't be combined with --verify-only or --dry-run")
+	}
+
+	if g.Metrics != "" && g.Metrics != "text" && g.Metrics != "json" {
+		return nil, fmt.Errorf("unsupported metrics format %q", g.Metrics)
+	}
+
+	var report *generator.VerifyReport
+	if g.VerifyReport != "" {
+		if g.VerifyReport != "json" {
+			return nil, fmt.Errorf("unsupported verify report format %q", g.VerifyReport)
+		}
+		if !g.VerifyOnly && !g.Fix {
+			return nil, fmt.Errorf("--verify-report requires --verify-only or --fix")
+		}
+		// Keep stdout clean for the report.
+		log.DefaultOut(os.Stderr)
+		report = &generator.VerifyReport{}
+	}
+
+	log.SetLevel(log.VerbosityLevel(g.Verbosity))
+	if g.Logger != nil {
+		log.SetLogger(g.Logger)
 	}
 
-	c.Verify = g.VerifyOnly
-	packages := pkgs(c, g)
-	if err := c.ExecutePackages(g.OutputBase, packages); err != nil {
+	if len(g.Initialisms) > 0 {
+		for _, systems := range nameSystems {
+			for _, n := range systems {
+				if ns, ok := n.(*namer.NameStrategy); ok {
+					ns.WithInitialisms(g.Initialisms...)
+				}
+			}
+		}
+	}
+	return report, nil
+}
+
+// execute generates the packages of the 'steps' once, over one parse of
+// the inputs.
+func (g *GeneratorArgs) execute(ctx context.Context, steps []PipelineStep, report *generator.VerifyReport) error {
+	c, err := g.newConfiguredContext(ctx, steps[0].NameSystems, steps[0].DefaultSystem, report)
+	if err != nil {
+		return err
+	}
+	if len(steps) > 1 {
+		// The cache remembers one generator per output package.
+		c.Cache = nil
+	}
+	start := time.Now()
+	var errs generator.Errors
+	for i, step := range steps {
+		stepContext := c
+		if i > 0 {
+			stepContext = c.WithNameSystems(step.NameSystems, step.DefaultSystem)
+		}
+		stepArgs := g
+		if step.Args != nil {
+			stepArgs = step.Args
+		}
+		stepContext.GeneratorName = stepArgs.generatorName()
+		if step.Name != "" {
+			stepContext.GeneratorName = step.Name
+		}
+		// Plugins run once, after the generators.
+		packages, perr := g.packages(stepContext, stepArgs, step.Packages, i == len(steps)-1)
+		if perr != nil {
+			return perr
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		stepErr := stepContext.ExecutePackagesContext(ctx, g.OutputBase, packages)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if stepErr != nil {
+			if step.Name != "" {
+				stepErr = fmt.Errorf("%s: %v", step.Name, stepErr)
+			}
+			errs = append(errs, stepErr)
+			if g.FailFast {
+				break
+			}
+		}
+	}
+	if len(errs) == 1 {
+		err = errs[0]
+	} else if len(errs) > 1 {
+		err = errs
+	}
+	if err == nil && g.Prune {
+		header, perr := g.LoadGoBoilerplate()
+		if perr == nil {
+			_, perr = c.Prune(g.OutputBase, header)
+		}
+		if perr != nil {
+			err = fmt.Errorf("failed pruning: %v", perr)
+		}
+	}
+	if report != nil {
+		if err := report.WriteJSON(os.Stdout); err != nil {
+			return fmt.Errorf("failed writing verify report: %v", err)
+		}
+	}
+	if c.Metrics != nil {
+		c.Metrics.SetExecuteDuration(time.Since(start))
+		if err := g.writeMetrics(c.Metrics); err != nil {
+			return fmt.Errorf("failed writing metrics: %v", err)
+		}
+	}
+	if atomic, ok := c.FS.(*generator.AtomicFileSystem); ok {
+		if err != nil {
+			atomic.Rollback()
+		} else if err := atomic.Commit(); err != nil {
+			return fmt.Errorf("failed writing output: %v", err)
+		}
+	}
+	if err != nil {
 		return fmt.Errorf("failed executing generator: %v", err)
 	}
+	if dryRun, ok := c.FS.(*generator.DryRunFileSystem); ok {
+		if err := dryRun.WritePlan(os.Stdout); err != nil {
+			return fmt.Errorf("failed writing dry run plan: %v", err)
+		}
+	}
+	if c.Cache != nil {
+		if err := c.Cache.Save(); err != nil {
+			return fmt.Errorf("failed saving cache: %v", err)
+		}
+	}
+	if c.Manifest != nil {
+		if err := g.writeManifest(c.Manifest); err != nil {
+			return fmt.Errorf("failed writing manifest: %v", err)
+		}
+	}
 
 	return nil
 }
+
+// writeMetrics writes the metrics in the format of --metrics to
+// --metrics-file, or stderr.
+func (g *GeneratorArgs) writeMetrics(m *generator.Metrics) error {
+	w := io.Writer(os.Stderr)
+	if g.MetricsFile != "" {
+		f, err := os.Create(g.MetricsFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if g.Metrics == "json" {
+		return m.WriteJSON(w)
+	}
+	return m.WriteText(w)
+}
+
+// writeManifest writes the manifest to --manifest.
+func (g *GeneratorArgs) writeManifest(m *generator.Manifest) error {
+	f, err := os.Create(g.Manifest)
+	if err != nil {
+		return err
+	}
+	if err := m.WriteJSON(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// newConfiguredContext loads the inputs into a context configured by the
+// arguments.
+func (g *GeneratorArgs) newConfiguredContext(ctx context.Context, nameSystems namer.NameSystems, defaultSystem string, report *generator.VerifyReport) (*generator.Context, error) {
+	start := time.Now()
+	c, err := g.newContext(ctx, nameSystems, defaultSystem)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed making a context: %v", err)
+	}
+	if g.Metrics != "" {
+		c.Metrics = generator.NewMetrics()
+		c.Metrics.SetParseDuration(time.Since(start))
+	}
+
+	c.Verify = g.VerifyOnly || g.Fix
+	c.StrictVerify = g.VerifyStrict
+	if g.Manifest != "" {
+		c.Manifest = &generator.Manifest{}
+	}
+	c.Fix = g.Fix
+	c.FixBackup = g.FixBackup
+	c.VerifyReport = report
+	c.WorkerCount = g.WorkerCount
+	c.LocalImportPrefix = g.LocalImportPrefix
+	c.OutputDirs = g.OutputDirs
+	if g.OutputMode == OutputModeModule {
+		if c.OutputDirs, err = moduleOutputDirs(c, g.OutputDirs); err != nil {
+			return nil, err
+		}
+	}
+	c.TrimPathPrefix = g.TrimPathPrefix
+	c.StrictTags = g.StrictTags
+	c.FailFast = g.FailFast
+	c.TypeCheck = g.TypeCheck
+	c.GeneratorName = g.generatorName()
+	switch {
+	case g.SkipFormat:
+		c.FileTypes[generator.GolangFileType] = generator.NewUnformattedGolangFile(g.CheckSyntax)
+	case !g.GoImports:
+		c.FileTypes[generator.GolangFileType] = generator.NewGofmtGolangFile()
+	}
+	for _, f := range g.PackageFilters {
+		c.RegisterPackageFilter(f)
+	}
+	for _, f := range g.TypeFilters {
+		c.RegisterTypeFilter(f)
+	}
+	c.FS = g.FS
+	if g.DryRun {
+		base := g.FS
+		if base == nil {
+			base = generator.OSFileSystem{}
+		}
+		c.FS = generator.NewDryRunFileSystem(base)
+	}
+	if g.Atomic {
+		base := g.FS
+		if base == nil {
+			base = generator.OSFileSystem{}
+		}
+		c.FS = generator.NewAtomicFileSystem(base)
+	}
+	// The cache only tracks Go sources, so it is not used for .proto inputs.
+	// Build systems which list the input files cache the output themselves.
+	if g.CacheFile != "" && !g.VerifyOnly && !g.Fix && !g.DryRun && len(g.InputFiles) == 0 && len(g.goInputDirs()) == len(g.InputDirs) {
+		c.Cache = generator.LoadCache(g.cachePath(), generator.ExecutableIdentity())
+		c.Cache.Force = g.Force
+	}
+	return c, nil
+}
+
+// cachePath returns the path of CacheFile, which is relative to OutputBase
+// unless absolute.
+func (g *GeneratorArgs) cachePath() string {
+	if filepath.IsAbs(g.CacheFile) {
+		return g.CacheFile
+	}
+	return filepath.Join(g.OutputBase, g.CacheFile)
+}
+
+// moduleOutputDirs returns 'outputDirs' with the root directory of the
+// module of every input package of 'c' added, under the module path.
+// Entries already in 'outputDirs' take precedence.
+func moduleOutputDirs(c *generator.Context, outputDirs map[string]string) (map[string]string, error) {
+	dirs := map[string]string{}
+	for _, input := range c.Inputs {
+		pkg := c.Universe.Package(input)
+		if pkg.SourcePath == "" {
+			continue
+		}
+		modulePath, moduleDir, err := findModule(pkg.SourcePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed finding the module of %q: %v", input, err)
+		}
+		if modulePath == "" {
+			return nil, fmt.Errorf("input package %q is not in a module, as --output-mode=%s requires", input, OutputModeModule)
+		}
+		dirs[modulePath] = moduleDir
+	}
+	for prefix, dir := range outputDirs {
+		dirs[prefix] = dir
+	}
+	return dirs, nil
+}
+
+// packages returns the packages to generate: those the generator 'pkgs'
+// returns given 'args', and, if 'withPlugins', those of any plugins.
+func (g *GeneratorArgs) packages(c *generator.Context, args *GeneratorArgs, pkgs func(*generator.Context, *GeneratorArgs) generator.Packages, withPlugins bool) (generator.Packages, error) {
+	packages := pkgs(c, args)
+	if err := args.applyPackageHeaders(packages); err != nil {
+		return nil, err
+	}
+	if !withPlugins {
+		return packages, nil
+	}
+	plugins := generator.Packages{}
+	for _, path := range g.Plugins {
+		pluginPackages, err := LoadPlugin(path)
+		if err != nil {
+			return nil, err
+		}
+		plugins = append(plugins, pluginPackages(c, g)...)
+	}
+	if len(g.ExecPlugins) > 0 {
+		header, err := g.LoadGoBoilerplate()
+		if err != nil {
+			return nil, fmt.Errorf("failed loading boilerplate: %v", err)
+		}
+		for _, spec := range g.ExecPlugins {
+			pluginPackages, err := plugin.Packages(c, plugin.Spec(spec), header)
+			if err != nil {
+				return nil, err
+			}
+			plugins = append(plugins, pluginPackages...)
+		}
+	}
+	if err := g.applyPackageHeaders(plugins); err != nil {
+		return nil, err
+	}
+	return append(packages, plugins...), nil
+}
+
+func validBuildConstraintStyle(style string) bool {
+	for _, s := range generator.BuildConstraintStyles {
+		if style == string(s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,245 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package args
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	ccli "github.com/lack-io/cli"
+)
+
+// customFlag is a field of custom arguments bound to a flag.
+type customFlag struct {
+	name  string
+	field reflect.Value
+}
+
+// RegisterCustomArgs sets 'customArgs', a pointer to a struct, as the
+// CustomArgs of the generator, binds its fields to flags of 'app' with
+// AddCustomFlags, and adds a --config flag naming a JSON file with values
+// for them, keyed by flag name. Flags given on the command line take
+// precedence over the file.
+func (g *GeneratorArgs) RegisterCustomArgs(app *ccli.App, customArgs interface{}) error {
+	flags, err := addCustomFlags(app, customArgs)
+	if err != nil {
+		return err
+	}
+	g.CustomArgs = customArgs
+
+	app.StringVarP(&g.ConfigFile, "config", "", g.ConfigFile,
+		"JSON file with values of the generator's own flags, keyed by flag name. Flags on the command line take precedence.", "")
+	before := app.Before
+	app.Before = func(ctx *ccli.Context) error {
+		if before != nil {
+			if err := before(ctx); err != nil {
+				return err
+			}
+		}
+		if g.ConfigFile == "" {
+			return nil
+		}
+		return loadCustomConfig(g.ConfigFile, flags, ctx.IsSet)
+	}
+	return nil
+}
+
+// AddCustomFlags binds the fields of the struct 'customArgs' points to
+// which have a `flag` tag to flags of 'app'. The tag is the flag name, and
+// the optional `alias`, `usage`, `default` and `env` tags tune the flag as
+// the parameters of the same name of flag-gen do: without a default, the
+// current value of the field is. Defaults of slices separate their items
+// with "|".
+//
+// Fields may be strings, bools, integers, float64s, time.Durations, slices
+// of strings, ints, int64s or float64s, or types defined on them.
+func AddCustomFlags(app *ccli.App, customArgs interface{}) error {
+	_, err := addCustomFlags(app, customArgs)
+	return err
+}
+
+func addCustomFlags(app *ccli.App, customArgs interface{}) ([]customFlag, error) {
+	v := reflect.ValueOf(customArgs)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("custom arguments must be a pointer to a struct, not %T", customArgs)
+	}
+	v = v.Elem()
+	t := v.Type()
+
+	flags := []customFlag{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, ok := f.Tag.Lookup("flag")
+		if !ok || name == "-" {
+			continue
+		}
+		if f.PkgPath != "" {
+			return nil, fmt.Errorf("%v.%s: flags can't be bound to unexported fields", t, f.Name)
+		}
+		field := v.Field(i)
+		if def, ok := f.Tag.Lookup("default"); ok {
+			if err := setCustomValue(field, def); err != nil {
+				return nil, fmt.Errorf("%v.%s: invalid default %q: %v", t, f.Name, def, err)
+			}
+		}
+		alias, usage, env := f.Tag.Get("alias"), f.Tag.Get("usage"), f.Tag.Get("env")
+		if err := bindCustomFlag(app, field, name, alias, usage, env); err != nil {
+			return nil, fmt.Errorf("%v.%s: %v", t, f.Name, err)
+		}
+		flags = append(flags, customFlag{name: name, field: field})
+	}
+	return flags, nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// bindCustomFlag binds the addressable value 'field' to the flag 'name'.
+// Defined types are bound through a pointer to their underlying type.
+func bindCustomFlag(app *ccli.App, field reflect.Value, name, alias, usage, env string) error {
+	ptr := func(p interface{}) reflect.Value {
+		return field.Addr().Convert(reflect.TypeOf(p))
+	}
+	switch {
+	case field.Type() == durationType:
+		app.DurationVarP(field.Addr().Interface().(*time.Duration), name, alias, time.Duration(field.Int()), usage, env)
+	case field.Kind() == reflect.String:
+		app.StringVarP(ptr((*string)(nil)).Interface().(*string), name, alias, field.String(), usage, env)
+	case field.Kind() == reflect.Bool:
+		app.BoolVarP(ptr((*bool)(nil)).Interface().(*bool), name, alias, field.Bool(), usage, env)
+	case field.Kind() == reflect.Int:
+		app.IntVarP(ptr((*int)(nil)).Interface().(*int), name, alias, int(field.Int()), usage, env)
+	case field.Kind() == reflect.Int64:
+		app.Int64VarP(ptr((*int64)(nil)).Interface().(*int64), name, alias, field.Int(), usage, env)
+	case field.Kind() == reflect.Uint:
+		app.UintVarP(ptr((*uint)(nil)).Interface().(*uint), name, alias, uint(field.Uint()), usage, env)
+	case field.Kind() == reflect.Uint64:
+		app.Uint64VarP(ptr((*uint64)(nil)).Interface().(*uint64), name, alias, field.Uint(), usage, env)
+	case field.Kind() == reflect.Float64:
+		app.Float64VarP(ptr((*float64)(nil)).Interface().(*float64), name, alias, field.Float(), usage, env)
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+		p := ptr((*[]string)(nil)).Interface().(*[]string)
+		app.StringSliceVarP(p, name, alias, *p, usage, env)
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Int:
+		p := ptr((*[]int)(nil)).Interface().(*[]int)
+		app.IntSliceVarP(p, name, alias, *p, usage, env)
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Int64:
+		p := ptr((*[]int64)(nil)).Interface().(*[]int64)
+		app.Int64SliceVarP(p, name, alias, *p, usage, env)
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Float64:
+		p := ptr((*[]float64)(nil)).Interface().(*[]float64)
+		app.Float64SliceVarP(p, name, alias, *p, usage, env)
+	default:
+		return fmt.Errorf("flags of type %v are not supported", field.Type())
+	}
+	return nil
+}
+
+// setCustomValue sets 'field' to the default 'value'.
+func setCustomValue(field reflect.Value, value string) error {
+	if field.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		i, err := strconv.ParseInt(value, 0, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(i)
+	case reflect.Uint, reflect.Uint64:
+		u, err := strconv.ParseUint(value, 0, 64)
+		if err != nil {
+			return err
+		}
+		field.SetUint(u)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		items := reflect.MakeSlice(field.Type(), 0, 0)
+		if len(value) > 0 {
+			for _, item := range strings.Split(value, "|") {
+				elem := reflect.New(field.Type().Elem()).Elem()
+				if err := setCustomValue(elem, item); err != nil {
+					return err
+				}
+				items = reflect.Append(items, elem)
+			}
+		}
+		field.Set(items)
+	default:
+		return fmt.Errorf("flags of type %v are not supported", field.Type())
+	}
+	return nil
+}
+
+// loadCustomConfig sets the fields of the 'flags' which 'isSet' reports as
+// not set on the command line from the JSON file 'path'. Durations may be
+// given as strings, such as "1m30s".
+func loadCustomConfig(path string, flags []customFlag, isSet func(name string) bool) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed reading config: %v", err)
+	}
+	values := map[string]json.RawMessage{}
+	if err := json.Unmarshal(b, &values); err != nil {
+		return fmt.Errorf("failed parsing config %s: %v", path, err)
+	}
+	byName := map[string]reflect.Value{}
+	for _, f := range flags {
+		byName[f.name] = f.field
+	}
+	for key, raw := range values {
+		field, ok := byName[key]
+		if !ok {
+			return fmt.Errorf("config %s: unknown key %q", path, key)
+		}
+		if isSet(key) {
+			continue
+		}
+		var s string
+		if field.Type() == durationType && json.Unmarshal(raw, &s) == nil {
+			if err := setCustomValue(field, s); err != nil {
+				return fmt.Errorf("config %s: invalid %q: %v", path, key, err)
+			}
+			continue
+		}
+		if err := json.Unmarshal(raw, field.Addr().Interface()); err != nil {
+			return fmt.Errorf("config %s: invalid %q: %v", path, key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package args
+
+import (
+	"fmt"
+	"strings"
+)
+
+// packageFiles are the files of a package given by --input-files or
+// --dependency-files.
+type packageFiles struct {
+	pkgPath string
+	files   []string
+}
+
+// parseFileList groups entries of the form "import/path=path/to/file.go" by
+// package, in the order the packages first appear.
+func parseFileList(entries []string) ([]packageFiles, error) {
+	var pkgs []packageFiles
+	index := map[string]int{}
+	for _, entry := range entries {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || !strings.HasSuffix(parts[1], ".go") {
+			return nil, fmt.Errorf("invalid file %q, expected \"import/path=path/to/file.go\"", entry)
+		}
+		i, ok := index[parts[0]]
+		if !ok {
+			i = len(pkgs)
+			index[parts[0]] = i
+			pkgs = append(pkgs, packageFiles{pkgPath: parts[0]})
+		}
+		pkgs[i].files = append(pkgs[i].files, parts[1])
+	}
+	return pkgs, nil
+}
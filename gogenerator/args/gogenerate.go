@@ -0,0 +1,116 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package args
+
+import (
+	"bufio"
+	"fmt"
+	"go/build"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/lack-io/gogogen/util/log"
+)
+
+// InvokedByGoGenerate returns true if the generator runs from a
+// //go:generate directive, which sets $GOFILE and $GOPACKAGE.
+func InvokedByGoGenerate() bool {
+	return os.Getenv("GOFILE") != "" && os.Getenv("GOPACKAGE") != ""
+}
+
+// applyGoGenerate configures the arguments to generate the package in the
+// working directory in place, as a //go:generate directive without
+// --input-dirs expects. It returns the directory of the module holding the
+// package, and the module path, to write output packages in the module to.
+// Outside of a module, the module path and directory are those of the
+// package.
+func (g *GeneratorArgs) applyGoGenerate() (modulePath, moduleDir string, err error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", "", err
+	}
+	pkgPath := ""
+	modulePath, moduleDir, err = findModule(wd)
+	if err != nil {
+		return "", "", err
+	}
+	if modulePath != "" {
+		rel, err := filepath.Rel(moduleDir, wd)
+		if err != nil {
+			return "", "", err
+		}
+		pkgPath = path.Join(modulePath, filepath.ToSlash(rel))
+	} else {
+		pkg, err := build.ImportDir(wd, build.FindOnly)
+		if err != nil {
+			return "", "", err
+		}
+		if pkg.ImportPath == "" || build.IsLocalImport(pkg.ImportPath) || strings.HasPrefix(pkg.ImportPath, "_") {
+			return "", "", fmt.Errorf("unable to find the import path of %q: it is outside of both a module and $GOPATH", wd)
+		}
+		pkgPath, modulePath, moduleDir = pkg.ImportPath, pkg.ImportPath, wd
+	}
+
+	g.InputDirs = []string{pkgPath}
+	if g.OutputPackagePath == "" {
+		g.OutputPackagePath = pkgPath
+	}
+	// The cache would be left in every package directory.
+	g.CacheFile = ""
+	// The default boilerplate is relative to $GOPATH, which is rarely set up
+	// for it.
+	if _, err := os.Stat(g.GoHeaderFilePath); os.IsNotExist(err) {
+		log.Infof("No boilerplate at %q, generating without it", g.GoHeaderFilePath)
+		g.GoHeaderFilePath = ""
+	}
+	return modulePath, moduleDir, nil
+}
+
+// findModule returns the path and directory of the module holding 'dir', or
+// empty strings if there is none.
+func findModule(dir string) (modulePath, moduleDir string, err error) {
+	for {
+		f, err := os.Open(filepath.Join(dir, "go.mod"))
+		if err == nil {
+			defer f.Close()
+			scanner := bufio.NewScanner(f)
+			for scanner.Scan() {
+				fields := strings.Fields(scanner.Text())
+				if len(fields) >= 2 && fields[0] == "module" {
+					p := fields[1]
+					if unquoted, err := strconv.Unquote(p); err == nil {
+						p = unquoted
+					}
+					return p, dir, nil
+				}
+			}
+			if err := scanner.Err(); err != nil {
+				return "", "", err
+			}
+			return "", "", fmt.Errorf("%s has no module directive", f.Name())
+		}
+		if !os.IsNotExist(err) {
+			return "", "", err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", "", nil
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package args
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lack-io/gogogen/gogenerator/generator"
+)
+
+// HeaderProvider computes the copyright header text of generated Go files
+// per output package, so that packages of different modules can carry
+// different licenses.
+type HeaderProvider interface {
+	// GoHeader returns the copyright header text, including comment
+	// markers, for the output package with the import path 'pkgPath'. Any
+	// "YEAR" is replaced with the current year, and the "Code generated by"
+	// comment is appended, as for --go-header-file.
+	GoHeader(pkgPath string) ([]byte, error)
+}
+
+// HeaderProviderFunc adapts a function to a HeaderProvider.
+type HeaderProviderFunc func(pkgPath string) ([]byte, error)
+
+func (f HeaderProviderFunc) GoHeader(pkgPath string) ([]byte, error) { return f(pkgPath) }
+
+// headerVariables returns the replacer of the variables in the boilerplate
+// and the "Code generated by" comment for the output package 'pkgPath':
+//
+//	YEAR               the current year, or HeaderYear
+//	GENERATOR_NAME     the name of the generator, see GeneratorName
+//	GENERATOR_VERSION  the version of the generator, see GeneratorVersion
+//	GIT_COMMIT         the commit of the input, see GitCommit
+//	PACKAGE            the import path of the output package
+//
+// PACKAGE is left as is if 'pkgPath' is empty.
+func (g *GeneratorArgs) headerVariables(pkgPath string) *strings.Replacer {
+	year := g.HeaderYear
+	if year == 0 {
+		year = time.Now().UTC().Year()
+	}
+	name := g.generatorName()
+	version, commit := g.GeneratorVersion, g.GitCommit
+	if version == "" {
+		if info, ok := debug.ReadBuildInfo(); ok {
+			version = info.Main.Version
+		}
+	}
+	if g.Reproducible {
+		version, commit = "", ""
+	}
+	vars := []string{
+		"YEAR", strconv.Itoa(year),
+		"GENERATOR_NAME", name,
+		"GENERATOR_VERSION", version,
+		"GIT_COMMIT", commit,
+	}
+	if pkgPath != "" {
+		vars = append(vars, "PACKAGE", pkgPath)
+	}
+	return strings.NewReplacer(vars...)
+}
+
+// applyPackageHeaders replaces the default boilerplate of the packages with
+// the one for each package, if it may differ: when HeaderProvider is set,
+// or the boilerplate refers to PACKAGE. Generators build their header
+// once from LoadGoBoilerplate, optionally after GeneratedBuildConstraint;
+// packages with any other header are left alone.
+func (g *GeneratorArgs) applyPackageHeaders(packages generator.Packages) error {
+	boilerplate, err := g.LoadGoBoilerplate()
+	if err != nil {
+		return fmt.Errorf("failed loading boilerplate: %v", err)
+	}
+	if g.HeaderProvider == nil && !bytes.Contains(boilerplate, []byte("PACKAGE")) {
+		return nil
+	}
+	constraint := g.GeneratedBuildConstraint()
+	for _, p := range packages {
+		d, ok := p.(*generator.DefaultPackage)
+		if !ok {
+			continue
+		}
+		var prefix []byte
+		switch {
+		case bytes.Equal(d.HeaderText, boilerplate):
+		case bytes.Equal(d.HeaderText, append(constraint[:len(constraint):len(constraint)], boilerplate...)):
+			prefix = constraint
+		default:
+			continue
+		}
+		b, err := g.LoadGoBoilerplateFor(d.PackagePath)
+		if err != nil {
+			return err
+		}
+		d.HeaderText = append(append([]byte(nil), prefix...), b...)
+	}
+	return nil
+}
+
+// generatorName returns GeneratorName, or the name of the binary if it is
+// empty.
+func (g *GeneratorArgs) generatorName() string {
+	if g.GeneratorName != "" {
+		return g.GeneratorName
+	}
+	return path.Base(os.Args[0])
+}
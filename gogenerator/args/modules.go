@@ -0,0 +1,98 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package args
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/lack-io/gogogen/util/log"
+)
+
+// splitVersion splits an --input-dirs entry such as
+// "example.com/api/...@v1.2.3" into the package path or pattern and the
+// version. Entries without a version return an empty one.
+func splitVersion(d string) (pattern, version string) {
+	if i := strings.LastIndex(d, "@"); i > 0 && !isProtoInput(d) {
+		return d[:i], d[i+1:]
+	}
+	return d, ""
+}
+
+// resolveVersionedInputs replaces the --input-dirs entries with versions
+// with their package paths, and returns the directory of a module which
+// requires those versions, to resolve the packages in. The versions are
+// downloaded through the module proxy, or taken from the module cache. If
+// no entry has a version, it returns "".
+func (g *GeneratorArgs) resolveVersionedInputs() (string, error) {
+	var versioned, local []string
+	for _, d := range g.InputDirs {
+		if _, version := splitVersion(d); version != "" {
+			versioned = append(versioned, d)
+		} else if !isProtoInput(d) {
+			local = append(local, d)
+		}
+	}
+	if len(versioned) == 0 {
+		return "", nil
+	}
+	if len(local) > 0 {
+		return "", fmt.Errorf("inputs with a version, such as %q, can't be mixed with local packages, such as %q", versioned[0], local[0])
+	}
+
+	// The module is kept between runs, so that the same versions are only
+	// resolved once.
+	sorted := append([]string(nil), versioned...)
+	sort.Strings(sorted)
+	sum := sha256.Sum256([]byte(strings.Join(sorted, "\n")))
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		cacheDir = os.TempDir()
+	}
+	dir := filepath.Join(cacheDir, "gogenerator", "inputs", hex.EncodeToString(sum[:8]))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	goMod := filepath.Join(dir, "go.mod")
+	if _, err := os.Stat(goMod); os.IsNotExist(err) {
+		if err := ioutil.WriteFile(goMod, []byte("module gogenerator.local/inputs\n"), 0644); err != nil {
+			return "", err
+		}
+	}
+
+	log.Infof("Resolving %s in %s", strings.Join(sorted, ", "), dir)
+	cmd := exec.Command("go", append([]string{"get"}, sorted...)...)
+	cmd.Dir = dir
+	// The module has no vendor directory, whatever the caller's is.
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod")
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("unable to resolve %s: %v: %s", strings.Join(sorted, ", "), err, strings.TrimSpace(stderr.String()))
+	}
+
+	for i, d := range g.InputDirs {
+		g.InputDirs[i], _ = splitVersion(d)
+	}
+	return dir, nil
+}
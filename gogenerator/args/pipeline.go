@@ -0,0 +1,127 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package args
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/namer"
+)
+
+// PipelineStep is one of the generators ExecutePipeline runs.
+type PipelineStep struct {
+	// Optional; names the step in errors and in the After of other steps.
+	Name string
+
+	// Optional; the names of the steps this one runs after, such as those
+	// whose output it builds on.
+	After []string
+
+	NameSystems   namer.NameSystems
+	DefaultSystem string
+	Packages      func(*generator.Context, *GeneratorArgs) generator.Packages
+
+	// Optional; the arguments Packages is passed, such as with the
+	// generator's CustomArgs and OutputFileBaseName. Which packages are
+	// parsed, and where and how the output is written, are up to the
+	// arguments ExecutePipeline is called on, which are the default.
+	Args *GeneratorArgs
+}
+
+// ExecutePipeline is like ExecuteContext, but runs the generators of all of
+// the 'steps' over one parse of the inputs, sharing the universe and the
+// imported packages. Steps run in the order given, except that a step runs
+// after those named in its After. The cache is not used, as it remembers a
+// single generator per output package, and --serve is not supported.
+func (g *GeneratorArgs) ExecutePipeline(ctx context.Context, steps []PipelineStep) error {
+	if len(steps) == 0 {
+		return fmt.Errorf("no pipeline steps")
+	}
+	ordered, err := orderSteps(steps)
+	if err != nil {
+		return err
+	}
+	nameSystems := []namer.NameSystems{}
+	for _, step := range ordered {
+		nameSystems = append(nameSystems, step.NameSystems)
+	}
+	report, err := g.prepare(nameSystems...)
+	if err != nil {
+		return err
+	}
+	if g.Serve != "" {
+		return fmt.Errorf("--serve can't be used with a pipeline of generators")
+	}
+	if g.Watch {
+		return g.watch(ctx, func() error {
+			return g.execute(ctx, ordered, report)
+		})
+	}
+	return g.execute(ctx, ordered, report)
+}
+
+// orderSteps returns the steps ordered so that every step comes after those
+// named in its After, and otherwise in the order given.
+func orderSteps(steps []PipelineStep) ([]PipelineStep, error) {
+	byName := map[string]int{}
+	for i, step := range steps {
+		if step.Name == "" {
+			continue
+		}
+		if _, ok := byName[step.Name]; ok {
+			return nil, fmt.Errorf("duplicate pipeline step %q", step.Name)
+		}
+		byName[step.Name] = i
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]int, len(steps))
+	ordered := make([]PipelineStep, 0, len(steps))
+	var visit func(i int, path []string) error
+	visit = func(i int, path []string) error {
+		switch state[i] {
+		case done:
+			return nil
+		case visiting:
+			return fmt.Errorf("pipeline steps depend on each other: %s", strings.Join(append(path, steps[i].Name), " -> "))
+		}
+		state[i] = visiting
+		for _, name := range steps[i].After {
+			j, ok := byName[name]
+			if !ok {
+				return fmt.Errorf("pipeline step %q runs after unknown step %q", steps[i].Name, name)
+			}
+			if err := visit(j, append(path, steps[i].Name)); err != nil {
+				return err
+			}
+		}
+		state[i] = done
+		ordered = append(ordered, steps[i])
+		return nil
+	}
+	for i := range steps {
+		if err := visit(i, nil); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
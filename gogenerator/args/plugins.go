@@ -0,0 +1,53 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package args
+
+import (
+	"fmt"
+	goplugin "plugin"
+
+	"github.com/lack-io/gogogen/gogenerator/generator"
+)
+
+// PluginSymbol is the name of the symbol a Go plugin must export to be loaded
+// with LoadPlugin. It must be a PackagesFunc, or a variable of that type.
+const PluginSymbol = "Packages"
+
+// PackagesFunc returns the packages to generate. It is the signature of the
+// function passed to Execute.
+type PackagesFunc func(*generator.Context, *GeneratorArgs) generator.Packages
+
+// LoadPlugin opens the Go plugin at 'path' and returns its exported
+// PluginSymbol. The plugin must be built against the same version of this
+// module as the running binary.
+func LoadPlugin(path string) (PackagesFunc, error) {
+	p, err := goplugin.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open plugin %q: %v", path, err)
+	}
+	sym, err := p.Lookup(PluginSymbol)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %q: %v", path, err)
+	}
+	switch f := sym.(type) {
+	case func(*generator.Context, *GeneratorArgs) generator.Packages:
+		return f, nil
+	case *func(*generator.Context, *GeneratorArgs) generator.Packages:
+		return *f, nil
+	case *PackagesFunc:
+		return *f, nil
+	}
+	return nil, fmt.Errorf("plugin %q: symbol %s has type %T, expected func(*generator.Context, *args.GeneratorArgs) generator.Packages", path, PluginSymbol, sym)
+}
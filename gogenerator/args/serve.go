@@ -0,0 +1,176 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package args
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"sync"
+
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/namer"
+	"github.com/lack-io/gogogen/util/log"
+)
+
+// GenerateRequest asks a generator serving with --serve to generate
+// packages. It is sent as the parameter of the JSON-RPC 1.0 method
+// "Generator.Generate".
+type GenerateRequest struct {
+	// The import paths of the output packages to generate. If empty, every
+	// package is generated.
+	Packages []string
+}
+
+// GenerateResponse is the result of a GenerateRequest.
+type GenerateResponse struct {
+	// The import paths of the packages generated.
+	Generated []string
+	// True if the inputs had changed since the previous request, and were
+	// loaded again.
+	Reloaded bool
+}
+
+// generateService serves generation requests from inputs loaded once, and
+// loaded again only once they change.
+type generateService struct {
+	ctx           context.Context
+	args          *GeneratorArgs
+	nameSystems   namer.NameSystems
+	defaultSystem string
+	pkgs          func(*generator.Context, *GeneratorArgs) generator.Packages
+
+	lock    sync.Mutex
+	context *generator.Context
+	inputs  inputSnapshot
+}
+
+// load loads the inputs into a new context.
+func (s *generateService) load() error {
+	inputs := s.args.snapshotInputs()
+	c, err := s.args.newConfiguredContext(s.ctx, s.nameSystems, s.defaultSystem, nil)
+	if err != nil {
+		return err
+	}
+	s.context, s.inputs = c, inputs
+	return nil
+}
+
+// Generate generates the requested packages.
+func (s *generateService) Generate(req GenerateRequest, resp *GenerateResponse) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.context == nil || len(s.inputs.changed(s.args.snapshotInputs())) > 0 {
+		log.Infof("Loading the inputs again")
+		if err := s.load(); err != nil {
+			s.context = nil
+			return err
+		}
+		resp.Reloaded = true
+	}
+
+	packages, err := s.args.packages(s.context, s.args, s.pkgs, true)
+	if err != nil {
+		return err
+	}
+	if len(req.Packages) > 0 {
+		requested := map[string]bool{}
+		for _, p := range req.Packages {
+			requested[p] = true
+		}
+		selected := generator.Packages{}
+		for _, p := range packages {
+			if requested[p.Path()] {
+				selected = append(selected, p)
+			}
+		}
+		packages = selected
+	}
+	err = s.context.ExecutePackagesContext(s.ctx, s.args.OutputBase, packages)
+	if atomic, ok := s.context.FS.(*generator.AtomicFileSystem); ok {
+		if err != nil {
+			atomic.Rollback()
+		} else {
+			err = atomic.Commit()
+		}
+		if err != nil && s.context.Cache != nil {
+			// Forget the packages recorded by this request, whose output
+			// was never written.
+			force := s.context.Cache.Force
+			s.context.Cache = generator.LoadCache(s.args.cachePath(), s.context.Cache.Identity)
+			s.context.Cache.Force = force
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if s.context.Cache != nil {
+		if err := s.context.Cache.Save(); err != nil {
+			return fmt.Errorf("failed saving cache: %v", err)
+		}
+	}
+	resp.Generated = []string{}
+	for _, p := range packages {
+		resp.Generated = append(resp.Generated, p.Path())
+	}
+	return nil
+}
+
+// serve loads the inputs, then serves generation requests on the unix socket
+// at g.Serve until ctx is done.
+func (g *GeneratorArgs) serve(ctx context.Context, nameSystems namer.NameSystems, defaultSystem string, pkgs func(*generator.Context, *GeneratorArgs) generator.Packages) error {
+	s := &generateService{
+		ctx:           ctx,
+		args:          g,
+		nameSystems:   nameSystems,
+		defaultSystem: defaultSystem,
+		pkgs:          pkgs,
+	}
+	if err := s.load(); err != nil {
+		return err
+	}
+	server := rpc.NewServer()
+	if err := server.RegisterName("Generator", s); err != nil {
+		return err
+	}
+
+	// Replace the socket of a previous server which didn't shut down.
+	if info, err := os.Stat(g.Serve); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(g.Serve)
+	}
+	ln, err := net.Listen("unix", g.Serve)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(g.Serve)
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+	log.Infof("Serving generation requests on %q", g.Serve)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		go server.ServeCodec(jsonrpc.NewServerCodec(conn))
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package args
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	ccli "github.com/lack-io/cli"
+
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/namer"
+)
+
+// Subcommand is a generator run as a subcommand of a binary bundling
+// several of them, as in "gogogen deepcopy -i ...".
+type Subcommand struct {
+	// The name of the subcommand, and a one-line description of it.
+	Name  string
+	Usage string
+
+	// The arguments of the generator, such as from its NewDefaults. Their
+	// flags are added to those of the subcommand.
+	Args *GeneratorArgs
+
+	// Optional; adds the generator's own flags, e.g. with
+	// RegisterCustomArgs.
+	AddFlags func(app *ccli.App) error
+
+	// Optional; checks the arguments once the flags are parsed.
+	Validate func(*GeneratorArgs) error
+
+	NameSystems   namer.NameSystems
+	DefaultSystem string
+	Packages      func(*generator.Context, *GeneratorArgs) generator.Packages
+}
+
+// RunSubcommands implements main() of the binary 'name' bundling the
+// generators 'subcommands': it runs the one named by the first of the
+// command line 'arguments', which start with the binary, with the rest.
+func RunSubcommands(ctx context.Context, name string, subcommands []Subcommand, arguments []string) error {
+	if len(arguments) < 2 {
+		printSubcommands(os.Stderr, name, subcommands)
+		return fmt.Errorf("no generator given")
+	}
+	switch arguments[1] {
+	case "-h", "--help", "help":
+		printSubcommands(os.Stdout, name, subcommands)
+		return nil
+	}
+
+	for i := range subcommands {
+		sc := &subcommands[i]
+		if sc.Name != arguments[1] {
+			continue
+		}
+		app := ccli.NewApp()
+		app.Name = name + " " + sc.Name
+		app.Usage = sc.Usage
+		app.CustomAppHelpTemplate = ccli.CommandLineHelpTemplate
+		app.HideVersion = true
+
+		// The flags are parsed by the subcommand, not by Execute.
+		g := sc.Args
+		g.defaultCommandLineFlags = false
+		g.AddFlags(app)
+		if sc.AddFlags != nil {
+			if err := sc.AddFlags(app); err != nil {
+				return err
+			}
+		}
+		app.Action = func(c *ccli.Context) error {
+			if sc.Validate != nil {
+				if err := sc.Validate(g); err != nil {
+					return err
+				}
+			}
+			return g.ExecuteContext(ctx, sc.NameSystems, sc.DefaultSystem, sc.Packages)
+		}
+		return app.RunContext(ctx, arguments[1:])
+	}
+
+	printSubcommands(os.Stderr, name, subcommands)
+	return fmt.Errorf("unknown generator %q", arguments[1])
+}
+
+func printSubcommands(w io.Writer, name string, subcommands []Subcommand) {
+	fmt.Fprintf(w, "Usage: %s <generator> [flags]\n\nGenerators:\n", name)
+	width := 0
+	for _, sc := range subcommands {
+		if len(sc.Name) > width {
+			width = len(sc.Name)
+		}
+	}
+	for _, sc := range subcommands {
+		fmt.Fprintf(w, "  %-*s  %s\n", width, sc.Name, sc.Usage)
+	}
+	fmt.Fprintf(w, "\nRun \"%s <generator> --help\" for the flags of a generator.\n", name)
+}
@@ -0,0 +1,122 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package args
+
+import (
+	"context"
+	"go/build"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lack-io/gogogen/util/log"
+)
+
+// fileStamp is what is compared to tell whether a file changed.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// inputSnapshot maps the paths of the input files to their stamps.
+type inputSnapshot map[string]fileStamp
+
+// changed returns the files added, removed or modified in 'next', sorted.
+func (s inputSnapshot) changed(next inputSnapshot) []string {
+	files := []string{}
+	for path, stamp := range next {
+		if prev, ok := s[path]; !ok || prev != stamp {
+			files = append(files, path)
+		}
+	}
+	for path := range s {
+		if _, ok := next[path]; !ok {
+			files = append(files, path)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// watch calls 'run', then polls the inputs and calls it again whenever they
+// change, until ctx is done. Errors from 'run' are logged rather than
+// returned, so that fixing the inputs resumes generation. Packages whose
+// inputs are unchanged are skipped by the cache, if it is enabled.
+func (g *GeneratorArgs) watch(ctx context.Context, run func() error) error {
+	for {
+		if err := run(); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Errorf("%v", err)
+		}
+		// Taken after the run, so that output written among the inputs
+		// doesn't trigger another one.
+		last := g.snapshotInputs()
+		log.Infof("Watching %d input files for changes", len(last))
+	poll:
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(g.WatchInterval):
+			}
+			if changed := last.changed(g.snapshotInputs()); len(changed) > 0 {
+				log.Infof("Generating again, changed: %s", strings.Join(changed, ", "))
+				break poll
+			}
+		}
+	}
+}
+
+// snapshotInputs stamps the Go files of the input directories, and the
+// .proto input files. Inputs which can't be found are skipped.
+func (g *GeneratorArgs) snapshotInputs() inputSnapshot {
+	s := inputSnapshot{}
+	for _, in := range g.InputDirs {
+		if isProtoInput(in) {
+			s.add(in)
+			continue
+		}
+		recursive := strings.HasSuffix(in, "/...")
+		pkg, err := build.Import(strings.TrimSuffix(in, "/..."), ".", build.FindOnly)
+		if err != nil {
+			log.Debugf("Not watching %q: %v", in, err)
+			continue
+		}
+		if !recursive {
+			matches, _ := filepath.Glob(filepath.Join(pkg.Dir, "*.go"))
+			for _, m := range matches {
+				s.add(m)
+			}
+			continue
+		}
+		filepath.Walk(pkg.Dir, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() && strings.HasSuffix(path, ".go") {
+				s.add(path)
+			}
+			return nil
+		})
+	}
+	return s
+}
+
+func (s inputSnapshot) add(path string) {
+	if info, err := os.Stat(path); err == nil {
+		s[path] = fileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io"
+	"runtime"
+
+	"github.com/lack-io/gogogen/gogenerator/types"
+)
+
+// astPrinter prints nodes the way gofmt does.
+var astPrinter = printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+
+// ASTWriter is an alternative to SnippetWriter for generators which would
+// rather build go/ast nodes than concatenate templates. Everything it writes
+// is printed by go/printer, so it is syntactically valid and already
+// formatted; such generators may use NewUnformattedGolangFile to skip gofmt.
+// Like SnippetWriter, methods are chainable, and you don't have to check
+// Error() until you're all done.
+//
+// Example:
+//
+// aw := generator.NewASTWriter(w, c)
+//
+//	aw.Decl(&ast.FuncDecl{
+//		Name: ast.NewIdent("New" + t.Name.Name),
+//		Type: &ast.FuncType{
+//			Results: &ast.FieldList{List: []*ast.Field{{Type: &ast.StarExpr{X: aw.Type(t)}}}},
+//		},
+//		Body: &ast.BlockStmt{List: []ast.Stmt{
+//			&ast.ReturnStmt{Results: []ast.Expr{aw.Expr("new($.|raw$)", t)}},
+//		}},
+//	})
+//
+// return aw.Error()
+type ASTWriter struct {
+	w       io.Writer
+	context *Context
+	err     error
+}
+
+// NewASTWriter returns an ASTWriter writing to w. Types are named by the
+// "raw" naming system of c, so that their packages are imported.
+func NewASTWriter(w io.Writer, c *Context) *ASTWriter {
+	return &ASTWriter{w: w, context: c}
+}
+
+// Decl prints each declaration, followed by an empty line. Decl is
+// chainable and does nothing after an error.
+func (a *ASTWriter) Decl(decls ...ast.Decl) *ASTWriter {
+	for _, decl := range decls {
+		a.node(decl)
+		if a.err == nil {
+			_, a.err = io.WriteString(a.w, "\n\n")
+		}
+	}
+	return a
+}
+
+// Stmt prints each statement on its own line, for generators which write
+// the body of a declaration with SnippetWriter. Stmt is chainable and does
+// nothing after an error.
+func (a *ASTWriter) Stmt(stmts ...ast.Stmt) *ASTWriter {
+	for _, stmt := range stmts {
+		a.node(stmt)
+		if a.err == nil {
+			_, a.err = io.WriteString(a.w, "\n")
+		}
+	}
+	return a
+}
+
+func (a *ASTWriter) node(node ast.Node) {
+	if a.err != nil {
+		return
+	}
+	if err := astPrinter.Fprint(a.w, token.NewFileSet(), node); err != nil {
+		_, file, line, _ := runtime.Caller(2)
+		a.err = fmt.Errorf("%s:%d: %v", file, line, err)
+	}
+}
+
+// Type returns the expression naming t, as the "raw" naming system of the
+// Context names it. After an error it returns a placeholder, so that it can
+// be used inline while building a node.
+func (a *ASTWriter) Type(t *types.Type) ast.Expr {
+	return a.expr("$.|raw$", t)
+}
+
+// Expr renders format with args, like SnippetWriter.Do with "$" delimiters,
+// and parses the result as an expression. It is meant for the leaves of a
+// tree, such as type names and literals, where building the nodes by hand
+// would only obscure the code. After an error it returns a placeholder.
+func (a *ASTWriter) Expr(format string, args interface{}) ast.Expr {
+	return a.expr(format, args)
+}
+
+func (a *ASTWriter) expr(format string, args interface{}) ast.Expr {
+	placeholder := ast.NewIdent("_")
+	if a.err != nil {
+		return placeholder
+	}
+	_, file, line, _ := runtime.Caller(2)
+	var src bytes.Buffer
+	if err := NewSnippetWriter(&src, a.context, "$", "$").Do(format, args).Error(); err != nil {
+		a.err = fmt.Errorf("%s:%d: %v", file, line, err)
+		return placeholder
+	}
+	expr, err := parser.ParseExpr(src.String())
+	if err != nil {
+		a.err = fmt.Errorf("%s:%d: %q is not an expression: %v", file, line, src.String(), err)
+		return placeholder
+	}
+	clearPositions(expr)
+	return expr
+}
+
+// Error returns the first error met by the ASTWriter, or nil.
+func (a *ASTWriter) Error() error {
+	return a.err
+}
+
+// clearPositions removes the positions parsed expressions have, which refer
+// to a file set of their own and would confuse go/printer when the
+// expression is mixed with other nodes.
+func clearPositions(node ast.Node) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Ident:
+			n.NamePos = token.NoPos
+		case *ast.BasicLit:
+			n.ValuePos = token.NoPos
+		case *ast.StarExpr:
+			n.Star = token.NoPos
+		case *ast.ArrayType:
+			n.Lbrack = token.NoPos
+		case *ast.MapType:
+			n.Map = token.NoPos
+		case *ast.ChanType:
+			n.Begin, n.Arrow = token.NoPos, token.NoPos
+		case *ast.FuncType:
+			n.Func = token.NoPos
+		case *ast.InterfaceType:
+			n.Interface = token.NoPos
+		case *ast.StructType:
+			n.Struct = token.NoPos
+		case *ast.FieldList:
+			n.Opening, n.Closing = token.NoPos, token.NoPos
+		case *ast.CallExpr:
+			n.Lparen, n.Ellipsis, n.Rparen = token.NoPos, token.NoPos, token.NoPos
+		case *ast.ParenExpr:
+			n.Lparen, n.Rparen = token.NoPos, token.NoPos
+		case *ast.UnaryExpr:
+			n.OpPos = token.NoPos
+		case *ast.BinaryExpr:
+			n.OpPos = token.NoPos
+		case *ast.CompositeLit:
+			n.Lbrace, n.Rbrace = token.NoPos, token.NoPos
+		case *ast.KeyValueExpr:
+			n.Colon = token.NoPos
+		case *ast.IndexExpr:
+			n.Lbrack, n.Rbrack = token.NoPos, token.NoPos
+		case *ast.SliceExpr:
+			n.Lbrack, n.Rbrack = token.NoPos, token.NoPos
+		case *ast.TypeAssertExpr:
+			n.Lparen, n.Rparen = token.NoPos, token.NoPos
+		case *ast.Ellipsis:
+			n.Ellipsis = token.NoPos
+		}
+		return true
+	})
+}
@@ -0,0 +1,203 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// AtomicFileSystem is a FileSystem which holds the files written to and
+// removed from it until Commit, and then applies the changes together, so
+// that a failed run leaves the existing files as they were. Files are read
+// from what was written to them, or from an underlying FileSystem.
+// Directories are created right away. It is safe for concurrent use.
+type AtomicFileSystem struct {
+	base FileSystem
+
+	lock    sync.Mutex
+	pending map[string]pendingWrite
+}
+
+// pendingWrite is a file to write, or to remove, on Commit.
+type pendingWrite struct {
+	data   []byte
+	perm   os.FileMode
+	remove bool
+}
+
+// NewAtomicFileSystem returns an AtomicFileSystem which commits to 'base'.
+func NewAtomicFileSystem(base FileSystem) *AtomicFileSystem {
+	return &AtomicFileSystem{
+		base:    base,
+		pending: map[string]pendingWrite{},
+	}
+}
+
+func (a *AtomicFileSystem) MkdirAll(path string, perm os.FileMode) error {
+	return a.base.MkdirAll(path, perm)
+}
+
+func (a *AtomicFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.pending[filepath.Clean(name)] = pendingWrite{data: append([]byte(nil), data...), perm: perm}
+	return nil
+}
+
+func (a *AtomicFileSystem) ReadFile(name string) ([]byte, error) {
+	a.lock.Lock()
+	w, ok := a.pending[filepath.Clean(name)]
+	a.lock.Unlock()
+	if ok && w.remove {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	if ok {
+		return append([]byte(nil), w.data...), nil
+	}
+	return a.base.ReadFile(name)
+}
+
+// ReadDir lists the directory of the underlying FileSystem.
+func (a *AtomicFileSystem) ReadDir(name string) ([]os.FileInfo, error) {
+	return a.base.ReadDir(name)
+}
+
+// Remove removes the file on Commit. The underlying FileSystem must be a
+// FileRemover by then.
+func (a *AtomicFileSystem) Remove(name string) error {
+	if _, err := a.ReadFile(name); err != nil {
+		return err
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.pending[filepath.Clean(name)] = pendingWrite{remove: true}
+	return nil
+}
+
+// Pending returns the files which were written or removed but not committed
+// yet, sorted by path.
+func (a *AtomicFileSystem) Pending() []string {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	paths := make([]string, 0, len(a.pending))
+	for path := range a.pending {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Rollback forgets the changes made since the last Commit.
+func (a *AtomicFileSystem) Rollback() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.pending = map[string]pendingWrite{}
+}
+
+// Commit applies the pending changes to the underlying FileSystem. If it is
+// a FileRenamer and a FileRemover, each file is written to a temporary file
+// next to it first, and they are only renamed into place once all of them
+// were written. If changing any file fails, the files already changed are
+// restored, those created are removed if the underlying FileSystem can, and
+// the error is returned. Either way, nothing is pending afterwards.
+func (a *AtomicFileSystem) Commit() error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	paths := make([]string, 0, len(a.pending))
+	for path := range a.pending {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	pending := a.pending
+	a.pending = map[string]pendingWrite{}
+
+	remover, _ := a.base.(FileRemover)
+	renamer, _ := a.base.(FileRenamer)
+	useTemps := remover != nil && renamer != nil
+	temps := map[string]string{}
+	removeTemps := func() {
+		for _, tmp := range temps {
+			remover.Remove(tmp)
+		}
+	}
+	if useTemps {
+		for _, path := range paths {
+			if pending[path].remove {
+				continue
+			}
+			tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+			if err := a.base.WriteFile(tmp, pending[path].data, pending[path].perm); err != nil {
+				removeTemps()
+				return fmt.Errorf("unable to write %q: %v", path, err)
+			}
+			temps[path] = tmp
+		}
+	}
+
+	// The original content of every file changed so far, to restore if a
+	// later one fails. Files which didn't exist are removed instead.
+	originals := map[string][]byte{}
+	existed := map[string]bool{}
+	changed := []string{}
+	fail := func(err error) error {
+		for _, path := range changed {
+			if existed[path] {
+				a.base.WriteFile(path, originals[path], 0644)
+			} else if remover != nil {
+				remover.Remove(path)
+			}
+		}
+		if useTemps {
+			removeTemps()
+		}
+		return err
+	}
+	for _, path := range paths {
+		w := pending[path]
+		original, err := a.base.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return fail(fmt.Errorf("unable to read %q: %v", path, err))
+		}
+		originals[path], existed[path] = original, err == nil
+		switch {
+		case w.remove && !existed[path]:
+			continue
+		case w.remove && remover == nil:
+			return fail(fmt.Errorf("unable to remove %q: %T can't remove files", path, a.base))
+		case w.remove:
+			err = remover.Remove(path)
+		case useTemps:
+			if err = renamer.Rename(temps[path], path); err == nil {
+				delete(temps, path)
+			}
+		default:
+			err = a.base.WriteFile(path, w.data, w.perm)
+		}
+		changed = append(changed, path)
+		if err != nil {
+			return fail(fmt.Errorf("unable to change %q: %v", path, err))
+		}
+	}
+	return nil
+}
+
+var (
+	_ = FileSystem(&AtomicFileSystem{})
+	_ = FileRemover(&AtomicFileSystem{})
+)
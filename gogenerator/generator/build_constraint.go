@@ -0,0 +1,130 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// BuildConstraintStyle selects the syntax of the build constraints written
+// into generated Go files.
+type BuildConstraintStyle string
+
+const (
+	// BuildConstraintBoth writes a "//go:build" line followed by the
+	// equivalent legacy "// +build" line, so that Go releases before 1.17
+	// honor the constraint too.
+	BuildConstraintBoth BuildConstraintStyle = "both"
+
+	// BuildConstraintGoBuild writes only a "//go:build" line.
+	BuildConstraintGoBuild BuildConstraintStyle = "go:build"
+)
+
+// BuildConstraintStyles lists the valid build constraint styles.
+var BuildConstraintStyles = []BuildConstraintStyle{BuildConstraintBoth, BuildConstraintGoBuild}
+
+// BuildConstraint returns the build constraint lines for 'expr', followed
+// by a blank line, in the given style. 'expr' uses the legacy "+build"
+// syntax: space-separated alternatives of comma-separated terms, each
+// optionally negated with "!", such as "linux,amd64 !cgo". An empty 'expr'
+// yields no lines.
+func BuildConstraint(style BuildConstraintStyle, expr string) []byte {
+	expr = strings.Join(strings.Fields(expr), " ")
+	if len(expr) == 0 {
+		return nil
+	}
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "//go:build %s\n", goBuildExpr([]string{expr}))
+	if style != BuildConstraintGoBuild {
+		fmt.Fprintf(b, "// +build %s\n", expr)
+	}
+	fmt.Fprintln(b)
+	return b.Bytes()
+}
+
+// goBuildExpr translates the expressions of one or more "// +build" lines,
+// which must all be satisfied, to a "//go:build" expression.
+func goBuildExpr(lines []string) string {
+	and := []string{}
+	for _, line := range lines {
+		or := []string{}
+		for _, alt := range strings.Fields(line) {
+			terms := strings.Split(alt, ",")
+			if len(terms) > 1 && len(strings.Fields(line)) > 1 {
+				or = append(or, "("+strings.Join(terms, " && ")+")")
+			} else {
+				or = append(or, strings.Join(terms, " && "))
+			}
+		}
+		if len(or) > 1 && len(lines) > 1 {
+			and = append(and, "("+strings.Join(or, " || ")+")")
+		} else {
+			and = append(and, strings.Join(or, " || "))
+		}
+	}
+	return strings.Join(and, " && ")
+}
+
+// isGoBuildLine reports whether 'line' is a "//go:build" constraint.
+func isGoBuildLine(line []byte) bool {
+	return bytes.HasPrefix(line, []byte("//go:build ")) || bytes.Equal(line, []byte("//go:build"))
+}
+
+// isPlusBuildLine reports whether 'line' is a legacy "// +build" constraint.
+func isPlusBuildLine(line []byte) bool {
+	return bytes.HasPrefix(line, []byte("// +build ")) || bytes.Equal(line, []byte("// +build"))
+}
+
+// normalizeBuildConstraints rewrites the build constraints at the top of the
+// Go source 'src' to a single "//go:build" line, dropping legacy "// +build"
+// lines, so that files which state the same constraint in either syntax, or
+// in both, compare equal. Sources without constraints are returned as is.
+func normalizeBuildConstraints(src []byte) []byte {
+	lines := bytes.SplitAfter(src, []byte("\n"))
+	var goBuild []byte
+	plusBuild := []string{}
+	out := make([][]byte, 0, len(lines))
+	at := -1
+	for i, line := range lines {
+		trimmed := bytes.TrimRight(line, " \t\r\n")
+		if bytes.HasPrefix(trimmed, []byte("package ")) {
+			out = append(out, lines[i:]...)
+			break
+		}
+		switch {
+		case isGoBuildLine(trimmed):
+			goBuild = trimmed
+		case isPlusBuildLine(trimmed):
+			plusBuild = append(plusBuild, string(bytes.TrimPrefix(trimmed, []byte("// +build"))))
+		default:
+			out = append(out, line)
+			continue
+		}
+		if at < 0 {
+			at = len(out)
+			out = append(out, nil)
+		}
+	}
+	if at < 0 {
+		return src
+	}
+	if goBuild == nil {
+		goBuild = []byte("//go:build " + goBuildExpr(plusBuild))
+	}
+	out[at] = append(append([]byte{}, goBuild...), '\n')
+	return bytes.Join(out, nil)
+}
@@ -0,0 +1,177 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Cache remembers, for every generator and generated package, a hash of the
+// inputs it was generated from and hashes of the files it produced, so that
+// later runs can skip packages whose inputs are unchanged and whose files are
+// as they were written. It is safe for concurrent use.
+type Cache struct {
+	// Identity distinguishes generators sharing a cache file. Each has entries
+	// of its own, so that they don't replace each other's for the packages
+	// they both generate into.
+	Identity string
+
+	// If true, every package is regenerated, but the results are still
+	// recorded.
+	Force bool
+
+	path string
+	lock sync.Mutex
+	// The entries of every identity, by package directory.
+	entries map[string]map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	Key string `json:"key"`
+	// The hashes of the contents of the files produced, by name.
+	Files map[string]string `json:"files"`
+}
+
+// LoadCache reads the cache stored at 'path'. A missing or unreadable cache
+// file yields an empty cache.
+func LoadCache(path, identity string) *Cache {
+	c := &Cache{
+		Identity: identity,
+		path:     path,
+		entries:  map[string]map[string]cacheEntry{},
+	}
+	if b, err := ioutil.ReadFile(path); err == nil {
+		if err := json.Unmarshal(b, &c.entries); err != nil {
+			c.entries = map[string]map[string]cacheEntry{}
+		}
+	}
+	return c
+}
+
+// Save writes the cache back to the file it was loaded from, creating its
+// directory if need be.
+func (c *Cache) Save() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	b, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.path, b, 0644)
+}
+
+// Fresh returns true if the package at 'dir' was last generated by this
+// generator from inputs with the given key, and all of its files, as read
+// from 'fs', still have the contents they were written with.
+func (c *Cache) Fresh(fs FileSystem, dir, key string) bool {
+	if c.Force {
+		return false
+	}
+	c.lock.Lock()
+	e, ok := c.entries[c.Identity][dir]
+	c.lock.Unlock()
+	if !ok || e.Key != key {
+		return false
+	}
+	for name, hash := range e.Files {
+		b, err := fs.ReadFile(filepath.Join(dir, name))
+		if err != nil || contentHash(b) != hash {
+			return false
+		}
+	}
+	return true
+}
+
+// Record remembers that the package at 'dir' was generated from inputs with
+// the given key, producing the files whose content hashes are 'files', by
+// name.
+func (c *Cache) Record(dir, key string, files map[string]string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.entries[c.Identity] == nil {
+		c.entries[c.Identity] = map[string]cacheEntry{}
+	}
+	c.entries[c.Identity][dir] = cacheEntry{Key: key, Files: files}
+}
+
+// files returns the names of the files recorded for the package at 'dir'.
+func (c *Cache) files(dir string) []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	names := []string{}
+	for name := range c.entries[c.Identity][dir].Files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ExecutableIdentity returns an identity for the running generator, derived
+// from its binary and command line, so that upgrading the generator or
+// changing its flags invalidates the cache.
+func ExecutableIdentity() string {
+	h := sha256.New()
+	if exe, err := os.Executable(); err == nil {
+		if f, err := os.Open(exe); err == nil {
+			io.Copy(h, f)
+			f.Close()
+		}
+	}
+	for _, arg := range os.Args {
+		fmt.Fprintf(h, "%s\x00", arg)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cacheKey hashes everything the output of 'p' may depend on: the generator
+// identity, the output location and header, the key of 'p' if it has one,
+// and the source, overlays included, of every package the builder has
+// parsed. Generators may look up any type in the universe, and add packages
+// to it, so hashing fewer packages could leave output generated from a
+// stale peer package in place; a change to any input regenerates every
+// package instead.
+func (c *Context) cacheKey(path string, p Package) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00", c.Cache.Identity, path, p.Header(""))
+	if kp, ok := p.(PackageWithCacheKey); ok {
+		fmt.Fprintf(h, "%s\x00", kp.CacheKey())
+	}
+	if c.builder == nil {
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+	for _, pkgPath := range c.builder.ParsedPackages() {
+		for _, file := range c.builder.PackageFiles(pkgPath) {
+			b, err := c.builder.ReadFile(file)
+			if err != nil {
+				return "", err
+			}
+			sum := sha256.Sum256(b)
+			fmt.Fprintf(h, "%s\x00%x\x00", file, sum)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -14,7 +14,11 @@
 
 package generator
 
-import "github.com/lack-io/gogogen/gogenerator/types"
+import (
+	"path/filepath"
+
+	"github.com/lack-io/gogogen/gogenerator/types"
+)
 
 // DefaultPackage contains a default implementation of Package.
 type DefaultPackage struct {
@@ -39,11 +43,31 @@ type DefaultPackage struct {
 
 	// Optional; filters the types exposed to the generators.
 	FilterFunc func(*Context, *types.Type) bool
+
+	// Optional; the source tree the package is written under, instead of
+	// the output directory of the run. See PackageWithOutputRoot.
+	OutputBase string
+
+	// Optional; returns the base name of the files the generator
+	// 'generatorName' writes for the package 'pkg', which is nil if the
+	// package is not in the universe. The extension of the generator's
+	// file name is kept. An empty result keeps the generator's file name.
+	OutputFileNameFunc func(pkg *types.Package, generatorName string) string
 }
 
 func (d *DefaultPackage) Name() string       { return d.PackageName }
 func (d *DefaultPackage) Path() string       { return d.PackagePath }
 func (d *DefaultPackage) SourcePath() string { return d.Source }
+func (d *DefaultPackage) OutputRoot() string { return d.OutputBase }
+
+func (d *DefaultPackage) FileName(c *Context, g Generator) string {
+	if d.OutputFileNameFunc != nil {
+		if name := d.OutputFileNameFunc(c.Universe[d.PackagePath], g.Name()); name != "" {
+			return name + filepath.Ext(g.Filename())
+		}
+	}
+	return g.Filename()
+}
 
 func (d *DefaultPackage) Filter(c *Context, t *types.Type) bool {
 	if d.FilterFunc != nil {
@@ -0,0 +1,249 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines printed around each change.
+const diffContext = 3
+
+// diffMaxSearch bounds the number of edits searched for from either end of
+// a part of the inputs, which bounds the time taken by diffs of inputs with
+// little in common; such parts are reported as replaced as a whole.
+const diffMaxSearch = 10000
+
+type diffOp struct {
+	// One of ' ', '-' or '+'.
+	kind byte
+	line string
+}
+
+// UnifiedDiff returns a unified diff which turns 'a' into 'b', using the given
+// names in the file header lines. An empty string is returned if the inputs
+// are equal.
+func UnifiedDiff(aName, bName string, a, b []byte) string {
+	if bytes.Equal(a, b) {
+		return ""
+	}
+	ops := myersDiff(splitDiffLines(a), splitDiffLines(b))
+
+	out := &bytes.Buffer{}
+	fmt.Fprintf(out, "--- %s\n+++ %s\n", aName, bName)
+
+	// aLine and bLine hold the (0-based) line number in each input at which
+	// ops[i] applies.
+	aLine := make([]int, len(ops)+1)
+	bLine := make([]int, len(ops)+1)
+	for i, op := range ops {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if op.kind != '+' {
+			aLine[i+1]++
+		}
+		if op.kind != '-' {
+			bLine[i+1]++
+		}
+	}
+
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		// Extend the hunk for as long as the next change is close enough
+		// that the context would overlap.
+		end, equal := i, 0
+		for end < len(ops) && equal <= 2*diffContext {
+			if ops[end].kind == ' ' {
+				equal++
+			} else {
+				equal = 0
+			}
+			end++
+		}
+		end -= equal
+		if end += diffContext; end > len(ops) {
+			end = len(ops)
+		}
+
+		aCount, bCount := aLine[end]-aLine[start], bLine[end]-bLine[start]
+		fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(aLine[start], aCount), hunkRange(bLine[start], bCount))
+		for _, op := range ops[start:end] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.line)
+			if !strings.HasSuffix(op.line, "\n") {
+				out.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+	return out.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		// An empty range refers to the line before the change.
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// splitDiffLines splits b into lines, keeping the trailing newlines.
+func splitDiffLines(b []byte) []string {
+	if len(b) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(b), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// myersDiff computes a shortest edit script from a to b using the linear
+// space refinement of Myers' O(ND) algorithm: the edit graph is searched from
+// both ends at once until the paths meet, and the parts on either side of
+// where they meet are diffed in turn. Unlike keeping the whole trace of the
+// search, this needs memory proportional to the size of the inputs, however
+// much they differ.
+func myersDiff(a, b []string) []diffOp {
+	ops := []diffOp{}
+	diffRange(a, b, &ops)
+	return ops
+}
+
+// diffRange appends the edit script from a to b to ops.
+func diffRange(a, b []string, ops *[]diffOp) {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	for _, line := range a[:prefix] {
+		*ops = append(*ops, diffOp{' ', line})
+	}
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	switch x, y := middle(midA, midB); {
+	case x >= 0:
+		diffRange(midA[:x], midB[:y], ops)
+		diffRange(midA[x:], midB[y:], ops)
+	default:
+		// One side is empty, or the two have nothing in common.
+		for _, line := range midA {
+			*ops = append(*ops, diffOp{'-', line})
+		}
+		for _, line := range midB {
+			*ops = append(*ops, diffOp{'+', line})
+		}
+	}
+	for _, line := range a[len(a)-suffix:] {
+		*ops = append(*ops, diffOp{' ', line})
+	}
+}
+
+// middle returns where the shortest edit script from a to b is split in two,
+// found by following the furthest reaching paths from the start (forward)
+// and from the end (backward) of the edit graph until they overlap, or -1 if
+// either input is empty, they have no line in common, or the paths don't
+// overlap within diffMaxSearch edits.
+func middle(a, b []string) (x, y int) {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return -1, -1
+	}
+	maxD := (n + m + 1) / 2
+	if maxD > diffMaxSearch {
+		maxD = diffMaxSearch
+	}
+	offset := maxD
+	size := 2*maxD + 2
+	// The furthest x reached on every diagonal k, at offset+k, by the
+	// forward paths, and by the backward paths counting from the end.
+	vf, vb := make([]int, size), make([]int, size)
+	for i := range vf {
+		vf[i], vb[i] = -1, -1
+	}
+	vf[offset+1], vb[offset+1] = 0, 0
+	delta := n - m
+	// If delta is odd, the paths are checked for overlap on the forward
+	// steps, otherwise on the backward ones.
+	front := delta%2 != 0
+	// The diagonals ruled out at each end, having left the edit graph.
+	fStart, fEnd, bStart, bEnd := 0, 0, 0, 0
+	for d := 0; d < maxD; d++ {
+		for k := -d + fStart; k <= d-fEnd; k += 2 {
+			var x int
+			if k == -d || (k != d && vf[offset+k-1] < vf[offset+k+1]) {
+				x = vf[offset+k+1]
+			} else {
+				x = vf[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			vf[offset+k] = x
+			switch {
+			case x > n:
+				fEnd += 2
+			case y > m:
+				fStart += 2
+			case front:
+				if kb := offset + delta - k; kb >= 0 && kb < size && vb[kb] != -1 && x >= n-vb[kb] {
+					return x, y
+				}
+			}
+		}
+		for k := -d + bStart; k <= d-bEnd; k += 2 {
+			var x int
+			if k == -d || (k != d && vb[offset+k-1] < vb[offset+k+1]) {
+				x = vb[offset+k+1]
+			} else {
+				x = vb[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x++
+				y++
+			}
+			vb[offset+k] = x
+			switch {
+			case x > n:
+				bEnd += 2
+			case y > m:
+				bStart += 2
+			case !front:
+				if kf := offset + delta - k; kf >= 0 && kf < size && vf[kf] != -1 && vf[kf] >= n-x {
+					return vf[kf], vf[kf] - (kf - offset)
+				}
+			}
+		}
+	}
+	return -1, -1
+}
@@ -0,0 +1,92 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+
+package generator
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/lack-io/gogogen/gogenerator/types"
+)
+
+// The comment tags every generator honors, without declaring or reading
+// them. On a type, they exclude it from generators; before the package
+// clause of a file, all the types the file declares; and in doc.go, all
+// the types of the package:
+//
+//	// +gogogen:skip              excluded from every generator
+//	// +gogogen:skip=deepcopy     excluded from the generators named
+//	// +gogogen:only=deepcopy     excluded from all but the generators named
+//
+// Generators are named by the Name of the Generator, or by the
+// GeneratorName of the context, with or without a "-gen" suffix; several
+// may be given, separated by commas.
+const (
+	SkipTagName = "gogogen:skip"
+	OnlyTagName = "gogogen:only"
+)
+
+// directiveFilter returns the filter excluding the types which the
+// +gogogen:skip and +gogogen:only tags exclude from 'g'.
+func (c *Context) directiveFilter(g Generator) func(*Context, *types.Type) bool {
+	names := []string{g.Name(), c.GeneratorName}
+	return func(ctxt *Context, t *types.Type) bool {
+		for _, comments := range ctxt.directiveComments(t) {
+			tags := types.ExtractCommentTags("+", comments)
+			for _, value := range tags[SkipTagName] {
+				if value == "" || namesGenerator(value, names) {
+					return false
+				}
+			}
+			for _, value := range tags[OnlyTagName] {
+				if !namesGenerator(value, names) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+}
+
+// directiveComments returns the comments of the package, the file and the
+// type 't', which may carry directives.
+func (c *Context) directiveComments(t *types.Type) [][]string {
+	out := [][]string{append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)}
+	if p, ok := c.Universe[t.Name.Package]; ok && t.Name.Package != "" {
+		out = append(out, p.Comments)
+		if t.Position.Filename != "" {
+			out = append(out, p.FileComments[filepath.Base(t.Position.Filename)])
+		}
+	}
+	return out
+}
+
+// namesGenerator returns true if the comma-separated list 'value' holds
+// one of 'names', with or without a "-gen" suffix.
+func namesGenerator(value string, names []string) bool {
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimSuffix(strings.TrimSpace(v), "-gen")
+		if v == "" {
+			continue
+		}
+		for _, name := range names {
+			if name != "" && strings.TrimSuffix(name, "-gen") == v {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -26,4 +26,7 @@
 // package. Additionally, all naming systems in the Context will be added as
 // functions to the parsed template, so that they can be called directly from
 // you templates!
+//
+// Generators which would rather build go/ast nodes than templates can use
+// ASTWriter instead, which prints them with go/printer.
 package generator
@@ -0,0 +1,165 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// WriteAction is what writing a generated file would do to it.
+type WriteAction string
+
+const (
+	WriteCreate    WriteAction = "create"
+	WriteUpdate    WriteAction = "update"
+	WriteUnchanged WriteAction = "unchanged"
+	WriteDelete    WriteAction = "delete"
+)
+
+// PlannedWrite describes a file a dry run would have written.
+type PlannedWrite struct {
+	Path          string
+	Action        WriteAction
+	ExistingBytes int
+	Bytes         int
+}
+
+// DryRunFileSystem is a FileSystem which, instead of writing files, records
+// what writing them would do. Files are read from an underlying FileSystem,
+// or from what was written to them during the dry run. It is safe for
+// concurrent use.
+type DryRunFileSystem struct {
+	base FileSystem
+
+	lock    sync.Mutex
+	written map[string][]byte
+	plan    map[string]PlannedWrite
+}
+
+// NewDryRunFileSystem returns a DryRunFileSystem reading from 'base'.
+func NewDryRunFileSystem(base FileSystem) *DryRunFileSystem {
+	return &DryRunFileSystem{
+		base:    base,
+		written: map[string][]byte{},
+		plan:    map[string]PlannedWrite{},
+	}
+}
+
+// MkdirAll does nothing.
+func (d *DryRunFileSystem) MkdirAll(path string, perm os.FileMode) error { return nil }
+
+func (d *DryRunFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	name = filepath.Clean(name)
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	w := PlannedWrite{Path: name, Action: WriteCreate, Bytes: len(data)}
+	if existing, err := d.readFile(name); err == nil {
+		w.ExistingBytes = len(existing)
+		if bytes.Equal(existing, data) {
+			w.Action = WriteUnchanged
+		} else {
+			w.Action = WriteUpdate
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	// The first write decides whether the file is created.
+	if prev, ok := d.plan[name]; ok && prev.Action == WriteCreate {
+		w.Action = WriteCreate
+		w.ExistingBytes = 0
+	}
+	d.plan[name] = w
+	d.written[name] = append([]byte(nil), data...)
+	return nil
+}
+
+func (d *DryRunFileSystem) ReadFile(name string) ([]byte, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.readFile(filepath.Clean(name))
+}
+
+func (d *DryRunFileSystem) readFile(name string) ([]byte, error) {
+	if b, ok := d.written[name]; ok {
+		return append([]byte(nil), b...), nil
+	}
+	return d.base.ReadFile(name)
+}
+
+// Remove records that the file would be deleted.
+func (d *DryRunFileSystem) Remove(name string) error {
+	name = filepath.Clean(name)
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	existing, err := d.readFile(name)
+	if err != nil {
+		return err
+	}
+	d.plan[name] = PlannedWrite{Path: name, Action: WriteDelete, ExistingBytes: len(existing)}
+	delete(d.written, name)
+	return nil
+}
+
+// ReadDir lists the directory of the underlying FileSystem.
+func (d *DryRunFileSystem) ReadDir(name string) ([]os.FileInfo, error) {
+	return d.base.ReadDir(name)
+}
+
+// Plan returns the files which would have been written, sorted by path.
+func (d *DryRunFileSystem) Plan() []PlannedWrite {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	plan := make([]PlannedWrite, 0, len(d.plan))
+	for _, w := range d.plan {
+		plan = append(plan, w)
+	}
+	sort.Slice(plan, func(i, j int) bool { return plan[i].Path < plan[j].Path })
+	return plan
+}
+
+// WritePlan writes the plan to 'w' as text, one file per line, followed by a
+// summary line.
+func (d *DryRunFileSystem) WritePlan(w io.Writer) error {
+	et := NewErrorTracker(w)
+	counts := map[WriteAction]int{}
+	for _, p := range d.Plan() {
+		counts[p.Action]++
+		switch p.Action {
+		case WriteCreate:
+			fmt.Fprintf(et, "%-9s %s (%d bytes)\n", p.Action, p.Path, p.Bytes)
+		case WriteUpdate:
+			fmt.Fprintf(et, "%-9s %s (%+d bytes)\n", p.Action, p.Path, p.Bytes-p.ExistingBytes)
+		default:
+			fmt.Fprintf(et, "%-9s %s\n", p.Action, p.Path)
+		}
+	}
+	fmt.Fprintf(et, "%d to create, %d to update, %d unchanged", counts[WriteCreate], counts[WriteUpdate], counts[WriteUnchanged])
+	if counts[WriteDelete] > 0 {
+		fmt.Fprintf(et, ", %d to delete", counts[WriteDelete])
+	}
+	fmt.Fprintln(et)
+	return et.Error()
+}
+
+var (
+	_ = FileSystem(&DryRunFileSystem{})
+	_ = FileRemover(&DryRunFileSystem{})
+)
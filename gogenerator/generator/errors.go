@@ -0,0 +1,88 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"fmt"
+	"go/token"
+	"strings"
+
+	"github.com/lack-io/gogogen/gogenerator/types"
+)
+
+// GenerationError is an error executing a package, attributed to the
+// package and, where known, to the output file, the generator, and the type
+// it was generating, at the position the type is declared.
+type GenerationError struct {
+	// The import path of the package.
+	Package string
+	// The name of the output file, without its directory, if any.
+	File string
+	// The name of the generator, if the error is its.
+	Generator string
+	// The type the generator failed on, if any, and where it is declared.
+	Type *types.Type
+	Pos  token.Position
+
+	Err error
+}
+
+func (e *GenerationError) Error() string {
+	where := fmt.Sprintf("package %q", e.Package)
+	if e.File != "" {
+		where += fmt.Sprintf(", file %q", e.File)
+	}
+	if e.Generator != "" {
+		where += fmt.Sprintf(", generator %q", e.Generator)
+	}
+	if e.Type != nil {
+		where += fmt.Sprintf(", type %v", e.Type)
+	}
+	if e.Pos.IsValid() {
+		where = e.Pos.String() + ": " + where
+	}
+	return where + ": " + e.Err.Error()
+}
+
+func (e *GenerationError) Unwrap() error { return e.Err }
+
+// generationError attributes 'err' to the package 'pkgPath', and the 'file'
+// and 'generator' if not empty. Errors already attributed to a type keep it.
+func generationError(pkgPath, file, generator string, err error) *GenerationError {
+	ge, ok := err.(*GenerationError)
+	if !ok {
+		ge = &GenerationError{Err: err}
+	}
+	ge.Package = pkgPath
+	if file != "" {
+		ge.File = file
+	}
+	if generator != "" {
+		ge.Generator = generator
+	}
+	return ge
+}
+
+// Errors are the errors of executing packages, in package order. Unless the
+// context fails fast, every package and every generator is executed, and
+// all of their errors are collected.
+type Errors []error
+
+func (e Errors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%d errors:\n%s", len(e), strings.Join(errs2strings(e), "\n"))
+}
@@ -16,12 +16,18 @@ package generator
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"go/parser"
+	"go/token"
 	"io"
-	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/tools/imports"
 
@@ -43,83 +49,195 @@ func errs2strings(errors []error) []string {
 // should be a physical path on disk, not an import path. e.g.:
 // /path/to/home/path/to/gopath/src
 // Each package has its import path already, this will be appended to 'outDir'.
+// If c.WorkerCount is greater than one, up to that many packages are executed
+// concurrently.
 func (c *Context) ExecutePackages(outDir string, packages Packages) error {
-	var errors []error
-	for _, p := range packages {
-		if err := c.ExecutePackage(outDir, p); err != nil {
-			errors = append(errors, err)
+	return c.ExecutePackagesContext(context.Background(), outDir, packages)
+}
+
+// ExecutePackagesContext is like ExecutePackages, but stops starting packages
+// once ctx is done, returning ctx.Err().
+func (c *Context) ExecutePackagesContext(ctx context.Context, outDir string, packages Packages) error {
+	if err := c.ValidateTags(); err != nil {
+		return err
+	}
+	results := make([]error, len(packages))
+	if c.WorkerCount <= 1 {
+		for i, p := range packages {
+			if ctx.Err() != nil {
+				break
+			}
+			results[i] = c.ExecutePackage(outDir, p)
+			if results[i] != nil && c.FailFast {
+				break
+			}
+		}
+	} else {
+		// The lazily computed import graphs are filled in now, rather than
+		// by generators running concurrently.
+		c.IncomingImports()
+		c.TransitiveIncomingImports()
+		c.ImportGraph()
+
+		var wg sync.WaitGroup
+		var failed int32
+		work := make(chan int)
+		for w := 0; w < c.WorkerCount; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := range work {
+					if results[i] = c.ExecutePackage(outDir, packages[i]); results[i] != nil {
+						atomic.StoreInt32(&failed, 1)
+					}
+				}
+			}()
+		}
+	feed:
+		for i := range packages {
+			if c.FailFast && atomic.LoadInt32(&failed) != 0 {
+				break
+			}
+			select {
+			case work <- i:
+			case <-ctx.Done():
+				break feed
+			}
+		}
+		close(work)
+		wg.Wait()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Report errors in package order, regardless of which finished first.
+	var errors Errors
+	for i, err := range results {
+		switch err := err.(type) {
+		case nil:
+		case Errors:
+			errors = append(errors, err...)
+		default:
+			errors = append(errors, generationError(packages[i].Path(), "", "", err))
 		}
 	}
 	if len(errors) > 0 {
-		return fmt.Errorf("some packages had errors:\n%v\n", strings.Join(errs2strings(errors), "\n"))
+		return errors
 	}
 	return nil
 }
 
 type DefaultFileType struct {
+	// Format formats the assembled file. If nil, the file is written as
+	// assembled.
 	Format   func([]byte) ([]byte, error)
 	Assemble func(io.Writer, *File)
 }
 
 func (ft DefaultFileType) AssembleFile(f *File, pathname string) error {
 	log.Infof("Assembling file %q", pathname)
-	destFile, err := os.Create(pathname)
-	if err != nil {
-		return err
-	}
-	defer destFile.Close()
-
 	b := &bytes.Buffer{}
 	et := NewErrorTracker(b)
 	ft.Assemble(et, f)
 	if et.Error() != nil {
 		return et.Error()
 	}
-	if formatted, err := ft.Format(b.Bytes()); err != nil {
-		err = fmt.Errorf("unable to format file %q (%v)", pathname, err)
-		// Write the file anyway, so they can see what's going wrong and fix the generator.
-		if _, err2 := destFile.Write(b.Bytes()); err2 != nil {
+	formatted := b.Bytes()
+	if ft.Format != nil {
+		var err error
+		if formatted, err = ft.Format(b.Bytes()); err != nil {
+			err = fmt.Errorf("unable to format file %q (%v)", pathname, err)
+			// Write the file anyway, so they can see what's going wrong and fix the generator.
+			if err2 := f.fileSystem().WriteFile(pathname, b.Bytes(), 0644); err2 != nil {
+				return err
+			}
 			return err
 		}
-		return err
-	} else {
-		_, err = destFile.Write(formatted)
+	}
+	formatted, err := f.postProcess(pathname, formatted)
+	if err != nil {
 		return err
 	}
+	return f.fileSystem().WriteFile(pathname, formatted, 0644)
 }
 
 func (ft DefaultFileType) VerifyFile(f *File, pathname string) error {
-	log.Infof("Verifying file %q", pathname)
+	result, existing, formatted, err := ft.verify(f, pathname)
+	if err != nil {
+		return err
+	}
 	friendlyName := filepath.Join(f.PackageName, f.Name)
-	b := &bytes.Buffer{}
-	et := NewErrorTracker(b)
-	ft.Assemble(et, f)
-	if et.Error() != nil {
-		return et.Error()
+	switch result.Status {
+	case VerifyMissing:
+		return fmt.Errorf("unable to read file %q for comparison: file does not exist", friendlyName)
+	case VerifyChanged:
+		diff := UnifiedDiff(pathname, pathname+" (generated)", existing, formatted)
+		return fmt.Errorf("output for %q differs from the existing file:\n%s", friendlyName, diff)
 	}
-	formatted, err := ft.Format(b.Bytes())
+	return nil
+}
+
+// VerifyFileResult compares the output for 'f' with the file at 'pathname'
+// and describes the outcome. An error is only returned if the output could
+// not be produced or the existing file could not be read.
+func (ft DefaultFileType) VerifyFileResult(f *File, pathname string) (VerifyResult, error) {
+	result, _, _, err := ft.verify(f, pathname)
+	return result, err
+}
+
+func (ft DefaultFileType) verify(f *File, pathname string) (result VerifyResult, existing, formatted []byte, err error) {
+	log.Infof("Verifying file %q", pathname)
+	friendlyName := filepath.Join(f.PackageName, f.Name)
+	result.Path = pathname
+	formatted, err = ft.assembleAndFormat(f, pathname)
 	if err != nil {
-		return fmt.Errorf("unable to format the output for %q: %v", friendlyName, err)
+		return result, nil, nil, fmt.Errorf("unable to format the output for %q: %v", friendlyName, err)
+	}
+	result.GeneratedBytes = len(formatted)
+	result.GeneratedHash = contentHash(formatted)
+
+	existing, err = f.fileSystem().ReadFile(pathname)
+	if os.IsNotExist(err) {
+		result.Status = VerifyMissing
+		return result, nil, formatted, nil
 	}
-	existing, err := ioutil.ReadFile(pathname)
 	if err != nil {
-		return fmt.Errorf("unable to read file %q for comparison: %q", friendlyName, err)
+		return result, nil, nil, fmt.Errorf("unable to read file %q for comparison: %q", friendlyName, err)
 	}
+	result.ExistingBytes = len(existing)
+	result.ExistingHash = contentHash(existing)
 	if bytes.Compare(formatted, existing) == 0 {
-		return nil
-	}
-	i := 0
-	for i < len(formatted) && i < len(existing) && formatted[i] == existing[i] {
-		i++
+		result.Status = VerifyOK
+	} else if strings.HasSuffix(pathname, ".go") && bytes.Equal(normalizeBuildConstraints(formatted), normalizeBuildConstraints(existing)) {
+		// The existing file only states the same build constraint in the
+		// other syntax, as gofmt of another Go release may have written it.
+		result.Status = VerifyOK
+	} else if !f.StrictVerify && strings.HasSuffix(pathname, ".go") && bytes.Equal(normalizeBuildConstraints(withoutHeader(formatted)), normalizeBuildConstraints(withoutHeader(existing))) {
+		// Only the header differs, as it does when the year or the name
+		// of the generator binary changes.
+		result.Status = VerifyOK
+	} else {
+		result.Status = VerifyChanged
 	}
-	eDiff, fDiff := existing[i:], formatted[i:]
-	if len(eDiff) > 100 {
-		eDiff = eDiff[:100]
+	return result, existing, formatted, nil
+}
+
+func (ft DefaultFileType) assembleAndFormat(f *File, pathname string) ([]byte, error) {
+	b := &bytes.Buffer{}
+	et := NewErrorTracker(b)
+	ft.Assemble(et, f)
+	if et.Error() != nil {
+		return nil, et.Error()
 	}
-	if len(fDiff) > 100 {
-		fDiff = fDiff[:100]
+	formatted := b.Bytes()
+	if ft.Format != nil {
+		var err error
+		if formatted, err = ft.Format(formatted); err != nil {
+			return nil, err
+		}
 	}
-	return fmt.Errorf("output for %q differs; first existing/expected diff: \n	%q\n	%q", friendlyName, string(eDiff), string(fDiff))
+	return f.postProcess(pathname, formatted)
 }
 
 func assembleGolangFile(w io.Writer, f *File) {
@@ -128,13 +246,12 @@ func assembleGolangFile(w io.Writer, f *File) {
 
 	if len(f.Imports) > 0 {
 		fmt.Fprintf(w, "import (\n")
-		for i := range f.Imports {
-			if strings.Contains(i, "\"") {
-				// they include quote, or are using the
-				// `name "path/to/pkg" format.
-				fmt.Fprintf(w, "\t%s\n", i)
-			} else {
-				fmt.Fprintf(w, "\t%q\n", i)
+		for i, group := range importGroups(f.Imports, f.LocalImportPrefix) {
+			if i > 0 {
+				fmt.Fprint(w, "\n")
+			}
+			for _, imp := range group {
+				fmt.Fprintf(w, "\t%s\n", imp)
 			}
 		}
 		fmt.Fprint(w, ")\n\n")
@@ -155,10 +272,77 @@ func assembleGolangFile(w io.Writer, f *File) {
 	w.Write(f.Body.Bytes())
 }
 
+// importGroups sorts imports into the groups goimports uses: the standard
+// library, other packages, and packages whose path starts with localPrefix.
+// Empty groups are omitted, and each group is sorted by import path.
+func importGroups(imports map[string]struct{}, localPrefix string) [][]string {
+	type spec struct{ line, path string }
+	groups := make([][]spec, 3)
+	for i := range imports {
+		s := spec{line: i, path: i}
+		if start := strings.Index(i, "\""); start >= 0 {
+			// they include quote, or are using the
+			// `name "path/to/pkg" format.
+			s.path = strings.Trim(i[start:], "\"")
+		} else {
+			s.line = fmt.Sprintf("%q", i)
+		}
+		g := 1
+		if localPrefix != "" && (s.path == localPrefix || strings.HasPrefix(s.path, strings.TrimSuffix(localPrefix, "/")+"/")) {
+			g = 2
+		} else if !strings.Contains(strings.SplitN(s.path, "/", 2)[0], ".") {
+			g = 0
+		}
+		groups[g] = append(groups[g], s)
+	}
+
+	out := [][]string{}
+	for _, group := range groups {
+		if len(group) == 0 {
+			continue
+		}
+		sort.Slice(group, func(i, j int) bool {
+			if group[i].path != group[j].path {
+				return group[i].path < group[j].path
+			}
+			return group[i].line < group[j].line
+		})
+		lines := make([]string, len(group))
+		for i := range group {
+			lines[i] = group[i].line
+		}
+		out = append(out, lines)
+	}
+	return out
+}
+
+// importsWrapper formats src like goimports: unused imports are removed and
+// missing ones added, so generators may emit code conditionally without
+// tracking exactly which imports it uses.
 func importsWrapper(src []byte) ([]byte, error) {
 	return imports.Process("", src, nil)
 }
 
+// gofmtWrapper formats src like gofmt, only sorting its imports.
+func gofmtWrapper(src []byte) ([]byte, error) {
+	return imports.Process("", src, &imports.Options{
+		Comments:   true,
+		TabIndent:  true,
+		TabWidth:   8,
+		FormatOnly: true,
+	})
+}
+
+// parseWrapper returns src unchanged, after checking that it is valid Go.
+func parseWrapper(src []byte) ([]byte, error) {
+	if _, err := parser.ParseFile(token.NewFileSet(), "", src, parser.AllErrors); err != nil {
+		return nil, err
+	}
+	return src, nil
+}
+
+// NewGolangFile returns the file type of Go files, which are run through
+// goimports after being assembled.
 func NewGolangFile() *DefaultFileType {
 	return &DefaultFileType{
 		Format:   importsWrapper,
@@ -166,6 +350,28 @@ func NewGolangFile() *DefaultFileType {
 	}
 }
 
+// NewGofmtGolangFile returns a file type of Go files which, unlike
+// NewGolangFile, are only run through gofmt. Every import must be used.
+func NewGofmtGolangFile() *DefaultFileType {
+	return &DefaultFileType{
+		Format:   gofmtWrapper,
+		Assemble: assembleGolangFile,
+	}
+}
+
+// NewUnformattedGolangFile returns a file type of Go files which are written
+// as assembled, for when formatting is left to a separate step. If
+// checkSyntax is true, files which don't parse are still reported as errors.
+func NewUnformattedGolangFile(checkSyntax bool) *DefaultFileType {
+	ft := &DefaultFileType{
+		Assemble: assembleGolangFile,
+	}
+	if checkSyntax {
+		ft.Format = parseWrapper
+	}
+	return ft
+}
+
 // format should be one line only, and not end with \n.
 func addIndentHeaderComment(b *bytes.Buffer, format string, args ...interface{}) {
 	if b.Len() > 0 {
@@ -209,88 +415,268 @@ func (c *Context) addNameSystems(namers namer.NameSystems) *Context {
 // ExecutePackage executes a single package. 'outDir' is the base directory in
 // which to place the package; it should be a physical path on disk, not an
 // import path. e.g.: '/path/to/name/path/to/gopath/src/' The package knowns its
-// import path already, this will be appended to 'outDir'.
+// import path already, this will be appended to 'outDir', unless
+// Context.OutputDirs or the package itself says otherwise. See
+// PackageWithOutputRoot.
 func (c *Context) ExecutePackage(outDir string, p Package) error {
-	path := filepath.Join(outDir, p.Path())
-	log.Infof("Processing package %q, disk location %q", p.Name(), path)
+	path := c.outputDir(outDir, p)
+	c.logger().Infof("Processing package %q, disk location %q", p.Name(), path)
+	if c.outputs != nil {
+		c.outputs.visit(path)
+	}
+	cached := false
+	if c.Metrics != nil {
+		start := time.Now()
+		defer func() { c.Metrics.addPackage(p.Path(), time.Since(start), cached) }()
+	}
+	var cacheKey string
+	if c.Cache != nil && !c.Verify {
+		var err error
+		if cacheKey, err = c.cacheKey(path, p); err != nil {
+			return fmt.Errorf("unable to hash the inputs of package %q: %v", p.Path(), err)
+		}
+		if c.Cache.Fresh(c.fileSystem(), path, cacheKey) {
+			c.logger().Infof("Skipping package %q, its inputs are unchanged", p.Path())
+			cached = true
+			for _, name := range c.Cache.files(path) {
+				if c.outputs != nil {
+					c.outputs.keep(filepath.Join(path, name))
+				}
+				if c.Manifest != nil {
+					if err := c.addToManifest(filepath.Join(path, name), p.Path(), nil, true); err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		}
+	}
 	// Filter out any types the *package* doesn't care about.
 	packageContext := c.filteredBy(p.Filter)
-	os.MkdirAll(path, 0755)
+	if err := c.fileSystem().MkdirAll(path, 0755); err != nil {
+		return err
+	}
+
+	// Errors are collected, and files which a generator failed to write are
+	// not assembled, unless the context fails fast.
+	var errors Errors
+	fail := func(file, generator string, err error) bool {
+		errors = append(errors, generationError(p.Path(), file, generator, err))
+		return c.FailFast
+	}
 	files := map[string]*File{}
+	fileGenerators := map[string][]string{}
+	failed := map[string]bool{}
 	for _, g := range p.Generators(packageContext) {
-		// Filter out types the *generator* doesn't care about.
-		genContext := packageContext.filteredBy(g.Filter)
+		// Filter out types the *generator* doesn't care about, or which
+		// the +gogogen:skip and +gogogen:only tags keep from it.
+		genContext := packageContext.filteredBy(c.directiveFilter(g)).filteredBy(g.Filter)
 		// Now add any extra name systems defined by this generator
 		genContext = genContext.addNameSystems(g.Namers(genContext))
 
 		fileType := g.FileType()
+		fileName := g.Filename()
+		if fp, ok := p.(PackageWithFileNames); ok {
+			fileName = fp.FileName(packageContext, g)
+		}
 		if len(fileType) == 0 {
-			return fmt.Errorf("generator %q must specify a file type", g.Name())
-		}
-		f := files[g.Filename()]
-		if f == nil {
-			// This is the first generator to reference this file, so start it.
-			f = &File{
-				Name:              g.Filename(),
-				FileType:          fileType,
-				PackageName:       p.Name(),
-				PackagePath:       p.Path(),
-				PackageSourcePath: p.SourcePath(),
-				Header:            p.Header(g.Filename()),
-				Imports:           map[string]struct{}{},
-			}
-			files[f.Name] = f
-		} else {
-			if f.FileType != g.FileType() {
-				return fmt.Errorf("file %q already has type %q, but generator %q wants to use type %q", f.Name, f.FileType, g.Name(), g.FileType())
+			if fail(fileName, g.Name(), fmt.Errorf("generator %q must specify a file type", g.Name())) {
+				return errors
 			}
+			continue
 		}
-
-		if vars := g.PackageVars(genContext); len(vars) > 0 {
-			addIndentHeaderComment(&f.Vars, "Package-wide variables from generator %q.", g.Name())
-			for _, v := range vars {
-				if _, err := fmt.Fprintf(&f.Vars, "%s\n", v); err != nil {
-					return err
-				}
-			}
+		fs := c.FS
+		if c.Metrics != nil {
+			fs = meteredFileSystem{c.fileSystem(), c.Metrics, p.Path()}
 		}
-		if consts := g.PackageConsts(genContext); len(consts) > 0 {
-			addIndentHeaderComment(&f.Consts, "Package-wide consts from generator %q.", g.Name())
-			for _, v := range consts {
-				if _, err := fmt.Fprintf(&f.Consts, "%s\n", v); err != nil {
-					return err
+		touched := []string{}
+		fileFor := func(name string) (*File, error) {
+			f := files[name]
+			if f == nil {
+				// This is the first generator to reference this file, so start it.
+				f = &File{
+					Name:              name,
+					FileType:          fileType,
+					PackageName:       p.Name(),
+					PackagePath:       p.Path(),
+					PackageSourcePath: p.SourcePath(),
+					Header:            p.Header(name),
+					Imports:           map[string]struct{}{},
+					LocalImportPrefix: c.LocalImportPrefix,
+					PostProcessors:    c.postProcessors,
+					StrictVerify:      c.StrictVerify,
+					FS:                fs,
 				}
+				files[f.Name] = f
+			} else {
+				if f.FileType != g.FileType() {
+					return nil, fmt.Errorf("file %q already has type %q, but generator %q wants to use type %q", f.Name, f.FileType, g.Name(), g.FileType())
+				}
+			}
+			touched = append(touched, name)
+			if gens := fileGenerators[name]; len(gens) == 0 || gens[len(gens)-1] != g.Name() {
+				fileGenerators[name] = append(gens, g.Name())
 			}
+			return f, nil
 		}
-		if err := genContext.executeBody(&f.Body, g); err != nil {
-			return err
+		start := time.Now()
+		err := genContext.executeGenerator(g, fileName, fileFor)
+		if c.Metrics != nil {
+			c.Metrics.addGenerator(p.Path(), g.Name(), time.Since(start))
 		}
-		if imports := g.Imports(genContext); len(imports) > 0 {
-			for _, i := range imports {
-				f.Imports[i] = struct{}{}
+		if err != nil {
+			for _, name := range touched {
+				failed[name] = true
+			}
+			if fail(fileName, g.Name(), err) {
+				return errors
 			}
 		}
 	}
-
-	var errors []error
 	for _, f := range files {
+		if f.pruneImports && !failed[f.Name] {
+			f.Imports = usedImports(f)
+		}
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if c.TypeCheck {
+		// Files which do not type check are not written.
+		typeErrs := c.typeCheck(p.Path(), path, files, failed)
+		for _, name := range names {
+			if err, ok := typeErrs[name]; ok {
+				failed[name] = true
+				if fail(name, strings.Join(fileGenerators[name], ", "), err) {
+					return errors
+				}
+			}
+		}
+	}
+	for _, name := range names {
+		f := files[name]
+		if failed[f.Name] {
+			continue
+		}
 		finalPath := filepath.Join(path, f.Name)
+		if c.outputs != nil {
+			if err := c.outputs.claim(finalPath, p.Path(), fileGenerators[f.Name]); err != nil {
+				if fail(f.Name, "", err) {
+					return errors
+				}
+				continue
+			}
+		}
 		assembler, ok := c.FileTypes[f.FileType]
 		if !ok {
-			return fmt.Errorf("the file type %q registered for file %q does not exist in the context", f.FileType, f.Name)
+			if fail(f.Name, "", fmt.Errorf("the file type %q registered for file %q does not exist in the context", f.FileType, f.Name)) {
+				return errors
+			}
+			continue
 		}
 		var err error
-		if c.Verify {
+		if c.Verify && c.Fix {
+			err = c.fixFile(assembler, f, finalPath)
+		} else if reporter, ok := assembler.(VerifyReporter); ok && c.Verify && c.VerifyReport != nil {
+			var result VerifyResult
+			if result, err = reporter.VerifyFileResult(f, finalPath); err == nil {
+				c.VerifyReport.Add(result)
+				if result.Status != VerifyOK {
+					err = fmt.Errorf("output for %q is %s", finalPath, result.Status)
+				}
+			}
+		} else if c.Verify {
 			err = assembler.VerifyFile(f, finalPath)
 		} else {
 			err = assembler.AssembleFile(f, finalPath)
 		}
+		if err == nil && c.Manifest != nil && (!c.Verify || c.Fix) {
+			err = c.addToManifest(finalPath, p.Path(), fileGenerators[f.Name], false)
+		}
 		if err != nil {
-			errors = append(errors, err)
+			if fail(f.Name, "", err) {
+				return errors
+			}
+		}
+	}
+	if c.Verify && c.VerifyReport != nil {
+		produced := func(name string) bool { _, ok := files[name]; return ok }
+		for _, stale := range findStaleFiles(c.fileSystem(), path, p.Header(""), produced) {
+			c.VerifyReport.Add(stale)
+			if c.Fix {
+				// Nothing removes files, so leave these to the user.
+				c.logger().Warnf("Output %q is %s, remove it by hand", stale.Path, stale.Status)
+				continue
+			}
+			if fail(filepath.Base(stale.Path), "", fmt.Errorf("output for %q is %s", stale.Path, stale.Status)) {
+				return errors
+			}
 		}
 	}
 	if len(errors) > 0 {
-		return fmt.Errorf("errors in package %q:\n%v\n", p.Path(), strings.Join(errs2strings(errors), "\n"))
+		return errors
+	}
+	if cacheKey != "" {
+		// The generators may have added packages to the universe, which the
+		// key must cover for the next run to tell when they change.
+		var err error
+		if cacheKey, err = c.cacheKey(path, p); err != nil {
+			return fmt.Errorf("unable to hash the inputs of package %q: %v", p.Path(), err)
+		}
+		hashes := map[string]string{}
+		for _, name := range names {
+			b, err := c.fileSystem().ReadFile(filepath.Join(path, name))
+			if err != nil {
+				return fmt.Errorf("unable to read output %q back for the cache: %v", filepath.Join(path, name), err)
+			}
+			hashes[name] = contentHash(b)
+		}
+		c.Cache.Record(path, cacheKey, hashes)
+	}
+	return nil
+}
+
+// executeGenerator runs the generator 'g' into the file 'fileName', and any
+// others it splits its output into, which it gets from 'fileFor'.
+func (c *Context) executeGenerator(g Generator, fileName string, fileFor func(name string) (*File, error)) error {
+	f, err := fileFor(fileName)
+	if err != nil {
+		return err
+	}
+
+	if vars := g.PackageVars(c); len(vars) > 0 {
+		addIndentHeaderComment(&f.Vars, "Package-wide variables from generator %q.", g.Name())
+		for _, v := range vars {
+			if _, err := fmt.Fprintf(&f.Vars, "%s\n", v); err != nil {
+				return err
+			}
+		}
+	}
+	if consts := g.PackageConsts(c); len(consts) > 0 {
+		addIndentHeaderComment(&f.Consts, "Package-wide consts from generator %q.", g.Name())
+		for _, v := range consts {
+			if _, err := fmt.Fprintf(&f.Consts, "%s\n", v); err != nil {
+				return err
+			}
+		}
+	}
+	written := []*File{f}
+	if sg, ok := g.(SplitGenerator); ok {
+		if written, err = c.executeSplitBody(f, sg, fileFor); err != nil {
+			return err
+		}
+	} else if err := c.executeBody(&f.Body, g); err != nil {
+		return err
+	}
+	if imports := g.Imports(c); len(imports) > 0 {
+		for _, f := range written {
+			for _, i := range imports {
+				f.Imports[i] = struct{}{}
+			}
+		}
 	}
 	return nil
 }
@@ -302,7 +688,7 @@ func (c *Context) executeBody(w io.Writer, generator Generator) error {
 	}
 	for _, t := range c.Order {
 		if err := generator.GenerateType(c, t, et); err != nil {
-			return err
+			return &GenerationError{Type: t, Pos: t.Position, Err: err}
 		}
 	}
 	if err := generator.Finalize(c, et); err != nil {
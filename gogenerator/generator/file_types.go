@@ -0,0 +1,105 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// YAMLFileType is the file type of YAML files. The header is written as
+	// "#" comments.
+	YAMLFileType = "yaml"
+
+	// MarkdownFileType is the file type of Markdown and HTML files. The
+	// header is written as an HTML comment.
+	MarkdownFileType = "markdown"
+
+	// TextFileType is the file type of files written without a header.
+	TextFileType = "text"
+)
+
+// NewTextFile returns a file type for files which aren't Go. The header of
+// each file, which holds "//" comments like that of a Go file, is rewritten
+// by 'header' and written before the body. If 'header' is nil, the header is
+// dropped. If 'format' is nil, the file is written as assembled.
+func NewTextFile(header func([]byte) []byte, format func([]byte) ([]byte, error)) *DefaultFileType {
+	return &DefaultFileType{
+		Format: format,
+		Assemble: func(w io.Writer, f *File) {
+			if header != nil {
+				w.Write(header(f.Header))
+			}
+			w.Write(f.Body.Bytes())
+		},
+	}
+}
+
+// NewYAMLFile returns the file type registered as YAMLFileType.
+func NewYAMLFile() *DefaultFileType {
+	return NewTextFile(func(header []byte) []byte {
+		return CommentHeader(header, "#")
+	}, nil)
+}
+
+// NewMarkdownFile returns the file type registered as MarkdownFileType.
+func NewMarkdownFile() *DefaultFileType {
+	return NewTextFile(func(header []byte) []byte {
+		return BlockCommentHeader(header, "<!--", "-->")
+	}, nil)
+}
+
+// CommentHeader rewrites the "//" comments of a Go header as comments
+// starting with 'prefix', such as "#". A blank line separates a non-empty
+// header from what follows.
+func CommentHeader(header []byte, prefix string) []byte {
+	text := strings.TrimRight(string(header), "\n")
+	if len(text) == 0 {
+		return nil
+	}
+	b := &bytes.Buffer{}
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, "//") {
+			line = prefix + strings.TrimPrefix(line, "//")
+		}
+		fmt.Fprintln(b, line)
+	}
+	fmt.Fprintln(b)
+	return b.Bytes()
+}
+
+// BlockCommentHeader rewrites the "//" comments of a Go header as a single
+// block comment between 'open' and 'close', such as "<!--" and "-->". Any
+// 'close' in the text is broken up with a space. A blank line separates a
+// non-empty header from what follows.
+func BlockCommentHeader(header []byte, open, close string) []byte {
+	text := strings.TrimRight(string(header), "\n")
+	if len(text) == 0 {
+		return nil
+	}
+	escaped := close[:1] + " " + close[1:]
+	b := &bytes.Buffer{}
+	fmt.Fprintln(b, open)
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimPrefix(strings.TrimPrefix(line, "//"), " ")
+		fmt.Fprintln(b, strings.Replace(line, close, escaped, -1))
+	}
+	fmt.Fprintln(b, close)
+	fmt.Fprintln(b)
+	return b.Bytes()
+}
@@ -0,0 +1,199 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FileSystem is where a context writes the files it generates, and reads
+// the existing files it verifies. Paths use the separator of the OS.
+type FileSystem interface {
+	MkdirAll(path string, perm os.FileMode) error
+	WriteFile(name string, data []byte, perm os.FileMode) error
+	// ReadFile returns an error satisfying os.IsNotExist if the file does
+	// not exist.
+	ReadFile(name string) ([]byte, error)
+	// ReadDir returns the entries of a directory, sorted by name.
+	ReadDir(name string) ([]os.FileInfo, error)
+}
+
+// OSFileSystem is the FileSystem of the OS.
+type OSFileSystem struct{}
+
+func (OSFileSystem) MkdirAll(path string, perm os.FileMode) error { return os.MkdirAll(path, perm) }
+func (OSFileSystem) ReadFile(name string) ([]byte, error)         { return ioutil.ReadFile(name) }
+func (OSFileSystem) ReadDir(name string) ([]os.FileInfo, error)   { return ioutil.ReadDir(name) }
+
+func (OSFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return ioutil.WriteFile(name, data, perm)
+}
+
+// FileRemover is implemented by file systems which can remove files.
+type FileRemover interface {
+	// Remove returns an error satisfying os.IsNotExist if the file does not
+	// exist.
+	Remove(name string) error
+}
+
+// FileRenamer is implemented by file systems which can move files.
+type FileRenamer interface {
+	Rename(oldpath, newpath string) error
+}
+
+func (OSFileSystem) Remove(name string) error             { return os.Remove(name) }
+func (OSFileSystem) Rename(oldpath, newpath string) error { return os.Rename(oldpath, newpath) }
+
+// MemFileSystem is a FileSystem which holds its files in memory, for tests
+// and for build systems which collect the output themselves. It is safe for
+// concurrent use.
+type MemFileSystem struct {
+	lock  sync.Mutex
+	files map[string][]byte
+	dirs  map[string]bool
+}
+
+// NewMemFileSystem returns an empty MemFileSystem.
+func NewMemFileSystem() *MemFileSystem {
+	return &MemFileSystem{
+		files: map[string][]byte{},
+		dirs:  map[string]bool{},
+	}
+}
+
+func (m *MemFileSystem) MkdirAll(path string, perm os.FileMode) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for dir := filepath.Clean(path); !m.dirs[dir]; dir = filepath.Dir(dir) {
+		if _, ok := m.files[dir]; ok {
+			return &os.PathError{Op: "mkdir", Path: path, Err: os.ErrExist}
+		}
+		m.dirs[dir] = true
+	}
+	return nil
+}
+
+func (m *MemFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	name = filepath.Clean(name)
+	if m.dirs[name] {
+		return &os.PathError{Op: "write", Path: name, Err: os.ErrExist}
+	}
+	m.files[name] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m *MemFileSystem) ReadFile(name string) ([]byte, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	b, ok := m.files[filepath.Clean(name)]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return append([]byte(nil), b...), nil
+}
+
+func (m *MemFileSystem) ReadDir(name string) ([]os.FileInfo, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	dir := filepath.Clean(name)
+	if !m.dirs[dir] {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	infos := []os.FileInfo{}
+	for path, b := range m.files {
+		if filepath.Dir(path) == dir {
+			infos = append(infos, memFileInfo{name: filepath.Base(path), size: int64(len(b))})
+		}
+	}
+	for path := range m.dirs {
+		if path != dir && filepath.Dir(path) == dir {
+			infos = append(infos, memFileInfo{name: filepath.Base(path), dir: true})
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+func (m *MemFileSystem) Remove(name string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	name = filepath.Clean(name)
+	if _, ok := m.files[name]; !ok {
+		return &os.PathError{Op: "remove", Path: name, Err: os.ErrNotExist}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+func (m *MemFileSystem) Rename(oldpath, newpath string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	oldpath, newpath = filepath.Clean(oldpath), filepath.Clean(newpath)
+	b, ok := m.files[oldpath]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrNotExist}
+	}
+	delete(m.files, oldpath)
+	m.files[newpath] = b
+	return nil
+}
+
+// Files returns the paths of all the files, sorted.
+func (m *MemFileSystem) Files() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	paths := make([]string, 0, len(m.files))
+	for path := range m.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// memFileInfo describes a file or directory of a MemFileSystem.
+type memFileInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (i memFileInfo) Name() string       { return i.name }
+func (i memFileInfo) Size() int64        { return i.size }
+func (i memFileInfo) ModTime() time.Time { return time.Time{} }
+func (i memFileInfo) IsDir() bool        { return i.dir }
+func (i memFileInfo) Sys() interface{}   { return nil }
+
+func (i memFileInfo) Mode() os.FileMode {
+	if i.dir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+var (
+	_ = FileSystem(OSFileSystem{})
+	_ = FileSystem(&MemFileSystem{})
+	_ = FileRemover(OSFileSystem{})
+	_ = FileRenamer(OSFileSystem{})
+	_ = FileRemover(&MemFileSystem{})
+	_ = FileRenamer(&MemFileSystem{})
+)
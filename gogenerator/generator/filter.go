@@ -0,0 +1,85 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"github.com/lack-io/gogogen/gogenerator/types"
+)
+
+// TypeFilterFunc returns true if the type takes part in the run.
+type TypeFilterFunc func(c *Context, t *types.Type) bool
+
+// PackageFilterFunc returns true if the package takes part in the run.
+type PackageFilterFunc func(c *Context, p *types.Package) bool
+
+// RegisterTypeFilter excludes the types for which 'f' returns false from the
+// run: they are removed from Order, so no package or generator sees them,
+// in their Filter methods or otherwise. Filters must be registered before
+// the packages to generate are made, as by the Packages function of a
+// generator, to hide types from it too.
+func (ctxt *Context) RegisterTypeFilter(f TypeFilterFunc) {
+	ctxt.typeFilters = append(ctxt.typeFilters[:len(ctxt.typeFilters):len(ctxt.typeFilters)], f)
+	ctxt.Order = ctxt.filterOrder(ctxt.Order)
+}
+
+// RegisterPackageFilter excludes the packages for which 'f' returns false
+// from the run: they are removed from Inputs, and their types from Order.
+// As with RegisterTypeFilter, filters must be registered before the
+// packages to generate are made.
+func (ctxt *Context) RegisterPackageFilter(f PackageFilterFunc) {
+	ctxt.packageFilters = append(ctxt.packageFilters[:len(ctxt.packageFilters):len(ctxt.packageFilters)], f)
+	inputs := make([]string, 0, len(ctxt.Inputs))
+	for _, path := range ctxt.Inputs {
+		if p, ok := ctxt.Universe[path]; !ok || f(ctxt, p) {
+			inputs = append(inputs, path)
+		}
+	}
+	ctxt.Inputs = inputs
+	ctxt.Order = ctxt.filterOrder(ctxt.Order)
+}
+
+// filterOrder returns the types of 'order' which pass the registered
+// filters.
+func (ctxt *Context) filterOrder(order []*types.Type) []*types.Type {
+	if len(ctxt.typeFilters) == 0 && len(ctxt.packageFilters) == 0 {
+		return order
+	}
+	out := make([]*types.Type, 0, len(order))
+	for _, t := range order {
+		if ctxt.included(t) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// included returns true if the type and its package pass the registered
+// filters. Types without a package in the universe, such as builtins, are
+// only subject to the type filters.
+func (ctxt *Context) included(t *types.Type) bool {
+	if p, ok := ctxt.Universe[t.Name.Package]; ok && t.Name.Package != "" {
+		for _, f := range ctxt.packageFilters {
+			if !f(ctxt, p) {
+				return false
+			}
+		}
+	}
+	for _, f := range ctxt.typeFilters {
+		if !f(ctxt, t) {
+			return false
+		}
+	}
+	return true
+}
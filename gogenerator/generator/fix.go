@@ -0,0 +1,59 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import "os"
+
+// BackupSuffix is appended to the name of a file to get the name of the
+// copy kept when the file is fixed with FixBackup set.
+const BackupSuffix = ".bak"
+
+// fixFile verifies the output for 'f' against the file at 'pathname', and
+// writes it again only if it is missing or differs. If FixBackup is set, a
+// file which differs is first copied to pathname+BackupSuffix.
+func (c *Context) fixFile(assembler FileType, f *File, pathname string) error {
+	result := VerifyResult{Path: pathname, Status: VerifyChanged}
+	if reporter, ok := assembler.(VerifyReporter); ok {
+		var err error
+		if result, err = reporter.VerifyFileResult(f, pathname); err != nil {
+			return err
+		}
+	} else if assembler.VerifyFile(f, pathname) == nil {
+		// Without a VerifyReporter, all we know is whether the file matches.
+		result.Status = VerifyOK
+	}
+	if result.Status != VerifyOK {
+		c.logger().Infof("Output for %q is %s, writing it again", pathname, result.Status)
+		if c.FixBackup {
+			existing, err := f.fileSystem().ReadFile(pathname)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			if err == nil {
+				if err := f.fileSystem().WriteFile(pathname+BackupSuffix, existing, 0644); err != nil {
+					return err
+				}
+			}
+		}
+		if err := assembler.AssembleFile(f, pathname); err != nil {
+			return err
+		}
+		result.Fixed = true
+	}
+	if c.VerifyReport != nil {
+		c.VerifyReport.Add(result)
+	}
+	return nil
+}
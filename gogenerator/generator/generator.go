@@ -16,11 +16,16 @@ package generator
 
 import (
 	"bytes"
+	"fmt"
+	gotypes "go/types"
 	"io"
+	"path/filepath"
+	"strings"
 
 	"github.com/lack-io/gogogen/gogenerator/namer"
 	"github.com/lack-io/gogogen/gogenerator/parser"
 	"github.com/lack-io/gogogen/gogenerator/types"
+	"github.com/lack-io/gogogen/util/log"
 )
 
 // Package contains the contract for generating a package.
@@ -49,6 +54,39 @@ type Package interface {
 	Generators(*Context) []Generator
 }
 
+// PackageWithOutputRoot is a Package which is written under its own source
+// tree, rather than under the output directory of the run, so that one run
+// can write packages into several modules.
+type PackageWithOutputRoot interface {
+	Package
+
+	// OutputRoot returns the directory the package's import path is
+	// appended to, to find where it is written. If empty, the package is
+	// written where it would be otherwise.
+	OutputRoot() string
+}
+
+// PackageWithFileNames is a Package which chooses the names of the files its
+// generators write.
+type PackageWithFileNames interface {
+	Package
+
+	// FileName returns the name of the file the generator 'g' writes,
+	// instead of g.Filename().
+	FileName(c *Context, g Generator) string
+}
+
+// PackageWithCacheKey is a Package whose output depends on more than the
+// types it is given, such as one whose files are produced by another program.
+type PackageWithCacheKey interface {
+	Package
+
+	// CacheKey returns a hash of what else the output of the package depends
+	// on, which the incremental generation cache adds to the hash of its
+	// inputs.
+	CacheKey() string
+}
+
 type File struct {
 	Name              string
 	FileType          string
@@ -57,9 +95,49 @@ type File struct {
 	PackagePath       string
 	PackageSourcePath string
 	Imports           map[string]struct{}
-	Vars              bytes.Buffer
-	Consts            bytes.Buffer
-	Body              bytes.Buffer
+	// Imports with this path prefix are grouped after all others, the way
+	// goimports -local groups them.
+	LocalImportPrefix string
+	// Applied in order to the formatted contents of the file before it is
+	// written or verified. See Context.RegisterFilePostProcessor.
+	PostProcessors []FilePostProcessor
+	// If true, the file only verifies if it is identical to the output.
+	// Otherwise Go files whose copyright header or "Code generated by"
+	// comment differ from the output, and nothing else, verify too.
+	StrictVerify bool
+	// Where the file is written, or read from to be verified. If nil, the
+	// file system of the OS is used.
+	FS     FileSystem
+	Vars   bytes.Buffer
+	Consts bytes.Buffer
+	Body   bytes.Buffer
+
+	// Set if the file is part of the split output of a generator, so that
+	// it only keeps the imports it uses. See SplitGenerator.
+	pruneImports bool
+}
+
+// FilePostProcessor rewrites the contents of a generated file, which will be
+// written to 'name', returning the new contents. Returning an error fails
+// the file.
+type FilePostProcessor func(name string, body []byte) ([]byte, error)
+
+func (f *File) fileSystem() FileSystem {
+	if f.FS == nil {
+		return OSFileSystem{}
+	}
+	return f.FS
+}
+
+// postProcess applies the file's post-processors to body.
+func (f *File) postProcess(name string, body []byte) ([]byte, error) {
+	for _, p := range f.PostProcessors {
+		var err error
+		if body, err = p(name, body); err != nil {
+			return nil, fmt.Errorf("unable to post-process file %q: %v", name, err)
+		}
+	}
+	return body, nil
 }
 
 type FileType interface {
@@ -149,6 +227,31 @@ type Generator interface {
 	FileType() string
 }
 
+// SplitGenerator is a Generator whose output is split across several files,
+// such as one per type, or parts of a maximum size, to keep big packages
+// manageable. All of them get the generator's imports, less those a file
+// doesn't use. Init, Finalize, PackageVars and PackageConsts write to the
+// generator's file, as usual.
+type SplitGenerator interface {
+	Generator
+
+	// Split returns how the output is split.
+	Split(*Context) FileSplit
+}
+
+// FileSplit describes how the output of a SplitGenerator is split.
+type FileSplit struct {
+	// If set, returns the name of the file the code generated for the type
+	// is written to. An empty name means the generator's file.
+	ByType func(*types.Type) string
+
+	// If positive, the code of further types goes to a new file once a file
+	// has this many lines. The new file is named after the one the code
+	// would go to, with a number appended, e.g. "zz_generated_2.go". The
+	// code of one type is never split.
+	MaxLines int
+}
+
 // Context is global context for individual generators to consume.
 type Context struct {
 	// A map from the naming system to the names for that system. E.g., you
@@ -164,6 +267,9 @@ type Context struct {
 	// Incoming transitive imports, i.e. the transitive closure of IncomingImports
 	incomingTransitiveImports map[string][]string
 
+	// The import graph of the universe. See ImportGraph.
+	importGraph *ImportGraph
+
 	// All the user-specified packages. This is after recursive expansion.
 	Inputs []string
 
@@ -172,13 +278,123 @@ type Context struct {
 	Order []*types.Type
 
 	// A set of types this context can process. If this is empty or nil
-	// the default "golang" filetype will be provide
+	// the default "golang" filetype will be provide. The YAMLFileType,
+	// MarkdownFileType and TextFileType file types are registered as well,
+	// and generators may register their own.
 	FileTypes map[string]FileType
 
 	// If true, Execute* calls will just verify that the existing output is
 	// correct. (You may set after calling NewContext.)
 	Verify bool
 
+	// If true, verification fails on any difference from the output,
+	// including in the copyright header and the "Code generated by"
+	// comment, as the year and the name of the generator binary are
+	// otherwise ignored. See File.StrictVerify.
+	StrictVerify bool
+
+	// If true together with Verify, files which are missing or differ from
+	// the output are written again, and files which match are left alone.
+	Fix bool
+
+	// If true together with Fix, a file is copied to its name plus
+	// BackupSuffix before it is written again.
+	FixBackup bool
+
+	// If non-nil, verify-only runs record the outcome for every file here,
+	// including generated files which are no longer produced.
+	VerifyReport *VerifyReport
+
+	// If non-nil, Execute* calls record every file they generate here, unless
+	// Verify is set without Fix.
+	Manifest *Manifest
+
+	// If non-nil, Execute* calls record the time spent in every package and
+	// generator, and the files written, here.
+	Metrics *Metrics
+
+	// If non-nil, packages whose inputs haven't changed since the cache was
+	// last recorded are skipped by Execute* calls.
+	Cache *Cache
+
+	// The number of packages ExecutePackages may execute concurrently. Values
+	// less than two execute packages one at a time. When executing
+	// concurrently, the namers and generators shared between packages must be
+	// safe for concurrent use, as the namers of the namer package are (see
+	// namer.Cached for others), and generators must not add packages to the
+	// context at runtime. The import graphs of the context, such as
+	// ImportGraph, are computed before packages start executing.
+	WorkerCount int
+
+	// Imports of packages with this path prefix, typically the module being
+	// generated into, are grouped separately from and after other imports in
+	// generated Go files.
+	LocalImportPrefix string
+
+	// Maps import path prefixes to the directories the packages under them
+	// are written to, instead of under the output directory. The longest
+	// matching prefix is used; e.g. {"example.com/m": "/src/m"} writes the
+	// package example.com/m/pkg to /src/m/pkg.
+	OutputDirs map[string]string
+
+	// Stripped from the import paths of packages, when it is a prefix of
+	// them, before they are appended to the output directory; e.g.
+	// "example.com/m" writes the package example.com/m/pkg to pkg under the
+	// output directory. OutputDirs take precedence.
+	TrimPathPrefix string
+
+	// Where generated files are written, and existing files are read from
+	// to be verified. If nil, the file system of the OS is used. The cache,
+	// if any, always checks for generated files on the OS file system.
+	FS FileSystem
+
+	// If true, the Go files of every package are type checked together
+	// with the package's existing files before any is written, and files
+	// which don't compile are reported as errors of the generators which
+	// wrote them instead. Needs a context made by NewContext.
+	TypeCheck bool
+
+	// The name of the program running the generators, e.g. deepcopy-gen,
+	// by which the +gogogen:skip and +gogogen:only tags may name its
+	// generators besides their own names. See SkipTagName.
+	GeneratorName string
+
+	// If true, uses of deprecated comment tags are errors rather than
+	// warnings. See RegisterTagSchemas.
+	StrictTags bool
+
+	// If true, Execute* calls stop at the first error, rather than
+	// executing every package and generator and returning all of their
+	// errors. See Errors.
+	FailFast bool
+
+	// Where the context logs. If nil, it logs like the util/log package
+	// functions.
+	Logger log.Logger
+
+	// Post-processors applied to every file, in order. See
+	// RegisterFilePostProcessor.
+	postProcessors []FilePostProcessor
+
+	// Exclude types and packages from the run. See RegisterTypeFilter and
+	// RegisterPackageFilter.
+	typeFilters    []TypeFilterFunc
+	packageFilters []PackageFilterFunc
+
+	// The types by the comment tags they carry. See TypesWithTag.
+	tagIndex *tagIndex
+
+	// The output files planned by Execute* calls so far, and who planned
+	// them. Contexts derived from this one share it.
+	outputs *outputTracker
+
+	// The comment tags generators accept. See RegisterTagSchemas.
+	tagNamespaces []*tagNamespace
+
+	// The result of ValidateTags, once it has run.
+	tagsValidated bool
+	tagsErr       error
+
 	// Allows generators to add packages at runtime.
 	builder *parser.Builder
 }
@@ -190,15 +406,28 @@ func NewContext(b *parser.Builder, nameSystems namer.NameSystems, canonicalOrder
 	if err != nil {
 		return nil, err
 	}
+	c := NewUniverseContext(universe, b.FindPackages(), nameSystems, canonicalOrderName)
+	c.builder = b
+	return c, nil
+}
 
+// NewUniverseContext generates a context from an already built universe, such
+// as one describing types which weren't parsed from Go source. 'inputs' lists
+// the user-requested packages. Packages can't be added to such a context at
+// runtime, and the cache can't tell when its inputs change.
+func NewUniverseContext(universe types.Universe, inputs []string, nameSystems namer.NameSystems, canonicalOrderName string) *Context {
 	c := &Context{
 		Namers:   namer.NameSystems{},
 		Universe: universe,
-		Inputs:   b.FindPackages(),
+		Inputs:   inputs,
 		FileTypes: map[string]FileType{
-			GolangFileType: NewGolangFile(),
+			GolangFileType:   NewGolangFile(),
+			YAMLFileType:     NewYAMLFile(),
+			MarkdownFileType: NewMarkdownFile(),
+			TextFileType:     NewTextFile(nil, nil),
 		},
-		builder: b,
+		tagIndex: &tagIndex{},
+		outputs:  &outputTracker{},
 	}
 
 	for name, systemNamer := range nameSystems {
@@ -208,15 +437,145 @@ func NewContext(b *parser.Builder, nameSystems namer.NameSystems, canonicalOrder
 			c.Order = orderer.OrderUniverse(universe)
 		}
 	}
-	return c, nil
+	return c
+}
+
+// WithNameSystems returns a context sharing the universe, the builder and
+// the settings of this one, but with the given naming systems and the
+// canonical ordering of 'canonicalOrderName', so that several generators can
+// run over one parse of their inputs. The comment tags of the context are
+// not shared: each generator registers and validates its own.
+func (ctxt *Context) WithNameSystems(nameSystems namer.NameSystems, canonicalOrderName string) *Context {
+	c := *ctxt
+	c.Namers = namer.NameSystems{}
+	c.Order = nil
+	for name, systemNamer := range nameSystems {
+		c.Namers[name] = systemNamer
+		if name == canonicalOrderName {
+			orderer := namer.Orderer{Namer: systemNamer}
+			c.Order = orderer.OrderUniverse(ctxt.Universe)
+		}
+	}
+	c.Order = c.filterOrder(c.Order)
+	c.tagNamespaces = nil
+	c.tagsValidated = false
+	c.tagsErr = nil
+	return &c
+}
+
+func (ctxt *Context) fileSystem() FileSystem {
+	if ctxt.FS == nil {
+		return OSFileSystem{}
+	}
+	return ctxt.FS
+}
+
+func (ctxt *Context) logger() log.Logger {
+	if ctxt.Logger == nil {
+		return log.Default()
+	}
+	return ctxt.Logger
+}
+
+// outputDir returns the directory the package 'p' is written to, given the
+// output directory passed to ExecutePackage.
+func (ctxt *Context) outputDir(outDir string, p Package) string {
+	pkgPath := p.Path()
+	if rp, ok := p.(PackageWithOutputRoot); ok && rp.OutputRoot() != "" {
+		return filepath.Join(rp.OutputRoot(), ctxt.trimPathPrefix(pkgPath))
+	}
+	return ctxt.outputDirOf(outDir, pkgPath)
+}
+
+// outputDirOf is like outputDir, for a package which doesn't choose its own
+// output root.
+func (ctxt *Context) outputDirOf(outDir, pkgPath string) string {
+	prefix := ""
+	for p := range ctxt.OutputDirs {
+		if (pkgPath == p || strings.HasPrefix(pkgPath, p+"/")) && len(p) >= len(prefix) {
+			prefix = p
+		}
+	}
+	if dir, ok := ctxt.OutputDirs[prefix]; ok {
+		return filepath.Join(dir, strings.TrimPrefix(pkgPath, prefix))
+	}
+	return filepath.Join(outDir, ctxt.trimPathPrefix(pkgPath))
 }
 
-// IncomingImports returns the incoming imports for each package. The map is lazily computed.
+// trimPathPrefix strips TrimPathPrefix from 'pkgPath', if it is the path of
+// one of its parent directories, or of itself.
+func (ctxt *Context) trimPathPrefix(pkgPath string) string {
+	prefix := strings.TrimSuffix(ctxt.TrimPathPrefix, "/")
+	if prefix == "" {
+		return pkgPath
+	}
+	if pkgPath == prefix {
+		return ""
+	}
+	return strings.TrimPrefix(pkgPath, prefix+"/")
+}
+
+// RegisterFilePostProcessor adds a post-processor which is applied to every
+// file the context generates or verifies, after it is assembled and
+// formatted. Post-processors run in the order they were registered, and must
+// be registered before the context executes any packages.
+func (ctxt *Context) RegisterFilePostProcessor(p FilePostProcessor) {
+	ctxt.postProcessors = append(ctxt.postProcessors, p)
+}
+
+// Implementers returns the types of the input packages which implement the
+// interface 'iface', themselves or through a pointer to them, sorted by
+// name. Types excluded by the registered filters are left out. See
+// types.Universe.Implementers.
+func (ctxt *Context) Implementers(iface *types.Type) []types.Implementer {
+	out := []types.Implementer{}
+	if len(ctxt.Inputs) == 0 {
+		return out
+	}
+	for _, i := range ctxt.Universe.Implementers(iface, ctxt.Inputs...) {
+		if ctxt.included(i.Type) {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+// GoType returns the go/types type 't' was built from, for generators which
+// need the precision of go/types, or nil if it wasn't parsed from Go source
+// by the context's builder.
+func (ctxt *Context) GoType(t *types.Type) gotypes.Type {
+	if ctxt.builder == nil {
+		return nil
+	}
+	return ctxt.builder.GoType(t)
+}
+
+// GoObject returns the go/types object declaring 't', or nil. See
+// parser.Builder.GoObject.
+func (ctxt *Context) GoObject(t *types.Type) gotypes.Object {
+	if ctxt.builder == nil {
+		return nil
+	}
+	return ctxt.builder.GoObject(t)
+}
+
+// Syntax returns the syntax declaring 't', for generators which need more
+// than the type model keeps, or nil. It is only kept if the builder was set
+// to include it.
+func (ctxt *Context) Syntax(t *types.Type) *parser.DeclSyntax {
+	if ctxt.builder == nil {
+		return nil
+	}
+	return ctxt.builder.Syntax(t)
+}
+
+// IncomingImports returns the incoming imports for each package. The map is lazily computed,
+// or computed up front when ExecutePackages executes packages concurrently.
 func (ctxt *Context) IncomingImports() map[string][]string {
 	if ctxt.incomingImports == nil {
 		incoming := map[string][]string{}
-		for _, pkg := range ctxt.Universe {
-			for imp := range pkg.Imports {
+		for _, pkg := range ctxt.Universe.SortedPackages() {
+			for _, imp := range pkg.SortedImports() {
 				incoming[imp] = append(incoming[imp], pkg.Path)
 			}
 		}
@@ -226,7 +585,8 @@ func (ctxt *Context) IncomingImports() map[string][]string {
 }
 
 // TransitiveIncomingImports returns the transitive closure of the incoming imports for each package.
-// The map is lazily computed.
+// The map is lazily computed, or computed up front when ExecutePackages executes packages
+// concurrently.
 func (ctxt *Context) TransitiveIncomingImports() map[string][]string {
 	if ctxt.incomingTransitiveImports == nil {
 		ctxt.incomingTransitiveImports = transitiveClosure(ctxt.IncomingImports())
@@ -239,8 +599,13 @@ func (ctxt *Context) TransitiveIncomingImports() map[string][]string {
 // (`which go`) will all be searched, in the normal Go fashion.
 // Deprecated: Please use AddDirectory.
 func (ctxt *Context) AddDir(path string) error {
+	if ctxt.builder == nil {
+		return fmt.Errorf("unable to add directory %q: the context has no parser", path)
+	}
 	ctxt.incomingImports = nil
 	ctxt.incomingTransitiveImports = nil
+	ctxt.importGraph = nil
+	ctxt.tagIndex = &tagIndex{}
 	return ctxt.builder.AddDirTo(path, &ctxt.Universe)
 }
 
@@ -248,7 +613,12 @@ func (ctxt *Context) AddDir(path string) error {
 // single go package import path.  GOPATH, GOROOT, and the location of your go
 // binary (`which go`) will all be searched, in the normal Go fashion.
 func (ctxt *Context) AddDirectory(path string) (*types.Package, error) {
+	if ctxt.builder == nil {
+		return nil, fmt.Errorf("unable to add directory %q: the context has no parser", path)
+	}
 	ctxt.incomingImports = nil
 	ctxt.incomingTransitiveImports = nil
+	ctxt.importGraph = nil
+	ctxt.tagIndex = &tagIndex{}
 	return ctxt.builder.AddDirectoryTo(path, &ctxt.Universe)
 }
@@ -0,0 +1,52 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"bytes"
+)
+
+// withoutHeader returns the Go source 'src' without the comments above its
+// package clause, other than build constraints and the package's doc
+// comment: that is, without the copyright header and the "Code generated
+// by" comment, which change with the year and the name of the generator
+// binary. The doc comment is the block of lines right above the package
+// clause. Sources without a package clause are returned as is.
+func withoutHeader(src []byte) []byte {
+	lines := bytes.SplitAfter(src, []byte("\n"))
+	pkg := -1
+	for i, line := range lines {
+		if bytes.HasPrefix(line, []byte("package ")) {
+			pkg = i
+			break
+		}
+	}
+	if pkg < 0 {
+		return src
+	}
+	doc := pkg
+	for doc > 0 && len(bytes.TrimSpace(lines[doc-1])) > 0 {
+		doc--
+	}
+	out := make([][]byte, 0, len(lines))
+	for _, line := range lines[:doc] {
+		trimmed := bytes.TrimRight(line, " \t\r\n")
+		if isGoBuildLine(trimmed) || isPlusBuildLine(trimmed) {
+			out = append(out, line)
+		}
+	}
+	out = append(out, lines[doc:]...)
+	return bytes.Join(out, nil)
+}
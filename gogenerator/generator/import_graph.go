@@ -0,0 +1,201 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ImportGraph is the graph of the imports among the packages of a universe.
+// Only the packages the parser was asked for have their imports recorded;
+// the packages they import are nodes without imports of their own.
+type ImportGraph struct {
+	packages   []string
+	imports    map[string][]string
+	importedBy map[string][]string
+}
+
+// ImportGraph returns the import graph of the packages of the universe. It
+// is lazily computed, or computed up front when ExecutePackages executes
+// packages concurrently.
+func (ctxt *Context) ImportGraph() *ImportGraph {
+	if ctxt.importGraph == nil {
+		g := &ImportGraph{
+			imports:    map[string][]string{},
+			importedBy: map[string][]string{},
+		}
+		nodes := map[string]bool{}
+		for _, pkg := range ctxt.Universe.SortedPackages() {
+			if pkg.Path == "" {
+				continue
+			}
+			nodes[pkg.Path] = true
+			for _, imp := range pkg.SortedImports() {
+				nodes[imp] = true
+				g.imports[pkg.Path] = append(g.imports[pkg.Path], imp)
+				g.importedBy[imp] = append(g.importedBy[imp], pkg.Path)
+			}
+		}
+		for path := range nodes {
+			g.packages = append(g.packages, path)
+		}
+		sort.Strings(g.packages)
+		for _, importers := range g.importedBy {
+			sort.Strings(importers)
+		}
+		ctxt.importGraph = g
+	}
+	return ctxt.importGraph
+}
+
+// Packages returns the paths of the packages in the graph, sorted.
+func (g *ImportGraph) Packages() []string {
+	return append([]string(nil), g.packages...)
+}
+
+// Imports returns the paths of the packages 'pkg' imports, sorted.
+func (g *ImportGraph) Imports(pkg string) []string {
+	return append([]string(nil), g.imports[pkg]...)
+}
+
+// ImportedBy returns the paths of the packages which import 'pkg', sorted.
+func (g *ImportGraph) ImportedBy(pkg string) []string {
+	return append([]string(nil), g.importedBy[pkg]...)
+}
+
+// TransitiveImports returns the paths of the packages 'pkg' imports,
+// directly or not, sorted. It includes 'pkg' only if it is in a cycle.
+func (g *ImportGraph) TransitiveImports(pkg string) []string {
+	return reachable(g.imports, pkg)
+}
+
+// TransitiveImportedBy returns the paths of the packages which import
+// 'pkg', directly or not, sorted. It includes 'pkg' only if it is in a
+// cycle.
+func (g *ImportGraph) TransitiveImportedBy(pkg string) []string {
+	return reachable(g.importedBy, pkg)
+}
+
+// reachable returns the nodes reachable from 'from' by the edges 'edges',
+// sorted.
+func reachable(edges map[string][]string, from string) []string {
+	seen := map[string]bool{}
+	queue := append([]string(nil), edges[from]...)
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		if seen[next] {
+			continue
+		}
+		seen[next] = true
+		queue = append(queue, edges[next]...)
+	}
+	out := make([]string, 0, len(seen))
+	for path := range seen {
+		out = append(out, path)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Cycles returns the import cycles in the graph, as the sets of packages
+// which import each other, directly or not. Each set is sorted, and the
+// sets are sorted by their first package.
+func (g *ImportGraph) Cycles() [][]string {
+	var cycles [][]string
+	for _, component := range g.components() {
+		if len(component) > 1 || g.importsItself(component[0]) {
+			sort.Strings(component)
+			cycles = append(cycles, component)
+		}
+	}
+	sort.Slice(cycles, func(i, j int) bool { return cycles[i][0] < cycles[j][0] })
+	return cycles
+}
+
+// TopologicalOrder returns the paths of the packages in the graph, every
+// package after the packages it imports, in an order which only depends on
+// the graph. It returns an error if the graph has cycles.
+func (g *ImportGraph) TopologicalOrder() ([]string, error) {
+	if cycles := g.Cycles(); len(cycles) > 0 {
+		descriptions := make([]string, 0, len(cycles))
+		for _, cycle := range cycles {
+			descriptions = append(descriptions, strings.Join(cycle, ", "))
+		}
+		return nil, fmt.Errorf("import cycles among packages: [%s]", strings.Join(descriptions, "], ["))
+	}
+	var order []string
+	for _, component := range g.components() {
+		order = append(order, component[0])
+	}
+	return order, nil
+}
+
+func (g *ImportGraph) importsItself(pkg string) bool {
+	for _, imp := range g.imports[pkg] {
+		if imp == pkg {
+			return true
+		}
+	}
+	return false
+}
+
+// components returns the strongly connected components of the graph, by
+// Tarjan's algorithm. A component comes after the components it imports.
+func (g *ImportGraph) components() [][]string {
+	index := map[string]int{}
+	lowlink := map[string]int{}
+	onStack := map[string]bool{}
+	var stack []string
+	var out [][]string
+	var visit func(pkg string)
+	visit = func(pkg string) {
+		index[pkg] = len(index)
+		lowlink[pkg] = index[pkg]
+		stack = append(stack, pkg)
+		onStack[pkg] = true
+		for _, imp := range g.imports[pkg] {
+			if _, visited := index[imp]; !visited {
+				visit(imp)
+				if lowlink[imp] < lowlink[pkg] {
+					lowlink[pkg] = lowlink[imp]
+				}
+			} else if onStack[imp] && index[imp] < lowlink[pkg] {
+				lowlink[pkg] = index[imp]
+			}
+		}
+		if lowlink[pkg] == index[pkg] {
+			var component []string
+			for {
+				top := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[top] = false
+				component = append(component, top)
+				if top == pkg {
+					break
+				}
+			}
+			out = append(out, component)
+		}
+	}
+	for _, pkg := range g.packages {
+		if _, visited := index[pkg]; !visited {
+			visit(pkg)
+		}
+	}
+	return out
+}
@@ -16,14 +16,24 @@ package generator
 
 import (
 	"go/token"
+	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/lack-io/gogogen/gogenerator/namer"
 	"github.com/lack-io/gogogen/gogenerator/types"
 	"github.com/lack-io/gogogen/util/log"
 )
 
-func NewImportTracker(typesToAdd ...*types.Type) namer.ImportTracker {
+// NewImportTracker returns a tracker of the imports of a Go file, naming
+// each package by the shortest suffix of its import path, with the
+// directories joined and sanitized, which no other package of the file is
+// named by already: "example.com/api/v1" is "v1", or "apiv1" if another
+// "v1" came first, or "examplecomapiv1", and then "v1_2", "v1_3" and so
+// on. Since the first package added gets the shortest name, generators
+// wanting names which don't depend on the order in which they write types
+// pin them with SetAlias.
+func NewImportTracker(typesToAdd ...*types.Type) *namer.DefaultImportTracker {
 	tracker := namer.NewDefaultImportTracker(types.Name{})
 	tracker.IsInvalidType = func(t *types.Type) bool { return false }
 	tracker.LocalName = func(name types.Name) string { return golangTrackerLocalName(&tracker, name) }
@@ -43,24 +53,35 @@ func golangTrackerLocalName(tracker namer.ImportTracker, t types.Name) string {
 	}
 
 	dirs := strings.Split(path, namer.GoSeperator)
-	for n := len(dirs) - 1; n >= 0; n++ {
+	shortest := ""
+	for n := len(dirs) - 1; n >= 0; n-- {
 		name := strings.Join(dirs[n:], "")
 		name = strings.Replace(name, "_", "", -1)
 		// These characters commonly appear in import paths for go
 		// packages, bug aren't legal go names. So we'll sanitize
 		name = strings.Replace(name, ".", "", -1)
 		name = strings.Replace(name, "-", "", -1)
+
+		// If the import name is a Go keyword, or doesn't start with a
+		// letter, prefix with an underscore.
+		if token.Lookup(name).IsKeyword() || (len(name) > 0 && !unicode.IsLetter(rune(name[0]))) {
+			name = "_" + name
+		}
+		if len(shortest) == 0 {
+			shortest = name
+		}
 		if _, found := tracker.PathOf(name); found {
 			// This name collides with some other package
 			continue
 		}
-
-		// If the import name is a Go keyword, prefix with an underscore.
-		if token.Lookup(name).IsKeyword() {
-			name = "_" + name
-		}
 		return name
 	}
 
-	panic("can't find import for " + path)
+	// Every suffix collides, which only pinned aliases make possible.
+	for i := 2; ; i++ {
+		name := shortest + "_" + strconv.Itoa(i)
+		if _, found := tracker.PathOf(name); !found {
+			return name
+		}
+	}
 }
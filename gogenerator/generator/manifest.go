@@ -0,0 +1,96 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+)
+
+// ManifestEntry describes one generated file.
+type ManifestEntry struct {
+	Path string `json:"path"`
+	// The import path of the package the file was generated for.
+	Package string `json:"package"`
+	// The generators which wrote to the file. It is empty for the files of
+	// packages the cache skipped.
+	Generators []string `json:"generators,omitempty"`
+	Cached     bool     `json:"cached,omitempty"`
+	Bytes      int      `json:"bytes"`
+	Hash       string   `json:"hash"`
+}
+
+// Manifest lists the files generated by Execute* calls, with the hashes of
+// their contents, for provenance tracking and to detect manual edits. It is
+// safe for concurrent use.
+type Manifest struct {
+	lock  sync.Mutex
+	files map[string]ManifestEntry
+}
+
+// Add records a file in the manifest, replacing any earlier entry for the
+// same path.
+func (m *Manifest) Add(e ManifestEntry) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.files == nil {
+		m.files = map[string]ManifestEntry{}
+	}
+	m.files[e.Path] = e
+}
+
+// Files returns the recorded files, sorted by path.
+func (m *Manifest) Files() []ManifestEntry {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	out := make([]ManifestEntry, 0, len(m.files))
+	for _, e := range m.files {
+		out = append(out, e)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
+
+// WriteJSON writes the manifest as a single JSON document.
+func (m *Manifest) WriteJSON(w io.Writer) error {
+	manifest := struct {
+		Files []ManifestEntry `json:"files"`
+	}{
+		Files: m.Files(),
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(manifest)
+}
+
+// addToManifest records the file at 'pathname', as it is now, in the
+// manifest.
+func (c *Context) addToManifest(pathname, pkgPath string, generators []string, cached bool) error {
+	b, err := c.fileSystem().ReadFile(pathname)
+	if err != nil {
+		return err
+	}
+	c.Manifest.Add(ManifestEntry{
+		Path:       pathname,
+		Package:    pkgPath,
+		Generators: append([]string(nil), generators...),
+		Cached:     cached,
+		Bytes:      len(b),
+		Hash:       contentHash(b),
+	})
+	return nil
+}
@@ -0,0 +1,237 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// PackageMetrics describes the execution of one output package.
+type PackageMetrics struct {
+	Path     string        `json:"path"`
+	Duration time.Duration `json:"duration"`
+	// True if the package was skipped because its inputs were unchanged.
+	Cached       bool `json:"cached,omitempty"`
+	Files        int  `json:"files"`
+	BytesWritten int  `json:"bytesWritten"`
+	// The time spent in each generator, by generator name.
+	Generators map[string]time.Duration `json:"generators,omitempty"`
+}
+
+// GeneratorMetrics describes the executions of one generator, summed over
+// all packages.
+type GeneratorMetrics struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration"`
+	Packages int           `json:"packages"`
+}
+
+// Metrics collects the time spent parsing and executing packages and
+// generators, and the output written. It is safe for concurrent use.
+type Metrics struct {
+	lock     sync.Mutex
+	parse    time.Duration
+	execute  time.Duration
+	packages map[string]*PackageMetrics
+}
+
+// NewMetrics returns empty metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{packages: map[string]*PackageMetrics{}}
+}
+
+// SetParseDuration records the time spent loading the inputs.
+func (m *Metrics) SetParseDuration(d time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.parse = d
+}
+
+// ParseDuration returns the time spent loading the inputs.
+func (m *Metrics) ParseDuration() time.Duration {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.parse
+}
+
+// SetExecuteDuration records the wall-clock time spent executing the
+// packages, which is less than their sum when they execute concurrently.
+func (m *Metrics) SetExecuteDuration(d time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.execute = d
+}
+
+// ExecuteDuration returns the wall-clock time spent executing the packages.
+func (m *Metrics) ExecuteDuration() time.Duration {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.execute
+}
+
+// update calls 'fn' with the metrics of the package 'path', under the lock.
+func (m *Metrics) update(path string, fn func(p *PackageMetrics)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	p := m.packages[path]
+	if p == nil {
+		p = &PackageMetrics{Path: path}
+		m.packages[path] = p
+	}
+	fn(p)
+}
+
+func (m *Metrics) addPackage(path string, d time.Duration, cached bool) {
+	m.update(path, func(p *PackageMetrics) {
+		p.Duration += d
+		p.Cached = p.Cached || cached
+	})
+}
+
+func (m *Metrics) addGenerator(path, name string, d time.Duration) {
+	m.update(path, func(p *PackageMetrics) {
+		if p.Generators == nil {
+			p.Generators = map[string]time.Duration{}
+		}
+		p.Generators[name] += d
+	})
+}
+
+func (m *Metrics) addFile(path string, bytes int) {
+	m.update(path, func(p *PackageMetrics) {
+		p.Files++
+		p.BytesWritten += bytes
+	})
+}
+
+// Packages returns the metrics of every executed package, sorted by path.
+func (m *Metrics) Packages() []PackageMetrics {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	out := make([]PackageMetrics, 0, len(m.packages))
+	for _, p := range m.packages {
+		c := *p
+		c.Generators = make(map[string]time.Duration, len(p.Generators))
+		for name, d := range p.Generators {
+			c.Generators[name] = d
+		}
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
+
+// Generators returns the metrics of every executed generator, slowest
+// first.
+func (m *Metrics) Generators() []GeneratorMetrics {
+	byName := map[string]*GeneratorMetrics{}
+	for _, p := range m.Packages() {
+		for name, d := range p.Generators {
+			g := byName[name]
+			if g == nil {
+				g = &GeneratorMetrics{Name: name}
+				byName[name] = g
+			}
+			g.Duration += d
+			g.Packages++
+		}
+	}
+	out := make([]GeneratorMetrics, 0, len(byName))
+	for _, g := range byName {
+		out = append(out, *g)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Duration != out[j].Duration {
+			return out[i].Duration > out[j].Duration
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// WriteJSON writes the metrics as a single JSON document. Durations are in
+// nanoseconds.
+func (m *Metrics) WriteJSON(w io.Writer) error {
+	packages := m.Packages()
+	report := struct {
+		Parse        time.Duration      `json:"parse"`
+		Execute      time.Duration      `json:"execute"`
+		Files        int                `json:"files"`
+		BytesWritten int                `json:"bytesWritten"`
+		Packages     []PackageMetrics   `json:"packages"`
+		Generators   []GeneratorMetrics `json:"generators"`
+	}{
+		Parse:      m.ParseDuration(),
+		Execute:    m.ExecuteDuration(),
+		Packages:   packages,
+		Generators: m.Generators(),
+	}
+	for _, p := range packages {
+		report.Files += p.Files
+		report.BytesWritten += p.BytesWritten
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// WriteText writes the metrics as human-readable tables.
+func (m *Metrics) WriteText(w io.Writer) error {
+	packages := m.Packages()
+	var files, bytes int
+	for _, p := range packages {
+		files += p.Files
+		bytes += p.BytesWritten
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "parse\t%v\n", m.ParseDuration())
+	fmt.Fprintf(tw, "execute\t%v\t%d files\t%d bytes\n", m.ExecuteDuration(), files, bytes)
+	fmt.Fprintf(tw, "\nPACKAGE\tDURATION\tFILES\tBYTES\n")
+	for _, p := range packages {
+		cached := ""
+		if p.Cached {
+			cached = "\t(cached)"
+		}
+		fmt.Fprintf(tw, "%s\t%v\t%d\t%d%s\n", p.Path, p.Duration, p.Files, p.BytesWritten, cached)
+	}
+	fmt.Fprintf(tw, "\nGENERATOR\tDURATION\tPACKAGES\n")
+	for _, g := range m.Generators() {
+		fmt.Fprintf(tw, "%s\t%v\t%d\n", g.Name, g.Duration, g.Packages)
+	}
+	return tw.Flush()
+}
+
+// meteredFileSystem records the files written to a FileSystem for a
+// package.
+type meteredFileSystem struct {
+	FileSystem
+	metrics *Metrics
+	path    string
+}
+
+func (fs meteredFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	if err := fs.FileSystem.WriteFile(name, data, perm); err != nil {
+		return err
+	}
+	fs.metrics.addFile(fs.path, len(data))
+	return nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// outputOwner is the package, and the generators in it, which produce an
+// output file.
+type outputOwner struct {
+	pkgPath    string
+	generators []string
+}
+
+func (o outputOwner) String() string {
+	return fmt.Sprintf("generator(s) %s of package %q", strings.Join(o.generators, ", "), o.pkgPath)
+}
+
+func (o outputOwner) equal(other outputOwner) bool {
+	if o.pkgPath != other.pkgPath || len(o.generators) != len(other.generators) {
+		return false
+	}
+	for i := range o.generators {
+		if o.generators[i] != other.generators[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// outputTracker remembers which package and generators planned each output
+// file, so that two of them writing the same file is an error rather than
+// the last one silently winning, and which files and directories were
+// generated at all, so that files left behind can be pruned. It is safe for
+// concurrent use.
+type outputTracker struct {
+	lock   sync.Mutex
+	owners map[string]outputOwner
+	// The files of packages which were skipped, because the cache says
+	// they are up to date.
+	kept map[string]bool
+	dirs map[string]bool
+}
+
+// visit records that a package was generated into 'dir'.
+func (t *outputTracker) visit(dir string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.dirs == nil {
+		t.dirs = map[string]bool{}
+	}
+	t.dirs[filepath.Clean(dir)] = true
+}
+
+// keep records that the file at 'pathname' is still generated, though it
+// wasn't planned in this run.
+func (t *outputTracker) keep(pathname string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.kept == nil {
+		t.kept = map[string]bool{}
+	}
+	t.kept[pathname] = true
+}
+
+// planned returns true if the file at 'pathname' was claimed or kept.
+func (t *outputTracker) planned(pathname string) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	_, ok := t.owners[pathname]
+	return ok || t.kept[pathname]
+}
+
+// visited returns the directories recorded by visit, sorted.
+func (t *outputTracker) visited() []string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	dirs := make([]string, 0, len(t.dirs))
+	for dir := range t.dirs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// claim records 'owner' as the producer of the file at 'pathname'. Claiming
+// a file again for the same owner, as watch and serve modes do, is fine.
+func (t *outputTracker) claim(pathname, pkgPath string, generators []string) error {
+	owner := outputOwner{pkgPath: pkgPath, generators: append([]string(nil), generators...)}
+	sort.Strings(owner.generators)
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.owners == nil {
+		t.owners = map[string]outputOwner{}
+	}
+	if prior, ok := t.owners[pathname]; ok && !prior.equal(owner) {
+		return fmt.Errorf("output %q of %s is also written by %s", pathname, owner, prior)
+	}
+	t.owners[pathname] = owner
+	return nil
+}
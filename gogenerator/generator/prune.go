@@ -0,0 +1,63 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// StaleFiles returns the files which carry the "Code generated by" line of
+// 'header', but which no Execute* call of this context planned, in the
+// output directories of the packages it executed and of the input
+// packages, under 'outDir'. These are what is left behind when types or
+// packages no longer need generating. The results are sorted by path.
+func (c *Context) StaleFiles(outDir string, header []byte) []VerifyResult {
+	if c.outputs == nil {
+		return nil
+	}
+	dirs := c.outputs.visited()
+	for _, pkgPath := range c.Inputs {
+		dirs = append(dirs, filepath.Clean(c.outputDirOf(outDir, pkgPath)))
+	}
+	sort.Strings(dirs)
+	var stale []VerifyResult
+	for i, dir := range dirs {
+		if i > 0 && dirs[i-1] == dir {
+			continue
+		}
+		produced := func(name string) bool { return c.outputs.planned(filepath.Join(dir, name)) }
+		stale = append(stale, findStaleFiles(c.fileSystem(), dir, header, produced)...)
+	}
+	return stale
+}
+
+// Prune removes the files StaleFiles returns, and returns them. The context's
+// FileSystem must be a FileRemover.
+func (c *Context) Prune(outDir string, header []byte) ([]VerifyResult, error) {
+	remover, ok := c.fileSystem().(FileRemover)
+	if !ok {
+		return nil, fmt.Errorf("unable to prune: %T can't remove files", c.fileSystem())
+	}
+	stale := c.StaleFiles(outDir, header)
+	for _, f := range stale {
+		c.logger().Infof("Removing stale file %q", f.Path)
+		if err := remover.Remove(f.Path); err != nil {
+			return nil, fmt.Errorf("unable to remove stale file %q: %v", f.Path, err)
+		}
+	}
+	return stale, nil
+}
@@ -15,10 +15,15 @@
 package generator
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"runtime"
+	"strconv"
+	"strings"
 	"text/template"
+
+	"github.com/lack-io/gogogen/gogenerator/namer"
 )
 
 // Snippet is an attempt to make the template library unable.
@@ -32,6 +37,71 @@ type SnippetWriter struct {
 	left, right string
 	funcMap     template.FuncMap
 	err         error
+	// Indents what Do and DoRaw write.
+	indent *indentWriter
+}
+
+// indentWriter prefixes every line but empty ones with 'depth' tabs.
+type indentWriter struct {
+	w     io.Writer
+	depth int
+	// Whether the next byte written starts a line.
+	lineStart bool
+}
+
+func (iw *indentWriter) Write(p []byte) (int, error) {
+	if iw.depth == 0 {
+		if len(p) > 0 {
+			iw.lineStart = p[len(p)-1] == '\n'
+		}
+		return iw.w.Write(p)
+	}
+	prefix := bytes.Repeat([]byte{'\t'}, iw.depth)
+	out := make([]byte, 0, len(p)+len(prefix))
+	for _, c := range p {
+		if iw.lineStart && c != '\n' {
+			out = append(out, prefix...)
+		}
+		out = append(out, c)
+		iw.lineStart = c == '\n'
+	}
+	if _, err := iw.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// SnippetFuncs are the functions every template passed to SnippetWriter.Do
+// may call, besides those of text/template and the name systems, which take
+// precedence. They are those of namer.TemplateFuncs, and:
+//
+// * "indent", which indents the lines of its second argument by as many tabs
+//   as its first, skipping empty lines
+// * "quote", which quotes a string as a Go string literal
+// * "join", which joins its second argument, a []string, by its first
+// * "hasPrefix" and "hasSuffix", as in the strings package, but taking the
+//   prefix or suffix first
+var SnippetFuncs = template.FuncMap{
+	"indent": func(n int, s string) string {
+		prefix := strings.Repeat("\t", n)
+		lines := strings.Split(s, "\n")
+		for i, line := range lines {
+			if line != "" {
+				lines[i] = prefix + line
+			}
+		}
+		return strings.Join(lines, "\n")
+	},
+	"quote":     strconv.Quote,
+	"join":      func(sep string, elems []string) string { return strings.Join(elems, sep) },
+	"hasPrefix": func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+	"hasSuffix": func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+}
+
+func init() {
+	for name, f := range namer.TemplateFuncs {
+		SnippetFuncs[name] = f
+	}
 }
 
 // w is the destination; left and right are the delimiters; @ and $ are both
@@ -46,6 +116,10 @@ func NewSnippetWriter(w io.Writer, c *Context, left, right string) *SnippetWrite
 		left:    left,
 		right:   right,
 		funcMap: template.FuncMap{},
+		indent:  &indentWriter{w: w, lineStart: true},
+	}
+	for name, f := range SnippetFuncs {
+		sw.funcMap[name] = f
 	}
 	for name, namer := range c.Namers {
 		sw.funcMap[name] = namer.Name
@@ -53,6 +127,22 @@ func NewSnippetWriter(w io.Writer, c *Context, left, right string) *SnippetWrite
 	return sw
 }
 
+// Funcs adds the functions in funcMap to those templates passed to Do may
+// call, replacing any of the same name, including the name systems. Funcs is
+// chainable.
+//
+// Example:
+//
+// sw := generator.NewSnippetWriter(outBuffer, context, "$", "$").
+// 	Funcs(template.FuncMap{"jsonName": jsonName})
+// sw.Do(`// $.|jsonName$ is the JSON name of $.Name.Name$.`, member)
+func (s *SnippetWriter) Funcs(funcMap template.FuncMap) *SnippetWriter {
+	for name, f := range funcMap {
+		s.funcMap[name] = f
+	}
+	return s
+}
+
 // Do parses format and runs args through it. You can have arbitrary logic in
 // the format (see the text/template documentation), but consider running many
 // short templates, with ordinary go logic between--this may by more
@@ -101,22 +191,120 @@ func (s *SnippetWriter) Do(format string, args interface{}) *SnippetWriter {
 	// Name the template by source file:line so it can be found when
 	// there's an error.
 	_, file, line, _ := runtime.Caller(1)
+	name := fmt.Sprintf("%s:%d", file, line)
 	tmpl, err := template.
-		New(fmt.Sprintf("%s:%d", file, line)).
+		New(name).
 		Delims(s.left, s.right).
 		Funcs(s.funcMap).
 		Parse(format)
 	if err != nil {
-		s.err = err
+		s.err = newSnippetError(file, line, name, format, err)
 		return s
 	}
-	err = tmpl.Execute(s.w, args)
+	err = tmpl.Execute(s.indent, args)
 	if err != nil {
+		s.err = newSnippetError(file, line, name, format, err)
+	}
+	return s
+}
+
+// DoRaw writes 'text' as it is, other than indenting it, for code which is
+// already rendered. Like Do, it is chainable and does nothing after an
+// error.
+func (s *SnippetWriter) DoRaw(text string) *SnippetWriter {
+	if s.err != nil {
+		return s
+	}
+	if _, err := io.WriteString(s.indent, text); err != nil {
 		s.err = err
 	}
 	return s
 }
 
+// Indent indents the lines Do and DoRaw write from now on by one more tab,
+// so nested code can be written without tabs in the templates. Empty lines
+// are not indented. Indent is chainable.
+//
+// Example:
+//
+// sw.Do("switch v := v.(type) {\n", nil)
+// for _, t := range variants {
+// 	sw.Do("case $.|raw$:\n", t)
+// 	sw.Indent().Do("return visitor.Visit$.|public$(v)\n", t).Dedent()
+// }
+// sw.Do("}\n", nil)
+func (s *SnippetWriter) Indent() *SnippetWriter {
+	s.indent.depth++
+	return s
+}
+
+// Dedent undoes the last call to Indent. Dedent is chainable.
+func (s *SnippetWriter) Dedent() *SnippetWriter {
+	if s.indent.depth > 0 {
+		s.indent.depth--
+	}
+	return s
+}
+
+// SnippetError is the error of a template passed to SnippetWriter.Do.
+type SnippetError struct {
+	// Where Do was called.
+	File string
+	Line int
+	// The line of the template the error is on, counting from 1, or 0 if
+	// it is unknown.
+	SnippetLine int
+	// The text of that line.
+	Source string
+	// The error of text/template.
+	Err error
+
+	// The error, without the template name and position text/template
+	// prefixes it with.
+	msg string
+}
+
+func (e *SnippetError) Error() string {
+	if e.SnippetLine == 0 {
+		return fmt.Sprintf("%s:%d: snippet: %v", e.File, e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s:%d: snippet line %d: %s\n\t%s", e.File, e.Line, e.SnippetLine, e.msg, strings.TrimSpace(e.Source))
+}
+
+func (e *SnippetError) Unwrap() error {
+	return e.Err
+}
+
+// newSnippetError makes the error of the template 'name', with the text
+// 'format', called for from file:line. The position text/template reports,
+// as in "template: name:3:7: ...", is parsed to find the snippet line.
+func newSnippetError(file string, line int, name, format string, err error) *SnippetError {
+	e := &SnippetError{File: file, Line: line, Err: err}
+	msg := err.Error()
+	prefix := "template: " + name + ":"
+	if !strings.HasPrefix(msg, prefix) {
+		return e
+	}
+	rest := strings.TrimPrefix(msg, prefix)
+	// The line, then the column for execution errors.
+	pos := strings.SplitN(rest, ":", 3)
+	n, convErr := strconv.Atoi(pos[0])
+	if convErr != nil || len(pos) < 2 {
+		return e
+	}
+	rest = strings.TrimPrefix(rest, pos[0]+":")
+	if _, convErr := strconv.Atoi(pos[1]); convErr == nil && len(pos) == 3 {
+		rest = pos[2]
+	}
+	rest = strings.Replace(strings.TrimSpace(rest), fmt.Sprintf("executing %q ", name), "", 1)
+	e.SnippetLine = n
+	if lines := strings.Split(format, "\n"); n <= len(lines) {
+		e.Source = lines[n-1]
+	}
+	e.msg = rest
+	return e
+}
+
 // Args exists to make it convenient to construct arguments for
 // SnippetWriter.Do.
 type Args map[interface{}]interface{}
@@ -139,6 +327,9 @@ func (a Args) WithArgs(key, value interface{}) Args {
 	return a2
 }
 
+// Out returns the writer the snippet writer writes to. What is written to it
+// directly is not indented, and should end with a newline if what follows is
+// indented.
 func (s *SnippetWriter) Out() io.Writer {
 	return s.w
 }
@@ -0,0 +1,165 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// executeSplitBody runs the generator 'g' like executeBody, but writes the
+// code of each type to the file its split calls for, starting files with
+// 'fileFor'. 'main' is the generator's file. It returns the files written to.
+func (c *Context) executeSplitBody(main *File, g SplitGenerator, fileFor func(name string) (*File, error)) ([]*File, error) {
+	split := g.Split(c)
+	main.pruneImports = true
+	written := []*File{main}
+	seen := map[*File]bool{main: true}
+
+	et := NewErrorTracker(&main.Body)
+	if err := g.Init(c, et); err != nil {
+		return nil, err
+	}
+	if err := et.Error(); err != nil {
+		return nil, err
+	}
+
+	// The current part of each file the code of types goes to.
+	parts := map[string]int{}
+	buf := &bytes.Buffer{}
+	for _, t := range c.Order {
+		buf.Reset()
+		et := NewErrorTracker(buf)
+		if err := g.GenerateType(c, t, et); err != nil {
+			return nil, &GenerationError{Type: t, Pos: t.Position, Err: err}
+		}
+		if err := et.Error(); err != nil {
+			return nil, err
+		}
+		if buf.Len() == 0 {
+			continue
+		}
+		name := main.Name
+		if split.ByType != nil {
+			if n := split.ByType(t); n != "" {
+				name = n
+			}
+		}
+		if parts[name] == 0 {
+			parts[name] = 1
+		}
+		f, err := fileFor(partName(name, parts[name]))
+		if err != nil {
+			return nil, err
+		}
+		if split.MaxLines > 0 && f.Body.Len() > 0 && lineCount(f) >= split.MaxLines {
+			parts[name]++
+			if f, err = fileFor(partName(name, parts[name])); err != nil {
+				return nil, err
+			}
+		}
+		f.Body.Write(buf.Bytes())
+		if !seen[f] {
+			seen[f] = true
+			f.pruneImports = true
+			written = append(written, f)
+		}
+	}
+
+	et = NewErrorTracker(&main.Body)
+	if err := g.Finalize(c, et); err != nil {
+		return nil, err
+	}
+	return written, et.Error()
+}
+
+// partName returns the name of the n-th part of the file 'name'.
+func partName(name string, n int) string {
+	if n <= 1 {
+		return name
+	}
+	ext := filepath.Ext(name)
+	return fmt.Sprintf("%s_%d%s", strings.TrimSuffix(name, ext), n, ext)
+}
+
+// lineCount returns the number of lines generated into 'f' so far.
+func lineCount(f *File) int {
+	return bytes.Count(f.Vars.Bytes(), []byte("\n")) + bytes.Count(f.Consts.Bytes(), []byte("\n")) + bytes.Count(f.Body.Bytes(), []byte("\n"))
+}
+
+// usedImports returns the imports of the Go file 'f' which its code refers
+// to. Imports which can't be matched with the code, such as ones without a
+// local name, and all imports of files which aren't Go or don't parse, are
+// kept.
+func usedImports(f *File) map[string]struct{} {
+	if f.FileType != GolangFileType {
+		return f.Imports
+	}
+	src := &bytes.Buffer{}
+	fmt.Fprintf(src, "package %s\n\n", f.PackageName)
+	if f.Vars.Len() > 0 {
+		fmt.Fprintf(src, "var (\n%s)\n\n", f.Vars.Bytes())
+	}
+	if f.Consts.Len() > 0 {
+		fmt.Fprintf(src, "const (\n%s)\n\n", f.Consts.Bytes())
+	}
+	src.Write(f.Body.Bytes())
+	file, err := parser.ParseFile(token.NewFileSet(), f.Name, src.Bytes(), 0)
+	if err != nil {
+		return f.Imports
+	}
+	used := map[string]bool{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if id, ok := sel.X.(*ast.Ident); ok {
+				used[id.Name] = true
+			}
+		}
+		return true
+	})
+
+	imports := map[string]struct{}{}
+	for imp := range f.Imports {
+		name := importName(imp)
+		if name == "" || name == "_" || name == "." || !token.IsIdentifier(name) || used[name] {
+			imports[imp] = struct{}{}
+		}
+	}
+	return imports
+}
+
+// importName returns the local name of the import spec 'imp', such as
+// `foo "example.com/foo"`, or "" if it can't tell.
+func importName(imp string) string {
+	fields := strings.Fields(imp)
+	switch len(fields) {
+	case 1:
+		p, err := strconv.Unquote(fields[0])
+		if err != nil {
+			return ""
+		}
+		return path.Base(p)
+	case 2:
+		return fields[0]
+	}
+	return ""
+}
@@ -0,0 +1,92 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/lack-io/gogogen/gogenerator/types"
+)
+
+// tagIndex maps the names of comment tags to the types carrying them. It is
+// built on first use, and shared by the contexts derived from one another.
+type tagIndex struct {
+	once  sync.Once
+	types map[string][]*types.Type
+}
+
+// build indexes the tags of the types of 'u', in the comment lines
+// immediately before them and the ones before those.
+func (ix *tagIndex) build(u types.Universe) {
+	ix.types = map[string][]*types.Type{}
+	for _, p := range u.SortedPackages() {
+		for _, t := range p.SortedTypes() {
+			seen := map[string]bool{}
+			for _, lines := range [][]string{t.SecondClosestCommentLines, t.CommentLines} {
+				for _, line := range lines {
+					line = strings.Trim(line, " ")
+					if !strings.HasPrefix(line, "+") || len(line) == 1 {
+						continue
+					}
+					name := line[1:]
+					if i := strings.Index(name, "="); i >= 0 {
+						name = name[:i]
+					}
+					if !seen[name] {
+						seen[name] = true
+						ix.types[name] = append(ix.types[name], t)
+					}
+				}
+			}
+		}
+	}
+}
+
+// TypesWithTag returns the types of the input packages which carry the
+// comment tag 'name', written with the "+" marker, in any of its forms as
+// in types.CommentTags.Has, sorted by name. Types excluded by the registered
+// filters are left out. The tags of all types are indexed on first use, so
+// generators need not scan the comments of every type.
+func (ctxt *Context) TypesWithTag(name string) []*types.Type {
+	ix := ctxt.tagIndex
+	if ix == nil {
+		ix = &tagIndex{}
+		ctxt.tagIndex = ix
+	}
+	ix.once.Do(func() { ix.build(ctxt.Universe) })
+
+	inputs := map[string]bool{}
+	for _, path := range ctxt.Inputs {
+		inputs[path] = true
+	}
+	seen := map[*types.Type]bool{}
+	out := []*types.Type{}
+	for key, tagged := range ix.types {
+		// "+name:key=value" tags are indexed by "name:key".
+		if key != name && !strings.HasPrefix(key, name+":") {
+			continue
+		}
+		for _, t := range tagged {
+			if !seen[t] && inputs[t.Name.Package] && ctxt.included(t) {
+				seen[t] = true
+				out = append(out, t)
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name.String() < out[j].Name.String() })
+	return out
+}
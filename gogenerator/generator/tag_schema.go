@@ -0,0 +1,387 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"fmt"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lack-io/gogogen/gogenerator/types"
+)
+
+// TagValueType is the kind of value a comment tag takes.
+type TagValueType int
+
+const (
+	// TagValueNone tags take no value, as in +name.
+	TagValueNone TagValueType = iota
+	// TagValueString tags take any value, as in +name=value.
+	TagValueString
+	// TagValueBool tags take "true" or "false", and +name alone means true.
+	TagValueBool
+	// TagValueInt tags take an integer.
+	TagValueInt
+	// TagValueJSON tags take a JSON value, as in +name={"key":"value"}.
+	TagValueJSON
+	// TagValueParams tags take parameters, as in +name:key1=value1,key2.
+	TagValueParams
+)
+
+// TagScope is a set of the places a comment tag is allowed on.
+type TagScope int
+
+const (
+	TagScopePackage TagScope = 1 << iota
+	TagScopeType
+	TagScopeMember
+)
+
+func (s TagScope) String() string {
+	switch s {
+	case TagScopePackage:
+		return "packages"
+	case TagScopeType:
+		return "types"
+	case TagScopeMember:
+		return "fields"
+	}
+	return fmt.Sprintf("TagScope(%d)", int(s))
+}
+
+// TagSchema declares a comment tag a generator accepts. Tags are written
+// with the "+" marker; Name doesn't include it.
+type TagSchema struct {
+	Name  string
+	Value TagValueType
+	Scope TagScope
+
+	// For TagValueString tags, the values allowed. Empty means any.
+	Values []string
+
+	// For TagValueParams tags, the parameter keys allowed. Empty means any.
+	Params []string
+
+	// Whether the tag may be given more than once on a declaration.
+	Repeated bool
+
+	// Whether the tag is deprecated. Its uses are still accepted, but are
+	// warned about, or are errors if the context's StrictTags is set.
+	Deprecated bool
+
+	// For deprecated tags, the name of the tag to use instead, if any.
+	ReplacedBy string
+}
+
+// TagError is a comment tag which is unknown or doesn't match its schema.
+type TagError struct {
+	Position token.Position
+	Tag      string
+	Err      string
+}
+
+func (e *TagError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", e.Position, e.Tag, e.Err)
+}
+
+// TagErrors are all the comment tag errors found in the inputs, in order.
+type TagErrors []*TagError
+
+func (e TagErrors) Error() string {
+	lines := make([]string, 0, len(e))
+	for _, err := range e {
+		lines = append(lines, err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// deprecatedTagUse is a use of a deprecated comment tag.
+type deprecatedTagUse struct {
+	schema   *TagSchema
+	position token.Position
+}
+
+type tagNamespace struct {
+	name    string
+	schemas map[string][]TagSchema
+}
+
+// RegisterTagSchemas declares the comment tags a generator accepts in
+// 'namespace', e.g. "gogogen:enum-gen". Once any are registered,
+// ExecutePackages validates the tags of the input packages before
+// generating, and fails on tags in a registered namespace which have no
+// schema or don't match it. A tag may have several schemas, for different
+// scopes.
+func (ctxt *Context) RegisterTagSchemas(namespace string, schemas ...TagSchema) {
+	var ns *tagNamespace
+	for _, n := range ctxt.tagNamespaces {
+		if n.name == namespace {
+			ns = n
+		}
+	}
+	if ns == nil {
+		ns = &tagNamespace{name: namespace, schemas: map[string][]TagSchema{}}
+		ctxt.tagNamespaces = append(ctxt.tagNamespaces, ns)
+	}
+	for _, s := range schemas {
+		ns.schemas[s.Name] = append(ns.schemas[s.Name], s)
+	}
+	ctxt.tagsValidated = false
+}
+
+// ValidateTags checks the comment tags of the input packages, their types
+// and their types' fields against the registered schemas. It returns
+// TagErrors if any don't match. Uses of deprecated tags are logged as
+// warnings, once per tag, unless StrictTags is set, in which case they are
+// errors too. Unless more schemas are registered, later calls return the
+// same result without checking again.
+func (ctxt *Context) ValidateTags() error {
+	if ctxt.tagsValidated {
+		return ctxt.tagsErr
+	}
+	ctxt.tagsValidated = true
+	ctxt.tagsErr = ctxt.validateTags()
+	return ctxt.tagsErr
+}
+
+func (ctxt *Context) validateTags() error {
+	if len(ctxt.tagNamespaces) == 0 {
+		return nil
+	}
+	var errs TagErrors
+	var deprecated []deprecatedTagUse
+	inputs := append([]string{}, ctxt.Inputs...)
+	sort.Strings(inputs)
+	for _, path := range inputs {
+		pkg := ctxt.Universe[path]
+		if pkg == nil {
+			continue
+		}
+		errs, deprecated = ctxt.validateTagLines(errs, deprecated, TagScopePackage, token.Position{Filename: pkg.SourcePath}, nil, pkg.Comments)
+
+		names := make([]string, 0, len(pkg.Types))
+		for name := range pkg.Types {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			t := pkg.Types[name]
+			if t.Name.Package != pkg.Path {
+				continue
+			}
+			errs, deprecated = ctxt.validateTagLines(errs, deprecated, TagScopeType, t.Position, t.SecondClosestCommentLines, t.CommentLines)
+			if t.Kind != types.Struct {
+				continue
+			}
+			for _, m := range t.Members {
+				// Fields declared on the type's line share its comments.
+				if m.Position.Filename == t.Position.Filename && m.Position.Line == t.Position.Line {
+					continue
+				}
+				errs, deprecated = ctxt.validateTagLines(errs, deprecated, TagScopeMember, m.Position, m.SecondClosestCommentLines, m.CommentLines)
+			}
+		}
+	}
+	sort.SliceStable(deprecated, func(i, j int) bool {
+		return positionLess(deprecated[i].position, deprecated[j].position)
+	})
+	if ctxt.StrictTags {
+		for _, use := range deprecated {
+			errs = append(errs, &TagError{Position: use.position, Tag: "+" + use.schema.Name, Err: deprecationMessage(use.schema)})
+		}
+	} else {
+		ctxt.warnDeprecatedTags(deprecated)
+	}
+	if len(errs) > 0 {
+		sort.SliceStable(errs, func(i, j int) bool {
+			return positionLess(errs[i].Position, errs[j].Position)
+		})
+		return errs
+	}
+	return nil
+}
+
+func positionLess(a, b token.Position) bool {
+	if a.Filename != b.Filename {
+		return a.Filename < b.Filename
+	}
+	return a.Line < b.Line
+}
+
+func deprecationMessage(s *TagSchema) string {
+	if s.ReplacedBy != "" {
+		return fmt.Sprintf("deprecated, use +%s instead", s.ReplacedBy)
+	}
+	return "deprecated"
+}
+
+// warnDeprecatedTags logs one warning for each deprecated tag used, listing
+// where it is used.
+func (ctxt *Context) warnDeprecatedTags(uses []deprecatedTagUse) {
+	var names []string
+	positions := map[string][]string{}
+	schemas := map[string]*TagSchema{}
+	for _, use := range uses {
+		name := use.schema.Name
+		if _, ok := positions[name]; !ok {
+			names = append(names, name)
+			schemas[name] = use.schema
+		}
+		positions[name] = append(positions[name], use.position.String())
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ctxt.logger().Warnf("Tag +%s is %s; used at:\n\t%s", name, deprecationMessage(schemas[name]), strings.Join(positions[name], "\n\t"))
+	}
+}
+
+// validateTagLines validates the tags of one declaration at 'pos', adding to
+// 'errs' and 'deprecated'. The lines of 'closest' are taken to directly
+// precede it, so that each tag's own line can be reported; tags in 'second'
+// are reported at the declaration.
+func (ctxt *Context) validateTagLines(errs TagErrors, deprecated []deprecatedTagUse, scope TagScope, pos token.Position, second, closest []string) (TagErrors, []deprecatedTagUse) {
+	counts := map[*tagNamespace]map[string]int{}
+	check := func(line string, pos token.Position) {
+		line = strings.Trim(line, " ")
+		if !strings.HasPrefix(line, "+") {
+			return
+		}
+		text := line[1:]
+		for _, ns := range ctxt.tagNamespaces {
+			if text != ns.name && !strings.HasPrefix(text, ns.name+":") && !strings.HasPrefix(text, ns.name+"=") {
+				continue
+			}
+			name, err := validateTag(ns, scope, text)
+			if err != "" {
+				errs = append(errs, &TagError{Position: pos, Tag: line, Err: err})
+				continue
+			}
+			if counts[ns] == nil {
+				counts[ns] = map[string]int{}
+			}
+			schema := findSchema(ns, name, scope)
+			counts[ns][name]++
+			if counts[ns][name] == 2 && !schema.Repeated {
+				errs = append(errs, &TagError{Position: pos, Tag: line, Err: "may only be given once"})
+			}
+			if schema.Deprecated {
+				deprecated = append(deprecated, deprecatedTagUse{schema: schema, position: pos})
+			}
+		}
+	}
+	for _, line := range second {
+		check(line, pos)
+	}
+	for i, line := range closest {
+		linePos := pos
+		if linePos.Line > 0 {
+			linePos.Line -= len(closest) - i
+			linePos.Column = 0
+		}
+		check(line, linePos)
+	}
+	return errs, deprecated
+}
+
+func findSchema(ns *tagNamespace, name string, scope TagScope) *TagSchema {
+	for i, s := range ns.schemas[name] {
+		if s.Scope&scope != 0 {
+			return &ns.schemas[name][i]
+		}
+	}
+	return nil
+}
+
+// validateTag returns the name of the schema 'text', a tag without its
+// marker, matches, or why it doesn't match any.
+func validateTag(ns *tagNamespace, scope TagScope, text string) (string, string) {
+	name, value, hasValue := text, "", false
+	if i := strings.Index(text, "="); i != -1 {
+		name, value, hasValue = text[:i], text[i+1:], true
+	}
+	if _, ok := ns.schemas[name]; !ok {
+		// Otherwise it may be a params tag, named by the part before a ':'.
+		name = ""
+		for n, schemas := range ns.schemas {
+			if schemas[0].Value == TagValueParams && strings.HasPrefix(text, n+":") && len(n) > len(name) {
+				name = n
+			}
+		}
+		if name == "" {
+			return "", "unknown tag"
+		}
+	}
+	s := findSchema(ns, name, scope)
+	if s == nil {
+		return "", fmt.Sprintf("not allowed on %s", scope)
+	}
+
+	switch s.Value {
+	case TagValueNone:
+		if hasValue {
+			return "", "takes no value"
+		}
+	case TagValueString:
+		if v, err := strconv.Unquote(value); err == nil {
+			value = v
+		}
+		if len(s.Values) > 0 && !containsString(s.Values, value) {
+			return "", fmt.Sprintf("unsupported value %q, want one of %q", value, s.Values)
+		}
+	case TagValueBool:
+		if hasValue && value != "true" && value != "false" {
+			return "", fmt.Sprintf("value %q is not boolean", value)
+		}
+	case TagValueInt:
+		if _, err := strconv.ParseInt(value, 0, 64); err != nil {
+			return "", fmt.Sprintf("value %q is not an integer", value)
+		}
+	case TagValueJSON:
+		var v interface{}
+		if _, err := types.ParseCommentTags("+", []string{"+" + text}).Decode(name, &v); err != nil {
+			return "", err.Error()
+		}
+	case TagValueParams:
+		if text == name {
+			return name, ""
+		}
+		if !strings.HasPrefix(text, name+":") {
+			return "", "takes parameters, as in +" + name + ":key=value"
+		}
+		params, err := types.ExtractCommentTagParams("+", name, []string{"+" + text})
+		if err != nil {
+			return "", err.Error()
+		}
+		if len(s.Params) > 0 {
+			for _, p := range params {
+				if !containsString(s.Params, p.Key) {
+					return "", fmt.Sprintf("unknown parameter %q, want one of %q", p.Key, s.Params)
+				}
+			}
+		}
+	}
+	return name, ""
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
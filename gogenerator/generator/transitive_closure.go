@@ -52,7 +52,7 @@ func transitiveClosure(in map[string][]string) map[string][]string {
 	for i := range in {
 		for j := range imports {
 			if adj[edge{i, j}] {
-				out[j] = append(out[i], j)
+				out[i] = append(out[i], j)
 			}
 		}
 
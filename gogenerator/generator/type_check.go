@@ -0,0 +1,110 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/scanner"
+	tc "go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// maxTypeCheckErrors is how many errors are reported for a file which
+// doesn't type check, as the go command reports.
+const maxTypeCheckErrors = 10
+
+// typeCheck assembles the Go files of 'files' which haven't failed in
+// memory, as if they were written to the directory 'dir' for the package
+// 'pkgPath', and type checks them with the rest of the package. The errors
+// are returned by file name. Files which can't be assembled are left for
+// the assembly proper to report.
+func (c *Context) typeCheck(pkgPath, dir string, files map[string]*File, failed map[string]bool) map[string]error {
+	if c.builder == nil {
+		c.logger().Warnf("Unable to type check the output for %q, the context has no parser.Builder", pkgPath)
+		return nil
+	}
+	mem := NewMemFileSystem()
+	srcs := map[string][]byte{}
+	names := map[string]string{}
+	for name, f := range files {
+		if failed[name] || !strings.HasSuffix(name, ".go") {
+			continue
+		}
+		assembler, ok := c.FileTypes[f.FileType]
+		if !ok {
+			continue
+		}
+		pathname, err := filepath.Abs(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		inMemory := *f
+		inMemory.FS = mem
+		if err := assembler.AssembleFile(&inMemory, pathname); err != nil {
+			continue
+		}
+		if srcs[pathname], err = mem.ReadFile(pathname); err != nil {
+			delete(srcs, pathname)
+			continue
+		}
+		names[pathname] = name
+	}
+	if len(srcs) == 0 {
+		return nil
+	}
+
+	out := map[string]error{}
+	for pathname, errs := range c.builder.CheckFiles(pkgPath, srcs) {
+		if len(errs) > 0 {
+			out[names[pathname]] = typeCheckError(srcs[pathname], errs)
+		}
+	}
+	return out
+}
+
+// typeCheckError describes the errors 'errs' of the Go file 'src', with the
+// lines they are on, as the file isn't written for them to be looked up.
+func typeCheckError(src []byte, errs []error) error {
+	sort.SliceStable(errs, func(i, j int) bool { return errorLine(errs[i]) < errorLine(errs[j]) })
+	lines := bytes.Split(src, []byte("\n"))
+	b := &strings.Builder{}
+	b.WriteString("the output does not type check:")
+	for i, err := range errs {
+		if i == maxTypeCheckErrors {
+			b.WriteString("\n\ttoo many errors")
+			break
+		}
+		fmt.Fprintf(b, "\n\t%v", err)
+		if line := errorLine(err); line > 0 && line <= len(lines) {
+			fmt.Fprintf(b, "\n\t\t%s", bytes.TrimSpace(lines[line-1]))
+		}
+	}
+	return errors.New(b.String())
+}
+
+// errorLine returns the line a type checker or parser error is on, or 0.
+func errorLine(err error) int {
+	switch err := err.(type) {
+	case tc.Error:
+		return err.Fset.Position(err.Pos).Line
+	case *scanner.Error:
+		return err.Pos.Line
+	}
+	return 0
+}
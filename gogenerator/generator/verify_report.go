@@ -0,0 +1,162 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package generator
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// VerifyStatus describes the outcome of verifying a single output file.
+type VerifyStatus string
+
+const (
+	// VerifyOK means the file on disk matches the generated output.
+	VerifyOK VerifyStatus = "ok"
+	// VerifyChanged means the file on disk differs from the generated output.
+	VerifyChanged VerifyStatus = "changed"
+	// VerifyMissing means the generated output has no file on disk.
+	VerifyMissing VerifyStatus = "missing"
+	// VerifyStale means a previously generated file exists on disk, but is
+	// no longer produced by the generators.
+	VerifyStale VerifyStatus = "stale"
+)
+
+// VerifyResult is the machine-readable outcome of verifying one file.
+type VerifyResult struct {
+	Path           string       `json:"path"`
+	Status         VerifyStatus `json:"status"`
+	ExistingBytes  int          `json:"existingBytes"`
+	GeneratedBytes int          `json:"generatedBytes"`
+	ExistingHash   string       `json:"existingHash,omitempty"`
+	GeneratedHash  string       `json:"generatedHash,omitempty"`
+	// Fixed is set if the file was written again to match the output.
+	Fixed bool `json:"fixed,omitempty"`
+}
+
+// VerifyReport collects the results of a verify-only run. It is safe for
+// concurrent use.
+type VerifyReport struct {
+	lock  sync.Mutex
+	files []VerifyResult
+}
+
+// VerifyReporter is implemented by file types which can describe the outcome
+// of a verification, rather than only returning an error on drift.
+type VerifyReporter interface {
+	VerifyFileResult(f *File, path string) (VerifyResult, error)
+}
+
+// Add records a result in the report.
+func (r *VerifyReport) Add(result VerifyResult) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.files = append(r.files, result)
+}
+
+// Files returns the recorded results, sorted by path.
+func (r *VerifyReport) Files() []VerifyResult {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	out := append([]VerifyResult(nil), r.files...)
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
+
+// Drifted returns true if any recorded file is not VerifyOK.
+func (r *VerifyReport) Drifted() bool {
+	for _, f := range r.Files() {
+		if f.Status != VerifyOK {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteJSON writes the report as a single JSON document.
+func (r *VerifyReport) WriteJSON(w io.Writer) error {
+	report := struct {
+		Drifted bool           `json:"drifted"`
+		Files   []VerifyResult `json:"files"`
+	}{
+		Drifted: r.Drifted(),
+		Files:   r.Files(),
+	}
+	if report.Files == nil {
+		report.Files = []VerifyResult{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+func contentHash(b []byte) string {
+	sum := sha256.Sum256(b)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// generatedByLine returns the "Code generated by" line of a header, if any.
+func generatedByLine(header []byte) []byte {
+	for _, line := range bytes.Split(header, []byte("\n")) {
+		if bytes.HasPrefix(line, []byte("// Code generated by ")) {
+			// Without the comment marker, so files which aren't Go match too.
+			return bytes.TrimPrefix(line, []byte("// "))
+		}
+	}
+	return nil
+}
+
+// findStaleFiles returns the files in 'dir' which carry the same "Code
+// generated by" line as 'header', but which 'produced' says are not
+// generated any more. Backups kept by Fix are not generated files, so they
+// are skipped.
+func findStaleFiles(fs FileSystem, dir string, header []byte, produced func(name string) bool) []VerifyResult {
+	marker := generatedByLine(header)
+	if marker == nil {
+		return nil
+	}
+	infos, err := fs.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var stale []VerifyResult
+	for _, info := range infos {
+		if info.IsDir() || strings.HasSuffix(info.Name(), BackupSuffix) {
+			continue
+		}
+		if produced(info.Name()) {
+			continue
+		}
+		pathname := filepath.Join(dir, info.Name())
+		existing, err := fs.ReadFile(pathname)
+		if err != nil || !bytes.Contains(existing, marker) {
+			continue
+		}
+		stale = append(stale, VerifyResult{
+			Path:          pathname,
+			Status:        VerifyStale,
+			ExistingBytes: len(existing),
+			ExistingHash:  contentHash(existing),
+		})
+	}
+	return stale
+}
@@ -0,0 +1,107 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package namer
+
+import (
+	"sync"
+
+	"github.com/lack-io/gogogen/gogenerator/types"
+)
+
+// NameLookup is implemented by namers which remember the names they make.
+type NameLookup interface {
+	Namer
+	// Names returns a copy of the names made thus far, which later calls
+	// to Name don't change.
+	Names() Names
+}
+
+// nameCache holds the names a namer has made. It is safe for concurrent
+// use. Names are only ever added: once a name is returned for a type, every
+// goroutine gets the same name for it, even if two of them made it at once.
+type nameCache struct {
+	lock  sync.RWMutex
+	names Names
+}
+
+// get returns the name recorded for 't', if any.
+func (c *nameCache) get(t *types.Type) (string, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	name, ok := c.names[t]
+	return name, ok
+}
+
+// add records 'name' for 't', unless a name was recorded for it meanwhile,
+// and returns the recorded name.
+func (c *nameCache) add(t *types.Type, name string) string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if existing, ok := c.names[t]; ok {
+		return existing
+	}
+	if c.names == nil {
+		c.names = Names{}
+	}
+	c.names[t] = name
+	return name
+}
+
+// reset forgets all recorded names.
+func (c *nameCache) reset() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.names = nil
+}
+
+// snapshot returns a copy of the recorded names.
+func (c *nameCache) snapshot() Names {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	out := make(Names, len(c.names))
+	for t, name := range c.names {
+		out[t] = name
+	}
+	return out
+}
+
+// cachedNamer remembers the names of a namer.
+type cachedNamer struct {
+	namer Namer
+	cache nameCache
+}
+
+// Cached returns a namer which names types by 'n', calling it once per
+// type. If 'n' is safe for concurrent use, so is the returned namer. Namers
+// which already remember their names are returned as they are.
+func Cached(n Namer) NameLookup {
+	if l, ok := n.(NameLookup); ok {
+		return l
+	}
+	return &cachedNamer{namer: n}
+}
+
+// Name returns the name 'n' gives 't'.
+func (c *cachedNamer) Name(t *types.Type) string {
+	if name, ok := c.cache.get(t); ok {
+		return name
+	}
+	return c.cache.add(t, c.namer.Name(t))
+}
+
+// Names returns a copy of the names made thus far.
+func (c *cachedNamer) Names() Names {
+	return c.cache.snapshot()
+}
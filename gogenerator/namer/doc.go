@@ -26,4 +26,15 @@
 //
 // Additionally, a "RawNamer" can optionally keep track of what needs to be
 // imported
+//
+// When types of several packages are named in one output package, a
+// UniqueNamer keeps their names from colliding.
+//
+// Name systems which are simple transforms of the names of types can be
+// defined by a template instead of a Namer implementation; see
+// NewTemplateNamer.
+//
+// The namers of this package are safe for concurrent use, and remember the
+// name they make for each type; Cached does the same for any other Namer.
+// Names returns an immutable copy of the names made thus far.
 package namer
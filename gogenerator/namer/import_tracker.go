@@ -15,6 +15,8 @@
 package namer
 
 import (
+	"fmt"
+	"go/token"
 	"sort"
 
 	"github.com/lack-io/gogogen/gogenerator/types"
@@ -31,6 +33,8 @@ type DefaultImportTracker struct {
 	// it here to prevent us from naming any package "go")
 	nameToPath map[string]string
 	local      types.Name
+	// Local names pinned by SetAlias, by path.
+	aliases map[string]string
 
 	// Returns true if a given types an invalid type and should be ignored.
 	IsInvalidType func(*types.Type) bool
@@ -45,9 +49,36 @@ func NewDefaultImportTracker(local types.Name) DefaultImportTracker {
 		pathToName: map[string]string{},
 		nameToPath: map[string]string{},
 		local:      local,
+		aliases:    map[string]string{},
 	}
 }
 
+// SetAlias pins the local name of the package at 'path' to 'alias', instead
+// of leaving it to LocalName. The alias is reserved at once, so that no other
+// package is given it, and the package is imported by it if any of its types
+// is added. Aliases should be pinned before types are added, as adding a
+// type gives its package a name which can't change.
+func (tracker *DefaultImportTracker) SetAlias(path, alias string) error {
+	if !token.IsIdentifier(alias) || token.Lookup(alias).IsKeyword() {
+		return fmt.Errorf("invalid alias %q of package %q", alias, path)
+	}
+	if other, ok := tracker.nameToPath[alias]; ok && other != path {
+		return fmt.Errorf("alias %q of package %q is already the name of package %q", alias, path, other)
+	}
+	if name, ok := tracker.pathToName[path]; ok && name != alias {
+		return fmt.Errorf("package %q is already imported as %q", path, name)
+	}
+	if tracker.aliases == nil {
+		tracker.aliases = map[string]string{}
+	}
+	if old, ok := tracker.aliases[path]; ok && old != alias {
+		delete(tracker.nameToPath, old)
+	}
+	tracker.aliases[path] = alias
+	tracker.nameToPath[alias] = path
+	return nil
+}
+
 func (tracker *DefaultImportTracker) AddTypes(types ...*types.Type) {
 	for _, t := range types {
 		tracker.AddType(t)
@@ -79,7 +110,10 @@ func (tracker *DefaultImportTracker) AddType(t *types.Type) {
 	if _, ok := tracker.pathToName[path]; ok {
 		return
 	}
-	name := tracker.LocalName(t.Name)
+	name, ok := tracker.aliases[path]
+	if !ok {
+		name = tracker.LocalName(t.Name)
+	}
 	tracker.nameToPath[name] = path
 	tracker.pathToName[path] = name
 }
@@ -17,6 +17,7 @@ package namer
 import (
 	"path/filepath"
 	"strings"
+	"unicode"
 
 	"github.com/lack-io/gogogen/gogenerator/types"
 )
@@ -138,8 +139,94 @@ type NameStrategy struct {
 	// of FrobbingFoo, 2 givens ServerFrobbingFoo, etc.
 	PrependPackageNames int
 
-	// A cache of names thus far assigned by this namer.
-	Names
+	// Words, in all capitals, to be spelled in all capitals wherever they
+	// are a word of a name, as in "HTTPServer" rather than "HttpServer". In
+	// camelCase names, they are spelled in all lowercase letters when they
+	// come first. See WithInitialisms.
+	Initialisms map[string]bool
+
+	// The names thus far assigned by this namer. It is safe for concurrent
+	// use, so the namer may be shared by concurrently executing packages.
+	cache nameCache
+}
+
+// CommonInitialisms are the initialisms of golint, for namers to be given
+// with WithInitialisms.
+var CommonInitialisms = []string{
+	"ACL", "API", "ASCII", "CPU", "CSS", "DNS", "EOF", "GUID", "HTML", "HTTP",
+	"HTTPS", "ID", "IP", "JSON", "LHS", "QPS", "RAM", "RHS", "RPC", "SLA",
+	"SMTP", "SQL", "SSH", "TCP", "TLS", "TTL", "UDP", "UI", "UID", "UUID",
+	"URI", "URL", "UTF8", "VM", "XML", "XMPP", "XSRF", "XSS",
+}
+
+// WithInitialisms adds words to the initialisms of the namer, and returns it.
+// Words are matched regardless of their case, so that e.g. both "Grpc" and
+// "GRPC" become "GRPC" given "grpc". It is meant to be called before the
+// namer names anything.
+func (ns *NameStrategy) WithInitialisms(words ...string) *NameStrategy {
+	if ns.Initialisms == nil {
+		ns.Initialisms = map[string]bool{}
+	}
+	for _, w := range words {
+		ns.Initialisms[strings.ToUpper(w)] = true
+	}
+	// Forget the names made without them.
+	ns.cache.reset()
+	return ns
+}
+
+// splitWords splits a CamelCase name into its words: a word starts at an
+// uppercase letter after a lowercase one, at the last of a run of uppercase
+// letters followed by a lowercase one, and at a digit after a letter.
+// Underscores are words of their own.
+func splitWords(name string) []string {
+	runes := []rune(name)
+	words := []string{}
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		prev, cur := runes[i-1], runes[i]
+		split := false
+		switch {
+		case cur == '_' || prev == '_':
+			split = true
+		case unicode.IsUpper(cur) && (unicode.IsLower(prev) || unicode.IsDigit(prev)):
+			split = true
+		case unicode.IsUpper(cur) && unicode.IsUpper(prev) && i+1 < len(runes) && unicode.IsLower(runes[i+1]):
+			split = true
+		case unicode.IsDigit(cur) && unicode.IsLetter(prev):
+			split = true
+		}
+		if split {
+			words = append(words, string(runes[start:i]))
+			start = i
+		}
+	}
+	return append(words, string(runes[start:]))
+}
+
+// applyInitialisms spells the initialisms of the namer in 'name' in all
+// capitals, or in all lowercase letters if they start a camelCase name.
+func (ns *NameStrategy) applyInitialisms(name string) string {
+	if len(ns.Initialisms) == 0 || name == "" {
+		return name
+	}
+	private := IsPrivateGoName(name)
+	words := splitWords(IC(name))
+	for i, w := range words {
+		if !ns.Initialisms[strings.ToUpper(w)] {
+			continue
+		}
+		if i == 0 && private {
+			words[i] = strings.ToLower(w)
+		} else {
+			words[i] = strings.ToUpper(w)
+		}
+	}
+	out := strings.Join(words, "")
+	if private {
+		out = IL(out)
+	}
+	return out
 }
 
 // IC ensure the first character is uppercase.
@@ -203,12 +290,14 @@ func (ns *NameStrategy) filterDirs(path string) []string {
 	return dirs
 }
 
+// Names returns a copy of the names made thus far.
+func (ns *NameStrategy) Names() Names {
+	return ns.cache.snapshot()
+}
+
 // See the comment on NameStrategy
 func (ns *NameStrategy) Name(t *types.Type) string {
-	if ns.Names == nil {
-		ns.Names = Names{}
-	}
-	if s, ok := ns.Names[t]; ok {
+	if s, ok := ns.cache.get(t); ok {
 		return s
 	}
 
@@ -219,9 +308,8 @@ func (ns *NameStrategy) Name(t *types.Type) string {
 		if i > dn {
 			i = dn
 		}
-		name := ns.Join(ns.Prefix, dirs[dn-i:], ns.Suffix)
-		ns.Names[t] = name
-		return name
+		name := ns.applyInitialisms(ns.Join(ns.Prefix, dirs[dn-i:], ns.Suffix))
+		return ns.cache.add(t, name)
 	}
 
 	// Only anonymous types remain.
@@ -254,15 +342,15 @@ func (ns *NameStrategy) Name(t *types.Type) string {
 		name = ns.Join(ns.Prefix, names, ns.Suffix)
 	case types.Chan:
 		name = ns.Join(ns.Prefix, []string{
-			"Chan",
+			string(t.ChanDir) + "Chan",
 			ns.removePrefixAndSuffix(ns.Name(t.Elem)),
 		}, ns.Suffix)
 	case types.Interface:
 		// TODO: add to name test
 		names := []string{"Interface"}
-		for _, m := range t.Methods {
+		for _, name := range t.SortedMethodNames() {
 			// TODO: include function sigature
-			names = append(names, m.Name.Name)
+			names = append(names, t.Methods[name].Name.Name)
 		}
 		name = ns.Join(ns.Prefix, names, ns.Suffix)
 	case types.Func:
@@ -279,8 +367,8 @@ func (ns *NameStrategy) Name(t *types.Type) string {
 	default:
 		name = "unnameable_" + string(t.Kind)
 	}
-	ns.Names[t] = name
-	return name
+	name = ns.applyInitialisms(name)
+	return ns.cache.add(t, name)
 }
 
 // ImportTracker allows a raw namer to keep track of the packages needed for
@@ -295,17 +383,19 @@ type ImportTracker interface {
 type rawNamer struct {
 	pkg     string
 	tracker ImportTracker
-	Names
+	cache   nameCache
+}
+
+// Names returns a copy of the names made thus far.
+func (r *rawNamer) Names() Names {
+	return r.cache.snapshot()
 }
 
 // Name makes a name the way you'd write it to literally refer to type t,
 // making ordinary assumptions about how you've imported t's package (or using
 // r.tracker to specifically track the package imports).
 func (r *rawNamer) Name(t *types.Type) string {
-	if r.Names == nil {
-		r.Names = Names{}
-	}
-	if name, ok := r.Names[t]; ok {
+	if name, ok := r.cache.get(t); ok {
 		return name
 	}
 	if t.Name.Package != "" {
@@ -324,8 +414,7 @@ func (r *rawNamer) Name(t *types.Type) string {
 				name = filepath.Join(t.Name.Package) + "." + t.Name.Name
 			}
 		}
-		r.Names[t] = name
-		return name
+		return r.cache.add(t, name)
 	}
 	var name string
 	switch t.Kind {
@@ -344,35 +433,56 @@ func (r *rawNamer) Name(t *types.Type) string {
 		}
 		name = "struct{" + strings.Join(elems, "; ") + "}"
 	case types.Chan:
-		// TODO: include directionality
-		name = "chan " + r.Name(t.Elem)
+		elem := r.Name(t.Elem)
+		switch t.ChanDir {
+		case types.SendOnly:
+			name = "chan<- " + elem
+		case types.RecvOnly:
+			name = "<-chan " + elem
+		default:
+			if t.Elem.Kind == types.Chan && t.Elem.ChanDir == types.RecvOnly && t.Elem.Name.Package == "" {
+				// chan <-chan T would be read as chan<- (chan T).
+				elem = "(" + elem + ")"
+			}
+			name = "chan " + elem
+		}
 	case types.Interface:
+		if len(t.Name.Name) > 0 && !strings.HasPrefix(t.Name.Name, "interface{") {
+			// A predeclared interface, such as error.
+			name = t.Name.Name
+			break
+		}
 		// TODO: add to name set
 		elems := []string{}
-		for _, m := range t.Methods {
+		for _, name := range t.SortedMethodNames() {
 			// TODO: include function signature
-			elems = append(elems, m.Name.Name)
+			elems = append(elems, t.Methods[name].Name.Name)
 		}
 		name = "interface{" + strings.Join(elems, "; ") + "}"
 	case types.Func:
 		// TODO: add to name test
 		params := []string{}
-		for _, pt := range t.Signature.Parameters {
+		for i, pt := range t.Signature.Parameters {
+			if t.Signature.Variadic && i == len(t.Signature.Parameters)-1 && pt.Kind == types.Slice {
+				params = append(params, "..."+r.Name(pt.Elem))
+				continue
+			}
 			params = append(params, r.Name(pt))
 		}
 		results := []string{}
 		for _, rt := range t.Signature.Results {
 			results = append(results, r.Name(rt))
 		}
-		name = "func(" + strings.Join(params, ",") + "}"
-		if len(results) == 1 {
+		name = "func(" + strings.Join(params, ", ") + ")"
+		switch len(results) {
+		case 0:
+		case 1:
 			name += " " + results[0]
-		} else {
-			name += " (" + strings.Join(results, ",") + ")"
+		default:
+			name += " (" + strings.Join(results, ", ") + ")"
 		}
 	default:
 		name = "unnameable_" + string(t.Kind)
 	}
-	r.Names[t] = name
-	return name
+	return r.cache.add(t, name)
 }
\ No newline at end of file
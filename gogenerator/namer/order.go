@@ -26,34 +26,29 @@ type Orderer struct {
 }
 
 // OrderUniverse assigns a name to every type in the Universe, including Types,
-// Functions and Variables, and returns a list sorted by those names.
+// Functions and Variables, and returns a list sorted by those names. Types
+// with the same name are in the order of the paths of their packages.
 func (o *Orderer) OrderUniverse(u types.Universe) []*types.Type {
 	list := tList{
 		namer: o.Namer,
 	}
-	for _, p := range u {
-		for _, t := range p.Types {
-			list.types = append(list.types, t)
-		}
-		for _, f := range p.Functions {
-			list.types = append(list.types, f)
-		}
-		for _, v := range p.Variables {
-			list.types = append(list.types, v)
-		}
+	for _, p := range u.SortedPackages() {
+		list.types = append(list.types, p.SortedTypes()...)
+		list.types = append(list.types, p.SortedFunctions()...)
+		list.types = append(list.types, p.SortedVariables()...)
 	}
-	sort.Sort(list)
+	sort.Stable(list)
 	return list.types
 }
 
 // OrderTypes assigns a name to every type, and returns a list sorted by those
-// names
+// names. Types with the same name keep their order in 'typeList'.
 func (o *Orderer) OrderTypes(typeList []*types.Type) []*types.Type {
 	list := tList{
 		namer: o.Namer,
 		types: typeList,
 	}
-	sort.Sort(list)
+	sort.Stable(list)
 	return list.types
 }
 
@@ -16,12 +16,65 @@ package namer
 
 import (
 	"strings"
+	"unicode"
 
 	"github.com/lack-io/gogogen/gogenerator/types"
 )
 
 var consonants = "bacdfghjklmnpqrstvwxyz"
 
+// irregularPlurals are the plurals of the lowercase words the rules get
+// wrong.
+var irregularPlurals = map[string]string{
+	"child":     "children",
+	"criterion": "criteria",
+	"datum":     "data",
+	"echo":      "echoes",
+	"elf":       "elves",
+	"foot":      "feet",
+	"goose":     "geese",
+	"half":      "halves",
+	"hero":      "heroes",
+	"knife":     "knives",
+	"leaf":      "leaves",
+	"life":      "lives",
+	"loaf":      "loaves",
+	"man":       "men",
+	"mouse":     "mice",
+	"person":    "people",
+	"potato":    "potatoes",
+	"quiz":      "quizzes",
+	"self":      "selves",
+	"shelf":     "shelves",
+	"thief":     "thieves",
+	"tomato":    "tomatoes",
+	"tooth":     "teeth",
+	"veto":      "vetoes",
+	"wife":      "wives",
+	"wolf":      "wolves",
+	"woman":     "women",
+}
+
+// irregularSingulars are the singulars of the irregular plurals.
+var irregularSingulars = func() map[string]string {
+	m := map[string]string{}
+	for singular, plural := range irregularPlurals {
+		m[plural] = singular
+	}
+	return m
+}()
+
+// uncountables are the lowercase words which are their own plural.
+var uncountables = map[string]bool{
+	"data":        true,
+	"equipment":   true,
+	"information": true,
+	"metadata":    true,
+	"news":        true,
+	"series":      true,
+	"species":     true,
+}
+
 type pluralNamer struct {
 	// key is the case-sensitive type name, value is the case-insensitive
 	// intended output.
@@ -50,54 +103,154 @@ func NewAllLowercasePluralNamer(exceptions map[string]string) *pluralNamer {
 // Name returns the plural form of the type's name. If the type's name is found
 // in the exceptions map, the map value is returned.
 func (r *pluralNamer) Name(t *types.Type) string {
-	singular := t.Name.Name
-	var plural string
-	var ok bool
-	if plural, ok = r.exceptions[singular]; ok {
+	if plural, ok := r.exceptions[t.Name.Name]; ok {
 		return r.finalize(plural)
 	}
-	if len(singular) < 2 {
+	return r.finalize(Pluralize(t.Name.Name))
+}
+
+type singularNamer struct {
+	// key is the case-sensitive type name, value is the case-insensitive
+	// intended output.
+	exceptions map[string]string
+	finalize   func(string) string
+}
+
+// NewPublicSingularNamer returns a namer that returns the singular form of the
+// input type's name, starting with a uppercase letter. It is meant for types
+// named in the plural, as lists of items often are.
+func NewPublicSingularNamer(exceptions map[string]string) *singularNamer {
+	return &singularNamer{exceptions, IC}
+}
+
+// NewPrivateSingularNamer returns a namer that returns the singular form of the
+// input type's name, starting with a lowercase letter.
+func NewPrivateSingularNamer(exceptions map[string]string) *singularNamer {
+	return &singularNamer{exceptions, IL}
+}
+
+// NewAllLowercaseSingularNamer returns a namer that returns the singular form of
+// the input type's name, with all letters in lowercase.
+func NewAllLowercaseSingularNamer(exceptions map[string]string) *singularNamer {
+	return &singularNamer{exceptions, strings.ToLower}
+}
+
+// Name returns the singular form of the type's name. If the type's name is
+// found in the exceptions map, the map value is returned.
+func (r *singularNamer) Name(t *types.Type) string {
+	if singular, ok := r.exceptions[t.Name.Name]; ok {
 		return r.finalize(singular)
 	}
+	return r.finalize(Singularize(t.Name.Name))
+}
 
-	switch rune(singular[len(singular)-1]) {
-	case 's', 'x', 'z':
-		plural = esPlural(singular)
-	case 'y':
-		sl := rune(singular[len(singular)-2])
-		if isConsonant(sl) {
-			plural = iesPlural(singular)
-		} else {
-			plural = sPlural(singular)
-		}
-	case 'h':
-		sl := rune(singular[len(singular)-2])
-		if sl == 'c' || sl == 's' {
-			plural = esPlural(singular)
-		} else {
-			plural = sPlural(singular)
+// Pluralize returns the plural form of a CamelCase name, which is the plural
+// of its last word: Pluralize("NetworkPolicy") is "NetworkPolicies". A last
+// word in all capitals gets a lowercase ending, as in "APIs".
+func Pluralize(name string) string {
+	return inflectLastWord(name, pluralOf)
+}
+
+// Singularize returns the singular form of a CamelCase name, which is the
+// singular of its last word: Singularize("NetworkPolicies") is
+// "NetworkPolicy". Words which don't look plural are kept as they are.
+func Singularize(name string) string {
+	// The plural of an acronym, as in "APIs", is the acronym with a
+	// lowercase ending.
+	if i := strings.LastIndexFunc(name, unicode.IsUpper); i >= 1 && unicode.IsUpper(rune(name[i-1])) {
+		if ending := name[i+1:]; ending == "s" || ending == "es" {
+			return name[:i+1]
 		}
-	case 'e':
-		sl := rune(singular[len(singular)-2])
-		if sl == 'f' {
-			plural = vesPlural(singular[:len(singular)-1])
+	}
+	return inflectLastWord(name, singularOf)
+}
+
+// inflectLastWord replaces the last word of 'name' with its inflection by
+// 'inflect', which takes and returns lowercase words. The case of the first
+// letter of the word is kept, and so is that of the rest, up to the end of
+// the shorter of the two.
+func inflectLastWord(name string, inflect func(string) string) string {
+	if len(name) < 2 {
+		return name
+	}
+	words := splitWords(name)
+	last := words[len(words)-1]
+	head := name[:len(name)-len(last)]
+	lower := strings.ToLower(last)
+	inflected := inflect(lower)
+	if inflected == lower {
+		return name
+	}
+
+	// Keep the capitals of the word, e.g. "API" to "APIs".
+	in, out := []rune(last), []rune(inflected)
+	for i := range out {
+		if i < len(in) && unicode.ToLower(in[i]) == out[i] {
+			out[i] = in[i]
 		} else {
-			plural = sPlural(singular)
+			break
 		}
-	case 'f':
-		plural = vesPlural(singular)
-	default:
-		plural = sPlural(singular)
 	}
-	return r.finalize(singular)
+	if len(out) > 0 && len(in) > 0 && unicode.IsUpper(in[0]) {
+		out[0] = unicode.ToUpper(out[0])
+	}
+	return head + string(out)
 }
 
-func iesPlural(singular string) string {
-	return singular[:len(singular)-1] + "ies"
+// pluralOf returns the plural of a lowercase word.
+func pluralOf(word string) string {
+	if plural, ok := irregularPlurals[word]; ok {
+		return plural
+	}
+	if uncountables[word] || len(word) < 2 {
+		return word
+	}
+
+	last, beforeLast := rune(word[len(word)-1]), rune(word[len(word)-2])
+	switch {
+	case strings.HasSuffix(word, "sis"):
+		// "analysis" to "analyses".
+		return word[:len(word)-2] + "es"
+	case last == 's' || last == 'x' || last == 'z':
+		return esPlural(word)
+	case last == 'y' && isConsonant(beforeLast):
+		return iesPlural(word)
+	case last == 'h' && (beforeLast == 'c' || beforeLast == 's'):
+		return esPlural(word)
+	}
+	return sPlural(word)
 }
 
-func vesPlural(singular string) string {
-	return singular[:len(singular)-1] + "ves"
+// singularOf returns the singular of a lowercase word.
+func singularOf(word string) string {
+	if singular, ok := irregularSingulars[word]; ok {
+		return singular
+	}
+	if uncountables[word] || len(word) < 2 {
+		return word
+	}
+
+	switch {
+	case strings.HasSuffix(word, "ss"), strings.HasSuffix(word, "us"), strings.HasSuffix(word, "is"):
+		// "class", "status" and "analysis" are singular already.
+		return word
+	case strings.HasSuffix(word, "ies") && len(word) > 3 && isConsonant(rune(word[len(word)-4])):
+		return word[:len(word)-3] + "y"
+	case strings.HasSuffix(word, "yses"):
+		return word[:len(word)-2] + "is"
+	case strings.HasSuffix(word, "sses"), strings.HasSuffix(word, "xes"), strings.HasSuffix(word, "zes"),
+		strings.HasSuffix(word, "shes"), strings.HasSuffix(word, "ches") && !strings.HasSuffix(word, "aches"),
+		strings.HasSuffix(word, "uses") && !strings.HasSuffix(word, "auses"):
+		// "statuses" to "status", but "causes" to "cause".
+		return word[:len(word)-2]
+	case strings.HasSuffix(word, "s"):
+		return word[:len(word)-1]
+	}
+	return word
+}
+
+func iesPlural(singular string) string {
+	return singular[:len(singular)-1] + "ies"
 }
 
 func esPlural(singular string) string {
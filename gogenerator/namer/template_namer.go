@@ -0,0 +1,172 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package namer
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+
+	"github.com/lack-io/gogogen/gogenerator/types"
+)
+
+// TemplateData is what the template of a template namer names a type from.
+type TemplateData struct {
+	// The name of the type, without its package. Empty for anonymous types.
+	Name string
+	// The package of the type. Empty for anonymous and builtin types.
+	Package TemplatePackage
+	// The kind of the type, as in "struct".
+	Kind string
+	// The name by which the type is written in its own package, as in
+	// "Foo" or "map[string]int".
+	Raw string
+	// The type itself.
+	Type *types.Type
+}
+
+// TemplatePackage is the package of a type, to a template namer.
+type TemplatePackage struct {
+	// The import path of the package.
+	Path string
+	// The last element of the path, which is usually its name.
+	Name string
+}
+
+// TemplateFuncs are the functions templates of template namers may call,
+// besides those of text/template.
+var TemplateFuncs = template.FuncMap{
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"title":      IC,
+	"untitle":    IL,
+	"plural":     Pluralize,
+	"singular":   Singularize,
+	"camel":      camelWords,
+	"snake":      func(s string) string { return joinWords(s, "_") },
+	"kebab":      func(s string) string { return joinWords(s, "-") },
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":    func(old, new, s string) string { return strings.Replace(s, old, new, -1) },
+}
+
+// joinWords returns the words of a CamelCase name, in lowercase, joined by
+// 'sep', as in "http_server" for "HTTPServer" and "_".
+func joinWords(s, sep string) string {
+	words := []string{}
+	for _, w := range splitWords(s) {
+		if w != "_" {
+			words = append(words, strings.ToLower(w))
+		}
+	}
+	return strings.Join(words, sep)
+}
+
+// camelWords joins the words of a name as camelCase, as in "httpServer" for
+// "http_server", "http-server" or "HTTPServer".
+func camelWords(s string) string {
+	words := []string{}
+	for _, w := range splitWords(strings.Replace(s, "-", "_", -1)) {
+		if w == "_" {
+			continue
+		}
+		if len(words) == 0 {
+			words = append(words, strings.ToLower(w))
+		} else {
+			words = append(words, IC(w))
+		}
+	}
+	return strings.Join(words, "")
+}
+
+// NewTemplateNamer returns a namer naming types by executing a text/template
+// on their TemplateData, with the functions of TemplateFuncs. For example,
+// the template:
+//
+//	{{.Package.Name}}_{{.Name | lower}}
+//
+// names the type Foo of package example.com/bar "bar_foo". It returns an
+// error if the template can't be parsed, or can't name a sample type.
+func NewTemplateNamer(text string) (Namer, error) {
+	tmpl, err := template.New("namer").Funcs(TemplateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid name template %q: %v", text, err)
+	}
+	n := &templateNamer{text: text, tmpl: tmpl}
+	sample := &types.Type{Name: types.Name{Package: "example.com/sample", Name: "Sample"}, Kind: types.Struct}
+	if _, err := n.name(sample); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// AddTemplate adds a name system named 'name' to the name systems, naming
+// types by the template 'text'. See NewTemplateNamer.
+func (ns NameSystems) AddTemplate(name, text string) error {
+	n, err := NewTemplateNamer(text)
+	if err != nil {
+		return err
+	}
+	ns[name] = n
+	return nil
+}
+
+type templateNamer struct {
+	text  string
+	tmpl  *template.Template
+	cache nameCache
+}
+
+// Name names the type by the template. It panics if the template fails on
+// the type, which checking the template on a sample type when it is made
+// doesn't rule out.
+func (n *templateNamer) Name(t *types.Type) string {
+	if s, ok := n.cache.get(t); ok {
+		return s
+	}
+	name, err := n.name(t)
+	if err != nil {
+		panic(err)
+	}
+	return n.cache.add(t, name)
+}
+
+// Names returns a copy of the names made thus far.
+func (n *templateNamer) Names() Names {
+	return n.cache.snapshot()
+}
+
+func (n *templateNamer) name(t *types.Type) (string, error) {
+	data := TemplateData{
+		Name: t.Name.Name,
+		Kind: string(t.Kind),
+		Raw:  NewRawNamer(t.Name.Package, nil).Name(t),
+		Type: t,
+	}
+	if len(t.Name.Package) > 0 {
+		data.Package = TemplatePackage{Path: t.Name.Package, Name: path.Base(t.Name.Package)}
+	}
+	if len(t.Name.Package) == 0 && t.Kind != types.Builtin {
+		// Anonymous types only have Raw.
+		data.Name = ""
+	}
+	b := &bytes.Buffer{}
+	if err := n.tmpl.Execute(b, data); err != nil {
+		return "", fmt.Errorf("name template %q failed on type %v: %v", n.text, t, err)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,138 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package namer
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/lack-io/gogogen/gogenerator/types"
+)
+
+// maxPrependedPackageNames bounds how many package directory names a
+// UniqueNamer prepends before it falls back to numbering names.
+const maxPrependedPackageNames = 32
+
+// UniqueNamer is a namer which never gives two types the same name, as
+// needed when types of several source packages, such as foo/v1 and bar/v1,
+// are named in a single output package. A type is named as by its
+// NameStrategy, unless another type already has that name; then the package
+// directory names which tell the two types apart are prepended, as in
+// "barV1Thing" for bar/v1.Thing when foo/v1.Thing is "thing". If no number
+// of directory names does, a number is appended.
+//
+// The types named first keep the shortest names, so types should be named
+// in a stable order, such as the Order of the generator context. A
+// UniqueNamer should be made for each output package, as by the Namers of
+// a generator, rather than shared by all of them. It is safe for concurrent
+// use.
+type UniqueNamer struct {
+	// The strategies prepending PrependPackageNames of the template, plus
+	// the index, package directory names, made as they are needed.
+	strategies []*NameStrategy
+	template   *NameStrategy
+
+	lock  sync.Mutex
+	taken map[string]*types.Type
+	cache nameCache
+}
+
+// NewUniqueNamer returns a UniqueNamer naming types as 'ns' does. The
+// names 'ns' made so far are not taken into account.
+func NewUniqueNamer(ns *NameStrategy) *UniqueNamer {
+	return &UniqueNamer{
+		template: ns,
+		taken:    map[string]*types.Type{},
+	}
+}
+
+// NewUniquePrivateNamer is a helper function that returns a UniqueNamer
+// making camelCase names, as NewPrivateNamer does.
+func NewUniquePrivateNamer(prependPackageNames int, ignoreWords ...string) *UniqueNamer {
+	return NewUniqueNamer(NewPrivateNamer(prependPackageNames, ignoreWords...))
+}
+
+// Names returns a copy of the names made thus far.
+func (u *UniqueNamer) Names() Names {
+	return u.cache.snapshot()
+}
+
+// Name returns the unique name of 't'.
+func (u *UniqueNamer) Name(t *types.Type) string {
+	if name, ok := u.cache.get(t); ok {
+		return name
+	}
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if name, ok := u.cache.get(t); ok {
+		return name
+	}
+
+	name := u.strategy(0).Name(t)
+	if owner, ok := u.taken[name]; ok && owner != t {
+		name = u.disambiguate(t, owner, name)
+	}
+	u.taken[name] = t
+	return u.cache.add(t, name)
+}
+
+// disambiguate returns a name for 't' which 'owner' of the same 'name'
+// doesn't share, and no other type has.
+func (u *UniqueNamer) disambiguate(t, owner *types.Type, name string) string {
+	prev := name
+	for extra := 1; extra <= maxPrependedPackageNames; extra++ {
+		s := u.strategy(extra)
+		candidate := s.Name(t)
+		if candidate == s.Name(owner) {
+			if candidate == prev {
+				// Neither has any more directory names to tell them apart.
+				break
+			}
+			prev = candidate
+			continue
+		}
+		if _, taken := u.taken[candidate]; !taken {
+			return candidate
+		}
+		prev = candidate
+	}
+	for i := 2; ; i++ {
+		candidate := name + strconv.Itoa(i)
+		if _, taken := u.taken[candidate]; !taken {
+			return candidate
+		}
+	}
+}
+
+// strategy returns the strategy prepending 'extra' more package directory
+// names than the template.
+func (u *UniqueNamer) strategy(extra int) *NameStrategy {
+	for len(u.strategies) <= extra {
+		ns := &NameStrategy{
+			Prefix:              u.template.Prefix,
+			Suffix:              u.template.Suffix,
+			Join:                u.template.Join,
+			IgnoreWords:         u.template.IgnoreWords,
+			PrependPackageNames: u.template.PrependPackageNames + len(u.strategies),
+			Initialisms:         u.template.Initialisms,
+		}
+		u.strategies = append(u.strategies, ns)
+	}
+	return u.strategies[extra]
+}
+
+var (
+	_ = NameLookup(&UniqueNamer{})
+)
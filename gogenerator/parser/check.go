@@ -0,0 +1,81 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	tc "go/types"
+	"path/filepath"
+)
+
+// CheckFiles type checks the Go sources 'srcs', keyed by absolute path, as
+// files of the package 'pkgPath', together with the files already parsed for
+// it except those at the same paths, as a generator's output would be
+// compiled. Imports are resolved like those of the parsed packages, so the
+// packages already loaded aren't loaded again. Only the errors in 'srcs' are
+// returned, keyed by path; errors in the other files are left to the go
+// command. It is safe to call CheckFiles from several goroutines, but not
+// concurrently with other methods of the Builder.
+func (b *Builder) CheckFiles(pkgPath string, srcs map[string][]byte) map[string][]error {
+	b.checkLock.Lock()
+	defer b.checkLock.Unlock()
+
+	errs := map[string][]error{}
+	files := []*ast.File{}
+	for path, src := range srcs {
+		f, err := parser.ParseFile(b.fset, path, src, parser.DeclarationErrors|parser.ParseComments)
+		if err != nil {
+			if list, ok := err.(scanner.ErrorList); ok {
+				for _, e := range list {
+					errs[path] = append(errs[path], e)
+				}
+			} else {
+				errs[path] = append(errs[path], err)
+			}
+			continue
+		}
+		files = append(files, f)
+	}
+	if len(files) == 0 {
+		return errs
+	}
+	for _, parsed := range b.parsed[importPathString(pkgPath)] {
+		abs, err := filepath.Abs(parsed.name)
+		if err != nil {
+			abs = parsed.name
+		}
+		if _, replaced := srcs[abs]; !replaced {
+			files = append(files, parsed.file)
+		}
+	}
+
+	c := tc.Config{
+		FakeImportC: b.IncludeCgoFiles,
+		Importer:    importAdapter{b},
+		Sizes:       b.sizes(),
+		Error: func(err error) {
+			if e, ok := err.(tc.Error); ok {
+				path := e.Fset.Position(e.Pos).Filename
+				if _, ok := srcs[path]; ok {
+					errs[path] = append(errs[path], e)
+				}
+			}
+		},
+	}
+	c.Check(pkgPath, b.fset, files, nil)
+	return errs
+}
@@ -0,0 +1,70 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	tc "go/types"
+)
+
+// Error is an error loading, parsing or type checking the sources of a
+// package, at the position it is about, where known.
+type Error struct {
+	// The import path of the package.
+	Package string
+	// Where the error is. Only Filename is set for errors about a whole
+	// file, and nothing for errors about the package.
+	Pos token.Position
+
+	Err error
+}
+
+func (e *Error) Error() string {
+	switch {
+	case e.Pos.IsValid():
+		return fmt.Sprintf("%v: %v", e.Pos, e.Err)
+	case e.Pos.Filename != "":
+		return fmt.Sprintf("%s: %v", e.Pos.Filename, e.Err)
+	}
+	return fmt.Sprintf("package %q: %v", e.Package, e.Err)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// newError attributes 'err', from the file 'filename' if not empty, to the
+// package 'pkgPath'. The positions of syntax and type errors are kept, and
+// the messages of those errors no longer repeat them.
+func newError(pkgPath importPathString, filename string, err error) *Error {
+	e := &Error{Package: string(pkgPath), Pos: token.Position{Filename: filename}, Err: err}
+	switch err := err.(type) {
+	case scanner.ErrorList:
+		if len(err) == 0 {
+			break
+		}
+		e.Pos = err[0].Pos
+		msg := err[0].Msg
+		if len(err) > 1 {
+			msg += fmt.Sprintf(" (and %d more errors)", len(err)-1)
+		}
+		e.Err = errors.New(msg)
+	case tc.Error:
+		e.Pos = err.Fset.Position(err.Pos)
+		e.Err = errors.New(err.Msg)
+	}
+	return e
+}
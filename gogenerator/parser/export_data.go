@@ -0,0 +1,141 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/importer"
+	tc "go/types"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/lack-io/gogogen/util/log"
+)
+
+// importExportData loads the package 'path' from the compiler's export data,
+// if ExportData is set and the go command can produce it. It returns nil
+// if the package should be parsed from source instead.
+func (b *Builder) importExportData(path string) *tc.Package {
+	if !b.ExportData || path == "C" {
+		return nil
+	}
+	if pkg, ok := b.exportPackages[path]; ok {
+		return pkg
+	}
+	if _, listed := b.exportFiles[path]; !listed {
+		b.listExportData(path)
+	}
+	var pkg *tc.Package
+	if file := b.exportFiles[path]; file != "" {
+		if b.exportImporter == nil {
+			b.exportImporter = importer.ForCompiler(b.fset, "gc", func(path string) (io.ReadCloser, error) {
+				file := b.exportFiles[path]
+				if file == "" {
+					return nil, fmt.Errorf("no export data for %q", path)
+				}
+				return os.Open(file)
+			})
+		}
+		var err error
+		if pkg, err = b.exportImporter.Import(path); err != nil {
+			log.Debugf("loading export data of %q failed, parsing it instead: %v", path, err)
+			pkg = nil
+		}
+	}
+	b.exportPackages[path] = pkg
+	return pkg
+}
+
+// listExportData has the go command build the export data of 'path', and of
+// all packages imported by the packages parsed so far, with their
+// dependencies, and records where it is. Doing them together saves running
+// the go command per package. Packages it fails for are recorded without
+// export data.
+func (b *Builder) listExportData(path string) {
+	paths := map[string]bool{path: true}
+	for _, imports := range b.importGraph {
+		for p := range imports {
+			if _, listed := b.exportFiles[p]; !listed && p != "C" && !b.isParsed(p) {
+				paths[p] = true
+			}
+		}
+	}
+	args := []string{"list", "-e", "-export", "-deps", "-f", "{{.ImportPath}}\t{{.Export}}"}
+	if len(b.context.BuildTags) > 0 {
+		args = append(args, "-tags", strings.Join(b.context.BuildTags, ","))
+	}
+	sorted := []string{}
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Strings(sorted)
+	args = append(args, sorted...)
+
+	cmd := exec.Command(b.goCommand(), args...)
+	cmd.Dir = b.Dir
+	cmd.Env = append(os.Environ(), "GOOS="+b.context.GOOS, "GOARCH="+b.context.GOARCH)
+	if !b.IncludeCgoFiles {
+		cmd.Env = append(cmd.Env, "CGO_ENABLED=0")
+	}
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		log.Debugf("go list -export failed, parsing dependencies instead: %v: %s", err, stderr.String())
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), "\t", 2)
+		if len(fields) == 2 {
+			b.exportFiles[fields[0]] = fields[1]
+		}
+	}
+	for p := range paths {
+		if _, listed := b.exportFiles[p]; !listed {
+			b.exportFiles[p] = ""
+		}
+	}
+}
+
+// isParsed reports whether the package 'path' was, or is about to be,
+// parsed from source.
+func (b *Builder) isParsed(path string) bool {
+	if _, ok := b.preparsed[path]; ok {
+		return true
+	}
+	if buildPkg := b.buildPackages[path]; buildPkg != nil {
+		path = string(canonicalizeImportPath(buildPkg.ImportPath))
+	}
+	_, found := b.parsed[importPathString(path)]
+	return found
+}
+
+// goCommand returns the go command of the builder's GOROOT, or the one in
+// $PATH.
+func (b *Builder) goCommand() string {
+	if b.context.GOROOT != "" {
+		goCmd := filepath.Join(b.context.GOROOT, "bin", "go")
+		if _, err := os.Stat(goCmd); err == nil {
+			return goCmd
+		}
+	}
+	return "go"
+}
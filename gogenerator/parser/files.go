@@ -0,0 +1,89 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// AddFiles adds the package 'pkgPath' made of exactly the Go files at
+// 'paths', as build systems which declare every input file need. The files
+// are read as they are: their directories are not listed, build constraints
+// are not applied, and neither GOPATH nor modules are consulted to find
+// them. Imports of the packages added by AddFiles and AddDependencyFiles
+// are resolved from their files; others, as of the standard library, are
+// loaded as usual. The packages are type checked by FindTypes, so they may
+// be added in any order.
+func (b *Builder) AddFiles(pkgPath string, paths ...string) error {
+	return b.addFileList(importPathString(pkgPath), paths, true)
+}
+
+// AddDependencyFiles is like AddFiles, but for a package which the inputs
+// only import, and which isn't user requested.
+func (b *Builder) AddDependencyFiles(pkgPath string, paths ...string) error {
+	return b.addFileList(importPathString(pkgPath), paths, false)
+}
+
+func (b *Builder) addFileList(pkgPath importPathString, paths []string, userRequested bool) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("package %q has no files", pkgPath)
+	}
+	for _, path := range paths {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return newError(pkgPath, path, err)
+		}
+		data, err := b.ReadFile(absPath)
+		if err != nil {
+			return newError(pkgPath, absPath, fmt.Errorf("while loading: %v", err))
+		}
+		if err := b.addFile(pkgPath, absPath, data, userRequested); err != nil {
+			return newError(pkgPath, absPath, err)
+		}
+		if _, ok := b.absPaths[pkgPath]; !ok {
+			b.absPaths[pkgPath] = filepath.Dir(absPath)
+		}
+	}
+	b.userRequested[pkgPath] = userRequested || b.userRequested[pkgPath]
+	b.fileListed[pkgPath] = true
+	return nil
+}
+
+// typeCheckFileLists type checks the packages added by AddFiles and
+// AddDependencyFiles which nothing imported yet. Errors are only returned
+// for user requested packages, as for the packages of AddDir.
+func (b *Builder) typeCheckFileLists() error {
+	for _, pkgPath := range sortedImportPaths(b.fileListed) {
+		if _, started := b.typeCheckedPackages[pkgPath]; started {
+			continue
+		}
+		pkg, err := b.typeCheckPackage(pkgPath)
+		if err != nil && (pkg == nil || b.userRequested[pkgPath]) {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedImportPaths(set map[importPathString]bool) []importPathString {
+	paths := make([]importPathString, 0, len(set))
+	for p := range set {
+		paths = append(paths, p)
+	}
+	sort.Slice(paths, func(i, j int) bool { return paths[i] < paths[j] })
+	return paths
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"go/scanner"
+	"go/token"
+)
+
+// blankFunctionBodies returns a copy of the Go source 'src' in which the
+// bodies of the top-level functions and methods are blanked out. Newlines are kept, so the
+// positions of everything else stay the same. Parsing the result is much
+// cheaper, and loses nothing the type checker looks at with
+// IgnoreFuncBodies set. If 'src' can't be scanned, it is returned as is.
+func blankFunctionBodies(src []byte) []byte {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", -1, len(src))
+	failed := false
+	var s scanner.Scanner
+	s.Init(file, src, func(token.Position, string) { failed = true }, 0)
+
+	out := append([]byte(nil), src...)
+	braces := 0          // depth of braces outside function bodies
+	inSignature := false // after a top-level "func", before its body
+	parens := 0          // depth of parentheses and brackets in a signature
+	typeBrace := false   // the next brace opens a struct or interface type
+	prev := token.SEMICOLON
+	for {
+		pos, tok, _ := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		switch tok {
+		case token.FUNC:
+			// Only a "func" starting a declaration; function literals
+			// and types are left alone.
+			if braces == 0 && !inSignature && prev == token.SEMICOLON {
+				inSignature = true
+				parens = 0
+			}
+		case token.STRUCT, token.INTERFACE:
+			prev = tok
+			typeBrace = true
+			continue
+		case token.LPAREN, token.LBRACK:
+			if inSignature {
+				parens++
+			}
+		case token.RPAREN, token.RBRACK:
+			if inSignature {
+				parens--
+			}
+		case token.SEMICOLON:
+			if inSignature && parens == 0 && braces == 0 {
+				// A function declared without a body.
+				inSignature = false
+			}
+		case token.LBRACE:
+			if inSignature && parens == 0 && braces == 0 && !typeBrace {
+				start := file.Offset(pos) + 1
+				end, ok := skipBlock(&s, file)
+				if !ok {
+					return src
+				}
+				for i := start; i < end; i++ {
+					if out[i] != '\n' {
+						out[i] = ' '
+					}
+				}
+				inSignature = false
+			} else {
+				braces++
+			}
+		case token.RBRACE:
+			braces--
+		}
+		prev = tok
+		typeBrace = false
+	}
+	if failed {
+		return src
+	}
+	return out
+}
+
+// skipBlock scans up to the brace closing the one just scanned, and returns
+// its offset.
+func skipBlock(s *scanner.Scanner, file *token.File) (int, bool) {
+	depth := 1
+	for {
+		pos, tok, _ := s.Scan()
+		switch tok {
+		case token.EOF:
+			return 0, false
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			depth--
+			if depth == 0 {
+				return file.Offset(pos), true
+			}
+		}
+	}
+}
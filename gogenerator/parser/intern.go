@@ -0,0 +1,72 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"go/ast"
+
+	"github.com/lack-io/gogogen/gogenerator/types"
+)
+
+// interner deduplicates the names, tags and comment lines of the types
+// model. Without it, each is allocated again for every type and member
+// which refers to it, which dominates the memory used to parse large trees.
+type interner struct {
+	strings map[string]string
+	// Comment lines, by the text of their comment. Since they are shared,
+	// the slices are capped so that appending to them copies.
+	lines map[string][]string
+}
+
+func newInterner() *interner {
+	return &interner{
+		strings: map[string]string{},
+		lines:   map[string][]string{},
+	}
+}
+
+// string returns the canonical copy of 's'.
+func (in *interner) string(s string) string {
+	if c, ok := in.strings[s]; ok {
+		return c
+	}
+	in.strings[s] = s
+	return s
+}
+
+// name returns 'n' with canonical copies of its strings.
+func (in *interner) name(n types.Name) types.Name {
+	return types.Name{
+		Name:    in.string(n.Name),
+		Package: in.string(n.Package),
+		Path:    in.string(n.Path),
+	}
+}
+
+// commentLines returns the lines of the comment 'c', which may be nil. Equal
+// comments share one slice, which must not be modified.
+func (in *interner) commentLines(c *ast.CommentGroup) []string {
+	text := c.Text()
+	if l, ok := in.lines[text]; ok {
+		return l
+	}
+	l := splitLines(text)
+	for i := range l {
+		l[i] = in.string(l[i])
+	}
+	l = l[:len(l):len(l)]
+	in.lines[in.string(text)] = l
+	return l
+}
@@ -0,0 +1,128 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"bytes"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// overlayFile returns the contents the Overlay gives for the file at 'path',
+// if any.
+func (b *Builder) overlayFile(path string) ([]byte, bool) {
+	if len(b.Overlay) == 0 {
+		return nil, false
+	}
+	if data, ok := b.Overlay[path]; ok {
+		return data, true
+	}
+	path = filepath.Clean(path)
+	for p, data := range b.Overlay {
+		if filepath.Clean(p) == path {
+			return data, true
+		}
+	}
+	return nil, false
+}
+
+// ReadFile reads the file at 'path', from the Overlay if it has the file.
+func (b *Builder) ReadFile(path string) ([]byte, error) {
+	if data, ok := b.overlayFile(path); ok {
+		return data, nil
+	}
+	return ioutil.ReadFile(path)
+}
+
+// overlayContext returns a copy of 'ctx' which lists and reads files through
+// the Overlay.
+func (b *Builder) overlayContext(ctx build.Context) build.Context {
+	ctx.OpenFile = func(path string) (io.ReadCloser, error) {
+		if data, ok := b.overlayFile(path); ok {
+			return ioutil.NopCloser(bytes.NewReader(data)), nil
+		}
+		return os.Open(path)
+	}
+	ctx.ReadDir = func(dir string) ([]os.FileInfo, error) {
+		infos, err := ioutil.ReadDir(dir)
+		dir = filepath.Clean(dir)
+		byName := map[string]os.FileInfo{}
+		for _, info := range infos {
+			byName[info.Name()] = info
+		}
+		added := false
+		for p, data := range b.Overlay {
+			p = filepath.Clean(p)
+			if filepath.Dir(p) != dir {
+				continue
+			}
+			name := filepath.Base(p)
+			byName[name] = overlayFileInfo{name: name, size: int64(len(data))}
+			added = true
+		}
+		if err != nil && !added {
+			return nil, err
+		}
+		infos = make([]os.FileInfo, 0, len(byName))
+		for _, info := range byName {
+			infos = append(infos, info)
+		}
+		sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+		return infos, nil
+	}
+	return ctx
+}
+
+// importOverlaid imports the package in 'dir' like 'ctx' would, but through
+// the Overlay. go/build doesn't ask the go command to resolve packages once
+// file system hooks are set, so the package is found without them first,
+// and then loaded from its directory.
+func (b *Builder) importOverlaid(ctx build.Context, dir, srcDir string, mode build.ImportMode) (*build.Package, error) {
+	found, err := ctx.Import(dir, srcDir, build.FindOnly)
+	if err != nil || mode&build.FindOnly != 0 {
+		return found, err
+	}
+	overlaid := b.overlayContext(ctx)
+	buildPkg, err := overlaid.ImportDir(found.Dir, mode)
+	if buildPkg != nil {
+		buildPkg.ImportPath = found.ImportPath
+		buildPkg.Root = found.Root
+		buildPkg.SrcRoot = found.SrcRoot
+		buildPkg.PkgRoot = found.PkgRoot
+		buildPkg.PkgTargetRoot = found.PkgTargetRoot
+		buildPkg.BinDir = found.BinDir
+		buildPkg.Goroot = found.Goroot
+		buildPkg.PkgObj = found.PkgObj
+	}
+	return buildPkg, err
+}
+
+// overlayFileInfo describes a file which only exists in the Overlay.
+type overlayFileInfo struct {
+	name string
+	size int64
+}
+
+func (fi overlayFileInfo) Name() string       { return fi.name }
+func (fi overlayFileInfo) Size() int64        { return fi.size }
+func (fi overlayFileInfo) Mode() os.FileMode  { return 0644 }
+func (fi overlayFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi overlayFileInfo) IsDir() bool        { return false }
+func (fi overlayFileInfo) Sys() interface{}   { return nil }
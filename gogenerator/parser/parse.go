@@ -16,20 +16,25 @@
 package parser
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"go/ast"
 	"go/build"
+	"go/constant"
+	"go/format"
 	"go/parser"
 	"go/token"
 	tc "go/types"
-	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"sort"
 	"strings"
+	"sync"
 
 	"github.com/lack-io/gogogen/gogenerator/types"
 	"github.com/lack-io/gogogen/util/log"
@@ -43,9 +48,55 @@ type importPathString string
 type Builder struct {
 	context *build.Context
 
-	// If true, include *_test.go
+	// If true, include *_test.go. The files of the external test package
+	// of a user-requested package x, those declaring package x_test, are
+	// added as the package with the path of x and "_test" appended.
 	IncludeTestFiles bool
 
+	// If true, keep the bodies of the functions and methods declared in the
+	// user-requested packages, as their types' Body.
+	IncludeFunctionBodies bool
+
+	// If true, parse the files which import "C". Otherwise they are left
+	// out, and packages made only of them are not found. Nothing is known
+	// of package C: declarations using its identifiers are given invalid
+	// types, and the rest are parsed as usual.
+	IncludeCgoFiles bool
+
+	// If true, keep the syntax of the declarations in the user-requested
+	// packages. See Syntax.
+	IncludeSyntax bool
+
+	// If true, the function bodies of packages which aren't user-requested
+	// are skipped when parsing, which is considerably faster. The type
+	// checker ignores them anyway. A package parsed as a dependency keeps
+	// no bodies even if it is added by the user later.
+	SkipFunctionBodies bool
+
+	// If true, packages imported by the user-requested ones are loaded from
+	// the compiler's export data, built by "go list -export", instead of
+	// being parsed. This is much faster for large dependency graphs, but
+	// leaves the types of those packages without comments. Packages the go
+	// command can't build are parsed as usual. A user-requested package
+	// imported by another one should be added before it, or in the same
+	// AddDirRecursive call, so that both share its parsed types.
+	ExportData bool
+
+	// The directory packages are resolved from, as if the generator ran in
+	// it, rather than the working directory. In module mode, its module is
+	// the main module.
+	Dir string
+
+	// Contents of files which override those on disk, or are added to their
+	// directory, keyed by absolute path, such as unsaved editor buffers.
+	// Directories must exist on disk.
+	Overlay map[string][]byte
+
+	// How the sizes, alignments and field offsets of types are computed. If
+	// nil, they are computed for the gc compiler and the architecture files
+	// are loaded for. See SetPlatform.
+	Sizes tc.Sizes
+
 	// Map of package names to more canonical information about the package.
 	// This might hold the same value for multiple names, e.g. if someone
 	// referenced ./pkg/name or in the case of vendoring, which canonicalizes
@@ -68,8 +119,54 @@ type Builder struct {
 	// All comments from everywhere in every parsed file.
 	endLineToCommentGroup map[fileLine]*ast.CommentGroup
 
+	// The lines opening the bodies of structs and interfaces, and those
+	// ending their fields and methods, which the comments of a member can
+	// not reach past.
+	memberBoundaries map[fileLine]bool
+
 	// map of package to list of packages it imports.
 	importGraph map[importPathString]map[string]struct{}
+
+	// Directories parsed concurrently by parseDirs, waiting to be added.
+	preparsed map[string]*preparsedDir
+
+	// Loading stops once this is done. See SetContext.
+	ctx context.Context
+
+	// The go/types types and objects types were built from. See GoType
+	// and GoObject.
+	goTypes   map[*types.Type]tc.Type
+	goObjects map[*types.Type]tc.Object
+
+	// The syntax of declarations, if IncludeSyntax is set.
+	syntax map[*types.Type]*DeclSyntax
+
+	// Map of external test package path to the path of the package it
+	// tests.
+	forTest map[importPathString]importPathString
+
+	// The packages added by AddFiles and AddDependencyFiles.
+	fileListed map[importPathString]bool
+
+	// Where the export data of packages is, and the packages loaded from
+	// it, if ExportData is set. Empty paths and nil packages mean there is
+	// none.
+	exportFiles    map[string]string
+	exportPackages map[string]*tc.Package
+	exportImporter tc.Importer
+
+	// Shares the strings and comment lines of the types it builds.
+	interner *interner
+
+	// Serializes CheckFiles.
+	checkLock sync.Mutex
+}
+
+// preparsedDir is a directory which was read and parsed ahead of being added.
+type preparsedDir struct {
+	buildPkg *build.Package
+	files    []parsedFile
+	err      error
 }
 
 // parsedFile is for tracking files with name
@@ -96,7 +193,7 @@ func New() *Builder {
 		}
 	}
 	// Force this to off, since we don't properly parse CGo.  All symbols must
-	// have non-CGo equivalents.
+	// have non-CGo equivalents. See IncludeCgoFiles.
 	c.CgoEnabled = false
 	return &Builder{
 		context:               &c,
@@ -107,15 +204,45 @@ func New() *Builder {
 		absPaths:              map[importPathString]string{},
 		userRequested:         map[importPathString]bool{},
 		endLineToCommentGroup: map[fileLine]*ast.CommentGroup{},
+		memberBoundaries:      map[fileLine]bool{},
 		importGraph:           map[importPathString]map[string]struct{}{},
+		preparsed:             map[string]*preparsedDir{},
+		ctx:                   context.Background(),
+		goTypes:               map[*types.Type]tc.Type{},
+		goObjects:             map[*types.Type]tc.Object{},
+		syntax:                map[*types.Type]*DeclSyntax{},
+		forTest:               map[importPathString]importPathString{},
+		fileListed:            map[importPathString]bool{},
+		exportFiles:           map[string]string{},
+		exportPackages:        map[string]*tc.Package{},
+		interner:              newInterner(),
 	}
 }
 
+// SetContext makes the builder stop loading packages and finding types once
+// ctx is done, returning ctx.Err().
+func (b *Builder) SetContext(ctx context.Context) {
+	b.ctx = ctx
+}
+
 // AddBuildTags adds the specified build tags to the parse context.
 func (b *Builder) AddBuildTags(tags ...string) {
 	b.context.BuildTags = append(b.context.BuildTags, tags...)
 }
 
+// SetPlatform makes the builder load files for the operating system 'goos'
+// and the architecture 'goarch', as selected by build constraints and file
+// names, instead of those of the build context, usually $GOOS and $GOARCH.
+// Empty values leave the respective setting unchanged.
+func (b *Builder) SetPlatform(goos, goarch string) {
+	if goos != "" {
+		b.context.GOOS = goos
+	}
+	if goarch != "" {
+		b.context.GOARCH = goarch
+	}
+}
+
 // Get package information from the go/build package. Automatically excludes
 // e.g. test files and files for other platforms-- there is quite a bit of
 // logic of that nature in the build package.
@@ -123,17 +250,12 @@ func (b *Builder) importBuildPackage(dir string) (*build.Package, error) {
 	if buildPkg, ok := b.buildPackages[dir]; ok {
 		return buildPkg, nil
 	}
-	// This validates the `package foo // github.com/bar/foo` comments.
-	buildPkg, err := b.importWithMode(dir, build.ImportComment)
-	if err != nil {
-		if _, ok := err.(*build.NoGoError); !ok {
-			return nil, fmt.Errorf("unable to import %q: %v", dir, err)
-		}
-	}
-	if buildPkg == nil {
-		// Might be an empty directory. Try to just find the dir.
-		buildPkg, err = b.importWithMode(dir, build.FindOnly)
-		if err != nil {
+	var buildPkg *build.Package
+	if pre, ok := b.preparsed[dir]; ok {
+		buildPkg = pre.buildPkg
+	} else {
+		var err error
+		if buildPkg, err = b.findBuildPackage(dir); err != nil {
 			return nil, err
 		}
 	}
@@ -155,6 +277,139 @@ func (b *Builder) importBuildPackage(dir string) (*build.Package, error) {
 	return buildPkg, nil
 }
 
+// findBuildPackage looks up the go/build package for dir, without recording
+// it. It is safe to call concurrently.
+func (b *Builder) findBuildPackage(dir string) (*build.Package, error) {
+	// This validates the `package foo // github.com/bar/foo` comments.
+	buildPkg, err := b.importWithMode(dir, build.ImportComment)
+	if err != nil {
+		if _, ok := err.(*build.NoGoError); !ok {
+			return nil, fmt.Errorf("unable to import %q: %v", dir, err)
+		}
+	}
+	if buildPkg == nil {
+		// Might be an empty directory. Try to just find the dir.
+		buildPkg, err = b.importWithMode(dir, build.FindOnly)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buildPkg, nil
+}
+
+// goFiles returns the names of the files to parse for buildPkg.
+func (b *Builder) goFiles(buildPkg *build.Package) []string {
+	candidates := []string{}
+	candidates = append(candidates, buildPkg.GoFiles...)
+	if b.IncludeCgoFiles {
+		candidates = append(candidates, buildPkg.CgoFiles...)
+	}
+	if b.IncludeTestFiles {
+		candidates = append(candidates, buildPkg.TestGoFiles...)
+	}
+	files := []string{}
+	for _, f := range candidates {
+		if b.excludedGenerated(filepath.Join(buildPkg.Dir, f)) {
+			continue
+		}
+		files = append(files, f)
+	}
+	return files
+}
+
+// excludedGenerated reports whether the Go file at 'path' is a generated
+// file excluded by one of the build tags, that is one stating the
+// constraint "//go:build !<tag>". go/build before Go 1.17 only honors the
+// legacy "// +build" lines, so such files must be detected here to not
+// parse the output of earlier runs as input.
+func (b *Builder) excludedGenerated(path string) bool {
+	if len(b.context.BuildTags) == 0 {
+		return false
+	}
+	src, err := b.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	for _, line := range bytes.Split(src, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if bytes.HasPrefix(line, []byte("package ")) {
+			break
+		}
+		if !bytes.HasPrefix(line, []byte("//go:build ")) {
+			continue
+		}
+		expr := strings.TrimSpace(string(line[len("//go:build "):]))
+		for _, tag := range b.context.BuildTags {
+			if expr == "!"+tag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseDirs finds, reads and parses the packages in dirs concurrently, and
+// saves the results for addDir to pick up. Directories which can't be found
+// are skipped, so addDir can report the error in the usual way.
+func (b *Builder) parseDirs(dirs []string) {
+	results := make([]*preparsedDir, len(dirs))
+	var wg sync.WaitGroup
+	work := make(chan int)
+	for w := 0; w < runtime.GOMAXPROCS(0); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				results[i] = b.parseDir(dirs[i])
+			}
+		}()
+	}
+	for i, dir := range dirs {
+		if _, found := b.buildPackages[dir]; found {
+			continue
+		}
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	for i, pre := range results {
+		if pre != nil {
+			b.preparsed[dirs[i]] = pre
+		}
+	}
+}
+
+// parseDir does the part of addDir which doesn't touch the builder's state.
+func (b *Builder) parseDir(dir string) *preparsedDir {
+	if b.ctx.Err() != nil {
+		return nil
+	}
+	buildPkg, err := b.findBuildPackage(dir)
+	if err != nil {
+		return nil
+	}
+	pre := &preparsedDir{buildPkg: buildPkg}
+	for _, file := range b.goFiles(buildPkg) {
+		if !strings.HasSuffix(file, ".go") {
+			continue
+		}
+		absPath := filepath.Join(buildPkg.Dir, file)
+		data, err := b.ReadFile(absPath)
+		if err != nil {
+			pre.err = newError(importPathString(buildPkg.ImportPath), absPath, fmt.Errorf("while loading: %v", err))
+			return pre
+		}
+		p, err := parser.ParseFile(b.fset, absPath, data, parser.DeclarationErrors|parser.ParseComments)
+		if err != nil {
+			pre.err = newError(importPathString(buildPkg.ImportPath), absPath, err)
+			return pre
+		}
+		pre.files = append(pre.files, parsedFile{absPath, p})
+	}
+	return pre
+}
+
 // AddFileForTest adds a file to the set, without verifying that the provided
 // pkg actually exists on disk. The pkg must be of the form "canonical/pkg/path"
 // and the path must be the absolute path to the file.  Because this bypasses
@@ -163,7 +418,7 @@ func (b *Builder) importBuildPackage(dir string) (*build.Package, error) {
 // time we need them.
 func (b *Builder) AddFileForTest(pkg string, path string, src []byte) error {
 	if err := b.addFile(importPathString(pkg), path, src, true); err != nil {
-		return err
+		return newError(importPathString(pkg), path, err)
 	}
 	if _, err := b.typeCheckPackage(importPathString(pkg)); err != nil {
 		return err
@@ -183,11 +438,19 @@ func (b *Builder) addFile(pkgPath importPathString, path string, src []byte, use
 		}
 	}
 	log.Debugf("addFile %s %s", pkgPath, path)
+	if b.SkipFunctionBodies && !userRequested {
+		src = blankFunctionBodies(src)
+	}
 	p, err := parser.ParseFile(b.fset, path, src, parser.DeclarationErrors|parser.ParseComments)
 	if err != nil {
 		return err
 	}
+	b.addParsedFile(pkgPath, path, p, userRequested)
+	return nil
+}
 
+// addParsedFile records an already parsed file in the set.
+func (b *Builder) addParsedFile(pkgPath importPathString, path string, p *ast.File, userRequested bool) {
 	// This is redundant with addDir, but some tests call AddFileForTest, which
 	// call into here without calling addDir.
 	b.userRequested[pkgPath] = userRequested || b.userRequested[pkgPath]
@@ -197,6 +460,22 @@ func (b *Builder) addFile(pkgPath importPathString, path string, src []byte, use
 		position := b.fset.Position(c.End())
 		b.endLineToCommentGroup[fileLine{position.Filename, position.Line}] = c
 	}
+	ast.Inspect(p, func(n ast.Node) bool {
+		var fields *ast.FieldList
+		switch n := n.(type) {
+		case *ast.StructType:
+			fields = n.Fields
+		case *ast.InterfaceType:
+			fields = n.Methods
+		}
+		if fields != nil {
+			b.addMemberBoundary(fields.Opening)
+			for _, f := range fields.List {
+				b.addMemberBoundary(f.End())
+			}
+		}
+		return true
+	})
 
 	// We have to get the packages from this specific file, in case the
 	// user added individual files instead of entire directories.
@@ -207,7 +486,6 @@ func (b *Builder) addFile(pkgPath importPathString, path string, src []byte, use
 		importedPath := strings.Trim(im.Path.Value, `"`)
 		b.importGraph[pkgPath][importedPath] = struct{}{}
 	}
-	return nil
 }
 
 // AddDir adds an entire directory, scanning it for go files. 'dir' should have
@@ -224,6 +502,9 @@ func (b *Builder) AddDir(dir string) error {
 func (b *Builder) AddDirRecursive(dir string) error {
 	// Add the root.
 	if _, err := b.importPackage(dir, true); err != nil {
+		if err := b.ctx.Err(); err != nil {
+			return err
+		}
 		log.Warnf("Ignoring directory %v: %v", dir, err)
 	}
 
@@ -234,17 +515,13 @@ func (b *Builder) AddDirRecursive(dir string) error {
 		return err
 	}
 
+	pkgs := []string{}
 	fn := func(filePath string, info os.FileInfo, err error) error {
 		if info != nil && info.IsDir() {
 			rel := filepath.ToSlash(strings.TrimPrefix(filePath, realPath))
 			if rel != "" {
 				// Make a pkg path.
-				pkg := path.Join(string(canonicalizeImportPath(b.buildPackages[dir].ImportPath)), rel)
-
-				// Add it.
-				if _, err := b.importPackage(pkg, true); err != nil {
-					log.Warnf("Ignoring child directory %v: %v", pkg, err)
-				}
+				pkgs = append(pkgs, path.Join(string(canonicalizeImportPath(b.buildPackages[dir].ImportPath)), rel))
 			}
 		}
 		return nil
@@ -252,6 +529,21 @@ func (b *Builder) AddDirRecursive(dir string) error {
 	if err := filepath.Walk(realPath, fn); err != nil {
 		return err
 	}
+
+	// Reading and parsing dominates, and does not depend on type checking,
+	// so do it up front for all the directories at once.
+	b.parseDirs(pkgs)
+
+	for _, pkg := range pkgs {
+		if err := b.ctx.Err(); err != nil {
+			return err
+		}
+		// Add it.
+		if _, err := b.importPackage(pkg, true); err != nil {
+			log.Warnf("Ignoring child directory %v: %v", pkg, err)
+		}
+	}
+	b.preparsed = map[string]*preparsedDir{}
 	return nil
 }
 
@@ -260,7 +552,8 @@ func (b *Builder) AddDirRecursive(dir string) error {
 // generator (rather than just at init time. 'dir' must be a single go package.
 // GOPATH, GOROOT, and the location of your go binary (`which go`) will all be
 // searched if dir doesn't literally resolve.
-// Deprecated. Please use AddDirectoryTo.
+//
+// Deprecated: Please use AddDirectoryTo.
 func (b *Builder) AddDirTo(dir string, u *types.Universe) error {
 	// We want all types from this package, as if they were directly added
 	// by the user.  They WERE added by the user, in effect.
@@ -311,24 +604,46 @@ func (b *Builder) addDir(dir string, userRequested bool) error {
 		b.absPaths[pkgPath] = buildPkg.Dir
 	}
 
-	files := []string{}
-	files = append(files, buildPkg.GoFiles...)
-	if b.IncludeTestFiles {
-		files = append(files, buildPkg.TestGoFiles...)
+	if pre, ok := b.preparsed[dir]; ok {
+		delete(b.preparsed, dir)
+		if pre.err != nil {
+			return pre.err
+		}
+		for _, f := range pre.files {
+			b.addParsedFile(pkgPath, f.name, f.file, userRequested)
+		}
+	} else {
+		if err := b.addFiles(pkgPath, buildPkg.Dir, b.goFiles(buildPkg), userRequested); err != nil {
+			return err
+		}
 	}
 
+	if b.IncludeTestFiles && userRequested && len(buildPkg.XTestGoFiles) > 0 {
+		xtestPath := pkgPath + "_test"
+		b.absPaths[xtestPath] = buildPkg.Dir
+		b.forTest[xtestPath] = pkgPath
+		if err := b.addFiles(xtestPath, buildPkg.Dir, buildPkg.XTestGoFiles, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addFiles reads and adds the go files named 'files' in 'dir' as the
+// package 'pkgPath'.
+func (b *Builder) addFiles(pkgPath importPathString, dir string, files []string, userRequested bool) error {
 	for _, file := range files {
 		if !strings.HasSuffix(file, ".go") {
 			continue
 		}
-		absPath := filepath.Join(buildPkg.Dir, file)
-		data, err := ioutil.ReadFile(absPath)
+		absPath := filepath.Join(dir, file)
+		data, err := b.ReadFile(absPath)
 		if err != nil {
-			return fmt.Errorf("while loading %q: %v", absPath, err)
+			return newError(pkgPath, absPath, fmt.Errorf("while loading: %v", err))
 		}
 		err = b.addFile(pkgPath, absPath, data, userRequested)
 		if err != nil {
-			return fmt.Errorf("while parsing %q: %v", absPath, err)
+			return newError(pkgPath, absPath, err)
 		}
 	}
 	return nil
@@ -344,6 +659,9 @@ func isErrPackageNotFound(err error) bool {
 // needs to import a go package. 'path' is the import path.
 func (b *Builder) importPackage(dir string, userRequested bool) (*tc.Package, error) {
 	log.Debugf("importPackage %s", dir)
+	if err := b.ctx.Err(); err != nil {
+		return nil, err
+	}
 	var pkgPath = importPathString(dir)
 
 	// Get the canonical path if we can.
@@ -398,6 +716,15 @@ func (b *Builder) importPackage(dir string, userRequested bool) (*tc.Package, er
 		}
 	}
 
+	// The external test package imports this one, so is checked after it,
+	// unless this is that import.
+	xtestPath := pkgPath + "_test"
+	if _, started := b.typeCheckedPackages[xtestPath]; !started && b.forTest[xtestPath] == pkgPath {
+		if _, err := b.typeCheckPackage(xtestPath); err != nil {
+			return nil, err
+		}
+	}
+
 	return pkg, nil
 }
 
@@ -406,6 +733,11 @@ type importAdapter struct {
 }
 
 func (a importAdapter) Import(path string) (*tc.Package, error) {
+	if !a.b.isParsed(path) {
+		if pkg := a.b.importExportData(path); pkg != nil {
+			return pkg, nil
+		}
+	}
 	return a.b.importPackage(path, false)
 }
 
@@ -436,6 +768,7 @@ func (b *Builder) typeCheckPackage(pkgPath importPathString) (*tc.Package, error
 	b.typeCheckedPackages[pkgPath] = nil
 	c := tc.Config{
 		IgnoreFuncBodies: true,
+		FakeImportC:      b.IncludeCgoFiles,
 		// Note that importAdapter can call b.importPackage which calls this
 		// method. So there can't be cycles in the import graph.
 		Importer: importAdapter{b},
@@ -445,7 +778,31 @@ func (b *Builder) typeCheckPackage(pkgPath importPathString) (*tc.Package, error
 	}
 	pkg, err := c.Check(string(pkgPath), b.fset, files, nil)
 	b.typeCheckedPackages[pkgPath] = pkg // record the result whether or not there was an error
-	return pkg, err
+	if err != nil {
+		return pkg, newError(pkgPath, "", err)
+	}
+	return pkg, nil
+}
+
+// PackageFiles returns the paths of the files parsed for the package, sorted.
+func (b *Builder) PackageFiles(pkgPath string) []string {
+	files := []string{}
+	for _, f := range b.parsed[importPathString(pkgPath)] {
+		files = append(files, f.name)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// ParsedPackages returns the import paths of every package parsed so far,
+// whether requested by the user or imported, sorted.
+func (b *Builder) ParsedPackages() []string {
+	pkgPaths := []string{}
+	for pkgPath := range b.parsed {
+		pkgPaths = append(pkgPaths, string(pkgPath))
+	}
+	sort.Strings(pkgPaths)
+	return pkgPaths
 }
 
 // FindPackages fetches a list of the user-imported packages.
@@ -473,6 +830,9 @@ func (b *Builder) FindPackages() []string {
 // FindTypes finalizes the package imports, and searches through all the
 // packages for types.
 func (b *Builder) FindTypes() (types.Universe, error) {
+	if err := b.typeCheckFileLists(); err != nil {
+		return nil, err
+	}
 	// Take a snapshot of pkgs to iterate, since this will recursively mutate
 	// b.parsed. Iterate in a predictable order.
 	pkgPaths := []string{}
@@ -483,6 +843,9 @@ func (b *Builder) FindTypes() (types.Universe, error) {
 
 	u := types.Universe{}
 	for _, pkgPath := range pkgPaths {
+		if err := b.ctx.Err(); err != nil {
+			return nil, err
+		}
 		if err := b.findTypesIn(importPathString(pkgPath), &u); err != nil {
 			return nil, err
 		}
@@ -511,57 +874,76 @@ func (b *Builder) findTypesIn(pkgPath importPathString, u *types.Universe) error
 	u.Package(string(pkgPath)).Name = pkg.Name()
 	u.Package(string(pkgPath)).Path = pkg.Path()
 	u.Package(string(pkgPath)).SourcePath = b.absPaths[pkgPath]
+	u.Package(string(pkgPath)).ForTest = string(b.forTest[pkgPath])
 
+	fileComments := map[string][]string{}
 	for _, f := range b.parsed[pkgPath] {
-		if _, fileName := filepath.Split(f.name); fileName == "doc.go" {
+		_, fileName := filepath.Split(f.name)
+		for _, cg := range f.file.Comments {
+			if cg.Pos() < f.file.Package {
+				fileComments[fileName] = append(fileComments[fileName], b.interner.commentLines(cg)...)
+			}
+		}
+		if fileName == "doc.go" {
 			tp := u.Package(string(pkgPath))
 			// findTypesIn might be called multiple times. Clean up tp.Comments
 			// to avoid repeatedly fill same comments to it.
 			tp.Comments = []string{}
 			for i := range f.file.Comments {
-				tp.Comments = append(tp.Comments, splitLines(f.file.Comments[i].Text())...)
+				tp.Comments = append(tp.Comments, b.interner.commentLines(f.file.Comments[i])...)
 			}
 			if f.file.Doc != nil {
-				tp.DocComments = splitLines(f.file.Doc.Text())
+				tp.DocComments = b.interner.commentLines(f.file.Doc)
 			}
 		}
 	}
+	u.Package(string(pkgPath)).FileComments = fileComments
 
 	s := pkg.Scope()
 	for _, n := range s.Names() {
 		obj := s.Lookup(n)
 		tn, ok := obj.(*tc.TypeName)
 		if ok {
-			t := b.walkType(*u, nil, tn.Type())
-			c1 := b.priorCommentLines(obj.Pos(), 1)
-			// c1.Text() is safe if c1 is nil
-			t.CommentLines = splitLines(c1.Text())
-			if c1 == nil {
-				t.SecondClosestCommentLines = splitLines(b.priorCommentLines(obj.Pos(), 2).Text())
+			var t *types.Type
+			if tn.IsAlias() {
+				t = b.addTypeAlias(*u, tn)
 			} else {
-				t.SecondClosestCommentLines = splitLines(b.priorCommentLines(c1.List[0].Slash, 2).Text())
+				t = b.walkType(*u, nil, tn.Type())
 			}
+			b.goObjects[t] = obj
+			t.Position = b.fset.Position(obj.Pos())
+			t.CommentLines, t.SecondClosestCommentLines = b.priorComments(obj.Pos())
 		}
 		tf, ok := obj.(*tc.Func)
 		// We only care about functions, not concrete/abstract methods.
 		if ok && tf.Type() != nil && tf.Type().(*tc.Signature).Recv() == nil {
 			t := b.addFunction(*u, nil, tf)
-			c1 := b.priorCommentLines(obj.Pos(), 1)
-			// c1.Text() is safe if c1 is nil
-			t.CommentLines = splitLines(c1.Text())
-			if c1 == nil {
-				t.SecondClosestCommentLines = splitLines(b.priorCommentLines(obj.Pos(), 2).Text())
-			} else {
-				t.SecondClosestCommentLines = splitLines(b.priorCommentLines(c1.List[0].Slash, 2).Text())
-			}
+			b.goObjects[t] = obj
+			t.Position = b.fset.Position(obj.Pos())
+			t.CommentLines, t.SecondClosestCommentLines = b.priorComments(obj.Pos())
 		}
 		tv, ok := obj.(*tc.Var)
 		if ok && !tv.IsField() {
-			b.addVariable(*u, nil, tv)
+			t := b.addVariable(*u, nil, tv)
+			b.goObjects[t] = obj
+			t.Position = b.fset.Position(obj.Pos())
 		}
 		tconst, ok := obj.(*tc.Const)
 		if ok {
-			b.addConstant(*u, nil, tconst)
+			t := b.addConstant(*u, nil, tconst)
+			b.goObjects[t] = obj
+			t.Position = b.fset.Position(obj.Pos())
+			t.CommentLines = b.interner.commentLines(b.priorCommentLines(obj.Pos(), 1))
+		}
+	}
+
+	b.addConstGroups(pkgPath, u)
+	if b.IncludeSyntax {
+		b.addSyntax(pkgPath, u)
+	}
+	if b.IncludeFunctionBodies {
+		if err := b.addFunctionBodies(pkgPath, u); err != nil {
+			return err
 		}
 	}
 
@@ -576,6 +958,158 @@ func (b *Builder) findTypesIn(pkgPath importPathString, u *types.Universe) error
 	return nil
 }
 
+// GoType returns the go/types type 't' was built from, or nil if it wasn't
+// built by the builder. The go/types struct of a struct type has the fields
+// of its members, in the same order.
+func (b *Builder) GoType(t *types.Type) tc.Type {
+	return b.goTypes[t]
+}
+
+// GoObject returns the go/types object declaring 't', if it is a named
+// type, type alias, function, method, variable or constant built by the
+// builder, or nil.
+func (b *Builder) GoObject(t *types.Type) tc.Object {
+	return b.goObjects[t]
+}
+
+// FileSet returns the file set the positions of go/types objects refer to.
+func (b *Builder) FileSet() *token.FileSet {
+	return b.fset
+}
+
+// sizes returns how the sizes of types are computed.
+func (b *Builder) sizes() tc.Sizes {
+	if b.Sizes == nil {
+		if b.Sizes = tc.SizesFor("gc", b.context.GOARCH); b.Sizes == nil {
+			b.Sizes = &tc.StdSizes{WordSize: 8, MaxAlign: 8}
+		}
+	}
+	return b.Sizes
+}
+
+// addConstGroups records the declaration each constant of the package is in,
+// and its iota.
+func (b *Builder) addConstGroups(pkgPath importPathString, u *types.Universe) {
+	tp := u.Package(string(pkgPath))
+	for _, f := range b.parsed[pkgPath] {
+		for _, decl := range f.file.Decls {
+			gd, ok := decl.(*ast.GenDecl)
+			if !ok || gd.Tok != token.CONST {
+				continue
+			}
+			group := &types.ConstGroup{}
+			for i, spec := range gd.Specs {
+				for _, name := range spec.(*ast.ValueSpec).Names {
+					t := tp.Constants[name.Name]
+					if name.Name == "_" || t == nil {
+						continue
+					}
+					t.ConstGroup = group
+					t.ConstIota = i
+					group.Constants = append(group.Constants, t)
+				}
+			}
+		}
+	}
+}
+
+// declaredFunc returns the function or method 'fd' declares in 'tp', or nil.
+func declaredFunc(tp *types.Package, fd *ast.FuncDecl) *types.Type {
+	if fd.Recv == nil {
+		return tp.Functions[fd.Name.Name]
+	}
+	if len(fd.Recv.List) != 1 {
+		return nil
+	}
+	recv := fd.Recv.List[0].Type
+	if star, ok := recv.(*ast.StarExpr); ok {
+		recv = star.X
+	}
+	if id, ok := recv.(*ast.Ident); ok && tp.Types[id.Name] != nil {
+		return tp.Types[id.Name].Methods[fd.Name.Name]
+	}
+	return nil
+}
+
+// DeclSyntax is the syntax declaring a type, function, method, variable or
+// constant.
+type DeclSyntax struct {
+	// The file the declaration is in.
+	File *ast.File
+
+	// The declaration: an *ast.FuncDecl for functions and methods, and an
+	// *ast.GenDecl otherwise.
+	Decl ast.Decl
+
+	// For an *ast.GenDecl, the *ast.TypeSpec or *ast.ValueSpec in it.
+	Spec ast.Spec
+}
+
+// addSyntax records the syntax of the declarations of the package.
+func (b *Builder) addSyntax(pkgPath importPathString, u *types.Universe) {
+	tp := u.Package(string(pkgPath))
+	for _, f := range b.parsed[pkgPath] {
+		for _, decl := range f.file.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if t := declaredFunc(tp, decl); t != nil {
+					b.syntax[t] = &DeclSyntax{File: f.file, Decl: decl}
+				}
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						if t := tp.Types[spec.Name.Name]; t != nil {
+							b.syntax[t] = &DeclSyntax{File: f.file, Decl: decl, Spec: spec}
+						}
+					case *ast.ValueSpec:
+						for _, name := range spec.Names {
+							t := tp.Variables[name.Name]
+							if decl.Tok == token.CONST {
+								t = tp.Constants[name.Name]
+							}
+							if t != nil && name.Name != "_" {
+								b.syntax[t] = &DeclSyntax{File: f.file, Decl: decl, Spec: spec}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// Syntax returns the syntax declaring 't', a type, function, method,
+// variable or constant of a user-requested package, if IncludeSyntax was
+// set, or nil.
+func (b *Builder) Syntax(t *types.Type) *DeclSyntax {
+	return b.syntax[t]
+}
+
+// addFunctionBodies records the bodies of the functions and methods declared
+// in the package.
+func (b *Builder) addFunctionBodies(pkgPath importPathString, u *types.Universe) error {
+	tp := u.Package(string(pkgPath))
+	for _, f := range b.parsed[pkgPath] {
+		for _, decl := range f.file.Decls {
+			fd, ok := decl.(*ast.FuncDecl)
+			if !ok || fd.Body == nil {
+				continue
+			}
+			t := declaredFunc(tp, fd)
+			if t == nil {
+				continue
+			}
+			var buf bytes.Buffer
+			if err := format.Node(&buf, b.fset, fd.Body); err != nil {
+				return fmt.Errorf("failed printing the body of %s: %v", fd.Name.Name, err)
+			}
+			t.Body = &types.FuncBody{Node: fd.Body, Source: buf.String()}
+		}
+	}
+	return nil
+}
+
 func (b *Builder) importWithMode(dir string, mode build.ImportMode) (*build.Package, error) {
 	// This is a bit of a hack.  The srcDir argument to Import() should
 	// properly be the dir of the file which depends on the package to be
@@ -588,7 +1122,20 @@ func (b *Builder) importWithMode(dir string, mode build.ImportMode) (*build.Pack
 	if err != nil {
 		return nil, fmt.Errorf("unable to get current directory: %v", err)
 	}
-	buildPkg, err := b.context.Import(filepath.ToSlash(dir), cwd, mode)
+	ctx := *b.context
+	if b.Dir != "" {
+		if cwd, err = filepath.Abs(b.Dir); err != nil {
+			return nil, err
+		}
+		ctx.Dir = cwd
+	}
+	ctx.CgoEnabled = b.IncludeCgoFiles
+	var buildPkg *build.Package
+	if len(b.Overlay) > 0 {
+		buildPkg, err = b.importOverlaid(ctx, filepath.ToSlash(dir), cwd, mode)
+	} else {
+		buildPkg, err = ctx.Import(filepath.ToSlash(dir), cwd, mode)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -602,6 +1149,51 @@ func (b *Builder) priorCommentLines(pos token.Pos, lines int) *ast.CommentGroup
 	return b.endLineToCommentGroup[key]
 }
 
+// priorComments returns the comment lines immediately before pos, and the
+// ones before those, as recorded in CommentLines and SecondClosestCommentLines.
+func (b *Builder) priorComments(pos token.Pos) (closest, second []string) {
+	c1 := b.priorCommentLines(pos, 1)
+	// c1.Text() is safe if c1 is nil
+	if c1 == nil {
+		return b.interner.commentLines(c1), b.interner.commentLines(b.priorCommentLines(pos, 2))
+	}
+	return b.interner.commentLines(c1), b.interner.commentLines(b.priorCommentLines(c1.List[0].Slash, 2))
+}
+
+// priorMemberComments is priorComments for the fields of structs and the
+// methods of interfaces, whose second-closest comments are never those of
+// the enclosing type or of the previous member.
+func (b *Builder) priorMemberComments(pos token.Pos) (closest, second []string) {
+	c1 := b.priorCommentLines(pos, 1)
+	above := pos
+	if c1 != nil {
+		above = c1.List[0].Slash
+	}
+	var c2 *ast.CommentGroup
+	if !b.isMemberBoundary(above, -1) {
+		c2 = b.priorCommentLines(above, 2)
+		// A comment trailing the previous member.
+		if c2 != nil && b.isMemberBoundary(c2.List[0].Slash, 0) {
+			c2 = nil
+		}
+	}
+	return b.interner.commentLines(c1), b.interner.commentLines(c2)
+}
+
+func (b *Builder) addMemberBoundary(pos token.Pos) {
+	if pos.IsValid() {
+		position := b.fset.Position(pos)
+		b.memberBoundaries[fileLine{position.Filename, position.Line}] = true
+	}
+}
+
+// isMemberBoundary returns true if the line 'offset' lines after that of pos
+// opens a struct or interface, or ends one of its members.
+func (b *Builder) isMemberBoundary(pos token.Pos, offset int) bool {
+	position := b.fset.Position(pos)
+	return b.memberBoundaries[fileLine{position.Filename, position.Line + offset}]
+}
+
 func splitLines(str string) []string {
 	return strings.Split(strings.TrimRight(str, "\n"), "\n")
 }
@@ -649,9 +1241,11 @@ func (b *Builder) convertSignature(u types.Universe, t *tc.Signature) *types.Sig
 	signature := &types.Signature{}
 	for i := 0; i < t.Params().Len(); i++ {
 		signature.Parameters = append(signature.Parameters, b.walkType(u, nil, t.Params().At(i).Type()))
+		signature.ParameterNames = append(signature.ParameterNames, b.interner.string(t.Params().At(i).Name()))
 	}
 	for i := 0; i < t.Results().Len(); i++ {
 		signature.Results = append(signature.Results, b.walkType(u, nil, t.Results().At(i).Type()))
+		signature.ResultNames = append(signature.ResultNames, b.interner.string(t.Results().At(i).Name()))
 	}
 	if r := t.Recv(); r != nil {
 		signature.Receiver = b.walkType(u, nil, r.Type())
@@ -662,11 +1256,29 @@ func (b *Builder) convertSignature(u types.Universe, t *tc.Signature) *types.Sig
 
 // walkType adds the type, and any necessary child types.
 func (b *Builder) walkType(u types.Universe, useName *types.Name, in tc.Type) *types.Type {
+	in = unalias(in)
+	out := b.convertType(u, useName, in)
+	// Named types are converted from their underlying types, but they
+	// should map back to the named type.
+	if _, ok := b.goTypes[out]; !ok || isNamed(in) {
+		b.goTypes[out] = in
+	}
+	return out
+}
+
+func isNamed(t tc.Type) bool {
+	_, ok := t.(*tc.Named)
+	return ok
+}
+
+// convertType converts the type for walkType.
+func (b *Builder) convertType(u types.Universe, useName *types.Name, in tc.Type) *types.Type {
 	// Most of the cases are underlying types of the named type.
 	name := tcNameToName(in.String())
 	if useName != nil {
 		name = *useName
 	}
+	name = b.interner.name(name)
 
 	switch t := in.(type) {
 	case *tc.Struct:
@@ -675,15 +1287,24 @@ func (b *Builder) walkType(u types.Universe, useName *types.Name, in tc.Type) *t
 			return out
 		}
 		out.Kind = types.Struct
+		sizes := b.sizes()
+		out.Size, out.Align = sizes.Sizeof(t), sizes.Alignof(t)
+		fields := make([]*tc.Var, t.NumFields())
+		for i := range fields {
+			fields[i] = t.Field(i)
+		}
+		offsets := sizes.Offsetsof(fields)
 		for i := 0; i < t.NumFields(); i++ {
 			f := t.Field(i)
 			m := types.Member{
-				Name:         f.Name(),
-				Embedded:     f.Anonymous(),
-				Tags:         t.Tag(i),
-				Type:         b.walkType(u, nil, f.Type()),
-				CommentLines: splitLines(b.priorCommentLines(f.Pos(), 1).Text()),
+				Name:     b.interner.string(f.Name()),
+				Embedded: f.Anonymous(),
+				Tags:     b.interner.string(t.Tag(i)),
+				Type:     b.walkType(u, nil, f.Type()),
+				Position: b.fset.Position(f.Pos()),
+				Offset:   offsets[i],
 			}
+			m.CommentLines, m.SecondClosestCommentLines = b.priorMemberComments(f.Pos())
 			out.Members = append(out.Members, m)
 		}
 		return out
@@ -729,8 +1350,12 @@ func (b *Builder) walkType(u types.Universe, useName *types.Name, in tc.Type) *t
 		}
 		out.Kind = types.Chan
 		out.Elem = b.walkType(u, nil, t.Elem())
-		// TODO: need to store direction, otherwise raw type name
-		// cannot be properly written.
+		switch t.Dir() {
+		case tc.SendOnly:
+			out.ChanDir = types.SendOnly
+		case tc.RecvOnly:
+			out.ChanDir = types.RecvOnly
+		}
 		return out
 	case *tc.Basic:
 		out := u.Type(types.Name{
@@ -762,9 +1387,11 @@ func (b *Builder) walkType(u types.Universe, useName *types.Name, in tc.Type) *t
 				out.Methods = map[string]*types.Type{}
 			}
 			method := t.Method(i)
-			name := tcNameToName(method.String())
+			name := b.interner.name(tcNameToName(method.String()))
 			mt := b.walkType(u, &name, method.Type())
-			mt.CommentLines = splitLines(b.priorCommentLines(method.Pos(), 1).Text())
+			mt.CommentLines, mt.SecondClosestCommentLines = b.priorMemberComments(method.Pos())
+			mt.Position = b.fset.Position(method.Pos())
+			b.goObjects[mt] = method
 			out.Methods[method.Name()] = mt
 		}
 		return out
@@ -772,19 +1399,20 @@ func (b *Builder) walkType(u types.Universe, useName *types.Name, in tc.Type) *t
 		var out *types.Type
 		switch t.Underlying().(type) {
 		case *tc.Named, *tc.Basic, *tc.Map, *tc.Slice:
-			name := tcNameToName(t.String())
+			name := b.interner.name(tcNameToName(t.String()))
 			out = u.Type(name)
 			if out.Kind != types.Unknown {
 				return out
 			}
 			out.Kind = types.Alias
 			out.Underlying = b.walkType(u, nil, t.Underlying())
+			out.Size, out.Align = b.sizes().Sizeof(t), b.sizes().Alignof(t)
 		default:
 			// tc package makes everything "named" with an
 			// underlying anonymous type--we remove that annoying
 			// "feature" for users. This flattens those types
 			// together.
-			name := tcNameToName(t.String())
+			name := b.interner.name(tcNameToName(t.String()))
 			if out := u.Type(name); out.Kind != types.Unknown {
 				return out // short circuit if we've already made this.
 			}
@@ -798,9 +1426,11 @@ func (b *Builder) walkType(u types.Universe, useName *types.Name, in tc.Type) *t
 					out.Methods = map[string]*types.Type{}
 				}
 				method := t.Method(i)
-				name := tcNameToName(method.String())
+				name := b.interner.name(tcNameToName(method.String()))
 				mt := b.walkType(u, &name, method.Type())
-				mt.CommentLines = splitLines(b.priorCommentLines(method.Pos(), 1).Text())
+				mt.CommentLines, mt.SecondClosestCommentLines = b.priorComments(method.Pos())
+				mt.Position = b.fset.Position(method.Pos())
+				b.goObjects[mt] = method
 				out.Methods[method.Name()] = mt
 			}
 		}
@@ -821,18 +1451,40 @@ func (b *Builder) addFunction(u types.Universe, useName *types.Name, in *tc.Func
 	if useName != nil {
 		name = *useName
 	}
-	out := u.Function(name)
+	out := u.Function(b.interner.name(name))
 	out.Kind = types.DeclarationOf
 	out.Underlying = b.walkType(u, nil, in.Type())
 	return out
 }
 
+// unalias returns the type an alias stands for. Newer type checkers
+// represent aliases by a type with an Rhs method; older ones resolve them
+// themselves.
+func unalias(t tc.Type) tc.Type {
+	for {
+		alias, ok := t.(interface{ Rhs() tc.Type })
+		if !ok {
+			return t
+		}
+		t = alias.Rhs()
+	}
+}
+
+// addTypeAlias records a type alias declaration, which the type checker
+// otherwise resolves to the aliased type.
+func (b *Builder) addTypeAlias(u types.Universe, in *tc.TypeName) *types.Type {
+	out := u.Type(types.Name{Package: in.Pkg().Path(), Name: in.Name()})
+	out.Kind = types.TypeAlias
+	out.Underlying = b.walkType(u, nil, in.Type())
+	return out
+}
+
 func (b *Builder) addVariable(u types.Universe, useName *types.Name, in *tc.Var) *types.Type {
 	name := tcVarNameToName(in.String())
 	if useName != nil {
 		name = *useName
 	}
-	out := u.Variable(name)
+	out := u.Variable(b.interner.name(name))
 	out.Kind = types.DeclarationOf
 	out.Underlying = b.walkType(u, nil, in.Type())
 	return out
@@ -843,9 +1495,17 @@ func (b *Builder) addConstant(u types.Universe, useName *types.Name, in *tc.Cons
 	if useName != nil {
 		name = *useName
 	}
-	out := u.Constant(name)
+	out := u.Constant(b.interner.name(name))
 	out.Kind = types.DeclarationOf
 	out.Underlying = b.walkType(u, nil, in.Type())
+
+	var value string
+	if in.Val().Kind() == constant.String {
+		value = constant.StringVal(in.Val())
+	} else {
+		value = in.Val().ExactString()
+	}
+	out.ConstValue = &value
 	return out
 }
 
@@ -0,0 +1,86 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMemberComments(t *testing.T) {
+	const src = `package comments
+
+// Tagged is a struct with tags of its own.
+// +gogogen:deepcopy-gen=true
+// +gogogen:deepcopy-gen:interfaces=example.com/pkg.Object
+type Tagged struct {
+	// First has a comment of its own.
+	First int
+
+	Second int // Second trails this.
+
+	// +gogogen:second-closest
+
+	// Third has both.
+	Third string
+	Fourth string
+}
+
+// +gogogen:interface-tag
+type Iface interface {
+	// Method has a comment of its own.
+	Method()
+}
+`
+	b := New()
+	if err := b.AddFileForTest("example.com/comments", "/src/example.com/comments/comments.go", []byte(src)); err != nil {
+		t.Fatal(err)
+	}
+	u, err := b.FindTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := u.Package("example.com/comments")
+
+	empty := []string{""}
+	tagged := pkg.Types["Tagged"]
+	for i, want := range []struct {
+		closest, second []string
+	}{
+		{[]string{"First has a comment of its own."}, empty},
+		{empty, empty},
+		{[]string{"Third has both."}, []string{"+gogogen:second-closest"}},
+		{empty, empty},
+	} {
+		m := tagged.Members[i]
+		if !reflect.DeepEqual(m.CommentLines, want.closest) {
+			t.Errorf("%s: got comment lines %q, want %q", m.Name, m.CommentLines, want.closest)
+		}
+		if !reflect.DeepEqual(m.SecondClosestCommentLines, want.second) {
+			t.Errorf("%s: got second-closest comment lines %q, want %q", m.Name, m.SecondClosestCommentLines, want.second)
+		}
+		if tags := m.CommentTags("+"); tags.Has("gogogen:deepcopy-gen") {
+			t.Errorf("%s: inherited the tags of its type", m.Name)
+		}
+	}
+
+	method := pkg.Types["Iface"].Methods["Method"]
+	if !reflect.DeepEqual(method.SecondClosestCommentLines, empty) {
+		t.Errorf("Method: got second-closest comment lines %q, want none", method.SecondClosestCommentLines)
+	}
+	if !tagged.CommentTags("+").Has("gogogen:deepcopy-gen") {
+		t.Errorf("Tagged: lost its own tags")
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parser
+
+import (
+	"path"
+	"sort"
+
+	"github.com/lack-io/gogogen/gogenerator/types"
+)
+
+// NewFromSources returns a builder of the Go packages whose files are given
+// by 'files', a map of file paths to their sources, without reading them
+// from disk. The directory of a path is the import path of the package of
+// the file, as in "example.com/m/pkg/types.go"; paths use forward slashes.
+// All the packages are user requested. Imports among them are resolved
+// from 'files' too, so sources which import only each other never touch
+// the file system; other imports, as of the standard library, are loaded
+// as usual. Errors of the type checker are returned.
+func NewFromSources(files map[string]string) (*Builder, error) {
+	b := New()
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	pkgPaths := []importPathString{}
+	for _, p := range paths {
+		pkgPath := importPathString(path.Dir(p))
+		if _, found := b.parsed[pkgPath]; !found {
+			pkgPaths = append(pkgPaths, pkgPath)
+		}
+		if err := b.addFile(pkgPath, p, []byte(files[p]), true); err != nil {
+			return nil, newError(pkgPath, p, err)
+		}
+	}
+	// The type checker imports the packages among them as it needs them.
+	for _, pkgPath := range pkgPaths {
+		if _, err := b.typeCheckPackage(pkgPath); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// UniverseFromSources returns the types of the Go packages given by 'files',
+// as built by NewFromSources.
+func UniverseFromSources(files map[string]string) (types.Universe, error) {
+	b, err := NewFromSources(files)
+	if err != nil {
+		return nil, err
+	}
+	return b.FindTypes()
+}
@@ -0,0 +1,212 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plugin
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/types"
+	"github.com/lack-io/gogogen/util/log"
+)
+
+const (
+	// BinaryPrefix is prepended to plugin names to find their binaries.
+	BinaryPrefix = "gogogen-plugin-"
+
+	// RawFileType is the file type of files produced by plugins. Their
+	// content is written as is.
+	RawFileType = "plugin-raw"
+)
+
+// Spec selects a plugin, in the form "name" or "name=parameter". The binary
+// is found by looking up BinaryPrefix+name in $PATH, unless name contains a
+// path separator, in which case it is run directly.
+type Spec string
+
+func (s Spec) binary() string {
+	name := strings.SplitN(string(s), "=", 2)[0]
+	if strings.ContainsRune(name, os.PathSeparator) {
+		return name
+	}
+	return BinaryPrefix + name
+}
+
+// binaryHash returns a hash of the plugin binary and its parameter, or of
+// its name if the binary can't be read.
+func (s Spec) binaryHash() string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00", s.binary(), s.parameter())
+	if bin, err := exec.LookPath(s.binary()); err == nil {
+		if f, err := os.Open(bin); err == nil {
+			io.Copy(h, f)
+			f.Close()
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (s Spec) parameter() string {
+	if parts := strings.SplitN(string(s), "=", 2); len(parts) == 2 {
+		return parts[1]
+	}
+	return ""
+}
+
+// Run sends the context to the plugin and returns its response.
+func Run(c *generator.Context, spec Spec, header []byte) (*Response, error) {
+	req := &Request{
+		Parameter: spec.parameter(),
+		Inputs:    c.Inputs,
+		Verify:    c.Verify,
+		Header:    string(header),
+		Packages:  EncodeUniverse(c.Universe),
+	}
+	in := &bytes.Buffer{}
+	if err := json.NewEncoder(in).Encode(req); err != nil {
+		return nil, fmt.Errorf("unable to encode request for plugin %q: %v", spec.binary(), err)
+	}
+
+	out := &bytes.Buffer{}
+	cmd := exec.Command(spec.binary())
+	cmd.Stdin = in
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+	log.Infof("Running plugin %q", spec.binary())
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("plugin %q failed: %v", spec.binary(), err)
+	}
+
+	resp := &Response{}
+	if err := json.NewDecoder(out).Decode(resp); err != nil {
+		return nil, fmt.Errorf("unable to decode response of plugin %q: %v", spec.binary(), err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("plugin %q: %s", spec.binary(), resp.Error)
+	}
+	return resp, nil
+}
+
+// Packages runs the plugin and wraps the files it generated as packages,
+// so they can be executed (or verified) like those of any other generator.
+// The raw file type is registered in the context.
+func Packages(c *generator.Context, spec Spec, header []byte) (generator.Packages, error) {
+	resp, err := Run(c, spec, header)
+	if err != nil {
+		return nil, err
+	}
+	c.FileTypes[RawFileType] = NewRawFile()
+
+	// Files are grouped into packages by output base and directory.
+	type outputDir struct {
+		base, dir string
+	}
+	byDir := map[outputDir][]File{}
+	for _, f := range resp.Files {
+		clean := path.Clean(f.Name)
+		if path.IsAbs(clean) || strings.HasPrefix(clean, "../") {
+			return nil, fmt.Errorf("plugin %q: file %q is not relative to the output base", spec.binary(), f.Name)
+		}
+		dir, name := path.Split(clean)
+		key := outputDir{f.OutputBase, dir}
+		byDir[key] = append(byDir[key], File{Name: name, Content: f.Content})
+	}
+	binaryHash := spec.binaryHash()
+	dirs := []outputDir{}
+	for dir := range byDir {
+		dirs = append(dirs, dir)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		if dirs[i].base != dirs[j].base {
+			return dirs[i].base < dirs[j].base
+		}
+		return dirs[i].dir < dirs[j].dir
+	})
+
+	packages := generator.Packages{}
+	for _, key := range dirs {
+		dir := key.dir
+		generators := []generator.Generator{}
+		for _, f := range byDir[key] {
+			generators = append(generators, rawGen{
+				DefaultGen: generator.DefaultGen{
+					OptionalName: f.Name,
+					OptionalBody: []byte(f.Content),
+				},
+			})
+		}
+		packages = append(packages, &pluginPackage{
+			DefaultPackage: &generator.DefaultPackage{
+				PackageName:   path.Base(dir),
+				PackagePath:   strings.TrimSuffix(dir, "/"),
+				OutputBase:    key.base,
+				GeneratorList: generators,
+				// Plugins have already seen every type.
+				FilterFunc: func(*generator.Context, *types.Type) bool { return false },
+			},
+			cacheKey: filesKey(binaryHash, byDir[key]),
+		})
+	}
+	return packages, nil
+}
+
+// pluginPackage is a package of files generated by a plugin. As the plugin
+// sees no type through the package, its files and the plugin binary are what
+// the incremental generation cache keys it with.
+type pluginPackage struct {
+	*generator.DefaultPackage
+	cacheKey string
+}
+
+func (p *pluginPackage) CacheKey() string { return p.cacheKey }
+
+// filesKey hashes the plugin binary hash and the names and contents of
+// 'files'.
+func filesKey(binaryHash string, files []File) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00", binaryHash)
+	for _, f := range files {
+		fmt.Fprintf(h, "%s\x00%d\x00%s", f.Name, len(f.Content), f.Content)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// rawGen emits a plugin's file verbatim.
+type rawGen struct {
+	generator.DefaultGen
+}
+
+func (g rawGen) Filename() string { return g.OptionalName }
+func (g rawGen) FileType() string { return RawFileType }
+
+// NewRawFile returns a file type which writes the file body as is.
+func NewRawFile() *generator.DefaultFileType {
+	return &generator.DefaultFileType{
+		Format: func(b []byte) ([]byte, error) { return b, nil },
+		Assemble: func(w io.Writer, f *generator.File) {
+			w.Write(f.Body.Bytes())
+		},
+	}
+}
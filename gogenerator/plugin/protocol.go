@@ -0,0 +1,299 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package plugin implements a protoc-style protocol for running generators
+// as external programs. The framework writes a Request, holding the parsed
+// types, as JSON to the plugin's stdin, and reads a Response, holding the
+// generated files, as JSON from its stdout.
+package plugin
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+
+	"github.com/lack-io/gogogen/gogenerator/types"
+)
+
+// Request is sent to a plugin on its stdin.
+type Request struct {
+	// The parameter given to the plugin on the command line, if any.
+	Parameter string `json:"parameter,omitempty"`
+
+	// All the user-specified packages. This is after recursive expansion.
+	Inputs []string `json:"inputs"`
+
+	// If true, the framework will only verify the files in the response
+	// against the files on disk.
+	Verify bool `json:"verify,omitempty"`
+
+	// The boilerplate header plugins should emit at the top of Go files.
+	Header string `json:"header,omitempty"`
+
+	// Every package and type known to the framework.
+	Packages []Package `json:"packages"`
+}
+
+// Response is read from a plugin's stdout.
+type Response struct {
+	// If set, the plugin failed, and no files are written.
+	Error string `json:"error,omitempty"`
+
+	// The generated files.
+	Files []File `json:"files,omitempty"`
+}
+
+// File is a single generated file.
+type File struct {
+	// The path of the file, relative to the output base, using forward
+	// slashes, e.g. "github.com/foo/bar/zz_generated.go".
+	Name string `json:"name"`
+
+	// The complete content of the file.
+	Content string `json:"content"`
+
+	// If set, the directory Name is relative to, instead of the output
+	// base, so that a plugin can write into several source trees.
+	OutputBase string `json:"outputBase,omitempty"`
+}
+
+// Package is the serialized form of a types.Package. Types refer to each
+// other by name.
+type Package struct {
+	Path        string   `json:"path"`
+	SourcePath  string   `json:"sourcePath,omitempty"`
+	Name        string   `json:"name,omitempty"`
+	DocComments []string `json:"docComments,omitempty"`
+	Comments    []string `json:"comments,omitempty"`
+	Types       []Type   `json:"types,omitempty"`
+	Functions   []Type   `json:"functions,omitempty"`
+	Variables   []Type   `json:"variables,omitempty"`
+	Constants   []Type   `json:"constants,omitempty"`
+	Imports     []string `json:"imports,omitempty"`
+}
+
+// Type is the serialized form of a types.Type.
+type Type struct {
+	Name                      types.Name            `json:"name"`
+	Kind                      types.Kind            `json:"kind"`
+	CommentLines              []string              `json:"commentLines,omitempty"`
+	SecondClosestCommentLines []string              `json:"secondClosestCommentLines,omitempty"`
+	Members                   []Member              `json:"members,omitempty"`
+	Elem                      *types.Name           `json:"elem,omitempty"`
+	Key                       *types.Name           `json:"key,omitempty"`
+	Underlying                *types.Name           `json:"underlying,omitempty"`
+	Methods                   map[string]types.Name `json:"methods,omitempty"`
+	Signature                 *Signature            `json:"signature,omitempty"`
+}
+
+// Member is the serialized form of a types.Member.
+type Member struct {
+	Name         string     `json:"name"`
+	Embedded     bool       `json:"embedded,omitempty"`
+	CommentLines []string   `json:"commentLines,omitempty"`
+	Tags         string     `json:"tags,omitempty"`
+	Type         types.Name `json:"type"`
+}
+
+// Signature is the serialized form of a types.Signature.
+type Signature struct {
+	Receiver       *types.Name  `json:"receiver,omitempty"`
+	Parameters     []types.Name `json:"parameters,omitempty"`
+	Results        []types.Name `json:"results,omitempty"`
+	ParameterNames []string     `json:"parameterNames,omitempty"`
+	ResultNames    []string     `json:"resultNames,omitempty"`
+	Variadic       bool         `json:"variadic,omitempty"`
+}
+
+// ReadRequest decodes a Request, as written by the framework.
+func ReadRequest(r io.Reader) (*Request, error) {
+	req := &Request{}
+	if err := json.NewDecoder(r).Decode(req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// WriteResponse encodes a Response, to be read by the framework.
+func WriteResponse(w io.Writer, resp *Response) error {
+	return json.NewEncoder(w).Encode(resp)
+}
+
+// EncodeUniverse converts a universe to its serialized form.
+func EncodeUniverse(u types.Universe) []Package {
+	paths := []string{}
+	for path := range u {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	out := []Package{}
+	for _, path := range paths {
+		p := u[path]
+		sp := Package{
+			Path:        p.Path,
+			SourcePath:  p.SourcePath,
+			Name:        p.Name,
+			DocComments: p.DocComments,
+			Comments:    p.Comments,
+			Types:       encodeTypes(p.Types),
+			Functions:   encodeTypes(p.Functions),
+			Variables:   encodeTypes(p.Variables),
+			Constants:   encodeTypes(p.Constants),
+		}
+		for imp := range p.Imports {
+			sp.Imports = append(sp.Imports, imp)
+		}
+		sort.Strings(sp.Imports)
+		out = append(out, sp)
+	}
+	return out
+}
+
+func encodeTypes(in map[string]*types.Type) []Type {
+	names := []string{}
+	for name := range in {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := []Type{}
+	for _, name := range names {
+		out = append(out, encodeType(in[name]))
+	}
+	return out
+}
+
+func ref(t *types.Type) *types.Name {
+	if t == nil {
+		return nil
+	}
+	n := t.Name
+	return &n
+}
+
+func encodeType(t *types.Type) Type {
+	st := Type{
+		Name:                      t.Name,
+		Kind:                      t.Kind,
+		CommentLines:              t.CommentLines,
+		SecondClosestCommentLines: t.SecondClosestCommentLines,
+		Elem:                      ref(t.Elem),
+		Key:                       ref(t.Key),
+		Underlying:                ref(t.Underlying),
+	}
+	for _, m := range t.Members {
+		st.Members = append(st.Members, Member{
+			Name:         m.Name,
+			Embedded:     m.Embedded,
+			CommentLines: m.CommentLines,
+			Tags:         m.Tags,
+			Type:         m.Type.Name,
+		})
+	}
+	if len(t.Methods) > 0 {
+		st.Methods = map[string]types.Name{}
+		for name, m := range t.Methods {
+			st.Methods[name] = m.Name
+		}
+	}
+	if t.Signature != nil {
+		st.Signature = &Signature{
+			Receiver:       ref(t.Signature.Receiver),
+			ParameterNames: t.Signature.ParameterNames,
+			ResultNames:    t.Signature.ResultNames,
+			Variadic:       t.Signature.Variadic,
+		}
+		for _, p := range t.Signature.Parameters {
+			st.Signature.Parameters = append(st.Signature.Parameters, p.Name)
+		}
+		for _, r := range t.Signature.Results {
+			st.Signature.Results = append(st.Signature.Results, r.Name)
+		}
+	}
+	return st
+}
+
+// Universe rebuilds the types.Universe sent with the request, restoring the
+// references between types.
+func (r *Request) Universe() types.Universe {
+	u := types.Universe{}
+	lookup := func(n *types.Name) *types.Type {
+		if n == nil {
+			return nil
+		}
+		return u.Type(*n)
+	}
+	fill := func(out *types.Type, in Type) {
+		out.Kind = in.Kind
+		out.CommentLines = in.CommentLines
+		out.SecondClosestCommentLines = in.SecondClosestCommentLines
+		out.Elem = lookup(in.Elem)
+		out.Key = lookup(in.Key)
+		out.Underlying = lookup(in.Underlying)
+		for _, m := range in.Members {
+			out.Members = append(out.Members, types.Member{
+				Name:         m.Name,
+				Embedded:     m.Embedded,
+				CommentLines: m.CommentLines,
+				Tags:         m.Tags,
+				Type:         u.Type(m.Type),
+			})
+		}
+		for name, m := range in.Methods {
+			if out.Methods == nil {
+				out.Methods = map[string]*types.Type{}
+			}
+			out.Methods[name] = u.Type(m)
+		}
+		if in.Signature != nil {
+			out.Signature = &types.Signature{
+				Receiver:       lookup(in.Signature.Receiver),
+				ParameterNames: in.Signature.ParameterNames,
+				ResultNames:    in.Signature.ResultNames,
+				Variadic:       in.Signature.Variadic,
+			}
+			for i := range in.Signature.Parameters {
+				out.Signature.Parameters = append(out.Signature.Parameters, u.Type(in.Signature.Parameters[i]))
+			}
+			for i := range in.Signature.Results {
+				out.Signature.Results = append(out.Signature.Results, u.Type(in.Signature.Results[i]))
+			}
+		}
+	}
+
+	for _, sp := range r.Packages {
+		p := u.Package(sp.Path)
+		p.SourcePath = sp.SourcePath
+		p.Name = sp.Name
+		p.DocComments = sp.DocComments
+		p.Comments = sp.Comments
+		for _, t := range sp.Types {
+			fill(p.Type(t.Name.Name), t)
+		}
+		for _, t := range sp.Functions {
+			fill(p.Function(t.Name.Name), t)
+		}
+		for _, t := range sp.Variables {
+			fill(p.Variable(t.Name.Name), t)
+		}
+		for _, t := range sp.Constants {
+			fill(p.Constant(t.Name.Name), t)
+		}
+	}
+	for _, sp := range r.Packages {
+		u.AddImports(sp.Path, sp.Imports...)
+	}
+	return u
+}
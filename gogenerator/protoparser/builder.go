@@ -0,0 +1,651 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package protoparser
+
+import (
+	"fmt"
+	gotoken "go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lack-io/gogogen/gogenerator/types"
+	"github.com/lack-io/gogogen/util/log"
+)
+
+// Builder lets you add .proto files, and then converts them into a
+// types.Universe.
+type Builder struct {
+	// Directories searched for imported files, like the --proto_path flag
+	// of protoc. Imports which cannot be found are ignored, but referring to
+	// a type defined in them is an error.
+	ImportPaths []string
+
+	// Parsed files, by absolute path, and the order they were added in.
+	files map[string]*protoFile
+	order []string
+
+	// Tracks which files were added explicitly, rather than by import.
+	userRequested map[string]bool
+
+	// The absolute path of each import, for those which were found.
+	imports map[string]string
+}
+
+// New constructs a new builder.
+func New() *Builder {
+	return &Builder{
+		files:         map[string]*protoFile{},
+		userRequested: map[string]bool{},
+		imports:       map[string]string{},
+	}
+}
+
+// AddFile parses the .proto file at 'filename'.
+func (b *Builder) AddFile(filename string) error {
+	src, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	return b.AddFileSource(filename, src)
+}
+
+// AddFileSource parses 'src' as the .proto file at 'filename'. The file does
+// not need to exist, which is useful for tests.
+func (b *Builder) AddFileSource(filename string, src []byte) error {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+	if err := b.addFile(abs, src); err != nil {
+		return err
+	}
+	b.userRequested[abs] = true
+	return nil
+}
+
+// AddDir parses every .proto file in 'dir'. It does not recurse.
+func (b *Builder) AddDir(dir string) error {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.proto"))
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("no .proto files in %q", dir)
+	}
+	sort.Strings(matches)
+	for _, m := range matches {
+		if err := b.AddFile(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Builder) addFile(abs string, src []byte) error {
+	if _, ok := b.files[abs]; ok {
+		return nil
+	}
+	f, err := parseFile(abs, src)
+	if err != nil {
+		return err
+	}
+	b.files[abs] = f
+	b.order = append(b.order, abs)
+	for _, imp := range f.imports {
+		if err := b.addImport(imp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Builder) addImport(imp string) error {
+	if _, ok := b.imports[imp]; ok {
+		return nil
+	}
+	for _, dir := range append(append([]string{}, b.ImportPaths...), ".") {
+		abs, err := filepath.Abs(filepath.Join(dir, filepath.FromSlash(imp)))
+		if err != nil {
+			return err
+		}
+		src, err := ioutil.ReadFile(abs)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		b.imports[imp] = abs
+		return b.addFile(abs, src)
+	}
+	log.Debugf("import %q not found in %v", imp, b.ImportPaths)
+	return nil
+}
+
+// FindPackages returns the Go package paths of the files that were added
+// explicitly.
+func (b *Builder) FindPackages() []string {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, abs := range b.order {
+		if !b.userRequested[abs] {
+			continue
+		}
+		pkgPath, _ := goPackage(b.files[abs])
+		if !seen[pkgPath] {
+			seen[pkgPath] = true
+			result = append(result, pkgPath)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// definition is a message or enum, along with where it was defined.
+type definition struct {
+	file    *protoFile
+	message *message
+	enum    *enum
+	// The enclosing message, if any.
+	parent *definition
+	// The fully-qualified proto name, without the leading dot.
+	fullName string
+	goName   string
+}
+
+// FindTypes converts all the parsed files, including the ones that were only
+// imported, into a types.Universe.
+func (b *Builder) FindTypes() (types.Universe, error) {
+	u := types.Universe{}
+	if err := b.FindTypesTo(&u); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// FindTypesTo adds the types of all the parsed files to 'u'.
+func (b *Builder) FindTypesTo(u *types.Universe) error {
+	defs := map[string]*definition{}
+	var ordered []*definition
+	var add func(f *protoFile, parent *definition, scope string, messages []*message, enums []*enum) error
+	add = func(f *protoFile, parent *definition, scope string, messages []*message, enums []*enum) error {
+		newDef := func(name string) (*definition, error) {
+			d := &definition{file: f, parent: parent, fullName: name}
+			if _, ok := defs[name]; ok {
+				return nil, fmt.Errorf("%s: %q is already defined", f.name, name)
+			}
+			d.goName = goCamelCase(strings.TrimPrefix(strings.TrimPrefix(name, f.pkg), "."))
+			defs[name] = d
+			ordered = append(ordered, d)
+			return d, nil
+		}
+		for _, e := range enums {
+			d, err := newDef(qualify(scope, e.name))
+			if err != nil {
+				return err
+			}
+			d.enum = e
+		}
+		for _, m := range messages {
+			d, err := newDef(qualify(scope, m.name))
+			if err != nil {
+				return err
+			}
+			d.message = m
+			if err := add(f, d, d.fullName, m.messages, m.enums); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, abs := range b.order {
+		f := b.files[abs]
+		if err := add(f, nil, f.pkg, f.messages, f.enums); err != nil {
+			return err
+		}
+	}
+
+	c := &converter{universe: *u, defs: defs}
+	for _, abs := range b.order {
+		f := b.files[abs]
+		pkgPath, pkgName := goPackage(f)
+		pkg := u.Package(pkgPath)
+		pkg.Path = pkgPath
+		pkg.Name = pkgName
+		pkg.SourcePath = filepath.Dir(abs)
+		pkg.Comments = append(pkg.Comments, f.comments...)
+		pkg.DocComments = append(pkg.DocComments, f.docComments...)
+		for _, imp := range f.imports {
+			if importAbs, ok := b.imports[imp]; ok {
+				if importPath, _ := goPackage(b.files[importAbs]); importPath != pkgPath {
+					u.AddImports(pkgPath, importPath)
+				}
+			}
+		}
+	}
+	for _, d := range ordered {
+		var err error
+		if d.enum != nil {
+			c.convertEnum(d)
+		} else {
+			err = c.convertMessage(d)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type converter struct {
+	universe types.Universe
+	defs     map[string]*definition
+}
+
+func (c *converter) typeOf(d *definition) *types.Type {
+	pkgPath, _ := goPackage(d.file)
+	return c.universe.Type(types.Name{Package: pkgPath, Name: d.goName})
+}
+
+// position returns the position in the file of 'd' of a declaration.
+func (c *converter) position(d *definition, line, column int) gotoken.Position {
+	return gotoken.Position{Filename: d.file.name, Line: line, Column: column}
+}
+
+func (c *converter) convertEnum(d *definition) {
+	t := c.typeOf(d)
+	t.Kind = types.Alias
+	t.Underlying = types.Int32
+	t.CommentLines = d.enum.comments
+	t.SecondClosestCommentLines = d.enum.secondComments
+	t.Position = c.position(d, d.enum.line, d.enum.column)
+
+	// Values of nested enums are prefixed with the enclosing message, like
+	// protoc-gen-go does.
+	prefix := d.goName
+	if d.parent != nil {
+		prefix = d.parent.goName
+	}
+	for _, v := range d.enum.values {
+		constant := c.universe.Constant(types.Name{Package: t.Name.Package, Name: prefix + "_" + v.name})
+		constant.Underlying = t
+		constant.CommentLines = v.comments
+		constant.Position = c.position(d, v.line, v.column)
+		value := strconv.Itoa(v.number)
+		constant.ConstValue = &value
+	}
+}
+
+func (c *converter) convertMessage(d *definition) error {
+	m := d.message
+	t := c.typeOf(d)
+	t.Kind = types.Struct
+	t.CommentLines = m.comments
+	t.SecondClosestCommentLines = m.secondComments
+	t.Position = c.position(d, m.line, m.column)
+	proto3 := d.file.syntax == "proto3"
+
+	oneofs := map[*oneof]bool{}
+	for _, f := range m.fields {
+		if f.oneof != nil {
+			if oneofs[f.oneof] {
+				continue
+			}
+			oneofs[f.oneof] = true
+			member, err := c.convertOneof(d, t, f.oneof)
+			if err != nil {
+				return err
+			}
+			t.Members = append(t.Members, member)
+			continue
+		}
+		fieldType, err := c.fieldType(d, f, proto3)
+		if err != nil {
+			return err
+		}
+		t.Members = append(t.Members, types.Member{
+			Name:         goCamelCase(f.name),
+			CommentLines: f.comments,
+			Tags:         c.structTags(d, f, proto3),
+			Type:         fieldType,
+			Position:     c.position(d, f.line, f.column),
+		})
+	}
+	return nil
+}
+
+// convertOneof returns the member holding the oneof 'o', whose type is an
+// interface implemented by a wrapper struct per field.
+func (c *converter) convertOneof(d *definition, t *types.Type, o *oneof) (types.Member, error) {
+	proto3 := d.file.syntax == "proto3"
+	methodName := "is" + d.goName + "_" + goCamelCase(o.name)
+	iface := c.universe.Type(types.Name{Package: t.Name.Package, Name: methodName})
+	iface.Kind = types.Interface
+	iface.Methods = map[string]*types.Type{
+		methodName: {
+			Name:      types.Name{Name: "func()"},
+			Kind:      types.Func,
+			Signature: &types.Signature{Receiver: iface},
+		},
+	}
+	for _, f := range o.fields {
+		wrapperName := d.goName + "_" + goCamelCase(f.name)
+		if _, ok := c.defs[qualify(d.fullName, goCamelCase(f.name))]; ok {
+			wrapperName += "_"
+		}
+		fieldType, err := c.fieldType(d, f, proto3)
+		if err != nil {
+			return types.Member{}, err
+		}
+		wrapper := c.universe.Type(types.Name{Package: t.Name.Package, Name: wrapperName})
+		wrapper.Kind = types.Struct
+		wrapper.CommentLines = f.comments
+		wrapper.Members = []types.Member{{
+			Name:         goCamelCase(f.name),
+			CommentLines: f.comments,
+			Tags:         c.structTags(d, f, proto3),
+			Type:         fieldType,
+		}}
+	}
+	return types.Member{
+		Name:         goCamelCase(o.name),
+		CommentLines: o.comments,
+		Tags:         fmt.Sprintf(`protobuf_oneof:"%s"`, o.name),
+		Type:         iface,
+	}, nil
+}
+
+// scalarTypes maps the scalar proto types to Go types and wire types.
+var scalarTypes = map[string]struct {
+	t    *types.Type
+	wire string
+}{
+	"double":   {types.Float64, "fixed64"},
+	"float":    {types.Float32, "fixed32"},
+	"int32":    {types.Int32, "varint"},
+	"int64":    {types.Int64, "varint"},
+	"uint32":   {types.Uint32, "varint"},
+	"uint64":   {types.Uint64, "varint"},
+	"sint32":   {types.Int32, "zigzag32"},
+	"sint64":   {types.Int64, "zigzag64"},
+	"fixed32":  {types.Uint32, "fixed32"},
+	"fixed64":  {types.Uint64, "fixed64"},
+	"sfixed32": {types.Int32, "fixed32"},
+	"sfixed64": {types.Int64, "fixed64"},
+	"bool":     {types.Bool, "varint"},
+	"string":   {types.String, "bytes"},
+	"bytes":    {nil, "bytes"},
+}
+
+// resolve finds the definition a type reference made in 'scope' refers to,
+// following the protobuf scoping rules.
+func (c *converter) resolve(scope, ref string) *definition {
+	if strings.HasPrefix(ref, ".") {
+		return c.defs[ref[1:]]
+	}
+	first := ref
+	if i := strings.Index(ref, "."); i != -1 {
+		first = ref[:i]
+	}
+	for {
+		if _, ok := c.defs[qualify(scope, first)]; ok {
+			return c.defs[qualify(scope, ref)]
+		}
+		if scope == "" {
+			return nil
+		}
+		if i := strings.LastIndex(scope, "."); i != -1 {
+			scope = scope[:i]
+		} else {
+			scope = ""
+		}
+	}
+}
+
+// elemType returns the Go type of a single value of the proto type 'name'.
+func (c *converter) elemType(d *definition, name string) (*types.Type, *definition, error) {
+	if scalar, ok := scalarTypes[name]; ok {
+		if scalar.t == nil {
+			return c.slice(types.Byte), nil, nil
+		}
+		return scalar.t, nil, nil
+	}
+	ref := c.resolve(d.fullName, name)
+	if ref == nil {
+		return nil, nil, fmt.Errorf("%s: message %q refers to unknown type %q", d.file.name, d.fullName, name)
+	}
+	if ref.message != nil {
+		return c.pointer(c.typeOf(ref)), ref, nil
+	}
+	return c.typeOf(ref), ref, nil
+}
+
+func (c *converter) fieldType(d *definition, f *field, proto3 bool) (*types.Type, error) {
+	elem, ref, err := c.elemType(d, f.typeName)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.keyType) > 0 {
+		key, ok := scalarTypes[f.keyType]
+		if !ok || key.t == nil || key.t == types.Float32 || key.t == types.Float64 {
+			return nil, fmt.Errorf("%s: field %q of %q has invalid map key type %q", d.file.name, f.name, d.fullName, f.keyType)
+		}
+		return c.mapOf(key.t, elem), nil
+	}
+	if f.label == "repeated" {
+		return c.slice(elem), nil
+	}
+	// Messages and bytes are already nillable. Other proto2 fields, proto3
+	// optional fields and oneof members are pointers to track presence.
+	if elem.Kind == types.Pointer || elem.Kind == types.Slice || f.oneof != nil {
+		return elem, nil
+	}
+	if (!proto3 || f.label == "optional") && (ref == nil || ref.enum != nil) {
+		return c.pointer(elem), nil
+	}
+	return elem, nil
+}
+
+// structTags returns the struct tags protoc-gen-go generates for 'f'.
+func (c *converter) structTags(d *definition, f *field, proto3 bool) string {
+	if len(f.keyType) > 0 {
+		key := fieldTag(&field{name: "key", number: 1, typeName: f.keyType}, "", proto3)
+		value := &field{name: "value", number: 2, typeName: f.typeName}
+		return fmt.Sprintf(`protobuf:"%s" json:"%s,omitempty" protobuf_key:"%s" protobuf_val:"%s"`,
+			fieldTag(f, "", proto3), f.name, key, fieldTag(value, c.enumName(d, f.typeName), proto3))
+	}
+	tag := fmt.Sprintf(`protobuf:"%s"`, fieldTag(f, c.enumName(d, f.typeName), proto3))
+	switch {
+	case f.oneof != nil:
+	case f.label == "required":
+		tag += fmt.Sprintf(` json:"%s"`, f.name)
+	default:
+		tag += fmt.Sprintf(` json:"%s,omitempty"`, f.name)
+	}
+	return tag
+}
+
+func (c *converter) enumName(d *definition, typeName string) string {
+	if _, ok := scalarTypes[typeName]; ok {
+		return ""
+	}
+	if ref := c.resolve(d.fullName, typeName); ref != nil && ref.enum != nil {
+		return ref.fullName
+	}
+	return ""
+}
+
+func fieldTag(f *field, enumName string, proto3 bool) string {
+	wire := "bytes"
+	if scalar, ok := scalarTypes[f.typeName]; ok {
+		wire = scalar.wire
+	} else if len(enumName) > 0 {
+		wire = "varint"
+	}
+	label := "opt"
+	switch {
+	case f.label == "required":
+		label = "req"
+	case f.label == "repeated" || len(f.keyType) > 0:
+		label = "rep"
+	}
+	parts := []string{wire, strconv.Itoa(f.number), label}
+	if f.label == "repeated" && proto3 && wire != "bytes" {
+		parts = append(parts, "packed")
+	}
+	parts = append(parts, "name="+f.name)
+	jsonName := f.jsonName
+	if len(jsonName) == 0 {
+		jsonName = defaultJSONName(f.name)
+	}
+	if jsonName != f.name {
+		parts = append(parts, "json="+jsonName)
+	}
+	if proto3 {
+		parts = append(parts, "proto3")
+	}
+	if len(enumName) > 0 {
+		parts = append(parts, "enum="+enumName)
+	}
+	if f.oneof != nil {
+		parts = append(parts, "oneof")
+	}
+	return strings.Join(parts, ",")
+}
+
+func (c *converter) pointer(elem *types.Type) *types.Type {
+	t := c.universe.Type(types.Name{Name: "*" + elem.Name.String()})
+	t.Kind = types.Pointer
+	t.Elem = elem
+	return t
+}
+
+func (c *converter) slice(elem *types.Type) *types.Type {
+	t := c.universe.Type(types.Name{Name: "[]" + elem.Name.String()})
+	t.Kind = types.Slice
+	t.Elem = elem
+	return t
+}
+
+func (c *converter) mapOf(key, elem *types.Type) *types.Type {
+	t := c.universe.Type(types.Name{Name: "map[" + key.Name.String() + "]" + elem.Name.String()})
+	t.Kind = types.Map
+	t.Key = key
+	t.Elem = elem
+	return t
+}
+
+func qualify(scope, name string) string {
+	if len(scope) == 0 {
+		return name
+	}
+	return scope + "." + name
+}
+
+// goPackage returns the Go package path and name for the types of 'f'. The
+// go_package option is used if set, the proto package otherwise.
+func goPackage(f *protoFile) (pkgPath, pkgName string) {
+	switch {
+	case len(f.goPackage) > 0:
+		pkgPath = f.goPackage
+		if i := strings.Index(pkgPath, ";"); i != -1 {
+			pkgPath, pkgName = pkgPath[:i], pkgPath[i+1:]
+		}
+	case len(f.pkg) > 0:
+		pkgPath = strings.Replace(f.pkg, ".", "/", -1)
+	default:
+		pkgPath = filepath.ToSlash(filepath.Dir(f.name))
+	}
+	if len(pkgName) == 0 {
+		pkgName = path.Base(pkgPath)
+	}
+	return pkgPath, goSanitized(pkgName)
+}
+
+// goSanitized turns 's' into a valid Go identifier.
+func goSanitized(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if !isLetter(c) && !isDigit(c) {
+			b[i] = '_'
+		}
+	}
+	if len(b) == 0 || isDigit(b[0]) {
+		b = append([]byte{'_'}, b...)
+	}
+	return string(b)
+}
+
+// goCamelCase converts a proto name into the Go name protoc-gen-go uses.
+// Dots separating nested names become underscores.
+func goCamelCase(s string) string {
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '.' && i+1 < len(s) && isLower(s[i+1]):
+			// Skip over '.' in ".{{lowercase}}".
+		case c == '.':
+			b = append(b, '_')
+		case c == '_' && (i == 0 || s[i-1] == '.'):
+			// Convert initial '_' to ensure we start with a capital letter.
+			b = append(b, 'X')
+		case c == '_' && i+1 < len(s) && isLower(s[i+1]):
+			// Skip over '_' in "_{{lowercase}}".
+		case isDigit(c):
+			b = append(b, c)
+		default:
+			// Assume we have a letter now - if not, it's a bogus identifier.
+			if isLower(c) {
+				c -= 'a' - 'A'
+			}
+			b = append(b, c)
+			// Accept lower case sequence that follows.
+			for ; i+1 < len(s) && isLower(s[i+1]); i++ {
+				b = append(b, s[i+1])
+			}
+		}
+	}
+	return string(b)
+}
+
+// defaultJSONName returns the JSON name protoc assigns to a field.
+func defaultJSONName(name string) string {
+	var b []byte
+	upper := false
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c == '_':
+			upper = true
+		case upper && isLower(c):
+			b = append(b, c-('a'-'A'))
+			upper = false
+		default:
+			b = append(b, c)
+			upper = false
+		}
+	}
+	return string(b)
+}
+
+func isLower(c byte) bool {
+	return 'a' <= c && c <= 'z'
+}
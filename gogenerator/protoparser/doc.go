@@ -0,0 +1,25 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package protoparser parses .proto files into a types.Universe, so that
+// generators written against Go types can also be run over schemas defined
+// in protobuf.
+//
+// The universe describes the Go code protoc-gen-go would generate for the
+// files: messages become structs with protobuf and json struct tags, enums
+// become named int32 types with a constant per value, and oneofs become an
+// interface with a wrapper struct per field. Comments before a declaration
+// become its CommentLines, so comment tags work as they do for Go input.
+// Services, extensions and groups are not represented.
+package protoparser
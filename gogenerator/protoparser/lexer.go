@@ -0,0 +1,254 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package protoparser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenInt
+	tokenFloat
+	tokenString
+	tokenSymbol
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	line   int
+	column int
+
+	// The comment group ending on the line before the token, and the one
+	// ending on the line before that group (or two lines before the token,
+	// if there is no closer one).
+	comments       []string
+	secondComments []string
+}
+
+type commentGroup struct {
+	lines     []string
+	startLine int
+	endLine   int
+}
+
+// lexer splits a .proto file into tokens, attaching the comments before each
+// token to it.
+type lexer struct {
+	filename string
+	src      string
+	pos      int
+	line     int
+
+	// The offset of the first byte of the current line.
+	lineStart int
+
+	// The line of the previous token. Comments starting on it trail that
+	// token, and are not attached to the next one.
+	prevLine int
+
+	// The comment groups seen since the previous token.
+	groups []commentGroup
+}
+
+func newLexer(filename string, src []byte) *lexer {
+	return &lexer{filename: filename, src: string(src), line: 1}
+}
+
+func (l *lexer) errorf(line int, format string, args ...interface{}) error {
+	return fmt.Errorf("%s:%d: %s", l.filename, line, fmt.Sprintf(format, args...))
+}
+
+func (l *lexer) next() (token, error) {
+	if err := l.skipSpaceAndComments(); err != nil {
+		return token{}, err
+	}
+	tok := token{line: l.line, column: l.pos - l.lineStart + 1}
+	tok.comments, tok.secondComments = l.attachedComments(l.line)
+	l.groups = nil
+	l.prevLine = l.line
+
+	if l.pos >= len(l.src) {
+		tok.kind = tokenEOF
+		return tok, nil
+	}
+	start := l.pos
+	c := l.src[l.pos]
+	switch {
+	case isLetter(c):
+		for l.pos < len(l.src) && (isLetter(l.src[l.pos]) || isDigit(l.src[l.pos])) {
+			l.pos++
+		}
+		tok.kind = tokenIdent
+	case isDigit(c) || (c == '.' && l.pos+1 < len(l.src) && isDigit(l.src[l.pos+1])):
+		tok.kind = tokenInt
+		for l.pos < len(l.src) {
+			c := l.src[l.pos]
+			switch {
+			case isLetter(c) || isDigit(c):
+				if (c == 'e' || c == 'E') && !strings.HasPrefix(l.src[start:], "0x") && !strings.HasPrefix(l.src[start:], "0X") {
+					tok.kind = tokenFloat
+					if l.pos+1 < len(l.src) && (l.src[l.pos+1] == '+' || l.src[l.pos+1] == '-') {
+						l.pos++
+					}
+				}
+			case c == '.':
+				tok.kind = tokenFloat
+			default:
+				tok.text = l.src[start:l.pos]
+				return tok, nil
+			}
+			l.pos++
+		}
+	case c == '"' || c == '\'':
+		l.pos++
+		for {
+			if l.pos >= len(l.src) || l.src[l.pos] == '\n' {
+				return tok, l.errorf(tok.line, "unterminated string")
+			}
+			if l.src[l.pos] == '\\' {
+				l.pos += 2
+				continue
+			}
+			if l.src[l.pos] == c {
+				l.pos++
+				break
+			}
+			l.pos++
+		}
+		tok.kind = tokenString
+		quoted := l.src[start:l.pos]
+		if c == '\'' {
+			quoted = `"` + strings.Replace(quoted[1:len(quoted)-1], `"`, `\"`, -1) + `"`
+		}
+		s, err := strconv.Unquote(quoted)
+		if err != nil {
+			return tok, l.errorf(tok.line, "invalid string %s: %v", l.src[start:l.pos], err)
+		}
+		tok.text = s
+		return tok, nil
+	default:
+		l.pos++
+		tok.kind = tokenSymbol
+	}
+	tok.text = l.src[start:l.pos]
+	return tok, nil
+}
+
+func (l *lexer) skipSpaceAndComments() error {
+	for l.pos < len(l.src) {
+		switch c := l.src[l.pos]; {
+		case c == '\n':
+			l.line++
+			l.pos++
+			l.lineStart = l.pos
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v':
+			l.pos++
+		case strings.HasPrefix(l.src[l.pos:], "//"):
+			end := strings.IndexByte(l.src[l.pos:], '\n')
+			if end == -1 {
+				end = len(l.src) - l.pos
+			}
+			l.addComment(l.line, l.line, []string{trimCommentLine(l.src[l.pos+2 : l.pos+end])})
+			l.pos += end
+		case strings.HasPrefix(l.src[l.pos:], "/*"):
+			end := strings.Index(l.src[l.pos+2:], "*/")
+			if end == -1 {
+				return l.errorf(l.line, "unterminated comment")
+			}
+			text := l.src[l.pos+2 : l.pos+2+end]
+			startLine := l.line
+			l.line += strings.Count(text, "\n")
+			var lines []string
+			for _, line := range strings.Split(text, "\n") {
+				line = strings.TrimSpace(line)
+				line = strings.TrimPrefix(line, "*")
+				lines = append(lines, trimCommentLine(line))
+			}
+			l.addComment(startLine, l.line, lines)
+			if nl := strings.LastIndexByte(text, '\n'); nl != -1 {
+				l.lineStart = l.pos + 2 + nl + 1
+			}
+			l.pos += 2 + end + 2
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// addComment adds comment lines to the current group if they directly follow
+// it, and starts a new group otherwise.
+func (l *lexer) addComment(startLine, endLine int, lines []string) {
+	if startLine == l.prevLine {
+		return
+	}
+	if n := len(l.groups); n > 0 && l.groups[n-1].endLine == startLine-1 {
+		l.groups[n-1].lines = append(l.groups[n-1].lines, lines...)
+		l.groups[n-1].endLine = endLine
+		return
+	}
+	l.groups = append(l.groups, commentGroup{lines: lines, startLine: startLine, endLine: endLine})
+}
+
+// attachedComments returns the comments for a token on the given line, the
+// same way the Go parser finds them for a declaration.
+func (l *lexer) attachedComments(line int) (comments, second []string) {
+	byEndLine := map[int]commentGroup{}
+	for _, g := range l.groups {
+		byEndLine[g.endLine] = g
+	}
+	if g, ok := byEndLine[line-1]; ok {
+		comments = trimBlankLines(g.lines)
+		if g2, ok := byEndLine[g.startLine-2]; ok {
+			second = trimBlankLines(g2.lines)
+		}
+		return comments, second
+	}
+	if g, ok := byEndLine[line-2]; ok {
+		second = trimBlankLines(g.lines)
+	}
+	return nil, second
+}
+
+// trimCommentLine removes the single space conventionally following the
+// comment marker.
+func trimCommentLine(line string) string {
+	return strings.TrimRight(strings.TrimPrefix(line, " "), " \t\r")
+}
+
+func trimBlankLines(lines []string) []string {
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func isLetter(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
@@ -0,0 +1,579 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package protoparser
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// protoFile is the parsed form of a .proto file.
+type protoFile struct {
+	name      string
+	syntax    string
+	pkg       string
+	goPackage string
+	imports   []string
+
+	// The comments before the syntax, package and file option statements,
+	// and the ones directly before the package statement.
+	comments    []string
+	docComments []string
+
+	messages []*message
+	enums    []*enum
+}
+
+type message struct {
+	name           string
+	line, column   int
+	comments       []string
+	secondComments []string
+
+	fields   []*field
+	oneofs   []*oneof
+	messages []*message
+	enums    []*enum
+}
+
+type field struct {
+	name         string
+	line, column int
+	number       int
+	label        string
+	typeName     string
+	// Only set for map fields, whose typeName is the value type.
+	keyType  string
+	jsonName string
+	comments []string
+
+	// The oneof the field belongs to, if any.
+	oneof *oneof
+}
+
+type oneof struct {
+	name     string
+	comments []string
+	fields   []*field
+}
+
+type enum struct {
+	name           string
+	line, column   int
+	comments       []string
+	secondComments []string
+	values         []*enumValue
+}
+
+type enumValue struct {
+	name         string
+	line, column int
+	number       int
+	comments     []string
+}
+
+type fileParser struct {
+	lex *lexer
+	tok token
+}
+
+// parseFile parses the source of a single .proto file.
+func parseFile(filename string, src []byte) (*protoFile, error) {
+	p := &fileParser{lex: newLexer(filename, src)}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	f := &protoFile{name: filename, syntax: "proto2"}
+	for p.tok.kind != tokenEOF {
+		if p.is(";") {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		tok, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		switch tok.text {
+		case "syntax":
+			f.comments = append(f.comments, commentsOf(tok)...)
+			if err := p.expect("="); err != nil {
+				return nil, err
+			}
+			s, err := p.str()
+			if err != nil {
+				return nil, err
+			}
+			if s != "proto2" && s != "proto3" {
+				return nil, p.lex.errorf(tok.line, "unsupported syntax %q", s)
+			}
+			f.syntax = s
+			err = p.expect(";")
+		case "package":
+			f.comments = append(f.comments, commentsOf(tok)...)
+			f.docComments = tok.comments
+			f.pkg, err = p.fullIdent()
+			if err == nil {
+				err = p.expect(";")
+			}
+		case "import":
+			if p.is("public") || p.is("weak") {
+				if err := p.advance(); err != nil {
+					return nil, err
+				}
+			}
+			var path string
+			if path, err = p.str(); err == nil {
+				f.imports = append(f.imports, path)
+				err = p.expect(";")
+			}
+		case "option":
+			f.comments = append(f.comments, commentsOf(tok)...)
+			var name, value string
+			if name, value, err = p.option(); err == nil {
+				if name == "go_package" {
+					f.goPackage = value
+				}
+				err = p.expect(";")
+			}
+		case "message":
+			var m *message
+			if m, err = p.message(tok); err == nil {
+				f.messages = append(f.messages, m)
+			}
+		case "enum":
+			var e *enum
+			if e, err = p.enum(tok); err == nil {
+				f.enums = append(f.enums, e)
+			}
+		case "service", "extend":
+			err = p.skipDeclaration()
+		default:
+			err = p.lex.errorf(tok.line, "unexpected %q", tok.text)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func commentsOf(tok token) []string {
+	return append(append([]string{}, tok.secondComments...), tok.comments...)
+}
+
+func (p *fileParser) advance() error {
+	tok, err := p.lex.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *fileParser) is(text string) bool {
+	return p.tok.kind != tokenString && p.tok.text == text
+}
+
+func (p *fileParser) expect(text string) error {
+	if !p.is(text) {
+		return p.unexpected("%q", text)
+	}
+	return p.advance()
+}
+
+func (p *fileParser) unexpected(format string, args ...interface{}) error {
+	found := strconv.Quote(p.tok.text)
+	if p.tok.kind == tokenEOF {
+		found = "end of file"
+	}
+	return p.lex.errorf(p.tok.line, "expected %s, found %s", fmt.Sprintf(format, args...), found)
+}
+
+// ident consumes an identifier and returns its token.
+func (p *fileParser) ident() (token, error) {
+	tok := p.tok
+	if tok.kind != tokenIdent {
+		return tok, p.unexpected("identifier")
+	}
+	return tok, p.advance()
+}
+
+// fullIdent consumes a dotted name, with an optional leading dot.
+func (p *fileParser) fullIdent() (string, error) {
+	var name string
+	if p.is(".") {
+		name = "."
+		if err := p.advance(); err != nil {
+			return "", err
+		}
+	}
+	for {
+		tok, err := p.ident()
+		if err != nil {
+			return "", err
+		}
+		name += tok.text
+		if !p.is(".") {
+			return name, nil
+		}
+		name += "."
+		if err := p.advance(); err != nil {
+			return "", err
+		}
+	}
+}
+
+func (p *fileParser) str() (string, error) {
+	if p.tok.kind != tokenString {
+		return "", p.unexpected("string")
+	}
+	s := p.tok.text
+	if err := p.advance(); err != nil {
+		return "", err
+	}
+	// Adjacent strings are concatenated.
+	for p.tok.kind == tokenString {
+		s += p.tok.text
+		if err := p.advance(); err != nil {
+			return "", err
+		}
+	}
+	return s, nil
+}
+
+func (p *fileParser) integer() (int, error) {
+	negative := false
+	if p.is("-") {
+		negative = true
+		if err := p.advance(); err != nil {
+			return 0, err
+		}
+	}
+	if p.tok.kind != tokenInt {
+		return 0, p.unexpected("integer")
+	}
+	n, err := strconv.ParseInt(p.tok.text, 0, 64)
+	if err != nil {
+		return 0, p.lex.errorf(p.tok.line, "invalid integer %q: %v", p.tok.text, err)
+	}
+	if negative {
+		n = -n
+	}
+	return int(n), p.advance()
+}
+
+// option consumes the name and value of an option, without the terminator.
+// Only the value of simple options is returned.
+func (p *fileParser) option() (name, value string, err error) {
+	for !p.is("=") {
+		if p.tok.kind == tokenEOF {
+			return "", "", p.unexpected("%q", "=")
+		}
+		name += p.tok.text
+		if err := p.advance(); err != nil {
+			return "", "", err
+		}
+	}
+	if err := p.advance(); err != nil {
+		return "", "", err
+	}
+	if p.is("{") {
+		return name, "", p.skipBlock()
+	}
+	if p.tok.kind == tokenString {
+		value, err = p.str()
+		return name, value, err
+	}
+	for p.is("-") || p.is("+") {
+		value += p.tok.text
+		if err := p.advance(); err != nil {
+			return "", "", err
+		}
+	}
+	value += p.tok.text
+	return name, value, p.advance()
+}
+
+// fieldOptions consumes an optional list of field options, returning the
+// simple ones by name.
+func (p *fileParser) fieldOptions() (map[string]string, error) {
+	options := map[string]string{}
+	if !p.is("[") {
+		return options, nil
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	for {
+		name, value, err := p.option()
+		if err != nil {
+			return nil, err
+		}
+		options[name] = value
+		if p.is("]") {
+			return options, p.advance()
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// skipBlock skips a brace-delimited block, starting at its opening brace.
+func (p *fileParser) skipBlock() error {
+	depth := 0
+	for {
+		switch {
+		case p.tok.kind == tokenEOF:
+			return p.unexpected("%q", "}")
+		case p.is("{"):
+			depth++
+		case p.is("}"):
+			depth--
+		}
+		if err := p.advance(); err != nil {
+			return err
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// skipDeclaration skips everything up to the end of the current statement or
+// block.
+func (p *fileParser) skipDeclaration() error {
+	for {
+		switch {
+		case p.tok.kind == tokenEOF:
+			return p.unexpected("%q", ";")
+		case p.is(";"):
+			return p.advance()
+		case p.is("{"):
+			return p.skipBlock()
+		}
+		if err := p.advance(); err != nil {
+			return err
+		}
+	}
+}
+
+func (p *fileParser) message(keyword token) (*message, error) {
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	m := &message{
+		name:           name.text,
+		line:           name.line,
+		column:         name.column,
+		comments:       keyword.comments,
+		secondComments: keyword.secondComments,
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	for !p.is("}") {
+		if p.is(";") {
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		tok := p.tok
+		switch tok.text {
+		case "message":
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			nested, err := p.message(tok)
+			if err != nil {
+				return nil, err
+			}
+			m.messages = append(m.messages, nested)
+		case "enum":
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			e, err := p.enum(tok)
+			if err != nil {
+				return nil, err
+			}
+			m.enums = append(m.enums, e)
+		case "oneof":
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			if err := p.oneof(tok, m); err != nil {
+				return nil, err
+			}
+		case "option", "reserved", "extensions", "extend":
+			if err := p.skipDeclaration(); err != nil {
+				return nil, err
+			}
+		default:
+			f, err := p.field()
+			if err != nil {
+				return nil, err
+			}
+			m.fields = append(m.fields, f)
+		}
+	}
+	return m, p.advance()
+}
+
+func (p *fileParser) oneof(keyword token, m *message) error {
+	name, err := p.ident()
+	if err != nil {
+		return err
+	}
+	o := &oneof{name: name.text, comments: keyword.comments}
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	for !p.is("}") {
+		switch {
+		case p.is(";"):
+			if err := p.advance(); err != nil {
+				return err
+			}
+		case p.is("option"):
+			if err := p.skipDeclaration(); err != nil {
+				return err
+			}
+		default:
+			f, err := p.field()
+			if err != nil {
+				return err
+			}
+			f.oneof = o
+			o.fields = append(o.fields, f)
+			m.fields = append(m.fields, f)
+		}
+	}
+	m.oneofs = append(m.oneofs, o)
+	return p.advance()
+}
+
+func (p *fileParser) field() (*field, error) {
+	f := &field{comments: p.tok.comments}
+	switch {
+	case p.is("optional") || p.is("required") || p.is("repeated"):
+		f.label = p.tok.text
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+	case p.is("group"):
+		return nil, p.lex.errorf(p.tok.line, "groups are not supported")
+	}
+	if p.is("map") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		if err := p.expect("<"); err != nil {
+			return nil, err
+		}
+		key, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+		value, err := p.fullIdent()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(">"); err != nil {
+			return nil, err
+		}
+		f.keyType, f.typeName = key.text, value
+	} else {
+		typeName, err := p.fullIdent()
+		if err != nil {
+			return nil, err
+		}
+		f.typeName = typeName
+	}
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	f.name = name.text
+	f.line, f.column = name.line, name.column
+	if err := p.expect("="); err != nil {
+		return nil, err
+	}
+	if f.number, err = p.integer(); err != nil {
+		return nil, err
+	}
+	options, err := p.fieldOptions()
+	if err != nil {
+		return nil, err
+	}
+	f.jsonName = options["json_name"]
+	return f, p.expect(";")
+}
+
+func (p *fileParser) enum(keyword token) (*enum, error) {
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	e := &enum{
+		name:           name.text,
+		line:           name.line,
+		column:         name.column,
+		comments:       keyword.comments,
+		secondComments: keyword.secondComments,
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	for !p.is("}") {
+		switch {
+		case p.is(";"):
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+		case p.is("option") || p.is("reserved"):
+			if err := p.skipDeclaration(); err != nil {
+				return nil, err
+			}
+		default:
+			tok, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("="); err != nil {
+				return nil, err
+			}
+			number, err := p.integer()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.fieldOptions(); err != nil {
+				return nil, err
+			}
+			e.values = append(e.values, &enumValue{name: tok.text, line: tok.line, column: tok.column, number: number, comments: tok.comments})
+			if err := p.expect(";"); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return e, p.advance()
+}
@@ -0,0 +1,34 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package testing runs generators in tests, and compares their output with
+// golden files.
+//
+// A test of a generator names fixture input packages and a directory of
+// golden files, usually under testdata:
+//
+//	func TestDeepCopy(t *testing.T) {
+//		gentesting.Run(t, gentesting.Case{
+//			InputDirs:     []string{"example.com/m/testdata/input"},
+//			GoldenDir:     "testdata/golden",
+//			NameSystems:   NameSystems(),
+//			DefaultSystem: DefaultNameSystem(),
+//			Packages:      Packages,
+//		})
+//	}
+//
+// The output is generated in memory; nothing is written to the input
+// packages. Running the tests with -update writes the output to the golden
+// files instead of comparing it with them.
+package testing
@@ -0,0 +1,198 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package testing
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/namer"
+)
+
+// Update makes Run write the golden files rather than compare the output
+// with them. It is set by the -update flag of the test binary, so tests
+// using this package can't define a flag of that name themselves.
+var Update = flag.Bool("update", false, "write the output of generators to their golden files")
+
+// outputBase is the directory of the in-memory file system generated into.
+const outputBase = "/gogenerator-test"
+
+// Case is a run of a generator to be compared with golden files.
+type Case struct {
+	// The import paths of the fixture input packages, as in
+	// args.GeneratorArgs.InputDirs.
+	InputDirs []string
+
+	// The directory of the golden files. The file f of the output package
+	// with import path p is compared with GoldenDir/p/f.
+	GoldenDir string
+
+	NameSystems   namer.NameSystems
+	DefaultSystem string
+	Packages      func(*generator.Context, *args.GeneratorArgs) generator.Packages
+
+	// The arguments of the generator, including its CustomArgs. If nil,
+	// args.Default() is used, with no copyright header. The input and
+	// output options are always set by Run, and the header is made
+	// reproducible.
+	Args *args.GeneratorArgs
+}
+
+// Run generates the output packages of 'c' and compares every file with
+// its golden file, reporting a diff of each which differs, and golden files
+// which are not generated any more. With -update, it writes the golden
+// files instead, and removes those not generated any more.
+func Run(t *testing.T, c Case) {
+	t.Helper()
+	files, err := Generate(c)
+	if err != nil {
+		t.Fatalf("failed generating: %v", err)
+	}
+
+	golden, err := goldenFiles(c.GoldenDir)
+	if err != nil {
+		t.Fatalf("failed reading the golden files: %v", err)
+	}
+	if *Update {
+		if err := update(c.GoldenDir, files, golden); err != nil {
+			t.Fatalf("failed updating the golden files: %v", err)
+		}
+		return
+	}
+
+	for _, name := range sortedNames(files) {
+		path := filepath.Join(c.GoldenDir, filepath.FromSlash(name))
+		want, ok := golden[name]
+		if !ok {
+			t.Errorf("%s: no golden file for the generated output; run with -update to write it", path)
+			continue
+		}
+		if diff := generator.UnifiedDiff(path, "generated", want, files[name]); diff != "" {
+			t.Errorf("%s differs from the generated output; run with -update to update it:\n%s", path, diff)
+		}
+	}
+	for _, name := range sortedNames(golden) {
+		if _, ok := files[name]; !ok {
+			t.Errorf("%s: golden file is not generated any more; run with -update to remove it", filepath.Join(c.GoldenDir, filepath.FromSlash(name)))
+		}
+	}
+}
+
+// Generate runs the generator of 'c' in memory and returns the generated
+// files by their paths, relative to the output base, with forward slashes.
+func Generate(c Case) (map[string][]byte, error) {
+	g := c.Args
+	if g == nil {
+		g = args.Default()
+		g.GoHeader = []byte{}
+		g.GeneratorName = "gogenerator-test"
+	}
+	inputs := c.InputDirs
+	if len(inputs) == 0 {
+		inputs = g.InputDirs
+	}
+	g.WithoutDefaultFlagParsing()
+	g.InputDirs = inputs
+	g.OutputBase = outputBase
+	g.OutputMode = args.OutputModeGOPATH
+	g.OutputDirs = nil
+	g.CacheFile = ""
+	g.Reproducible = true
+	fs := generator.NewMemFileSystem()
+	g.FS = fs
+	if err := g.Execute(c.NameSystems, c.DefaultSystem, c.Packages); err != nil {
+		return nil, err
+	}
+
+	files := map[string][]byte{}
+	for _, path := range fs.Files() {
+		rel, err := filepath.Rel(outputBase, path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		b, err := fs.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		files[filepath.ToSlash(rel)] = b
+	}
+	return files, nil
+}
+
+// goldenFiles returns the contents of the files under 'dir' by their paths
+// relative to it, with forward slashes. A missing directory has no files.
+func goldenFiles(dir string) (map[string][]byte, error) {
+	files := map[string][]byte{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = b
+		return nil
+	})
+	return files, err
+}
+
+// update writes the generated 'files' under 'dir', and removes the
+// 'golden' files which weren't generated.
+func update(dir string, files, golden map[string][]byte) error {
+	for _, name := range sortedNames(files) {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, files[name], 0644); err != nil {
+			return err
+		}
+	}
+	for _, name := range sortedNames(golden) {
+		if _, ok := files[name]; !ok {
+			if err := os.Remove(filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func sortedNames(files map[string][]byte) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,231 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import "path"
+
+// UniverseBuilder constructs a Universe in code, for tests and for frontends
+// which don't parse Go sources:
+//
+//	b := types.NewUniverseBuilder()
+//	b.Package("example.com/m/a").Struct("Foo").
+//		Comments("Foo is a foo.", "+optional").
+//		Field("Name", types.String, `json:"name"`).
+//		Field("Labels", b.MapOf(types.String, types.String), `json:"labels"`)
+//	u := b.Universe()
+//
+// Anonymous types are named the way the parser names them, so types built
+// by either are interchangeable.
+type UniverseBuilder struct {
+	u Universe
+}
+
+// NewUniverseBuilder returns a builder of an empty universe.
+func NewUniverseBuilder() *UniverseBuilder {
+	return &UniverseBuilder{u: Universe{}}
+}
+
+// Universe returns the universe built thus far.
+func (b *UniverseBuilder) Universe() Universe {
+	return b.u
+}
+
+// Package returns a builder of the package with the given path, adding the
+// package if needed. Its name defaults to the last element of the path.
+func (b *UniverseBuilder) Package(packagePath string) *PackageBuilder {
+	p := b.u.Package(packagePath)
+	if p.Name == "" {
+		p.Name = path.Base(packagePath)
+	}
+	return &PackageBuilder{u: b.u, p: p}
+}
+
+// PointerTo returns the pointer type to 'elem'.
+func (b *UniverseBuilder) PointerTo(elem *Type) *Type {
+	t := b.u.Type(Name{Name: "*" + elem.Name.String()})
+	t.Kind = Pointer
+	t.Elem = elem
+	return t
+}
+
+// SliceOf returns the slice type of 'elem'.
+func (b *UniverseBuilder) SliceOf(elem *Type) *Type {
+	t := b.u.Type(Name{Name: "[]" + elem.Name.String()})
+	t.Kind = Slice
+	t.Elem = elem
+	return t
+}
+
+// MapOf returns the map type from 'key' to 'elem'.
+func (b *UniverseBuilder) MapOf(key, elem *Type) *Type {
+	t := b.u.Type(Name{Name: "map[" + key.Name.String() + "]" + elem.Name.String()})
+	t.Kind = Map
+	t.Key = key
+	t.Elem = elem
+	return t
+}
+
+// Func returns a signature with the given parameters and results, which is
+// not variadic and has no receiver.
+func (b *UniverseBuilder) Func(parameters, results []*Type) *Signature {
+	return &Signature{Parameters: parameters, Results: results}
+}
+
+// PackageBuilder adds declarations to a package of a UniverseBuilder.
+type PackageBuilder struct {
+	u Universe
+	p *Package
+}
+
+// Package returns the package built.
+func (b *PackageBuilder) Package() *Package {
+	return b.p
+}
+
+// Name sets the name in the package clause of the package.
+func (b *PackageBuilder) Name(name string) *PackageBuilder {
+	b.p.Name = name
+	return b
+}
+
+// Comments sets the comment lines of the package, as parsed from doc.go.
+func (b *PackageBuilder) Comments(lines ...string) *PackageBuilder {
+	b.p.DocComments = lines
+	b.p.Comments = lines
+	return b
+}
+
+// Import records that the package imports the package with the given path.
+func (b *PackageBuilder) Import(packagePath string) *PackageBuilder {
+	b.u.AddImports(b.p.Path, packagePath)
+	return b
+}
+
+// Struct returns a builder of the struct type with the given name, adding
+// the type if needed.
+func (b *PackageBuilder) Struct(name string) *TypeBuilder {
+	return b.named(name, Struct)
+}
+
+// Interface returns a builder of the interface type with the given name,
+// adding the type if needed. Its methods are added with Method.
+func (b *PackageBuilder) Interface(name string) *TypeBuilder {
+	return b.named(name, Interface)
+}
+
+// Alias returns a builder of the type with the given name defined by
+// another, as in "type Foo string", adding the type if needed.
+func (b *PackageBuilder) Alias(name string, underlying *Type) *TypeBuilder {
+	tb := b.named(name, Alias)
+	tb.t.Underlying = underlying
+	return tb
+}
+
+func (b *PackageBuilder) named(name string, kind Kind) *TypeBuilder {
+	t := b.p.Type(name)
+	t.Kind = kind
+	return &TypeBuilder{t: t}
+}
+
+// Function adds a function with the given signature to the package, and
+// returns it.
+func (b *PackageBuilder) Function(name string, signature *Signature) *Type {
+	f := b.p.Function(name)
+	f.Underlying = &Type{Kind: Func, Signature: signature}
+	return f
+}
+
+// Variable adds a variable of the given type to the package, and returns
+// it.
+func (b *PackageBuilder) Variable(name string, t *Type) *Type {
+	v := b.p.Variable(name)
+	v.Underlying = t
+	return v
+}
+
+// Constant adds a constant of the given type and value to the package, and
+// returns it. As for parsed constants, string values are unquoted, and
+// others are written as in Go.
+func (b *PackageBuilder) Constant(name string, t *Type, value string) *Type {
+	c := b.p.Constant(name)
+	c.Underlying = t
+	c.ConstValue = &value
+	return c
+}
+
+// TypeBuilder adds to a named type of a PackageBuilder.
+type TypeBuilder struct {
+	t *Type
+}
+
+// Type returns the type built.
+func (b *TypeBuilder) Type() *Type {
+	return b.t
+}
+
+// Comments sets the comment lines immediately before the type.
+func (b *TypeBuilder) Comments(lines ...string) *TypeBuilder {
+	b.t.CommentLines = lines
+	return b
+}
+
+// SecondClosestComments sets the comment lines before those immediately
+// before the type, as in Type.SecondClosestCommentLines.
+func (b *TypeBuilder) SecondClosestComments(lines ...string) *TypeBuilder {
+	b.t.SecondClosestCommentLines = lines
+	return b
+}
+
+// Field adds a member to the struct, with the given tags and comment lines.
+// It panics if the type isn't a struct.
+func (b *TypeBuilder) Field(name string, t *Type, tags string, comments ...string) *TypeBuilder {
+	return b.member(Member{Name: name, Type: t, Tags: tags, CommentLines: comments})
+}
+
+// Embed adds an embedded member of type 't' to the struct, with the given
+// tags. It panics if the type isn't a struct.
+func (b *TypeBuilder) Embed(t *Type, tags string) *TypeBuilder {
+	name := t.Name.Name
+	if t.Kind == Pointer {
+		name = t.Elem.Name.Name
+	}
+	return b.member(Member{Name: name, Embedded: true, Type: t, Tags: tags})
+}
+
+func (b *TypeBuilder) member(m Member) *TypeBuilder {
+	if b.t.Kind != Struct {
+		panic("types: member added to " + string(b.t.Kind) + " type " + b.t.String())
+	}
+	b.t.Members = append(b.t.Members, m)
+	return b
+}
+
+// Method adds a method with the given signature, and comment lines, to the
+// type. The receiver of the signature defaults to the type itself.
+func (b *TypeBuilder) Method(name string, signature *Signature, comments ...string) *TypeBuilder {
+	if signature.Receiver == nil && b.t.Kind != Interface {
+		signature.Receiver = b.t
+	}
+	if b.t.Methods == nil {
+		b.t.Methods = map[string]*Type{}
+	}
+	b.t.Methods[name] = &Type{
+		Name:         Name{Package: b.t.Name.Package, Name: name},
+		Kind:         Func,
+		CommentLines: comments,
+		Signature:    signature,
+	}
+	return b
+}
@@ -0,0 +1,193 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CommentTags are the comment tags found in a set of comment lines, parsed so
+// that generators need not split their values themselves. Tags have the forms
+//
+//	'marker' + "name"
+//	'marker' + "name=value"
+//	'marker' + "name:key1=value1,key2=value2"
+//
+// A value may be a double quoted Go string, or a JSON object or array.
+type CommentTags struct {
+	marker string
+	lines  []string
+}
+
+// ParseCommentTags returns the comment tags in 'lines' that start with
+// 'marker'.
+func ParseCommentTags(marker string, lines []string) CommentTags {
+	t := CommentTags{marker: marker}
+	for _, line := range lines {
+		line = strings.Trim(line, " ")
+		if strings.HasPrefix(line, marker) && len(line) > len(marker) {
+			t.lines = append(t.lines, line)
+		}
+	}
+	return t
+}
+
+// CommentTags returns the comment tags in the package's comments.
+func (p *Package) CommentTags(marker string) CommentTags {
+	return ParseCommentTags(marker, p.Comments)
+}
+
+// CommentTags returns the comment tags in the comments of the type, function or
+// method, including SecondClosestCommentLines.
+func (t *Type) CommentTags(marker string) CommentTags {
+	return ParseCommentTags(marker, append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...))
+}
+
+// CommentTags returns the comment tags in the comments of the struct field,
+// including SecondClosestCommentLines.
+func (m Member) CommentTags(marker string) CommentTags {
+	return ParseCommentTags(marker, append(append([]string{}, m.SecondClosestCommentLines...), m.CommentLines...))
+}
+
+// Has returns whether a tag named 'name' is present, in any form.
+func (t CommentTags) Has(name string) bool {
+	prefix := t.marker + name
+	for _, line := range t.lines {
+		if line == prefix || strings.HasPrefix(line, prefix+"=") || strings.HasPrefix(line, prefix+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// Values returns the values of all the "name" and "name=value" tags for
+// 'name', in order. A tag without a value has the value "", and quoted values
+// are unquoted.
+func (t CommentTags) Values(name string) ([]string, error) {
+	tags := ExtractCommentTags(t.marker, t.lines)[name]
+	values := make([]string, 0, len(tags))
+	for _, v := range tags {
+		if strings.HasPrefix(v, `"`) {
+			unquoted, err := strconv.Unquote(v)
+			if err != nil {
+				return nil, fmt.Errorf("tag %q: invalid quoted value %s: %v", name, v, err)
+			}
+			v = unquoted
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// Value returns the value of the first tag for 'name', and whether there is
+// one.
+func (t CommentTags) Value(name string) (string, bool, error) {
+	values, err := t.Values(name)
+	if err != nil || len(values) == 0 {
+		return "", false, err
+	}
+	return values[0], true, nil
+}
+
+// Bool returns the value of the first tag for 'name' as a boolean, or
+// 'defaultVal' if there is none. A tag without a value is true.
+func (t CommentTags) Bool(name string, defaultVal bool) (bool, error) {
+	v, ok, err := t.Value(name)
+	if err != nil || !ok {
+		return defaultVal, err
+	}
+	if v == "" {
+		return true, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("tag value for %q is not boolean: %q", name, v)
+	}
+	return b, nil
+}
+
+// Decode unmarshals the JSON value of the first tag for 'name' into 'v'. It
+// returns false if there is no such tag.
+func (t CommentTags) Decode(name string, v interface{}) (bool, error) {
+	tags := ExtractCommentTags(t.marker, t.lines)[name]
+	if len(tags) == 0 {
+		return false, nil
+	}
+	if err := json.Unmarshal([]byte(tags[0]), v); err != nil {
+		return true, fmt.Errorf("tag %q: invalid JSON value: %v", name, err)
+	}
+	return true, nil
+}
+
+// Params returns the parameters of all the "name:key=value,..." tags for
+// 'name', in order.
+func (t CommentTags) Params(name string) (TagParams, error) {
+	return ExtractCommentTagParams(t.marker, name, t.lines)
+}
+
+// TagParams are the parameters of structured comment tags, in order. A key
+// may be repeated.
+type TagParams []TagParam
+
+// Get returns the value of the first parameter named 'key', and whether there
+// is one.
+func (p TagParams) Get(key string) (string, bool) {
+	for _, param := range p {
+		if param.Key == key {
+			return param.Value, true
+		}
+	}
+	return "", false
+}
+
+// All returns the values of all the parameters named 'key', in order.
+func (p TagParams) All(key string) []string {
+	var values []string
+	for _, param := range p {
+		if param.Key == key {
+			values = append(values, param.Value)
+		}
+	}
+	return values
+}
+
+// Keys returns the distinct parameter keys, in the order they first appear.
+func (p TagParams) Keys() []string {
+	var keys []string
+	seen := map[string]bool{}
+	for _, param := range p {
+		if !seen[param.Key] {
+			seen[param.Key] = true
+			keys = append(keys, param.Key)
+		}
+	}
+	return keys
+}
+
+// Decode unmarshals the JSON value of the first parameter named 'key' into
+// 'v'. It returns false if there is no such parameter.
+func (p TagParams) Decode(key string, v interface{}) (bool, error) {
+	value, ok := p.Get(key)
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal([]byte(value), v); err != nil {
+		return true, fmt.Errorf("parameter %q: invalid JSON value: %v", key, err)
+	}
+	return true, nil
+}
@@ -19,6 +19,7 @@ package types
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -78,4 +79,116 @@ func ExtractSingleBoolCommentTag(marker string, key string, defaultVal bool, lin
 		return false, nil
 	}
 	return false, fmt.Errorf("tag value for %q is not boolean: %q", key, values[0])
-}
\ No newline at end of file
+}
+// TagParam is a single key=value parameter of a structured comment tag.
+type TagParam struct {
+	Key   string
+	Value string
+}
+
+// ExtractCommentTagParams parses comments for lines of the form:
+//
+//	'marker' + 'name' + ":" + "key1=value1,key2=value2"
+//
+// and returns the parameters of all of them, in order. A parameter without
+// "=" has the value "". Values may be double quoted, as Go strings, to hold
+// commas. Values starting with "{" or "[" run to the matching bracket, so
+// JSON objects and arrays may be given as they are.
+//
+// Example: if you pass "+" for 'marker' and "validate" for 'name', and the
+// following lines are in the comments:
+//	+validate:min=1,max=10
+//	+validate:pattern="^[a-z,]+$"
+// Then this function will return:
+//	[]TagParam{{"min", "1"}, {"max", "10"}, {"pattern", "^[a-z,]+$"}}
+func ExtractCommentTagParams(marker, name string, lines []string) (TagParams, error) {
+	prefix := marker + name + ":"
+	var params TagParams
+	for _, line := range lines {
+		line = strings.Trim(line, " ")
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		rest := line[len(prefix):]
+		for len(rest) > 0 {
+			var param TagParam
+			end := strings.IndexAny(rest, "=,")
+			if end == -1 {
+				end = len(rest)
+			}
+			param.Key = strings.TrimSpace(rest[:end])
+			if len(param.Key) == 0 {
+				return nil, fmt.Errorf("tag %q: empty parameter name", line)
+			}
+			rest = rest[end:]
+			if strings.HasPrefix(rest, "=") {
+				rest = rest[1:]
+				if strings.HasPrefix(rest, `"`) {
+					end := 1
+					for end < len(rest) && rest[end] != '"' {
+						if rest[end] == '\\' {
+							end++
+						}
+						end++
+					}
+					if end >= len(rest) {
+						return nil, fmt.Errorf("tag %q: unterminated value of %q", line, param.Key)
+					}
+					value, err := strconv.Unquote(rest[:end+1])
+					if err != nil {
+						return nil, fmt.Errorf("tag %q: invalid quoted value of %q: %v", line, param.Key, err)
+					}
+					param.Value = value
+					rest = rest[end+1:]
+					if len(rest) > 0 && !strings.HasPrefix(rest, ",") {
+						return nil, fmt.Errorf("tag %q: unexpected %q after the value of %q", line, rest, param.Key)
+					}
+				} else if strings.HasPrefix(rest, "{") || strings.HasPrefix(rest, "[") {
+					end := jsonValueEnd(rest)
+					if end == -1 {
+						return nil, fmt.Errorf("tag %q: unterminated value of %q", line, param.Key)
+					}
+					param.Value = rest[:end]
+					rest = rest[end:]
+					if len(rest) > 0 && !strings.HasPrefix(rest, ",") {
+						return nil, fmt.Errorf("tag %q: unexpected %q after the value of %q", line, rest, param.Key)
+					}
+				} else {
+					end := strings.Index(rest, ",")
+					if end == -1 {
+						end = len(rest)
+					}
+					param.Value = rest[:end]
+					rest = rest[end:]
+				}
+			}
+			rest = strings.TrimPrefix(rest, ",")
+			params = append(params, param)
+		}
+	}
+	return params, nil
+}
+
+// jsonValueEnd returns the index just past the bracket closing the JSON
+// object or array 's' starts with, or -1 if it isn't closed.
+func jsonValueEnd(s string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '{', '[':
+			depth++
+		case '}', ']':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		case '"':
+			for i++; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' {
+					i++
+				}
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,186 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import "sort"
+
+// Method is a method in the method set of a type.
+type Method struct {
+	Name string
+
+	// The method, as found in the Methods of the type declaring it.
+	Func *Type
+
+	// Whether the method is declared with a pointer receiver.
+	PointerReceiver bool
+
+	// The embedded members the method is promoted through, outermost
+	// first. Empty for the type's own methods.
+	Path []Member
+}
+
+// Promoted returns whether the method is promoted from an embedded type.
+func (m Method) Promoted() bool {
+	return len(m.Path) > 0
+}
+
+// MethodSet returns the method set of the named type 't', or of a pointer to
+// it if 'pointer' is true, sorted by name. Unlike Methods, it includes the
+// methods promoted from embedded types, following the rules of the Go spec:
+// a value method set has no methods with pointer receivers, except those
+// promoted through embedded pointers, and a name at a lower depth, field or
+// method, hides the same name deeper down.
+func (t *Type) MethodSet(pointer bool) []Method {
+	type embedding struct {
+		t           *Type
+		addressable bool
+		path        []Member
+	}
+	var out []Method
+	settled := map[string]bool{}
+	visited := map[*Type]bool{}
+	current := []embedding{{t: t, addressable: pointer}}
+	for len(current) > 0 {
+		var next []embedding
+		// The methods found at this depth by name; nil stands for a field,
+		// or a method not in the method set, which still hides others.
+		found := map[string][]*Method{}
+		add := func(name string, m *Method) {
+			if !settled[name] {
+				found[name] = append(found[name], m)
+			}
+		}
+		expanded := map[*Type]bool{}
+		for _, e := range current {
+			if visited[e.t] {
+				continue
+			}
+			expanded[e.t] = true
+			for name, f := range e.t.Methods {
+				ptr := f.Signature != nil && f.Signature.Receiver != nil && f.Signature.Receiver.Kind == Pointer
+				if ptr && !e.addressable {
+					add(name, nil)
+					continue
+				}
+				add(name, &Method{Name: name, Func: f, PointerReceiver: ptr, Path: e.path})
+			}
+			if e.t.Kind != Struct {
+				continue
+			}
+			for _, m := range e.t.Members {
+				add(m.Name, nil)
+				if !m.Embedded {
+					continue
+				}
+				et, addressable := m.Type, e.addressable
+				if et.Kind == Pointer {
+					et, addressable = et.Elem, true
+				}
+				next = append(next, embedding{t: et, addressable: addressable, path: append(append([]Member{}, e.path...), m)})
+			}
+		}
+		for name, methods := range found {
+			settled[name] = true
+			if len(methods) == 1 && methods[0] != nil {
+				out = append(out, *methods[0])
+			}
+		}
+		for t := range expanded {
+			visited[t] = true
+		}
+		current = next
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Implements returns whether the method set of 't', or of a pointer to it if
+// 'pointer' is true, has every method of the interface 'iface', with the
+// same signature.
+func (t *Type) Implements(iface *Type, pointer bool) bool {
+	methods := map[string]*Type{}
+	for _, m := range t.MethodSet(pointer) {
+		methods[m.Name] = m.Func
+	}
+	for name, want := range iface.Methods {
+		got, ok := methods[name]
+		if !ok || !sameSignature(got.Signature, want.Signature) {
+			return false
+		}
+	}
+	return true
+}
+
+// Implementer is a type whose method set has every method of an interface.
+type Implementer struct {
+	Type *Type
+
+	// True if only a pointer to Type has the methods, because some of them
+	// have pointer receivers.
+	Pointer bool
+}
+
+// Implementers returns the named types of the packages with the given paths,
+// or of every package if none are given, which implement the interface
+// 'iface', themselves or through a pointer to them, sorted by name.
+// Interfaces are left out, even those which embed 'iface'.
+func (u Universe) Implementers(iface *Type, packagePaths ...string) []Implementer {
+	packages := u.SortedPackages()
+	if len(packagePaths) > 0 {
+		packages = packages[:0:0]
+		for _, path := range packagePaths {
+			if p, ok := u[path]; ok {
+				packages = append(packages, p)
+			}
+		}
+	}
+	var out []Implementer
+	for _, p := range packages {
+		for _, t := range p.Types {
+			if t.Name.Package == "" || t.Kind == Interface || t.Kind == TypeAlias || t.Kind == Unknown {
+				continue
+			}
+			if t.Implements(iface, false) {
+				out = append(out, Implementer{Type: t})
+			} else if t.Implements(iface, true) {
+				out = append(out, Implementer{Type: t, Pointer: true})
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Type.Name.String() < out[j].Type.Name.String() })
+	return out
+}
+
+// sameSignature returns whether 'a' and 'b' have the same parameters and
+// results, ignoring names and receivers.
+func sameSignature(a, b *Signature) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Variadic != b.Variadic || len(a.Parameters) != len(b.Parameters) || len(a.Results) != len(b.Results) {
+		return false
+	}
+	for i := range a.Parameters {
+		if a.Parameters[i] != b.Parameters[i] {
+			return false
+		}
+	}
+	for i := range a.Results {
+		if a.Results[i] != b.Results[i] {
+			return false
+		}
+	}
+	return true
+}
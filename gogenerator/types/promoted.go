@@ -0,0 +1,195 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PromotedMember is a member of a struct, or of a struct embedded in it,
+// along with how it is reached.
+type PromotedMember struct {
+	Member
+
+	// The embedded members the member is promoted through, outermost
+	// first. Empty for the struct's own members.
+	Path []Member
+
+	// The member's name in JSON. Only set by JSONMembers.
+	JSONName string
+
+	// The indexes of the members in Path and of the member itself in their
+	// structs, for ordering.
+	index []int
+}
+
+// Selector returns the selector of the member from a value of the struct,
+// e.g. "Base.Meta.Name".
+func (m PromotedMember) Selector() string {
+	parts := make([]string, 0, len(m.Path)+1)
+	for _, p := range m.Path {
+		parts = append(parts, p.Name)
+	}
+	return strings.Join(append(parts, m.Name), ".")
+}
+
+// PromotedMembers returns the fields of the struct 't' as Go sees them: its
+// own members, and the ones promoted from the structs it embeds, directly or
+// through pointers, in any package. A field hides fields of the same name
+// deeper down, and fields of the same name at the same depth hide each
+// other. Fields are returned in declaration order, depth first. Methods,
+// which can hide fields too, are not considered.
+func PromotedMembers(t *Type) []PromotedMember {
+	return promoteMembers(t, func(m Member) promotedField {
+		return promotedField{name: m.Name, field: true, promote: m.Embedded}
+	})
+}
+
+// JSONMembers returns the fields of the struct 't' as encoding/json sees
+// them, with their JSON names. Unexported and "-" fields are left out, and
+// the fields of untagged embedded structs are promoted in their place. Of
+// several fields with the same name at the same depth, only a tagged one is
+// kept, if there is exactly one.
+func JSONMembers(t *Type) []PromotedMember {
+	field := func(m Member) promotedField {
+		tag := reflect.StructTag(m.Tags).Get("json")
+		if tag == "-" {
+			return promotedField{}
+		}
+		name := strings.Split(tag, ",")[0]
+		if m.Embedded && name == "" && embeddedStruct(m) != nil {
+			return promotedField{promote: true}
+		}
+		if r, _ := utf8.DecodeRuneInString(m.Name); !unicode.IsUpper(r) {
+			return promotedField{}
+		}
+		if name == "" {
+			return promotedField{name: m.Name, field: true}
+		}
+		return promotedField{name: name, tagged: true, field: true}
+	}
+	members := promoteMembers(t, field)
+	for i := range members {
+		members[i].JSONName = field(members[i].Member).name
+	}
+	return members
+}
+
+// embeddedStruct returns the struct 'm' embeds, directly or through a
+// pointer, or nil.
+func embeddedStruct(m Member) *Type {
+	t := m.Type
+	if t.Kind == Pointer {
+		t = t.Elem
+	}
+	if t == nil || t.Kind != Struct {
+		return nil
+	}
+	return t
+}
+
+// promotedField is how a member is seen: whether it is a field and by what
+// name, whether that name was given by a tag, and whether the fields of the
+// struct it embeds are promoted.
+type promotedField struct {
+	name    string
+	tagged  bool
+	field   bool
+	promote bool
+}
+
+// promoteMembers returns the fields of 't' and of the structs embedded in
+// it, as seen through 'field'. A name at a lower depth hides the same name
+// deeper down; of several fields with the same name at the same depth, the
+// only tagged one is kept, or otherwise none.
+func promoteMembers(t *Type, field func(Member) promotedField) []PromotedMember {
+	type embedding struct {
+		t     *Type
+		path  []Member
+		index []int
+	}
+	type candidate struct {
+		member PromotedMember
+		tagged bool
+	}
+	var out []PromotedMember
+	settled := map[string]bool{}
+	visited := map[*Type]bool{}
+	current := []embedding{{t: t}}
+	for len(current) > 0 {
+		var next []embedding
+		var names []string
+		candidates := map[string][]candidate{}
+		expanded := map[*Type]bool{}
+		for _, e := range current {
+			// Structs embedded at a lower depth are already expanded. One
+			// embedded several times at the same depth is expanded every
+			// time, which makes its fields ambiguous, as they should be.
+			if visited[e.t] {
+				continue
+			}
+			expanded[e.t] = true
+			for i, m := range e.t.Members {
+				f := field(m)
+				index := append(append([]int{}, e.index...), i)
+				if st := embeddedStruct(m); f.promote && st != nil {
+					next = append(next, embedding{t: st, path: append(append([]Member{}, e.path...), m), index: index})
+				}
+				if !f.field || settled[f.name] {
+					continue
+				}
+				if _, ok := candidates[f.name]; !ok {
+					names = append(names, f.name)
+				}
+				candidates[f.name] = append(candidates[f.name], candidate{PromotedMember{Member: m, Path: e.path, index: index}, f.tagged})
+			}
+		}
+		for _, name := range names {
+			settled[name] = true
+			c := candidates[name]
+			if len(c) == 1 {
+				out = append(out, c[0].member)
+				continue
+			}
+			var tagged []PromotedMember
+			for _, c := range c {
+				if c.tagged {
+					tagged = append(tagged, c.member)
+				}
+			}
+			if len(tagged) == 1 {
+				out = append(out, tagged[0])
+			}
+		}
+		for t := range expanded {
+			visited[t] = true
+		}
+		current = next
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i].index, out[j].index
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	return out
+}
@@ -0,0 +1,76 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import "sort"
+
+// The maps of packages and types are iterated in random order. Generators
+// iterate them through these helpers, so that the order in which they emit
+// code, or report problems, doesn't change from run to run.
+
+// SortedPackages returns the packages of the universe, sorted by path.
+func (u Universe) SortedPackages() []*Package {
+	out := make([]*Package, 0, len(u))
+	for _, p := range u {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
+
+// SortedTypes returns the types of the package, sorted by name.
+func (p *Package) SortedTypes() []*Type { return sortedByName(p.Types) }
+
+// SortedFunctions returns the functions of the package, sorted by name.
+func (p *Package) SortedFunctions() []*Type { return sortedByName(p.Functions) }
+
+// SortedVariables returns the variables of the package, sorted by name.
+func (p *Package) SortedVariables() []*Type { return sortedByName(p.Variables) }
+
+// SortedConstants returns the constants of the package, sorted by name.
+func (p *Package) SortedConstants() []*Type { return sortedByName(p.Constants) }
+
+// SortedImports returns the import paths of the package, sorted.
+func (p *Package) SortedImports() []string {
+	out := make([]string, 0, len(p.Imports))
+	for path := range p.Imports {
+		out = append(out, path)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// SortedMethodNames returns the names of the methods of the type, sorted.
+func (t *Type) SortedMethodNames() []string {
+	out := make([]string, 0, len(t.Methods))
+	for name := range t.Methods {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func sortedByName(m map[string]*Type) []*Type {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := make([]*Type, 0, len(m))
+	for _, name := range names {
+		out = append(out, m[name])
+	}
+	return out
+}
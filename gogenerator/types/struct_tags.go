@@ -0,0 +1,71 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package types
+
+import (
+	"reflect"
+	"strings"
+
+	forkedreflect "github.com/lack-io/gogogen/util/third_party/forked/golang/reflect"
+)
+
+// StructTagValue is the value of one key of a struct tag, split the way
+// encoding/json splits it: the name before the first comma, and the options
+// after it.
+//
+// Example: json:"name,omitempty" has the value
+//	StructTagValue{Key: "json", Name: "name", Options: []string{"omitempty"}}
+type StructTagValue struct {
+	Key     string
+	Name    string
+	Options []string
+}
+
+// HasOption returns whether 'option' is among the value's options.
+func (v StructTagValue) HasOption(option string) bool {
+	for _, o := range v.Options {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+func newStructTagValue(key, value string) StructTagValue {
+	parts := strings.Split(value, ",")
+	return StructTagValue{Key: key, Name: parts[0], Options: parts[1:]}
+}
+
+// StructTag returns the value of the key 'key' of the member's struct tag,
+// and whether the key is present.
+func (m Member) StructTag(key string) (StructTagValue, bool) {
+	value, ok := reflect.StructTag(m.Tags).Lookup(key)
+	if !ok {
+		return StructTagValue{Key: key}, false
+	}
+	return newStructTagValue(key, value), true
+}
+
+// StructTags returns the values of all the keys of the member's struct tag,
+// in order. As with reflect, parsing stops at the first malformed key; an
+// error is only returned for values which can't be unquoted.
+func (m Member) StructTags() ([]StructTagValue, error) {
+	tags, err := forkedreflect.ParseStructTags(m.Tags)
+	values := make([]StructTagValue, 0, len(tags))
+	for _, tag := range tags {
+		values = append(values, newStructTagValue(tag.Name, tag.Value))
+	}
+	return values, err
+}
@@ -14,7 +14,11 @@
 
 package types
 
-import "strings"
+import (
+	"go/ast"
+	"go/token"
+	"strings"
+)
 
 // Ref makes a reference to the given type.  It can only be used for e.g.
 // passing to namers.
@@ -78,6 +82,13 @@ const (
 	// We then need "Alias" as a way for us to say that Bar *is* a Foo.
 	Alias Kind = "Alias"
 
+	// TypeAlias is a type alias declaration, e.g. in:
+	//  type Foo = Bar
+	// Foo is another name for Bar, which is its Underlying. Unlike with
+	// Alias, Foo is not a type of its own: it has no methods of its own, and
+	// everything declared as a Foo is parsed as a Bar.
+	TypeAlias Kind = "TypeAlias"
+
 	// Interface is any type that could have differing types at run time.
 	Interface Kind = "Interface"
 
@@ -99,6 +110,20 @@ const (
 	Protobuf Kind = "Protobuf"
 )
 
+// ChanDir is the direction of a channel type.
+type ChanDir string
+
+const (
+	// SendRecv is that of a channel values are sent to and received from,
+	// e.g. chan int.
+	SendRecv ChanDir = ""
+	// SendOnly is that of a channel values are only sent to, e.g. chan<- int.
+	SendOnly ChanDir = "SendOnly"
+	// RecvOnly is that of a channel values are only received from, e.g.
+	// <-chan int.
+	RecvOnly ChanDir = "RecvOnly"
+)
+
 // Package holds package level information.
 // Fields are public, as everything in this package, to enable consumption by
 // templates (for example).  But it is strongly encouraged for code to build by
@@ -114,6 +139,11 @@ type Package struct {
 	// 'package x' line.
 	Name string
 
+	// If this is an external test package, one of the package x_test files
+	// next to package x, the path of the package it tests. Its own path is
+	// that one with "_test" appended.
+	ForTest string
+
 	// The comment right above the package declaration in doc.go, if any.
 	DocComments []string
 
@@ -121,6 +151,10 @@ type Package struct {
 	// TODO: remove Comments and use DocComments everywhere
 	Comments []string
 
+	// The comments above the package clause of each file, by file name
+	// without its directory, for directives about the whole file.
+	FileComments map[string][]string
+
 	// Types within this package, indexed by their name (*not* including
 	// package name)
 	Types map[string]*Type
@@ -284,6 +318,24 @@ func (u Universe) Package(packagePath string) *Package {
 	return p
 }
 
+// ConstGroup is a const declaration, such as a parenthesized block of
+// constants counting up with iota.
+type ConstGroup struct {
+	// The constants declared, in source order. Blank (_) constants are
+	// left out, so use their ConstIota for their ordinal in the block.
+	Constants []*Type
+}
+
+// FuncBody is the body of a function or method parsed from source.
+type FuncBody struct {
+	// The body's block statement, positioned in the file set of the parser
+	// which parsed it.
+	Node *ast.BlockStmt
+
+	// The body, braces included, formatted as by gofmt.
+	Source string
+}
+
 // Type represents a subset of possible go types.
 type Type struct {
 	// There are two general categories of types, those explicitly named
@@ -321,6 +373,20 @@ type Type struct {
 	// ---
 	SecondClosestCommentLines []string
 
+	// Where the type, function, method, variable or constant is declared,
+	// if it was parsed from source. Use Position.String() to refer to it in
+	// diagnostics, as file:line:column.
+	Position token.Position
+
+	// If Kind == DeclarationOf a function, or Kind == Func for a method,
+	// the body of the function, if the parser was asked to keep bodies.
+	Body *FuncBody
+
+	// If Kind == Struct, or Kind == Alias, the size and alignment in bytes
+	// of values of the type on the architecture the parser was targeting.
+	Size  int64
+	Align int64
+
 	// If Kind == Struct
 	Members []Member
 
@@ -330,20 +396,38 @@ type Type struct {
 	// If Kind == Map, this is the map's type.
 	Key *Type
 
+	// If Kind == Chan, this is the channel's direction.
+	ChanDir ChanDir
+
 	// If Kind == Alias, this is the underlying type.
+	// If Kind == TypeAlias, this is the aliased type.
 	// If Kind == DeclarationOf, this is the type of the declaration.
 	Underlying *Type
 
-	// If Kind == Interface, this is the set of all required functions.
-	// Otherwise, if this is a named type, this is the list of methods that
-	// type has. (All elements will have Kind == "Func")
+	// If Kind == Interface, this is the set of all required functions,
+	// including those of embedded interfaces from any package; their Name
+	// and Position are those of the interface declaring them. Otherwise, if
+	// this is a named type, this is the list of methods that type has. (All
+	// elements will have Kind == "Func")
 	Methods map[string]*Type
 
 	// If Kind == func, this is the signature of the function.
 	Signature *Signature
 
+	// If Kind == DeclarationOf and this is a constant, this is its value.
+	// String constants hold the unquoted string; all others hold the exact
+	// Go representation of the value, for example "3" or "1.5".
+	ConstValue *string
+
+	// If Kind == DeclarationOf and this is a constant, the const declaration
+	// it is in. Constants declared on their own are alone in theirs.
+	ConstGroup *ConstGroup
+
+	// If Kind == DeclarationOf and this is a constant, the value of iota in
+	// its declaration, i.e. the index of its line in ConstGroup.
+	ConstIota int
+
 	// TODO: Add:
-	// * channel direction
 	// * array length
 }
 
@@ -399,9 +483,21 @@ type Member struct {
 	// definition, they will be recorded here.
 	CommentLines []string
 
+	// If there are comment lines preceding the `CommentLines`, separated
+	// from them or from the member by a blank line, they will be recorded
+	// here, as for Type.SecondClosestCommentLines.
+	SecondClosestCommentLines []string
+
 	// If there are tags along with this member, they will be saved here.
 	Tags string
 
+	// Where the member is declared, if it was parsed from source.
+	Position token.Position
+
+	// The offset in bytes of the member in the struct, on the architecture
+	// the parser was targeting.
+	Offset int64
+
 	// The type of this member.
 	Type *Type
 }
@@ -413,13 +509,16 @@ func (m Member) String() string {
 
 // Signature is a function's signature.
 type Signature struct {
-	// TODO: store the parameter names, not just types.
-
 	// If a method of some type, this is the type it's a member of.
 	Receiver   *Type
 	Parameters []*Type
 	Results    []*Type
 
+	// The names of the parameters and results, in the same order. Unnamed
+	// ones have empty names. These are nil if the names are not known.
+	ParameterNames []string
+	ResultNames    []string
+
 	// True if the last in parameter is of the form ...T.
 	Variadic bool
 
@@ -459,15 +558,15 @@ var (
 		Kind: Builtin,
 	}
 	Uint32 = &Type{
-		Name: Name{Name: "uin32"},
+		Name: Name{Name: "uint32"},
 		Kind: Builtin,
 	}
 	Uint16 = &Type{
-		Name: Name{Name: "uin16"},
+		Name: Name{Name: "uint16"},
 		Kind: Builtin,
 	}
 	Uint8 = &Type{
-		Name: Name{Name: "uin8"},
+		Name: Name{Name: "uint8"},
 		Kind: Builtin,
 	}
 	Uint = &Type{
@@ -504,8 +603,10 @@ var (
 			"bool":    Bool,
 			"string":  String,
 			"int":     Int,
-			"int8":    Byte,
+			"int8":    Int8,
+			"int16":   Int16,
 			"int32":   Int32,
+			"rune":    Int32,
 			"int64":   Int64,
 			"uint":    Uint,
 			"uint8":   Byte,
@@ -526,7 +627,7 @@ var (
 
 func IsInteger(t *Type) bool {
 	switch t {
-	case Int, Int16, Int32, Int64, Uint, Uint16, Uint32, Uint64, Byte:
+	case Int, Int8, Int16, Int32, Int64, Uint, Uint8, Uint16, Uint32, Uint64, Uintptr, Byte:
 		return true
 	default:
 		return false
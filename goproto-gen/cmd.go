@@ -51,6 +51,8 @@ type Generator struct {
 	KeepGogoproto        bool
 	SkipGeneratedRewrite bool
 	DropEmbeddedFields   string
+	Proto3               bool
+	VerifyNumbering      bool
 }
 
 func New() *Generator {
@@ -91,7 +93,7 @@ func (g *Generator) BindFlags(app *ccli.App) {
 	app.StringSliceVar(&g.ProtoImport, "proto-import", g.ProtoImport,
 		"The search path for the core protobuf .protos, required;", "")
 	app.StringVar(&g.Conditional, "conditional", g.Conditional,
-		"An optional Golang build tag condition to add to the generated Go code", "")
+		"An optional Golang build tag condition, in the // +build syntax, to add to the generated Go code", "")
 	app.BoolVar(&g.Clean, "clean", g.Clean,
 		"If true, remove all generated files for the specified Packages.", "")
 	app.BoolVar(&g.OnlyIDL, "only-idl", g.OnlyIDL,
@@ -102,10 +104,14 @@ func (g *Generator) BindFlags(app *ccli.App) {
 		"If true, skip fixing up the generated.pb.go file (debugging only).", "")
 	app.StringVar(&g.DropEmbeddedFields, "drop-embedded-fields", g.DropEmbeddedFields,
 		"Comma-delimited list of embedded Go types to omit from generated protobufs", "")
+	app.BoolVar(&g.Proto3, "proto3", g.Proto3,
+		"If true, generate proto3 IDL instead of proto2.", "")
+	app.BoolVar(&g.VerifyNumbering, "verify-numbering", g.VerifyNumbering,
+		"If true, fail if any field lacks a field number in its protobuf struct tag, instead of assigning one. Implies --only-idl.", "")
 }
 
 func Run(g *Generator) {
-	if g.Common.VerifyOnly {
+	if g.Common.VerifyOnly || g.VerifyNumbering {
 		g.OnlyIDL = true
 		g.Clean = false
 	}
@@ -164,6 +170,8 @@ func Run(g *Generator) {
 			name = parts[1]
 		}
 		p := newProtobufPackage(d, name, generateAllTypes, omitTypes)
+		p.Proto3 = g.Proto3
+		p.VerifyNumbering = g.VerifyNumbering
 		header := append([]byte{}, boilerplate...)
 		header = append(header, p.HeaderText...)
 		p.HeaderText = header
@@ -175,7 +183,7 @@ func Run(g *Generator) {
 		}
 	}
 
-	if !g.Common.VerifyOnly {
+	if !g.Common.VerifyOnly && !g.VerifyNumbering {
 		for _, p := range outputPackages {
 			if err := p.(*protobufPackage).Clean(g.OutputBase); err != nil {
 				log.Fatalf("Unable to clean package %s: %v", p.Name(), err)
@@ -206,7 +214,15 @@ func Run(g *Generator) {
 	}
 
 	c.Verify = g.Common.VerifyOnly
-	c.FileTypes["protoidl"] = NewProtoFile()
+	syntax := "proto2"
+	if g.Proto3 {
+		syntax = "proto3"
+	}
+	c.FileTypes["protoidl"] = NewProtoFileWithSyntax(syntax)
+	if g.VerifyNumbering {
+		// Only the numbering is of interest, leave the output untouched.
+		c.FileTypes["protoidl"] = discardFile{}
+	}
 
 	// order package by imports, importees first
 	deps := deps(c, protobufNames.packages)
@@ -262,9 +278,7 @@ func Run(g *Generator) {
 	args := append(searchArgs, fmt.Sprintf("--gogo_out=%s", g.OutputBase))
 
 	buf := &bytes.Buffer{}
-	if len(g.Conditional) > 0 {
-		fmt.Fprintf(buf, "// +build %s\n\n", g.Conditional)
-	}
+	buf.Write(generator.BuildConstraint(generator.BuildConstraintBoth, g.Conditional))
 	buf.Write(boilerplate)
 
 	for _, outputPackage := range outputPackages {
@@ -370,8 +384,8 @@ func Run(g *Generator) {
 func deps(c *generator.Context, pkgs []*protobufPackage) map[string][]string {
 	ret := map[string][]string{}
 	for _, p := range pkgs {
-		for _, d := range c.Universe[p.PackagePath].Imports {
-			ret[p.PackagePath] = append(ret[p.PackagePath], d.Path)
+		for _, d := range c.Universe[p.PackagePath].SortedImports() {
+			ret[p.PackagePath] = append(ret[p.PackagePath], d)
 		}
 	}
 	return ret
@@ -36,9 +36,11 @@ type genProtoIDL struct {
 	localGoPackage types.Name
 	imports        namer.ImportTracker
 
-	generateAll    bool
-	omitGogo       bool
-	omitFieldTypes map[types.Name]struct{}
+	generateAll     bool
+	omitGogo        bool
+	proto3          bool
+	verifyNumbering bool
+	omitFieldTypes  map[types.Name]struct{}
 }
 
 func (g *genProtoIDL) PackageVars(c *generator.Context) []string {
@@ -168,8 +170,10 @@ func (g *genProtoIDL) GenerateType(c *generator.Context, t *types.Type, w io.Wri
 		},
 		localPackage: g.localPackage,
 
-		omitGogo:       g.omitGogo,
-		omitFieldTypes: g.omitFieldTypes,
+		omitGogo:        g.omitGogo,
+		proto3:          g.proto3,
+		verifyNumbering: g.verifyNumbering,
+		omitFieldTypes:  g.omitFieldTypes,
 
 		t: t,
 	}
@@ -247,10 +251,12 @@ func (p protobufLocator) ProtoTypeFor(t *types.Type) (*types.Type, error) {
 }
 
 type bodyGen struct {
-	locator        ProtobufLocator
-	localPackage   types.Name
-	omitGogo       bool
-	omitFieldTypes map[types.Name]struct{}
+	locator         ProtobufLocator
+	localPackage    types.Name
+	omitGogo        bool
+	proto3          bool
+	verifyNumbering bool
+	omitFieldTypes  map[types.Name]struct{}
 
 	t *types.Type
 }
@@ -362,6 +368,12 @@ func (b bodyGen) doStruct(sw *generator.SnippetWriter) error {
 		fields = memberFields
 	}
 
+	if b.verifyNumbering {
+		if err := verifyFieldNumbers(b.t, fields); err != nil {
+			return err
+		}
+	}
+
 	out := sw.Out()
 	genComment(out, b.t.CommentLines, "")
 	sw.Do(`message $.Name.Name$ {
@@ -385,6 +397,8 @@ func (b bodyGen) doStruct(sw *generator.SnippetWriter) error {
 		case field.Map:
 		case field.Repeated:
 			fmt.Fprintf(out, "repeated ")
+		case b.proto3:
+			// proto3 fields have no presence label
 		case field.Required:
 			fmt.Fprintf(out, "required ")
 		default:
@@ -426,6 +440,7 @@ type protoField struct {
 	Optional bool
 	Required bool
 	Nullable bool
+	Assigned bool
 	Extras   map[string]string
 
 	CommentLines []string
@@ -707,6 +722,9 @@ func membersToFields(locator ProtobufLocator, t *types.Type, localPackage types.
 		field := &fields[i]
 		tag := field.Tag
 		if tag != -1 {
+			if !isValidFieldNumber(tag) {
+				return nil, fmt.Errorf("field %q has tag %d, which is not a valid protobuf field number", field.Name, tag)
+			}
 			if existing, ok := byTag[tag]; ok {
 				return nil, fmt.Errorf("field %q and %q both have tag %d", field.Name, existing.Name, tag)
 			}
@@ -723,12 +741,48 @@ func membersToFields(locator ProtobufLocator, t *types.Type, localPackage types.
 			continue
 		}
 		highest++
+		if highest >= firstReservedFieldNumber && highest <= lastReservedFieldNumber {
+			highest = lastReservedFieldNumber + 1
+		}
 		field.Tag = highest
+		field.Assigned = true
 		byTag[field.Tag] = field
 	}
 	return fields, nil
 }
 
+// The range of field numbers reserved by the protobuf implementation, and the
+// largest field number allowed.
+const (
+	firstReservedFieldNumber = 19000
+	lastReservedFieldNumber  = 19999
+	maxFieldNumber           = 1<<29 - 1
+)
+
+func isValidFieldNumber(tag int) bool {
+	if tag >= firstReservedFieldNumber && tag <= lastReservedFieldNumber {
+		return false
+	}
+	return tag > 0 && tag <= maxFieldNumber
+}
+
+// verifyFieldNumbers returns an error if any of the fields of t had to be
+// assigned a number, rather than taking it from an existing protobuf struct
+// tag. Once the generated tags have been written back to the Go source a
+// second run assigns nothing, so this checks that the numbering is stable.
+func verifyFieldNumbers(t *types.Type, fields []protoField) error {
+	var unnumbered []string
+	for _, field := range fields {
+		if field.Assigned {
+			unnumbered = append(unnumbered, fmt.Sprintf("%s (would be %d)", field.Name, field.Tag))
+		}
+	}
+	if len(unnumbered) > 0 {
+		return fmt.Errorf("type %v has fields without a protobuf field number: %s", t, strings.Join(unnumbered, ", "))
+	}
+	return nil
+}
+
 func genComment(out io.Writer, lines []string, indent string) {
 	for {
 		l := len(lines)
@@ -751,37 +805,52 @@ func formatProtoFile(source []byte) ([]byte, error) {
 	return source, nil
 }
 
-func assembleProtoFile(w io.Writer, f *generator.File) {
-	w.Write(f.Header)
+func assembleProtoFile(syntax string) func(io.Writer, *generator.File) {
+	return func(w io.Writer, f *generator.File) {
+		w.Write(f.Header)
 
-	fmt.Fprint(w, "syntax = 'proto2';\n\n")
+		fmt.Fprintf(w, "syntax = '%s';\n\n", syntax)
 
-	if len(f.PackageName) > 0 {
-		fmt.Fprintf(w, "package %s;\n\n", f.PackageName)
-	}
+		if len(f.PackageName) > 0 {
+			fmt.Fprintf(w, "package %s;\n\n", f.PackageName)
+		}
 
-	if len(f.Imports) > 0 {
-		imports := []string{}
-		for i := range f.Imports {
-			imports = append(imports, i)
+		if len(f.Imports) > 0 {
+			imports := []string{}
+			for i := range f.Imports {
+				imports = append(imports, i)
+			}
+			sort.Strings(imports)
+			for _, s := range imports {
+				fmt.Fprintf(w, "import %q;\n", s)
+			}
+			fmt.Fprint(w, "\n")
 		}
-		sort.Strings(imports)
-		for _, s := range imports {
-			fmt.Fprintf(w, "import %q;\n", s)
+
+		if f.Vars.Len() > 0 {
+			fmt.Fprintf(w, "%s\n", f.Vars.String())
 		}
-		fmt.Fprint(w, "\n")
-	}
 
-	if f.Vars.Len() > 0 {
-		fmt.Fprintf(w, "%s\n", f.Vars.String())
+		w.Write(f.Body.Bytes())
 	}
-
-	w.Write(f.Body.Bytes())
 }
 
+// NewProtoFile returns the file type for proto2 IDL files.
 func NewProtoFile() *generator.DefaultFileType {
+	return NewProtoFileWithSyntax("proto2")
+}
+
+// NewProtoFileWithSyntax returns the file type for IDL files declaring the
+// given syntax, either "proto2" or "proto3".
+func NewProtoFileWithSyntax(syntax string) *generator.DefaultFileType {
 	return &generator.DefaultFileType{
 		Format:   formatProtoFile,
-		Assemble: assembleProtoFile,
+		Assemble: assembleProtoFile(syntax),
 	}
 }
+
+// discardFile is a file type which drops everything generated into it.
+type discardFile struct{}
+
+func (discardFile) AssembleFile(f *generator.File, path string) error { return nil }
+func (discardFile) VerifyFile(f *generator.File, path string) error   { return nil }
@@ -70,6 +70,14 @@ type protobufPackage struct {
 	// If true, omit any gogoprotobuf extensions not defined as types.
 	OmitGogo bool
 
+	// If true, generate proto3 messages, which carry no optional or required
+	// labels.
+	Proto3 bool
+
+	// If true, fail on any field which has no field number in its protobuf
+	// struct tag, instead of assigning one.
+	VerifyNumbering bool
+
 	// A list of field types that will be excluded from the output struct
 	OmitFieldTypes map[types.Name]struct{}
 
@@ -216,12 +224,14 @@ func (p *protobufPackage) generatorFunc(c *generator.Context) []generator.Genera
 		DefaultGen: generator.DefaultGen{
 			OptionalName: "generated",
 		},
-		localPackage:   types.Name{Package: p.PackageName, Path: p.PackagePath},
-		localGoPackage: types.Name{Package: p.PackagePath, Name: p.GoPackageName()},
-		imports:        p.Imports,
-		generateAll:    p.GenerateAll,
-		omitGogo:       p.OmitGogo,
-		omitFieldTypes: p.OmitFieldTypes,
+		localPackage:    types.Name{Package: p.PackageName, Path: p.PackagePath},
+		localGoPackage:  types.Name{Package: p.PackagePath, Name: p.GoPackageName()},
+		imports:         p.Imports,
+		generateAll:     p.GenerateAll,
+		omitGogo:        p.OmitGogo,
+		proto3:          p.Proto3,
+		verifyNumbering: p.VerifyNumbering,
+		omitFieldTypes:  p.OmitFieldTypes,
 	})
 	return generators
 }
@@ -0,0 +1,495 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package grpc_gen
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/namer"
+	"github.com/lack-io/gogogen/gogenerator/types"
+	"github.com/lack-io/gogogen/util/log"
+	"github.com/lack-io/gogogen/util/sets"
+)
+
+// These are the comment tags that carry parameters for service generation.
+const (
+	tagName = "gogogen:grpc-gen"
+	// The full name of the service, <package name>.<interface name> by
+	// default.
+	serviceTagName = tagName + ":service"
+)
+
+// The packages the generated code uses.
+const (
+	grpcPackage     = "google.golang.org/grpc"
+	encodingPackage = "google.golang.org/grpc/encoding"
+	contextPackage  = "context"
+	jsonPackage     = "encoding/json"
+)
+
+// codecName is the content subtype the generated code exchanges messages
+// as.
+const codecName = "json"
+
+func extractTag(name string, t *types.Type) []string {
+	comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
+	return types.ExtractCommentTags("+", comments)[name]
+}
+
+// NameSystems returns the name system used by the generators in this package.
+func NameSystems() namer.NameSystems {
+	return namer.NameSystems{
+		"public": namer.NewPublicNamer(0),
+		"raw":    namer.NewRawNamer("", nil),
+	}
+}
+
+// DefaultNameSystem returns the default name system for ordering the types to
+// be processed by the generators in this package.
+func DefaultNameSystem() string {
+	return "public"
+}
+
+// field is a field of a request or response message.
+type field struct {
+	// The name of the variable in the generated code, for parameters.
+	Var string
+	// The name of the field, and its JSON name.
+	Name     string
+	JSONName string
+	Type     *types.Type
+	// Whether the parameter is variadic.
+	Variadic bool
+}
+
+// method is a method of a service, along with its messages.
+type method struct {
+	Name string
+	// The name of the function handling calls of the method on the server.
+	Handler  string
+	Request  []field
+	Response []field
+}
+
+// service is an interface along with the methods of the service made of it.
+type service struct {
+	Name    string
+	Methods []method
+}
+
+// isContext returns true for context.Context.
+func isContext(t *types.Type) bool {
+	return t.Name.Package == contextPackage && t.Name.Name == "Context"
+}
+
+// isError returns true for error.
+func isError(t *types.Type) bool {
+	return t.Name.Package == "" && t.Name.Name == "error"
+}
+
+// exported returns 'name' with its first letter upper case.
+func exported(name string) string {
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// newMethod checks that the method of 't' called 'name' can be a unary RPC,
+// taking a context first and returning an error last, and returns it.
+func newMethod(t *types.Type, name string) method {
+	sig := t.Methods[name].Signature
+	if len(sig.Parameters) == 0 || !isContext(sig.Parameters[0]) {
+		log.Fatalf("Interface %v: method %s must take a context.Context first", t, name)
+	}
+	if len(sig.Results) == 0 || !isError(sig.Results[len(sig.Results)-1]) {
+		log.Fatalf("Interface %v: method %s must return an error last", t, name)
+	}
+
+	m := method{Name: name, Handler: "_" + t.Name.Name + "_" + name + "_Handler"}
+	// "ctx", "in", "out" and "err" are local names of the generated code.
+	used := map[string]bool{"ctx": true, "in": true, "out": true, "err": true}
+	fields := map[string]bool{}
+	for i := 1; i < len(sig.Parameters); i++ {
+		f := field{Type: sig.Parameters[i]}
+		if i < len(sig.ParameterNames) {
+			f.Var = sig.ParameterNames[i]
+		}
+		if len(f.Var) == 0 || f.Var == "_" {
+			f.Var = fmt.Sprintf("arg%d", i)
+		}
+		for used[f.Var] {
+			f.Var += "_"
+		}
+		used[f.Var] = true
+		f.Name, f.JSONName = exported(f.Var), f.Var
+		for fields[f.Name] {
+			f.Name += "_"
+		}
+		fields[f.Name] = true
+		if sig.Variadic && i == len(sig.Parameters)-1 {
+			f.Variadic = true
+		}
+		m.Request = append(m.Request, f)
+	}
+	fields = map[string]bool{}
+	results := sig.Results[:len(sig.Results)-1]
+	for i, rt := range results {
+		f := field{Type: rt}
+		if i < len(sig.ResultNames) && len(sig.ResultNames[i]) > 0 && sig.ResultNames[i] != "_" {
+			f.JSONName = sig.ResultNames[i]
+		} else if len(results) == 1 {
+			f.JSONName = "result"
+		} else {
+			f.JSONName = fmt.Sprintf("result%d", i)
+		}
+		f.Name = exported(f.JSONName)
+		for fields[f.Name] {
+			f.Name += "_"
+		}
+		fields[f.Name] = true
+		m.Response = append(m.Response, f)
+	}
+	return m
+}
+
+// findServices returns the services of the interfaces of 'pkg', indexed by
+// type.
+func findServices(pkg *types.Package) map[*types.Type]*service {
+	services := map[*types.Type]*service{}
+	for _, t := range pkg.SortedTypes() {
+		if t.Kind != types.Interface {
+			continue
+		}
+		values := extractTag(tagName, t)
+		if len(values) == 0 {
+			continue
+		}
+		if len(values) > 1 || (values[0] != "" && values[0] != "true" && values[0] != "false") {
+			log.Fatalf("Interface %v: unsupported %s values: %q", t, tagName, values)
+		}
+		if values[0] == "false" {
+			continue
+		}
+
+		s := &service{Name: pkg.Name + "." + t.Name.Name}
+		if values := extractTag(serviceTagName, t); len(values) > 0 {
+			s.Name = values[0]
+		}
+		names := []string{}
+		for name := range t.Methods {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if namer.IsPrivateGoName(name) {
+				log.Fatalf("Interface %v: unexported method %s can't be served", t, name)
+			}
+			s.Methods = append(s.Methods, newMethod(t, name))
+		}
+		services[t] = s
+	}
+	return services
+}
+
+func Packages(context *generator.Context, arguments *args.GeneratorArgs) generator.Packages {
+	boilerplate, err := arguments.LoadGoBoilerplate()
+	if err != nil {
+		log.Fatalf("Failed loading boilerplate: %v", err)
+	}
+
+	packages := generator.Packages{}
+	header := append(arguments.GeneratedBuildConstraint(), boilerplate...)
+
+	for i := range sets.NewString(context.Inputs...) {
+		log.Debugf("Considering pkg %q", i)
+		pkg := context.Universe[i]
+		if pkg == nil {
+			// If the input had no Go files, for example.
+			continue
+		}
+
+		services := findServices(pkg)
+		if len(services) == 0 {
+			continue
+		}
+
+		log.Infof("Package %q needs generation", i)
+		packages = append(packages,
+			&generator.DefaultPackage{
+				PackageName: strings.Split(filepath.Base(pkg.Path), ".")[0],
+				PackagePath: pkg.Path,
+				HeaderText:  header,
+				GeneratorFunc: func(c *generator.Context) (generators []generator.Generator) {
+					return []generator.Generator{
+						NewGenGRPC(arguments.OutputFileName(pkg, "grpc"), pkg.Path, services),
+					}
+				},
+				FilterFunc: func(c *generator.Context, t *types.Type) bool {
+					return t.Name.Package == pkg.Path
+				},
+			})
+	}
+	return packages
+}
+
+// genGRPC produces a file with the messages, clients and servers of the
+// services of a package.
+type genGRPC struct {
+	generator.DefaultGen
+	targetPackage string
+	imports       namer.ImportTracker
+	services      map[*types.Type]*service
+}
+
+func NewGenGRPC(sanitizedName, targetPackage string, services map[*types.Type]*service) generator.Generator {
+	return &genGRPC{
+		DefaultGen: generator.DefaultGen{
+			OptionalName: sanitizedName,
+		},
+		targetPackage: targetPackage,
+		imports:       generator.NewImportTracker(),
+		services:      services,
+	}
+}
+
+func (g *genGRPC) Namers(c *generator.Context) namer.NameSystems {
+	// Have the raw namer for this file track what it imports.
+	return namer.NameSystems{
+		"raw": namer.NewRawNamer(g.targetPackage, g.imports),
+	}
+}
+
+func (g *genGRPC) Filter(c *generator.Context, t *types.Type) bool {
+	_, ok := g.services[t]
+	return ok
+}
+
+func (g *genGRPC) isOtherPackage(pkg string) bool {
+	if pkg == g.targetPackage {
+		return false
+	}
+	if strings.HasSuffix(pkg, "\""+g.targetPackage+"\"") {
+		return false
+	}
+	return true
+}
+
+func (g *genGRPC) Imports(c *generator.Context) (imports []string) {
+	importLines := []string{}
+	for _, singleImport := range g.imports.ImportLines() {
+		if g.isOtherPackage(singleImport) {
+			importLines = append(importLines, singleImport)
+		}
+	}
+	return importLines
+}
+
+func (g *genGRPC) Init(c *generator.Context, w io.Writer) error {
+	sw := generator.NewSnippetWriter(w, c, "$", "$")
+	sw.Do(codecCode, generator.Args{
+		"codecName":     codecName,
+		"Marshal":       types.Ref(jsonPackage, "Marshal"),
+		"Unmarshal":     types.Ref(jsonPackage, "Unmarshal"),
+		"RegisterCodec": types.Ref(encodingPackage, "RegisterCodec"),
+	})
+	return sw.Error()
+}
+
+// paramList returns the parameters of the method as declared, along with
+// the arguments forwarding them.
+func paramList(raw namer.Namer, m method) (params, args string) {
+	ps, as := []string{"ctx " + raw.Name(types.Ref(contextPackage, "Context"))}, []string{"ctx"}
+	for _, f := range m.Request {
+		if f.Variadic {
+			ps = append(ps, f.Var+" ..."+raw.Name(f.Type.Elem))
+			as = append(as, "in."+f.Name+"...")
+		} else {
+			ps = append(ps, f.Var+" "+raw.Name(f.Type))
+			as = append(as, "in."+f.Name)
+		}
+	}
+	return strings.Join(ps, ", "), strings.Join(as, ", ")
+}
+
+// resultList returns the results of the method as declared, along with the
+// expressions returning them from a response.
+func resultList(raw namer.Namer, m method) (results, returns string) {
+	rs, outs := []string{}, []string{}
+	for _, f := range m.Response {
+		rs = append(rs, raw.Name(f.Type))
+		outs = append(outs, "out."+f.Name)
+	}
+	rs = append(rs, "error")
+	if len(rs) == 1 {
+		return "error", strings.Join(outs, ", ")
+	}
+	return "(" + strings.Join(rs, ", ") + ")", strings.Join(outs, ", ")
+}
+
+func (g *genGRPC) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	log.Infof("Generating gRPC service for interface %v", t)
+
+	s := g.services[t]
+	raw := c.Namers["raw"]
+	sw := generator.NewSnippetWriter(w, c, "$", "$")
+	args := generator.Args{
+		"type":                   t,
+		"service":                s.Name,
+		"methods":                s.Methods,
+		"codecName":              codecName,
+		"Context":                types.Ref(contextPackage, "Context"),
+		"ClientConnInterface":    types.Ref(grpcPackage, "ClientConnInterface"),
+		"CallOption":             types.Ref(grpcPackage, "CallOption"),
+		"CallContentSubtype":     types.Ref(grpcPackage, "CallContentSubtype"),
+		"ServiceRegistrar":       types.Ref(grpcPackage, "ServiceRegistrar"),
+		"ServiceDesc":            types.Ref(grpcPackage, "ServiceDesc"),
+		"MethodDesc":             types.Ref(grpcPackage, "MethodDesc"),
+		"StreamDesc":             types.Ref(grpcPackage, "StreamDesc"),
+		"UnaryServerInterceptor": types.Ref(grpcPackage, "UnaryServerInterceptor"),
+		"UnaryServerInfo":        types.Ref(grpcPackage, "UnaryServerInfo"),
+	}
+	sw.Do(serviceCode, args)
+	for _, m := range s.Methods {
+		args["method"] = m.Name
+		args["handler"] = m.Handler
+		args["request"] = m.Request
+		args["response"] = m.Response
+		args["params"], args["args"] = paramList(raw, m)
+		args["results"], args["returns"] = resultList(raw, m)
+		// The assignment of the results of the implementation to the
+		// response.
+		assign := []string{}
+		for _, f := range m.Response {
+			assign = append(assign, "out."+f.Name)
+		}
+		if len(assign) == 0 {
+			args["assign"] = "err :="
+		} else {
+			args["assign"] = "var err error\n" + strings.Join(append(assign, "err"), ", ") + " ="
+		}
+		sw.Do(methodCode, args)
+	}
+	return sw.Error()
+}
+
+var codecCode = `// grpcCodec exchanges the messages of the services in this package as JSON.
+type grpcCodec struct{}
+
+func (grpcCodec) Marshal(v interface{}) ([]byte, error) {
+	return $.Marshal|raw$(v)
+}
+
+func (grpcCodec) Unmarshal(data []byte, v interface{}) error {
+	return $.Unmarshal|raw$(data, v)
+}
+
+func (grpcCodec) Name() string {
+	return "$.codecName$"
+}
+
+func init() {
+	$.RegisterCodec|raw$(grpcCodec{})
+}
+
+`
+
+var serviceCode = `// $.type|public$Client calls the $.service$ service. It implements $.type|raw$.
+type $.type|public$Client struct {
+	cc   $.ClientConnInterface|raw$
+	opts []$.CallOption|raw$
+}
+
+var _ $.type|raw$ = &$.type|public$Client{}
+
+// New$.type|public$Client returns a client calling the $.service$ service over
+// cc, with the given call options on every call.
+func New$.type|public$Client(cc $.ClientConnInterface|raw$, opts ...$.CallOption|raw$) *$.type|public$Client {
+	return &$.type|public$Client{cc: cc, opts: append([]$.CallOption|raw${$.CallContentSubtype|raw$("$.codecName$")}, opts...)}
+}
+
+// Register$.type|public$Server registers impl as the $.service$ service.
+func Register$.type|public$Server(s $.ServiceRegistrar|raw$, impl $.type|raw$) {
+	s.RegisterService(&$.type|public$ServiceDesc, impl)
+}
+
+// $.type|public$ServiceDesc describes the $.service$ service.
+var $.type|public$ServiceDesc = $.ServiceDesc|raw${
+	ServiceName: "$.service$",
+	HandlerType: (*$.type|raw$)(nil),
+	Methods: []$.MethodDesc|raw${
+		$- range .methods$
+		{
+			MethodName: "$.Name$",
+			Handler:    $.Handler$,
+		},
+		$- end$
+	},
+	Streams: []$.StreamDesc|raw${},
+}
+
+`
+
+var methodCode = `// $.type|public$$.method$Request holds the arguments of $.type|raw$.$.method$.
+type $.type|public$$.method$Request struct {
+	$- range .request$
+	$.Name$ $.Type|raw$ ` + "`" + `json:"$.JSONName$,omitempty"` + "`" + `
+	$- end$
+}
+
+// $.type|public$$.method$Response holds the results of $.type|raw$.$.method$.
+type $.type|public$$.method$Response struct {
+	$- range .response$
+	$.Name$ $.Type|raw$ ` + "`" + `json:"$.JSONName$,omitempty"` + "`" + `
+	$- end$
+}
+
+// $.method$ calls $.method$ on the $.service$ service.
+func (c *$.type|public$Client) $.method$($.params$) $.results$ {
+	in := &$.type|public$$.method$Request{
+		$- range .request$
+		$.Name$: $.Var$,
+		$- end$
+	}
+	out := &$.type|public$$.method$Response{}
+	err := c.cc.Invoke(ctx, "/$.service$/$.method$", in, out, c.opts...)
+	return $if .returns$$.returns$, $end$err
+}
+
+func $.handler$(srv interface{}, ctx $.Context|raw$, dec func(interface{}) error, interceptor $.UnaryServerInterceptor|raw$) (interface{}, error) {
+	in := &$.type|public$$.method$Request{}
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	handler := func(ctx $.Context|raw$, req interface{}) (interface{}, error) {
+		in := req.(*$.type|public$$.method$Request)
+		out := &$.type|public$$.method$Response{}
+		$.assign$ srv.($.type|raw$).$.method$($.args$)
+		return out, err
+	}
+	if interceptor == nil {
+		return handler(ctx, in)
+	}
+	info := &$.UnaryServerInfo|raw${
+		Server:     srv,
+		FullMethod: "/$.service$/$.method$",
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+`
@@ -0,0 +1,288 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package import_boss
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/namer"
+	"github.com/lack-io/gogogen/gogenerator/types"
+	"github.com/lack-io/gogogen/util/log"
+	"github.com/lack-io/gogogen/util/sets"
+)
+
+// This is the comment tag that carries the rule of a package.
+const tagName = "gogogen:import-boss"
+
+// The parameters of the rule of a package.
+const (
+	paramAllowedPrefixes   = "allowedPrefixes"
+	paramForbiddenPrefixes = "forbiddenPrefixes"
+)
+
+// The name of the files holding the rules of a directory tree.
+const restrictionsFileName = ".import-restrictions"
+
+// The file type of the files the checks would write, which are none.
+const noFileType = "import-boss"
+
+// NameSystems returns the name system used by the generators in this package.
+func NameSystems() namer.NameSystems {
+	return namer.NameSystems{
+		"public": namer.NewPublicNamer(0),
+		"raw":    namer.NewRawNamer("", nil),
+	}
+}
+
+// DefaultNameSystem returns the default name system for ordering the types to
+// be processed by the generators in this package.
+func DefaultNameSystem() string {
+	return "public"
+}
+
+// Restrictions is the content of an .import-restrictions file.
+type Restrictions struct {
+	Rules []Rule
+}
+
+// Rule restricts the imports matching its selector.
+type Rule struct {
+	// The imports the rule applies to. All imports, if it is empty.
+	SelectorRegexp string
+	// If not empty, the imports must have one of these prefixes.
+	AllowedPrefixes []string
+	// The imports must not have any of these prefixes.
+	ForbiddenPrefixes []string
+
+	// Where the rule comes from, for the violations it reports.
+	source   string
+	selector *regexp.Regexp
+}
+
+// check returns why the import 'imp' violates the rule, or "" if it doesn't.
+func (r *Rule) check(imp string) string {
+	if r.selector != nil && !r.selector.MatchString(imp) {
+		return ""
+	}
+	for _, prefix := range r.ForbiddenPrefixes {
+		if hasPathPrefix(imp, prefix) {
+			return fmt.Sprintf("forbidden by %s", r.source)
+		}
+	}
+	if len(r.AllowedPrefixes) == 0 {
+		return ""
+	}
+	for _, prefix := range r.AllowedPrefixes {
+		if hasPathPrefix(imp, prefix) {
+			return ""
+		}
+	}
+	return fmt.Sprintf("not allowed by %s", r.source)
+}
+
+// hasPathPrefix returns true if 'prefix' is 'path', or a directory of it, or
+// ends with a "/" and starts it.
+func hasPathPrefix(path, prefix string) bool {
+	if !strings.HasPrefix(path, prefix) {
+		return false
+	}
+	return len(path) == len(prefix) || strings.HasSuffix(prefix, "/") || path[len(prefix)] == '/'
+}
+
+// isStandard returns true if 'imp' is a package of the standard library,
+// whose paths don't start with a domain.
+func isStandard(imp string) bool {
+	return !strings.Contains(strings.Split(imp, "/")[0], ".")
+}
+
+// loadRestrictions returns the rules of the .import-restrictions file in
+// 'dir', if there is one.
+func loadRestrictions(dir string) ([]Rule, error) {
+	path := filepath.Join(dir, restrictionsFileName)
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var r Restrictions
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for i := range r.Rules {
+		if err := r.Rules[i].compile(path); err != nil {
+			return nil, err
+		}
+	}
+	return r.Rules, nil
+}
+
+func (r *Rule) compile(source string) error {
+	r.source = source
+	if len(r.SelectorRegexp) == 0 {
+		return nil
+	}
+	selector, err := regexp.Compile(r.SelectorRegexp)
+	if err != nil {
+		return fmt.Errorf("%s: invalid selector: %v", source, err)
+	}
+	r.selector = selector
+	return nil
+}
+
+// rulesOf returns the rules applying to 'pkg': those of the files in its
+// directory and the ones above it, up to the one of the module, and the one
+// of its doc.go.
+func rulesOf(pkg *types.Package) ([]Rule, error) {
+	rules := []Rule{}
+	if len(pkg.SourcePath) > 0 {
+		for dir := pkg.SourcePath; ; dir = filepath.Dir(dir) {
+			dirRules, err := loadRestrictions(dir)
+			if err != nil {
+				return nil, err
+			}
+			rules = append(rules, dirRules...)
+			if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+				break
+			}
+			if filepath.Dir(dir) == dir {
+				break
+			}
+		}
+	}
+
+	params, err := types.ExtractCommentTagParams("+", tagName, pkg.Comments)
+	if err != nil {
+		return nil, err
+	}
+	if len(params) > 0 {
+		rule := Rule{source: fmt.Sprintf("the %s tag of the package", tagName)}
+		for _, p := range params {
+			switch p.Key {
+			case paramAllowedPrefixes:
+				rule.AllowedPrefixes = append(rule.AllowedPrefixes, strings.Split(p.Value, "|")...)
+			case paramForbiddenPrefixes:
+				rule.ForbiddenPrefixes = append(rule.ForbiddenPrefixes, strings.Split(p.Value, "|")...)
+			default:
+				return nil, fmt.Errorf("unsupported %s parameter %q", tagName, p.Key)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func Packages(context *generator.Context, arguments *args.GeneratorArgs) generator.Packages {
+	context.FileTypes[noFileType] = noFiles{}
+
+	packages := generator.Packages{}
+	for i := range sets.NewString(context.Inputs...) {
+		log.Debugf("Considering pkg %q", i)
+		pkg := context.Universe[i]
+		if pkg == nil {
+			// If the input had no Go files, for example.
+			continue
+		}
+
+		rules, err := rulesOf(pkg)
+		if err != nil {
+			log.Fatalf("Package %v: %v", i, err)
+		}
+		if len(rules) == 0 {
+			continue
+		}
+
+		log.Infof("Package %q needs checking", i)
+		packages = append(packages,
+			&generator.DefaultPackage{
+				PackageName: strings.Split(filepath.Base(pkg.Path), ".")[0],
+				PackagePath: pkg.Path,
+				GeneratorFunc: func(c *generator.Context) (generators []generator.Generator) {
+					return []generator.Generator{
+						NewGenImportBoss(arguments.OutputFileName(pkg, "import-boss"), pkg, rules),
+					}
+				},
+				FilterFunc: func(c *generator.Context, t *types.Type) bool {
+					return false
+				},
+			})
+	}
+	return packages
+}
+
+// noFiles is the file type of the files the checks would write. It neither
+// writes nor verifies them.
+type noFiles struct{}
+
+func (noFiles) AssembleFile(f *generator.File, path string) error { return nil }
+func (noFiles) VerifyFile(f *generator.File, path string) error   { return nil }
+
+// genImportBoss checks the imports of a package, and fails if any violates
+// its rules. It writes nothing.
+type genImportBoss struct {
+	generator.DefaultGen
+	pkg   *types.Package
+	rules []Rule
+}
+
+func NewGenImportBoss(sanitizedName string, pkg *types.Package, rules []Rule) generator.Generator {
+	return &genImportBoss{
+		DefaultGen: generator.DefaultGen{
+			OptionalName: sanitizedName,
+		},
+		pkg:   pkg,
+		rules: rules,
+	}
+}
+
+func (g *genImportBoss) FileType() string {
+	return noFileType
+}
+
+func (g *genImportBoss) Init(c *generator.Context, w io.Writer) error {
+	imports := []string{}
+	for imp := range g.pkg.Imports {
+		imports = append(imports, imp)
+	}
+	sort.Strings(imports)
+
+	violations := []string{}
+	for _, imp := range imports {
+		if isStandard(imp) {
+			continue
+		}
+		for i := range g.rules {
+			if why := g.rules[i].check(imp); len(why) > 0 {
+				violations = append(violations, fmt.Sprintf("  %s imports %q, %s", g.pkg.Path, imp, why))
+			}
+		}
+	}
+	if len(violations) > 0 {
+		return fmt.Errorf("import violations:\n%s", strings.Join(violations, "\n"))
+	}
+	log.Infof("Package %q imports nothing it shouldn't", g.pkg.Path)
+	return nil
+}
@@ -0,0 +1,723 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package json_gen
+
+import (
+	"io"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/namer"
+	"github.com/lack-io/gogogen/gogenerator/types"
+	"github.com/lack-io/gogogen/runtime/jsonutil"
+	"github.com/lack-io/gogogen/util/log"
+	"github.com/lack-io/gogogen/util/sets"
+)
+
+// This is the comment tag that carries parameters for JSON generation.
+const tagName = "gogogen:json-gen"
+
+// tagValuePackage, on a package, asks for JSON methods for every struct type
+// in it.
+const tagValuePackage = "package"
+
+// jsonutilPackage holds the helpers the generated code calls.
+const jsonutilPackage = "github.com/lack-io/gogogen/runtime/jsonutil"
+
+// NameSystems returns the name system used by the generators in this package.
+func NameSystems() namer.NameSystems {
+	return namer.NameSystems{
+		"public": namer.NewPublicNamer(0),
+		"raw":    namer.NewRawNamer("", nil),
+	}
+}
+
+// DefaultNameSystem returns the default name system for ordering the types to
+// be processed by the generators in this package.
+func DefaultNameSystem() string {
+	return "public"
+}
+
+// wantsJSON returns true if JSON methods are requested for 't', either by its
+// own tag or by the tag of its package.
+func wantsJSON(t *types.Type, ptagValue string) bool {
+	comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
+	values := types.ExtractCommentTags("+", comments)[tagName]
+	if len(values) > 1 {
+		log.Fatalf("Type %v: found %d %s tags: %q", t, len(values), tagName, values)
+	}
+	if len(values) == 1 {
+		switch values[0] {
+		case "", "true":
+			return true
+		case "false":
+			return false
+		default:
+			log.Fatalf("Type %v: unsupported %s value: %q", t, tagName, values[0])
+		}
+	}
+	return ptagValue == tagValuePackage
+}
+
+func Packages(context *generator.Context, arguments *args.GeneratorArgs) generator.Packages {
+	boilerplate, err := arguments.LoadGoBoilerplate()
+	if err != nil {
+		log.Fatalf("Failed loading boilerplate: %v", err)
+	}
+
+	packages := generator.Packages{}
+	header := append(arguments.GeneratedBuildConstraint(), boilerplate...)
+
+	for i := range sets.NewString(context.Inputs...) {
+		log.Debugf("Considering pkg %q", i)
+		pkg := context.Universe[i]
+		if pkg == nil {
+			// If the input had no Go files, for example.
+			continue
+		}
+
+		ptagValue := ""
+		if values := types.ExtractCommentTags("+", pkg.Comments)[tagName]; len(values) > 0 {
+			ptagValue = values[0]
+			if ptagValue != tagValuePackage {
+				log.Fatalf("Package %v: unsupported %s value: %q", i, tagName, ptagValue)
+			}
+		}
+
+		structs := map[*types.Type]bool{}
+		for _, t := range pkg.SortedTypes() {
+			if t.Kind == types.Struct && wantsJSON(t, ptagValue) {
+				structs[t] = true
+			}
+		}
+		if len(structs) == 0 {
+			continue
+		}
+
+		log.Infof("Package %q needs generation", i)
+		packages = append(packages,
+			&generator.DefaultPackage{
+				PackageName: strings.Split(filepath.Base(pkg.Path), ".")[0],
+				PackagePath: pkg.Path,
+				HeaderText:  header,
+				GeneratorFunc: func(c *generator.Context) (generators []generator.Generator) {
+					return []generator.Generator{
+						NewGenJSON(arguments.OutputFileName(pkg, "json"), pkg.Path, structs),
+					}
+				},
+				FilterFunc: func(c *generator.Context, t *types.Type) bool {
+					return t.Name.Package == pkg.Path
+				},
+			})
+	}
+	return packages
+}
+
+// jsonField is a member of a struct, or of a struct embedded in it, which is
+// encoded as a key of the JSON object.
+type jsonField struct {
+	// The JSON key.
+	Name string
+	// The members leading from the struct to the field.
+	Path      []types.Member
+	Tagged    bool
+	OmitEmpty bool
+}
+
+func (f jsonField) Type() *types.Type {
+	return f.Path[len(f.Path)-1].Type
+}
+
+// isValidTag reports whether encoding/json accepts 's' as a key name.
+func isValidTag(s string) bool {
+	for _, c := range s {
+		switch {
+		case strings.ContainsRune("!#$%&()*+-./:;<=>?@[]^_{|}~ ", c):
+			// Backslash and quote chars are reserved, but otherwise any
+			// punctuation chars are allowed in a tag name.
+		case !unicode.IsLetter(c) && !unicode.IsDigit(c):
+			return false
+		}
+	}
+	return true
+}
+
+func isExported(name string) bool {
+	r, _ := utf8.DecodeRuneInString(name)
+	return unicode.IsUpper(r)
+}
+
+// jsonFields returns the fields of 't' in the order, and with the names,
+// encoding/json uses for them.
+func jsonFields(t *types.Type) []jsonField {
+	all := []jsonField{}
+	var walk func(t *types.Type, path []types.Member, visited map[*types.Type]bool)
+	walk = func(t *types.Type, path []types.Member, visited map[*types.Type]bool) {
+		if visited[t] {
+			return
+		}
+		visited[t] = true
+		defer delete(visited, t)
+		for _, m := range t.Members {
+			tag := reflect.StructTag(m.Tags).Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, opts := tag, ""
+			if i := strings.Index(tag, ","); i >= 0 {
+				name, opts = tag[:i], tag[i:]
+			}
+			if !isValidTag(name) {
+				name = ""
+			}
+			memberPath := append(append([]types.Member{}, path...), m)
+			if m.Embedded && name == "" {
+				et := m.Type
+				if et.Kind == types.Pointer {
+					et = et.Elem
+				}
+				if et.Kind == types.Struct {
+					walk(et, memberPath, visited)
+					continue
+				}
+			}
+			if !isExported(m.Name) {
+				continue
+			}
+			if strings.Contains(opts, ",string") {
+				log.Fatalf("Type %v: member %s uses the unsupported ,string json option", t, m.Name)
+			}
+			f := jsonField{
+				Name:      name,
+				Path:      memberPath,
+				Tagged:    name != "",
+				OmitEmpty: strings.Contains(opts, ",omitempty"),
+			}
+			if f.Name == "" {
+				f.Name = m.Name
+			}
+			all = append(all, f)
+		}
+	}
+	walk(t, nil, map[*types.Type]bool{})
+
+	// Of several fields with the same name, the shallowest wins, then the
+	// tagged one. Otherwise they cancel out.
+	fields := []jsonField{}
+	for i, f := range all {
+		dominant, ambiguous := true, false
+		for j, other := range all {
+			if i == j || other.Name != f.Name {
+				continue
+			}
+			switch {
+			case len(other.Path) < len(f.Path):
+				dominant = false
+			case len(other.Path) == len(f.Path) && other.Tagged && !f.Tagged:
+				dominant = false
+			case len(other.Path) == len(f.Path) && other.Tagged == f.Tagged:
+				ambiguous = true
+			}
+		}
+		if dominant && !ambiguous {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
+
+// genJSON produces a file with the JSON methods of the structs of a package.
+type genJSON struct {
+	generator.DefaultGen
+	targetPackage string
+	imports       namer.ImportTracker
+	structs       map[*types.Type]bool
+}
+
+func NewGenJSON(sanitizedName, targetPackage string, structs map[*types.Type]bool) generator.Generator {
+	return &genJSON{
+		DefaultGen: generator.DefaultGen{
+			OptionalName: sanitizedName,
+		},
+		targetPackage: targetPackage,
+		imports:       generator.NewImportTracker(),
+		structs:       structs,
+	}
+}
+
+func (g *genJSON) Namers(c *generator.Context) namer.NameSystems {
+	// Have the raw namer for this file track what it imports.
+	return namer.NameSystems{
+		"raw": namer.NewRawNamer(g.targetPackage, g.imports),
+	}
+}
+
+func (g *genJSON) Filter(c *generator.Context, t *types.Type) bool {
+	return g.structs[t]
+}
+
+func (g *genJSON) isOtherPackage(pkg string) bool {
+	if pkg == g.targetPackage {
+		return false
+	}
+	if strings.HasSuffix(pkg, "\""+g.targetPackage+"\"") {
+		return false
+	}
+	return true
+}
+
+func (g *genJSON) Imports(c *generator.Context) (imports []string) {
+	importLines := []string{}
+	for _, singleImport := range g.imports.ImportLines() {
+		if g.isOtherPackage(singleImport) {
+			importLines = append(importLines, singleImport)
+		}
+	}
+	return importLines
+}
+
+// baseArgs returns the template arguments shared by all snippets.
+func baseArgs() generator.Args {
+	args := generator.Args{
+		"Lexer":   types.Ref(jsonutilPackage, "Lexer"),
+		"sort":    types.Ref("sort", "Strings"),
+		"Marshal": types.Ref(jsonutilPackage, "AppendMarshal"),
+	}
+	for _, name := range []string{"NewLexer", "AppendString", "AppendBool", "AppendInt", "AppendUint", "AppendFloat"} {
+		args[name] = types.Ref(jsonutilPackage, name)
+	}
+	return args
+}
+
+func (g *genJSON) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	log.Infof("Generating JSON methods for type %v", t)
+
+	fields := jsonFields(t)
+	args := baseArgs().With("type", t)
+
+	sw := generator.NewSnippetWriter(w, c, "$", "$")
+	sw.Do("// MarshalJSON implements json.Marshaler.\n", nil)
+	sw.Do("func (in $.type|raw$) MarshalJSON() ([]byte, error) {\n", args)
+	sw.Do("return in.AppendJSON(nil)\n", nil)
+	sw.Do("}\n\n", nil)
+
+	sw.Do("// AppendJSON appends the JSON encoding of in to b.\n", nil)
+	sw.Do("func (in *$.type|raw$) AppendJSON(b []byte) ([]byte, error) {\n", args)
+	sw.Do("var err error\n", nil)
+	sw.Do("sep := byte('{')\n", nil)
+	for _, f := range fields {
+		g.writeMarshalField(sw, f)
+	}
+	sw.Do("if sep == '{' {\n", nil)
+	sw.Do("b = append(b, '{')\n", nil)
+	sw.Do("}\n", nil)
+	sw.Do("return append(b, '}'), err\n", nil)
+	sw.Do("}\n\n", nil)
+
+	sw.Do("// UnmarshalJSON implements json.Unmarshaler.\n", nil)
+	sw.Do("func (out *$.type|raw$) UnmarshalJSON(data []byte) error {\n", args)
+	sw.Do("l := $.NewLexer|raw$(data)\n", args)
+	sw.Do("out.UnmarshalJSONFrom(l)\n", nil)
+	sw.Do("l.End()\n", nil)
+	sw.Do("return l.Error()\n", nil)
+	sw.Do("}\n\n", nil)
+
+	sw.Do("// UnmarshalJSONFrom decodes the next value read by l into out.\n", nil)
+	sw.Do("func (out *$.type|raw$) UnmarshalJSONFrom(l *$.Lexer|raw$) {\n", args)
+	sw.Do("if l.Null() {\n", nil)
+	sw.Do("return\n", nil)
+	sw.Do("}\n", nil)
+	sw.Do("l.Delim('{')\n", nil)
+	sw.Do("for l.More('}') {\n", nil)
+	names := make([]string, 0, len(fields))
+	for _, f := range fields {
+		names = append(names, strconv.Quote(f.Name))
+	}
+	sw.Do("switch l.Field($.$) {\n", strings.Join(names, ", "))
+	for _, f := range fields {
+		sw.Do("case $.$:\n", strconv.Quote(f.Name))
+		g.writeUnmarshalField(sw, f)
+	}
+	sw.Do("default:\n", nil)
+	sw.Do("l.Skip()\n", nil)
+	sw.Do("}\n", nil)
+	sw.Do("}\n", nil)
+	sw.Do("}\n\n", nil)
+	return sw.Error()
+}
+
+// fieldExpr returns the selector of 'f' rooted at 'recv', along with the
+// embedded pointers which must be non-nil to reach it.
+func fieldExpr(recv string, f jsonField) (string, []string) {
+	expr := recv
+	pointers := []string{}
+	for i, m := range f.Path {
+		expr += "." + m.Name
+		if i < len(f.Path)-1 && m.Type.Kind == types.Pointer {
+			pointers = append(pointers, expr)
+		}
+	}
+	return expr, pointers
+}
+
+func (g *genJSON) writeMarshalField(sw *generator.SnippetWriter, f jsonField) {
+	expr, pointers := fieldExpr("in", f)
+	conds := []string{}
+	for _, p := range pointers {
+		conds = append(conds, p+" != nil")
+	}
+	if f.OmitEmpty {
+		if cond := nonEmpty(expr, f.Type()); cond != "" {
+			conds = append(conds, cond)
+		}
+	}
+	if len(conds) > 0 {
+		sw.Do("if $.$ {\n", strings.Join(conds, " && "))
+	}
+	key := jsonutil.AppendString(nil, f.Name)
+	sw.Do("b = append(b, sep)\n", nil)
+	sw.Do("sep = ','\n", nil)
+	sw.Do("b = append(b, $.$...)\n", strconv.Quote(string(key)+":"))
+	g.writeMarshalValue(sw, expr, f.Type(), 0)
+	if len(conds) > 0 {
+		sw.Do("}\n", nil)
+	}
+}
+
+// nonEmpty returns the condition under which an omitempty field is encoded.
+func nonEmpty(expr string, t *types.Type) string {
+	u := t
+	if u.Kind == types.Alias {
+		u = u.Underlying
+	}
+	switch u.Kind {
+	case types.Builtin:
+		switch u.Name.Name {
+		case "string":
+			return expr + ` != ""`
+		case "bool":
+			return expr
+		}
+		return expr + " != 0"
+	case types.Pointer, types.Interface:
+		return expr + " != nil"
+	case types.Slice, types.Map:
+		return "len(" + expr + ") != 0"
+	case types.Array:
+		// encoding/json considers only zero-length arrays empty.
+		return "len(" + expr + ") != 0"
+	}
+	return ""
+}
+
+// hasCustomCodec returns true if 't' encodes itself, in which case
+// encoding/json must be used to honor it.
+func (g *genJSON) hasCustomCodec(t *types.Type) bool {
+	if g.structs[t] {
+		return false
+	}
+	for _, name := range []string{"MarshalJSON", "UnmarshalJSON", "MarshalText", "UnmarshalText"} {
+		if _, ok := t.Methods[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func isStringKeyed(t *types.Type) bool {
+	k := t.Key
+	if k.Kind == types.Alias {
+		k = k.Underlying
+	}
+	return k.Kind == types.Builtin && k.Name.Name == "string"
+}
+
+// builtinOf returns the builtin underlying 't', or nil.
+func builtinOf(t *types.Type) *types.Type {
+	if t.Kind == types.Alias {
+		t = t.Underlying
+	}
+	if t.Kind == types.Builtin {
+		return t
+	}
+	return nil
+}
+
+// convert returns 'expr', of type 't', converted to the builtin 'to'.
+func convert(to, expr string, t *types.Type) string {
+	if t.Kind == types.Builtin && t.Name.Name == to {
+		return expr
+	}
+	return to + "(" + expr + ")"
+}
+
+func intBits(name string) string {
+	switch name {
+	case "int8", "uint8", "byte":
+		return "8"
+	case "int16", "uint16":
+		return "16"
+	case "int32", "uint32", "rune":
+		return "32"
+	case "int64", "uint64":
+		return "64"
+	}
+	// The size of int, uint and uintptr.
+	return "0"
+}
+
+func loopVars(depth int) (string, string) {
+	if depth == 0 {
+		return "i", "v"
+	}
+	return "i" + strconv.Itoa(depth), "v" + strconv.Itoa(depth)
+}
+
+// writeMarshalValue emits code appending the addressable value 'expr' of
+// type 't' to b.
+func (g *genJSON) writeMarshalValue(sw *generator.SnippetWriter, expr string, t *types.Type, depth int) {
+	args := baseArgs().With("expr", expr).With("type", t)
+	if g.hasCustomCodec(t) {
+		sw.Do("if b, err = $.Marshal|raw$(b, $.expr$); err != nil {\n", args)
+		sw.Do("return b, err\n", nil)
+		sw.Do("}\n", nil)
+		return
+	}
+	if b := builtinOf(t); b != nil {
+		switch name := b.Name.Name; {
+		case name == "string":
+			sw.Do("b = $.AppendString|raw$(b, $.value$)\n", args.With("value", convert("string", expr, t)))
+		case name == "bool":
+			sw.Do("b = $.AppendBool|raw$(b, $.value$)\n", args.With("value", convert("bool", expr, t)))
+		case name == "float32" || name == "float64":
+			args = args.With("value", convert("float64", expr, t)).With("bits", strings.TrimPrefix(name, "float"))
+			sw.Do("if b, err = $.AppendFloat|raw$(b, $.value$, $.bits$); err != nil {\n", args)
+			sw.Do("return b, err\n", nil)
+			sw.Do("}\n", nil)
+		case strings.HasPrefix(name, "uint") || name == "byte":
+			sw.Do("b = $.AppendUint|raw$(b, $.value$)\n", args.With("value", convert("uint64", expr, t)))
+		case strings.HasPrefix(name, "int") || name == "rune":
+			sw.Do("b = $.AppendInt|raw$(b, $.value$)\n", args.With("value", convert("int64", expr, t)))
+		default:
+			g.writeMarshalFallback(sw, args)
+		}
+		return
+	}
+
+	u := t
+	if u.Kind == types.Alias {
+		u = u.Underlying
+	}
+	i, v := loopVars(depth)
+	args = args.With("i", i).With("v", v)
+	switch {
+	case g.structs[u]:
+		sw.Do("if b, err = $.expr$.AppendJSON(b); err != nil {\n", args)
+		sw.Do("return b, err\n", nil)
+		sw.Do("}\n", nil)
+	case u.Kind == types.Pointer:
+		sw.Do("if $.expr$ == nil {\n", args)
+		sw.Do("b = append(b, \"null\"...)\n", nil)
+		sw.Do("} else {\n", nil)
+		if g.structs[u.Elem] {
+			g.writeMarshalValue(sw, expr, u.Elem, depth)
+		} else {
+			g.writeMarshalValue(sw, "(*"+expr+")", u.Elem, depth)
+		}
+		sw.Do("}\n", nil)
+	case u.Kind == types.Slice && builtinOf(u.Elem) != nil && builtinOf(u.Elem).Name.Name == "byte":
+		// Byte slices are base64 encoded.
+		g.writeMarshalFallback(sw, args)
+	case u.Kind == types.Slice || u.Kind == types.Array:
+		if u.Kind == types.Slice {
+			sw.Do("if $.expr$ == nil {\n", args)
+			sw.Do("b = append(b, \"null\"...)\n", nil)
+			sw.Do("} else {\n", nil)
+		}
+		sw.Do("b = append(b, '[')\n", nil)
+		sw.Do("for $.i$ := range $.expr$ {\n", args)
+		sw.Do("if $.i$ > 0 {\n", args)
+		sw.Do("b = append(b, ',')\n", nil)
+		sw.Do("}\n", nil)
+		g.writeMarshalValue(sw, expr+"["+i+"]", u.Elem, depth+1)
+		sw.Do("}\n", nil)
+		sw.Do("b = append(b, ']')\n", nil)
+		if u.Kind == types.Slice {
+			sw.Do("}\n", nil)
+		}
+	case u.Kind == types.Map && isStringKeyed(u):
+		// Keys are sorted, as encoding/json does.
+		keys := "keys" + strings.TrimPrefix(i, "i")
+		args = args.With("keys", keys).With("key", u.Key)
+		sw.Do("if $.expr$ == nil {\n", args)
+		sw.Do("b = append(b, \"null\"...)\n", nil)
+		sw.Do("} else {\n", nil)
+		sw.Do("$.keys$ := make([]string, 0, len($.expr$))\n", args)
+		sw.Do("for k := range $.expr$ {\n", args)
+		sw.Do("$.keys$ = append($.keys$, string(k))\n", args)
+		sw.Do("}\n", nil)
+		sw.Do("$.sort|raw$($.keys$)\n", args)
+		sw.Do("b = append(b, '{')\n", nil)
+		sw.Do("for $.i$, k := range $.keys$ {\n", args)
+		sw.Do("if $.i$ > 0 {\n", args)
+		sw.Do("b = append(b, ',')\n", nil)
+		sw.Do("}\n", nil)
+		sw.Do("b = $.AppendString|raw$(b, k)\n", args)
+		sw.Do("b = append(b, ':')\n", nil)
+		if builtinOf(u.Key) == u.Key {
+			sw.Do("$.v$ := $.expr$[k]\n", args)
+		} else {
+			sw.Do("$.v$ := $.expr$[$.key|raw$(k)]\n", args)
+		}
+		g.writeMarshalValue(sw, v, u.Elem, depth+1)
+		sw.Do("}\n", nil)
+		sw.Do("b = append(b, '}')\n", nil)
+		sw.Do("}\n", nil)
+	default:
+		g.writeMarshalFallback(sw, args)
+	}
+}
+
+func (g *genJSON) writeMarshalFallback(sw *generator.SnippetWriter, args generator.Args) {
+	sw.Do("if b, err = $.Marshal|raw$(b, $.expr$); err != nil {\n", args)
+	sw.Do("return b, err\n", nil)
+	sw.Do("}\n", nil)
+}
+
+func (g *genJSON) writeUnmarshalField(sw *generator.SnippetWriter, f jsonField) {
+	expr, pointers := fieldExpr("out", f)
+	for i, p := range pointers {
+		sw.Do("if $.$ == nil {\n", p)
+		sw.Do("$.expr$ = new($.type|raw$)\n", generator.Args{
+			"expr": p,
+			"type": f.Path[i].Type.Elem,
+		})
+		sw.Do("}\n", nil)
+	}
+	g.writeUnmarshalValue(sw, expr, f.Type(), 0)
+}
+
+// writeUnmarshalValue emits code decoding the next value read by l into the
+// addressable value 'expr' of type 't'.
+func (g *genJSON) writeUnmarshalValue(sw *generator.SnippetWriter, expr string, t *types.Type, depth int) {
+	args := baseArgs().With("expr", expr).With("type", t)
+	if g.hasCustomCodec(t) {
+		sw.Do("l.Unmarshal(&$.expr$)\n", args)
+		return
+	}
+	if b := builtinOf(t); b != nil {
+		read, readType := "", ""
+		switch name := b.Name.Name; {
+		case name == "string":
+			read, readType = "l.String()", "string"
+		case name == "bool":
+			read, readType = "l.Bool()", "bool"
+		case name == "float32" || name == "float64":
+			read, readType = "l.Float64("+strings.TrimPrefix(name, "float")+")", "float64"
+		case strings.HasPrefix(name, "uint") || name == "byte":
+			read, readType = "l.Uint64("+intBits(name)+")", "uint64"
+		case strings.HasPrefix(name, "int") || name == "rune":
+			read, readType = "l.Int64("+intBits(name)+")", "int64"
+		default:
+			sw.Do("l.Unmarshal(&$.expr$)\n", args)
+			return
+		}
+		// Like encoding/json, null leaves the value unchanged, and so does a
+		// value which can't be read, such as an integer out of range.
+		sw.Do("if !l.Null() {\n", nil)
+		sw.Do("if x := $.read$; l.Error() == nil {\n", args.With("read", read))
+		if t.Kind == types.Builtin && t.Name.Name == readType {
+			sw.Do("$.expr$ = x\n", args)
+		} else {
+			sw.Do("$.expr$ = $.type|raw$(x)\n", args)
+		}
+		sw.Do("}\n", nil)
+		sw.Do("}\n", nil)
+		return
+	}
+
+	u := t
+	if u.Kind == types.Alias {
+		u = u.Underlying
+	}
+	i, v := loopVars(depth)
+	args = args.With("i", i).With("v", v).With("elem", u.Elem)
+	switch {
+	case g.structs[u]:
+		sw.Do("$.expr$.UnmarshalJSONFrom(l)\n", args)
+	case u.Kind == types.Pointer:
+		sw.Do("if l.Null() {\n", nil)
+		sw.Do("$.expr$ = nil\n", args)
+		sw.Do("} else {\n", nil)
+		sw.Do("if $.expr$ == nil {\n", args)
+		sw.Do("$.expr$ = new($.elem|raw$)\n", args)
+		sw.Do("}\n", nil)
+		if g.structs[u.Elem] {
+			g.writeUnmarshalValue(sw, expr, u.Elem, depth)
+		} else {
+			g.writeUnmarshalValue(sw, "(*"+expr+")", u.Elem, depth)
+		}
+		sw.Do("}\n", nil)
+	case u.Kind == types.Slice && builtinOf(u.Elem) != nil && builtinOf(u.Elem).Name.Name == "byte":
+		// Byte slices are base64 encoded.
+		sw.Do("l.Unmarshal(&$.expr$)\n", args)
+	case u.Kind == types.Slice:
+		sw.Do("if l.Null() {\n", nil)
+		sw.Do("$.expr$ = nil\n", args)
+		sw.Do("} else {\n", nil)
+		sw.Do("$.expr$ = $.type|raw${}\n", args)
+		sw.Do("l.Delim('[')\n", nil)
+		sw.Do("for l.More(']') {\n", nil)
+		sw.Do("var $.v$ $.elem|raw$\n", args)
+		g.writeUnmarshalValue(sw, v, u.Elem, depth+1)
+		sw.Do("$.expr$ = append($.expr$, $.v$)\n", args)
+		sw.Do("}\n", nil)
+		sw.Do("}\n", nil)
+	case u.Kind == types.Array:
+		sw.Do("if !l.Null() {\n", nil)
+		sw.Do("l.Delim('[')\n", nil)
+		sw.Do("for $.i$ := 0; l.More(']'); $.i$++ {\n", args)
+		sw.Do("if $.i$ >= len($.expr$) {\n", args)
+		sw.Do("l.Skip()\n", nil)
+		sw.Do("continue\n", nil)
+		sw.Do("}\n", nil)
+		g.writeUnmarshalValue(sw, expr+"["+i+"]", u.Elem, depth+1)
+		sw.Do("}\n", nil)
+		sw.Do("}\n", nil)
+	case u.Kind == types.Map && isStringKeyed(u):
+		sw.Do("if l.Null() {\n", nil)
+		sw.Do("$.expr$ = nil\n", args)
+		sw.Do("} else {\n", nil)
+		sw.Do("if $.expr$ == nil {\n", args)
+		sw.Do("$.expr$ = make($.type|raw$)\n", args)
+		sw.Do("}\n", nil)
+		sw.Do("l.Delim('{')\n", nil)
+		sw.Do("for l.More('}') {\n", nil)
+		sw.Do("k := $.key|raw$(l.Key())\n", args.With("key", u.Key))
+		sw.Do("var $.v$ $.elem|raw$\n", args)
+		g.writeUnmarshalValue(sw, v, u.Elem, depth+1)
+		sw.Do("$.expr$[k] = $.v$\n", args)
+		sw.Do("}\n", nil)
+		sw.Do("}\n", nil)
+	default:
+		sw.Do("l.Unmarshal(&$.expr$)\n", args)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonschema_gen
+
+import (
+	"fmt"
+	"net/url"
+
+	ccli "github.com/lack-io/cli"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+)
+
+// CustomArgs is used by the gogenerator framework to pass args specific to
+// this generator.
+type CustomArgs struct {
+	// BaseURI, if set, is prefixed to the package path to make the $id of
+	// the document of a package, and references between documents are
+	// absolute. Otherwise documents have no $id, and refer to each other by
+	// relative paths.
+	BaseURI string
+}
+
+// NewDefaults returns arguments for the generator.
+func NewDefaults() (*args.GeneratorArgs, *CustomArgs) {
+	genericArgs := args.Default().WithoutDefaultFlagParsing()
+	customArgs := &CustomArgs{}
+	genericArgs.CustomArgs = customArgs
+	genericArgs.OutputFileBaseName = "zz_generated.schema"
+	return genericArgs, customArgs
+}
+
+// AddFlags add the generator flags to the flag set.
+func (ca *CustomArgs) AddFlags(app *ccli.App) {
+	app.StringVarP(&ca.BaseURI, "base-uri", "", ca.BaseURI,
+		"The URI the $id of each document is made from, by appending the package path.", "")
+}
+
+// Validate checks the given arguments.
+func Validate(genericArgs *args.GeneratorArgs) error {
+	customArgs := genericArgs.CustomArgs.(*CustomArgs)
+
+	if len(genericArgs.InputDirs) == 0 && len(genericArgs.InputFiles) == 0 && !args.InvokedByGoGenerate() {
+		return fmt.Errorf("input directories cannot be empty")
+	}
+
+	if len(genericArgs.OutputFileBaseName) == 0 {
+		return fmt.Errorf("output file base name cannot be empty")
+	}
+
+	if len(customArgs.BaseURI) > 0 {
+		u, err := url.Parse(customArgs.BaseURI)
+		if err != nil {
+			return fmt.Errorf("invalid base URI %q: %v", customArgs.BaseURI, err)
+		}
+		if !u.IsAbs() {
+			return fmt.Errorf("base URI %q is not absolute", customArgs.BaseURI)
+		}
+	}
+
+	return nil
+}
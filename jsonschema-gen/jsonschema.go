@@ -0,0 +1,517 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonschema_gen
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/namer"
+	"github.com/lack-io/gogogen/gogenerator/types"
+	"github.com/lack-io/gogogen/util/log"
+	"github.com/lack-io/gogogen/util/sets"
+)
+
+// This is the comment tag that carries parameters for schema generation.
+const tagName = "gogogen:jsonschema-gen"
+
+// tagValuePackage, on a package, asks for schemas of every struct and named
+// type in it.
+const tagValuePackage = "package"
+
+// Comment tags on struct fields.
+const (
+	// +optional marks a field which may be left out, even if it is neither
+	// a pointer nor omitempty.
+	tagOptional = "optional"
+	// +required marks a field which must be present, even if it is a
+	// pointer or omitempty.
+	tagRequired = "required"
+	// +default=<value> gives the default of a field, as JSON. Values which
+	// are not valid JSON are taken as strings.
+	tagDefault = "default"
+)
+
+// metaSchema is the dialect of the documents.
+const metaSchema = "https://json-schema.org/draft/2020-12/schema"
+
+// defsPrefix is how references to the definitions of a document start.
+const defsPrefix = "#/$defs/"
+
+// The file type of the documents.
+const jsonSchemaFileType = "jsonschema"
+
+// schema is a JSON Schema. Only the keywords jsonschema-gen produces are
+// modeled.
+type schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	ID                   string             `json:"$id,omitempty"`
+	Ref                  string             `json:"$ref,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	ContentEncoding      string             `json:"contentEncoding,omitempty"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *schema            `json:"items,omitempty"`
+	AdditionalProperties *schema            `json:"additionalProperties,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Default              interface{}        `json:"default,omitempty"`
+	Defs                 map[string]*schema `json:"$defs,omitempty"`
+}
+
+// NameSystems returns the name system used by the generators in this package.
+func NameSystems() namer.NameSystems {
+	return namer.NameSystems{
+		"public": namer.NewPublicNamer(0),
+	}
+}
+
+// DefaultNameSystem returns the default name system for ordering the types to
+// be processed by the generators in this package.
+func DefaultNameSystem() string {
+	return "public"
+}
+
+// wantsSchema returns true if a schema is requested for 't', either by its
+// own tag or by the tag of its package.
+func wantsSchema(t *types.Type, ptagValue string) bool {
+	comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
+	values := types.ExtractCommentTags("+", comments)[tagName]
+	if len(values) > 1 {
+		log.Fatalf("Type %v: found %d %s tags: %q", t, len(values), tagName, values)
+	}
+	if len(values) == 1 {
+		switch values[0] {
+		case "", "true":
+			return true
+		case "false":
+			return false
+		default:
+			log.Fatalf("Type %v: unsupported %s value: %q", t, tagName, values[0])
+		}
+	}
+	return ptagValue == tagValuePackage
+}
+
+// requestedTypes returns the types of 'pkg' schemas are requested for.
+func requestedTypes(pkg *types.Package) map[*types.Type]bool {
+	ptagValue := ""
+	if values := types.ExtractCommentTags("+", pkg.Comments)[tagName]; len(values) > 0 {
+		ptagValue = values[0]
+		if ptagValue != tagValuePackage {
+			log.Fatalf("Package %v: unsupported %s value: %q", pkg.Path, tagName, ptagValue)
+		}
+	}
+	requested := map[*types.Type]bool{}
+	for _, t := range pkg.SortedTypes() {
+		if (t.Kind == types.Struct || t.Kind == types.Alias) && wantsSchema(t, ptagValue) {
+			requested[t] = true
+		}
+	}
+	return requested
+}
+
+func Packages(context *generator.Context, arguments *args.GeneratorArgs) generator.Packages {
+	boilerplate, err := arguments.LoadGoBoilerplate()
+	if err != nil {
+		log.Fatalf("Failed loading boilerplate: %v", err)
+	}
+	baseURI := arguments.CustomArgs.(*CustomArgs).BaseURI
+	// The name of the document of the package at 'path'.
+	filename := func(path string) string {
+		return arguments.OutputFileName(context.Universe[path], "jsonschema") + ".json"
+	}
+
+	context.FileTypes[jsonSchemaFileType] = generator.DefaultFileType{
+		Format:   formatJSON,
+		Assemble: assembleJSON,
+	}
+
+	// Find every requested type first, so that the document of a package
+	// can refer to the definitions in the documents of other packages
+	// rather than repeat them.
+	requested := map[string]map[*types.Type]bool{}
+	for i := range sets.NewString(context.Inputs...) {
+		log.Debugf("Considering pkg %q", i)
+		pkg := context.Universe[i]
+		if pkg == nil {
+			// If the input had no Go files, for example.
+			continue
+		}
+		if pkgRequested := requestedTypes(pkg); len(pkgRequested) > 0 {
+			requested[i] = pkgRequested
+		}
+	}
+
+	packages := generator.Packages{}
+	for i := range requested {
+		pkg := context.Universe[i]
+		// The location of the document holding each type defined
+		// elsewhere.
+		documents := map[*types.Type]string{}
+		for other, otherRequested := range requested {
+			if other == i {
+				continue
+			}
+			location := documentLocation(baseURI, i, other, filename(other))
+			for t := range otherRequested {
+				documents[t] = location
+			}
+		}
+		id := ""
+		if len(baseURI) > 0 {
+			id = documentLocation(baseURI, i, i, filename(i))
+		}
+
+		log.Infof("Package %q needs generation", i)
+		packages = append(packages,
+			&generator.DefaultPackage{
+				PackageName: strings.Split(filepath.Base(pkg.Path), ".")[0],
+				PackagePath: pkg.Path,
+				HeaderText:  boilerplate,
+				GeneratorFunc: func(c *generator.Context) (generators []generator.Generator) {
+					return []generator.Generator{
+						NewGenJSONSchema(arguments.OutputFileName(pkg, "jsonschema"), pkg.Path, id, requested[pkg.Path], documents),
+					}
+				},
+				FilterFunc: func(c *generator.Context, t *types.Type) bool {
+					return t.Name.Package == pkg.Path
+				},
+			})
+	}
+	return packages
+}
+
+// documentLocation returns how the document of package 'to' is referred to
+// from the document of package 'from': by its absolute URI when there is a
+// base URI, and by the relative path between the output directories
+// otherwise.
+func documentLocation(baseURI, from, to, filename string) string {
+	if len(baseURI) > 0 {
+		return strings.TrimSuffix(baseURI, "/") + "/" + to + "/" + filename
+	}
+	rel, err := filepath.Rel(filepath.FromSlash(from), filepath.FromSlash(to))
+	if err != nil {
+		log.Fatalf("Failed to find the path from %q to %q: %v", from, to, err)
+	}
+	return filepath.ToSlash(filepath.Join(rel, filename))
+}
+
+// genJSONSchema produces the JSON Schema document of the types of a package.
+type genJSONSchema struct {
+	generator.DefaultGen
+	targetPackage string
+	id            string
+	requested     map[*types.Type]bool
+	schemas       *schemaBuilder
+}
+
+func NewGenJSONSchema(sanitizedName, targetPackage, id string, requested map[*types.Type]bool, documents map[*types.Type]string) generator.Generator {
+	return &genJSONSchema{
+		DefaultGen: generator.DefaultGen{
+			OptionalName: sanitizedName,
+		},
+		targetPackage: targetPackage,
+		id:            id,
+		requested:     requested,
+		schemas:       newSchemaBuilder(targetPackage, documents),
+	}
+}
+
+func (g *genJSONSchema) Filename() string {
+	return g.OptionalName + ".json"
+}
+
+func (g *genJSONSchema) FileType() string {
+	return jsonSchemaFileType
+}
+
+func (g *genJSONSchema) Filter(c *generator.Context, t *types.Type) bool {
+	return g.requested[t]
+}
+
+func (g *genJSONSchema) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	log.Infof("Generating JSON Schema for type %v", t)
+	g.schemas.define(c.Universe, t)
+	return nil
+}
+
+func (g *genJSONSchema) Finalize(c *generator.Context, w io.Writer) error {
+	document := &schema{
+		Schema: metaSchema,
+		ID:     g.id,
+		Defs:   g.schemas.defs,
+	}
+	b, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// The header is dropped from the documents, as JSON has no comments.
+func assembleJSON(w io.Writer, f *generator.File) {
+	w.Write(f.Body.Bytes())
+}
+
+func formatJSON(source []byte) ([]byte, error) {
+	if !json.Valid(source) {
+		return source, fmt.Errorf("invalid JSON")
+	}
+	return source, nil
+}
+
+// schemaBuilder converts types into schemas. Named types get a definition
+// in the document, unless they are defined in the document of another
+// package, which is then referred to.
+type schemaBuilder struct {
+	targetPackage string
+	documents     map[*types.Type]string
+	defs          map[string]*schema
+}
+
+func newSchemaBuilder(targetPackage string, documents map[*types.Type]string) *schemaBuilder {
+	return &schemaBuilder{
+		targetPackage: targetPackage,
+		documents:     documents,
+		defs:          map[string]*schema{},
+	}
+}
+
+// defName returns the name of the definition of the named type 't'. Types of
+// other packages are qualified by their package path.
+func (b *schemaBuilder) defName(t *types.Type) string {
+	if t.Name.Package == b.targetPackage {
+		return t.Name.Name
+	}
+	return strings.Replace(t.Name.Package, "/", ".", -1) + "." + t.Name.Name
+}
+
+// define adds the definition of the named type 't', and returns its name.
+func (b *schemaBuilder) define(u types.Universe, t *types.Type) string {
+	name := b.defName(t)
+	if _, ok := b.defs[name]; ok {
+		return name
+	}
+	// Register the name first, so that recursive types terminate.
+	s := &schema{}
+	b.defs[name] = s
+
+	if special, ok := specialSchema(t); ok {
+		*s = *special
+	} else if t.Kind == types.Struct {
+		*s = *b.structSchema(u, t)
+	} else if t.Kind == types.Alias {
+		*s = *b.schemaFor(u, t.Underlying)
+		s.Enum = enumValues(u, t)
+	}
+	s.Description = description(t.CommentLines)
+	return name
+}
+
+// specialSchema returns the schema of types which encode themselves.
+func specialSchema(t *types.Type) (*schema, bool) {
+	switch {
+	case t.Name.Package == "time" && t.Name.Name == "Time":
+		return &schema{Type: "string", Format: "date-time"}, true
+	case t.Methods["MarshalJSON"] != nil:
+		// Nothing is known about what it produces.
+		return &schema{}, true
+	case t.Methods["MarshalText"] != nil:
+		return &schema{Type: "string"}, true
+	}
+	return nil, false
+}
+
+// schemaFor returns the schema for a value of type 't', referring to the
+// definitions of named types.
+func (b *schemaBuilder) schemaFor(u types.Universe, t *types.Type) *schema {
+	if t.Kind == types.Builtin {
+		return builtinSchema(t)
+	}
+	if len(t.Name.Package) > 0 && (t.Kind == types.Struct || t.Kind == types.Alias) {
+		if location, ok := b.documents[t]; ok {
+			return &schema{Ref: location + defsPrefix + t.Name.Name}
+		}
+		return &schema{Ref: defsPrefix + b.define(u, t)}
+	}
+	switch t.Kind {
+	case types.Pointer:
+		return b.schemaFor(u, t.Elem)
+	case types.Slice, types.Array:
+		if t.Elem == types.Byte {
+			return &schema{Type: "string", ContentEncoding: "base64"}
+		}
+		return &schema{Type: "array", Items: b.schemaFor(u, t.Elem)}
+	case types.Map:
+		return &schema{Type: "object", AdditionalProperties: b.schemaFor(u, t.Elem)}
+	case types.Struct:
+		return b.structSchema(u, t)
+	}
+	// Interfaces, and anything else, may hold any value.
+	return &schema{}
+}
+
+func builtinSchema(t *types.Type) *schema {
+	switch t {
+	case types.String:
+		return &schema{Type: "string"}
+	case types.Bool:
+		return &schema{Type: "boolean"}
+	case types.Float32, types.Float64:
+		return &schema{Type: "number"}
+	}
+	if types.IsInteger(t) {
+		return &schema{Type: "integer"}
+	}
+	return &schema{}
+}
+
+// structSchema returns the object schema of the struct 't', with the members
+// of embedded structs promoted the way encoding/json does.
+func (b *schemaBuilder) structSchema(u types.Universe, t *types.Type) *schema {
+	s := &schema{Type: "object"}
+	b.addMembers(u, s, t, map[*types.Type]bool{})
+	return s
+}
+
+func (b *schemaBuilder) addMembers(u types.Universe, s *schema, t *types.Type, visited map[*types.Type]bool) {
+	if visited[t] {
+		return
+	}
+	visited[t] = true
+	for _, m := range t.Members {
+		tag := reflect.StructTag(m.Tags).Get("json")
+		if tag == "-" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		name, omitEmpty := parts[0], false
+		for _, opt := range parts[1:] {
+			omitEmpty = omitEmpty || opt == "omitempty"
+		}
+		if m.Embedded && len(name) == 0 {
+			et := m.Type
+			if et.Kind == types.Pointer {
+				et = et.Elem
+			}
+			if et.Kind == types.Struct {
+				b.addMembers(u, s, et, visited)
+				continue
+			}
+		}
+		if namer.IsPrivateGoName(m.Name) {
+			continue
+		}
+		if len(name) == 0 {
+			name = m.Name
+		}
+		if _, ok := s.Properties[name]; ok {
+			// A shallower member already claimed the name.
+			continue
+		}
+
+		prop := b.schemaFor(u, m.Type)
+		if len(prop.Ref) == 0 {
+			prop.Description = description(m.CommentLines)
+		}
+		memberTags := types.ExtractCommentTags("+", m.CommentLines)
+		if values := memberTags[tagDefault]; len(values) > 0 {
+			var value interface{}
+			if err := json.Unmarshal([]byte(values[0]), &value); err != nil {
+				value = values[0]
+			}
+			prop.Default = value
+		}
+		if s.Properties == nil {
+			s.Properties = map[string]*schema{}
+		}
+		s.Properties[name] = prop
+
+		_, optional := memberTags[tagOptional]
+		_, required := memberTags[tagRequired]
+		if optional && required {
+			log.Fatalf("Type %v: field %s is tagged both +%s and +%s", t, m.Name, tagOptional, tagRequired)
+		}
+		if required || (!optional && !omitEmpty && m.Type.Kind != types.Pointer) {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// enumValues returns the values of the constants of the named type 't', or
+// nil if there are none.
+func enumValues(u types.Universe, t *types.Type) []interface{} {
+	pkg := u[t.Name.Package]
+	if pkg == nil {
+		return nil
+	}
+	var values []string
+	for _, c := range pkg.SortedConstants() {
+		if c.Underlying == t && c.ConstValue != nil {
+			values = append(values, *c.ConstValue)
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	enum := []interface{}{}
+	if t.Underlying == types.String {
+		sort.Strings(values)
+		for _, v := range values {
+			enum = append(enum, v)
+		}
+		return enum
+	}
+	numbers := []json.Number{}
+	for _, v := range values {
+		if _, err := strconv.ParseFloat(v, 64); err != nil {
+			// Not representable, such as a fraction.
+			return nil
+		}
+		numbers = append(numbers, json.Number(v))
+	}
+	sort.Slice(numbers, func(i, j int) bool {
+		a, _ := strconv.ParseFloat(string(numbers[i]), 64)
+		b, _ := strconv.ParseFloat(string(numbers[j]), 64)
+		return a < b
+	})
+	for _, n := range numbers {
+		enum = append(enum, n)
+	}
+	return enum
+}
+
+// description returns the comment lines which aren't comment tags.
+func description(lines []string) string {
+	var text []string
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "+") {
+			continue
+		}
+		text = append(text, line)
+	}
+	return strings.TrimSpace(strings.Join(text, "\n"))
+}
@@ -0,0 +1,367 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lister_gen
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/namer"
+	"github.com/lack-io/gogogen/gogenerator/types"
+	"github.com/lack-io/gogogen/util/log"
+	"github.com/lack-io/gogogen/util/sets"
+)
+
+// This is the comment tag that marks a resource type, and the prefix of the
+// one carrying its parameters.
+const tagName = "gogogen:resource"
+
+// The parameters of a resource.
+const (
+	paramNamespaced = "namespaced"
+	paramResource   = "resource"
+)
+
+// The package of the cache the generated listers read from.
+const cachePackage = "github.com/lack-io/gogogen/runtime/cache"
+
+// NameSystems returns the name system used by the generators in this package.
+func NameSystems() namer.NameSystems {
+	return namer.NameSystems{
+		"public":       namer.NewPublicNamer(0),
+		"private":      namer.NewPrivateNamer(0),
+		"publicPlural": namer.NewPublicPluralNamer(nil),
+		"raw":          namer.NewRawNamer("", nil),
+	}
+}
+
+// DefaultNameSystem returns the default name system for ordering the types to
+// be processed by the generators in this package.
+func DefaultNameSystem() string {
+	return "public"
+}
+
+// resource describes the resource a type is the object of.
+type resource struct {
+	Namespaced bool
+	// The name of the resource in errors.
+	Resource string
+}
+
+// parseResource returns the resource of 't', or nil if it is not one.
+func parseResource(t *types.Type) *resource {
+	comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
+	values := types.ExtractCommentTags("+", comments)[tagName]
+	params, err := types.ExtractCommentTagParams("+", tagName, comments)
+	if err != nil {
+		log.Fatalf("Type %v: %v", t, err)
+	}
+	if len(values) == 0 && len(params) == 0 {
+		return nil
+	}
+	for _, v := range values {
+		if v != "" && v != "true" {
+			if v == "false" {
+				return nil
+			}
+			log.Fatalf("Type %v: unsupported %s value: %q", t, tagName, v)
+		}
+	}
+	if t.Kind != types.Struct {
+		log.Fatalf("Type %v: only structs can be resources", t)
+	}
+
+	r := &resource{Resource: namer.NewAllLowercasePluralNamer(nil).Name(t)}
+	for _, p := range params {
+		switch p.Key {
+		case paramNamespaced:
+			switch p.Value {
+			case "", "true":
+				r.Namespaced = true
+			case "false":
+				r.Namespaced = false
+			default:
+				log.Fatalf("Type %v: unsupported %s value: %q", t, paramNamespaced, p.Value)
+			}
+		case paramResource:
+			r.Resource = p.Value
+		default:
+			log.Fatalf("Type %v: unsupported %s parameter %q", t, tagName, p.Key)
+		}
+	}
+	return r
+}
+
+func Packages(context *generator.Context, arguments *args.GeneratorArgs) generator.Packages {
+	boilerplate, err := arguments.LoadGoBoilerplate()
+	if err != nil {
+		log.Fatalf("Failed loading boilerplate: %v", err)
+	}
+
+	packages := generator.Packages{}
+	header := append(arguments.GeneratedBuildConstraint(), boilerplate...)
+
+	for i := range sets.NewString(context.Inputs...) {
+		log.Debugf("Considering pkg %q", i)
+		pkg := context.Universe[i]
+		if pkg == nil {
+			// If the input had no Go files, for example.
+			continue
+		}
+
+		resources := map[*types.Type]*resource{}
+		for _, t := range pkg.SortedTypes() {
+			if r := parseResource(t); r != nil {
+				resources[t] = r
+			}
+		}
+		if len(resources) == 0 {
+			continue
+		}
+
+		log.Infof("Package %q needs generation", i)
+		packages = append(packages,
+			&generator.DefaultPackage{
+				PackageName: strings.Split(filepath.Base(pkg.Path), ".")[0],
+				PackagePath: pkg.Path,
+				HeaderText:  header,
+				GeneratorFunc: func(c *generator.Context) (generators []generator.Generator) {
+					return []generator.Generator{
+						NewGenLister(arguments.OutputFileName(pkg, "lister"), pkg.Path, resources),
+					}
+				},
+				FilterFunc: func(c *generator.Context, t *types.Type) bool {
+					return t.Name.Package == pkg.Path
+				},
+			})
+	}
+	return packages
+}
+
+// genLister produces a file with the listers of the resources of a package.
+type genLister struct {
+	generator.DefaultGen
+	targetPackage string
+	imports       namer.ImportTracker
+	resources     map[*types.Type]*resource
+}
+
+func NewGenLister(sanitizedName, targetPackage string, resources map[*types.Type]*resource) generator.Generator {
+	return &genLister{
+		DefaultGen: generator.DefaultGen{
+			OptionalName: sanitizedName,
+		},
+		targetPackage: targetPackage,
+		imports:       generator.NewImportTracker(),
+		resources:     resources,
+	}
+}
+
+func (g *genLister) Namers(c *generator.Context) namer.NameSystems {
+	// Have the raw namer for this file track what it imports.
+	return namer.NameSystems{
+		"raw": namer.NewRawNamer(g.targetPackage, g.imports),
+	}
+}
+
+func (g *genLister) Filter(c *generator.Context, t *types.Type) bool {
+	return g.resources[t] != nil
+}
+
+func (g *genLister) isOtherPackage(pkg string) bool {
+	if pkg == g.targetPackage {
+		return false
+	}
+	if strings.HasSuffix(pkg, "\""+g.targetPackage+"\"") {
+		return false
+	}
+	return true
+}
+
+func (g *genLister) Imports(c *generator.Context) (imports []string) {
+	importLines := []string{"fmt"}
+	for _, singleImport := range g.imports.ImportLines() {
+		if g.isOtherPackage(singleImport) {
+			importLines = append(importLines, singleImport)
+		}
+	}
+	return importLines
+}
+
+func (g *genLister) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	log.Infof("Generating lister for type %v", t)
+
+	r := g.resources[t]
+	sw := generator.NewSnippetWriter(w, c, "$", "$")
+	args := generator.Args{
+		"type":           t,
+		"resource":       fmt.Sprintf("%q", r.Resource),
+		"Indexer":        types.Ref(cachePackage, "Indexer"),
+		"NamespaceIndex": types.Ref(cachePackage, "NamespaceIndex"),
+		"NamespacedKey":  types.Ref(cachePackage, "NamespacedKey"),
+		"NewNotFound":    types.Ref(cachePackage, "NewNotFound"),
+	}
+	if r.Namespaced {
+		sw.Do(namespacedListerCode, args)
+	} else {
+		sw.Do(listerCode, args)
+	}
+	sw.Do(convertCode, args)
+	return sw.Error()
+}
+
+var listerCode = `// $.type|public$Lister lists and gets $.type|publicPlural$ from a cache.
+type $.type|public$Lister interface {
+	// List returns the $.type|publicPlural$ in the cache which match, or all of
+	// them if match is nil.
+	List(match func(*$.type|raw$) bool) ([]*$.type|raw$, error)
+	// Get returns the $.type|public$ with the name.
+	Get(name string) (*$.type|raw$, error)
+	// ByIndex returns the $.type|publicPlural$ whose values for the index include
+	// the value.
+	ByIndex(indexName, indexedValue string) ([]*$.type|raw$, error)
+}
+
+type $.type|private$Lister struct {
+	indexer $.Indexer|raw$
+}
+
+// New$.type|public$Lister returns a lister of the $.type|publicPlural$ in the indexer.
+func New$.type|public$Lister(indexer $.Indexer|raw$) $.type|public$Lister {
+	return &$.type|private$Lister{indexer: indexer}
+}
+
+func (l *$.type|private$Lister) List(match func(*$.type|raw$) bool) ([]*$.type|raw$, error) {
+	return to$.type|publicPlural$(l.indexer.List(), match)
+}
+
+func (l *$.type|private$Lister) Get(name string) (*$.type|raw$, error) {
+	return get$.type|public$(l.indexer, $.NamespacedKey|raw$("", name))
+}
+
+func (l *$.type|private$Lister) ByIndex(indexName, indexedValue string) ([]*$.type|raw$, error) {
+	objs, err := l.indexer.ByIndex(indexName, indexedValue)
+	if err != nil {
+		return nil, err
+	}
+	return to$.type|publicPlural$(objs, nil)
+}
+
+`
+
+var namespacedListerCode = `// $.type|public$Lister lists $.type|publicPlural$ from a cache.
+type $.type|public$Lister interface {
+	// List returns the $.type|publicPlural$ of all namespaces in the cache which
+	// match, or all of them if match is nil.
+	List(match func(*$.type|raw$) bool) ([]*$.type|raw$, error)
+	// ByIndex returns the $.type|publicPlural$ whose values for the index include
+	// the value.
+	ByIndex(indexName, indexedValue string) ([]*$.type|raw$, error)
+	// $.type|publicPlural$ returns a lister of the $.type|publicPlural$ of the namespace.
+	$.type|publicPlural$(namespace string) $.type|public$NamespaceLister
+}
+
+// $.type|public$NamespaceLister lists and gets the $.type|publicPlural$ of a namespace from
+// a cache.
+type $.type|public$NamespaceLister interface {
+	// List returns the $.type|publicPlural$ of the namespace in the cache which
+	// match, or all of them if match is nil.
+	List(match func(*$.type|raw$) bool) ([]*$.type|raw$, error)
+	// Get returns the $.type|public$ of the namespace with the name.
+	Get(name string) (*$.type|raw$, error)
+}
+
+type $.type|private$Lister struct {
+	indexer $.Indexer|raw$
+}
+
+// New$.type|public$Lister returns a lister of the $.type|publicPlural$ in the indexer, which
+// must have the $.NamespaceIndex|raw$ index.
+func New$.type|public$Lister(indexer $.Indexer|raw$) $.type|public$Lister {
+	return &$.type|private$Lister{indexer: indexer}
+}
+
+func (l *$.type|private$Lister) List(match func(*$.type|raw$) bool) ([]*$.type|raw$, error) {
+	return to$.type|publicPlural$(l.indexer.List(), match)
+}
+
+func (l *$.type|private$Lister) ByIndex(indexName, indexedValue string) ([]*$.type|raw$, error) {
+	objs, err := l.indexer.ByIndex(indexName, indexedValue)
+	if err != nil {
+		return nil, err
+	}
+	return to$.type|publicPlural$(objs, nil)
+}
+
+func (l *$.type|private$Lister) $.type|publicPlural$(namespace string) $.type|public$NamespaceLister {
+	return &$.type|private$NamespaceLister{indexer: l.indexer, namespace: namespace}
+}
+
+type $.type|private$NamespaceLister struct {
+	indexer   $.Indexer|raw$
+	namespace string
+}
+
+func (l *$.type|private$NamespaceLister) List(match func(*$.type|raw$) bool) ([]*$.type|raw$, error) {
+	objs, err := l.indexer.ByIndex($.NamespaceIndex|raw$, l.namespace)
+	if err != nil {
+		return nil, err
+	}
+	return to$.type|publicPlural$(objs, match)
+}
+
+func (l *$.type|private$NamespaceLister) Get(name string) (*$.type|raw$, error) {
+	return get$.type|public$(l.indexer, $.NamespacedKey|raw$(l.namespace, name))
+}
+
+`
+
+var convertCode = `// get$.type|public$ returns the $.type|public$ with the key in the indexer.
+func get$.type|public$(indexer $.Indexer|raw$, key string) (*$.type|raw$, error) {
+	obj, exists, err := indexer.GetByKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, $.NewNotFound|raw$($.resource$, key)
+	}
+	out, ok := obj.(*$.type|raw$)
+	if !ok {
+		return nil, fmt.Errorf("cache holds a %T, not a *$.type|raw$, for key %q", obj, key)
+	}
+	return out, nil
+}
+
+// to$.type|publicPlural$ returns the objects as $.type|publicPlural$, leaving out those which don't
+// match, unless match is nil.
+func to$.type|publicPlural$(objs []interface{}, match func(*$.type|raw$) bool) ([]*$.type|raw$, error) {
+	out := make([]*$.type|raw$, 0, len(objs))
+	for _, obj := range objs {
+		o, ok := obj.(*$.type|raw$)
+		if !ok {
+			return nil, fmt.Errorf("cache holds a %T, not a *$.type|raw$", obj)
+		}
+		if match == nil || match(o) {
+			out = append(out, o)
+		}
+	}
+	return out, nil
+}
+
+`
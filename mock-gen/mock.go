@@ -0,0 +1,379 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mock_gen
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/namer"
+	"github.com/lack-io/gogogen/gogenerator/types"
+	"github.com/lack-io/gogogen/util/log"
+	"github.com/lack-io/gogogen/util/sets"
+)
+
+// This is the comment tag that asks for a mock of an interface.
+const tagName = "gogogen:mock"
+
+// NameSystems returns the name system used by the generators in this package.
+func NameSystems() namer.NameSystems {
+	return namer.NameSystems{
+		"public": namer.NewPublicNamer(0),
+		"raw":    namer.NewRawNamer("", nil),
+	}
+}
+
+// DefaultNameSystem returns the default name system for ordering the types to
+// be processed by the generators in this package.
+func DefaultNameSystem() string {
+	return "public"
+}
+
+// wantsMock returns true if a mock is requested for the interface 't'. Unless
+// taggedOnly, every exported interface is mocked which doesn't opt out.
+func wantsMock(t *types.Type, taggedOnly bool) bool {
+	comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
+	values := types.ExtractCommentTags("+", comments)[tagName]
+	if len(values) > 1 {
+		log.Fatalf("Type %v: found %d %s tags: %q", t, len(values), tagName, values)
+	}
+	if len(values) == 1 {
+		switch values[0] {
+		case "", "true":
+			return true
+		case "false":
+			return false
+		default:
+			log.Fatalf("Type %v: unsupported %s value: %q", t, tagName, values[0])
+		}
+	}
+	return !taggedOnly && !namer.IsPrivateGoName(t.Name.Name)
+}
+
+func Packages(context *generator.Context, arguments *args.GeneratorArgs) generator.Packages {
+	boilerplate, err := arguments.LoadGoBoilerplate()
+	if err != nil {
+		log.Fatalf("Failed loading boilerplate: %v", err)
+	}
+	taggedOnly := arguments.CustomArgs.(*CustomArgs).TaggedOnly
+
+	packages := generator.Packages{}
+	header := append(arguments.GeneratedBuildConstraint(), boilerplate...)
+
+	for i := range sets.NewString(context.Inputs...) {
+		log.Debugf("Considering pkg %q", i)
+		pkg := context.Universe[i]
+		if pkg == nil {
+			// If the input had no Go files, for example.
+			continue
+		}
+
+		requested := map[*types.Type]bool{}
+		for _, t := range pkg.SortedTypes() {
+			if t.Kind == types.Interface && len(t.Methods) > 0 && wantsMock(t, taggedOnly) {
+				requested[t] = true
+			}
+		}
+		if len(requested) == 0 {
+			continue
+		}
+
+		log.Infof("Package %q needs generation", i)
+		packages = append(packages,
+			&generator.DefaultPackage{
+				PackageName: strings.Split(filepath.Base(pkg.Path), ".")[0],
+				PackagePath: pkg.Path,
+				HeaderText:  header,
+				GeneratorFunc: func(c *generator.Context) (generators []generator.Generator) {
+					return []generator.Generator{
+						NewGenMock(arguments.OutputFileName(pkg, "mock"), pkg.Path, requested),
+					}
+				},
+				FilterFunc: func(c *generator.Context, t *types.Type) bool {
+					return t.Name.Package == pkg.Path
+				},
+			})
+	}
+	return packages
+}
+
+// genMock produces a file with the mocks of the interfaces of a package.
+type genMock struct {
+	generator.DefaultGen
+	targetPackage string
+	imports       namer.ImportTracker
+	requested     map[*types.Type]bool
+}
+
+func NewGenMock(sanitizedName, targetPackage string, requested map[*types.Type]bool) generator.Generator {
+	return &genMock{
+		DefaultGen: generator.DefaultGen{
+			OptionalName: sanitizedName,
+		},
+		targetPackage: targetPackage,
+		imports:       generator.NewImportTracker(),
+		requested:     requested,
+	}
+}
+
+func (g *genMock) Namers(c *generator.Context) namer.NameSystems {
+	// Have the raw namer for this file track what it imports.
+	return namer.NameSystems{
+		"raw": namer.NewRawNamer(g.targetPackage, g.imports),
+	}
+}
+
+func (g *genMock) Filter(c *generator.Context, t *types.Type) bool {
+	return g.requested[t]
+}
+
+func (g *genMock) isOtherPackage(pkg string) bool {
+	if pkg == g.targetPackage {
+		return false
+	}
+	if strings.HasSuffix(pkg, "\""+g.targetPackage+"\"") {
+		return false
+	}
+	return true
+}
+
+func (g *genMock) Imports(c *generator.Context) (imports []string) {
+	importLines := []string{"sync"}
+	for _, singleImport := range g.imports.ImportLines() {
+		if g.isOtherPackage(singleImport) {
+			importLines = append(importLines, singleImport)
+		}
+	}
+	return importLines
+}
+
+// mockVar is a parameter or result of a mocked method.
+type mockVar struct {
+	// The name of the variable in the generated code.
+	Name string
+	// The name of the field recording it, for parameters.
+	Field string
+	// The type, as written in a parameter list.
+	Type string
+	// The type of the field recording it.
+	FieldType string
+	// What the variable is passed as to the stub.
+	Arg string
+}
+
+// mockMethod describes a method of a mocked interface.
+type mockMethod struct {
+	Name string
+	// The name of the mock type.
+	Mock     string
+	Params   []mockVar
+	Results  []mockVar
+	FuncType string
+}
+
+// newMockMethod names the parameters and results of a method so that they
+// don't collide with each other, or with the local names of the generated
+// code. The names in the interface are kept where possible.
+func newMockMethod(raw namer.Namer, mock, name string, method *types.Type) mockMethod {
+	sig := method.Signature
+	m := mockMethod{Name: name, Mock: mock}
+	used := map[string]bool{"mock": true, "stub": true}
+	fields := map[string]bool{}
+	for i, pt := range sig.Parameters {
+		v := mockVar{Type: raw.Name(pt)}
+		if i < len(sig.ParameterNames) {
+			v.Name = sig.ParameterNames[i]
+		}
+		if len(v.Name) == 0 || v.Name == "_" || used[v.Name] {
+			v.Name = fmt.Sprintf("p%d", i)
+		}
+		for used[v.Name] {
+			v.Name += "_"
+		}
+		used[v.Name] = true
+
+		v.Field = strings.ToUpper(v.Name[:1]) + v.Name[1:]
+		for fields[v.Field] {
+			v.Field += "_"
+		}
+		fields[v.Field] = true
+
+		v.FieldType = v.Type
+		v.Arg = v.Name
+		if sig.Variadic && i == len(sig.Parameters)-1 && pt.Kind == types.Slice {
+			v.Type = "..." + raw.Name(pt.Elem)
+			v.Arg += "..."
+		}
+		m.Params = append(m.Params, v)
+	}
+	for i, rt := range sig.Results {
+		v := mockVar{Name: fmt.Sprintf("r%d", i), Type: raw.Name(rt)}
+		for used[v.Name] {
+			v.Name += "_"
+		}
+		used[v.Name] = true
+		m.Results = append(m.Results, v)
+	}
+	m.FuncType = "func(" + m.ParamTypes() + ")" + m.ResultList()
+	return m
+}
+
+func joinVars(vars []mockVar, f func(mockVar) string) string {
+	parts := []string{}
+	for _, v := range vars {
+		parts = append(parts, f(v))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ParamList returns the parameters, as declared by the method.
+func (m mockMethod) ParamList() string {
+	return joinVars(m.Params, func(v mockVar) string { return v.Name + " " + v.Type })
+}
+
+// ParamTypes returns the parameters without their names.
+func (m mockMethod) ParamTypes() string {
+	return joinVars(m.Params, func(v mockVar) string { return v.Type })
+}
+
+// Args returns the arguments passing the parameters on to the stub.
+func (m mockMethod) Args() string {
+	return joinVars(m.Params, func(v mockVar) string { return v.Arg })
+}
+
+// ResultList returns the results, as declared by the method, including the
+// space separating them from the parameters.
+func (m mockMethod) ResultList() string {
+	switch len(m.Results) {
+	case 0:
+		return ""
+	case 1:
+		return " " + m.Results[0].Type
+	}
+	return " (" + joinVars(m.Results, func(v mockVar) string { return v.Type }) + ")"
+}
+
+// NamedResults returns the results as parameters, named.
+func (m mockMethod) NamedResults() string {
+	return joinVars(m.Results, func(v mockVar) string { return v.Name + " " + v.Type })
+}
+
+// ResultNames returns the names of the results, as returned.
+func (m mockMethod) ResultNames() string {
+	return joinVars(m.Results, func(v mockVar) string { return v.Name })
+}
+
+func (g *genMock) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	log.Infof("Generating mock for interface %v", t)
+
+	names := []string{}
+	for name := range t.Methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	methods := []mockMethod{}
+	for _, name := range names {
+		methods = append(methods, newMockMethod(c.Namers["raw"], "Mock"+c.Namers["public"].Name(t), name, t.Methods[name]))
+	}
+
+	sw := generator.NewSnippetWriter(w, c, "$", "$")
+	args := generator.Args{
+		"type":    t,
+		"methods": methods,
+	}
+	sw.Do(mockCode, args)
+	for _, m := range methods {
+		args["method"] = m
+		sw.Do(methodCode, args)
+		if len(m.Results) > 0 {
+			sw.Do(returnsCode, args)
+		}
+	}
+	return sw.Error()
+}
+
+var mockCode = `// Mock$.type|public$ is a mock implementation of $.type|raw$. It records the
+// calls made to it, and answers them with its stub functions, or with zero
+// values for the methods which have none.
+type Mock$.type|public$ struct {
+	$- range .methods$
+	// $.Name$Func, if set, answers the calls to $.Name$.
+	$.Name$Func $.FuncType$
+	$- end$
+
+	lock  sync.Mutex
+	calls struct {
+		$- range .methods$
+		$.Name$ []$.Mock$$.Name$Call
+		$- end$
+	}
+}
+
+var _ $.type|raw$ = &Mock$.type|public${}
+
+`
+
+var methodCode = `$- with .method -$
+// $.Mock$$.Name$Call holds the arguments of a call to $.Name$.
+type $.Mock$$.Name$Call struct {
+	$- range .Params$
+	$.Field$ $.FieldType$
+	$- end$
+}
+
+// $.Name$ records the call, and answers it with $.Name$Func.
+func (mock *$.Mock$) $.Name$($.ParamList$)$.ResultList$ {
+	mock.lock.Lock()
+	mock.calls.$.Name$ = append(mock.calls.$.Name$, $.Mock$$.Name$Call{
+		$- range .Params$
+		$.Field$: $.Name$,
+		$- end$
+	})
+	stub := mock.$.Name$Func
+	mock.lock.Unlock()
+	if stub == nil {
+		$- range .Results$
+		var $.Name$ $.Type$
+		$- end$
+		return $.ResultNames$
+	}
+	$if .Results$return $end$stub($.Args$)
+}
+
+// $.Name$Calls returns the calls made to $.Name$ so far.
+func (mock *$.Mock$) $.Name$Calls() []$.Mock$$.Name$Call {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	return append([]$.Mock$$.Name$Call(nil), mock.calls.$.Name$...)
+}
+$end$
+`
+
+var returnsCode = `$- with .method -$
+// $.Name$Returns stubs $.Name$ to always return the given values.
+func (mock *$.Mock$) $.Name$Returns($.NamedResults$) {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	mock.$.Name$Func = func($.ParamTypes$)$.ResultList$ {
+		return $.ResultNames$
+	}
+}
+$end$
+`
@@ -0,0 +1,64 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mock_gen
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	gotypes "go/types"
+	"path/filepath"
+	"testing"
+
+	gentesting "github.com/lack-io/gogogen/gogenerator/testing"
+)
+
+const testdataPackage = "github.com/lack-io/gogogen/mock-gen/testdata/store"
+
+// TestGolden compares the mocks of testdata/store with the golden files, and
+// type checks them along with the package they mock, so that the mocks are
+// known to implement their interfaces.
+func TestGolden(t *testing.T) {
+	genericArgs, _ := NewDefaults()
+	genericArgs.GoHeader = []byte{}
+	genericArgs.GeneratorName = "mock-gen"
+	gentesting.Run(t, gentesting.Case{
+		InputDirs:     []string{testdataPackage},
+		GoldenDir:     "testdata/golden",
+		NameSystems:   NameSystems(),
+		DefaultSystem: DefaultNameSystem(),
+		Packages:      Packages,
+		Args:          genericArgs,
+	})
+
+	fset := token.NewFileSet()
+	files := []*ast.File{}
+	for _, dir := range []string{"testdata/store", filepath.Join("testdata/golden", filepath.FromSlash(testdataPackage))} {
+		pkgs, err := parser.ParseDir(fset, dir, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, pkg := range pkgs {
+			for _, f := range pkg.Files {
+				files = append(files, f)
+			}
+		}
+	}
+	conf := gotypes.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	if _, err := conf.Check(testdataPackage, fset, files, nil); err != nil {
+		t.Errorf("The mocks don't compile: %v", err)
+	}
+}
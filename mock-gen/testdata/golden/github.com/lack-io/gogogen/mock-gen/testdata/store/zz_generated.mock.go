@@ -0,0 +1,217 @@
+//go:build !ignore_autogenerated
+// +build !ignore_autogenerated
+
+package store
+
+import (
+	context "context"
+	"sync"
+)
+
+// MockStore is a mock implementation of Store. It records the
+// calls made to it, and answers them with its stub functions, or with zero
+// values for the methods which have none.
+type MockStore struct {
+	// FnFunc, if set, answers the calls to Fn.
+	FnFunc func(func(int) error, chan<- int)
+	// GetFunc, if set, answers the calls to Get.
+	GetFunc func(context.Context, string) ([]byte, error)
+	// KeysFunc, if set, answers the calls to Keys.
+	KeysFunc func(string, ...string) []string
+	// PipeFunc, if set, answers the calls to Pipe.
+	PipeFunc func(<-chan int, chan<- int, chan int) chan (<-chan int)
+	// WatchFunc, if set, answers the calls to Watch.
+	WatchFunc func(context.Context) <-chan string
+
+	lock  sync.Mutex
+	calls struct {
+		Fn    []MockStoreFnCall
+		Get   []MockStoreGetCall
+		Keys  []MockStoreKeysCall
+		Pipe  []MockStorePipeCall
+		Watch []MockStoreWatchCall
+	}
+}
+
+var _ Store = &MockStore{}
+
+// MockStoreFnCall holds the arguments of a call to Fn.
+type MockStoreFnCall struct {
+	F  func(int) error
+	Ch chan<- int
+}
+
+// Fn records the call, and answers it with FnFunc.
+func (mock *MockStore) Fn(f func(int) error, ch chan<- int) {
+	mock.lock.Lock()
+	mock.calls.Fn = append(mock.calls.Fn, MockStoreFnCall{
+		F:  f,
+		Ch: ch,
+	})
+	stub := mock.FnFunc
+	mock.lock.Unlock()
+	if stub == nil {
+		return
+	}
+	stub(f, ch)
+}
+
+// FnCalls returns the calls made to Fn so far.
+func (mock *MockStore) FnCalls() []MockStoreFnCall {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	return append([]MockStoreFnCall(nil), mock.calls.Fn...)
+}
+
+// MockStoreGetCall holds the arguments of a call to Get.
+type MockStoreGetCall struct {
+	Ctx context.Context
+	Key string
+}
+
+// Get records the call, and answers it with GetFunc.
+func (mock *MockStore) Get(ctx context.Context, key string) ([]byte, error) {
+	mock.lock.Lock()
+	mock.calls.Get = append(mock.calls.Get, MockStoreGetCall{
+		Ctx: ctx,
+		Key: key,
+	})
+	stub := mock.GetFunc
+	mock.lock.Unlock()
+	if stub == nil {
+		var r0 []byte
+		var r1 error
+		return r0, r1
+	}
+	return stub(ctx, key)
+}
+
+// GetCalls returns the calls made to Get so far.
+func (mock *MockStore) GetCalls() []MockStoreGetCall {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	return append([]MockStoreGetCall(nil), mock.calls.Get...)
+}
+
+// GetReturns stubs Get to always return the given values.
+func (mock *MockStore) GetReturns(r0 []byte, r1 error) {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	mock.GetFunc = func(context.Context, string) ([]byte, error) {
+		return r0, r1
+	}
+}
+
+// MockStoreKeysCall holds the arguments of a call to Keys.
+type MockStoreKeysCall struct {
+	Prefix string
+	More   []string
+}
+
+// Keys records the call, and answers it with KeysFunc.
+func (mock *MockStore) Keys(prefix string, more ...string) []string {
+	mock.lock.Lock()
+	mock.calls.Keys = append(mock.calls.Keys, MockStoreKeysCall{
+		Prefix: prefix,
+		More:   more,
+	})
+	stub := mock.KeysFunc
+	mock.lock.Unlock()
+	if stub == nil {
+		var r0 []string
+		return r0
+	}
+	return stub(prefix, more...)
+}
+
+// KeysCalls returns the calls made to Keys so far.
+func (mock *MockStore) KeysCalls() []MockStoreKeysCall {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	return append([]MockStoreKeysCall(nil), mock.calls.Keys...)
+}
+
+// KeysReturns stubs Keys to always return the given values.
+func (mock *MockStore) KeysReturns(r0 []string) {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	mock.KeysFunc = func(string, ...string) []string {
+		return r0
+	}
+}
+
+// MockStorePipeCall holds the arguments of a call to Pipe.
+type MockStorePipeCall struct {
+	In   <-chan int
+	Out  chan<- int
+	Both chan int
+}
+
+// Pipe records the call, and answers it with PipeFunc.
+func (mock *MockStore) Pipe(in <-chan int, out chan<- int, both chan int) chan (<-chan int) {
+	mock.lock.Lock()
+	mock.calls.Pipe = append(mock.calls.Pipe, MockStorePipeCall{
+		In:   in,
+		Out:  out,
+		Both: both,
+	})
+	stub := mock.PipeFunc
+	mock.lock.Unlock()
+	if stub == nil {
+		var r0 chan (<-chan int)
+		return r0
+	}
+	return stub(in, out, both)
+}
+
+// PipeCalls returns the calls made to Pipe so far.
+func (mock *MockStore) PipeCalls() []MockStorePipeCall {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	return append([]MockStorePipeCall(nil), mock.calls.Pipe...)
+}
+
+// PipeReturns stubs Pipe to always return the given values.
+func (mock *MockStore) PipeReturns(r0 chan (<-chan int)) {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	mock.PipeFunc = func(<-chan int, chan<- int, chan int) chan (<-chan int) {
+		return r0
+	}
+}
+
+// MockStoreWatchCall holds the arguments of a call to Watch.
+type MockStoreWatchCall struct {
+	Ctx context.Context
+}
+
+// Watch records the call, and answers it with WatchFunc.
+func (mock *MockStore) Watch(ctx context.Context) <-chan string {
+	mock.lock.Lock()
+	mock.calls.Watch = append(mock.calls.Watch, MockStoreWatchCall{
+		Ctx: ctx,
+	})
+	stub := mock.WatchFunc
+	mock.lock.Unlock()
+	if stub == nil {
+		var r0 <-chan string
+		return r0
+	}
+	return stub(ctx)
+}
+
+// WatchCalls returns the calls made to Watch so far.
+func (mock *MockStore) WatchCalls() []MockStoreWatchCall {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	return append([]MockStoreWatchCall(nil), mock.calls.Watch...)
+}
+
+// WatchReturns stubs Watch to always return the given values.
+func (mock *MockStore) WatchReturns(r0 <-chan string) {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	mock.WatchFunc = func(context.Context) <-chan string {
+		return r0
+	}
+}
@@ -0,0 +1,14 @@
+// Package store is the input of the mock-gen golden test.
+package store
+
+import "context"
+
+// Store is mocked, with channels of every direction among its parameters
+// and results.
+type Store interface {
+	Get(ctx context.Context, key string) ([]byte, error)
+	Fn(f func(int) error, ch chan<- int)
+	Watch(ctx context.Context) <-chan string
+	Pipe(in <-chan int, out chan<- int, both chan int) chan (<-chan int)
+	Keys(prefix string, more ...string) []string
+}
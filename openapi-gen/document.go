@@ -0,0 +1,86 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openapi_gen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+
+	"github.com/lack-io/gogogen/gogenerator/generator"
+)
+
+// The bodies of the standalone documents are the JSON of the components
+// section. The Go header is dropped from JSON, which has no comments.
+func assembleJSON(w io.Writer, f *generator.File) {
+	w.Write(f.Body.Bytes())
+}
+
+func formatJSON(source []byte) ([]byte, error) {
+	if !json.Valid(source) {
+		return source, fmt.Errorf("invalid JSON")
+	}
+	return source, nil
+}
+
+// assembleYAML converts the header to YAML comments and the body to block
+// style YAML.
+func assembleYAML(w io.Writer, f *generator.File) {
+	w.Write(generator.CommentHeader(f.Header, "#"))
+
+	d := json.NewDecoder(bytes.NewReader(f.Body.Bytes()))
+	d.UseNumber()
+	var doc map[string]interface{}
+	if err := d.Decode(&doc); err != nil {
+		// JSON is valid YAML as well.
+		w.Write(f.Body.Bytes())
+		return
+	}
+	writeYAMLMap(w, doc, "")
+}
+
+func formatYAML(source []byte) ([]byte, error) {
+	return source, nil
+}
+
+var plainYAMLKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// writeYAMLMap writes a map in block style, with its values which aren't
+// maps in flow style. Flow style values are written as JSON, which YAML
+// accepts.
+func writeYAMLMap(w io.Writer, m map[string]interface{}, indent string) {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		name := key
+		if !plainYAMLKey.MatchString(key) {
+			b, _ := json.Marshal(key)
+			name = string(b)
+		}
+		if nested, ok := m[key].(map[string]interface{}); ok && len(nested) > 0 {
+			fmt.Fprintf(w, "%s%s:\n", indent, name)
+			writeYAMLMap(w, nested, indent+"  ")
+			continue
+		}
+		b, _ := json.Marshal(m[key])
+		fmt.Fprintf(w, "%s%s: %s\n", indent, name, b)
+	}
+}
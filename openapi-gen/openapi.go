@@ -0,0 +1,581 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package openapi_gen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/namer"
+	"github.com/lack-io/gogogen/gogenerator/types"
+	"github.com/lack-io/gogogen/runtime/openapi"
+	"github.com/lack-io/gogogen/util/log"
+	"github.com/lack-io/gogogen/util/sets"
+)
+
+// This is the comment tag that carries parameters for schema generation.
+const tagName = "gogogen:openapi-gen"
+
+// tagValuePackage, on a package, asks for schemas of every struct and named
+// type in it.
+const tagValuePackage = "package"
+
+// Comment tags on struct fields.
+const (
+	// +optional marks a field which may be left out, even if it isn't
+	// omitempty.
+	tagOptional = "optional"
+	// +default=<value> gives the default of a field, as JSON. Values which
+	// are not valid JSON are taken as strings.
+	tagDefault = "default"
+)
+
+// openapiPackage holds the schema model the generated Go code uses.
+const openapiPackage = "github.com/lack-io/gogogen/runtime/openapi"
+
+// The file types of the standalone documents.
+const (
+	jsonFileType = "openapi-json"
+	yamlFileType = "openapi-yaml"
+)
+
+// NameSystems returns the name system used by the generators in this package.
+func NameSystems() namer.NameSystems {
+	return namer.NameSystems{
+		"public": namer.NewPublicNamer(0),
+		"raw":    namer.NewRawNamer("", nil),
+	}
+}
+
+// DefaultNameSystem returns the default name system for ordering the types to
+// be processed by the generators in this package.
+func DefaultNameSystem() string {
+	return "public"
+}
+
+// wantsSchema returns true if a schema is requested for 't', either by its
+// own tag or by the tag of its package.
+func wantsSchema(t *types.Type, ptagValue string) bool {
+	comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
+	values := types.ExtractCommentTags("+", comments)[tagName]
+	if len(values) > 1 {
+		log.Fatalf("Type %v: found %d %s tags: %q", t, len(values), tagName, values)
+	}
+	if len(values) == 1 {
+		switch values[0] {
+		case "", "true":
+			return true
+		case "false":
+			return false
+		default:
+			log.Fatalf("Type %v: unsupported %s value: %q", t, tagName, values[0])
+		}
+	}
+	return ptagValue == tagValuePackage
+}
+
+func Packages(context *generator.Context, arguments *args.GeneratorArgs) generator.Packages {
+	boilerplate, err := arguments.LoadGoBoilerplate()
+	if err != nil {
+		log.Fatalf("Failed loading boilerplate: %v", err)
+	}
+	format := arguments.CustomArgs.(*CustomArgs).Format
+
+	header := boilerplate
+	if format == FormatGo {
+		header = append(arguments.GeneratedBuildConstraint(), boilerplate...)
+	}
+	context.FileTypes[jsonFileType] = generator.DefaultFileType{
+		Format:   formatJSON,
+		Assemble: assembleJSON,
+	}
+	context.FileTypes[yamlFileType] = generator.DefaultFileType{
+		Format:   formatYAML,
+		Assemble: assembleYAML,
+	}
+
+	packages := generator.Packages{}
+	for i := range sets.NewString(context.Inputs...) {
+		log.Debugf("Considering pkg %q", i)
+		pkg := context.Universe[i]
+		if pkg == nil {
+			// If the input had no Go files, for example.
+			continue
+		}
+
+		ptagValue := ""
+		if values := types.ExtractCommentTags("+", pkg.Comments)[tagName]; len(values) > 0 {
+			ptagValue = values[0]
+			if ptagValue != tagValuePackage {
+				log.Fatalf("Package %v: unsupported %s value: %q", i, tagName, ptagValue)
+			}
+		}
+
+		requested := map[*types.Type]bool{}
+		for _, t := range pkg.SortedTypes() {
+			if (t.Kind == types.Struct || t.Kind == types.Alias) && wantsSchema(t, ptagValue) {
+				requested[t] = true
+			}
+		}
+		if len(requested) == 0 {
+			continue
+		}
+
+		log.Infof("Package %q needs generation", i)
+		packages = append(packages,
+			&generator.DefaultPackage{
+				PackageName: strings.Split(filepath.Base(pkg.Path), ".")[0],
+				PackagePath: pkg.Path,
+				HeaderText:  header,
+				GeneratorFunc: func(c *generator.Context) (generators []generator.Generator) {
+					return []generator.Generator{
+						NewGenOpenAPI(arguments.OutputFileName(pkg, "openapi"), pkg.Path, format, requested),
+					}
+				},
+				FilterFunc: func(c *generator.Context, t *types.Type) bool {
+					return t.Name.Package == pkg.Path
+				},
+			})
+	}
+	return packages
+}
+
+// genOpenAPI produces a file with the schemas of the types of a package, and
+// of the types they refer to.
+type genOpenAPI struct {
+	generator.DefaultGen
+	targetPackage string
+	format        string
+	imports       namer.ImportTracker
+	requested     map[*types.Type]bool
+	schemas       *schemaBuilder
+}
+
+func NewGenOpenAPI(sanitizedName, targetPackage, format string, requested map[*types.Type]bool) generator.Generator {
+	return &genOpenAPI{
+		DefaultGen: generator.DefaultGen{
+			OptionalName: sanitizedName,
+		},
+		targetPackage: targetPackage,
+		format:        format,
+		imports:       generator.NewImportTracker(),
+		requested:     requested,
+		schemas:       newSchemaBuilder(),
+	}
+}
+
+func (g *genOpenAPI) Filename() string {
+	return g.OptionalName + "." + g.format
+}
+
+func (g *genOpenAPI) FileType() string {
+	switch g.format {
+	case FormatJSON:
+		return jsonFileType
+	case FormatYAML:
+		return yamlFileType
+	}
+	return generator.GolangFileType
+}
+
+func (g *genOpenAPI) Namers(c *generator.Context) namer.NameSystems {
+	// Have the raw namer for this file track what it imports.
+	return namer.NameSystems{
+		"raw": namer.NewRawNamer(g.targetPackage, g.imports),
+	}
+}
+
+func (g *genOpenAPI) Filter(c *generator.Context, t *types.Type) bool {
+	return g.requested[t]
+}
+
+func (g *genOpenAPI) isOtherPackage(pkg string) bool {
+	if pkg == g.targetPackage {
+		return false
+	}
+	if strings.HasSuffix(pkg, "\""+g.targetPackage+"\"") {
+		return false
+	}
+	return true
+}
+
+func (g *genOpenAPI) Imports(c *generator.Context) (imports []string) {
+	importLines := []string{}
+	for _, singleImport := range g.imports.ImportLines() {
+		if g.isOtherPackage(singleImport) {
+			importLines = append(importLines, singleImport)
+		}
+	}
+	return importLines
+}
+
+func (g *genOpenAPI) Init(c *generator.Context, w io.Writer) error {
+	return nil
+}
+
+func (g *genOpenAPI) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	log.Infof("Generating OpenAPI schema for type %v", t)
+	g.schemas.define(c.Universe, t)
+	return nil
+}
+
+func (g *genOpenAPI) Finalize(c *generator.Context, w io.Writer) error {
+	if g.format != FormatGo {
+		b, err := json.MarshalIndent(openapi.Document{Components: openapi.Components{Schemas: g.schemas.schemas}}, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(b, '\n'))
+		return err
+	}
+
+	schemaType := c.Namers["raw"].Name(types.Ref(openapiPackage, "Schema"))
+	names := []string{}
+	for name := range g.schemas.schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sw := generator.NewSnippetWriter(w, c, "$", "$")
+	sw.Do("// OpenAPISchemas returns the OpenAPI v3 schemas of the types in this\n", nil)
+	sw.Do("// package, and of the types they refer to, keyed by their name in the\n", nil)
+	sw.Do("// components section of a document.\n", nil)
+	sw.Do("func OpenAPISchemas() map[string]*$.$ {\n", schemaType)
+	sw.Do("return map[string]*$.$ {\n", schemaType)
+	for _, name := range names {
+		sw.Do("$.name$: $.schema$,\n", generator.Args{
+			"name":   strconv.Quote(name),
+			"schema": goLiteral(g.schemas.schemas[name], schemaType, false),
+		})
+	}
+	sw.Do("}\n", nil)
+	sw.Do("}\n", nil)
+	return sw.Error()
+}
+
+// schemaBuilder converts types into schemas, defining a named schema for
+// every named type it meets.
+type schemaBuilder struct {
+	schemas map[string]*openapi.Schema
+}
+
+func newSchemaBuilder() *schemaBuilder {
+	return &schemaBuilder{schemas: map[string]*openapi.Schema{}}
+}
+
+// schemaName returns the name of the schema of the named type 't'.
+func schemaName(t *types.Type) string {
+	return strings.Replace(t.Name.Package, "/", ".", -1) + "." + t.Name.Name
+}
+
+// define adds the schema of the named type 't', and returns its name.
+func (b *schemaBuilder) define(u types.Universe, t *types.Type) string {
+	name := schemaName(t)
+	if _, ok := b.schemas[name]; ok {
+		return name
+	}
+	// Register the name first, so that recursive types terminate.
+	s := &openapi.Schema{}
+	b.schemas[name] = s
+
+	if special, ok := specialSchema(t); ok {
+		*s = *special
+	} else if t.Kind == types.Struct {
+		*s = *b.structSchema(u, t)
+	} else if t.Kind == types.Alias {
+		*s = *b.schemaFor(u, t.Underlying)
+		s.Enum = enumValues(u, t)
+	}
+	s.Description = description(t.CommentLines)
+	return name
+}
+
+// specialSchema returns the schema of types which encode themselves.
+func specialSchema(t *types.Type) (*openapi.Schema, bool) {
+	switch {
+	case t.Name.Package == "time" && t.Name.Name == "Time":
+		return &openapi.Schema{Type: "string", Format: "date-time"}, true
+	case t.Methods["MarshalJSON"] != nil:
+		// Nothing is known about what it produces.
+		return &openapi.Schema{}, true
+	case t.Methods["MarshalText"] != nil:
+		return &openapi.Schema{Type: "string"}, true
+	}
+	return nil, false
+}
+
+// schemaFor returns the schema for a value of type 't', referring to the
+// schemas of named types.
+func (b *schemaBuilder) schemaFor(u types.Universe, t *types.Type) *openapi.Schema {
+	if t.Kind == types.Builtin {
+		return builtinSchema(t)
+	}
+	if len(t.Name.Package) > 0 && (t.Kind == types.Struct || t.Kind == types.Alias) {
+		return &openapi.Schema{Ref: openapi.RefPrefix + b.define(u, t)}
+	}
+	switch t.Kind {
+	case types.Pointer:
+		return b.schemaFor(u, t.Elem)
+	case types.Slice, types.Array:
+		if t.Elem == types.Byte {
+			return &openapi.Schema{Type: "string", Format: "byte"}
+		}
+		return &openapi.Schema{Type: "array", Items: b.schemaFor(u, t.Elem)}
+	case types.Map:
+		return &openapi.Schema{Type: "object", AdditionalProperties: b.schemaFor(u, t.Elem)}
+	case types.Struct:
+		return b.structSchema(u, t)
+	}
+	// Interfaces, and anything else, may hold any value.
+	return &openapi.Schema{}
+}
+
+func builtinSchema(t *types.Type) *openapi.Schema {
+	switch t {
+	case types.String:
+		return &openapi.Schema{Type: "string"}
+	case types.Bool:
+		return &openapi.Schema{Type: "boolean"}
+	case types.Int32, types.Int16, types.Int8, types.Uint16, types.Uint8:
+		return &openapi.Schema{Type: "integer", Format: "int32"}
+	case types.Float32:
+		return &openapi.Schema{Type: "number", Format: "float"}
+	case types.Float64:
+		return &openapi.Schema{Type: "number", Format: "double"}
+	}
+	if types.IsInteger(t) {
+		return &openapi.Schema{Type: "integer", Format: "int64"}
+	}
+	return &openapi.Schema{}
+}
+
+// structSchema returns the object schema of the struct 't', with the members
+// of embedded structs promoted the way encoding/json does.
+func (b *schemaBuilder) structSchema(u types.Universe, t *types.Type) *openapi.Schema {
+	s := &openapi.Schema{Type: "object"}
+	b.addMembers(u, s, t, map[*types.Type]bool{})
+	return s
+}
+
+func (b *schemaBuilder) addMembers(u types.Universe, s *openapi.Schema, t *types.Type, visited map[*types.Type]bool) {
+	if visited[t] {
+		return
+	}
+	visited[t] = true
+	for _, m := range t.Members {
+		tag := reflect.StructTag(m.Tags).Get("json")
+		if tag == "-" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		name, omitEmpty := parts[0], false
+		for _, opt := range parts[1:] {
+			omitEmpty = omitEmpty || opt == "omitempty"
+		}
+		if m.Embedded && len(name) == 0 {
+			et := m.Type
+			if et.Kind == types.Pointer {
+				et = et.Elem
+			}
+			if et.Kind == types.Struct {
+				b.addMembers(u, s, et, visited)
+				continue
+			}
+		}
+		if namer.IsPrivateGoName(m.Name) {
+			continue
+		}
+		if len(name) == 0 {
+			name = m.Name
+		}
+		if _, ok := s.Properties[name]; ok {
+			// A shallower member already claimed the name.
+			continue
+		}
+
+		prop := b.schemaFor(u, m.Type)
+		if len(prop.Ref) == 0 {
+			prop.Description = description(m.CommentLines)
+		}
+		memberTags := types.ExtractCommentTags("+", m.CommentLines)
+		if values := memberTags[tagDefault]; len(values) > 0 {
+			var value interface{}
+			if err := json.Unmarshal([]byte(values[0]), &value); err != nil {
+				value = values[0]
+			}
+			prop.Default = value
+		}
+		if s.Properties == nil {
+			s.Properties = map[string]*openapi.Schema{}
+		}
+		s.Properties[name] = prop
+		if _, optional := memberTags[tagOptional]; !optional && !omitEmpty {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// enumValues returns the values of the constants of the named type 't', or
+// nil if there are none.
+func enumValues(u types.Universe, t *types.Type) []interface{} {
+	pkg := u[t.Name.Package]
+	if pkg == nil {
+		return nil
+	}
+	var values []string
+	for _, c := range pkg.SortedConstants() {
+		if c.Underlying == t && c.ConstValue != nil {
+			values = append(values, *c.ConstValue)
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	enum := []interface{}{}
+	if t.Underlying == types.String {
+		sort.Strings(values)
+		for _, v := range values {
+			enum = append(enum, v)
+		}
+		return enum
+	}
+	numbers := []json.Number{}
+	for _, v := range values {
+		if _, err := strconv.ParseFloat(v, 64); err != nil {
+			// Not representable, such as a fraction.
+			return nil
+		}
+		numbers = append(numbers, json.Number(v))
+	}
+	sort.Slice(numbers, func(i, j int) bool {
+		a, _ := strconv.ParseFloat(string(numbers[i]), 64)
+		b, _ := strconv.ParseFloat(string(numbers[j]), 64)
+		return a < b
+	})
+	for _, n := range numbers {
+		enum = append(enum, n)
+	}
+	return enum
+}
+
+// description returns the comment lines which aren't comment tags.
+func description(lines []string) string {
+	var text []string
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "+") {
+			continue
+		}
+		text = append(text, line)
+	}
+	return strings.TrimSpace(strings.Join(text, "\n"))
+}
+
+// goLiteral returns the Go composite literal of 's'. The type is left out
+// where it can be elided.
+func goLiteral(s *openapi.Schema, schemaType string, withType bool) string {
+	b := &bytes.Buffer{}
+	if withType {
+		b.WriteString("&" + schemaType)
+	}
+	b.WriteString("{\n")
+	field := func(name, value string) {
+		fmt.Fprintf(b, "%s: %s,\n", name, value)
+	}
+	str := func(name, value string) {
+		if len(value) > 0 {
+			field(name, strconv.Quote(value))
+		}
+	}
+	str("Ref", s.Ref)
+	str("Description", s.Description)
+	str("Type", s.Type)
+	str("Format", s.Format)
+	if len(s.Properties) > 0 {
+		names := []string{}
+		for name := range s.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(b, "Properties: map[string]*%s{\n", schemaType)
+		for _, name := range names {
+			fmt.Fprintf(b, "%s: %s,\n", strconv.Quote(name), goLiteral(s.Properties[name], schemaType, false))
+		}
+		b.WriteString("},\n")
+	}
+	if len(s.Required) > 0 {
+		quoted := []string{}
+		for _, name := range s.Required {
+			quoted = append(quoted, strconv.Quote(name))
+		}
+		field("Required", "[]string{"+strings.Join(quoted, ", ")+"}")
+	}
+	if s.Items != nil {
+		field("Items", goLiteral(s.Items, schemaType, true))
+	}
+	if s.AdditionalProperties != nil {
+		field("AdditionalProperties", goLiteral(s.AdditionalProperties, schemaType, true))
+	}
+	if len(s.Enum) > 0 {
+		field("Enum", goValue(s.Enum))
+	}
+	if s.Default != nil {
+		field("Default", goValue(s.Default))
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// goValue returns the Go expression of a decoded JSON value.
+func goValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "nil"
+	case string:
+		return strconv.Quote(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case json.Number:
+		return v.String()
+	case []interface{}:
+		items := []string{}
+		for _, item := range v {
+			items = append(items, goValue(item))
+		}
+		return "[]interface{}{" + strings.Join(items, ", ") + "}"
+	case map[string]interface{}:
+		keys := []string{}
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		items := []string{}
+		for _, key := range keys {
+			items = append(items, strconv.Quote(key)+": "+goValue(v[key]))
+		}
+		return "map[string]interface{}{" + strings.Join(items, ", ") + "}"
+	}
+	return fmt.Sprintf("%#v", v)
+}
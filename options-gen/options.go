@@ -0,0 +1,421 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package options_gen
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/namer"
+	"github.com/lack-io/gogogen/gogenerator/types"
+	"github.com/lack-io/gogogen/util/log"
+	"github.com/lack-io/gogogen/util/sets"
+)
+
+// These are the comment tags that carry parameters for options generation.
+const (
+	tagName = "gogogen:options"
+	// The name of the option type, Option by default.
+	optionTypeTagName = tagName + ":option-type"
+	// The prefix of the option functions, With by default.
+	prefixTagName = tagName + ":prefix"
+
+	// +default=<value>, on a field, gives its value in the constructor, as
+	// JSON. Values which are not valid JSON are taken as strings.
+	defaultTagName = "default"
+)
+
+func extractTag(name string, t *types.Type) []string {
+	comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
+	return types.ExtractCommentTags("+", comments)[name]
+}
+
+// boolTag returns the value of a true/false tag, or 'def' if it is not set.
+func boolTag(values []string, def bool, where string) bool {
+	if len(values) > 1 {
+		log.Fatalf("%s: found %d %s tags: %q", where, len(values), tagName, values)
+	}
+	if len(values) == 0 {
+		return def
+	}
+	switch values[0] {
+	case "", "true":
+		return true
+	case "false":
+		return false
+	}
+	log.Fatalf("%s: unsupported %s value: %q", where, tagName, values[0])
+	return false
+}
+
+// stringTag returns the value of a tag, or 'def' if it is not set.
+func stringTag(t *types.Type, name, def string) string {
+	values := extractTag(name, t)
+	if len(values) > 1 {
+		log.Fatalf("Type %v: found %d %s tags: %q", t, len(values), name, values)
+	}
+	if len(values) == 0 {
+		return def
+	}
+	return values[0]
+}
+
+// NameSystems returns the name system used by the generators in this package.
+func NameSystems() namer.NameSystems {
+	return namer.NameSystems{
+		"public": namer.NewPublicNamer(0),
+		"raw":    namer.NewRawNamer("", nil),
+	}
+}
+
+// DefaultNameSystem returns the default name system for ordering the types to
+// be processed by the generators in this package.
+func DefaultNameSystem() string {
+	return "public"
+}
+
+// option is a field which can be set by an option.
+type option struct {
+	Member types.Member
+	// The name of the option function.
+	Func string
+	// The default, as JSON, if any.
+	Default *string
+}
+
+// optionsType is a struct along with its options.
+type optionsType struct {
+	// The names of the option type and of the constructor.
+	OptionType  string
+	Constructor string
+	Options     []option
+}
+
+// findOptions returns the option types of the structs of 'pkg', indexed by
+// type.
+func findOptions(pkg *types.Package) map[*types.Type]*optionsType {
+	found := map[*types.Type]*optionsType{}
+	// The type declaring each generated name, to report collisions.
+	declared := map[string]*types.Type{}
+	declare := func(t *types.Type, name string) {
+		if other, ok := declared[name]; ok && other != t {
+			log.Fatalf("Type %v: %s is generated for %v too, use %s or %s to rename one", t, name, other, optionTypeTagName, prefixTagName)
+		}
+		if _, ok := pkg.Types[name]; ok {
+			log.Fatalf("Type %v: %s is already declared in the package, use %s or %s to rename it", t, name, optionTypeTagName, prefixTagName)
+		}
+		declared[name] = t
+	}
+
+	for _, t := range pkg.SortedTypes() {
+		if t.Kind != types.Struct || !boolTag(extractTag(tagName, t), false, fmt.Sprintf("Type %v", t)) {
+			continue
+		}
+		o := &optionsType{
+			OptionType:  stringTag(t, optionTypeTagName, "Option"),
+			Constructor: "New" + t.Name.Name,
+		}
+		prefix := stringTag(t, prefixTagName, "With")
+		declare(t, o.OptionType)
+		if _, ok := pkg.Functions[o.Constructor]; ok {
+			log.Fatalf("Type %v: %s is already declared in the package", t, o.Constructor)
+		}
+		declare(t, o.Constructor)
+
+		for _, m := range t.Members {
+			where := fmt.Sprintf("Type %v, field %s", t, m.Name)
+			tags := types.ExtractCommentTags("+", m.CommentLines)
+			if !boolTag(tags[tagName], true, where) {
+				continue
+			}
+			if !isNameable(m.Type) {
+				log.Warnf("%s: not generating an option, as the type of the field can't be written", where)
+				continue
+			}
+			opt := option{
+				Member: m,
+				Func:   prefix + strings.ToUpper(m.Name[:1]) + m.Name[1:],
+			}
+			if values := tags[defaultTagName]; len(values) > 0 {
+				opt.Default = &values[0]
+			}
+			if _, ok := pkg.Functions[opt.Func]; ok {
+				log.Fatalf("%s: %s is already declared in the package", where, opt.Func)
+			}
+			declare(t, opt.Func)
+			o.Options = append(o.Options, opt)
+		}
+		found[t] = o
+	}
+	return found
+}
+
+// isNameable returns false for the types the raw namer can't write, which are
+// anonymous arrays, as the parser doesn't record their length.
+func isNameable(t *types.Type) bool {
+	if len(t.Name.Package) > 0 {
+		return true
+	}
+	switch t.Kind {
+	case types.Array:
+		return false
+	case types.Pointer, types.Slice, types.Chan:
+		return isNameable(t.Elem)
+	case types.Map:
+		return isNameable(t.Key) && isNameable(t.Elem)
+	}
+	return true
+}
+
+func Packages(context *generator.Context, arguments *args.GeneratorArgs) generator.Packages {
+	boilerplate, err := arguments.LoadGoBoilerplate()
+	if err != nil {
+		log.Fatalf("Failed loading boilerplate: %v", err)
+	}
+
+	packages := generator.Packages{}
+	header := append(arguments.GeneratedBuildConstraint(), boilerplate...)
+
+	for i := range sets.NewString(context.Inputs...) {
+		log.Debugf("Considering pkg %q", i)
+		pkg := context.Universe[i]
+		if pkg == nil {
+			// If the input had no Go files, for example.
+			continue
+		}
+
+		options := findOptions(pkg)
+		if len(options) == 0 {
+			continue
+		}
+
+		log.Infof("Package %q needs generation", i)
+		packages = append(packages,
+			&generator.DefaultPackage{
+				PackageName: strings.Split(filepath.Base(pkg.Path), ".")[0],
+				PackagePath: pkg.Path,
+				HeaderText:  header,
+				GeneratorFunc: func(c *generator.Context) (generators []generator.Generator) {
+					return []generator.Generator{
+						NewGenOptions(arguments.OutputFileName(pkg, "options"), pkg.Path, options),
+					}
+				},
+				FilterFunc: func(c *generator.Context, t *types.Type) bool {
+					return t.Name.Package == pkg.Path
+				},
+			})
+	}
+	return packages
+}
+
+// genOptions produces a file with the options and constructors of the
+// structs of a package.
+type genOptions struct {
+	generator.DefaultGen
+	targetPackage string
+	imports       namer.ImportTracker
+	options       map[*types.Type]*optionsType
+}
+
+func NewGenOptions(sanitizedName, targetPackage string, options map[*types.Type]*optionsType) generator.Generator {
+	return &genOptions{
+		DefaultGen: generator.DefaultGen{
+			OptionalName: sanitizedName,
+		},
+		targetPackage: targetPackage,
+		imports:       generator.NewImportTracker(),
+		options:       options,
+	}
+}
+
+func (g *genOptions) Namers(c *generator.Context) namer.NameSystems {
+	// Have the raw namer for this file track what it imports.
+	return namer.NameSystems{
+		"raw": namer.NewRawNamer(g.targetPackage, g.imports),
+	}
+}
+
+func (g *genOptions) Filter(c *generator.Context, t *types.Type) bool {
+	_, ok := g.options[t]
+	return ok
+}
+
+func (g *genOptions) isOtherPackage(pkg string) bool {
+	if pkg == g.targetPackage {
+		return false
+	}
+	if strings.HasSuffix(pkg, "\""+g.targetPackage+"\"") {
+		return false
+	}
+	return true
+}
+
+func (g *genOptions) Imports(c *generator.Context) (imports []string) {
+	importLines := []string{}
+	for _, singleImport := range g.imports.ImportLines() {
+		if g.isOtherPackage(singleImport) {
+			importLines = append(importLines, singleImport)
+		}
+	}
+	return importLines
+}
+
+// fieldDefault is a field set by the constructor.
+type fieldDefault struct {
+	Name  string
+	Value string
+}
+
+func (g *genOptions) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	log.Infof("Generating options for type %v", t)
+
+	o := g.options[t]
+	defaults := []fieldDefault{}
+	for _, opt := range o.Options {
+		if opt.Default == nil {
+			continue
+		}
+		value, err := goDefault(c.Namers["raw"], opt.Member.Type, *opt.Default)
+		if err != nil {
+			return fmt.Errorf("type %v, field %s: invalid default %q: %v", t, opt.Member.Name, *opt.Default, err)
+		}
+		defaults = append(defaults, fieldDefault{Name: opt.Member.Name, Value: value})
+	}
+
+	sw := generator.NewSnippetWriter(w, c, "$", "$")
+	args := generator.Args{
+		"type":        t,
+		"optionType":  o.OptionType,
+		"constructor": o.Constructor,
+		"defaults":    defaults,
+	}
+	sw.Do(constructorCode, args)
+	for _, opt := range o.Options {
+		args["func"] = opt.Func
+		args["field"] = opt.Member.Name
+		args["member"] = opt.Member.Type
+		sw.Do(optionCode, args)
+	}
+	return sw.Error()
+}
+
+// goDefault returns the Go expression of the default 'value', given as JSON,
+// of a field of type 't'. Values which are not valid JSON are taken as
+// strings.
+func goDefault(raw namer.Namer, t *types.Type, value string) (string, error) {
+	var v interface{}
+	d := json.NewDecoder(strings.NewReader(value))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		v = value
+	}
+	return goValue(raw, t, v)
+}
+
+// goValue returns the Go expression assigning the decoded JSON value 'v' to
+// a variable of type 't'.
+func goValue(raw namer.Namer, t *types.Type, v interface{}) (string, error) {
+	u := t
+	if u.Kind == types.Alias {
+		u = u.Underlying
+	}
+	switch v := v.(type) {
+	case string:
+		if u == types.String {
+			return strconv.Quote(v), nil
+		}
+	case bool:
+		if u == types.Bool {
+			return strconv.FormatBool(v), nil
+		}
+	case json.Number:
+		if types.IsInteger(u) {
+			if _, err := strconv.ParseInt(v.String(), 10, 64); err != nil {
+				if _, err := strconv.ParseUint(v.String(), 10, 64); err != nil {
+					return "", fmt.Errorf("%s is not an integer", v)
+				}
+			}
+			return v.String(), nil
+		}
+		if u == types.Float32 || u == types.Float64 {
+			return v.String(), nil
+		}
+	case []interface{}:
+		if u.Kind == types.Slice {
+			items := []string{}
+			for _, item := range v {
+				s, err := goValue(raw, u.Elem, item)
+				if err != nil {
+					return "", err
+				}
+				items = append(items, s)
+			}
+			return raw.Name(t) + "{" + strings.Join(items, ", ") + "}", nil
+		}
+	case map[string]interface{}:
+		if u.Kind == types.Map && (u.Key == types.String || u.Key.Kind == types.Alias && u.Key.Underlying == types.String) {
+			keys := []string{}
+			for key := range v {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			items := []string{}
+			for _, key := range keys {
+				s, err := goValue(raw, u.Elem, v[key])
+				if err != nil {
+					return "", err
+				}
+				items = append(items, strconv.Quote(key)+": "+s)
+			}
+			return raw.Name(t) + "{" + strings.Join(items, ", ") + "}", nil
+		}
+	}
+	return "", fmt.Errorf("a %T can't be assigned to a %s", v, raw.Name(t))
+}
+
+var constructorCode = `// $.optionType$ sets a field of a $.type|raw$ built by $.constructor$.
+type $.optionType$ func(*$.type|raw$)
+
+// $.constructor$ returns a $.type|raw$ with its defaults set, and then the given
+// options applied.
+func $.constructor$(opts ...$.optionType$) *$.type|raw$ {
+	x := &$.type|raw${
+		$- range .defaults$
+		$.Name$: $.Value$,
+		$- end$
+	}
+	for _, opt := range opts {
+		opt(x)
+	}
+	return x
+}
+
+`
+
+var optionCode = `// $.func$ returns an option setting the $.field$ field of a $.type|raw$.
+func $.func$(v $.member|raw$) $.optionType$ {
+	return func(x *$.type|raw$) {
+		x.$.field$ = v
+	}
+}
+
+`
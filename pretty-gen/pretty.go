@@ -0,0 +1,465 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pretty_gen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/namer"
+	"github.com/lack-io/gogogen/gogenerator/types"
+	"github.com/lack-io/gogogen/util/log"
+	"github.com/lack-io/gogogen/util/sets"
+)
+
+// These are the comment tags that carry parameters for String generation.
+const (
+	tagName         = "gogogen:pretty-gen"
+	maxItemsTagName = tagName + ":max-items"
+
+	// secretTagName, on a field or a type, has its values redacted.
+	secretTagName = "gogogen:secret"
+
+	// tagValuePackage, on a package, asks for String methods on every
+	// struct in it.
+	tagValuePackage = "package"
+)
+
+// prettyutilPackage holds the Printer the generated code writes to.
+const prettyutilPackage = "github.com/lack-io/gogogen/runtime/prettyutil"
+
+// NameSystems returns the name system used by the generators in this package.
+func NameSystems() namer.NameSystems {
+	return namer.NameSystems{
+		"public": namer.NewPublicNamer(0),
+		"raw":    namer.NewRawNamer("", nil),
+	}
+}
+
+// DefaultNameSystem returns the default name system for ordering the types to
+// be processed by the generators in this package.
+func DefaultNameSystem() string {
+	return "public"
+}
+
+// boolTag returns the value of a true/false tag, or 'def' if it is not set.
+func boolTag(values []string, def bool, where, name string) bool {
+	if len(values) > 1 {
+		log.Fatalf("%s: found %d %s tags: %q", where, len(values), name, values)
+	}
+	if len(values) == 0 {
+		return def
+	}
+	switch values[0] {
+	case "", "true":
+		return true
+	case "false":
+		return false
+	}
+	log.Fatalf("%s: unsupported %s value: %q", where, name, values[0])
+	return false
+}
+
+func extractTag(name string, t *types.Type) []string {
+	comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
+	return types.ExtractCommentTags("+", comments)[name]
+}
+
+// maxItemsOf returns the number of items String shows for values of 't'.
+func maxItemsOf(t *types.Type, def int) int {
+	values := extractTag(maxItemsTagName, t)
+	if len(values) == 0 {
+		return def
+	}
+	maxItems, err := strconv.Atoi(values[0])
+	if len(values) > 1 || err != nil {
+		log.Fatalf("Type %v: invalid %s tags: %q", t, maxItemsTagName, values)
+	}
+	return maxItems
+}
+
+// requestedTypes returns the types of 'pkg' String methods are requested for.
+func requestedTypes(pkg *types.Package) map[*types.Type]bool {
+	ptagValue := ""
+	if values := types.ExtractCommentTags("+", pkg.Comments)[tagName]; len(values) > 0 {
+		ptagValue = values[0]
+		if ptagValue != tagValuePackage {
+			log.Fatalf("Package %v: unsupported %s value: %q", pkg.Path, tagName, ptagValue)
+		}
+	}
+	requested := map[*types.Type]bool{}
+	for _, t := range pkg.SortedTypes() {
+		if t.Kind != types.Struct || !boolTag(extractTag(tagName, t), ptagValue == tagValuePackage, fmt.Sprintf("Type %v", t), tagName) {
+			continue
+		}
+		if t.Methods["String"] != nil {
+			log.Warnf("Type %v: not generating String, which is already defined", t)
+			continue
+		}
+		requested[t] = true
+	}
+	return requested
+}
+
+func Packages(context *generator.Context, arguments *args.GeneratorArgs) generator.Packages {
+	boilerplate, err := arguments.LoadGoBoilerplate()
+	if err != nil {
+		log.Fatalf("Failed loading boilerplate: %v", err)
+	}
+	maxItems := arguments.CustomArgs.(*CustomArgs).MaxItems
+
+	packages := generator.Packages{}
+	header := append(arguments.GeneratedBuildConstraint(), boilerplate...)
+
+	// Find every type with a String method first, so that the methods can
+	// write to each other's Printer across the input packages.
+	requested := map[string]map[*types.Type]bool{}
+	pretty := map[*types.Type]bool{}
+	for i := range sets.NewString(context.Inputs...) {
+		log.Debugf("Considering pkg %q", i)
+		pkg := context.Universe[i]
+		if pkg == nil {
+			// If the input had no Go files, for example.
+			continue
+		}
+		if pkgRequested := requestedTypes(pkg); len(pkgRequested) > 0 {
+			requested[i] = pkgRequested
+			for t := range pkgRequested {
+				pretty[t] = true
+			}
+		}
+	}
+
+	for i := range requested {
+		pkg := context.Universe[i]
+		log.Infof("Package %q needs generation", i)
+		packages = append(packages,
+			&generator.DefaultPackage{
+				PackageName: strings.Split(filepath.Base(pkg.Path), ".")[0],
+				PackagePath: pkg.Path,
+				HeaderText:  header,
+				GeneratorFunc: func(c *generator.Context) (generators []generator.Generator) {
+					return []generator.Generator{
+						NewGenPretty(arguments.OutputFileName(pkg, "pretty"), pkg.Path, requested[pkg.Path], pretty, maxItems),
+					}
+				},
+				FilterFunc: func(c *generator.Context, t *types.Type) bool {
+					return t.Name.Package == pkg.Path
+				},
+			})
+	}
+	return packages
+}
+
+// genPretty produces a file with the String methods of the types of a
+// package.
+type genPretty struct {
+	generator.DefaultGen
+	targetPackage string
+	imports       namer.ImportTracker
+	requested     map[*types.Type]bool
+	pretty        map[*types.Type]bool
+	maxItems      int
+}
+
+func NewGenPretty(sanitizedName, targetPackage string, requested, pretty map[*types.Type]bool, maxItems int) generator.Generator {
+	return &genPretty{
+		DefaultGen: generator.DefaultGen{
+			OptionalName: sanitizedName,
+		},
+		targetPackage: targetPackage,
+		imports:       generator.NewImportTracker(),
+		requested:     requested,
+		pretty:        pretty,
+		maxItems:      maxItems,
+	}
+}
+
+func (g *genPretty) Namers(c *generator.Context) namer.NameSystems {
+	// Have the raw namer for this file track what it imports.
+	return namer.NameSystems{
+		"raw": namer.NewRawNamer(g.targetPackage, g.imports),
+	}
+}
+
+func (g *genPretty) Filter(c *generator.Context, t *types.Type) bool {
+	return g.requested[t]
+}
+
+func (g *genPretty) isOtherPackage(pkg string) bool {
+	if pkg == g.targetPackage {
+		return false
+	}
+	if strings.HasSuffix(pkg, "\""+g.targetPackage+"\"") {
+		return false
+	}
+	return true
+}
+
+func (g *genPretty) Imports(c *generator.Context) (imports []string) {
+	importLines := []string{}
+	for _, singleImport := range g.imports.ImportLines() {
+		if g.isOtherPackage(singleImport) {
+			importLines = append(importLines, singleImport)
+		}
+	}
+	return importLines
+}
+
+// hasString returns true if values of 't' have a String() string method of
+// their own, with a value receiver so that it can be called on any of them.
+func hasString(t *types.Type) bool {
+	if t.Kind == types.Interface || t.Kind == types.Pointer {
+		return false
+	}
+	m := t.Methods["String"]
+	if m == nil || m.Signature == nil {
+		return false
+	}
+	sig := m.Signature
+	if sig.Receiver != nil && sig.Receiver.Kind == types.Pointer {
+		return false
+	}
+	return len(sig.Parameters) == 0 && len(sig.Results) == 1 && sig.Results[0] == types.String
+}
+
+// isSecret returns true if the values of 't' are redacted.
+func isSecret(t *types.Type) bool {
+	return t.Kind != types.Builtin && boolTag(extractTag(secretTagName, t), false, fmt.Sprintf("Type %v", t), secretTagName)
+}
+
+// canBeNil returns true if values of 't' can be nil, in which case they are
+// left out of the structs they are fields of.
+func canBeNil(t *types.Type) bool {
+	if t.Kind == types.Alias {
+		t = t.Underlying
+	}
+	switch t.Kind {
+	case types.Pointer, types.Interface, types.Slice, types.Map, types.Func, types.Chan:
+		return true
+	}
+	return false
+}
+
+// prettyWriter writes the body of a FormatTo method.
+type prettyWriter struct {
+	g   *genPretty
+	b   *bytes.Buffer
+	raw namer.Namer
+	// The depth of nested loops, to name their variables.
+	depth int
+	// The structs being written inline, which are written with Value
+	// rather than again if they are met within themselves.
+	inline map[*types.Type]bool
+}
+
+func (pw *prettyWriter) printf(format string, args ...interface{}) {
+	fmt.Fprintf(pw.b, format, args...)
+}
+
+// format writes the statements writing 'expr', of type 't', to the Printer
+// p; 'notNil' tells that it was checked not to be nil. Within the type being
+// generated, named types are written by their structure rather than by their
+// FormatTo method, which is theirs.
+func (pw *prettyWriter) format(expr string, t *types.Type, top, notNil bool) {
+	switch {
+	case isSecret(t):
+		pw.printf("p.Redact()\n")
+		return
+	case !top && pw.g.pretty[t]:
+		pw.printf("%s.FormatTo(p)\n", expr)
+		return
+	case hasString(t):
+		pw.printf("p.Text(%s.String())\n", expr)
+		return
+	}
+	u := t
+	if u.Kind == types.Alias {
+		u = u.Underlying
+	}
+	switch u.Kind {
+	case types.Builtin:
+		pw.builtin(expr, t, u)
+	case types.Pointer:
+		if notNil {
+			pw.format("(*"+expr+")", u.Elem, false, false)
+			return
+		}
+		pw.printf("if %s == nil {\np.Nil()\n} else {\n", expr)
+		pw.format("(*"+expr+")", u.Elem, false, false)
+		pw.printf("}\n")
+	case types.Slice, types.Array:
+		if u.Kind == types.Slice && u.Elem == types.Byte {
+			pw.printf("p.Bytes(%s)\n", convert("[]byte", expr, t))
+			return
+		}
+		check := u.Kind == types.Slice && !notNil
+		if check {
+			pw.printf("if %s == nil {\np.Nil()\n} else {\n", expr)
+		}
+		pw.printf("p.BeginList(len(%s))\n", expr)
+		if isSecret(u.Elem) {
+			pw.printf("for range %s {\nif !p.Item() {\nbreak\n}\np.Redact()\n}\n", expr)
+		} else {
+			i := fmt.Sprintf("i%d", pw.depth)
+			pw.depth++
+			pw.printf("for %s := range %s {\nif !p.Item() {\nbreak\n}\n", i, expr)
+			pw.format(expr+"["+i+"]", u.Elem, false, false)
+			pw.printf("}\n")
+			pw.depth--
+		}
+		pw.printf("p.EndList()\n")
+		if check {
+			pw.printf("}\n")
+		}
+	case types.Map:
+		// Secret keys and values are redacted without being looked at.
+		k, v := fmt.Sprintf("k%d", pw.depth), fmt.Sprintf("v%d", pw.depth)
+		if isSecret(u.Key) {
+			k = "_"
+		}
+		if isSecret(u.Elem) {
+			v = "_"
+		}
+		pw.depth++
+		if !notNil {
+			pw.printf("if %s == nil {\np.Nil()\n} else {\n", expr)
+		}
+		pw.printf("p.BeginMap()\nfor %s, %s := range %s {\np.Key()\n", k, v, expr)
+		pw.format(k, u.Key, false, false)
+		pw.printf("p.Elem()\n")
+		pw.format(v, u.Elem, false, false)
+		pw.printf("}\np.EndMap()\n")
+		if !notNil {
+			pw.printf("}\n")
+		}
+		pw.depth--
+	case types.Struct:
+		if !top && (pw.inline[t] || len(t.Name.Package) > 0 && t.Name.Package != pw.g.targetPackage) {
+			// Structs of other packages without String methods.
+			pw.printf("p.Value(%s)\n", unparen(expr))
+			return
+		}
+		pw.inline[t] = true
+		// Anonymous structs go without a name.
+		name := ""
+		if t.Kind != types.Struct || len(t.Name.Package) > 0 {
+			name = pw.raw.Name(t)
+		}
+		pw.printf("p.BeginStruct(%q)\n", name)
+		pw.members(expr, t, u)
+		pw.printf("p.EndStruct()\n")
+		delete(pw.inline, t)
+	default:
+		// Interfaces, functions and channels.
+		pw.printf("p.Value(%s)\n", unparen(expr))
+	}
+}
+
+// members writes the fields of 'expr', a struct of type 't', leaving out
+// those that are nil or opted out.
+func (pw *prettyWriter) members(expr string, t, u *types.Type) {
+	for _, m := range u.Members {
+		if m.Name == "_" {
+			continue
+		}
+		where := fmt.Sprintf("Type %v, field %s", t, m.Name)
+		tags := types.ExtractCommentTags("+", m.CommentLines)
+		if !boolTag(tags[tagName], true, where, tagName) {
+			continue
+		}
+		field := expr + "." + m.Name
+		nilable := canBeNil(m.Type)
+		if nilable {
+			pw.printf("if %s != nil {\n", field)
+		}
+		pw.printf("p.Field(%q)\n", m.Name)
+		if boolTag(tags[secretTagName], false, where, secretTagName) {
+			pw.printf("p.Redact()\n")
+		} else {
+			pw.format(field, m.Type, false, nilable)
+		}
+		if nilable {
+			pw.printf("}\n")
+		}
+	}
+}
+
+// builtin writes 'expr', of type 't', whose underlying type 'u' is builtin.
+func (pw *prettyWriter) builtin(expr string, t, u *types.Type) {
+	switch name := u.Name.Name; {
+	case name == "string":
+		pw.printf("p.Quote(%s)\n", convert("string", expr, t))
+	case name == "bool":
+		pw.printf("p.Bool(%s)\n", convert("bool", expr, t))
+	case name == "float32" || name == "float64":
+		pw.printf("p.Float(%s, %s)\n", convert("float64", expr, t), strings.TrimPrefix(name, "float"))
+	case strings.HasPrefix(name, "uint") || name == "byte":
+		pw.printf("p.Uint(%s)\n", convert("uint64", expr, t))
+	case strings.HasPrefix(name, "int") || name == "rune":
+		pw.printf("p.Int(%s)\n", convert("int64", expr, t))
+	default:
+		// Complex numbers, and unsafe pointers.
+		pw.printf("p.Value(%s)\n", unparen(expr))
+	}
+}
+
+// convert returns 'expr', of type 't', converted to the builtin 'to'.
+func convert(to, expr string, t *types.Type) string {
+	if t.Kind == types.Builtin && t.Name.Name == to {
+		return expr
+	}
+	return to + "(" + unparen(expr) + ")"
+}
+
+// unparen removes the parentheses around a dereference, where it is an
+// argument and doesn't need them.
+func unparen(expr string) string {
+	if strings.HasPrefix(expr, "(*") && strings.HasSuffix(expr, ")") {
+		return expr[1 : len(expr)-1]
+	}
+	return expr
+}
+
+func (g *genPretty) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	log.Infof("Generating String for type %v", t)
+
+	pw := &prettyWriter{g: g, b: &bytes.Buffer{}, raw: c.Namers["raw"], inline: map[*types.Type]bool{}}
+	name := pw.raw.Name(t)
+	maxItems := maxItemsOf(t, g.maxItems)
+	pw.printf("// String returns x in a readable form, leaving out nil fields, showing\n")
+	if maxItems > 0 {
+		pw.printf("// at most %d items of every slice, array and map, and redacting secrets.\n", maxItems)
+	} else {
+		pw.printf("// every item of slices, arrays and maps, and redacting secrets.\n")
+	}
+	pw.printf("func (x %s) String() string {\n", name)
+	pw.printf("p := %s(%d)\n", pw.raw.Name(types.Ref(prettyutilPackage, "NewPrinter")), maxItems)
+	pw.printf("x.FormatTo(p)\nreturn p.String()\n}\n\n")
+
+	pw.printf("// FormatTo writes x to p, as String does.\n")
+	pw.printf("func (x %s) FormatTo(p *%s) {\n", name, pw.raw.Name(types.Ref(prettyutilPackage, "Printer")))
+	pw.format("x", t, true, false)
+	pw.printf("}\n\n")
+
+	_, err := w.Write(pw.b.Bytes())
+	return err
+}
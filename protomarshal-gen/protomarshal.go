@@ -0,0 +1,918 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package protomarshal_gen
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/namer"
+	"github.com/lack-io/gogogen/gogenerator/types"
+	"github.com/lack-io/gogogen/util/log"
+	"github.com/lack-io/gogogen/util/sets"
+)
+
+// This is the comment tag that carries parameters for protobuf generation.
+const tagName = "gogogen:protomarshal-gen"
+
+// tagValuePackage, on a package, asks for protobuf methods for every struct
+// type in it.
+const tagValuePackage = "package"
+
+// protoutilPackage holds the helpers the generated code calls.
+const protoutilPackage = "github.com/lack-io/gogogen/runtime/protoutil"
+
+// NameSystems returns the name system used by the generators in this package.
+func NameSystems() namer.NameSystems {
+	return namer.NameSystems{
+		"public": namer.NewPublicNamer(0),
+		"raw":    namer.NewRawNamer("", nil),
+	}
+}
+
+// DefaultNameSystem returns the default name system for ordering the types to
+// be processed by the generators in this package.
+func DefaultNameSystem() string {
+	return "public"
+}
+
+// wantsMarshal returns true if protobuf methods are requested for 't',
+// either by its own tag or by the tag of its package.
+func wantsMarshal(t *types.Type, ptagValue string) bool {
+	comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
+	values := types.ExtractCommentTags("+", comments)[tagName]
+	if len(values) > 1 {
+		log.Fatalf("Type %v: found %d %s tags: %q", t, len(values), tagName, values)
+	}
+	if len(values) == 1 {
+		switch values[0] {
+		case "", "true":
+			return true
+		case "false":
+			return false
+		default:
+			log.Fatalf("Type %v: unsupported %s value: %q", t, tagName, values[0])
+		}
+	}
+	return ptagValue == tagValuePackage
+}
+
+func Packages(context *generator.Context, arguments *args.GeneratorArgs) generator.Packages {
+	boilerplate, err := arguments.LoadGoBoilerplate()
+	if err != nil {
+		log.Fatalf("Failed loading boilerplate: %v", err)
+	}
+
+	packages := generator.Packages{}
+	header := append(arguments.GeneratedBuildConstraint(), boilerplate...)
+
+	for i := range sets.NewString(context.Inputs...) {
+		log.Debugf("Considering pkg %q", i)
+		pkg := context.Universe[i]
+		if pkg == nil {
+			// If the input had no Go files, for example.
+			continue
+		}
+
+		ptagValue := ""
+		if values := types.ExtractCommentTags("+", pkg.Comments)[tagName]; len(values) > 0 {
+			ptagValue = values[0]
+			if ptagValue != tagValuePackage {
+				log.Fatalf("Package %v: unsupported %s value: %q", i, tagName, ptagValue)
+			}
+		}
+
+		structs := map[*types.Type]bool{}
+		for _, t := range pkg.SortedTypes() {
+			if t.Kind == types.Struct && wantsMarshal(t, ptagValue) {
+				structs[t] = true
+			}
+		}
+		if len(structs) == 0 {
+			continue
+		}
+
+		log.Infof("Package %q needs generation", i)
+		packages = append(packages,
+			&generator.DefaultPackage{
+				PackageName: strings.Split(filepath.Base(pkg.Path), ".")[0],
+				PackagePath: pkg.Path,
+				HeaderText:  header,
+				GeneratorFunc: func(c *generator.Context) (generators []generator.Generator) {
+					return []generator.Generator{
+						NewGenProtoMarshal(arguments.OutputFileName(pkg, "protomarshal"), pkg.Path, structs),
+					}
+				},
+				FilterFunc: func(c *generator.Context, t *types.Type) bool {
+					return t.Name.Package == pkg.Path
+				},
+			})
+	}
+	return packages
+}
+
+// encoding is how a scalar value is written: one of the wire types of a
+// protobuf struct tag, refined by the Go type.
+type encoding string
+
+const (
+	encVarint   encoding = "varint"
+	encZigzag32 encoding = "zigzag32"
+	encZigzag64 encoding = "zigzag64"
+	encFixed32  encoding = "fixed32"
+	encFixed64  encoding = "fixed64"
+	encBool     encoding = "bool"
+	encFloat32  encoding = "float32"
+	encFloat64  encoding = "float64"
+	encString   encoding = "string"
+	encBytes    encoding = "bytes"
+)
+
+// wireType returns the protobuf wire type of values encoded as 'e'.
+func (e encoding) wireType() int {
+	switch e {
+	case encFixed64, encFloat64:
+		return 1
+	case encString, encBytes:
+		return 2
+	case encFixed32, encFloat32:
+		return 5
+	}
+	return 0
+}
+
+// wireTypeName returns the protoutil constant of the wire type of 'e'.
+func (e encoding) wireTypeName() string {
+	return map[int]string{0: "WireVarint", 1: "WireFixed64", 2: "WireBytes", 5: "WireFixed32"}[e.wireType()]
+}
+
+// fixedSize returns the size of values encoded as 'e', or 0 if it varies.
+func (e encoding) fixedSize() int {
+	switch e {
+	case encFixed32, encFloat32:
+		return 4
+	case encFixed64, encFloat64:
+		return 8
+	case encBool:
+		return 1
+	}
+	return 0
+}
+
+// value is a value of a field, of its elements, or of its map keys or
+// values: either a scalar, or a message.
+type value struct {
+	Type *types.Type
+	// How a scalar is encoded, or empty for a message.
+	Enc encoding
+	// The value is a pointer to Type.
+	Pointer bool
+}
+
+// protoField is a member of a struct with a protobuf struct tag.
+type protoField struct {
+	Member   types.Member
+	Number   int
+	Repeated bool
+	Packed   bool
+	Map      bool
+	// The key of a map field, and the value of the field, its elements, or
+	// its map values.
+	Key, Value value
+}
+
+// underlying returns the type 't' is defined as, for named non-struct types.
+func underlying(t *types.Type) *types.Type {
+	if t.Kind == types.Alias {
+		return t.Underlying
+	}
+	return t
+}
+
+func isByteSlice(t *types.Type) bool {
+	u := underlying(t)
+	return u.Kind == types.Slice && underlying(u.Elem).Kind == types.Builtin && underlying(u.Elem).Name.Name == "byte"
+}
+
+// isMessage returns true if 't' is a struct whose methods are generated, or
+// a type with the methods they call.
+func (g *genProtoMarshal) isMessage(t *types.Type) bool {
+	if g.structs[t] {
+		return true
+	}
+	for _, name := range []string{"Size", "MarshalTo", "Unmarshal"} {
+		if _, ok := t.Methods[name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// defaultWire returns the wire type of the struct tag of a map key or
+// value of type 't' whose tag doesn't say.
+func defaultWire(t *types.Type) string {
+	if isByteSlice(t) {
+		return "bytes"
+	}
+	switch underlying(t).Name.Name {
+	case "string":
+		return "bytes"
+	case "float32":
+		return "fixed32"
+	case "float64":
+		return "fixed64"
+	}
+	return "varint"
+}
+
+// scalarEncoding returns how a scalar of type 't' with the wire type 'wire'
+// is encoded.
+func scalarEncoding(t *types.Type, wire string) (encoding, error) {
+	if isByteSlice(t) {
+		if wire != "bytes" {
+			return "", fmt.Errorf("a byte slice has wire type %q, want bytes", wire)
+		}
+		return encBytes, nil
+	}
+	u := underlying(t)
+	if u.Kind != types.Builtin {
+		return "", fmt.Errorf("type %v is neither a scalar nor a message", t)
+	}
+	want := ""
+	switch name := u.Name.Name; {
+	case name == "bool":
+		want = "varint"
+		if wire == want {
+			return encBool, nil
+		}
+	case name == "string":
+		want = "bytes"
+		if wire == want {
+			return encString, nil
+		}
+	case name == "float32":
+		want = "fixed32"
+		if wire == want {
+			return encFloat32, nil
+		}
+	case name == "float64":
+		want = "fixed64"
+		if wire == want {
+			return encFloat64, nil
+		}
+	case strings.HasPrefix(name, "int") || strings.HasPrefix(name, "uint") || name == "byte" || name == "rune":
+		want = "varint, zigzag32, zigzag64, fixed32 or fixed64"
+		switch wire {
+		case "varint", "fixed32", "fixed64":
+			return encoding(wire), nil
+		case "zigzag32", "zigzag64":
+			if !strings.HasPrefix(name, "uint") && name != "byte" {
+				return encoding(wire), nil
+			}
+			want = "varint, fixed32 or fixed64"
+		}
+	default:
+		return "", fmt.Errorf("type %v can't be encoded", t)
+	}
+	return "", fmt.Errorf("type %v has wire type %q, want %s", t, wire, want)
+}
+
+// valueOf returns how a value of type 't' with the wire type 'wire' is
+// encoded. Pointers to scalars are only allowed if 'optional'.
+func (g *genProtoMarshal) valueOf(t *types.Type, wire string, optional bool) (value, error) {
+	v := value{Type: t}
+	if t.Kind == types.Pointer {
+		v.Type, v.Pointer = t.Elem, true
+	}
+	if g.isMessage(v.Type) {
+		if wire != "bytes" {
+			return v, fmt.Errorf("message %v has wire type %q, want bytes", v.Type, wire)
+		}
+		return v, nil
+	}
+	if v.Pointer && !optional {
+		return v, fmt.Errorf("pointers to scalars are only supported as fields")
+	}
+	var err error
+	v.Enc, err = scalarEncoding(v.Type, wire)
+	return v, err
+}
+
+// parseTag returns the wire type, the field number and the options of the
+// protobuf struct tag 'tag', e.g. "bytes,1,opt,name=foo".
+func parseTag(tag string) (string, int, []string, error) {
+	parts := strings.Split(tag, ",")
+	if len(parts) < 2 {
+		return "", 0, nil, fmt.Errorf("malformed protobuf tag %q", tag)
+	}
+	number, err := strconv.Atoi(parts[1])
+	if err != nil || number < 1 || number > 1<<29-1 || (number >= 19000 && number <= 19999) {
+		return "", 0, nil, fmt.Errorf("protobuf tag %q has an invalid field number", tag)
+	}
+	return parts[0], number, parts[2:], nil
+}
+
+// protoFields returns the members of 't' with protobuf struct tags, by
+// field number.
+func (g *genProtoMarshal) protoFields(t *types.Type) []protoField {
+	fields := []protoField{}
+	numbers := map[int]string{}
+	for _, m := range t.Members {
+		tag := reflect.StructTag(m.Tags).Get("protobuf")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		f, err := g.protoField(m, tag)
+		if err != nil {
+			log.Fatalf("Type %v: member %s: %v", t, m.Name, err)
+		}
+		if other, ok := numbers[f.Number]; ok {
+			log.Fatalf("Type %v: members %s and %s have the same field number %d", t, other, m.Name, f.Number)
+		}
+		numbers[f.Number] = m.Name
+		fields = append(fields, f)
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Number < fields[j].Number })
+	return fields
+}
+
+func (g *genProtoMarshal) protoField(m types.Member, tag string) (protoField, error) {
+	wire, number, opts, err := parseTag(tag)
+	if err != nil {
+		return protoField{}, err
+	}
+	f := protoField{Member: m, Number: number}
+	for _, opt := range opts {
+		if opt == "packed" {
+			f.Packed = true
+		}
+	}
+	u := underlying(m.Type)
+	switch {
+	case u.Kind == types.Map:
+		f.Map = true
+		tags := reflect.StructTag(m.Tags)
+		keyWire, valueWire := defaultWire(u.Key), defaultWire(u.Elem)
+		if g.isMessage(u.Elem) || (u.Elem.Kind == types.Pointer && g.isMessage(u.Elem.Elem)) {
+			valueWire = "bytes"
+		}
+		if k := tags.Get("protobuf_key"); k != "" {
+			keyWire = strings.Split(k, ",")[0]
+		}
+		if v := tags.Get("protobuf_val"); v != "" {
+			valueWire = strings.Split(v, ",")[0]
+		}
+		if f.Key, err = g.valueOf(u.Key, keyWire, false); err != nil {
+			return f, fmt.Errorf("map key: %v", err)
+		}
+		if f.Key.Enc == "" || f.Key.Enc == encBytes || f.Key.Enc == encFloat32 || f.Key.Enc == encFloat64 {
+			return f, fmt.Errorf("map keys of type %v are not supported", u.Key)
+		}
+		if f.Value, err = g.valueOf(u.Elem, valueWire, false); err != nil {
+			return f, fmt.Errorf("map value: %v", err)
+		}
+	case u.Kind == types.Slice && !isByteSlice(u):
+		f.Repeated = true
+		if f.Value, err = g.valueOf(u.Elem, wire, false); err != nil {
+			return f, err
+		}
+		if f.Value.Enc == "" || f.Value.Enc.wireType() == 2 {
+			// Only scalars of the other wire types can be packed.
+			f.Packed = false
+		}
+	default:
+		if f.Value, err = g.valueOf(m.Type, wire, true); err != nil {
+			return f, err
+		}
+	}
+	return f, nil
+}
+
+// genProtoMarshal produces a file with the protobuf methods of the structs
+// of a package.
+type genProtoMarshal struct {
+	generator.DefaultGen
+	targetPackage string
+	imports       namer.ImportTracker
+	structs       map[*types.Type]bool
+}
+
+func NewGenProtoMarshal(sanitizedName, targetPackage string, structs map[*types.Type]bool) generator.Generator {
+	return &genProtoMarshal{
+		DefaultGen: generator.DefaultGen{
+			OptionalName: sanitizedName,
+		},
+		targetPackage: targetPackage,
+		imports:       generator.NewImportTracker(),
+		structs:       structs,
+	}
+}
+
+func (g *genProtoMarshal) Namers(c *generator.Context) namer.NameSystems {
+	// Have the raw namer for this file track what it imports.
+	return namer.NameSystems{
+		"raw": namer.NewRawNamer(g.targetPackage, g.imports),
+	}
+}
+
+func (g *genProtoMarshal) Filter(c *generator.Context, t *types.Type) bool {
+	return g.structs[t]
+}
+
+func (g *genProtoMarshal) isOtherPackage(pkg string) bool {
+	if pkg == g.targetPackage {
+		return false
+	}
+	if strings.HasSuffix(pkg, "\""+g.targetPackage+"\"") {
+		return false
+	}
+	return true
+}
+
+func (g *genProtoMarshal) Imports(c *generator.Context) (imports []string) {
+	importLines := []string{}
+	for _, singleImport := range g.imports.ImportLines() {
+		if g.isOtherPackage(singleImport) {
+			importLines = append(importLines, singleImport)
+		}
+	}
+	return importLines
+}
+
+func (g *genProtoMarshal) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	log.Infof("Generating protobuf methods for type %v", t)
+
+	fields := g.protoFields(t)
+	e := &emitter{sw: generator.NewSnippetWriter(w, c, "$", "$"), raw: c.Namers["raw"]}
+	args := generator.Args{"type": t}
+
+	// A nil message, such as a nil element of a slice or map of pointers,
+	// is encoded as an empty one, as gogo/protobuf does.
+	e.sw.Do("// Size returns the size of the protobuf encoding of m.\n", nil)
+	e.sw.Do("func (m *$.type|raw$) Size() (n int) {\n", args)
+	e.sw.Do("if m == nil {\n", nil)
+	e.sw.Do("return 0\n", nil)
+	e.sw.Do("}\n", nil)
+	if len(fields) > 0 {
+		e.sw.Do("var l int\n", nil)
+		e.sw.Do("_ = l\n", nil)
+	}
+	for _, f := range fields {
+		e.writeSize(f)
+	}
+	e.sw.Do("return n\n", nil)
+	e.sw.Do("}\n\n", nil)
+
+	e.sw.Do("// Marshal returns the protobuf encoding of m.\n", nil)
+	e.sw.Do("func (m *$.type|raw$) Marshal() ([]byte, error) {\n", args)
+	e.sw.Do("dAtA := make([]byte, m.Size())\n", nil)
+	e.sw.Do("n, err := m.MarshalTo(dAtA)\n", nil)
+	e.sw.Do("if err != nil {\n", nil)
+	e.sw.Do("return nil, err\n", nil)
+	e.sw.Do("}\n", nil)
+	e.sw.Do("return dAtA[:n], nil\n", nil)
+	e.sw.Do("}\n\n", nil)
+
+	e.sw.Do("// MarshalTo writes the protobuf encoding of m to dAtA, which must hold\n", nil)
+	e.sw.Do("// at least m.Size() bytes, and returns the number of bytes written.\n", nil)
+	e.sw.Do("func (m *$.type|raw$) MarshalTo(dAtA []byte) (i int, err error) {\n", args)
+	e.sw.Do("if m == nil {\n", nil)
+	e.sw.Do("return 0, nil\n", nil)
+	e.sw.Do("}\n", nil)
+	for _, f := range fields {
+		e.writeMarshal(f)
+	}
+	e.sw.Do("return i, nil\n", nil)
+	e.sw.Do("}\n\n", nil)
+
+	e.sw.Do("// Unmarshal decodes the protobuf encoding dAtA into m. Fields are merged\n", nil)
+	e.sw.Do("// into those m already has, as protobuf merges repeated messages.\n", nil)
+	e.sw.Do("func (m *$.type|raw$) Unmarshal(dAtA []byte) error {\n", args)
+	e.sw.Do("d := $.$(dAtA)\n", e.pu("NewDecoder"))
+	e.sw.Do("for d.More() {\n", nil)
+	e.sw.Do("field, wire := d.Key()\n", nil)
+	e.sw.Do("switch field {\n", nil)
+	for _, f := range fields {
+		e.sw.Do("case $.$:\n", f.Number)
+		e.writeUnmarshal(f)
+	}
+	e.sw.Do("default:\n", nil)
+	e.sw.Do("d.Skip(wire)\n", nil)
+	e.sw.Do("}\n", nil)
+	e.sw.Do("}\n", nil)
+	e.sw.Do("return d.Error()\n", nil)
+	e.sw.Do("}\n\n", nil)
+	return e.sw.Error()
+}
+
+// emitter writes the code of the methods of a type.
+type emitter struct {
+	sw  *generator.SnippetWriter
+	raw namer.Namer
+}
+
+// line writes one line of code.
+func (e *emitter) line(format string, a ...interface{}) {
+	e.sw.Do("$.$\n", fmt.Sprintf(format, a...))
+}
+
+// pu returns the name of the protoutil function or constant 'name'.
+func (e *emitter) pu(name string) string {
+	return e.raw.Name(types.Ref(protoutilPackage, name))
+}
+
+// math returns the name of the math function 'name'.
+func (e *emitter) math(name string) string {
+	return e.raw.Name(types.Ref("math", name))
+}
+
+func sizeVarint(x uint64) int {
+	n := 1
+	for x >= 0x80 {
+		x >>= 7
+		n++
+	}
+	return n
+}
+
+// key returns the key of the field 'number' of wire type 'wire', and the
+// size of its encoding.
+func key(number, wire int) (uint64, int) {
+	k := uint64(number)<<3 | uint64(wire)
+	return k, sizeVarint(k)
+}
+
+// fieldKey returns the key of 'f', and the size of its encoding.
+func fieldKey(f protoField) (uint64, int) {
+	wire := 2
+	if !f.Map && !f.Packed && f.Value.Enc != "" {
+		wire = f.Value.Enc.wireType()
+	}
+	return key(f.Number, wire)
+}
+
+// convert returns 'expr', of type 't', converted to the builtin 'to'.
+func convert(to, expr string, t *types.Type) string {
+	if t.Name.Package == "" && t.Name.Name == to {
+		return expr
+	}
+	return to + "(" + expr + ")"
+}
+
+// nonZero returns the condition under which the scalar 'v', encoded as
+// 'enc', is written, as zero values are left out.
+func nonZero(enc encoding, v string) string {
+	switch enc {
+	case encBool:
+		return v
+	case encString, encBytes:
+		return "len(" + v + ") > 0"
+	}
+	return v + " != 0"
+}
+
+// sizeOf returns the size of the encoding of the scalar 'v' of type 't'.
+func (e *emitter) sizeOf(enc encoding, v string, t *types.Type) string {
+	switch enc {
+	case encZigzag32:
+		return fmt.Sprintf("%s(%s(%s))", e.pu("SizeVarint"), e.pu("Zigzag32"), convert("int32", v, t))
+	case encZigzag64:
+		return fmt.Sprintf("%s(%s(%s))", e.pu("SizeVarint"), e.pu("Zigzag64"), convert("int64", v, t))
+	case encString, encBytes:
+		return fmt.Sprintf("%s(uint64(len(%s))) + len(%s)", e.pu("SizeVarint"), v, v)
+	}
+	if size := enc.fixedSize(); size > 0 {
+		return strconv.Itoa(size)
+	}
+	return fmt.Sprintf("%s(%s)", e.pu("SizeVarint"), convert("uint64", v, t))
+}
+
+// put returns the statement writing the scalar 'v' of type 't' at i.
+func (e *emitter) put(enc encoding, v string, t *types.Type) string {
+	call := func(name, arg string) string {
+		return fmt.Sprintf("i = %s(dAtA, i, %s)", e.pu(name), arg)
+	}
+	switch enc {
+	case encZigzag32:
+		return call("PutVarint", fmt.Sprintf("%s(%s)", e.pu("Zigzag32"), convert("int32", v, t)))
+	case encZigzag64:
+		return call("PutVarint", fmt.Sprintf("%s(%s)", e.pu("Zigzag64"), convert("int64", v, t)))
+	case encFixed32:
+		return call("PutFixed32", convert("uint32", v, t))
+	case encFixed64:
+		return call("PutFixed64", convert("uint64", v, t))
+	case encFloat32:
+		return call("PutFixed32", fmt.Sprintf("%s(%s)", e.math("Float32bits"), convert("float32", v, t)))
+	case encFloat64:
+		return call("PutFixed64", fmt.Sprintf("%s(%s)", e.math("Float64bits"), convert("float64", v, t)))
+	case encBool:
+		return call("PutBool", convert("bool", v, t))
+	case encString:
+		return call("PutString", convert("string", v, t))
+	case encBytes:
+		return call("PutBytes", convert("[]byte", v, t))
+	}
+	return call("PutVarint", convert("uint64", v, t))
+}
+
+// read returns the expression reading a scalar of type 't' with the
+// decoder 'd'.
+func (e *emitter) read(enc encoding, d string, t *types.Type) string {
+	expr, base := d+".Varint()", "uint64"
+	switch enc {
+	case encZigzag32:
+		expr, base = e.pu("Unzigzag32")+"("+d+".Varint())", "int32"
+	case encZigzag64:
+		expr, base = e.pu("Unzigzag64")+"("+d+".Varint())", "int64"
+	case encFixed32:
+		expr, base = d+".Fixed32()", "uint32"
+	case encFixed64:
+		expr, base = d+".Fixed64()", "uint64"
+	case encFloat32:
+		expr, base = e.math("Float32frombits")+"("+d+".Fixed32())", "float32"
+	case encFloat64:
+		expr, base = e.math("Float64frombits")+"("+d+".Fixed64())", "float64"
+	case encBool:
+		expr, base = d+".Varint() != 0", "bool"
+	case encString:
+		expr, base = d+".String()", "string"
+	case encBytes:
+		expr, base = d+".Bytes()", "[]byte"
+	}
+	if t.Name.Package == "" && t.Name.Name == base {
+		return expr
+	}
+	return e.raw.Name(t) + "(" + expr + ")"
+}
+
+// sizeOfValue returns the size of the encoding of 'v', without its key.
+func (e *emitter) sizeOfValue(v value, expr string) string {
+	if v.Enc == "" {
+		if !v.Pointer {
+			expr = "&" + expr
+		}
+		return fmt.Sprintf("%s(%s)", e.pu("SizeMessage"), expr)
+	}
+	return e.sizeOf(v.Enc, expr, v.Type)
+}
+
+// putValue writes the statements writing 'v' at i, without its key.
+func (e *emitter) putValue(v value, expr string) {
+	if v.Enc == "" {
+		if !v.Pointer {
+			expr = "&" + expr
+		}
+		e.line("if i, err = %s(dAtA, i, %s); err != nil {", e.pu("PutMessage"), expr)
+		e.line("return 0, err")
+		e.line("}")
+		return
+	}
+	e.line("%s", e.put(v.Enc, expr, v.Type))
+}
+
+func (e *emitter) writeSize(f protoField) {
+	_, keyLen := fieldKey(f)
+	field := "m." + f.Member.Name
+	switch {
+	case f.Map:
+		k, v := "k", "v"
+		if f.Key.Enc.fixedSize() > 0 {
+			k = "_"
+		}
+		if f.Value.Enc.fixedSize() > 0 {
+			v = "_"
+		}
+		switch {
+		case k == "_" && v == "_":
+			e.line("for range %s {", field)
+		case v == "_":
+			e.line("for %s := range %s {", k, field)
+		default:
+			e.line("for %s, %s := range %s {", k, v, field)
+		}
+		e.line("l = %d + %s + %d + %s", 1, e.sizeOfValue(f.Key, k), 1, e.sizeOfValue(f.Value, v))
+		e.line("n += %d + %s(uint64(l)) + l", keyLen, e.pu("SizeVarint"))
+		e.line("}")
+	case f.Repeated && f.Packed:
+		e.line("if len(%s) > 0 {", field)
+		if size := f.Value.Enc.fixedSize(); size > 0 {
+			e.line("l = len(%s) * %d", field, size)
+		} else {
+			e.line("l = 0")
+			e.line("for _, v := range %s {", field)
+			e.line("l += %s", e.sizeOf(f.Value.Enc, "v", f.Value.Type))
+			e.line("}")
+		}
+		e.line("n += %d + %s(uint64(l)) + l", keyLen, e.pu("SizeVarint"))
+		e.line("}")
+	case f.Repeated && f.Value.Enc.fixedSize() > 0:
+		e.line("n += len(%s) * %d", field, keyLen+f.Value.Enc.fixedSize())
+	case f.Repeated:
+		e.line("for i := range %s {", field)
+		e.line("n += %d + %s", keyLen, e.sizeOfValue(f.Value, field+"[i]"))
+		e.line("}")
+	case f.Value.Pointer:
+		e.line("if %s != nil {", field)
+		if f.Value.Enc == "" {
+			e.line("n += %d + %s", keyLen, e.sizeOfValue(f.Value, field))
+		} else {
+			e.line("n += %d + %s", keyLen, e.sizeOfValue(f.Value, "*"+field))
+		}
+		e.line("}")
+	case f.Value.Enc == "":
+		e.line("n += %d + %s", keyLen, e.sizeOfValue(f.Value, field))
+	default:
+		e.line("if %s {", nonZero(f.Value.Enc, field))
+		e.line("n += %d + %s", keyLen, e.sizeOfValue(f.Value, field))
+		e.line("}")
+	}
+}
+
+func (e *emitter) putKey(k uint64) {
+	e.line("i = %s(dAtA, i, %#x)", e.pu("PutVarint"), k)
+}
+
+func (e *emitter) writeMarshal(f protoField) {
+	k, _ := fieldKey(f)
+	field := "m." + f.Member.Name
+	switch {
+	case f.Map:
+		// Entries are written in the order of their keys, so that the
+		// encoding is deterministic.
+		keyType := underlying(f.Member.Type).Key
+		e.line("if len(%s) > 0 {", field)
+		e.line("keys := make([]%s, 0, len(%s))", e.raw.Name(keyType), field)
+		e.line("for k := range %s {", field)
+		e.line("keys = append(keys, k)")
+		e.line("}")
+		less := "keys[a] < keys[b]"
+		if f.Key.Enc == encBool {
+			less = "!keys[a] && keys[b]"
+		}
+		e.line("%s(keys, func(a, b int) bool { return %s })", e.raw.Name(types.Ref("sort", "Slice")), less)
+		e.line("for _, k := range keys {")
+		e.line("v := %s[k]", field)
+		e.putKey(k)
+		e.line("i = %s(dAtA, i, uint64(%d + %s + %d + %s))", e.pu("PutVarint"), 1, e.sizeOfValue(f.Key, "k"), 1, e.sizeOfValue(f.Value, "v"))
+		keyKey, _ := key(1, f.Key.Enc.wireType())
+		e.putKey(keyKey)
+		e.putValue(f.Key, "k")
+		valueWire := 2
+		if f.Value.Enc != "" {
+			valueWire = f.Value.Enc.wireType()
+		}
+		valueKey, _ := key(2, valueWire)
+		e.putKey(valueKey)
+		e.putValue(f.Value, "v")
+		e.line("}")
+		e.line("}")
+	case f.Repeated && f.Packed:
+		e.line("if len(%s) > 0 {", field)
+		e.putKey(k)
+		if size := f.Value.Enc.fixedSize(); size > 0 {
+			e.line("i = %s(dAtA, i, uint64(len(%s) * %d))", e.pu("PutVarint"), field, size)
+		} else {
+			e.line("l := 0")
+			e.line("for _, v := range %s {", field)
+			e.line("l += %s", e.sizeOf(f.Value.Enc, "v", f.Value.Type))
+			e.line("}")
+			e.line("i = %s(dAtA, i, uint64(l))", e.pu("PutVarint"))
+		}
+		e.line("for _, v := range %s {", field)
+		e.putValue(f.Value, "v")
+		e.line("}")
+		e.line("}")
+	case f.Repeated:
+		e.line("for j := range %s {", field)
+		e.putKey(k)
+		e.putValue(f.Value, field+"[j]")
+		e.line("}")
+	case f.Value.Pointer:
+		e.line("if %s != nil {", field)
+		e.putKey(k)
+		if f.Value.Enc == "" {
+			e.putValue(f.Value, field)
+		} else {
+			e.putValue(f.Value, "*"+field)
+		}
+		e.line("}")
+	case f.Value.Enc == "":
+		e.putKey(k)
+		e.putValue(f.Value, field)
+	default:
+		e.line("if %s {", nonZero(f.Value.Enc, field))
+		e.putKey(k)
+		e.putValue(f.Value, field)
+		e.line("}")
+	}
+}
+
+// readValue writes the statements reading 'v' with the decoder 'd' into
+// 'target'. Messages are merged into what 'target' holds.
+func (e *emitter) readValue(v value, d, target string) {
+	if v.Enc != "" {
+		e.line("%s = %s", target, e.read(v.Enc, d, v.Type))
+		return
+	}
+	if v.Pointer {
+		e.line("if %s == nil {", target)
+		e.line("%s = new(%s)", target, e.raw.Name(v.Type))
+		e.line("}")
+		e.line("%s.Message(%s)", d, target)
+		return
+	}
+	e.line("%s.Message(&%s)", d, target)
+}
+
+func (e *emitter) expect(d string, enc encoding) string {
+	if enc == "" {
+		enc = encBytes
+	}
+	return fmt.Sprintf("%s.Expect(wire, %s)", d, e.pu(enc.wireTypeName()))
+}
+
+func (e *emitter) writeUnmarshal(f protoField) {
+	field := "m." + f.Member.Name
+	switch {
+	case f.Map:
+		e.line("if %s {", e.expect("d", ""))
+		e.line("var k %s", e.raw.Name(f.Key.Type))
+		if f.Value.Pointer {
+			e.line("v := new(%s)", e.raw.Name(f.Value.Type))
+		} else {
+			e.line("var v %s", e.raw.Name(f.Value.Type))
+		}
+		e.line("for entry := d.Nested(); entry.More(); {")
+		e.line("field, wire := entry.Key()")
+		e.line("switch field {")
+		e.line("case 1:")
+		e.line("if %s {", e.expect("entry", f.Key.Enc))
+		e.readValue(f.Key, "entry", "k")
+		e.line("}")
+		e.line("case 2:")
+		e.line("if %s {", e.expect("entry", f.Value.Enc))
+		e.readValue(f.Value, "entry", "v")
+		e.line("}")
+		e.line("default:")
+		e.line("entry.Skip(wire)")
+		e.line("}")
+		e.line("}")
+		e.line("if %s == nil {", field)
+		e.line("%s = make(%s)", field, e.raw.Name(f.Member.Type))
+		e.line("}")
+		e.line("%s[k] = v", field)
+		e.line("}")
+	case f.Repeated && f.Value.Enc != "":
+		if f.Value.Enc.wireType() != 2 {
+			// Parsers must accept both packed and unpacked scalars.
+			e.line("if wire == %s {", e.pu("WireBytes"))
+			e.line("for p := d.Nested(); p.More(); {")
+			e.line("%s = append(%s, %s)", field, field, e.read(f.Value.Enc, "p", f.Value.Type))
+			e.line("}")
+			e.line("} else if %s {", e.expect("d", f.Value.Enc))
+		} else {
+			e.line("if %s {", e.expect("d", f.Value.Enc))
+		}
+		e.line("%s = append(%s, %s)", field, field, e.read(f.Value.Enc, "d", f.Value.Type))
+		e.line("}")
+	case f.Repeated && f.Value.Pointer:
+		e.line("if %s {", e.expect("d", ""))
+		e.line("v := new(%s)", e.raw.Name(f.Value.Type))
+		e.line("d.Message(v)")
+		e.line("%s = append(%s, v)", field, field)
+		e.line("}")
+	case f.Repeated:
+		e.line("if %s {", e.expect("d", ""))
+		e.line("%s = append(%s, %s{})", field, field, e.raw.Name(f.Value.Type))
+		e.line("d.Message(&%s[len(%s)-1])", field, field)
+		e.line("}")
+	case f.Value.Pointer && f.Value.Enc != "":
+		e.line("if %s {", e.expect("d", f.Value.Enc))
+		e.line("v := %s", e.read(f.Value.Enc, "d", f.Value.Type))
+		e.line("%s = &v", field)
+		e.line("}")
+	default:
+		e.line("if %s {", e.expect("d", f.Value.Enc))
+		e.readValue(f.Value, "d", field)
+		e.line("}")
+	}
+}
@@ -0,0 +1,278 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package register_gen
+
+import (
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/namer"
+	"github.com/lack-io/gogogen/gogenerator/types"
+	"github.com/lack-io/gogogen/util/log"
+	"github.com/lack-io/gogogen/util/sets"
+)
+
+// This is the comment tag that marks the root types of a package, and the
+// prefix of the one naming its group and version.
+const tagName = "gogogen:register-gen"
+
+// The parameters of a package.
+const (
+	paramGroup   = "group"
+	paramVersion = "version"
+)
+
+// The packages the generated code uses.
+const (
+	schemePackage = "github.com/lack-io/gogogen/runtime/scheme"
+	metaPackage   = "github.com/lack-io/gogogen/runtime/meta"
+)
+
+// NameSystems returns the name system used by the generators in this package.
+func NameSystems() namer.NameSystems {
+	return namer.NameSystems{
+		"public": namer.NewPublicNamer(0),
+		"raw":    namer.NewRawNamer("", nil),
+	}
+}
+
+// DefaultNameSystem returns the default name system for ordering the types to
+// be processed by the generators in this package.
+func DefaultNameSystem() string {
+	return "public"
+}
+
+// groupVersion is the group and version of the API of a package.
+type groupVersion struct {
+	Group   string
+	Version string
+}
+
+// parseGroupVersion returns the group and version of 'pkg', or nil if it
+// names none.
+func parseGroupVersion(pkg *types.Package) *groupVersion {
+	params, err := types.ExtractCommentTagParams("+", tagName, pkg.Comments)
+	if err != nil {
+		log.Fatalf("Package %v: %v", pkg.Path, err)
+	}
+	if len(params) == 0 {
+		return nil
+	}
+	gv := &groupVersion{Version: pkg.Name}
+	hasGroup := false
+	for _, p := range params {
+		switch p.Key {
+		case paramGroup:
+			gv.Group = p.Value
+			hasGroup = true
+		case paramVersion:
+			gv.Version = p.Value
+		default:
+			log.Fatalf("Package %v: unsupported %s parameter %q", pkg.Path, tagName, p.Key)
+		}
+	}
+	if !hasGroup {
+		log.Fatalf("Package %v: the API needs a group, as in +%s:%s=example.com", pkg.Path, tagName, paramGroup)
+	}
+	if len(gv.Version) == 0 {
+		log.Fatalf("Package %v: the API needs a version", pkg.Path)
+	}
+	return gv
+}
+
+// isRootType returns true if 't' is to be added to a scheme: it embeds the
+// object metadata, or asks to be, and doesn't ask not to be.
+func isRootType(t *types.Type) bool {
+	comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
+	values := types.ExtractCommentTags("+", comments)[tagName]
+	if len(values) > 1 {
+		log.Fatalf("Type %v: found %d %s tags: %q", t, len(values), tagName, values)
+	}
+	if len(values) == 1 {
+		switch values[0] {
+		case "true":
+			if t.Kind != types.Struct {
+				log.Fatalf("Type %v: only structs can be added to a scheme", t)
+			}
+			return true
+		case "false":
+			return false
+		default:
+			log.Fatalf("Type %v: unsupported %s value: %q", t, tagName, values[0])
+		}
+	}
+	if t.Kind != types.Struct {
+		return false
+	}
+	for _, m := range t.Members {
+		if m.Embedded && m.Type.Name == types.Ref(metaPackage, "Meta").Name {
+			return true
+		}
+	}
+	return false
+}
+
+func Packages(context *generator.Context, arguments *args.GeneratorArgs) generator.Packages {
+	boilerplate, err := arguments.LoadGoBoilerplate()
+	if err != nil {
+		log.Fatalf("Failed loading boilerplate: %v", err)
+	}
+
+	packages := generator.Packages{}
+	header := append(arguments.GeneratedBuildConstraint(), boilerplate...)
+
+	for i := range sets.NewString(context.Inputs...) {
+		log.Debugf("Considering pkg %q", i)
+		pkg := context.Universe[i]
+		if pkg == nil {
+			// If the input had no Go files, for example.
+			continue
+		}
+
+		gv := parseGroupVersion(pkg)
+		if gv == nil {
+			continue
+		}
+
+		log.Infof("Package %q needs generation", i)
+		packages = append(packages,
+			&generator.DefaultPackage{
+				PackageName: strings.Split(filepath.Base(pkg.Path), ".")[0],
+				PackagePath: pkg.Path,
+				HeaderText:  header,
+				GeneratorFunc: func(c *generator.Context) (generators []generator.Generator) {
+					return []generator.Generator{
+						NewGenRegister(arguments.OutputFileName(pkg, "register"), pkg.Path, gv),
+					}
+				},
+				FilterFunc: func(c *generator.Context, t *types.Type) bool {
+					return t.Name.Package == pkg.Path
+				},
+			})
+	}
+	return packages
+}
+
+// genRegister produces a file registering the root types of a package in a
+// scheme.
+type genRegister struct {
+	generator.DefaultGen
+	targetPackage string
+	imports       namer.ImportTracker
+	groupVersion  *groupVersion
+	rootTypes     []*types.Type
+}
+
+func NewGenRegister(sanitizedName, targetPackage string, gv *groupVersion) generator.Generator {
+	return &genRegister{
+		DefaultGen: generator.DefaultGen{
+			OptionalName: sanitizedName,
+		},
+		targetPackage: targetPackage,
+		imports:       generator.NewImportTracker(),
+		groupVersion:  gv,
+	}
+}
+
+func (g *genRegister) Namers(c *generator.Context) namer.NameSystems {
+	// Have the raw namer for this file track what it imports.
+	return namer.NameSystems{
+		"raw": namer.NewRawNamer(g.targetPackage, g.imports),
+	}
+}
+
+func (g *genRegister) Filter(c *generator.Context, t *types.Type) bool {
+	return isRootType(t)
+}
+
+func (g *genRegister) isOtherPackage(pkg string) bool {
+	if pkg == g.targetPackage {
+		return false
+	}
+	if strings.HasSuffix(pkg, "\""+g.targetPackage+"\"") {
+		return false
+	}
+	return true
+}
+
+func (g *genRegister) Imports(c *generator.Context) (imports []string) {
+	importLines := []string{}
+	for _, singleImport := range g.imports.ImportLines() {
+		if g.isOtherPackage(singleImport) {
+			importLines = append(importLines, singleImport)
+		}
+	}
+	return importLines
+}
+
+func (g *genRegister) Init(c *generator.Context, w io.Writer) error {
+	sw := generator.NewSnippetWriter(w, c, "$", "$")
+	sw.Do(registerCode, generator.Args{
+		"group":         strconv.Quote(g.groupVersion.Group),
+		"version":       strconv.Quote(g.groupVersion.Version),
+		"GroupVersion":  types.Ref(schemePackage, "GroupVersion"),
+		"SchemeBuilder": types.Ref(schemePackage, "SchemeBuilder"),
+	})
+	return sw.Error()
+}
+
+var registerCode = `// GroupName is the group of the API types of this package.
+const GroupName = $.group$
+
+// SchemeGroupVersion is the group and version of the API types of this package.
+var SchemeGroupVersion = $.GroupVersion|raw${Group: GroupName, Version: $.version$}
+
+var (
+	// SchemeBuilder collects the functions adding the API types of this
+	// package to a scheme.
+	SchemeBuilder $.SchemeBuilder|raw$
+	// localSchemeBuilder is for other files of this package to register
+	// functions of their own with.
+	localSchemeBuilder = &SchemeBuilder
+	// AddToScheme adds the API types of this package to a scheme.
+	AddToScheme = localSchemeBuilder.AddToScheme
+)
+
+func init() {
+	localSchemeBuilder.Register(addKnownTypes)
+}
+
+`
+
+func (g *genRegister) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	log.Infof("Registering type %v", t)
+	g.rootTypes = append(g.rootTypes, t)
+	return nil
+}
+
+func (g *genRegister) Finalize(c *generator.Context, w io.Writer) error {
+	sw := generator.NewSnippetWriter(w, c, "$", "$")
+	sw.Do("// addKnownTypes adds the root types of this package to the scheme.\n", nil)
+	sw.Do("func addKnownTypes(s *$.|raw$) error {\n", types.Ref(schemePackage, "Scheme"))
+	if len(g.rootTypes) > 0 {
+		sw.Do("s.AddKnownTypes(SchemeGroupVersion,\n", nil)
+		for _, t := range g.rootTypes {
+			sw.Do("&$.|raw${},\n", t)
+		}
+		sw.Do(")\n", nil)
+	}
+	sw.Do("return nil\n", nil)
+	sw.Do("}\n", nil)
+	return sw.Error()
+}
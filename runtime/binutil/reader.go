@@ -0,0 +1,223 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binutil
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+var (
+	// ErrTruncated is returned for input ending in the middle of a value.
+	ErrTruncated = errors.New("binutil: unexpected end of input")
+	// ErrOverflow is returned for an integer too large for its type.
+	ErrOverflow = errors.New("binutil: integer overflow")
+	// ErrLayout is returned for input written for another layout of the
+	// type being decoded.
+	ErrLayout = errors.New("binutil: layout mismatch")
+)
+
+// Reader decodes values written by a Writer. The first error it meets is
+// kept, and every later call is a no-op returning a zero value, so that
+// generated code only needs to check Error once at the end.
+type Reader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+// NewReader returns a Reader reading data.
+func NewReader(data []byte) *Reader {
+	return &Reader{data: data}
+}
+
+// Error returns the first error met, if any.
+func (r *Reader) Error() error {
+	return r.err
+}
+
+func (r *Reader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+	r.pos = len(r.data)
+}
+
+// End fails if anything follows the value just read.
+func (r *Reader) End() {
+	if r.err == nil && r.pos < len(r.data) {
+		r.fail(fmt.Errorf("binutil: %d unexpected bytes after value", len(r.data)-r.pos))
+	}
+}
+
+// Header checks that the value which follows was written for the given
+// version and layout hash of its type.
+func (r *Reader) Header(version uint64, layout uint32) {
+	v := r.Uint(64)
+	if r.err == nil && v != version {
+		r.fail(fmt.Errorf("binutil: version %d, want %d", v, version))
+		return
+	}
+	b := r.next(4)
+	if b != nil && binary.LittleEndian.Uint32(b) != layout {
+		r.fail(ErrLayout)
+	}
+}
+
+// next returns the next n bytes, or nil if there are not as many.
+func (r *Reader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > len(r.data)-r.pos {
+		r.fail(ErrTruncated)
+		return nil
+	}
+	b := r.data[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *Reader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data[r.pos:])
+	switch {
+	case n == 0:
+		r.fail(ErrTruncated)
+		return 0
+	case n < 0:
+		r.fail(ErrOverflow)
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+// Uint reads a uvarint, which must fit in bits bits, or in a uint if bits
+// is 0.
+func (r *Reader) Uint(bits int) uint64 {
+	if bits == 0 {
+		bits = 32 << (^uint(0) >> 63)
+	}
+	v := r.uvarint()
+	if bits < 64 && v>>uint(bits) != 0 {
+		r.fail(ErrOverflow)
+		return 0
+	}
+	return v
+}
+
+// Int reads a zigzag encoded varint, which must fit in bits bits, or in an
+// int if bits is 0.
+func (r *Reader) Int(bits int) int64 {
+	if bits == 0 {
+		bits = 32 << (^uint(0) >> 63)
+	}
+	u := r.uvarint()
+	v := int64(u>>1) ^ -int64(u&1)
+	if bits < 64 && (v < -1<<uint(bits-1) || v >= 1<<uint(bits-1)) {
+		r.fail(ErrOverflow)
+		return 0
+	}
+	return v
+}
+
+// Byte reads a byte.
+func (r *Reader) Byte() byte {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+// Bool reads a bool.
+func (r *Reader) Bool() bool {
+	switch b := r.Byte(); b {
+	case 0:
+		return false
+	case 1:
+		return true
+	default:
+		r.fail(fmt.Errorf("binutil: invalid bool %d", b))
+		return false
+	}
+}
+
+// Float32 reads a float32.
+func (r *Reader) Float32() float32 {
+	if b := r.next(4); b != nil {
+		return math.Float32frombits(binary.LittleEndian.Uint32(b))
+	}
+	return 0
+}
+
+// Float64 reads a float64.
+func (r *Reader) Float64() float64 {
+	if b := r.next(8); b != nil {
+		return math.Float64frombits(binary.LittleEndian.Uint64(b))
+	}
+	return 0
+}
+
+// String reads a string.
+func (r *Reader) String() string {
+	n := r.Uint(0)
+	if n > uint64(len(r.data)-r.pos) {
+		r.fail(ErrTruncated)
+		return ""
+	}
+	return string(r.next(int(n)))
+}
+
+// ByteSlice reads a copy of a byte slice.
+func (r *Reader) ByteSlice() []byte {
+	n := r.Len()
+	if n < 0 {
+		return nil
+	}
+	return append([]byte{}, r.next(n)...)
+}
+
+// Len reads the length of a slice or a map, -1 standing for nil. As every
+// item takes at least a byte, a length larger than the rest of the input is
+// an error, which keeps corrupt input from making callers allocate much.
+func (r *Reader) Len() int {
+	n := r.Uint(0)
+	if n > uint64(len(r.data)-r.pos)+1 {
+		r.fail(ErrTruncated)
+		return -1
+	}
+	return int(n) - 1
+}
+
+// Unmarshal reads a value written by Writer.Marshal, passing it to the
+// UnmarshalBinary method of u.
+func (r *Reader) Unmarshal(u encoding.BinaryUnmarshaler) {
+	n := r.Uint(0)
+	if n > uint64(len(r.data)-r.pos) {
+		r.fail(ErrTruncated)
+		return
+	}
+	if b := r.next(int(n)); b != nil {
+		if err := u.UnmarshalBinary(b); err != nil {
+			r.fail(err)
+		}
+	}
+}
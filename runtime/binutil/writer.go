@@ -0,0 +1,132 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package binutil holds the helpers used by the code binary-gen generates.
+//
+// A value is written as a header, the uvarint version of its type followed by
+// the 32-bit little-endian hash of its layout, and then its fields in order:
+// integers as varints, zigzag encoded if signed, bytes and bools as single
+// bytes, floats as their little-endian IEEE 754 bits, and strings, byte
+// slices and the results of MarshalBinary methods prefixed by their uvarint
+// length. Slices and maps are prefixed by their length plus one, zero
+// standing for nil, pointers by a byte which is 1 if they are not nil, and
+// arrays and nested structs are written as their items and fields, without a
+// prefix.
+package binutil
+
+import (
+	"encoding"
+	"encoding/binary"
+	"math"
+)
+
+// Writer appends encoded values to a buffer. The first error met, by a
+// MarshalBinary method, is kept and returned by Bytes.
+type Writer struct {
+	buf []byte
+	err error
+}
+
+// NewWriter returns a Writer whose buffer starts with room for size bytes.
+func NewWriter(size int) *Writer {
+	return &Writer{buf: make([]byte, 0, size)}
+}
+
+// Bytes returns the encoded values, or the first error met.
+func (w *Writer) Bytes() ([]byte, error) {
+	if w.err != nil {
+		return nil, w.err
+	}
+	return w.buf, nil
+}
+
+// Header writes the version and the layout hash of the type of the value
+// which follows.
+func (w *Writer) Header(version uint64, layout uint32) {
+	w.Uint(version)
+	w.buf = append(w.buf, byte(layout), byte(layout>>8), byte(layout>>16), byte(layout>>24))
+}
+
+// Uint writes v as a uvarint.
+func (w *Writer) Uint(v uint64) {
+	for v >= 0x80 {
+		w.buf = append(w.buf, byte(v)|0x80)
+		v >>= 7
+	}
+	w.buf = append(w.buf, byte(v))
+}
+
+// Int writes v as a zigzag encoded varint.
+func (w *Writer) Int(v int64) {
+	w.Uint(uint64(v<<1) ^ uint64(v>>63))
+}
+
+// Byte writes v.
+func (w *Writer) Byte(v byte) {
+	w.buf = append(w.buf, v)
+}
+
+// Bool writes v as a byte.
+func (w *Writer) Bool(v bool) {
+	if v {
+		w.buf = append(w.buf, 1)
+	} else {
+		w.buf = append(w.buf, 0)
+	}
+}
+
+// Float32 writes the bits of v.
+func (w *Writer) Float32(v float32) {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], math.Float32bits(v))
+	w.buf = append(w.buf, b[:]...)
+}
+
+// Float64 writes the bits of v.
+func (w *Writer) Float64(v float64) {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], math.Float64bits(v))
+	w.buf = append(w.buf, b[:]...)
+}
+
+// String writes the length of s, then s.
+func (w *Writer) String(s string) {
+	w.Uint(uint64(len(s)))
+	w.buf = append(w.buf, s...)
+}
+
+// ByteSlice writes the length of b, plus one unless b is nil, then b.
+func (w *Writer) ByteSlice(b []byte) {
+	if b == nil {
+		w.buf = append(w.buf, 0)
+		return
+	}
+	w.Uint(uint64(len(b)) + 1)
+	w.buf = append(w.buf, b...)
+}
+
+// Len writes the length of a slice or a map, n, or -1 if it is nil.
+func (w *Writer) Len(n int) {
+	w.Uint(uint64(n + 1))
+}
+
+// Marshal writes the result of the MarshalBinary method of m, prefixed by
+// its length.
+func (w *Writer) Marshal(m encoding.BinaryMarshaler) {
+	data, err := m.MarshalBinary()
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	w.String(string(data))
+}
@@ -0,0 +1,253 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cache holds the generic object cache the typed listers lister-gen
+// generates read from.
+package cache
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// NamespaceIndex is the name of the index of objects by namespace, which the
+// listers of namespaced resources list a namespace with.
+const NamespaceIndex = "namespace"
+
+// Indexer is a cache of objects by key, with indexes. Objects are stored as
+// pointers to the types of the resources.
+type Indexer interface {
+	// GetByKey returns the object with the key, and whether there is one.
+	GetByKey(key string) (obj interface{}, exists bool, err error)
+	// List returns all the objects.
+	List() []interface{}
+	// ByIndex returns the objects whose values for the index include the
+	// value.
+	ByIndex(indexName, indexedValue string) ([]interface{}, error)
+}
+
+// KeyFunc returns the key of an object.
+type KeyFunc func(obj interface{}) (string, error)
+
+// IndexFunc returns the values of an object for an index.
+type IndexFunc func(obj interface{}) ([]string, error)
+
+// Indexers are index functions by the names of their indexes.
+type Indexers map[string]IndexFunc
+
+// NamespacedKey returns the key of the object with the name in the
+// namespace, as listers get objects by: the name for the empty namespace,
+// and "namespace/name" otherwise.
+func NamespacedKey(namespace, name string) string {
+	if len(namespace) == 0 {
+		return name
+	}
+	return namespace + "/" + name
+}
+
+// SplitKey returns the namespace and name of a key made by NamespacedKey.
+func SplitKey(key string) (namespace, name string) {
+	if i := strings.Index(key, "/"); i >= 0 {
+		return key[:i], key[i+1:]
+	}
+	return "", key
+}
+
+// NotFoundError is the error of getting an object not in a cache.
+type NotFoundError struct {
+	Resource string
+	Key      string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s %q not found", e.Resource, e.Key)
+}
+
+// NewNotFound returns the error of getting the object of the resource with
+// the key.
+func NewNotFound(resource, key string) error {
+	return &NotFoundError{Resource: resource, Key: key}
+}
+
+// IsNotFound returns true if err is a NotFoundError.
+func IsNotFound(err error) bool {
+	_, ok := err.(*NotFoundError)
+	return ok
+}
+
+// Store is an Indexer kept in memory, which is safe for concurrent use. It is
+// filled by calls to Add, Update and Delete, usually from a watch of the API.
+type Store struct {
+	keyFunc  KeyFunc
+	indexers Indexers
+
+	lock  sync.RWMutex
+	items map[string]interface{}
+	// The keys of the objects by index, then by indexed value.
+	indices map[string]map[string]map[string]bool
+}
+
+var _ Indexer = &Store{}
+
+// NewStore returns an empty store keying objects with keyFunc, and indexing
+// them with indexers.
+func NewStore(keyFunc KeyFunc, indexers Indexers) *Store {
+	s := &Store{
+		keyFunc:  keyFunc,
+		indexers: Indexers{},
+		items:    map[string]interface{}{},
+		indices:  map[string]map[string]map[string]bool{},
+	}
+	for name, f := range indexers {
+		s.indexers[name] = f
+		s.indices[name] = map[string]map[string]bool{}
+	}
+	return s
+}
+
+// Add adds the object to the store, replacing any with the same key.
+func (s *Store) Add(obj interface{}) error {
+	key, err := s.keyFunc(obj)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if old, ok := s.items[key]; ok {
+		if err := s.unindex(key, old); err != nil {
+			return err
+		}
+	}
+	if err := s.index(key, obj); err != nil {
+		return err
+	}
+	s.items[key] = obj
+	return nil
+}
+
+// Update replaces the object in the store, or adds it.
+func (s *Store) Update(obj interface{}) error {
+	return s.Add(obj)
+}
+
+// Delete removes the object from the store, if it is there.
+func (s *Store) Delete(obj interface{}) error {
+	key, err := s.keyFunc(obj)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	old, ok := s.items[key]
+	if !ok {
+		return nil
+	}
+	if err := s.unindex(key, old); err != nil {
+		return err
+	}
+	delete(s.items, key)
+	return nil
+}
+
+// GetByKey returns the object with the key, and whether there is one.
+func (s *Store) GetByKey(key string) (interface{}, bool, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	obj, ok := s.items[key]
+	return obj, ok, nil
+}
+
+// List returns all the objects, sorted by key.
+func (s *Store) List() []interface{} {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.sorted(s.items)
+}
+
+// ListKeys returns the keys of all the objects, sorted.
+func (s *Store) ListKeys() []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	keys := make([]string, 0, len(s.items))
+	for key := range s.items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ByIndex returns the objects whose values for the index include the value,
+// sorted by key.
+func (s *Store) ByIndex(indexName, indexedValue string) ([]interface{}, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	index, ok := s.indices[indexName]
+	if !ok {
+		return nil, fmt.Errorf("index %q does not exist", indexName)
+	}
+	items := map[string]interface{}{}
+	for key := range index[indexedValue] {
+		items[key] = s.items[key]
+	}
+	return s.sorted(items), nil
+}
+
+func (s *Store) sorted(items map[string]interface{}) []interface{} {
+	keys := make([]string, 0, len(items))
+	for key := range items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	out := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		out = append(out, items[key])
+	}
+	return out
+}
+
+func (s *Store) index(key string, obj interface{}) error {
+	for name, f := range s.indexers {
+		values, err := f(obj)
+		if err != nil {
+			return fmt.Errorf("index %q: %v", name, err)
+		}
+		index := s.indices[name]
+		for _, value := range values {
+			if index[value] == nil {
+				index[value] = map[string]bool{}
+			}
+			index[value][key] = true
+		}
+	}
+	return nil
+}
+
+func (s *Store) unindex(key string, obj interface{}) error {
+	for name, f := range s.indexers {
+		values, err := f(obj)
+		if err != nil {
+			return fmt.Errorf("index %q: %v", name, err)
+		}
+		index := s.indices[name]
+		for _, value := range values {
+			delete(index[value], key)
+			if len(index[value]) == 0 {
+				delete(index, value)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package env holds the error types and helpers used by the LoadFromEnv
+// methods env-gen generates.
+package env
+
+import (
+	"strings"
+)
+
+// Error is an environment variable which could not be loaded.
+type Error struct {
+	Var     string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Var + ": " + e.Message
+}
+
+// Errors is every variable which could not be loaded.
+type Errors []*Error
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ErrorOrNil returns e as an error, or nil if it is empty.
+func (e Errors) ErrorOrNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Missing returns the error of a required variable which is not set.
+func Missing(name string) *Error {
+	return &Error{Var: name, Message: "is required but not set"}
+}
+
+// Invalid returns the error of a variable whose value could not be parsed.
+func Invalid(name string, err error) *Error {
+	return &Error{Var: name, Message: err.Error()}
+}
+
+// Split returns the comma separated items of a list value, trimmed of
+// spaces. An empty value is an empty list.
+func Split(value string) []string {
+	if len(strings.TrimSpace(value)) == 0 {
+		return []string{}
+	}
+	items := strings.Split(value, ",")
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+	}
+	return items
+}
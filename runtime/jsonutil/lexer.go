@@ -0,0 +1,374 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Lexer reads a JSON document token by token. The first error it meets is
+// kept, and every later call is a no-op returning a zero value, so that
+// generated code only needs to check Error once at the end.
+type Lexer struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+// NewLexer returns a Lexer reading data.
+func NewLexer(data []byte) *Lexer {
+	return &Lexer{data: data}
+}
+
+// Error returns the first error met, if any.
+func (l *Lexer) Error() error {
+	return l.err
+}
+
+func (l *Lexer) fail(format string, args ...interface{}) {
+	if l.err == nil {
+		l.err = fmt.Errorf("json: offset %d: %s", l.pos, fmt.Sprintf(format, args...))
+	}
+}
+
+func (l *Lexer) skipSpace() {
+	for l.pos < len(l.data) {
+		switch l.data[l.pos] {
+		case ' ', '\t', '\n', '\r':
+			l.pos++
+		default:
+			return
+		}
+	}
+}
+
+// peek returns the next non-space byte, or 0 at the end of the input.
+func (l *Lexer) peek() byte {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return 0
+	}
+	return l.data[l.pos]
+}
+
+// End checks that nothing but spaces follows the value just read.
+func (l *Lexer) End() {
+	if l.err == nil && l.peek() != 0 {
+		l.fail("unexpected %q after top-level value", l.data[l.pos])
+	}
+}
+
+// Null consumes a null and returns true, if one is next.
+func (l *Lexer) Null() bool {
+	if l.err != nil || l.peek() != 'n' {
+		return false
+	}
+	l.literal("null")
+	return l.err == nil
+}
+
+func (l *Lexer) literal(lit string) {
+	if len(l.data)-l.pos < len(lit) || string(l.data[l.pos:l.pos+len(lit)]) != lit {
+		l.fail("invalid literal, expected %s", lit)
+		return
+	}
+	l.pos += len(lit)
+}
+
+// Delim consumes the delimiter c, one of '{' or '['.
+func (l *Lexer) Delim(c byte) {
+	if l.err != nil {
+		return
+	}
+	if l.peek() != c {
+		l.fail("expected %q", c)
+		return
+	}
+	l.pos++
+}
+
+// More reports whether another element of the current object or array
+// follows, consuming the separating comma. At the closing delimiter 'end' it
+// consumes it and returns false.
+func (l *Lexer) More(end byte) bool {
+	if l.err != nil {
+		return false
+	}
+	c := l.peek()
+	if c == end {
+		l.pos++
+		return false
+	}
+	// A comma is required unless this is the first element.
+	prev := l.pos - 1
+	for prev >= 0 && (l.data[prev] == ' ' || l.data[prev] == '\t' || l.data[prev] == '\n' || l.data[prev] == '\r') {
+		prev--
+	}
+	if prev >= 0 && l.data[prev] != '{' && l.data[prev] != '[' {
+		if c != ',' {
+			l.fail("expected ',' or %q", end)
+			return false
+		}
+		l.pos++
+	}
+	return true
+}
+
+// Key reads an object key and the colon following it.
+func (l *Lexer) Key() string {
+	key := l.String()
+	if l.err == nil {
+		if l.peek() != ':' {
+			l.fail("expected ':' after object key")
+			return ""
+		}
+		l.pos++
+	}
+	return key
+}
+
+// Field reads an object key, and returns the first of 'names' it equals, or
+// else the first it equals ignoring case, as encoding/json matches keys with
+// the names of fields. If there is neither, it returns the key.
+func (l *Lexer) Field(names ...string) string {
+	key := l.Key()
+	for _, name := range names {
+		if key == name {
+			return name
+		}
+	}
+	for _, name := range names {
+		if strings.EqualFold(key, name) {
+			return name
+		}
+	}
+	return key
+}
+
+// String reads a string.
+func (l *Lexer) String() string {
+	if l.err != nil {
+		return ""
+	}
+	if l.peek() != '"' {
+		l.fail("expected string")
+		return ""
+	}
+	l.pos++
+	start := l.pos
+	// Fast path: no escapes.
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if c == '"' {
+			s := string(l.data[start:l.pos])
+			l.pos++
+			return s
+		}
+		if c == '\\' || c < 0x20 {
+			break
+		}
+		l.pos++
+	}
+	buf := append([]byte(nil), l.data[start:l.pos]...)
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case c == '"':
+			l.pos++
+			return string(buf)
+		case c < 0x20:
+			l.fail("invalid character in string")
+			return ""
+		case c != '\\':
+			buf = append(buf, c)
+			l.pos++
+			continue
+		}
+		l.pos++
+		if l.pos >= len(l.data) {
+			break
+		}
+		c = l.data[l.pos]
+		l.pos++
+		switch c {
+		case '"', '\\', '/':
+			buf = append(buf, c)
+		case 'b':
+			buf = append(buf, '\b')
+		case 'f':
+			buf = append(buf, '\f')
+		case 'n':
+			buf = append(buf, '\n')
+		case 'r':
+			buf = append(buf, '\r')
+		case 't':
+			buf = append(buf, '\t')
+		case 'u':
+			r := l.hex4()
+			if utf16.IsSurrogate(r) && l.pos+1 < len(l.data) && l.data[l.pos] == '\\' && l.data[l.pos+1] == 'u' {
+				l.pos += 2
+				r = utf16.DecodeRune(r, l.hex4())
+			}
+			if !utf8.ValidRune(r) {
+				r = utf8.RuneError
+			}
+			buf = append(buf, string(r)...)
+		default:
+			l.fail("invalid escape %q in string", c)
+			return ""
+		}
+	}
+	l.fail("unterminated string")
+	return ""
+}
+
+func (l *Lexer) hex4() rune {
+	if len(l.data)-l.pos < 4 {
+		l.fail("invalid unicode escape")
+		return utf8.RuneError
+	}
+	v, err := strconv.ParseUint(string(l.data[l.pos:l.pos+4]), 16, 32)
+	if err != nil {
+		l.fail("invalid unicode escape")
+		return utf8.RuneError
+	}
+	l.pos += 4
+	return rune(v)
+}
+
+// Bool reads a boolean.
+func (l *Lexer) Bool() bool {
+	if l.err != nil {
+		return false
+	}
+	switch l.peek() {
+	case 't':
+		l.literal("true")
+		return l.err == nil
+	case 'f':
+		l.literal("false")
+	default:
+		l.fail("expected boolean")
+	}
+	return false
+}
+
+func (l *Lexer) number() string {
+	if l.err != nil {
+		return ""
+	}
+	l.skipSpace()
+	start := l.pos
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if (c < '0' || c > '9') && c != '-' && c != '+' && c != '.' && c != 'e' && c != 'E' {
+			break
+		}
+		l.pos++
+	}
+	if start == l.pos {
+		l.fail("expected number")
+	}
+	return string(l.data[start:l.pos])
+}
+
+// Int64 reads an integer which fits in 'bits' bits.
+func (l *Lexer) Int64(bits int) int64 {
+	n := l.number()
+	if l.err != nil {
+		return 0
+	}
+	v, err := strconv.ParseInt(n, 10, bits)
+	if err != nil {
+		l.fail("invalid integer %s", n)
+	}
+	return v
+}
+
+// Uint64 reads an unsigned integer which fits in 'bits' bits.
+func (l *Lexer) Uint64(bits int) uint64 {
+	n := l.number()
+	if l.err != nil {
+		return 0
+	}
+	v, err := strconv.ParseUint(n, 10, bits)
+	if err != nil {
+		l.fail("invalid unsigned integer %s", n)
+	}
+	return v
+}
+
+// Float64 reads a number which fits in a float of 'bits' bits.
+func (l *Lexer) Float64(bits int) float64 {
+	n := l.number()
+	if l.err != nil {
+		return 0
+	}
+	v, err := strconv.ParseFloat(n, bits)
+	if err != nil {
+		l.fail("invalid number %s", n)
+	}
+	return v
+}
+
+// Skip consumes the next value, whatever it is.
+func (l *Lexer) Skip() {
+	if l.err != nil {
+		return
+	}
+	switch l.peek() {
+	case '{':
+		l.pos++
+		for l.More('}') {
+			l.Key()
+			l.Skip()
+		}
+	case '[':
+		l.pos++
+		for l.More(']') {
+			l.Skip()
+		}
+	case '"':
+		_ = l.String()
+	case 't', 'f':
+		l.Bool()
+	case 'n':
+		l.Null()
+	default:
+		l.number()
+	}
+}
+
+// Unmarshal decodes the next value into v with encoding/json. It is used for
+// values the generated code does not decode itself.
+func (l *Lexer) Unmarshal(v interface{}) {
+	if l.err != nil {
+		return
+	}
+	l.skipSpace()
+	start := l.pos
+	l.Skip()
+	if l.err != nil {
+		return
+	}
+	if err := json.Unmarshal(l.data[start:l.pos], v); err != nil && l.err == nil {
+		l.err = err
+	}
+}
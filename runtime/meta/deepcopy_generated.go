@@ -47,3 +47,28 @@ func (in *Meta) DeepCopy() *Meta {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an auto-generated deepcopy function, coping the receiver, writing into out. in must be no-nil.
+func (in *Resource) DeepCopyInto(out *Resource) {
+	*out = *in
+	in.Meta.DeepCopyInto(&out.Meta)
+	return
+}
+
+// DeepCopy is an auto-generated deepcopy function, copying the receiver, creating a new Resource.
+func (in *Resource) DeepCopy() *Resource {
+	if in == nil {
+		return nil
+	}
+	out := new(Resource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an auto-generated deepcopy function, copying the receiver, creating a new Resource.
+func (in *Resource) DeepCopyObject() Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
@@ -11,10 +11,17 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-// +gogo:deepcopy-gen=package
+// +gogogen:deepcopy-gen=package
 package meta
 
-// +gogo:deepcopy-gen=true
+// Object is implemented by every resource which can be deep copied without
+// knowing its concrete type. deepcopy-gen implements it for types tagged with
+//   // +gogogen:deepcopy-gen:interfaces=github.com/lack-io/gogogen/runtime/meta.Object
+type Object interface {
+	DeepCopyObject() Object
+}
+
+// +gogogen:deepcopy-gen=true
 // +gogo:genproto=true
 // 资源元数据
 type Meta struct {
@@ -38,6 +45,8 @@ type Meta struct {
 	Annotations map[string]string `json:"annotations" protobuf:"bytes,9,rep,name=annotations"`
 }
 
+// +gogogen:deepcopy-gen=true
+// +gogogen:deepcopy-gen:interfaces=github.com/lack-io/gogogen/runtime/meta.Object
 // +gogo:genproto=true
 // 资源元数据
 type Resource struct {
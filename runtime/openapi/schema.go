@@ -0,0 +1,48 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package openapi holds the OpenAPI v3 schema model used by the code
+// openapi-gen generates.
+package openapi
+
+// Schema is an OpenAPI v3 Schema Object. Only the parts openapi-gen produces
+// are modeled.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Default              interface{}        `json:"default,omitempty"`
+}
+
+// Document is the part of an OpenAPI document openapi-gen writes, when it
+// writes standalone documents.
+type Document struct {
+	Components Components `json:"components"`
+}
+
+// Components is the components section of an OpenAPI document, which holds
+// reusable schemas.
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+// RefPrefix is how references to schemas in the components section of a
+// document start.
+const RefPrefix = "#/components/schemas/"
@@ -0,0 +1,260 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package prettyutil holds the Printer the String methods generated by
+// pretty-gen write to.
+package prettyutil
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Formatter is implemented by the types pretty-gen generates methods for.
+type Formatter interface {
+	FormatTo(p *Printer)
+}
+
+// Redacted is written in place of secret values.
+const Redacted = "<redacted>"
+
+// frame is a struct, list or map being written.
+type frame struct {
+	// The number of fields or items written, and, for lists, the number of
+	// items there are.
+	n, total int
+	// For maps, where the entries start, and where the keys and the values
+	// of each of them start.
+	start        int
+	keys, values []int
+}
+
+// Printer writes values in a compact, Go-like form, such as
+// Name{Field: "value", List: [1, 2, ... (+3 more)], Map: {"a": 1}}.
+//
+// Structs, lists and maps are opened and closed explicitly. Lists show at
+// most the given number of items, and so do maps, whose entries are sorted
+// by their keys, numerically if they are numbers, so that the output doesn't
+// depend on the order they were written in.
+type Printer struct {
+	buf      []byte
+	stack    []*frame
+	maxItems int
+}
+
+// NewPrinter returns an empty Printer, showing at most maxItems items of
+// every list and map, or all of them if maxItems isn't positive.
+func NewPrinter(maxItems int) *Printer {
+	return &Printer{maxItems: maxItems}
+}
+
+// String returns what was written.
+func (p *Printer) String() string {
+	return string(p.buf)
+}
+
+func (p *Printer) push(f *frame) {
+	p.stack = append(p.stack, f)
+}
+
+func (p *Printer) pop() *frame {
+	f := p.stack[len(p.stack)-1]
+	p.stack = p.stack[:len(p.stack)-1]
+	return f
+}
+
+func (p *Printer) top() *frame {
+	return p.stack[len(p.stack)-1]
+}
+
+// BeginStruct starts a struct named name, which may be empty.
+func (p *Printer) BeginStruct(name string) {
+	p.buf = append(p.buf, name...)
+	p.buf = append(p.buf, '{')
+	p.push(&frame{})
+}
+
+// Field starts the field name of the current struct; its value follows.
+func (p *Printer) Field(name string) {
+	f := p.top()
+	if f.n > 0 {
+		p.buf = append(p.buf, ", "...)
+	}
+	f.n++
+	p.buf = append(p.buf, name...)
+	p.buf = append(p.buf, ": "...)
+}
+
+// EndStruct ends the current struct.
+func (p *Printer) EndStruct() {
+	p.pop()
+	p.buf = append(p.buf, '}')
+}
+
+// BeginList starts a list of n items.
+func (p *Printer) BeginList(n int) {
+	p.buf = append(p.buf, '[')
+	p.push(&frame{total: n})
+}
+
+// Item starts the next item of the current list, and returns false, writing
+// nothing, once as many items as shown were written.
+func (p *Printer) Item() bool {
+	f := p.top()
+	if p.maxItems > 0 && f.n >= p.maxItems {
+		return false
+	}
+	if f.n > 0 {
+		p.buf = append(p.buf, ", "...)
+	}
+	f.n++
+	return true
+}
+
+// EndList ends the current list, telling how many of its items weren't
+// shown.
+func (p *Printer) EndList() {
+	f := p.pop()
+	if f.n < f.total {
+		p.more(f.n, f.total-f.n)
+	}
+	p.buf = append(p.buf, ']')
+}
+
+func (p *Printer) more(shown, left int) {
+	if shown > 0 {
+		p.buf = append(p.buf, ", "...)
+	}
+	p.buf = append(p.buf, fmt.Sprintf("... (+%d more)", left)...)
+}
+
+// BeginMap starts a map.
+func (p *Printer) BeginMap() {
+	p.buf = append(p.buf, '{')
+	p.push(&frame{start: len(p.buf)})
+}
+
+// Key starts the next entry of the current map; its key follows.
+func (p *Printer) Key() {
+	f := p.top()
+	f.keys = append(f.keys, len(p.buf))
+}
+
+// Elem follows the key of the current entry; its value follows.
+func (p *Printer) Elem() {
+	f := p.top()
+	f.values = append(f.values, len(p.buf))
+}
+
+// EndMap ends the current map, sorting its entries and leaving out those
+// that aren't shown.
+func (p *Printer) EndMap() {
+	f := p.pop()
+	type entry struct{ key, value string }
+	entries := make([]entry, len(f.keys))
+	for i, k := range f.keys {
+		end := len(p.buf)
+		if i+1 < len(f.keys) {
+			end = f.keys[i+1]
+		}
+		entries[i] = entry{string(p.buf[k:f.values[i]]), string(p.buf[f.values[i]:end])}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return less(entries[i].key, entries[j].key)
+	})
+	shown := len(entries)
+	if p.maxItems > 0 && shown > p.maxItems {
+		shown = p.maxItems
+	}
+	p.buf = p.buf[:f.start]
+	for i, e := range entries[:shown] {
+		if i > 0 {
+			p.buf = append(p.buf, ", "...)
+		}
+		p.buf = append(p.buf, e.key...)
+		p.buf = append(p.buf, ": "...)
+		p.buf = append(p.buf, e.value...)
+	}
+	if shown < len(entries) {
+		p.more(shown, len(entries)-shown)
+	}
+	p.buf = append(p.buf, '}')
+}
+
+// less orders map keys by their text, or by their value if both are numbers.
+func less(a, b string) bool {
+	x, errX := strconv.ParseFloat(a, 64)
+	y, errY := strconv.ParseFloat(b, 64)
+	if errX == nil && errY == nil && x != y {
+		return x < y
+	}
+	return a < b
+}
+
+// Nil writes a nil pointer, slice or map.
+func (p *Printer) Nil() {
+	p.buf = append(p.buf, "nil"...)
+}
+
+// Redact writes Redacted in place of a secret value.
+func (p *Printer) Redact() {
+	p.buf = append(p.buf, Redacted...)
+}
+
+// Quote writes a quoted string.
+func (p *Printer) Quote(s string) {
+	p.buf = strconv.AppendQuote(p.buf, s)
+}
+
+// Text writes s as it is, as it comes from the String method of a value.
+func (p *Printer) Text(s string) {
+	p.buf = append(p.buf, s...)
+}
+
+// Bool writes a bool.
+func (p *Printer) Bool(b bool) {
+	p.buf = strconv.AppendBool(p.buf, b)
+}
+
+// Int writes a signed integer.
+func (p *Printer) Int(i int64) {
+	p.buf = strconv.AppendInt(p.buf, i, 10)
+}
+
+// Uint writes an unsigned integer.
+func (p *Printer) Uint(u uint64) {
+	p.buf = strconv.AppendUint(p.buf, u, 10)
+}
+
+// Float writes a float of the given bit size.
+func (p *Printer) Float(f float64, bits int) {
+	p.buf = strconv.AppendFloat(p.buf, f, 'g', -1, bits)
+}
+
+// Bytes writes the length of a byte slice, rather than its content, which
+// is rarely readable.
+func (p *Printer) Bytes(b []byte) {
+	if b == nil {
+		p.Nil()
+		return
+	}
+	p.buf = append(p.buf, fmt.Sprintf("[%d bytes]", len(b))...)
+}
+
+// Value writes v as the %+v verb of the fmt package does, for the values
+// that have no better form.
+func (p *Printer) Value(v interface{}) {
+	p.buf = append(p.buf, fmt.Sprintf("%+v", v)...)
+}
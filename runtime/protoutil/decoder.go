@@ -0,0 +1,214 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package protoutil
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+var (
+	// ErrTruncated is the error of input which ends in the middle of a
+	// field.
+	ErrTruncated = errors.New("protoutil: unexpected end of input")
+	// ErrOverflow is the error of a varint longer than 64 bits.
+	ErrOverflow = errors.New("protoutil: varint overflows 64 bits")
+)
+
+// Unmarshaler is implemented by the messages protomarshal-gen generates
+// code for.
+type Unmarshaler interface {
+	Unmarshal(data []byte) error
+}
+
+// Decoder reads the fields of a protobuf message. Once it meets an error,
+// it stops reading, its methods return zero values, and Error returns the
+// error, so that it need only be checked once at the end.
+type Decoder struct {
+	data []byte
+	pos  int
+	err  error
+	// The field Key read last.
+	field int
+	// The decoder of the message this one reads a part of, if any, which
+	// gets its errors too.
+	parent *Decoder
+}
+
+// NewDecoder returns a Decoder reading the message 'data'.
+func NewDecoder(data []byte) *Decoder {
+	return &Decoder{data: data}
+}
+
+// Error returns the first error met, or nil.
+func (d *Decoder) Error() error {
+	return d.err
+}
+
+func (d *Decoder) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+	if d.parent != nil {
+		d.parent.fail(err)
+	}
+}
+
+// More returns true if there is more input to read, and no error was met.
+func (d *Decoder) More() bool {
+	return d.err == nil && d.pos < len(d.data)
+}
+
+// Key reads the key of the next field, and returns its number and wire
+// type.
+func (d *Decoder) Key() (field, wireType int) {
+	x := d.Varint()
+	if d.err != nil {
+		return 0, 0
+	}
+	if x>>3 == 0 || x>>3 > math.MaxInt32 {
+		d.fail(fmt.Errorf("protoutil: invalid field number %d", x>>3))
+		return 0, 0
+	}
+	d.field = int(x >> 3)
+	return d.field, int(x & 7)
+}
+
+// Expect returns true if 'wireType', the wire type of the field Key read
+// last, is 'want'. Otherwise it fails.
+func (d *Decoder) Expect(wireType, want int) bool {
+	if wireType != want {
+		d.fail(fmt.Errorf("protoutil: field %d has wire type %d, want %d", d.field, wireType, want))
+		return false
+	}
+	return d.err == nil
+}
+
+// Varint reads a varint.
+func (d *Decoder) Varint() uint64 {
+	var x uint64
+	for shift := uint(0); ; shift += 7 {
+		if d.err != nil {
+			return 0
+		}
+		if shift >= 64 {
+			d.fail(ErrOverflow)
+			return 0
+		}
+		if d.pos >= len(d.data) {
+			d.fail(ErrTruncated)
+			return 0
+		}
+		b := d.data[d.pos]
+		d.pos++
+		x |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			return x
+		}
+	}
+}
+
+// Fixed32 reads four bytes in little-endian order.
+func (d *Decoder) Fixed32() uint32 {
+	b := d.next(4)
+	if b == nil {
+		return 0
+	}
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+}
+
+// Fixed64 reads eight bytes in little-endian order.
+func (d *Decoder) Fixed64() uint64 {
+	b := d.next(8)
+	if b == nil {
+		return 0
+	}
+	return uint64(b[0]) | uint64(b[1])<<8 | uint64(b[2])<<16 | uint64(b[3])<<24 |
+		uint64(b[4])<<32 | uint64(b[5])<<40 | uint64(b[6])<<48 | uint64(b[7])<<56
+}
+
+// next returns the next 'n' bytes of input, or nil if there are fewer.
+func (d *Decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.data)-d.pos {
+		d.fail(ErrTruncated)
+		return nil
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b
+}
+
+// delimited reads a length-delimited value, without copying it.
+func (d *Decoder) delimited() []byte {
+	n := d.Varint()
+	if n > uint64(len(d.data)) {
+		d.fail(ErrTruncated)
+		return nil
+	}
+	return d.next(int(n))
+}
+
+// Bytes reads a length-delimited value into a new slice.
+func (d *Decoder) Bytes() []byte {
+	b := d.delimited()
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
+
+// String reads a length-delimited value as a string.
+func (d *Decoder) String() string {
+	return string(d.delimited())
+}
+
+// Nested reads a length-delimited value and returns a Decoder reading it,
+// for packed repeated fields and map entries. Its errors are this
+// decoder's too.
+func (d *Decoder) Nested() *Decoder {
+	return &Decoder{data: d.delimited(), err: d.err, parent: d}
+}
+
+// Message reads a length-delimited value, and unmarshals it into m.
+func (d *Decoder) Message(m Unmarshaler) {
+	b := d.delimited()
+	if d.err != nil {
+		return
+	}
+	if err := m.Unmarshal(b); err != nil {
+		d.fail(err)
+	}
+}
+
+// Skip reads the value of a field of type 'wireType', for fields the
+// message doesn't know.
+func (d *Decoder) Skip(wireType int) {
+	switch wireType {
+	case WireVarint:
+		d.Varint()
+	case WireFixed64:
+		d.next(8)
+	case WireBytes:
+		d.delimited()
+	case WireFixed32:
+		d.next(4)
+	default:
+		d.fail(fmt.Errorf("protoutil: field %d has unsupported wire type %d", d.field, wireType))
+	}
+}
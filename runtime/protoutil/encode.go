@@ -0,0 +1,133 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package protoutil holds the helpers used by the code protomarshal-gen
+// generates, which reads and writes the protobuf wire format.
+package protoutil
+
+// The wire types of protobuf fields.
+const (
+	WireVarint  = 0
+	WireFixed64 = 1
+	WireBytes   = 2
+	WireFixed32 = 5
+)
+
+// SizeVarint returns the number of bytes the varint encoding of x takes.
+func SizeVarint(x uint64) int {
+	n := 1
+	for x >= 0x80 {
+		x >>= 7
+		n++
+	}
+	return n
+}
+
+// PutVarint writes the varint encoding of x to b at i, and returns the
+// index following it.
+func PutVarint(b []byte, i int, x uint64) int {
+	for x >= 0x80 {
+		b[i] = byte(x) | 0x80
+		x >>= 7
+		i++
+	}
+	b[i] = byte(x)
+	return i + 1
+}
+
+// PutBool writes v to b at i as a varint, and returns the index following
+// it.
+func PutBool(b []byte, i int, v bool) int {
+	b[i] = 0
+	if v {
+		b[i] = 1
+	}
+	return i + 1
+}
+
+// PutFixed32 writes x to b at i in little-endian order, and returns the
+// index following it.
+func PutFixed32(b []byte, i int, x uint32) int {
+	b[i] = byte(x)
+	b[i+1] = byte(x >> 8)
+	b[i+2] = byte(x >> 16)
+	b[i+3] = byte(x >> 24)
+	return i + 4
+}
+
+// PutFixed64 writes x to b at i in little-endian order, and returns the
+// index following it.
+func PutFixed64(b []byte, i int, x uint64) int {
+	i = PutFixed32(b, i, uint32(x))
+	return PutFixed32(b, i, uint32(x>>32))
+}
+
+// PutString writes s to b at i, preceded by its length, and returns the
+// index following it.
+func PutString(b []byte, i int, s string) int {
+	i = PutVarint(b, i, uint64(len(s)))
+	return i + copy(b[i:], s)
+}
+
+// PutBytes writes v to b at i, preceded by its length, and returns the
+// index following it.
+func PutBytes(b []byte, i int, v []byte) int {
+	i = PutVarint(b, i, uint64(len(v)))
+	return i + copy(b[i:], v)
+}
+
+// Zigzag32 maps v to an unsigned integer the way sint32 fields are
+// encoded, so that small negative numbers have short encodings.
+func Zigzag32(v int32) uint64 {
+	return uint64(uint32(v<<1) ^ uint32(v>>31))
+}
+
+// Zigzag64 maps v to an unsigned integer the way sint64 fields are
+// encoded.
+func Zigzag64(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+// Unzigzag32 undoes Zigzag32.
+func Unzigzag32(x uint64) int32 {
+	return int32(uint32(x)>>1) ^ -int32(x&1)
+}
+
+// Unzigzag64 undoes Zigzag64.
+func Unzigzag64(x uint64) int64 {
+	return int64(x>>1) ^ -int64(x&1)
+}
+
+// Marshaler is implemented by the messages protomarshal-gen generates code
+// for.
+type Marshaler interface {
+	Size() int
+	MarshalTo(b []byte) (int, error)
+}
+
+// SizeMessage returns the size of the encoding of m, preceded by its
+// length.
+func SizeMessage(m Marshaler) int {
+	n := m.Size()
+	return SizeVarint(uint64(n)) + n
+}
+
+// PutMessage writes the encoding of m to b at i, preceded by its length,
+// and returns the index following it.
+func PutMessage(b []byte, i int, m Marshaler) (int, error) {
+	n := m.Size()
+	i = PutVarint(b, i, uint64(n))
+	written, err := m.MarshalTo(b[i : i+n])
+	return i + written, err
+}
@@ -0,0 +1,117 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package rest holds the HTTP client the typed clients client-gen generates
+// are built on.
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Transport sends HTTP requests. *http.Client implements it; other
+// implementations may add authentication or retries, or answer requests in
+// tests.
+type Transport interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Client sends JSON requests to the API served at a base URL.
+type Client struct {
+	baseURL   string
+	transport Transport
+}
+
+// NewClient returns a client of the API served at baseURL, sending requests
+// with transport, or with http.DefaultClient if transport is nil.
+func NewClient(baseURL string, transport Transport) *Client {
+	if transport == nil {
+		transport = http.DefaultClient
+	}
+	return &Client{baseURL: strings.TrimSuffix(baseURL, "/"), transport: transport}
+}
+
+// StatusError is the error of a request answered with a status other than
+// 2xx.
+type StatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	// The body of the response, which usually explains the error.
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	msg := fmt.Sprintf("%s %s: %d %s", e.Method, e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+	if len(e.Body) > 0 {
+		msg += ": " + e.Body
+	}
+	return msg
+}
+
+// IsNotFound returns true if err is a StatusError for a 404 response.
+func IsNotFound(err error) bool {
+	se, ok := err.(*StatusError)
+	return ok && se.StatusCode == http.StatusNotFound
+}
+
+// Do sends a request with 'in' as its JSON body, unless it is nil, to the
+// path under the base URL, and decodes the JSON body of the response into
+// 'out', unless it is nil.
+func (c *Client) Do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	url := c.baseURL + path
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.transport.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &StatusError{Method: method, URL: url, StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(data))}
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("%s %s: decoding response: %v", method, url, err)
+	}
+	return nil
+}
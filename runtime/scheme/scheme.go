@@ -0,0 +1,200 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package scheme maps the kinds of API objects to their Go types, so that
+// objects can be created and identified by the group, version and kind
+// they are sent with. register-gen writes the code adding the types of an
+// API package to a scheme.
+package scheme
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// GroupVersion is the group and version of an API.
+type GroupVersion struct {
+	Group   string
+	Version string
+}
+
+// String returns the group and version as an API version, as in
+// "example.com/v1", or just the version for the empty group.
+func (gv GroupVersion) String() string {
+	if len(gv.Group) == 0 {
+		return gv.Version
+	}
+	return gv.Group + "/" + gv.Version
+}
+
+// WithKind returns the kind of the group and version.
+func (gv GroupVersion) WithKind(kind string) GroupVersionKind {
+	return GroupVersionKind{Group: gv.Group, Version: gv.Version, Kind: kind}
+}
+
+// GroupVersionKind is the kind of an API object.
+type GroupVersionKind struct {
+	Group   string
+	Version string
+	Kind    string
+}
+
+// GroupVersion returns the group and version of the kind.
+func (gvk GroupVersionKind) GroupVersion() GroupVersion {
+	return GroupVersion{Group: gvk.Group, Version: gvk.Version}
+}
+
+// String returns the kind with its API version.
+func (gvk GroupVersionKind) String() string {
+	return gvk.GroupVersion().String() + ", Kind=" + gvk.Kind
+}
+
+// Scheme maps kinds to the Go types of their objects, and back. A type may
+// have several kinds, as when it is served in several versions.
+type Scheme struct {
+	types map[GroupVersionKind]reflect.Type
+	kinds map[reflect.Type][]GroupVersionKind
+}
+
+// NewScheme returns an empty scheme.
+func NewScheme() *Scheme {
+	return &Scheme{
+		types: map[GroupVersionKind]reflect.Type{},
+		kinds: map[reflect.Type][]GroupVersionKind{},
+	}
+}
+
+// AddKnownTypes adds the types of the objects to the scheme as kinds of the
+// group and version, each named after its type. The objects must be
+// pointers to structs.
+func (s *Scheme) AddKnownTypes(gv GroupVersion, objs ...interface{}) {
+	for _, obj := range objs {
+		t := reflect.TypeOf(obj)
+		if t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+			panic(fmt.Sprintf("scheme: type %v is not a pointer to a struct", t))
+		}
+		s.AddKnownTypeWithName(gv.WithKind(t.Elem().Name()), obj)
+	}
+}
+
+// AddKnownTypeWithName adds the type of the object to the scheme as the kind.
+// It panics if the kind is already of another type.
+func (s *Scheme) AddKnownTypeWithName(gvk GroupVersionKind, obj interface{}) {
+	t := reflect.TypeOf(obj)
+	if t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("scheme: type %v is not a pointer to a struct", t))
+	}
+	t = t.Elem()
+	if old, ok := s.types[gvk]; ok {
+		if old == t {
+			return
+		}
+		panic(fmt.Sprintf("scheme: kind %v is registered as both %v and %v", gvk, old, t))
+	}
+	s.types[gvk] = t
+	s.kinds[t] = append(s.kinds[t], gvk)
+}
+
+// Recognizes returns true if the kind is in the scheme.
+func (s *Scheme) Recognizes(gvk GroupVersionKind) bool {
+	_, ok := s.types[gvk]
+	return ok
+}
+
+// New returns a new, zero object of the kind.
+func (s *Scheme) New(gvk GroupVersionKind) (interface{}, error) {
+	t, ok := s.types[gvk]
+	if !ok {
+		return nil, fmt.Errorf("scheme: kind %v is not registered", gvk)
+	}
+	return reflect.New(t).Interface(), nil
+}
+
+// ObjectKinds returns the kinds of the type of the object.
+func (s *Scheme) ObjectKinds(obj interface{}) ([]GroupVersionKind, error) {
+	t := reflect.TypeOf(obj)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	kinds, ok := s.kinds[t]
+	if !ok {
+		return nil, fmt.Errorf("scheme: type %v is not registered", t)
+	}
+	return append([]GroupVersionKind(nil), kinds...), nil
+}
+
+// KnownTypes returns the types of the kinds of the group and version, keyed
+// by kind.
+func (s *Scheme) KnownTypes(gv GroupVersion) map[string]reflect.Type {
+	out := map[string]reflect.Type{}
+	for gvk, t := range s.types {
+		if gvk.GroupVersion() == gv {
+			out[gvk.Kind] = t
+		}
+	}
+	return out
+}
+
+// AllKnownTypes returns the types of all the kinds in the scheme.
+func (s *Scheme) AllKnownTypes() map[GroupVersionKind]reflect.Type {
+	out := make(map[GroupVersionKind]reflect.Type, len(s.types))
+	for gvk, t := range s.types {
+		out[gvk] = t
+	}
+	return out
+}
+
+// GroupVersions returns the groups and versions with kinds in the scheme,
+// sorted.
+func (s *Scheme) GroupVersions() []GroupVersion {
+	seen := map[GroupVersion]bool{}
+	out := []GroupVersion{}
+	for gvk := range s.types {
+		if gv := gvk.GroupVersion(); !seen[gv] {
+			seen[gv] = true
+			out = append(out, gv)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].String() < out[j].String() })
+	return out
+}
+
+// SchemeBuilder collects the functions adding types to a scheme, so that an
+// API package can be added to a scheme in a single call however many files
+// register types.
+type SchemeBuilder []func(*Scheme) error
+
+// NewSchemeBuilder returns a builder calling the functions.
+func NewSchemeBuilder(funcs ...func(*Scheme) error) SchemeBuilder {
+	var sb SchemeBuilder
+	sb.Register(funcs...)
+	return sb
+}
+
+// Register adds the functions to the builder.
+func (sb *SchemeBuilder) Register(funcs ...func(*Scheme) error) {
+	*sb = append(*sb, funcs...)
+}
+
+// AddToScheme calls the functions of the builder in order, stopping at the
+// first error.
+func (sb *SchemeBuilder) AddToScheme(s *Scheme) error {
+	for _, f := range *sb {
+		if err := f(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
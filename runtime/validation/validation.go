@@ -0,0 +1,107 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package validation holds the error types used by the Validate methods
+// validate-gen generates.
+package validation
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Validator is implemented by the types which check themselves.
+type Validator interface {
+	Validate() error
+}
+
+// Error is a failed check of a field.
+type Error struct {
+	// The path of the field, such as spec.containers[0].image.
+	Field   string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// Errors is every failed check found validating a value.
+type Errors []*Error
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ErrorOrNil returns e as an error, or nil if it is empty.
+func (e Errors) ErrorOrNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Nested returns the errors of validating the value of the field at 'path',
+// with their fields made relative to the value holding it.
+func Nested(path string, err error) Errors {
+	switch err := err.(type) {
+	case nil:
+		return nil
+	case Errors:
+		out := make(Errors, 0, len(err))
+		for _, e := range err {
+			out = append(out, &Error{Field: join(path, e.Field), Message: e.Message})
+		}
+		return out
+	case *Error:
+		return Errors{{Field: join(path, err.Field), Message: err.Message}}
+	}
+	return Errors{{Field: path, Message: err.Error()}}
+}
+
+// Validate validates 'v', the value of the field at 'path', if it is a
+// Validator.
+func Validate(path string, v interface{}) Errors {
+	if v, ok := v.(Validator); ok {
+		return Nested(path, v.Validate())
+	}
+	return nil
+}
+
+// Index returns the path of an item of the slice at 'path'.
+func Index(path string, i int) string {
+	return fmt.Sprintf("%s[%d]", path, i)
+}
+
+// Key returns the path of a value of the map at 'path'.
+func Key(path string, key interface{}) string {
+	return fmt.Sprintf("%s[%v]", path, key)
+}
+
+func join(path, field string) string {
+	if len(path) == 0 {
+		return field
+	}
+	if len(field) == 0 {
+		return path
+	}
+	if strings.HasPrefix(field, "[") {
+		return path + field
+	}
+	return path + "." + field
+}
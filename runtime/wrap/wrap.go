@@ -0,0 +1,186 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package wrap holds the observers of the calls made through the wrappers
+// wrap-gen generates, which log them, measure them, or hand them to a
+// tracer.
+package wrap
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Call is a call made through a wrapper.
+type Call struct {
+	// The interface wrapped, and the method called.
+	Interface string
+	Method    string
+	Start     time.Time
+	// The duration and error of the call, set once it returns. The error is
+	// nil for methods which return none.
+	Duration time.Duration
+	Err      error
+
+	observer Observer
+}
+
+// Observer is told of the calls made through wrappers.
+type Observer interface {
+	// Before is called before the call. The context it returns is passed on
+	// to the method, if it takes one, so that it may carry a trace span.
+	Before(ctx context.Context, call *Call) context.Context
+	// After is called once the call returns.
+	After(ctx context.Context, call *Call)
+}
+
+// Start tells the observer of a call, and returns the context to make it
+// with.
+func Start(ctx context.Context, observer Observer, iface, method string) (context.Context, *Call) {
+	call := &Call{Interface: iface, Method: method, Start: time.Now(), observer: observer}
+	return observer.Before(ctx, call), call
+}
+
+// End records the error of the call, and tells its observer it returned.
+func (c *Call) End(ctx context.Context, err error) {
+	c.Duration = time.Since(c.Start)
+	c.Err = err
+	c.observer.After(ctx, c)
+}
+
+// Funcs is an observer calling functions, which may be nil. It integrates
+// wrappers with tracers, by starting spans in BeforeFunc.
+type Funcs struct {
+	BeforeFunc func(ctx context.Context, call *Call) context.Context
+	AfterFunc  func(ctx context.Context, call *Call)
+}
+
+func (f Funcs) Before(ctx context.Context, call *Call) context.Context {
+	if f.BeforeFunc == nil {
+		return ctx
+	}
+	return f.BeforeFunc(ctx, call)
+}
+
+func (f Funcs) After(ctx context.Context, call *Call) {
+	if f.AfterFunc != nil {
+		f.AfterFunc(ctx, call)
+	}
+}
+
+// Chain returns an observer telling every one of 'observers', in order
+// before calls and in reverse order after them.
+func Chain(observers ...Observer) Observer {
+	if len(observers) == 1 {
+		return observers[0]
+	}
+	return chain(observers)
+}
+
+type chain []Observer
+
+func (c chain) Before(ctx context.Context, call *Call) context.Context {
+	for _, o := range c {
+		ctx = o.Before(ctx, call)
+	}
+	return ctx
+}
+
+func (c chain) After(ctx context.Context, call *Call) {
+	for i := len(c) - 1; i >= 0; i-- {
+		c[i].After(ctx, call)
+	}
+}
+
+// Log returns an observer logging every call with logf, such as
+// log.Printf.
+func Log(logf func(format string, args ...interface{})) Observer {
+	return Funcs{AfterFunc: func(ctx context.Context, call *Call) {
+		if call.Err != nil {
+			logf("%s.%s failed after %v: %v", call.Interface, call.Method, call.Duration, call.Err)
+			return
+		}
+		logf("%s.%s took %v", call.Interface, call.Method, call.Duration)
+	}}
+}
+
+// Stats are the measures of the calls of a method.
+type Stats struct {
+	Calls    int64
+	Errors   int64
+	Duration time.Duration
+	// The longest call.
+	Max time.Duration
+}
+
+// Metrics is an observer measuring the calls of every method. It is safe
+// for concurrent use.
+type Metrics struct {
+	lock  sync.Mutex
+	stats map[string]*Stats
+}
+
+// NewMetrics returns an observer measuring calls.
+func NewMetrics() *Metrics {
+	return &Metrics{stats: map[string]*Stats{}}
+}
+
+func (m *Metrics) Before(ctx context.Context, call *Call) context.Context {
+	return ctx
+}
+
+func (m *Metrics) After(ctx context.Context, call *Call) {
+	key := call.Interface + "." + call.Method
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	s := m.stats[key]
+	if s == nil {
+		s = &Stats{}
+		m.stats[key] = s
+	}
+	s.Calls++
+	if call.Err != nil {
+		s.Errors++
+	}
+	s.Duration += call.Duration
+	if call.Duration > s.Max {
+		s.Max = call.Duration
+	}
+}
+
+// Snapshot returns the stats of every method called so far, keyed by
+// <interface>.<method>.
+func (m *Metrics) Snapshot() map[string]Stats {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	out := make(map[string]Stats, len(m.stats))
+	for key, s := range m.stats {
+		out[key] = *s
+	}
+	return out
+}
+
+// Methods returns the keys of the methods called so far, sorted.
+func (m *Metrics) Methods() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	keys := make([]string, 0, len(m.stats))
+	for key := range m.stats {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
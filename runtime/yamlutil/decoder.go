@@ -0,0 +1,294 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yamlutil
+
+import (
+	"encoding"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Decoder converts parsed nodes to Go values. The first error it meets is
+// kept, and every later call returns a zero value, so that generated code only
+// needs to check Error once at the end.
+type Decoder struct {
+	// AllowUnknownFields makes keys which match no struct field be skipped,
+	// rather than reported as errors.
+	AllowUnknownFields bool
+
+	err error
+}
+
+// NewDecoder returns a Decoder rejecting unknown fields.
+func NewDecoder() *Decoder {
+	return &Decoder{}
+}
+
+// Error returns the first error met, if any.
+func (d *Decoder) Error() error {
+	return d.err
+}
+
+func (d *Decoder) fail(n *Node, format string, args ...interface{}) {
+	if d.err == nil {
+		d.err = fmt.Errorf("yaml: line %d: %s", n.Line, fmt.Sprintf(format, args...))
+	}
+}
+
+// mismatch reports that n can not be decoded into a value of type into.
+func (d *Decoder) mismatch(n *Node, into string) {
+	if n.Kind == ScalarNode {
+		d.fail(n, "cannot unmarshal %s `%s` into %s", n.Tag, n.Value, into)
+	} else {
+		d.fail(n, "cannot unmarshal %s into %s", n.Tag, into)
+	}
+}
+
+// Null reports whether n is null.
+func (d *Decoder) Null(n *Node) bool {
+	return d.err == nil && n.Kind == ScalarNode && n.Tag == "!!null"
+}
+
+// Mapping reports whether n is a mapping, failing if it is anything but a
+// mapping or null. into names the type being decoded, for errors.
+func (d *Decoder) Mapping(n *Node, into string) bool {
+	if d.err != nil || n.Tag == "!!null" {
+		return false
+	}
+	if n.Kind != MappingNode {
+		d.mismatch(n, into)
+		return false
+	}
+	return true
+}
+
+// Sequence reports whether n is a sequence, failing if it is anything but a
+// sequence or null. into names the type being decoded, for errors.
+func (d *Decoder) Sequence(n *Node, into string) bool {
+	if d.err != nil || n.Tag == "!!null" {
+		return false
+	}
+	if n.Kind != SequenceNode {
+		d.mismatch(n, into)
+		return false
+	}
+	return true
+}
+
+// Array is Sequence for an array of length items, failing as well if n has
+// more items than that.
+func (d *Decoder) Array(n *Node, length int, into string) bool {
+	if !d.Sequence(n, into) {
+		return false
+	}
+	if len(n.Content) > length {
+		d.fail(n, "cannot unmarshal !!seq of %d items into %s", len(n.Content), into)
+		return false
+	}
+	return true
+}
+
+// Key returns the text of the mapping key k.
+func (d *Decoder) Key(k *Node) string {
+	if d.err != nil {
+		return ""
+	}
+	if k.Kind != ScalarNode {
+		d.fail(k, "invalid map key")
+		return ""
+	}
+	return k.Value
+}
+
+// Unknown reports the key k, which matches no field of the struct type into,
+// unless AllowUnknownFields is set.
+func (d *Decoder) Unknown(k *Node, into string) {
+	if !d.AllowUnknownFields {
+		d.fail(k, "field %s not found in type %s", k.Value, into)
+	}
+}
+
+func (d *Decoder) scalar(n *Node, into string) bool {
+	if d.err != nil || n.Tag == "!!null" {
+		return false
+	}
+	if n.Kind != ScalarNode {
+		d.mismatch(n, into)
+		return false
+	}
+	return true
+}
+
+// String decodes a scalar n as a string.
+func (d *Decoder) String(n *Node) string {
+	if !d.scalar(n, "string") {
+		return ""
+	}
+	return n.Value
+}
+
+// Bool decodes n as a boolean.
+func (d *Decoder) Bool(n *Node) bool {
+	if !d.scalar(n, "bool") {
+		return false
+	}
+	if n.Tag != "!!bool" {
+		d.mismatch(n, "bool")
+		return false
+	}
+	return n.Value[0] == 't' || n.Value[0] == 'T'
+}
+
+func intType(prefix string, bits int) string {
+	if bits == 0 {
+		return prefix
+	}
+	return prefix + strconv.Itoa(bits)
+}
+
+// Int64 decodes n as an integer of the given size in bits, or of the size of
+// int if bits is 0.
+func (d *Decoder) Int64(n *Node, bits int) int64 {
+	into := intType("int", bits)
+	if !d.scalar(n, into) {
+		return 0
+	}
+	v, err := strconv.ParseInt(strings.Replace(n.Value, "_", "", -1), 0, bits)
+	if n.Tag != "!!int" || err != nil {
+		d.mismatch(n, into)
+		return 0
+	}
+	return v
+}
+
+// Uint64 decodes n as an unsigned integer of the given size in bits, or of
+// the size of uint if bits is 0.
+func (d *Decoder) Uint64(n *Node, bits int) uint64 {
+	into := intType("uint", bits)
+	if !d.scalar(n, into) {
+		return 0
+	}
+	v, err := strconv.ParseUint(strings.TrimPrefix(strings.Replace(n.Value, "_", "", -1), "+"), 0, bits)
+	if n.Tag != "!!int" || err != nil {
+		d.mismatch(n, into)
+		return 0
+	}
+	return v
+}
+
+// Float64 decodes n as a floating-point number. bits is 32 for float32
+// values and 64 otherwise.
+func (d *Decoder) Float64(n *Node, bits int) float64 {
+	into := intType("float", bits)
+	if !d.scalar(n, into) {
+		return 0
+	}
+	if n.Tag != "!!float" && n.Tag != "!!int" {
+		d.mismatch(n, into)
+		return 0
+	}
+	switch strings.ToLower(n.Value) {
+	case ".inf", "+.inf":
+		return math.Inf(1)
+	case "-.inf":
+		return math.Inf(-1)
+	case ".nan":
+		return math.NaN()
+	}
+	if n.Tag == "!!int" {
+		if v, err := strconv.ParseInt(strings.Replace(n.Value, "_", "", -1), 0, 64); err == nil {
+			return float64(v)
+		}
+	}
+	v, err := strconv.ParseFloat(strings.Replace(n.Value, "_", "", -1), bits)
+	if err != nil {
+		d.mismatch(n, into)
+		return 0
+	}
+	return v
+}
+
+// Duration decodes n as a time.Duration, either a string such as "1m30s" or
+// a number of nanoseconds.
+func (d *Decoder) Duration(n *Node) time.Duration {
+	if !d.scalar(n, "time.Duration") {
+		return 0
+	}
+	if n.Tag == "!!int" {
+		return time.Duration(d.Int64(n, 64))
+	}
+	v, err := time.ParseDuration(n.Value)
+	if err != nil {
+		d.mismatch(n, "time.Duration")
+		return 0
+	}
+	return v
+}
+
+// Text decodes a scalar n through the UnmarshalText method of u. Null leaves
+// u unchanged.
+func (d *Decoder) Text(n *Node, u encoding.TextUnmarshaler) {
+	if !d.scalar(n, fmt.Sprintf("%T", u)) {
+		return
+	}
+	if err := u.UnmarshalText([]byte(n.Value)); err != nil {
+		d.fail(n, "%v", err)
+	}
+}
+
+// Interface decodes n into nil, a bool, an int, an int64, a uint64, a
+// float64, a string, a []interface{} or a map[string]interface{}.
+func (d *Decoder) Interface(n *Node) interface{} {
+	if d.err != nil {
+		return nil
+	}
+	switch n.Kind {
+	case SequenceNode:
+		s := make([]interface{}, 0, len(n.Content))
+		for _, item := range n.Content {
+			s = append(s, d.Interface(item))
+		}
+		return s
+	case MappingNode:
+		m := make(map[string]interface{}, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			m[d.Key(n.Content[i])] = d.Interface(n.Content[i+1])
+		}
+		return m
+	}
+	switch n.Tag {
+	case "!!null":
+		return nil
+	case "!!bool":
+		return d.Bool(n)
+	case "!!int":
+		plain := strings.Replace(n.Value, "_", "", -1)
+		if v, err := strconv.ParseInt(plain, 0, 64); err == nil {
+			if v == int64(int(v)) {
+				return int(v)
+			}
+			return v
+		}
+		if v, err := strconv.ParseUint(strings.TrimPrefix(plain, "+"), 0, 64); err == nil {
+			return v
+		}
+	case "!!float":
+		return d.Float64(n, 64)
+	}
+	return n.Value
+}
@@ -0,0 +1,415 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yamlutil
+
+import (
+	"encoding"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Encodable is implemented by the types yaml-gen generates methods for.
+type Encodable interface {
+	EncodeYAMLTo(e *Encoder)
+}
+
+// collection is a mapping or a sequence being written.
+type collection struct {
+	mapping bool
+	flow    bool
+	// The column of the entries, in block style.
+	indent int
+	// What precedes the first entry in block style: nothing at the start of
+	// the document, a space after a '-', or a line break otherwise.
+	first string
+	// The number of entries written.
+	n int
+}
+
+// Encoder writes a YAML document, in block style unless asked otherwise.
+// Mappings and sequences are opened and closed explicitly, and the values of
+// a mapping follow their keys. The first error met is kept and returned by
+// Bytes.
+type Encoder struct {
+	buf   []byte
+	stack []*collection
+	flow  bool
+	err   error
+}
+
+// NewEncoder returns an empty Encoder.
+func NewEncoder() *Encoder {
+	return &Encoder{}
+}
+
+// Bytes returns the document written, or the first error met.
+func (e *Encoder) Bytes() ([]byte, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	return e.buf, nil
+}
+
+// Fail records err, unless an error was already met.
+func (e *Encoder) Fail(err error) {
+	if e.err == nil {
+		e.err = err
+	}
+}
+
+func (e *Encoder) top() *collection {
+	if len(e.stack) == 0 {
+		return nil
+	}
+	return e.stack[len(e.stack)-1]
+}
+
+func (e *Encoder) spaces(n int) {
+	for i := 0; i < n; i++ {
+		e.buf = append(e.buf, ' ')
+	}
+}
+
+// entry starts a new entry of the block collection c.
+func (e *Encoder) entry(c *collection) {
+	if c.n == 0 {
+		e.buf = append(e.buf, c.first...)
+	} else {
+		e.spaces(c.indent)
+	}
+	c.n++
+	if !c.mapping {
+		e.buf = append(e.buf, '-')
+	}
+}
+
+// separate starts a new item of the flow sequence c.
+func (e *Encoder) separate(c *collection) {
+	if c.n > 0 {
+		e.buf = append(e.buf, ", "...)
+	}
+	c.n++
+}
+
+// scalar writes the already formatted scalar s as the next value.
+func (e *Encoder) scalar(s string) {
+	// Flow only applies to collections.
+	e.flow = false
+	switch c := e.top(); {
+	case c == nil:
+		e.buf = append(e.buf, s...)
+		e.buf = append(e.buf, '\n')
+	case c.flow:
+		if !c.mapping {
+			e.separate(c)
+		}
+		e.buf = append(e.buf, s...)
+	default:
+		if !c.mapping {
+			e.entry(c)
+		}
+		e.buf = append(e.buf, ' ')
+		e.buf = append(e.buf, s...)
+		e.buf = append(e.buf, '\n')
+	}
+}
+
+// Flow makes the next mapping or sequence, and everything in it, be written
+// in flow style.
+func (e *Encoder) Flow() {
+	e.flow = true
+}
+
+func (e *Encoder) begin(mapping bool) {
+	c := &collection{mapping: mapping, flow: e.flow}
+	e.flow = false
+	switch parent := e.top(); {
+	case parent == nil:
+	case parent.flow:
+		c.flow = true
+		if !parent.mapping {
+			e.separate(parent)
+		}
+	case parent.mapping:
+		// The value of a key.
+		if c.flow {
+			e.buf = append(e.buf, ' ')
+			break
+		}
+		c.indent = parent.indent
+		if mapping {
+			c.indent += 2
+		}
+		c.first = "\n" + strings.Repeat(" ", c.indent)
+	default:
+		// An item of a sequence.
+		e.entry(parent)
+		e.buf = append(e.buf, ' ')
+		c.indent = parent.indent + 2
+	}
+	if c.flow {
+		if mapping {
+			e.buf = append(e.buf, '{')
+		} else {
+			e.buf = append(e.buf, '[')
+		}
+	}
+	e.stack = append(e.stack, c)
+}
+
+func (e *Encoder) end(empty string) {
+	c := e.top()
+	e.stack = e.stack[:len(e.stack)-1]
+	parent := e.top()
+	switch {
+	case c.flow:
+		e.buf = append(e.buf, empty[1])
+	case c.n == 0:
+		if parent != nil && parent.mapping {
+			e.buf = append(e.buf, ' ')
+		}
+		e.buf = append(e.buf, empty...)
+	}
+	if (c.flow || c.n == 0) && (parent == nil || !parent.flow) {
+		e.buf = append(e.buf, '\n')
+	}
+}
+
+// BeginMapping starts a mapping as the next value.
+func (e *Encoder) BeginMapping() {
+	e.begin(true)
+}
+
+// EndMapping ends the current mapping.
+func (e *Encoder) EndMapping() {
+	e.end("{}")
+}
+
+// BeginSequence starts a sequence as the next value.
+func (e *Encoder) BeginSequence() {
+	e.begin(false)
+}
+
+// EndSequence ends the current sequence.
+func (e *Encoder) EndSequence() {
+	e.end("[]")
+}
+
+func (e *Encoder) key(s string) {
+	c := e.top()
+	if c.flow {
+		e.separate(c)
+		e.buf = append(e.buf, s...)
+		e.buf = append(e.buf, ": "...)
+		return
+	}
+	e.entry(c)
+	e.buf = append(e.buf, s...)
+	e.buf = append(e.buf, ':')
+}
+
+// Key writes the next key of the current mapping.
+func (e *Encoder) Key(k string) {
+	e.key(quote(k))
+}
+
+// IntKey writes the next key of the current mapping, an integer.
+func (e *Encoder) IntKey(k int64) {
+	e.key(strconv.FormatInt(k, 10))
+}
+
+// UintKey writes the next key of the current mapping, an unsigned integer.
+func (e *Encoder) UintKey(k uint64) {
+	e.key(strconv.FormatUint(k, 10))
+}
+
+// Null writes null.
+func (e *Encoder) Null() {
+	e.scalar("null")
+}
+
+// String writes s, quoted if it would otherwise be read as something else.
+func (e *Encoder) String(s string) {
+	e.scalar(quote(s))
+}
+
+// Bool writes v.
+func (e *Encoder) Bool(v bool) {
+	e.scalar(strconv.FormatBool(v))
+}
+
+// Int writes v.
+func (e *Encoder) Int(v int64) {
+	e.scalar(strconv.FormatInt(v, 10))
+}
+
+// Uint writes v.
+func (e *Encoder) Uint(v uint64) {
+	e.scalar(strconv.FormatUint(v, 10))
+}
+
+// Float writes v. bits is 32 for float32 values and 64 otherwise.
+func (e *Encoder) Float(v float64, bits int) {
+	switch {
+	case math.IsInf(v, 1):
+		e.scalar(".inf")
+	case math.IsInf(v, -1):
+		e.scalar("-.inf")
+	case math.IsNaN(v):
+		e.scalar(".nan")
+	default:
+		s := strconv.FormatFloat(v, 'g', -1, bits)
+		if resolve(s) != "!!float" {
+			// Keep 1 a float, rather than an integer.
+			s = strconv.FormatFloat(v, 'f', 1, bits)
+		}
+		e.scalar(s)
+	}
+}
+
+// Text writes the result of the MarshalText method of m as a string.
+func (e *Encoder) Text(m encoding.TextMarshaler) {
+	text, err := m.MarshalText()
+	if err != nil {
+		e.Fail(err)
+	}
+	e.String(string(text))
+}
+
+// Interface writes v, which may hold any value Decoder.Interface returns,
+// any other integer or floating-point value, a time.Duration, an Encodable or
+// an encoding.TextMarshaler.
+func (e *Encoder) Interface(v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		e.Null()
+	case Encodable:
+		v.EncodeYAMLTo(e)
+	case time.Duration:
+		e.String(v.String())
+	case encoding.TextMarshaler:
+		e.Text(v)
+	case string:
+		e.String(v)
+	case bool:
+		e.Bool(v)
+	case int:
+		e.Int(int64(v))
+	case int8:
+		e.Int(int64(v))
+	case int16:
+		e.Int(int64(v))
+	case int32:
+		e.Int(int64(v))
+	case int64:
+		e.Int(v)
+	case uint:
+		e.Uint(uint64(v))
+	case uint8:
+		e.Uint(uint64(v))
+	case uint16:
+		e.Uint(uint64(v))
+	case uint32:
+		e.Uint(uint64(v))
+	case uint64:
+		e.Uint(v)
+	case float32:
+		e.Float(float64(v), 32)
+	case float64:
+		e.Float(v, 64)
+	case []interface{}:
+		e.BeginSequence()
+		for _, item := range v {
+			e.Interface(item)
+		}
+		e.EndSequence()
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		e.BeginMapping()
+		for _, k := range keys {
+			e.Key(k)
+			e.Interface(v[k])
+		}
+		e.EndMapping()
+	default:
+		e.Fail(fmt.Errorf("yaml: cannot marshal type %T", v))
+		e.Null()
+	}
+}
+
+// quote returns s as a plain scalar if it would be read back as the same
+// string, and as a double-quoted scalar otherwise.
+func quote(s string) string {
+	if !needsQuotes(s) {
+		return s
+	}
+	b := make([]byte, 0, len(s)+2)
+	b = append(b, '"')
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		switch {
+		case r == '"' || r == '\\':
+			b = append(b, '\\', byte(r))
+		case r == '\n':
+			b = append(b, '\\', 'n')
+		case r == '\t':
+			b = append(b, '\\', 't')
+		case r == '\r':
+			b = append(b, '\\', 'r')
+		case r < 0x20 || r == 0x7f:
+			b = append(b, fmt.Sprintf("\\x%02x", r)...)
+		case r == utf8.RuneError && size == 1:
+			b = append(b, `\ufffd`...)
+		case r == '\u0085' || r == '\u2028' || r == '\u2029' || r == '\ufeff':
+			b = append(b, fmt.Sprintf("\\u%04x", r)...)
+		default:
+			b = append(b, s[i-size:i]...)
+		}
+	}
+	return string(append(b, '"'))
+}
+
+func needsQuotes(s string) bool {
+	if s == "" || resolve(s) != "!!str" {
+		return true
+	}
+	switch strings.ToLower(s) {
+	case "y", "n", "yes", "no", "on", "off":
+		// Booleans to YAML 1.1 readers.
+		return true
+	}
+	if strings.IndexByte("-?:,[]{}#&*!|>'\"%@` \t", s[0]) >= 0 || s[len(s)-1] == ' ' || s[len(s)-1] == ':' {
+		return true
+	}
+	if strings.Contains(s, ": ") || strings.Contains(s, " #") || strings.ContainsAny(s, ",[]{}") {
+		return true
+	}
+	for _, r := range s {
+		if r < 0x20 || r == 0x7f || r == utf8.RuneError || r == '\u0085' || r == '\u2028' || r == '\u2029' || r == '\ufeff' {
+			return true
+		}
+	}
+	return false
+}
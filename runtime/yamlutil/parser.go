@@ -0,0 +1,785 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package yamlutil holds the helpers used by the code yaml-gen generates. It
+// reads and writes a single YAML document without reflection. Anchors,
+// aliases, tags and directives are rejected, so a document never expands
+// beyond its own size.
+package yamlutil
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Kind is the kind of a Node.
+type Kind int
+
+const (
+	ScalarNode Kind = iota
+	SequenceNode
+	MappingNode
+)
+
+// Node is a parsed YAML value.
+type Node struct {
+	Kind Kind
+	// Tag is the resolved tag of the node: !!map, !!seq, or for scalars one
+	// of !!null, !!bool, !!int, !!float and !!str. Quoted and block scalars
+	// are always !!str.
+	Tag string
+	// Value is the text of a scalar.
+	Value string
+	// Content holds the items of a sequence, or the keys and values of a
+	// mapping, one after the other.
+	Content []*Node
+	// Line and Column locate the node in the document, counting from 1.
+	Line   int
+	Column int
+}
+
+// Parse parses the YAML document in data. It returns nil for a document
+// holding nothing but comments and blank lines.
+func Parse(data []byte) (*Node, error) {
+	p := &parser{data: data, line: 1}
+	p.skipSpace()
+	if p.hasPrefix("%") && p.col() == 0 {
+		p.fail("directives are not supported")
+	}
+	if p.isMarker("---") {
+		p.pos += 3
+	}
+	n := p.parseBlock(0, false)
+	p.skipSpace()
+	if p.isMarker("...") {
+		p.pos += 3
+		p.skipSpace()
+	}
+	if p.err == nil && p.pos < len(p.data) {
+		if p.isMarker("---") {
+			p.fail("multiple documents are not supported")
+		} else {
+			p.fail("did not find expected end of document")
+		}
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	if n != nil && n.Kind == ScalarNode && n.Tag == "!!null" && n.Value == "" && n.Line == 0 {
+		return nil, nil
+	}
+	return n, nil
+}
+
+type parser struct {
+	data      []byte
+	pos       int
+	line      int
+	lineStart int
+	err       error
+}
+
+func (p *parser) fail(format string, args ...interface{}) {
+	if p.err == nil {
+		p.err = fmt.Errorf("yaml: line %d: %s", p.line, fmt.Sprintf(format, args...))
+	}
+	// Stop parsing.
+	p.pos = len(p.data)
+}
+
+func (p *parser) col() int {
+	return p.pos - p.lineStart
+}
+
+func (p *parser) peek() byte {
+	if p.pos >= len(p.data) {
+		return 0
+	}
+	return p.data[p.pos]
+}
+
+func (p *parser) hasPrefix(s string) bool {
+	return strings.HasPrefix(string(p.data[p.pos:]), s)
+}
+
+// isBlank reports whether the byte at i ends a token: a space, a line break
+// or the end of the input.
+func (p *parser) isBlank(i int) bool {
+	if i >= len(p.data) {
+		return true
+	}
+	switch p.data[i] {
+	case ' ', '\t', '\n', '\r':
+		return true
+	}
+	return false
+}
+
+// isMarker reports whether a document marker starts the current line.
+func (p *parser) isMarker(m string) bool {
+	return p.col() == 0 && p.hasPrefix(m) && p.isBlank(p.pos+len(m))
+}
+
+func (p *parser) newline() {
+	if p.peek() == '\r' {
+		p.pos++
+	}
+	if p.peek() == '\n' {
+		p.pos++
+	}
+	p.line++
+	p.lineStart = p.pos
+}
+
+// skipInline skips spaces and a comment up to the end of the current line.
+func (p *parser) skipInline() {
+	for p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case ' ', '\t':
+			p.pos++
+		case '#':
+			for p.pos < len(p.data) && p.data[p.pos] != '\n' && p.data[p.pos] != '\r' {
+				p.pos++
+			}
+			return
+		default:
+			return
+		}
+	}
+}
+
+func (p *parser) atLineEnd() bool {
+	c := p.peek()
+	return c == 0 || c == '\n' || c == '\r'
+}
+
+// skipSpace skips spaces, comments and line breaks, stopping at the next
+// token.
+func (p *parser) skipSpace() {
+	for p.pos < len(p.data) {
+		p.skipInline()
+		if !p.atLineEnd() || p.pos >= len(p.data) {
+			break
+		}
+		p.newline()
+		// Tabs may not indent a line holding a token.
+		i := p.pos
+		for i < len(p.data) && p.data[i] == ' ' {
+			i++
+		}
+		if i < len(p.data) && p.data[i] == '\t' {
+			j := i
+			for j < len(p.data) && (p.data[j] == ' ' || p.data[j] == '\t') {
+				j++
+			}
+			if j < len(p.data) && p.data[j] != '\n' && p.data[j] != '\r' && p.data[j] != '#' {
+				p.fail("found a tab character used as indentation")
+				return
+			}
+		}
+	}
+}
+
+func (p *parser) node(kind Kind, tag string) *Node {
+	return &Node{Kind: kind, Tag: tag, Line: p.line, Column: p.col() + 1}
+}
+
+// null returns an empty value, found at the current position.
+func (p *parser) null() *Node {
+	return p.node(ScalarNode, "!!null")
+}
+
+// checkToken rejects the tokens this parser does not support.
+func (p *parser) checkToken() bool {
+	switch p.peek() {
+	case '&', '*':
+		p.fail("anchors and aliases are not supported")
+	case '!':
+		p.fail("tags are not supported")
+	case '?':
+		if p.isBlank(p.pos + 1) {
+			p.fail("complex mapping keys are not supported")
+		}
+	case '@', '`':
+		p.fail("found character %q that cannot start any token", p.peek())
+	}
+	return p.err == nil
+}
+
+// parseBlock parses the node starting at the next token, which must be at a
+// column of at least indent. A mapping may start on the current line only if
+// inline is false.
+func (p *parser) parseBlock(indent int, inline bool) *Node {
+	p.skipSpace()
+	if p.pos >= len(p.data) || p.col() < indent || p.isMarker("---") || p.isMarker("...") {
+		n := p.null()
+		n.Line, n.Column = 0, 0
+		return n
+	}
+	if !p.checkToken() {
+		return nil
+	}
+	col := p.col()
+	switch c := p.peek(); {
+	case c == '-' && p.isBlank(p.pos+1):
+		return p.parseSequence(col)
+	case c == '|' || c == '>':
+		return p.parseBlockScalar(indent - 1)
+	case c == '[' || c == '{':
+		n := p.parseFlow()
+		p.skipInline()
+		if p.peek() == ':' && p.isBlank(p.pos+1) {
+			p.fail("flow mapping keys are not supported")
+		}
+		return n
+	}
+	quoted := p.peek() == '"' || p.peek() == '\''
+	n := p.parseScalar(false)
+	p.skipInline()
+	if p.peek() == ':' && p.isBlank(p.pos+1) {
+		if inline {
+			p.fail("mapping values are not allowed in this context")
+			return nil
+		}
+		return p.parseMapping(col, n)
+	}
+	if quoted && !p.atLineEnd() {
+		p.fail("did not find expected key")
+		return nil
+	}
+	if !quoted {
+		p.continuePlain(n, indent)
+	}
+	return n
+}
+
+// parseMapping parses a block mapping whose keys are at column col, the first
+// of them already read.
+func (p *parser) parseMapping(col int, key *Node) *Node {
+	n := &Node{Kind: MappingNode, Tag: "!!map", Line: key.Line, Column: key.Column}
+	var seen map[string]int
+	for {
+		if key.Kind != ScalarNode {
+			p.fail("mapping keys must be scalars")
+			return nil
+		}
+		if line, ok := seen[key.Value]; ok {
+			p.line = key.Line
+			p.fail("mapping key %q already defined at line %d", key.Value, line)
+			return nil
+		}
+		if seen == nil {
+			seen = map[string]int{}
+		}
+		seen[key.Value] = key.Line
+		// Skip the ':'.
+		p.pos++
+		value := p.parseValue(col, true)
+		if p.err != nil {
+			return nil
+		}
+		n.Content = append(n.Content, key, value)
+
+		p.skipSpace()
+		if p.pos >= len(p.data) || p.col() < col || p.isMarker("---") || p.isMarker("...") {
+			return n
+		}
+		if p.col() > col {
+			p.fail("mapping values are not allowed in this context")
+			return nil
+		}
+		if !p.checkToken() {
+			return nil
+		}
+		if p.peek() == '-' && p.isBlank(p.pos+1) {
+			p.fail("did not find expected key")
+			return nil
+		}
+		key = p.parseScalar(false)
+		p.skipInline()
+		if p.peek() != ':' || !p.isBlank(p.pos+1) {
+			p.fail("could not find expected ':'")
+			return nil
+		}
+	}
+}
+
+// parseSequence parses a block sequence whose entries are at column col.
+func (p *parser) parseSequence(col int) *Node {
+	n := p.node(SequenceNode, "!!seq")
+	for {
+		// Skip the '-'.
+		p.pos++
+		item := p.parseValue(col, false)
+		if p.err != nil {
+			return nil
+		}
+		n.Content = append(n.Content, item)
+
+		p.skipSpace()
+		if p.pos >= len(p.data) || p.col() != col || p.peek() != '-' || !p.isBlank(p.pos+1) || p.isMarker("---") {
+			if p.pos < len(p.data) && p.col() > col {
+				p.fail("did not find expected '-' indicator")
+			}
+			return n
+		}
+	}
+}
+
+// parseValue parses the value following a ':' or a '-' indicator of a
+// collection at column col.
+func (p *parser) parseValue(col int, mapping bool) *Node {
+	p.skipInline()
+	if !p.atLineEnd() {
+		if p.peek() == '-' && p.isBlank(p.pos+1) && mapping {
+			p.fail("block sequence entries are not allowed in this context")
+			return nil
+		}
+		return p.parseBlock(col+1, mapping)
+	}
+	n := p.null()
+	p.skipSpace()
+	switch {
+	case p.pos >= len(p.data) || p.isMarker("---") || p.isMarker("..."):
+	case p.col() > col:
+		return p.parseBlock(col+1, false)
+	case p.col() == col && mapping && p.peek() == '-' && p.isBlank(p.pos+1):
+		// A sequence may be as indented as the key it is the value of.
+		return p.parseSequence(col)
+	}
+	return n
+}
+
+// parseScalar parses a quoted or plain scalar.
+func (p *parser) parseScalar(flow bool) *Node {
+	n := p.node(ScalarNode, "!!str")
+	switch p.peek() {
+	case '"':
+		n.Value = p.parseDoubleQuoted()
+	case '\'':
+		n.Value = p.parseSingleQuoted()
+	default:
+		n.Value = p.parsePlain(flow)
+		n.Tag = resolve(n.Value)
+	}
+	return n
+}
+
+// parsePlain reads a plain scalar up to the end of the line, a ": ", a
+// comment or, in flow context, a flow indicator.
+func (p *parser) parsePlain(flow bool) string {
+	start := p.pos
+	end := p.pos
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		if c == '\n' || c == '\r' {
+			break
+		}
+		if c == ':' && (p.isBlank(p.pos+1) || flow && strings.IndexByte(",[]{}", p.peekAt(p.pos+1)) >= 0) {
+			break
+		}
+		if c == '#' && p.pos > start && (p.data[p.pos-1] == ' ' || p.data[p.pos-1] == '\t') {
+			break
+		}
+		if flow && strings.IndexByte(",[]{}", c) >= 0 {
+			break
+		}
+		p.pos++
+		if c != ' ' && c != '\t' {
+			end = p.pos
+		}
+	}
+	p.pos = end
+	return string(p.data[start:end])
+}
+
+func (p *parser) peekAt(i int) byte {
+	if i >= len(p.data) {
+		return 0
+	}
+	return p.data[i]
+}
+
+// continuePlain folds the lines continuing the plain scalar n, which are
+// indented by at least indent, into its value.
+func (p *parser) continuePlain(n *Node, indent int) {
+	var b strings.Builder
+	b.WriteString(n.Value)
+	continued := false
+	for {
+		save, saveLine, saveStart := p.pos, p.line, p.lineStart
+		p.skipInline()
+		if !p.atLineEnd() || p.pos >= len(p.data) {
+			p.pos, p.line, p.lineStart = save, saveLine, saveStart
+			break
+		}
+		// Count the blank lines up to the next line holding anything.
+		breaks := 0
+		for p.atLineEnd() && p.pos < len(p.data) {
+			p.newline()
+			breaks++
+			for p.peek() == ' ' || p.peek() == '\t' {
+				p.pos++
+			}
+		}
+		if p.pos >= len(p.data) || p.col() < indent || p.peek() == '#' || p.isMarker("---") || p.isMarker("...") ||
+			p.hasPrefix("- ") || strings.Contains(p.restOfLine(), ": ") || strings.HasSuffix(p.restOfLine(), ":") {
+			p.pos, p.line, p.lineStart = save, saveLine, saveStart
+			break
+		}
+		if breaks == 1 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteString(strings.Repeat("\n", breaks-1))
+		}
+		b.WriteString(p.parsePlain(false))
+		continued = true
+	}
+	if continued {
+		n.Value = b.String()
+		n.Tag = "!!str"
+	}
+}
+
+func (p *parser) restOfLine() string {
+	end := p.pos
+	for end < len(p.data) && p.data[end] != '\n' && p.data[end] != '\r' {
+		end++
+	}
+	line := string(p.data[p.pos:end])
+	if i := strings.Index(line, " #"); i >= 0 {
+		line = line[:i]
+	}
+	return strings.TrimRight(line, " \t")
+}
+
+// foldLine handles a line break inside a quoted scalar: it is read as a space,
+// unless blank lines follow, which are read as line breaks.
+func (p *parser) foldLine(b *strings.Builder) {
+	s := strings.TrimRight(b.String(), " \t")
+	b.Reset()
+	b.WriteString(s)
+	breaks := 0
+	for p.atLineEnd() && p.pos < len(p.data) {
+		p.newline()
+		breaks++
+		for p.peek() == ' ' || p.peek() == '\t' {
+			p.pos++
+		}
+	}
+	if breaks == 1 {
+		b.WriteByte(' ')
+	} else {
+		b.WriteString(strings.Repeat("\n", breaks-1))
+	}
+}
+
+func (p *parser) parseSingleQuoted() string {
+	var b strings.Builder
+	p.pos++
+	for {
+		switch c := p.peek(); {
+		case p.pos >= len(p.data):
+			p.fail("found unexpected end of stream in a quoted scalar")
+			return ""
+		case c == '\'':
+			if p.peekAt(p.pos+1) != '\'' {
+				p.pos++
+				return b.String()
+			}
+			b.WriteByte('\'')
+			p.pos += 2
+		case c == '\n' || c == '\r':
+			p.foldLine(&b)
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+var escapes = map[byte]string{
+	'0': "\x00", 'a': "\a", 'b': "\b", 't': "\t", '\t': "\t", 'n': "\n", 'v': "\v", 'f': "\f", 'r': "\r",
+	'e': "\x1b", ' ': " ", '"': "\"", '/': "/", '\\': "\\", 'N': "\u0085", '_': "\u00a0", 'L': "\u2028", 'P': "\u2029",
+}
+
+func (p *parser) parseDoubleQuoted() string {
+	var b strings.Builder
+	p.pos++
+	for {
+		switch c := p.peek(); {
+		case p.pos >= len(p.data):
+			p.fail("found unexpected end of stream in a quoted scalar")
+			return ""
+		case c == '"':
+			p.pos++
+			return b.String()
+		case c == '\\':
+			p.pos++
+			e := p.peek()
+			if e == '\n' || e == '\r' {
+				// An escaped line break joins the lines.
+				p.newline()
+				for p.peek() == ' ' || p.peek() == '\t' {
+					p.pos++
+				}
+				continue
+			}
+			if s, ok := escapes[e]; ok {
+				b.WriteString(s)
+				p.pos++
+				continue
+			}
+			size := map[byte]int{'x': 2, 'u': 4, 'U': 8}[e]
+			if size == 0 || p.pos+1+size > len(p.data) {
+				p.fail("found unknown escape character %q in a quoted scalar", e)
+				return ""
+			}
+			r, err := strconv.ParseUint(string(p.data[p.pos+1:p.pos+1+size]), 16, 32)
+			if err != nil || !utf8.ValidRune(rune(r)) {
+				p.fail("found invalid escape sequence in a quoted scalar")
+				return ""
+			}
+			b.WriteRune(rune(r))
+			p.pos += 1 + size
+		case c == '\n' || c == '\r':
+			p.foldLine(&b)
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+}
+
+// parseBlockScalar parses a literal (|) or folded (>) scalar, whose content
+// is indented more than indent.
+func (p *parser) parseBlockScalar(indent int) *Node {
+	n := p.node(ScalarNode, "!!str")
+	folded := p.peek() == '>'
+	p.pos++
+	chomp, explicit := byte(0), 0
+	for i := 0; i < 2; i++ {
+		switch c := p.peek(); {
+		case (c == '-' || c == '+') && chomp == 0:
+			chomp = c
+			p.pos++
+		case c >= '1' && c <= '9' && explicit == 0:
+			explicit = int(c - '0')
+			p.pos++
+		}
+	}
+	p.skipInline()
+	if !p.atLineEnd() {
+		p.fail("did not find expected comment or line break")
+		return nil
+	}
+
+	// Collect the lines, indented by the indentation of the first one
+	// holding anything.
+	contentIndent := -1
+	if explicit > 0 {
+		contentIndent = indent + explicit
+		if indent < 0 {
+			contentIndent = explicit
+		}
+	}
+	lines := []string{}
+	for p.pos < len(p.data) {
+		save, saveLine, saveStart := p.pos, p.line, p.lineStart
+		p.newline()
+		spaces := 0
+		for p.peekAt(p.pos+spaces) == ' ' {
+			spaces++
+		}
+		end := p.pos
+		for end < len(p.data) && p.data[end] != '\n' && p.data[end] != '\r' {
+			end++
+		}
+		blank := strings.TrimSpace(string(p.data[p.pos+spaces:end])) == ""
+		if contentIndent < 0 && !blank {
+			contentIndent = spaces
+			if contentIndent <= indent {
+				p.pos, p.line, p.lineStart = save, saveLine, saveStart
+				break
+			}
+		}
+		if !blank && spaces < contentIndent || p.isMarker("---") || p.isMarker("...") {
+			p.pos, p.line, p.lineStart = save, saveLine, saveStart
+			break
+		}
+		line := ""
+		if contentIndent >= 0 && p.pos+contentIndent <= end {
+			line = string(p.data[p.pos+contentIndent : end])
+		}
+		lines = append(lines, line)
+		p.pos = end
+	}
+
+	// Trailing blank lines only matter for keeping.
+	trailing := 0
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+		trailing++
+	}
+	var b strings.Builder
+	for i, line := range lines {
+		if i > 0 {
+			prev := lines[i-1]
+			switch {
+			case !folded:
+				b.WriteByte('\n')
+			case line == "" || prev == "" || line[0] == ' ' || line[0] == '\t' || prev[0] == ' ' || prev[0] == '\t':
+				// Blank and more indented lines are kept as is.
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString(line)
+	}
+	if folded {
+		// A blank line between two folded lines only adds one break.
+		n.Value = strings.Replace(b.String(), "\n\n", "\n", -1)
+		if b.Len() == 0 {
+			n.Value = ""
+		}
+	} else {
+		n.Value = b.String()
+	}
+	switch {
+	case len(lines) == 0:
+		if chomp == '+' {
+			n.Value = strings.Repeat("\n", trailing)
+		}
+	case chomp == '-':
+	case chomp == '+':
+		n.Value += "\n" + strings.Repeat("\n", trailing)
+	default:
+		n.Value += "\n"
+	}
+	return n
+}
+
+// parseFlow parses a flow sequence or mapping.
+func (p *parser) parseFlow() *Node {
+	mapping := p.peek() == '{'
+	n := p.node(SequenceNode, "!!seq")
+	closing := byte(']')
+	if mapping {
+		n.Kind, n.Tag, closing = MappingNode, "!!map", '}'
+	}
+	p.pos++
+	var seen map[string]int
+	for {
+		p.skipSpace()
+		if p.peek() == closing {
+			p.pos++
+			return n
+		}
+		if p.pos >= len(p.data) {
+			p.fail("did not find expected ',' or '%c'", closing)
+			return nil
+		}
+		item := p.parseFlowNode()
+		if p.err != nil {
+			return nil
+		}
+		p.skipSpace()
+		if mapping {
+			if item.Kind != ScalarNode {
+				p.fail("mapping keys must be scalars")
+				return nil
+			}
+			if line, ok := seen[item.Value]; ok {
+				p.fail("mapping key %q already defined at line %d", item.Value, line)
+				return nil
+			}
+			if seen == nil {
+				seen = map[string]int{}
+			}
+			seen[item.Value] = item.Line
+			value := p.null()
+			if p.peek() == ':' {
+				p.pos++
+				p.skipSpace()
+				if c := p.peek(); c != ',' && c != closing {
+					value = p.parseFlowNode()
+					p.skipSpace()
+				}
+			}
+			n.Content = append(n.Content, item, value)
+		} else {
+			if p.peek() == ':' {
+				p.fail("single pair mappings are not supported in flow sequences")
+				return nil
+			}
+			n.Content = append(n.Content, item)
+		}
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case closing:
+		default:
+			p.fail("did not find expected ',' or '%c'", closing)
+			return nil
+		}
+	}
+}
+
+func (p *parser) parseFlowNode() *Node {
+	if !p.checkToken() {
+		return nil
+	}
+	switch p.peek() {
+	case '[', '{':
+		return p.parseFlow()
+	case ']', '}', ',':
+		p.fail("did not find expected node content")
+		return nil
+	}
+	return p.parseScalar(true)
+}
+
+// resolve returns the tag of a plain scalar, following the YAML 1.2 core
+// schema.
+func resolve(s string) string {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return "!!null"
+	case "true", "True", "TRUE", "false", "False", "FALSE":
+		return "!!bool"
+	case ".inf", ".Inf", ".INF", "+.inf", "+.Inf", "+.INF", "-.inf", "-.Inf", "-.INF", ".nan", ".NaN", ".NAN":
+		return "!!float"
+	}
+	c := s[0]
+	if c != '-' && c != '+' && c != '.' && (c < '0' || c > '9') {
+		return "!!str"
+	}
+	plain := strings.Replace(s, "_", "", -1)
+	if _, err := strconv.ParseInt(plain, 0, 64); err == nil {
+		return "!!int"
+	}
+	if _, err := strconv.ParseUint(strings.TrimPrefix(plain, "+"), 0, 64); err == nil {
+		return "!!int"
+	}
+	if strings.Trim(plain, "0123456789+-.eE") != "" {
+		return "!!str"
+	}
+	if _, err := strconv.ParseFloat(plain, 64); err == nil {
+		return "!!float"
+	}
+	return "!!str"
+}
@@ -24,7 +24,12 @@ import (
 	"github.com/lack-io/gogogen/util/log"
 )
 
-const tagEnable = "vine:genset"
+const (
+	tagEnable = "gogogen:set-gen"
+	// legacyTagEnable is the tag used before set-gen was generalized to
+	// arbitrary named types. It is still honored.
+	legacyTagEnable = "vine:genset"
+)
 
 // NameSystems returns the name system used by the generators in this package.
 func NameSystems() namer.NameSystems {
@@ -100,11 +105,29 @@ func Packages(_ *generator.Context, arguments *args.GeneratorArgs) generator.Pac
 				return true
 			case types.Struct:
 				// Only some structs can be keys in a map. This is triggered by the
-				// // +vine:genset
+				// // +gogogen:set-gen
 				// or
 				//
-				// // +vine:genset=true
-				return extractBoolTagOrDie(tagEnable, t.CommentLines) == true
+				// // +gogogen:set-gen=true
+				if !setRequested(t) {
+					return false
+				}
+				for _, m := range types.FlattenMembers(t.Members) {
+					if !orderable(m.Type) {
+						log.Fatalf("Type %v requests a set, but member %s of type %v can not be ordered", t, m.Name, m.Type)
+					}
+				}
+				return true
+			case types.Alias:
+				// Named types, such as "type Color string", are handled
+				// like their underlying builtin, when requested.
+				if !setRequested(t) {
+					return false
+				}
+				if !orderable(t) {
+					log.Fatalf("Type %v requests a set, but can not be ordered", t)
+				}
+				return true
 			}
 			return false
 		},
@@ -163,15 +186,52 @@ func (g *genSet) lessBody(sw *generator.SnippetWriter, t *types.Type) {
 	switch t.Kind {
 	case types.Struct:
 		for _, m := range types.FlattenMembers(t.Members) {
+			if isBool(m.Type) {
+				sw.Do("if !lhs.$.Name$ && rhs.$.Name$ { return true }\n", m)
+				sw.Do("if lhs.$.Name$ && !rhs.$.Name$ { return false }\n", m)
+				continue
+			}
 			sw.Do("if lhs.$.Name$ < rhs.$.Name$ { return true }\n", m)
 			sw.Do("if lhs.$.Name$ > rhs.$.Name$ { return false }\n", m)
 		}
 		sw.Do("return false\n", nil)
 	default:
+		if isBool(t) {
+			sw.Do("return !lhs && rhs\n", nil)
+			return
+		}
 		sw.Do("return lhs < rhs\n", nil)
 	}
 }
 
+// setRequested returns true if the comments of 't' ask for a set.
+func setRequested(t *types.Type) bool {
+	lines := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
+	return extractBoolTagOrDie(tagEnable, lines) || extractBoolTagOrDie(legacyTagEnable, lines)
+}
+
+// orderable returns true if values of 't' can be sorted by lessBody.
+func orderable(t *types.Type) bool {
+	if t.Kind == types.Alias {
+		t = t.Underlying
+	}
+	if t.Kind != types.Builtin {
+		return false
+	}
+	switch t.Name.Name {
+	case "complex64", "complex128", "error":
+		return false
+	}
+	return true
+}
+
+func isBool(t *types.Type) bool {
+	if t.Kind == types.Alias {
+		t = t.Underlying
+	}
+	return t.Kind == types.Builtin && t.Name.Name == "bool"
+}
+
 // written to the "empty.go" file.
 var emptyTypeDecl = `
 // Empty is public since it is used by some internal API objects for conversions between external
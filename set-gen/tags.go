@@ -20,9 +20,12 @@ import (
 )
 
 // extractBoolTagOrDie gets the comment-tags for the key and asserts that, if
-// it exists, the value is boolean. If the tag did not exists, it returns
-// false.
+// it exists, the value is boolean. A tag without a value counts as true. If
+// the tag did not exists, it returns false.
 func extractBoolTagOrDie(key string, lines []string) bool {
+	if values := types.ExtractCommentTags("+", lines)[key]; len(values) > 0 && values[0] == "" {
+		return true
+	}
 	val, err := types.ExtractSingleBoolCommentTag("+", key, false, lines)
 	if err != nil {
 		log.Fatalf(err.Error())
@@ -0,0 +1,475 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sql_gen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/namer"
+	"github.com/lack-io/gogogen/gogenerator/types"
+	"github.com/lack-io/gogogen/util/log"
+	"github.com/lack-io/gogogen/util/sets"
+)
+
+// These are the comment tags that carry parameters for SQL generation.
+const (
+	tagName = "gogogen:sql-gen"
+	// The name of the table of a struct, by default the snake case plural of
+	// its name.
+	tableTagName = tagName + ":table"
+
+	// tagValuePackage, on a package, asks for the methods of every struct in
+	// it.
+	tagValuePackage = "package"
+)
+
+// The struct tag naming the columns of fields, and its options.
+const (
+	structTagName = "db"
+	// The column is (part of) the primary key.
+	optionPrimaryKey = "pk"
+	// The column is unique.
+	optionUnique = "unique"
+	// type=<SQL type> gives the type of the column, for the Go types
+	// without a default.
+	optionType = "type="
+)
+
+// The kinds of columns, mapped to a SQL type by each dialect.
+const (
+	columnBigInt    = "bigint"
+	columnInt       = "int"
+	columnSmallInt  = "smallint"
+	columnBool      = "bool"
+	columnReal      = "real"
+	columnDouble    = "double"
+	columnText      = "text"
+	columnBytes     = "bytes"
+	columnTimestamp = "timestamp"
+)
+
+var dialects = map[string]map[string]string{
+	DialectPostgres: {
+		columnBigInt:    "BIGINT",
+		columnInt:       "INTEGER",
+		columnSmallInt:  "SMALLINT",
+		columnBool:      "BOOLEAN",
+		columnReal:      "REAL",
+		columnDouble:    "DOUBLE PRECISION",
+		columnText:      "TEXT",
+		columnBytes:     "BYTEA",
+		columnTimestamp: "TIMESTAMP WITH TIME ZONE",
+	},
+	DialectMySQL: {
+		columnBigInt:    "BIGINT",
+		columnInt:       "INT",
+		columnSmallInt:  "SMALLINT",
+		columnBool:      "BOOLEAN",
+		columnReal:      "FLOAT",
+		columnDouble:    "DOUBLE",
+		columnText:      "VARCHAR(255)",
+		columnBytes:     "BLOB",
+		columnTimestamp: "DATETIME(6)",
+	},
+	DialectSQLite: {
+		columnBigInt:    "INTEGER",
+		columnInt:       "INTEGER",
+		columnSmallInt:  "INTEGER",
+		columnBool:      "BOOLEAN",
+		columnReal:      "REAL",
+		columnDouble:    "REAL",
+		columnText:      "TEXT",
+		columnBytes:     "BLOB",
+		columnTimestamp: "TIMESTAMP",
+	},
+}
+
+// The nullable types of database/sql, with the kind of their column.
+var nullTypes = map[string]string{
+	"NullString":  columnText,
+	"NullInt64":   columnBigInt,
+	"NullInt32":   columnInt,
+	"NullInt16":   columnSmallInt,
+	"NullByte":    columnSmallInt,
+	"NullBool":    columnBool,
+	"NullFloat64": columnDouble,
+	"NullTime":    columnTimestamp,
+}
+
+// NameSystems returns the name system used by the generators in this package.
+func NameSystems() namer.NameSystems {
+	return namer.NameSystems{
+		"public": namer.NewPublicNamer(0),
+		"raw":    namer.NewRawNamer("", nil),
+	}
+}
+
+// DefaultNameSystem returns the default name system for ordering the types to
+// be processed by the generators in this package.
+func DefaultNameSystem() string {
+	return "public"
+}
+
+// column is a column of a table, and the field it is stored in.
+type column struct {
+	Name string
+	// The path of the field from the struct, as in Base.ID.
+	Field      string
+	SQLType    string
+	Nullable   bool
+	PrimaryKey bool
+	Unique     bool
+}
+
+// table is the table of a struct.
+type table struct {
+	Name    string
+	Columns []column
+}
+
+// snakeCase returns 'name' in lower case, with words separated by
+// underscores.
+func snakeCase(name string) string {
+	b := &bytes.Buffer{}
+	runes := []rune(name)
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			// A new word starts at an upper case letter, unless it
+			// continues an initialism.
+			prevLower := unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || (unicode.IsUpper(runes[i-1]) && nextLower) {
+				b.WriteRune('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
+
+// newTable returns the table of the struct 't'.
+func newTable(t *types.Type, dialect string) *table {
+	tbl := &table{Name: snakeCase(namer.NewPublicPluralNamer(nil).Name(t))}
+	comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
+	if values := types.ExtractCommentTags("+", comments)[tableTagName]; len(values) > 0 {
+		tbl.Name = values[0]
+	}
+	addColumns(tbl, t, t, "", dialects[dialect])
+	if len(tbl.Columns) == 0 {
+		log.Fatalf("Type %v: no field has a %s struct tag", t, structTagName)
+	}
+	seen := map[string]bool{}
+	for _, c := range tbl.Columns {
+		if seen[c.Name] {
+			log.Fatalf("Type %v: column %q is declared twice", t, c.Name)
+		}
+		seen[c.Name] = true
+	}
+	return tbl
+}
+
+// addColumns adds the columns of the fields of 'st' to the table of 't',
+// flattening embedded structs.
+func addColumns(tbl *table, t, st *types.Type, prefix string, sqlTypes map[string]string) {
+	for _, m := range st.Members {
+		tag, tagged := reflect.StructTag(m.Tags).Lookup(structTagName)
+		if tag == "-" {
+			continue
+		}
+		if m.Embedded && !tagged && m.Type.Kind == types.Struct {
+			addColumns(tbl, t, m.Type, prefix+m.Name+".", sqlTypes)
+			continue
+		}
+		if !tagged {
+			continue
+		}
+		if namer.IsPrivateGoName(m.Name) {
+			log.Fatalf("Type %v: unexported field %s can't be stored", t, m.Name)
+		}
+
+		opts := strings.Split(tag, ",")
+		c := column{Name: opts[0], Field: prefix + m.Name}
+		if len(c.Name) == 0 {
+			c.Name = snakeCase(m.Name)
+		}
+		for _, opt := range opts[1:] {
+			switch {
+			case opt == optionPrimaryKey:
+				c.PrimaryKey = true
+			case opt == optionUnique:
+				c.Unique = true
+			case strings.HasPrefix(opt, optionType):
+				c.SQLType = strings.TrimPrefix(opt, optionType)
+			default:
+				log.Fatalf("Type %v, field %s: unsupported %s option %q", t, m.Name, structTagName, opt)
+			}
+		}
+
+		ft := m.Type
+		if ft.Kind == types.Pointer {
+			c.Nullable = true
+			ft = ft.Elem
+		}
+		kind := columnKind(ft)
+		if _, ok := nullTypes[ft.Name.Name]; ok && ft.Name.Package == "database/sql" {
+			c.Nullable = true
+		}
+		if len(c.SQLType) == 0 {
+			if len(kind) == 0 {
+				log.Fatalf("Type %v, field %s: no SQL type is known for %v, give one with %s:\"%s,%s...\"", t, m.Name, m.Type, structTagName, c.Name, optionType)
+			}
+			c.SQLType = sqlTypes[kind]
+		}
+		if c.PrimaryKey && c.Nullable {
+			log.Fatalf("Type %v, field %s: a primary key can't be nullable", t, m.Name)
+		}
+		tbl.Columns = append(tbl.Columns, c)
+	}
+}
+
+// columnKind returns the kind of column of values of type 't', or "" if
+// there is no default.
+func columnKind(t *types.Type) string {
+	switch {
+	case t.Name.Package == "time" && t.Name.Name == "Time":
+		return columnTimestamp
+	case t.Name.Package == "database/sql":
+		return nullTypes[t.Name.Name]
+	}
+	if t.Kind == types.Alias {
+		t = t.Underlying
+	}
+	if t.Kind == types.Slice && t.Elem == types.Byte {
+		return columnBytes
+	}
+	switch t {
+	case types.String:
+		return columnText
+	case types.Bool:
+		return columnBool
+	case types.Int32, types.Uint16:
+		return columnInt
+	case types.Int16, types.Int8, types.Uint8:
+		return columnSmallInt
+	case types.Float32:
+		return columnReal
+	case types.Float64:
+		return columnDouble
+	}
+	if types.IsInteger(t) {
+		return columnBigInt
+	}
+	return ""
+}
+
+// ddl returns the CREATE TABLE statement of a table.
+func (tbl *table) ddl() string {
+	lines := []string{}
+	keys := []string{}
+	for _, c := range tbl.Columns {
+		line := "  " + c.Name + " " + c.SQLType
+		if !c.Nullable {
+			line += " NOT NULL"
+		}
+		if c.Unique {
+			line += " UNIQUE"
+		}
+		lines = append(lines, line)
+		if c.PrimaryKey {
+			keys = append(keys, c.Name)
+		}
+	}
+	if len(keys) > 0 {
+		lines = append(lines, "  PRIMARY KEY ("+strings.Join(keys, ", ")+")")
+	}
+	return "CREATE TABLE " + tbl.Name + " (\n" + strings.Join(lines, ",\n") + "\n);"
+}
+
+func Packages(context *generator.Context, arguments *args.GeneratorArgs) generator.Packages {
+	boilerplate, err := arguments.LoadGoBoilerplate()
+	if err != nil {
+		log.Fatalf("Failed loading boilerplate: %v", err)
+	}
+	dialect := arguments.CustomArgs.(*CustomArgs).Dialect
+
+	packages := generator.Packages{}
+	header := append(arguments.GeneratedBuildConstraint(), boilerplate...)
+
+	for i := range sets.NewString(context.Inputs...) {
+		log.Debugf("Considering pkg %q", i)
+		pkg := context.Universe[i]
+		if pkg == nil {
+			// If the input had no Go files, for example.
+			continue
+		}
+
+		ptagValue := ""
+		if values := types.ExtractCommentTags("+", pkg.Comments)[tagName]; len(values) > 0 {
+			ptagValue = values[0]
+			if ptagValue != tagValuePackage {
+				log.Fatalf("Package %v: unsupported %s value: %q", i, tagName, ptagValue)
+			}
+		}
+
+		tables := map[*types.Type]*table{}
+		for _, t := range pkg.SortedTypes() {
+			if t.Kind != types.Struct {
+				continue
+			}
+			comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
+			values := types.ExtractCommentTags("+", comments)[tagName]
+			if len(values) > 1 || (len(values) == 1 && values[0] != "" && values[0] != "true" && values[0] != "false") {
+				log.Fatalf("Type %v: unsupported %s values: %q", t, tagName, values)
+			}
+			if (len(values) == 0 && ptagValue != tagValuePackage) || (len(values) == 1 && values[0] == "false") {
+				continue
+			}
+			tables[t] = newTable(t, dialect)
+		}
+		if len(tables) == 0 {
+			continue
+		}
+
+		log.Infof("Package %q needs generation", i)
+		packages = append(packages,
+			&generator.DefaultPackage{
+				PackageName: strings.Split(filepath.Base(pkg.Path), ".")[0],
+				PackagePath: pkg.Path,
+				HeaderText:  header,
+				GeneratorFunc: func(c *generator.Context) (generators []generator.Generator) {
+					return []generator.Generator{
+						NewGenSQL(arguments.OutputFileName(pkg, "sql"), pkg.Path, tables),
+					}
+				},
+				FilterFunc: func(c *generator.Context, t *types.Type) bool {
+					return t.Name.Package == pkg.Path
+				},
+			})
+	}
+	return packages
+}
+
+// genSQL produces a file with the table helpers of the structs of a package.
+type genSQL struct {
+	generator.DefaultGen
+	targetPackage string
+	imports       namer.ImportTracker
+	tables        map[*types.Type]*table
+}
+
+func NewGenSQL(sanitizedName, targetPackage string, tables map[*types.Type]*table) generator.Generator {
+	return &genSQL{
+		DefaultGen: generator.DefaultGen{
+			OptionalName: sanitizedName,
+		},
+		targetPackage: targetPackage,
+		imports:       generator.NewImportTracker(),
+		tables:        tables,
+	}
+}
+
+func (g *genSQL) Namers(c *generator.Context) namer.NameSystems {
+	// Have the raw namer for this file track what it imports.
+	return namer.NameSystems{
+		"raw": namer.NewRawNamer(g.targetPackage, g.imports),
+	}
+}
+
+func (g *genSQL) Filter(c *generator.Context, t *types.Type) bool {
+	_, ok := g.tables[t]
+	return ok
+}
+
+func (g *genSQL) isOtherPackage(pkg string) bool {
+	if pkg == g.targetPackage {
+		return false
+	}
+	if strings.HasSuffix(pkg, "\""+g.targetPackage+"\"") {
+		return false
+	}
+	return true
+}
+
+func (g *genSQL) Imports(c *generator.Context) (imports []string) {
+	importLines := []string{}
+	for _, singleImport := range g.imports.ImportLines() {
+		if g.isOtherPackage(singleImport) {
+			importLines = append(importLines, singleImport)
+		}
+	}
+	return importLines
+}
+
+func (g *genSQL) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	log.Infof("Generating SQL helpers for type %v", t)
+
+	tbl := g.tables[t]
+	names, pointers, values := []string{}, []string{}, []string{}
+	for _, col := range tbl.Columns {
+		names = append(names, fmt.Sprintf("%q", col.Name))
+		pointers = append(pointers, "&x."+col.Field)
+		values = append(values, "x."+col.Field)
+	}
+	sw := generator.NewSnippetWriter(w, c, "$", "$")
+	sw.Do(sqlCode, generator.Args{
+		"type":     t,
+		"table":    fmt.Sprintf("%q", tbl.Name),
+		"ddl":      "`" + tbl.ddl() + "`",
+		"columns":  strings.Join(names, ", "),
+		"pointers": strings.Join(pointers, ", "),
+		"values":   strings.Join(values, ", "),
+	})
+	return sw.Error()
+}
+
+var sqlCode = `// $.type|public$Table is the name of the table of $.type|raw$.
+const $.type|public$Table = $.table$
+
+// $.type|public$Schema creates the table of $.type|raw$.
+const $.type|public$Schema = $.ddl$
+
+// $.type|public$Columns returns the columns of the table of $.type|raw$, in the
+// order of SQLPointers and SQLValues.
+func $.type|public$Columns() []string {
+	return []string{$.columns$}
+}
+
+// SQLPointers returns pointers to the fields of x stored in the columns of
+// its table, for Scan.
+func (x *$.type|raw$) SQLPointers() []interface{} {
+	return []interface{}{$.pointers$}
+}
+
+// SQLValues returns the values of the fields of x stored in the columns of
+// its table, for Exec.
+func (x *$.type|raw$) SQLValues() []interface{} {
+	return []interface{}{$.values$}
+}
+
+// ScanRow sets x from the current row of a *sql.Row or *sql.Rows, which
+// must select the columns of $.type|public$Columns in order.
+func (x *$.type|raw$) ScanRow(row interface{ Scan(dest ...interface{}) error }) error {
+	return row.Scan(x.SQLPointers()...)
+}
+
+`
@@ -20,19 +20,51 @@ type Logger interface {
 
 	Debugf(format string, v ...interface{})
 
+	// Debugw logs a message with fields, given as alternating keys and
+	// values.
+	Debugw(msg string, keysAndValues ...interface{})
+
 	Info(args ...interface{})
 
 	Infof(format string, v ...interface{})
 
+	Infow(msg string, keysAndValues ...interface{})
+
 	Warn(args ...interface{})
 
 	Warnf(format string, v ...interface{})
 
+	Warnw(msg string, keysAndValues ...interface{})
+
 	Error(args ...interface{})
 
 	Errorf(format string, v ...interface{})
 
+	Errorw(msg string, keysAndValues ...interface{})
+
 	Fatal(args ...interface{})
 
 	Fatalf(format string, v ...interface{})
 }
+
+// Level is the severity of a log message.
+type Level int8
+
+const (
+	DebugLevel Level = iota - 1
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+// VerbosityLevel returns the lowest level logged at verbosity 'v': errors
+// and warnings at 0, info at 1, and everything at 2 and above.
+func VerbosityLevel(v int) Level {
+	switch {
+	case v <= 0:
+		return WarnLevel
+	case v == 1:
+		return InfoLevel
+	}
+	return DebugLevel
+}
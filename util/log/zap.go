@@ -22,12 +22,19 @@ import (
 	"go.uber.org/zap/zapcore"
 )
 
-var deLogger Logger
+var (
+	deLogger Logger
+
+	// The lowest level logged by the package functions.
+	level = DebugLevel
+)
 
 func init() {
 	DefaultOut(os.Stdout)
 }
 
+// DefaultOut makes the package functions log to 'out', replacing any Logger
+// set with SetLogger.
 func DefaultOut(out io.Writer) {
 	ws := zapcore.AddSync(out)
 	encoder := getEncoder()
@@ -36,6 +43,23 @@ func DefaultOut(out io.Writer) {
 	deLogger = logger.Sugar()
 }
 
+// SetLogger makes the package functions log to 'l'. It isn't safe to call
+// while logging.
+func SetLogger(l Logger) {
+	deLogger = l
+}
+
+// Default returns a Logger which logs like the package functions.
+func Default() Logger {
+	return levelLogger{}
+}
+
+// SetLevel sets the lowest level logged by the package functions. It isn't
+// safe to call while logging.
+func SetLevel(l Level) {
+	level = l
+}
+
 func getEncoder() zapcore.Encoder {
 	encoderConfig := zap.NewProductionEncoderConfig()
 	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
@@ -44,35 +68,75 @@ func getEncoder() zapcore.Encoder {
 }
 
 func Debug(args ...interface{}) {
-	deLogger.Debug(args...)
+	if level <= DebugLevel {
+		deLogger.Debug(args...)
+	}
 }
 
 func Debugf(format string, v ...interface{}) {
-	deLogger.Debugf(format, v...)
+	if level <= DebugLevel {
+		deLogger.Debugf(format, v...)
+	}
+}
+
+func Debugw(msg string, keysAndValues ...interface{}) {
+	if level <= DebugLevel {
+		deLogger.Debugw(msg, keysAndValues...)
+	}
 }
 
 func Info(args ...interface{}) {
-	deLogger.Info(args...)
+	if level <= InfoLevel {
+		deLogger.Info(args...)
+	}
 }
 
 func Infof(format string, v ...interface{}) {
-	deLogger.Infof(format, v...)
+	if level <= InfoLevel {
+		deLogger.Infof(format, v...)
+	}
+}
+
+func Infow(msg string, keysAndValues ...interface{}) {
+	if level <= InfoLevel {
+		deLogger.Infow(msg, keysAndValues...)
+	}
 }
 
 func Warn(args ...interface{}) {
-	deLogger.Warn(args...)
+	if level <= WarnLevel {
+		deLogger.Warn(args...)
+	}
 }
 
 func Warnf(format string, v ...interface{}) {
-	deLogger.Warnf(format, v...)
+	if level <= WarnLevel {
+		deLogger.Warnf(format, v...)
+	}
+}
+
+func Warnw(msg string, keysAndValues ...interface{}) {
+	if level <= WarnLevel {
+		deLogger.Warnw(msg, keysAndValues...)
+	}
 }
 
 func Error(args ...interface{}) {
-	deLogger.Error(args...)
+	if level <= ErrorLevel {
+		deLogger.Error(args...)
+	}
 }
 
 func Errorf(format string, v ...interface{}) {
-	deLogger.Errorf(format, v...)
+	if level <= ErrorLevel {
+		deLogger.Errorf(format, v...)
+	}
+}
+
+func Errorw(msg string, keysAndValues ...interface{}) {
+	if level <= ErrorLevel {
+		deLogger.Errorw(msg, keysAndValues...)
+	}
 }
 
 func Fatal(args ...interface{}) {
@@ -82,3 +146,87 @@ func Fatal(args ...interface{}) {
 func Fatalf(format string, v ...interface{}) {
 	deLogger.Fatalf(format, v...)
 }
+
+// levelLogger logs to deLogger, dropping messages below the level. It calls
+// deLogger directly, so the caller skipped is the caller of its methods.
+type levelLogger struct{}
+
+func (levelLogger) Debug(args ...interface{}) {
+	if level <= DebugLevel {
+		deLogger.Debug(args...)
+	}
+}
+
+func (levelLogger) Debugf(format string, v ...interface{}) {
+	if level <= DebugLevel {
+		deLogger.Debugf(format, v...)
+	}
+}
+
+func (levelLogger) Debugw(msg string, keysAndValues ...interface{}) {
+	if level <= DebugLevel {
+		deLogger.Debugw(msg, keysAndValues...)
+	}
+}
+
+func (levelLogger) Info(args ...interface{}) {
+	if level <= InfoLevel {
+		deLogger.Info(args...)
+	}
+}
+
+func (levelLogger) Infof(format string, v ...interface{}) {
+	if level <= InfoLevel {
+		deLogger.Infof(format, v...)
+	}
+}
+
+func (levelLogger) Infow(msg string, keysAndValues ...interface{}) {
+	if level <= InfoLevel {
+		deLogger.Infow(msg, keysAndValues...)
+	}
+}
+
+func (levelLogger) Warn(args ...interface{}) {
+	if level <= WarnLevel {
+		deLogger.Warn(args...)
+	}
+}
+
+func (levelLogger) Warnf(format string, v ...interface{}) {
+	if level <= WarnLevel {
+		deLogger.Warnf(format, v...)
+	}
+}
+
+func (levelLogger) Warnw(msg string, keysAndValues ...interface{}) {
+	if level <= WarnLevel {
+		deLogger.Warnw(msg, keysAndValues...)
+	}
+}
+
+func (levelLogger) Error(args ...interface{}) {
+	if level <= ErrorLevel {
+		deLogger.Error(args...)
+	}
+}
+
+func (levelLogger) Errorf(format string, v ...interface{}) {
+	if level <= ErrorLevel {
+		deLogger.Errorf(format, v...)
+	}
+}
+
+func (levelLogger) Errorw(msg string, keysAndValues ...interface{}) {
+	if level <= ErrorLevel {
+		deLogger.Errorw(msg, keysAndValues...)
+	}
+}
+
+func (levelLogger) Fatal(args ...interface{}) {
+	deLogger.Fatal(args...)
+}
+
+func (levelLogger) Fatalf(format string, v ...interface{}) {
+	deLogger.Fatalf(format, v...)
+}
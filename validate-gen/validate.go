@@ -0,0 +1,552 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package validate_gen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/namer"
+	"github.com/lack-io/gogogen/gogenerator/types"
+	"github.com/lack-io/gogogen/util/log"
+	"github.com/lack-io/gogogen/util/sets"
+)
+
+// These are the comment tags that carry parameters for validation.
+const (
+	// On types and packages, to request or opt out of generation.
+	tagName = "gogogen:validate-gen"
+	// On fields, with the rules they must follow, as in
+	// +validate:min=1,max=10.
+	rulesTagName = "validate"
+
+	// tagValuePackage, on a package, asks for Validate methods on every
+	// struct in it.
+	tagValuePackage = "package"
+)
+
+// The rules fields may be given.
+const (
+	ruleRequired = "required"
+	ruleMin      = "min"
+	ruleMax      = "max"
+	rulePattern  = "pattern"
+	ruleEnum     = "enum"
+)
+
+// validationPackage holds the error types the generated code uses.
+const validationPackage = "github.com/lack-io/gogogen/runtime/validation"
+
+// NameSystems returns the name system used by the generators in this package.
+func NameSystems() namer.NameSystems {
+	return namer.NameSystems{
+		"public": namer.NewPublicNamer(0),
+		"raw":    namer.NewRawNamer("", nil),
+	}
+}
+
+// DefaultNameSystem returns the default name system for ordering the types to
+// be processed by the generators in this package.
+func DefaultNameSystem() string {
+	return "public"
+}
+
+// fieldRules are the rules of a field.
+type fieldRules struct {
+	Required bool
+	Min, Max *string
+	Pattern  *string
+	Enum     []string
+}
+
+func (r *fieldRules) empty() bool {
+	return !r.Required && r.Min == nil && r.Max == nil && r.Pattern == nil && r.Enum == nil
+}
+
+// parseRules returns the rules of the field 'm' of 't'.
+func parseRules(t *types.Type, m types.Member) *fieldRules {
+	params, err := m.CommentTags("+").Params(rulesTagName)
+	if err != nil {
+		log.Fatalf("Type %v, field %s: %v", t, m.Name, err)
+	}
+	r := &fieldRules{}
+	for i := range params {
+		p := params[i]
+		switch p.Key {
+		case ruleRequired:
+			r.Required = true
+		case ruleMin, ruleMax:
+			if _, err := strconv.ParseFloat(p.Value, 64); err != nil {
+				log.Fatalf("Type %v, field %s: %s=%q is not a number", t, m.Name, p.Key, p.Value)
+			}
+			if p.Key == ruleMin {
+				r.Min = &p.Value
+			} else {
+				r.Max = &p.Value
+			}
+		case rulePattern:
+			if _, err := regexp.Compile(p.Value); err != nil {
+				log.Fatalf("Type %v, field %s: invalid pattern: %v", t, m.Name, err)
+			}
+			r.Pattern = &p.Value
+		case ruleEnum:
+			r.Enum = strings.Split(p.Value, "|")
+		default:
+			log.Fatalf("Type %v, field %s: unknown rule %q", t, m.Name, p.Key)
+		}
+	}
+	return r
+}
+
+// wantsValidate returns whether a Validate method is requested for 't',
+// either by its own tag, by the tag of its package, or by rules on its
+// fields.
+func wantsValidate(t *types.Type, ptagValue string, rules map[string]*fieldRules) bool {
+	comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
+	values := types.ExtractCommentTags("+", comments)[tagName]
+	if len(values) > 1 {
+		log.Fatalf("Type %v: found %d %s tags: %q", t, len(values), tagName, values)
+	}
+	if len(values) == 1 {
+		switch values[0] {
+		case "", "true":
+			return true
+		case "false":
+			return false
+		default:
+			log.Fatalf("Type %v: unsupported %s value: %q", t, tagName, values[0])
+		}
+	}
+	return ptagValue == tagValuePackage || len(rules) > 0
+}
+
+// findValidated returns the structs of 'pkg' which get Validate methods,
+// along with the rules of their fields, indexed by field name.
+func findValidated(pkg *types.Package) map[*types.Type]map[string]*fieldRules {
+	ptagValue := ""
+	if values := types.ExtractCommentTags("+", pkg.Comments)[tagName]; len(values) > 0 {
+		ptagValue = values[0]
+		if ptagValue != tagValuePackage {
+			log.Fatalf("Package %v: unsupported %s value: %q", pkg.Path, tagName, ptagValue)
+		}
+	}
+
+	validated := map[*types.Type]map[string]*fieldRules{}
+	for _, t := range pkg.SortedTypes() {
+		if t.Kind != types.Struct {
+			continue
+		}
+		rules := map[string]*fieldRules{}
+		for _, m := range t.Members {
+			if r := parseRules(t, m); !r.empty() {
+				checkRules(t, m, r)
+				rules[m.Name] = r
+			}
+		}
+		if !wantsValidate(t, ptagValue, rules) {
+			continue
+		}
+		if t.Methods["Validate"] != nil {
+			log.Warnf("Type %v: not generating Validate, which is already defined", t)
+			continue
+		}
+		validated[t] = rules
+	}
+	return validated
+}
+
+// valueKind is what the rules of a field apply to.
+type valueKind int
+
+const (
+	unsupportedKind valueKind = iota
+	stringKind
+	numberKind
+	lengthKind
+)
+
+// kindOf returns what the rules of a field of type 't' apply to, once
+// pointers are followed.
+func kindOf(t *types.Type) valueKind {
+	if t.Kind == types.Pointer {
+		t = t.Elem
+	}
+	if t.Kind == types.Alias {
+		t = t.Underlying
+	}
+	switch {
+	case t == types.String:
+		return stringKind
+	case types.IsInteger(t) || t == types.Float32 || t == types.Float64:
+		return numberKind
+	case t.Kind == types.Slice || t.Kind == types.Map:
+		return lengthKind
+	}
+	return unsupportedKind
+}
+
+// checkRules fails if the rules of a field can't apply to its type.
+func checkRules(t *types.Type, m types.Member, r *fieldRules) {
+	kind := kindOf(m.Type)
+	unsupported := func(rule string) {
+		log.Fatalf("Type %v, field %s: rule %q doesn't apply to %v", t, m.Name, rule, m.Type)
+	}
+	if r.Required && kind == unsupportedKind && m.Type.Kind != types.Pointer {
+		unsupported(ruleRequired)
+	}
+	if (r.Min != nil || r.Max != nil) && kind == unsupportedKind {
+		unsupported(ruleMin + "/" + ruleMax)
+	}
+	if r.Pattern != nil && kind != stringKind {
+		unsupported(rulePattern)
+	}
+	if r.Enum != nil {
+		switch kind {
+		case stringKind:
+		case numberKind:
+			for _, v := range r.Enum {
+				if _, err := strconv.ParseFloat(v, 64); err != nil {
+					log.Fatalf("Type %v, field %s: enum value %q is not a number", t, m.Name, v)
+				}
+			}
+		default:
+			unsupported(ruleEnum)
+		}
+	}
+}
+
+func Packages(context *generator.Context, arguments *args.GeneratorArgs) generator.Packages {
+	boilerplate, err := arguments.LoadGoBoilerplate()
+	if err != nil {
+		log.Fatalf("Failed loading boilerplate: %v", err)
+	}
+
+	packages := generator.Packages{}
+	header := append(arguments.GeneratedBuildConstraint(), boilerplate...)
+
+	for i := range sets.NewString(context.Inputs...) {
+		log.Debugf("Considering pkg %q", i)
+		pkg := context.Universe[i]
+		if pkg == nil {
+			// If the input had no Go files, for example.
+			continue
+		}
+
+		validated := findValidated(pkg)
+		if len(validated) == 0 {
+			continue
+		}
+
+		log.Infof("Package %q needs generation", i)
+		packages = append(packages,
+			&generator.DefaultPackage{
+				PackageName: strings.Split(filepath.Base(pkg.Path), ".")[0],
+				PackagePath: pkg.Path,
+				HeaderText:  header,
+				GeneratorFunc: func(c *generator.Context) (generators []generator.Generator) {
+					return []generator.Generator{
+						NewGenValidate(arguments.OutputFileName(pkg, "validate"), pkg.Path, validated),
+					}
+				},
+				FilterFunc: func(c *generator.Context, t *types.Type) bool {
+					return t.Name.Package == pkg.Path
+				},
+			})
+	}
+	return packages
+}
+
+// genValidate produces a file with the Validate methods of the structs of a
+// package.
+type genValidate struct {
+	generator.DefaultGen
+	targetPackage string
+	imports       namer.ImportTracker
+	validated     map[*types.Type]map[string]*fieldRules
+}
+
+func NewGenValidate(sanitizedName, targetPackage string, validated map[*types.Type]map[string]*fieldRules) generator.Generator {
+	return &genValidate{
+		DefaultGen: generator.DefaultGen{
+			OptionalName: sanitizedName,
+		},
+		targetPackage: targetPackage,
+		imports:       generator.NewImportTracker(),
+		validated:     validated,
+	}
+}
+
+func (g *genValidate) Namers(c *generator.Context) namer.NameSystems {
+	// Have the raw namer for this file track what it imports.
+	return namer.NameSystems{
+		"raw": namer.NewRawNamer(g.targetPackage, g.imports),
+	}
+}
+
+func (g *genValidate) Filter(c *generator.Context, t *types.Type) bool {
+	_, ok := g.validated[t]
+	return ok
+}
+
+func (g *genValidate) isOtherPackage(pkg string) bool {
+	if pkg == g.targetPackage {
+		return false
+	}
+	if strings.HasSuffix(pkg, "\""+g.targetPackage+"\"") {
+		return false
+	}
+	return true
+}
+
+func (g *genValidate) Imports(c *generator.Context) (imports []string) {
+	importLines := []string{}
+	for _, singleImport := range g.imports.ImportLines() {
+		if g.isOtherPackage(singleImport) {
+			importLines = append(importLines, singleImport)
+		}
+	}
+	return importLines
+}
+
+// fieldPath returns the name of the field 'm' in error messages, which is
+// its JSON name.
+func fieldPath(m types.Member) string {
+	tag, _ := m.StructTag("json")
+	name := tag.Name
+	if len(name) == 0 || name == "-" {
+		if m.Embedded {
+			return ""
+		}
+		return m.Name
+	}
+	return name
+}
+
+// isOmitEmpty returns true if the field 'm' is left out of JSON when it is
+// empty, which makes it optional.
+func isOmitEmpty(m types.Member) bool {
+	tag, _ := m.StructTag("json")
+	return tag.HasOption("omitempty")
+}
+
+// isSet returns the condition of the value 'v' of type 't' not being empty.
+func isSet(v string, t *types.Type) string {
+	switch kindOf(t) {
+	case stringKind:
+		return v + ` != ""`
+	case numberKind:
+		return v + " != 0"
+	}
+	return "len(" + v + ") > 0"
+}
+
+// isStruct returns true for named structs, which may have Validate methods.
+func isStruct(t *types.Type) bool {
+	return len(t.Name.Package) > 0 && t.Kind == types.Struct
+}
+
+// validateWriter writes the body of a Validate method.
+type validateWriter struct {
+	b   *bytes.Buffer
+	raw namer.Namer
+}
+
+func (vw *validateWriter) printf(format string, args ...interface{}) {
+	fmt.Fprintf(vw.b, format, args...)
+}
+
+// fail returns the statement recording the failure of the field at 'path'.
+func (vw *validateWriter) fail(path, message string) string {
+	return fmt.Sprintf("errs = append(errs, &%s{Field: %q, Message: %q})\n",
+		vw.raw.Name(types.Ref(validationPackage, "Error")), path, message)
+}
+
+// rules writes the checks of the rules on the value 'v', as a chain of ifs,
+// so that only the first failure of a field is reported.
+func (vw *validateWriter) rules(v, path string, t *types.Type, r *fieldRules, pattern string) {
+	kind := kindOf(t)
+	var conds []string
+	var msgs []string
+	check := func(cond, msg string) {
+		conds = append(conds, cond)
+		msgs = append(msgs, msg)
+	}
+	length := "len(" + v + ")"
+	if kind == stringKind {
+		length = vw.raw.Name(types.Ref("unicode/utf8", "RuneCountInString")) + "(string(" + v + "))"
+	}
+	if r.Required {
+		switch kind {
+		case numberKind:
+			check(v+" == 0", "is required")
+		default:
+			check("len("+v+") == 0", "is required")
+		}
+	}
+	// How bounds on lengths are described.
+	least, most, unit := "must have at least ", "must have at most ", " items"
+	if kind == stringKind {
+		least, most, unit = "must be at least ", "must be at most ", " characters long"
+	}
+	if r.Min != nil {
+		if kind == numberKind {
+			check(v+" < "+*r.Min, "must be at least "+*r.Min)
+		} else {
+			check(length+" < "+*r.Min, least+*r.Min+unit)
+		}
+	}
+	if r.Max != nil {
+		if kind == numberKind {
+			check(v+" > "+*r.Max, "must be at most "+*r.Max)
+		} else {
+			check(length+" > "+*r.Max, most+*r.Max+unit)
+		}
+	}
+	if r.Pattern != nil {
+		check("!"+pattern+".MatchString(string("+v+"))", "must match "+*r.Pattern)
+	}
+	if r.Enum != nil {
+		values := []string{}
+		for _, e := range r.Enum {
+			if kind == stringKind {
+				values = append(values, v+" != "+strconv.Quote(e))
+			} else {
+				values = append(values, v+" != "+e)
+			}
+		}
+		check(strings.Join(values, " && "), "must be one of "+strings.Join(r.Enum, ", "))
+	}
+	for i := range conds {
+		if i > 0 {
+			vw.printf("} else ")
+		}
+		vw.printf("if %s {\n%s", conds[i], vw.fail(path, msgs[i]))
+	}
+	if len(conds) > 0 {
+		vw.printf("}\n")
+	}
+}
+
+// nested writes the validation of the values held by the field 'v' of type
+// 't', if they may have Validate methods.
+func (vw *validateWriter) nested(v, path string, t *types.Type) {
+	validate := vw.raw.Name(types.Ref(validationPackage, "Validate"))
+	nested := func(path, ptr string) {
+		vw.printf("errs = append(errs, %s(%s, %s)...)\n", validate, path, ptr)
+	}
+	switch {
+	case isStruct(t):
+		if strings.HasPrefix(v, "*") {
+			nested(strconv.Quote(path), v[1:])
+		} else {
+			nested(strconv.Quote(path), "&"+v)
+		}
+	case t.Kind == types.Pointer && isStruct(t.Elem):
+		vw.printf("if %s != nil {\n", v)
+		nested(strconv.Quote(path), v)
+		vw.printf("}\n")
+	case t.Kind == types.Slice && isStruct(t.Elem):
+		vw.printf("for i := range %s {\n", v)
+		nested(vw.raw.Name(types.Ref(validationPackage, "Index"))+"("+strconv.Quote(path)+", i)", "&"+v+"[i]")
+		vw.printf("}\n")
+	case t.Kind == types.Slice && t.Elem.Kind == types.Pointer && isStruct(t.Elem.Elem):
+		vw.printf("for i := range %s {\n", v)
+		vw.printf("if %s[i] != nil {\n", v)
+		nested(vw.raw.Name(types.Ref(validationPackage, "Index"))+"("+strconv.Quote(path)+", i)", v+"[i]")
+		vw.printf("}\n}\n")
+	case t.Kind == types.Map && isStruct(t.Elem):
+		vw.printf("for k, v := range %s {\n", v)
+		nested(vw.raw.Name(types.Ref(validationPackage, "Key"))+"("+strconv.Quote(path)+", k)", "&v")
+		vw.printf("}\n")
+	case t.Kind == types.Map && t.Elem.Kind == types.Pointer && isStruct(t.Elem.Elem):
+		vw.printf("for k, v := range %s {\n", v)
+		vw.printf("if v != nil {\n")
+		nested(vw.raw.Name(types.Ref(validationPackage, "Key"))+"("+strconv.Quote(path)+", k)", "v")
+		vw.printf("}\n}\n")
+	}
+}
+
+// patternVar returns the name of the variable holding the compiled pattern
+// of a field.
+func patternVar(t *types.Type, m types.Member) string {
+	return "validate" + t.Name.Name + m.Name + "Pattern"
+}
+
+func (g *genValidate) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	log.Infof("Generating Validate for type %v", t)
+
+	rules := g.validated[t]
+	vw := &validateWriter{b: &bytes.Buffer{}, raw: c.Namers["raw"]}
+	for _, m := range t.Members {
+		if r := rules[m.Name]; r != nil && r.Pattern != nil {
+			vw.printf("var %s = %s(%q)\n\n", patternVar(t, m), vw.raw.Name(types.Ref("regexp", "MustCompile")), *r.Pattern)
+		}
+	}
+
+	vw.printf("// Validate checks the fields of x against the rules in their comment tags,\n")
+	vw.printf("// and validates the fields whose types have Validate methods.\n")
+	vw.printf("func (x *%s) Validate() error {\n", vw.raw.Name(t))
+	vw.printf("var errs %s\n", vw.raw.Name(types.Ref(validationPackage, "Errors")))
+	for _, m := range t.Members {
+		if m.Name == "_" {
+			continue
+		}
+		path := fieldPath(m)
+		v := "x." + m.Name
+		r := rules[m.Name]
+		if m.Type.Kind == types.Pointer && (r != nil || isStruct(m.Type.Elem)) {
+			// Rules apply to what the pointer points to, if anything.
+			inner := &validateWriter{b: &bytes.Buffer{}, raw: vw.raw}
+			if r != nil {
+				elemRules := *r
+				elemRules.Required = false
+				inner.rules("*"+v, path, m.Type, &elemRules, patternVar(t, m))
+			}
+			inner.nested("*"+v, path, m.Type.Elem)
+			switch {
+			case r != nil && r.Required && inner.b.Len() > 0:
+				vw.printf("if %s == nil {\n%s} else {\n%s}\n", v, vw.fail(path, "is required"), inner.b)
+			case r != nil && r.Required:
+				vw.printf("if %s == nil {\n%s}\n", v, vw.fail(path, "is required"))
+			case inner.b.Len() > 0:
+				vw.printf("if %s != nil {\n%s}\n", v, inner.b)
+			}
+			continue
+		}
+		if r != nil {
+			if isOmitEmpty(m) && !r.Required {
+				// Optional fields are only checked when set.
+				inner := &validateWriter{b: &bytes.Buffer{}, raw: vw.raw}
+				inner.rules(v, path, m.Type, r, patternVar(t, m))
+				vw.printf("if %s {\n%s}\n", isSet(v, m.Type), inner.b)
+			} else {
+				vw.rules(v, path, m.Type, r, patternVar(t, m))
+			}
+		}
+		vw.nested(v, path, m.Type)
+	}
+	vw.printf("return errs.ErrorOrNil()\n")
+	vw.printf("}\n\n")
+
+	_, err := w.Write(vw.b.Bytes())
+	return err
+}
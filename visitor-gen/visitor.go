@@ -0,0 +1,302 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package visitor_gen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/namer"
+	"github.com/lack-io/gogogen/gogenerator/types"
+	"github.com/lack-io/gogogen/util/log"
+	"github.com/lack-io/gogogen/util/sets"
+)
+
+// This is the comment tag that asks for a visitor of an interface.
+const tagName = "gogogen:visitor"
+
+// NameSystems returns the name system used by the generators in this package.
+func NameSystems() namer.NameSystems {
+	return namer.NameSystems{
+		"public": namer.NewPublicNamer(0),
+		"raw":    namer.NewRawNamer("", nil),
+	}
+}
+
+// DefaultNameSystem returns the default name system for ordering the types to
+// be processed by the generators in this package.
+func DefaultNameSystem() string {
+	return "public"
+}
+
+// wantsVisitor returns true if a visitor is requested for the interface 't'.
+func wantsVisitor(t *types.Type) bool {
+	comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
+	values := types.ExtractCommentTags("+", comments)[tagName]
+	if len(values) == 0 {
+		return false
+	}
+	if len(values) > 1 {
+		log.Fatalf("Type %v: found %d %s tags: %q", t, len(values), tagName, values)
+	}
+	switch values[0] {
+	case "", "true":
+		return true
+	case "false":
+		return false
+	}
+	log.Fatalf("Type %v: unsupported %s value: %q", t, tagName, values[0])
+	return false
+}
+
+// sameSignature returns true if the method types 'a' and 'b' take and return
+// the same types, regardless of their receivers.
+func sameSignature(a, b *types.Signature) bool {
+	if a == nil || b == nil {
+		return false
+	}
+	if a.Variadic != b.Variadic || len(a.Parameters) != len(b.Parameters) || len(a.Results) != len(b.Results) {
+		return false
+	}
+	for i := range a.Parameters {
+		if a.Parameters[i] != b.Parameters[i] {
+			return false
+		}
+	}
+	for i := range a.Results {
+		if a.Results[i] != b.Results[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// variantOf returns the type implementing 'iface' for the named type 't': 't'
+// itself if all the methods implementing it have value receivers, a pointer
+// to 't' if any has a pointer receiver, and nil if 't' doesn't implement it.
+func variantOf(t, iface *types.Type) *types.Type {
+	if t.Kind == types.Interface || t.Kind == types.Pointer || len(t.Methods) < len(iface.Methods) {
+		return nil
+	}
+	byPointer := false
+	for name, m := range iface.Methods {
+		tm, ok := t.Methods[name]
+		if !ok || !sameSignature(m.Signature, tm.Signature) {
+			return nil
+		}
+		if r := tm.Signature.Receiver; r != nil && r.Kind == types.Pointer {
+			byPointer = true
+		}
+	}
+	if byPointer {
+		return &types.Type{
+			Name: types.Name{Name: "*" + t.Name.String()},
+			Kind: types.Pointer,
+			Elem: t,
+		}
+	}
+	return t
+}
+
+// variants returns the types of package 'pkg' implementing 'iface', sorted by
+// name.
+func variants(pkg *types.Package, iface *types.Type) []*types.Type {
+	names := []string{}
+	for name := range pkg.Types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := []*types.Type{}
+	for _, name := range names {
+		if v := variantOf(pkg.Types[name], iface); v != nil {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func Packages(context *generator.Context, arguments *args.GeneratorArgs) generator.Packages {
+	boilerplate, err := arguments.LoadGoBoilerplate()
+	if err != nil {
+		log.Fatalf("Failed loading boilerplate: %v", err)
+	}
+
+	packages := generator.Packages{}
+	header := append(arguments.GeneratedBuildConstraint(), boilerplate...)
+
+	for i := range sets.NewString(context.Inputs...) {
+		log.Debugf("Considering pkg %q", i)
+		pkg := context.Universe[i]
+		if pkg == nil {
+			// If the input had no Go files, for example.
+			continue
+		}
+
+		requested := map[*types.Type][]*types.Type{}
+		for _, t := range pkg.SortedTypes() {
+			if t.Kind != types.Interface || len(t.Methods) == 0 || !wantsVisitor(t) {
+				continue
+			}
+			vs := variants(pkg, t)
+			if len(vs) == 0 {
+				log.Fatalf("Type %v: no type of package %q implements it", t, pkg.Path)
+			}
+			requested[t] = vs
+		}
+		if len(requested) == 0 {
+			continue
+		}
+
+		log.Infof("Package %q needs generation", i)
+		packages = append(packages,
+			&generator.DefaultPackage{
+				PackageName: strings.Split(filepath.Base(pkg.Path), ".")[0],
+				PackagePath: pkg.Path,
+				HeaderText:  header,
+				GeneratorFunc: func(c *generator.Context) (generators []generator.Generator) {
+					return []generator.Generator{
+						NewGenVisitor(arguments.OutputFileName(pkg, "visitor"), pkg.Path, requested),
+					}
+				},
+				FilterFunc: func(c *generator.Context, t *types.Type) bool {
+					return t.Name.Package == pkg.Path
+				},
+			})
+	}
+	return packages
+}
+
+// genVisitor produces a file with the visitors of the tagged unions of a
+// package.
+type genVisitor struct {
+	generator.DefaultGen
+	targetPackage string
+	imports       namer.ImportTracker
+	requested     map[*types.Type][]*types.Type
+}
+
+func NewGenVisitor(sanitizedName, targetPackage string, requested map[*types.Type][]*types.Type) generator.Generator {
+	return &genVisitor{
+		DefaultGen: generator.DefaultGen{
+			OptionalName: sanitizedName,
+		},
+		targetPackage: targetPackage,
+		imports:       generator.NewImportTracker(),
+		requested:     requested,
+	}
+}
+
+func (g *genVisitor) Namers(c *generator.Context) namer.NameSystems {
+	// Have the raw namer for this file track what it imports.
+	return namer.NameSystems{
+		"raw": namer.NewRawNamer(g.targetPackage, g.imports),
+	}
+}
+
+func (g *genVisitor) Filter(c *generator.Context, t *types.Type) bool {
+	_, ok := g.requested[t]
+	return ok
+}
+
+func (g *genVisitor) isOtherPackage(pkg string) bool {
+	if pkg == g.targetPackage {
+		return false
+	}
+	if strings.HasSuffix(pkg, "\""+g.targetPackage+"\"") {
+		return false
+	}
+	return true
+}
+
+func (g *genVisitor) Imports(c *generator.Context) (imports []string) {
+	importLines := []string{}
+	for _, singleImport := range g.imports.ImportLines() {
+		if g.isOtherPackage(singleImport) {
+			importLines = append(importLines, singleImport)
+		}
+	}
+	return importLines
+}
+
+func (g *genVisitor) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	log.Infof("Generating visitor for interface %v", t)
+
+	raw := c.Namers["raw"]
+	public := c.Namers["public"]
+	name := public.Name(t)
+	variants := g.requested[t]
+
+	// The name of the variant in method and parameter names.
+	variantName := func(v *types.Type) string {
+		if v.Kind == types.Pointer {
+			return public.Name(v.Elem)
+		}
+		return public.Name(v)
+	}
+
+	b := &bytes.Buffer{}
+	fmt.Fprintf(b, "// %sVisitor is implemented by code handling every variant of %s. A\n", name, t.Name.Name)
+	fmt.Fprintf(b, "// variant added to %s adds a method here, so that visitors stop compiling\n", t.Name.Name)
+	fmt.Fprintf(b, "// until they handle it.\n")
+	fmt.Fprintf(b, "type %sVisitor interface {\n", name)
+	for _, v := range variants {
+		fmt.Fprintf(b, "Visit%s(%s)\n", variantName(v), raw.Name(v))
+	}
+	fmt.Fprintf(b, "}\n\n")
+
+	panicf := raw.Name(types.Ref("fmt", "Sprintf"))
+	fmt.Fprintf(b, "// Visit%s calls the method of visitor for the variant v is. It panics if v\n", name)
+	fmt.Fprintf(b, "// is nil or of a type which is not a variant of %s.\n", t.Name.Name)
+	fmt.Fprintf(b, "func Visit%s(v %s, visitor %sVisitor) {\n", name, raw.Name(t), name)
+	fmt.Fprintf(b, "switch v := v.(type) {\n")
+	for _, v := range variants {
+		fmt.Fprintf(b, "case %s:\n", raw.Name(v))
+		fmt.Fprintf(b, "visitor.Visit%s(v)\n", variantName(v))
+	}
+	fmt.Fprintf(b, "default:\n")
+	fmt.Fprintf(b, "panic(%s(\"unknown %s variant %%T\", v))\n", panicf, t.Name.Name)
+	fmt.Fprintf(b, "}\n")
+	fmt.Fprintf(b, "}\n\n")
+
+	params := []string{}
+	for _, v := range variants {
+		params = append(params, fmt.Sprintf("on%s func(%s)", variantName(v), raw.Name(v)))
+	}
+	fmt.Fprintf(b, "// Switch%s calls the func for the variant v is, which may be nil to ignore\n", name)
+	fmt.Fprintf(b, "// the variant. A variant added to %s adds a parameter here, so that\n", t.Name.Name)
+	fmt.Fprintf(b, "// callers stop compiling until they handle it. It panics if v is nil or of\n")
+	fmt.Fprintf(b, "// a type which is not a variant of %s.\n", t.Name.Name)
+	fmt.Fprintf(b, "func Switch%s(v %s, %s) {\n", name, raw.Name(t), strings.Join(params, ", "))
+	fmt.Fprintf(b, "switch v := v.(type) {\n")
+	for _, v := range variants {
+		fmt.Fprintf(b, "case %s:\n", raw.Name(v))
+		fmt.Fprintf(b, "if on%s != nil {\n", variantName(v))
+		fmt.Fprintf(b, "on%s(v)\n", variantName(v))
+		fmt.Fprintf(b, "}\n")
+	}
+	fmt.Fprintf(b, "default:\n")
+	fmt.Fprintf(b, "panic(%s(\"unknown %s variant %%T\", v))\n", panicf, t.Name.Name)
+	fmt.Fprintf(b, "}\n")
+	fmt.Fprintf(b, "}\n\n")
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
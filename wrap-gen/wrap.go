@@ -0,0 +1,292 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package wrap_gen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/namer"
+	"github.com/lack-io/gogogen/gogenerator/types"
+	"github.com/lack-io/gogogen/util/log"
+	"github.com/lack-io/gogogen/util/sets"
+)
+
+// This is the comment tag that asks for a wrapper of an interface.
+const tagName = "gogogen:wrap"
+
+// wrapPackage holds the observers the generated wrappers tell of calls.
+const wrapPackage = "github.com/lack-io/gogogen/runtime/wrap"
+
+// NameSystems returns the name system used by the generators in this package.
+func NameSystems() namer.NameSystems {
+	return namer.NameSystems{
+		"public": namer.NewPublicNamer(0),
+		"raw":    namer.NewRawNamer("", nil),
+	}
+}
+
+// DefaultNameSystem returns the default name system for ordering the types to
+// be processed by the generators in this package.
+func DefaultNameSystem() string {
+	return "public"
+}
+
+// wantsWrapper returns true if a wrapper is requested for the interface 't'.
+func wantsWrapper(t *types.Type) bool {
+	comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
+	values := types.ExtractCommentTags("+", comments)[tagName]
+	if len(values) == 0 {
+		return false
+	}
+	if len(values) > 1 {
+		log.Fatalf("Type %v: found %d %s tags: %q", t, len(values), tagName, values)
+	}
+	switch values[0] {
+	case "", "true":
+		return true
+	case "false":
+		return false
+	}
+	log.Fatalf("Type %v: unsupported %s value: %q", t, tagName, values[0])
+	return false
+}
+
+func Packages(context *generator.Context, arguments *args.GeneratorArgs) generator.Packages {
+	boilerplate, err := arguments.LoadGoBoilerplate()
+	if err != nil {
+		log.Fatalf("Failed loading boilerplate: %v", err)
+	}
+
+	packages := generator.Packages{}
+	header := append(arguments.GeneratedBuildConstraint(), boilerplate...)
+
+	for i := range sets.NewString(context.Inputs...) {
+		log.Debugf("Considering pkg %q", i)
+		pkg := context.Universe[i]
+		if pkg == nil {
+			// If the input had no Go files, for example.
+			continue
+		}
+
+		requested := map[*types.Type]bool{}
+		for _, t := range pkg.SortedTypes() {
+			if t.Kind == types.Interface && len(t.Methods) > 0 && wantsWrapper(t) {
+				requested[t] = true
+			}
+		}
+		if len(requested) == 0 {
+			continue
+		}
+
+		log.Infof("Package %q needs generation", i)
+		packages = append(packages,
+			&generator.DefaultPackage{
+				PackageName: strings.Split(filepath.Base(pkg.Path), ".")[0],
+				PackagePath: pkg.Path,
+				HeaderText:  header,
+				GeneratorFunc: func(c *generator.Context) (generators []generator.Generator) {
+					return []generator.Generator{
+						NewGenWrap(arguments.OutputFileName(pkg, "wrap"), pkg.Path, requested),
+					}
+				},
+				FilterFunc: func(c *generator.Context, t *types.Type) bool {
+					return t.Name.Package == pkg.Path
+				},
+			})
+	}
+	return packages
+}
+
+// genWrap produces a file with the wrappers of the interfaces of a package.
+type genWrap struct {
+	generator.DefaultGen
+	targetPackage string
+	imports       namer.ImportTracker
+	requested     map[*types.Type]bool
+}
+
+func NewGenWrap(sanitizedName, targetPackage string, requested map[*types.Type]bool) generator.Generator {
+	return &genWrap{
+		DefaultGen: generator.DefaultGen{
+			OptionalName: sanitizedName,
+		},
+		targetPackage: targetPackage,
+		imports:       generator.NewImportTracker(),
+		requested:     requested,
+	}
+}
+
+func (g *genWrap) Namers(c *generator.Context) namer.NameSystems {
+	// Have the raw namer for this file track what it imports.
+	return namer.NameSystems{
+		"raw": namer.NewRawNamer(g.targetPackage, g.imports),
+	}
+}
+
+func (g *genWrap) Filter(c *generator.Context, t *types.Type) bool {
+	return g.requested[t]
+}
+
+func (g *genWrap) isOtherPackage(pkg string) bool {
+	if pkg == g.targetPackage {
+		return false
+	}
+	if strings.HasSuffix(pkg, "\""+g.targetPackage+"\"") {
+		return false
+	}
+	return true
+}
+
+func (g *genWrap) Imports(c *generator.Context) (imports []string) {
+	importLines := []string{}
+	for _, singleImport := range g.imports.ImportLines() {
+		if g.isOtherPackage(singleImport) {
+			importLines = append(importLines, singleImport)
+		}
+	}
+	return importLines
+}
+
+func (g *genWrap) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	log.Infof("Generating wrapper for interface %v", t)
+
+	raw := c.Namers["raw"]
+	names := []string{}
+	for name := range t.Methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	wrapper := c.Namers["public"].Name(t) + "Wrapper"
+	sw := generator.NewSnippetWriter(w, c, "$", "$")
+	sw.Do(wrapperCode, generator.Args{
+		"type":     t,
+		"wrapper":  wrapper,
+		"name":     fmt.Sprintf("%q", t.Name.Name),
+		"Observer": types.Ref(wrapPackage, "Observer"),
+		"Chain":    types.Ref(wrapPackage, "Chain"),
+	})
+	if err := sw.Error(); err != nil {
+		return err
+	}
+	b := &bytes.Buffer{}
+	for _, name := range names {
+		writeMethod(b, raw, t, wrapper, name)
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+var wrapperCode = `// $.wrapper$ wraps a $.type|raw$, telling an observer of every call made
+// through it, along with its duration and error.
+type $.wrapper$ struct {
+	next     $.type|raw$
+	observer $.Observer|raw$
+}
+
+var _ $.type|raw$ = &$.wrapper${}
+
+// Wrap$.type|public$ returns a wrapper of next, telling the observers of every call
+// made through it.
+func Wrap$.type|public$(next $.type|raw$, observers ...$.Observer|raw$) *$.wrapper$ {
+	return &$.wrapper${next: next, observer: $.Chain|raw$(observers...)}
+}
+
+`
+
+// writeMethod writes the method 'name' of the wrapper of 't'. The names of
+// the parameters in the interface are kept where they don't collide with
+// the local names of the generated code.
+func writeMethod(b *bytes.Buffer, raw namer.Namer, t *types.Type, wrapper, name string) {
+	sig := t.Methods[name].Signature
+	contextType := types.Ref("context", "Context")
+	used := map[string]bool{"wrapper": true, "call": true}
+	params, args := []string{}, []string{}
+	ctx := ""
+	for i, pt := range sig.Parameters {
+		v := ""
+		if i < len(sig.ParameterNames) {
+			v = sig.ParameterNames[i]
+		}
+		if len(v) == 0 || v == "_" || used[v] {
+			v = fmt.Sprintf("p%d", i)
+		}
+		for used[v] {
+			v += "_"
+		}
+		used[v] = true
+		if i == 0 && pt.Name == contextType.Name {
+			ctx = v
+		}
+		if sig.Variadic && i == len(sig.Parameters)-1 && pt.Kind == types.Slice {
+			params = append(params, v+" ..."+raw.Name(pt.Elem))
+			args = append(args, v+"...")
+		} else {
+			params = append(params, v+" "+raw.Name(pt))
+			args = append(args, v)
+		}
+	}
+	results, resultTypes := []string{}, []string{}
+	for i, rt := range sig.Results {
+		v := fmt.Sprintf("r%d", i)
+		for used[v] {
+			v += "_"
+		}
+		used[v] = true
+		results = append(results, v)
+		resultTypes = append(resultTypes, raw.Name(rt))
+	}
+	resultList := ""
+	switch len(resultTypes) {
+	case 0:
+	case 1:
+		resultList = " " + resultTypes[0]
+	default:
+		resultList = " (" + strings.Join(resultTypes, ", ") + ")"
+	}
+	callErr := "nil"
+	if n := len(sig.Results); n > 0 && sig.Results[n-1].Name.Package == "" && sig.Results[n-1].Name.Name == "error" {
+		callErr = results[n-1]
+	}
+
+	fmt.Fprintf(b, "// %s calls %s on the wrapped %s.\n", name, name, t.Name.Name)
+	fmt.Fprintf(b, "func (wrapper *%s) %s(%s)%s {\n", wrapper, name, strings.Join(params, ", "), resultList)
+	if len(ctx) > 0 {
+		fmt.Fprintf(b, "%s, call := %s(%s, wrapper.observer, %q, %q)\n", ctx, raw.Name(types.Ref(wrapPackage, "Start")), ctx, t.Name.Name, name)
+	} else {
+		ctx = "ctx"
+		for used[ctx] {
+			ctx += "_"
+		}
+		fmt.Fprintf(b, "%s, call := %s(%s(), wrapper.observer, %q, %q)\n", ctx, raw.Name(types.Ref(wrapPackage, "Start")), raw.Name(types.Ref("context", "Background")), t.Name.Name, name)
+	}
+	if len(results) > 0 {
+		fmt.Fprintf(b, "%s := wrapper.next.%s(%s)\n", strings.Join(results, ", "), name, strings.Join(args, ", "))
+	} else {
+		fmt.Fprintf(b, "wrapper.next.%s(%s)\n", name, strings.Join(args, ", "))
+	}
+	fmt.Fprintf(b, "call.End(%s, %s)\n", ctx, callErr)
+	if len(results) > 0 {
+		fmt.Fprintf(b, "return %s\n", strings.Join(results, ", "))
+	}
+	fmt.Fprintf(b, "}\n\n")
+}
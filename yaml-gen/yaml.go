@@ -0,0 +1,868 @@
+// Copyright 2020 lack
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package yaml_gen
+
+import (
+	"io"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/lack-io/gogogen/gogenerator/args"
+	"github.com/lack-io/gogogen/gogenerator/generator"
+	"github.com/lack-io/gogogen/gogenerator/namer"
+	"github.com/lack-io/gogogen/gogenerator/types"
+	"github.com/lack-io/gogogen/util/log"
+	"github.com/lack-io/gogogen/util/sets"
+)
+
+// This is the comment tag that carries parameters for YAML generation.
+const tagName = "gogogen:yaml-gen"
+
+// tagValuePackage, on a package, asks for YAML methods for every struct type
+// in it.
+const tagValuePackage = "package"
+
+// yamlutilPackage holds the helpers the generated code calls.
+const yamlutilPackage = "github.com/lack-io/gogogen/runtime/yamlutil"
+
+// NameSystems returns the name system used by the generators in this package.
+func NameSystems() namer.NameSystems {
+	return namer.NameSystems{
+		"public": namer.NewPublicNamer(0),
+		"raw":    namer.NewRawNamer("", nil),
+	}
+}
+
+// DefaultNameSystem returns the default name system for ordering the types to
+// be processed by the generators in this package.
+func DefaultNameSystem() string {
+	return "public"
+}
+
+// wantsYAML returns true if YAML methods are requested for 't', either by its
+// own tag or by the tag of its package.
+func wantsYAML(t *types.Type, ptagValue string) bool {
+	comments := append(append([]string{}, t.SecondClosestCommentLines...), t.CommentLines...)
+	values := types.ExtractCommentTags("+", comments)[tagName]
+	if len(values) > 1 {
+		log.Fatalf("Type %v: found %d %s tags: %q", t, len(values), tagName, values)
+	}
+	if len(values) == 1 {
+		switch values[0] {
+		case "", "true":
+			return true
+		case "false":
+			return false
+		default:
+			log.Fatalf("Type %v: unsupported %s value: %q", t, tagName, values[0])
+		}
+	}
+	return ptagValue == tagValuePackage
+}
+
+func Packages(context *generator.Context, arguments *args.GeneratorArgs) generator.Packages {
+	boilerplate, err := arguments.LoadGoBoilerplate()
+	if err != nil {
+		log.Fatalf("Failed loading boilerplate: %v", err)
+	}
+
+	packages := generator.Packages{}
+	header := append(arguments.GeneratedBuildConstraint(), boilerplate...)
+
+	for i := range sets.NewString(context.Inputs...) {
+		log.Debugf("Considering pkg %q", i)
+		pkg := context.Universe[i]
+		if pkg == nil {
+			// If the input had no Go files, for example.
+			continue
+		}
+
+		ptagValue := ""
+		if values := types.ExtractCommentTags("+", pkg.Comments)[tagName]; len(values) > 0 {
+			ptagValue = values[0]
+			if ptagValue != tagValuePackage {
+				log.Fatalf("Package %v: unsupported %s value: %q", i, tagName, ptagValue)
+			}
+		}
+
+		structs := map[*types.Type]bool{}
+		for _, t := range pkg.SortedTypes() {
+			if t.Kind == types.Struct && wantsYAML(t, ptagValue) {
+				structs[t] = true
+			}
+		}
+		if len(structs) == 0 {
+			continue
+		}
+
+		log.Infof("Package %q needs generation", i)
+		packages = append(packages,
+			&generator.DefaultPackage{
+				PackageName: strings.Split(filepath.Base(pkg.Path), ".")[0],
+				PackagePath: pkg.Path,
+				HeaderText:  header,
+				GeneratorFunc: func(c *generator.Context) (generators []generator.Generator) {
+					return []generator.Generator{
+						NewGenYAML(arguments.OutputFileName(pkg, "yaml"), pkg.Path, structs),
+					}
+				},
+				FilterFunc: func(c *generator.Context, t *types.Type) bool {
+					return t.Name.Package == pkg.Path
+				},
+			})
+	}
+	return packages
+}
+
+// yamlField is a member of a struct, or of a struct inlined in it, which is
+// encoded as a key of the YAML mapping.
+type yamlField struct {
+	// The YAML key.
+	Name string
+	// The members leading from the struct to the field.
+	Path      []types.Member
+	OmitEmpty bool
+	Flow      bool
+}
+
+func (f yamlField) Type() *types.Type {
+	return f.Path[len(f.Path)-1].Type
+}
+
+func isExported(name string) bool {
+	r, _ := utf8.DecodeRuneInString(name)
+	return unicode.IsUpper(r)
+}
+
+func underlying(t *types.Type) *types.Type {
+	if t.Kind == types.Alias {
+		return t.Underlying
+	}
+	return t
+}
+
+// yamlFields returns the fields of 't' in the order, and with the keys, the
+// go-yaml packages use for them, along with the map inlined into 't', if any,
+// which holds the keys matching no field.
+func yamlFields(t *types.Type) ([]yamlField, *yamlField) {
+	fields := []yamlField{}
+	var inlineMap *yamlField
+	var walk func(t *types.Type, path []types.Member, visited map[*types.Type]bool)
+	walk = func(st *types.Type, path []types.Member, visited map[*types.Type]bool) {
+		if visited[st] {
+			log.Fatalf("Type %v: %v is inlined into itself", t, st)
+		}
+		visited[st] = true
+		defer delete(visited, st)
+		for _, m := range st.Members {
+			tag := reflect.StructTag(m.Tags).Get("yaml")
+			if tag == "-" {
+				continue
+			}
+			parts := strings.Split(tag, ",")
+			f := yamlField{
+				Name: parts[0],
+				Path: append(append([]types.Member{}, path...), m),
+			}
+			inline := false
+			for _, opt := range parts[1:] {
+				switch opt {
+				case "omitempty":
+					f.OmitEmpty = true
+				case "flow":
+					f.Flow = true
+				case "inline":
+					inline = true
+				default:
+					log.Fatalf("Type %v: unsupported flag %q in tag %q of member %s", t, opt, tag, m.Name)
+				}
+			}
+			if !inline && !isExported(m.Name) {
+				continue
+			}
+			if !inline {
+				if f.Name == "" {
+					f.Name = strings.ToLower(m.Name)
+				}
+				fields = append(fields, f)
+				continue
+			}
+
+			it := underlying(m.Type)
+			if it.Kind == types.Pointer && underlying(it.Elem).Kind == types.Struct {
+				it = underlying(it.Elem)
+			}
+			switch {
+			case it.Kind == types.Struct:
+				walk(it, f.Path, visited)
+			case it.Kind == types.Map && isStringKind(it.Key):
+				if inlineMap != nil {
+					log.Fatalf("Type %v: multiple ,inline maps in struct", t)
+				}
+				inlineMap = &f
+			default:
+				log.Fatalf("Type %v: option ,inline of member %s needs a struct value or map field", t, m.Name)
+			}
+		}
+	}
+	walk(t, nil, map[*types.Type]bool{})
+
+	seen := map[string]bool{}
+	for _, f := range fields {
+		if seen[f.Name] {
+			log.Fatalf("Type %v: duplicated key %q in struct", t, f.Name)
+		}
+		seen[f.Name] = true
+	}
+	return fields, inlineMap
+}
+
+// builtinName returns the name of the builtin underlying 't', or "".
+func builtinName(t *types.Type) string {
+	if u := underlying(t); u.Kind == types.Builtin {
+		return u.Name.Name
+	}
+	return ""
+}
+
+func isStringKind(t *types.Type) bool {
+	return builtinName(t) == "string"
+}
+
+func isIntKind(t *types.Type) bool {
+	name := builtinName(t)
+	return strings.HasPrefix(name, "int") || strings.HasPrefix(name, "uint") || name == "byte" || name == "rune"
+}
+
+// typeName returns the name of 't' as reflect writes it, for errors.
+func typeName(t *types.Type) string {
+	switch t.Kind {
+	case types.Pointer:
+		return "*" + typeName(t.Elem)
+	case types.Slice:
+		return "[]" + typeName(t.Elem)
+	case types.Array:
+		return t.Name.Name[:strings.Index(t.Name.Name, "]")+1] + typeName(t.Elem)
+	case types.Map:
+		return "map[" + typeName(t.Key) + "]" + typeName(t.Elem)
+	}
+	if t.Name.Package == "" {
+		return t.Name.Name
+	}
+	return path.Base(t.Name.Package) + "." + t.Name.Name
+}
+
+// genYAML produces a file with the YAML methods of the structs of a package.
+type genYAML struct {
+	generator.DefaultGen
+	targetPackage string
+	imports       namer.ImportTracker
+	structs       map[*types.Type]bool
+}
+
+func NewGenYAML(sanitizedName, targetPackage string, structs map[*types.Type]bool) generator.Generator {
+	return &genYAML{
+		DefaultGen: generator.DefaultGen{
+			OptionalName: sanitizedName,
+		},
+		targetPackage: targetPackage,
+		imports:       generator.NewImportTracker(),
+		structs:       structs,
+	}
+}
+
+func (g *genYAML) Namers(c *generator.Context) namer.NameSystems {
+	// Have the raw namer for this file track what it imports.
+	return namer.NameSystems{
+		"raw": namer.NewRawNamer(g.targetPackage, g.imports),
+	}
+}
+
+func (g *genYAML) Filter(c *generator.Context, t *types.Type) bool {
+	return g.structs[t]
+}
+
+func (g *genYAML) isOtherPackage(pkg string) bool {
+	if pkg == g.targetPackage {
+		return false
+	}
+	if strings.HasSuffix(pkg, "\""+g.targetPackage+"\"") {
+		return false
+	}
+	return true
+}
+
+func (g *genYAML) Imports(c *generator.Context) (imports []string) {
+	importLines := []string{}
+	for _, singleImport := range g.imports.ImportLines() {
+		if g.isOtherPackage(singleImport) {
+			importLines = append(importLines, singleImport)
+		}
+	}
+	return importLines
+}
+
+// valueKind says how the generated code encodes a value.
+type valueKind int
+
+const (
+	unsupportedKind valueKind = iota
+	// The type has YAML methods of its own, generated or not.
+	selfKind
+	durationKind
+	// The type has MarshalText and UnmarshalText methods.
+	textKind
+	stringKind
+	boolKind
+	intKind
+	uintKind
+	floatKind
+	interfaceKind
+	pointerKind
+	sliceKind
+	arrayKind
+	mapKind
+)
+
+func (g *genYAML) kindOf(t *types.Type) valueKind {
+	if g.structs[t] {
+		return selfKind
+	}
+	if _, ok := t.Methods["EncodeYAMLTo"]; ok {
+		if _, ok := t.Methods["DecodeYAMLNode"]; ok {
+			return selfKind
+		}
+	}
+	if t.Name == (types.Name{Package: "time", Name: "Duration"}) {
+		return durationKind
+	}
+	if _, ok := t.Methods["MarshalText"]; ok {
+		if _, ok := t.Methods["UnmarshalText"]; ok {
+			return textKind
+		}
+	}
+	switch name := builtinName(t); {
+	case name == "string":
+		return stringKind
+	case name == "bool":
+		return boolKind
+	case name == "float32" || name == "float64":
+		return floatKind
+	case strings.HasPrefix(name, "uint") || name == "byte":
+		return uintKind
+	case strings.HasPrefix(name, "int") || name == "rune":
+		return intKind
+	case name != "":
+		return unsupportedKind
+	}
+	switch u := underlying(t); u.Kind {
+	case types.Interface:
+		if len(u.Methods) == 0 {
+			return interfaceKind
+		}
+	case types.Pointer:
+		return pointerKind
+	case types.Slice:
+		return sliceKind
+	case types.Array:
+		return arrayKind
+	case types.Map:
+		if isStringKind(u.Key) || isIntKind(u.Key) {
+			return mapKind
+		}
+	}
+	return unsupportedKind
+}
+
+// baseArgs returns the template arguments shared by all snippets.
+func baseArgs() generator.Args {
+	args := generator.Args{
+		"sort": types.Ref("sort", "Slice"),
+	}
+	for _, name := range []string{"Encoder", "Decoder", "Node", "NewEncoder", "NewDecoder", "Parse"} {
+		args[name] = types.Ref(yamlutilPackage, name)
+	}
+	return args
+}
+
+func (g *genYAML) GenerateType(c *generator.Context, t *types.Type, w io.Writer) error {
+	log.Infof("Generating YAML methods for type %v", t)
+
+	fields, inlineMap := yamlFields(t)
+	sw := generator.NewSnippetWriter(w, c, "$", "$")
+	e := &emitter{g: g, sw: sw, t: t}
+	args := baseArgs().With("type", t).With("into", strconv.Quote(typeName(t)))
+
+	sw.Do("// EncodeYAML returns the YAML encoding of in.\n", nil)
+	sw.Do("func (in $.type|raw$) EncodeYAML() ([]byte, error) {\n", args)
+	sw.Do("e := $.NewEncoder|raw$()\n", args)
+	sw.Do("in.EncodeYAMLTo(e)\n", nil)
+	sw.Do("return e.Bytes()\n", nil)
+	sw.Do("}\n\n", nil)
+
+	sw.Do("// EncodeYAMLTo writes in to e, as a mapping.\n", nil)
+	sw.Do("func (in *$.type|raw$) EncodeYAMLTo(e *$.Encoder|raw$) {\n", args)
+	sw.Do("e.BeginMapping()\n", nil)
+	for _, f := range fields {
+		e.writeMarshalField(f)
+	}
+	if inlineMap != nil {
+		e.writeMarshalInlineMap(*inlineMap)
+	}
+	sw.Do("e.EndMapping()\n", nil)
+	sw.Do("}\n\n", nil)
+
+	sw.Do("// DecodeYAML decodes the YAML document in data into out. Keys matching\n", nil)
+	sw.Do("// no field, anchors and aliases are errors.\n", nil)
+	sw.Do("func (out *$.type|raw$) DecodeYAML(data []byte) error {\n", args)
+	sw.Do("n, err := $.Parse|raw$(data)\n", args)
+	sw.Do("if err != nil || n == nil {\n", nil)
+	sw.Do("return err\n", nil)
+	sw.Do("}\n", nil)
+	sw.Do("d := $.NewDecoder|raw$()\n", args)
+	sw.Do("out.DecodeYAMLNode(d, n)\n", nil)
+	sw.Do("return d.Error()\n", nil)
+	sw.Do("}\n\n", nil)
+
+	sw.Do("// DecodeYAMLNode decodes n into out, reporting errors to d.\n", nil)
+	sw.Do("func (out *$.type|raw$) DecodeYAMLNode(d *$.Decoder|raw$, n *$.Node|raw$) {\n", args)
+	sw.Do("if d.Null(n) {\n", nil)
+	sw.Do("*out = $.type|raw${}\n", args)
+	sw.Do("return\n", nil)
+	sw.Do("}\n", nil)
+	sw.Do("if !d.Mapping(n, $.into$) {\n", args)
+	sw.Do("return\n", nil)
+	sw.Do("}\n", nil)
+	sw.Do("for i := 0; i+1 < len(n.Content); i += 2 {\n", nil)
+	sw.Do("k, v := n.Content[i], n.Content[i+1]\n", nil)
+	sw.Do("switch d.Key(k) {\n", nil)
+	for _, f := range fields {
+		sw.Do("case $.$:\n", strconv.Quote(f.Name))
+		e.writeUnmarshalField(f)
+	}
+	sw.Do("default:\n", nil)
+	if inlineMap != nil {
+		e.writeUnmarshalInlineMap(*inlineMap)
+	} else {
+		sw.Do("d.Unknown(k, $.into$)\n", args)
+	}
+	sw.Do("}\n", nil)
+	sw.Do("}\n", nil)
+	sw.Do("}\n\n", nil)
+	return sw.Error()
+}
+
+// fieldExpr returns the selector of the member at the end of 'path' rooted
+// at 'recv', along with the inlined pointers which must be non-nil to reach
+// it.
+func fieldExpr(recv string, path []types.Member) (string, []string) {
+	expr := recv
+	pointers := []string{}
+	for i, m := range path {
+		expr += "." + m.Name
+		if i < len(path)-1 && m.Type.Kind == types.Pointer {
+			pointers = append(pointers, expr)
+		}
+	}
+	return expr, pointers
+}
+
+// nonEmpty returns the condition under which an omitempty field is encoded,
+// which is false only for values the go-yaml packages consider zero.
+func nonEmpty(expr string, t *types.Type) string {
+	if _, ok := t.Methods["IsZero"]; ok {
+		return "!" + expr + ".IsZero()"
+	}
+	u := underlying(t)
+	switch u.Kind {
+	case types.Builtin:
+		switch u.Name.Name {
+		case "string":
+			return expr + ` != ""`
+		case "bool":
+			return expr
+		}
+		return expr + " != 0"
+	case types.Pointer, types.Interface:
+		return expr + " != nil"
+	case types.Slice, types.Map:
+		return "len(" + expr + ") != 0"
+	case types.Struct:
+		// A struct is zero when all of its exported members are.
+		conds := []string{}
+		for _, m := range u.Members {
+			if !isExported(m.Name) {
+				continue
+			}
+			cond := nonEmpty(expr+"."+m.Name, m.Type)
+			if cond == "true" {
+				return cond
+			}
+			conds = append(conds, cond)
+		}
+		switch len(conds) {
+		case 0:
+			return "false"
+		case 1:
+			return conds[0]
+		}
+		return "(" + strings.Join(conds, " || ") + ")"
+	}
+	// Arrays, for one, are never zero.
+	return "true"
+}
+
+// emitter writes the code encoding and decoding the members of a struct.
+type emitter struct {
+	g  *genYAML
+	sw *generator.SnippetWriter
+	// The struct being generated for.
+	t *types.Type
+}
+
+func (e *emitter) kindOf(t *types.Type) valueKind {
+	kind := e.g.kindOf(t)
+	if kind == unsupportedKind {
+		log.Fatalf("Type %v: values of type %v can not be encoded; annotate the type for yaml-gen, or give it MarshalText and UnmarshalText methods", e.t, t)
+	}
+	return kind
+}
+
+// convert returns 'expr', of type 't', converted to the builtin 'to'.
+func convert(to, expr string, t *types.Type) string {
+	if t.Kind == types.Builtin && t.Name.Name == to {
+		return expr
+	}
+	return to + "(" + expr + ")"
+}
+
+func intBits(name string) string {
+	switch name {
+	case "int8", "uint8", "byte":
+		return "8"
+	case "int16", "uint16":
+		return "16"
+	case "int32", "uint32", "rune":
+		return "32"
+	case "int64", "uint64":
+		return "64"
+	}
+	// The size of int, uint and uintptr.
+	return "0"
+}
+
+func loopVar(name string, depth int) string {
+	return name + strconv.Itoa(depth)
+}
+
+func (e *emitter) writeMarshalField(f yamlField) {
+	expr, pointers := fieldExpr("in", f.Path)
+	conds := []string{}
+	for _, p := range pointers {
+		conds = append(conds, p+" != nil")
+	}
+	if f.OmitEmpty {
+		switch cond := nonEmpty(expr, f.Type()); cond {
+		case "false":
+			return
+		case "true":
+		default:
+			conds = append(conds, cond)
+		}
+	}
+	if len(conds) > 0 {
+		e.sw.Do("if $.$ {\n", strings.Join(conds, " && "))
+	}
+	e.sw.Do("e.Key($.$)\n", strconv.Quote(f.Name))
+	e.writeMarshalValue(expr, f.Type(), 1, f.Flow)
+	if len(conds) > 0 {
+		e.sw.Do("}\n", nil)
+	}
+}
+
+func (e *emitter) writeMarshalInlineMap(f yamlField) {
+	expr, pointers := fieldExpr("in", f.Path)
+	for _, p := range pointers {
+		e.sw.Do("if $.$ != nil {\n", p)
+	}
+	e.writeMarshalEntries(expr, underlying(f.Type()), 1)
+	for range pointers {
+		e.sw.Do("}\n", nil)
+	}
+}
+
+// writeMarshalValue emits code writing the addressable value 'expr' of type
+// 't' to e. Loop variables are numbered by 'depth'.
+func (e *emitter) writeMarshalValue(expr string, t *types.Type, depth int, flow bool) {
+	args := baseArgs().With("expr", expr).With("type", t)
+	kind := e.kindOf(t)
+	if flow {
+		switch kind {
+		case selfKind, sliceKind, arrayKind, mapKind:
+			e.sw.Do("e.Flow()\n", nil)
+		}
+	}
+	u := underlying(t)
+	switch kind {
+	case selfKind:
+		e.sw.Do("$.expr$.EncodeYAMLTo(e)\n", args)
+	case durationKind:
+		e.sw.Do("e.String($.expr$.String())\n", args)
+	case textKind:
+		e.sw.Do("e.Text(&$.expr$)\n", args)
+	case stringKind:
+		e.sw.Do("e.String($.$)\n", convert("string", expr, t))
+	case boolKind:
+		e.sw.Do("e.Bool($.$)\n", convert("bool", expr, t))
+	case intKind:
+		e.sw.Do("e.Int($.$)\n", convert("int64", expr, t))
+	case uintKind:
+		e.sw.Do("e.Uint($.$)\n", convert("uint64", expr, t))
+	case floatKind:
+		e.sw.Do("e.Float($.value$, $.bits$)\n", generator.Args{
+			"value": convert("float64", expr, t),
+			"bits":  strings.TrimPrefix(builtinName(t), "float"),
+		})
+	case interfaceKind:
+		e.sw.Do("e.Interface($.expr$)\n", args)
+	case pointerKind:
+		e.sw.Do("if $.expr$ == nil {\n", args)
+		e.sw.Do("e.Null()\n", nil)
+		e.sw.Do("} else {\n", nil)
+		if e.g.kindOf(u.Elem) == selfKind {
+			e.writeMarshalValue(expr, u.Elem, depth, flow)
+		} else {
+			e.writeMarshalValue("(*"+expr+")", u.Elem, depth, flow)
+		}
+		e.sw.Do("}\n", nil)
+	case sliceKind, arrayKind:
+		i := loopVar("i", depth)
+		if kind == sliceKind {
+			e.writeMarshalNil(expr)
+		}
+		e.sw.Do("e.BeginSequence()\n", nil)
+		e.sw.Do("for $.i$ := range $.expr$ {\n", args.With("i", i))
+		e.writeMarshalValue(expr+"["+i+"]", u.Elem, depth+1, false)
+		e.sw.Do("}\n", nil)
+		e.sw.Do("e.EndSequence()\n", nil)
+		if kind == sliceKind {
+			e.sw.Do("}\n", nil)
+		}
+	case mapKind:
+		e.writeMarshalNil(expr)
+		e.sw.Do("e.BeginMapping()\n", nil)
+		e.writeMarshalEntries(expr, u, depth)
+		e.sw.Do("e.EndMapping()\n", nil)
+		e.sw.Do("}\n", nil)
+	}
+}
+
+// writeMarshalNil opens a block writing the slice or map 'expr' unless it is
+// nil, in which case null is written, so that nil values are decoded back as
+// nil.
+func (e *emitter) writeMarshalNil(expr string) {
+	e.sw.Do("if $.$ == nil {\n", expr)
+	e.sw.Do("e.Null()\n", nil)
+	e.sw.Do("} else {\n", nil)
+}
+
+// writeMarshalEntries emits code writing the entries of the map 'expr' of
+// type 'u', sorted by key.
+func (e *emitter) writeMarshalEntries(expr string, u *types.Type, depth int) {
+	args := baseArgs().With("expr", expr).With("key", u.Key).
+		With("keys", loopVar("keys", depth)).With("k", loopVar("k", depth)).With("v", loopVar("v", depth)).
+		With("a", loopVar("a", depth)).With("b", loopVar("b", depth))
+	sw := e.sw
+	sw.Do("$.keys$ := make([]$.key|raw$, 0, len($.expr$))\n", args)
+	sw.Do("for $.k$ := range $.expr$ {\n", args)
+	sw.Do("$.keys$ = append($.keys$, $.k$)\n", args)
+	sw.Do("}\n", nil)
+	sw.Do("$.sort|raw$($.keys$, func($.a$, $.b$ int) bool { return $.keys$[$.a$] < $.keys$[$.b$] })\n", args)
+	sw.Do("for _, $.k$ := range $.keys$ {\n", args)
+	switch k := loopVar("k", depth); {
+	case isStringKind(u.Key):
+		sw.Do("e.Key($.$)\n", convert("string", k, u.Key))
+	case strings.HasPrefix(builtinName(u.Key), "uint") || builtinName(u.Key) == "byte":
+		sw.Do("e.UintKey($.$)\n", convert("uint64", k, u.Key))
+	default:
+		sw.Do("e.IntKey($.$)\n", convert("int64", k, u.Key))
+	}
+	sw.Do("$.v$ := $.expr$[$.k$]\n", args)
+	e.writeMarshalValue(loopVar("v", depth), u.Elem, depth+1, false)
+	sw.Do("}\n", nil)
+}
+
+// allocate emits code allocating the nil inlined pointers of 'f'.
+func (e *emitter) allocate(f yamlField, pointers []string) {
+	for i, p := range pointers {
+		e.sw.Do("if $.$ == nil {\n", p)
+		e.sw.Do("$.expr$ = new($.type|raw$)\n", generator.Args{
+			"expr": p,
+			"type": underlying(f.Path[i].Type).Elem,
+		})
+		e.sw.Do("}\n", nil)
+	}
+}
+
+func (e *emitter) writeUnmarshalField(f yamlField) {
+	expr, pointers := fieldExpr("out", f.Path)
+	e.allocate(f, pointers)
+	e.writeUnmarshalValue(expr, "v", f.Type(), 1)
+}
+
+func (e *emitter) writeUnmarshalInlineMap(f yamlField) {
+	expr, pointers := fieldExpr("out", f.Path)
+	e.allocate(f, pointers)
+	u := underlying(f.Type())
+	args := generator.Args{"expr": expr, "type": f.Type(), "elem": u.Elem}
+	e.sw.Do("if $.expr$ == nil {\n", args)
+	e.sw.Do("$.expr$ = make($.type|raw$)\n", args)
+	e.sw.Do("}\n", nil)
+	e.declare("value", "v", u.Elem, 1)
+	if u.Key.Kind == types.Builtin {
+		e.sw.Do("$.expr$[d.Key(k)] = value\n", args)
+	} else {
+		e.sw.Do("$.expr$[$.key|raw$(d.Key(k))] = value\n", args.With("key", u.Key))
+	}
+}
+
+// writeUnmarshalValue emits code decoding the node 'node' into the
+// addressable value 'expr' of type 't'. Loop variables are numbered by
+// 'depth'.
+func (e *emitter) writeUnmarshalValue(expr, node string, t *types.Type, depth int) {
+	u := underlying(t)
+	args := baseArgs().With("expr", expr).With("node", node).With("type", t).
+		With("elem", u.Elem).With("into", strconv.Quote(typeName(t)))
+	sw := e.sw
+	if read, readType, ok := e.readScalar(t, node); ok {
+		e.assign(expr, "=", t, read, readType)
+		return
+	}
+	switch e.kindOf(t) {
+	case selfKind:
+		sw.Do("$.expr$.DecodeYAMLNode(d, $.node$)\n", args)
+		return
+	case textKind:
+		sw.Do("d.Text($.node$, &$.expr$)\n", args)
+		return
+	case pointerKind:
+		sw.Do("if d.Null($.node$) {\n", args)
+		sw.Do("$.expr$ = nil\n", args)
+		sw.Do("} else {\n", nil)
+		sw.Do("if $.expr$ == nil {\n", args)
+		sw.Do("$.expr$ = new($.elem|raw$)\n", args)
+		sw.Do("}\n", nil)
+		if e.g.kindOf(u.Elem) == selfKind {
+			e.writeUnmarshalValue(expr, node, u.Elem, depth)
+		} else {
+			e.writeUnmarshalValue("(*"+expr+")", node, u.Elem, depth)
+		}
+		sw.Do("}\n", nil)
+		return
+	case sliceKind:
+		args = args.With("i", loopVar("i", depth)).With("n", loopVar("n", depth))
+		sw.Do("if d.Sequence($.node$, $.into$) {\n", args)
+		sw.Do("$.expr$ = make($.type|raw$, len($.node$.Content))\n", args)
+		sw.Do("for $.i$, $.n$ := range $.node$.Content {\n", args)
+		e.writeUnmarshalValue(expr+"["+loopVar("i", depth)+"]", loopVar("n", depth), u.Elem, depth+1)
+		sw.Do("}\n", nil)
+		sw.Do("} else if d.Null($.node$) {\n", args)
+		sw.Do("$.expr$ = nil\n", args)
+		sw.Do("}\n", nil)
+		return
+	case arrayKind:
+		// Like null, missing items leave the array unchanged; extra items
+		// are an error.
+		args = args.With("i", loopVar("i", depth)).With("n", loopVar("n", depth))
+		sw.Do("if d.Array($.node$, len($.expr$), $.into$) {\n", args)
+		sw.Do("for $.i$, $.n$ := range $.node$.Content {\n", args)
+		e.writeUnmarshalValue(expr+"["+loopVar("i", depth)+"]", loopVar("n", depth), u.Elem, depth+1)
+		sw.Do("}\n", nil)
+		sw.Do("}\n", nil)
+		return
+	case mapKind:
+		i, v := loopVar("i", depth), loopVar("v", depth)
+		args = args.With("i", i).With("v", v).With("key", u.Key)
+		sw.Do("if d.Mapping($.node$, $.into$) {\n", args)
+		sw.Do("if $.expr$ == nil {\n", args)
+		sw.Do("$.expr$ = make($.type|raw$, len($.node$.Content)/2)\n", args)
+		sw.Do("}\n", nil)
+		sw.Do("for $.i$ := 0; $.i$+1 < len($.node$.Content); $.i$ += 2 {\n", args)
+		k := loopVar("k", depth)
+		keyNode := node + ".Content[" + i + "]"
+		if isStringKind(u.Key) {
+			e.assign(k, ":=", u.Key, "d.Key("+keyNode+")", "string")
+		} else {
+			read, readType, _ := e.readScalar(u.Key, keyNode)
+			e.assign(k, ":=", u.Key, read, readType)
+		}
+		e.declare(v, node+".Content["+i+"+1]", u.Elem, depth+1)
+		sw.Do("$.expr$[$.k$] = $.v$\n", args.With("k", k))
+		sw.Do("}\n", nil)
+		sw.Do("} else if d.Null($.node$) {\n", args)
+		sw.Do("$.expr$ = nil\n", args)
+		sw.Do("}\n", nil)
+		return
+	}
+}
+
+// readScalar returns the expression decoding the node 'node' into a value of
+// type 't', and the type of that expression, if 't' is read by a single call.
+func (e *emitter) readScalar(t *types.Type, node string) (string, string, bool) {
+	switch e.kindOf(t) {
+	case durationKind:
+		return "d.Duration(" + node + ")", "Duration", true
+	case stringKind:
+		return "d.String(" + node + ")", "string", true
+	case boolKind:
+		return "d.Bool(" + node + ")", "bool", true
+	case floatKind:
+		return "d.Float64(" + node + ", " + strings.TrimPrefix(builtinName(t), "float") + ")", "float64", true
+	case uintKind:
+		return "d.Uint64(" + node + ", " + intBits(builtinName(t)) + ")", "uint64", true
+	case intKind:
+		return "d.Int64(" + node + ", " + intBits(builtinName(t)) + ")", "int64", true
+	case interfaceKind:
+		return "d.Interface(" + node + ")", "interface{}", true
+	}
+	return "", "", false
+}
+
+// declare emits code declaring the variable 'name' of type 't', holding the
+// node 'node' decoded.
+func (e *emitter) declare(name, node string, t *types.Type, depth int) {
+	if read, readType, ok := e.readScalar(t, node); ok {
+		e.assign(name, ":=", t, read, readType)
+		return
+	}
+	e.sw.Do("var $.name$ $.type|raw$\n", generator.Args{"name": name, "type": t})
+	e.writeUnmarshalValue(name, node, t, depth)
+}
+
+// assign emits code setting, or with ":=" declaring, 'expr' of type 't' to
+// 'read', an expression of the type named 'readType'.
+func (e *emitter) assign(expr, op string, t *types.Type, read, readType string) {
+	args := generator.Args{"expr": expr, "op": op, "type": t, "read": read}
+	if t.Name.Name == readType && (t.Kind == types.Builtin || t.Kind == types.Interface || t.Name.Package == "time") {
+		e.sw.Do("$.expr$ $.op$ $.read$\n", args)
+	} else {
+		e.sw.Do("$.expr$ $.op$ $.type|raw$($.read$)\n", args)
+	}
+}